@@ -140,6 +140,11 @@ func (a Bits) IsFloat() bool {
 	return a == Bits_16LEF || a == Bits_24LEF || a == Bits_32LEF || a == Bits_64LEF
 }
 
+// 是否可以作为内部处理的位宽
+func (a Bits) IsInternal() bool {
+	return a == Bits_32LEF || a == Bits_64LEF
+}
+
 func (a Bits) Bits() int {
 	return a.ToInt()
 }
@@ -85,6 +85,17 @@ func (a Channel) IsValid() bool {
 	return a > Channel_NONE && a < Channel_MAX
 }
 
+// Side 声道所在的一侧，-1 左侧，1 右侧，0 中间
+func (a Channel) Side() int {
+	switch a {
+	case Channel_FRONT_LEFT, Channel_FRONT_LEFT_OF_CENTER, Channel_BACK_LEFT, Channel_SIDE_LEFT, Channel_TOP_FRONT_LEFT, Channel_TOP_BACK_LEFT:
+		return -1
+	case Channel_FRONT_RIGHT, Channel_FRONT_RIGHT_OF_CENTER, Channel_BACK_RIGHT, Channel_SIDE_RIGHT, Channel_TOP_FRONT_RIGHT, Channel_TOP_BACK_RIGHT:
+		return 1
+	}
+	return 0
+}
+
 type ChannelIndex = []int8
 type ChannelMask uint32
 
@@ -111,6 +122,12 @@ func (m *ChannelMask) Add(ch Channel) {
 	}
 }
 
+func (m *ChannelMask) Del(ch Channel) {
+	if ch.IsValid() {
+		*m &^= 1 << (ch - 1)
+	}
+}
+
 func (m *ChannelMask) FromChannelSlice(arr []Channel) error {
 	if len(arr) > int(Channel_MAX) {
 		return errors.New("channels too large")
@@ -429,6 +446,7 @@ func extendLayout(a Layout, ch ...Channel) Layout {
 }
 
 type ChannelRoute struct {
-	From []Channel
-	To   Channel
+	From  []Channel
+	To    Channel
+	Gains []float64 `jp:"Gains,omitempty"` // 对应 From 的增益，缺省为 1
 }
@@ -114,11 +114,28 @@ func DefaultFormat() Format {
 	}
 }
 
-// 内部处理格式，其他无所谓，位宽必须是float64
+// 内部处理的位宽
+var internalBits = Bits_DEFAULT
+
+// SetInternalBits 设置内部处理的位宽，只支持 float32 和 float64。
+// 必须在创建任何线路和扬声器之前设置，已经创建的管道和缓存仍然使用原来的位宽，之后修改会导致两者不一致
+func SetInternalBits(b Bits) bool {
+	if !b.IsInternal() {
+		return false
+	}
+	internalBits = b
+	return true
+}
+
+func InternalBits() Bits {
+	return internalBits
+}
+
+// 内部处理格式，其他无所谓，位宽必须是 float64 或者 float32
 func InternalFormat() Format {
 	return Format{
 		Sample: Sample{
-			Bits: Bits_DEFAULT,
+			Bits: internalBits,
 		},
 	}
 }
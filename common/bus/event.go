@@ -76,6 +76,28 @@ func UnregisterObj(obj any) {
 	}
 }
 
+// 注销 RegisterObj 返回的事件
+//
+// 同一对象上其它模块注册的事件不受影响。包装后的回调函数指针相同，不能使用 Unregister
+func UnregisterHandler(hd *HandlerData) {
+	if hd == nil {
+		return
+	}
+	ll := list[hd.e]
+	for i, h := range ll {
+		if h != hd {
+			continue
+		}
+		nl := append(append([]*HandlerData{}, ll[:i]...), ll[i+1:]...)
+		if len(nl) == 0 {
+			delete(list, hd.e)
+		} else {
+			list[hd.e] = nl
+		}
+		return
+	}
+}
+
 func Dispatch(e string, args ...any) error {
 	return DispatchObj(nil, e, args...)
 }
@@ -4,9 +4,11 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/zwcway/castserver-go/common/utils"
 )
 
 func TestBus(t *testing.T) {
+	log = utils.NewEmptyContext().Logger("bus")
 
 	t.Run("unregister", func(t *testing.T) {
 		c := func(o any, a ...any) error { return nil }
@@ -17,4 +19,22 @@ func TestBus(t *testing.T) {
 		assert.Equal(t, len(list), 0)
 	})
 
+	t.Run("unregister handler", func(t *testing.T) {
+		var a, b int
+		obj := &struct{ int }{}
+		reg := func(n *int) *HandlerData {
+			return RegisterObj(obj, "unregister handler", func(o any, a ...any) error { *n++; return nil })
+		}
+		ha := reg(&a)
+		reg(&b)
+
+		UnregisterHandler(ha)
+		DispatchObj(obj, "unregister handler")
+		assert.Equal(t, 0, a)
+		assert.Equal(t, 1, b)
+
+		UnregisterObj(obj)
+		assert.Equal(t, len(list), 0)
+	})
+
 }
@@ -121,11 +121,17 @@ func FromOptions(ctx utils.Context, opts map[string]string) error {
 			HTTPListen = *iface
 			iface.AddrPort = netip.AddrPortFrom(*addr, DLNAListen.AddrPort.Port())
 			DLNAListen = *iface
+			iface.AddrPort = netip.AddrPortFrom(*addr, DLNAServerListen.AddrPort.Port())
+			DLNAServerListen = *iface
+			iface.AddrPort = netip.AddrPortFrom(*addr, AirPlayListen.AddrPort.Port())
+			AirPlayListen = *iface
 		} else {
 			ServerListen = *iface
 			ReceiveListen = *iface
 			HTTPListen = *iface
 			DLNAListen = *iface
+			DLNAServerListen = *iface
+			AirPlayListen = *iface
 		}
 	}
 
@@ -11,7 +11,6 @@ import (
 	"github.com/zwcway/castserver-go/common/audio"
 	lg "github.com/zwcway/castserver-go/common/log"
 	"github.com/zwcway/castserver-go/common/utils"
-	upnputils "github.com/zwcway/fasthttp-upnp/utils"
 	"gorm.io/gorm"
 )
 
@@ -70,6 +69,67 @@ var (
 	// 缓冲长度（单位ms），0 表示动态自动判断
 	AudioBuferMSDuration MilliDuration = 10 * time.Millisecond
 
+	// 响度标准化的默认目标响度（LUFS）
+	LoudnessTarget float64 = -18
+
+	// 音量变化的过渡时长
+	VolumeRampDuration MilliDuration = 50 * time.Millisecond
+	// 静音、暂停、停止时淡入淡出的时长
+	VolumeFadeDuration MilliDuration = 200 * time.Millisecond
+
+	// 新线路切换曲目时的交叉淡化时长，0 表示无缝衔接
+	CrossfadeDuration MilliDuration = 0
+	// 交叉淡化曲线，0 线性，1 等功率，2 S 型
+	CrossfadeCurve uint8 = 1
+	// 新线路的声道扩展方式，0 矩阵，1 环境声提取，2 不扩展
+	ChannelUpmix uint8 = 0
+	// 新线路降低位深时的抖动方式，0 不抖动，1 TPDF，2 TPDF 加噪声整形
+	DitherMode uint8 = 1
+	// 冲激响应文件所在的目录，线路只能使用其中的文件，为空时不能使用卷积
+	ConvolverDir string = ""
+	// 转码实现，ffmpeg 或者 go，没有 ffmpeg 时总是使用 go
+	ResampleEngine string = ResampleEngineFFmpeg
+	// 内部处理的位宽，f64 或者 f32。f32 占用的内存和带宽减半。只在启动时读取，修改后需要重启
+	InternalBits audio.Bits = audio.Bits_64LEF
+
+	// 播报期间其它声音压低的 dB
+	AnnounceDuck float64 = 15
+	// 播报的音量，0 至 100，与线路音量无关
+	AnnounceVolume int = 80
+	// 开始播报时压低的时间常数
+	AnnounceAttack MilliDuration = 50 * time.Millisecond
+	// 播报结束后恢复的时间常数
+	AnnounceRelease MilliDuration = 500 * time.Millisecond
+	// 播报文件所在的目录，播报只能使用其中的文件，为空时只能直接发送音频数据
+	AnnounceDir string = ""
+
+	// 线路连续静音超过该时长后停止推送，0 表示一直推送
+	SilenceTimeout MilliDuration = 10 * time.Second
+	// 从静音恢复时，先推送的静音时长，用于填充扬声器的缓存
+	SilencePreroll MilliDuration = 100 * time.Millisecond
+
+	// 频谱分析的 FFT 长度，512 至 16384 之间的 2 的幂
+	SpectrumSize int = 2048
+	// 频谱分析的窗函数，0 Hann，1 Blackman-Harris，2 平顶窗
+	SpectrumWindow uint8 = 0
+	// 频谱的指数平均系数，0 表示不平均
+	SpectrumAveraging float64 = 0
+	// 频谱峰值的保持时长
+	SpectrumPeakHold MilliDuration = 1000 * time.Millisecond
+
+	// 峰值表的峰值和削波提示的保持时长
+	MeterPeakHold MilliDuration = 2 * time.Second
+	// 峰值表的保持结束后，峰值每秒下降的 dB
+	MeterPeakDecay float64 = 20
+
+	// 定时任务错过执行时间后，启动时补执行的宽限时间
+	ScheduleMissedGrace MilliDuration = 10 * time.Minute
+
+	// 网络电台断开后重新连接的最长等待时间，从 1 秒开始加倍
+	RadioBackoffMax MilliDuration = 30 * time.Second
+	// 网络电台连续连接失败的次数上限，0 表示一直重试
+	RadioRetries int = 10
+
 	SpeakerOfflineTimeout       int = 5
 	SpeakerOfflineCheckInterval int = 5
 
@@ -88,13 +148,32 @@ var (
 	EnableDLNA     bool   = false
 	EnableAirPlay  bool   = false
 
+	// tcp，每个线路的 RTSP 端口为此端口加线路 ID，端口为 0 时随机分配
+	AirPlayListen Interface = Interface{
+		AddrPort: netip.MustParseAddrPort("0.0.0.0:5000"),
+	}
+	// 开始播放前缓冲的时长
+	AirPlayBuffer MilliDuration = 500 * time.Millisecond
+	// 加密音频使用的 RSA 私钥文件（PEM），为空时只接受不加密的音频
+	AirPlayKey string = ""
+
 	// tcp
 	DLNAListen Interface = Interface{
 		AddrPort: netip.MustParseAddrPort("0.0.0.0:4416"),
 	}
+	// 媒体服务器，向控制端提供音乐库
+	DLNAMediaServer  bool      = true
+	DLNAServerListen Interface = Interface{
+		AddrPort: netip.MustParseAddrPort("0.0.0.0:4417"),
+	}
 	DLNANotifyInterval uint8        = 30
 	DLNAAllowIps       []*net.IPNet = []*net.IPNet{}
 	DLNADenyIps        []*net.IPNet = []*net.IPNet{}
+
+	// 音乐库的目录，多个目录使用 | 分隔
+	LibraryDirs []string = []string{}
+	// 重新扫描音乐库的间隔，只读取变化的文件，0 表示只在启动时扫描
+	LibraryRescan MilliDuration = 5 * time.Minute
 )
 
 func MTU() int {
@@ -122,7 +201,7 @@ func TemporayFile(file string) string {
 	// }
 	ext := filepath.Ext(file)
 
-	return filepath.Join(ReceiveTempDir, upnputils.MakeUUID(file)+ext)
+	return filepath.Join(ReceiveTempDir, utils.MakeUUID(file)+ext)
 }
 
 func initLogger(ctx utils.Context) {
@@ -135,3 +214,8 @@ const (
 	APPNAME string = "Castspeaker Server"
 	VERSION string = "1.0"
 )
+
+const (
+	ResampleEngineFFmpeg = "ffmpeg"
+	ResampleEngineGo     = "go"
+)
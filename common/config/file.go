@@ -93,6 +93,19 @@ func parseBits(cfg reflect.Value, k *ini.Key, ck *CfgKey) {
 	}
 }
 
+func parseInternalBits(cfg reflect.Value, k *ini.Key, ck *CfgKey) {
+	if k == nil || len(k.String()) == 0 {
+		return
+	}
+	var a audio.Bits
+	a.FromName(k.String())
+	if !audio.SetInternalBits(a) {
+		log.Error("internal bits must be f32 or f64", lg.String("bits", k.String()), lg.String("key", ck.Key))
+		return
+	}
+	cfg.Set(reflect.ValueOf(a))
+}
+
 func parseRates(cfg reflect.Value, k *ini.Key, ck *CfgKey) {
 	parse := func(b string) []audio.Rate {
 		r := strings.FieldsFunc(b, func(r rune) bool {
@@ -142,6 +155,30 @@ func parsePath(cfg reflect.Value, k *ini.Key, ck *CfgKey) {
 	}
 }
 
+func parseDirs(cfg reflect.Value, k *ini.Key, ck *CfgKey) {
+	if k == nil {
+		return
+	}
+	dirs := []string{}
+	for _, dir := range strings.Split(k.String(), string(SEP)) {
+		dir = strings.TrimSpace(dir)
+		if dir == "" {
+			continue
+		}
+		if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+			log.Error("dir not exists", lg.String("dir", dir), lg.String("key", ck.Key))
+			continue
+		}
+		if abs, err := filepath.Abs(dir); err == nil {
+			dir = abs
+		}
+		if utils.SliceContains(dirs, dir) < 0 {
+			dirs = append(dirs, dir)
+		}
+	}
+	cfg.Set(reflect.ValueOf(dirs))
+}
+
 func parseTempDir(cfg reflect.Value, k *ini.Key, ck *CfgKey) {
 	path := ""
 	if k != nil {
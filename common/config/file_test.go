@@ -69,6 +69,16 @@ func TestSetKey(t *testing.T) {
 		{"bits unknown", "[audio]\nsupport bits: 4", func() bool {
 			return len(SupportAudioBits) > 0
 		}, false},
+		{"internal bits", "[audio]\ninternal bits: f32", func() bool {
+			return InternalBits == audio.Bits_32LEF && audio.InternalBits() == audio.Bits_32LEF
+		}, false},
+		{"internal bits invalid", "[audio]\ninternal bits: s16", func() bool {
+			defer audio.SetInternalBits(audio.Bits_DEFAULT)
+			return audio.InternalBits() == audio.Bits_32LEF
+		}, false},
+		{"loudness target", "[audio]\nloudness target: -23.5", func() bool {
+			return LoudnessTarget == -23.5
+		}, false},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
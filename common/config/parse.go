@@ -60,6 +60,8 @@ func (ck *CfgKey) setReflect(key *ini.Key, cfgrv reflect.Value) error {
 		return ck.setReflectUInt(key, cfgrv)
 	case reflect.Bool:
 		return ck.setReflectBool(key, cfgrv)
+	case reflect.Float32, reflect.Float64:
+		return ck.setReflectFloat(key, cfgrv)
 	case reflect.Struct:
 		return ck.setReflectStruct(key, cfgrv)
 	case reflect.Slice:
@@ -98,6 +100,14 @@ func (ck *CfgKey) setReflectBool(key *ini.Key, cfgrv reflect.Value) error {
 	return err
 }
 
+func (ck *CfgKey) setReflectFloat(key *ini.Key, cfgrv reflect.Value) error {
+	ki, err := key.Float64()
+	if err == nil {
+		cfgrv.SetFloat(ki)
+	}
+	return err
+}
+
 func (ck *CfgKey) setReflectStruct(key *ini.Key, cfgrv reflect.Value) error {
 	keyV := key.String()
 
@@ -11,6 +11,32 @@ var ConfigStruct = []CfgSection{
 		{&SupportAudioBits, "support bits", "", parseBits},
 		{&SupportAudioRates, "support rates", "", parseRates},
 		{&AudioBuferMSDuration, "buffer duration", "", nil},
+		{&LoudnessTarget, "loudness target", "", nil},
+		{&VolumeRampDuration, "volume ramp", "", nil},
+		{&VolumeFadeDuration, "volume fade", "", nil},
+		{&CrossfadeDuration, "crossfade duration", "", nil},
+		{&CrossfadeCurve, "crossfade curve", "", nil},
+		{&ChannelUpmix, "channel upmix", "", nil},
+		{&DitherMode, "dither", "", nil},
+		{&ConvolverDir, "convolver dir", "", parsePath},
+		{&ResampleEngine, "resample engine", "", nil},
+		{&InternalBits, "internal bits", "", parseInternalBits},
+		{&AnnounceDuck, "announce duck", "", nil},
+		{&AnnounceVolume, "announce volume", "", nil},
+		{&AnnounceAttack, "announce attack", "", nil},
+		{&AnnounceRelease, "announce release", "", nil},
+		{&AnnounceDir, "announce dir", "", parsePath},
+		{&SilenceTimeout, "silence timeout", "", nil},
+		{&SilencePreroll, "silence preroll", "", nil},
+		{&SpectrumSize, "spectrum size", "", nil},
+		{&SpectrumWindow, "spectrum window", "", nil},
+		{&SpectrumAveraging, "spectrum averaging", "", nil},
+		{&SpectrumPeakHold, "spectrum peak hold", "", nil},
+		{&MeterPeakHold, "meter peak hold", "", nil},
+		{&MeterPeakDecay, "meter peak decay", "", nil},
+		{&ScheduleMissedGrace, "schedule missed grace", "", nil},
+		{&RadioBackoffMax, "radio backoff", "", nil},
+		{&RadioRetries, "radio retries", "", nil},
 	}},
 	{"detect", []CfgKey{
 		{&ServerListen, "listen", "", nil},
@@ -36,8 +62,20 @@ var ConfigStruct = []CfgSection{
 	{"dlna", []CfgKey{
 		{&EnableDLNA, "enable", "", nil},
 		{&DLNAListen, "listen", "", nil},
+		{&DLNAMediaServer, "media server", "", nil},
+		{&DLNAServerListen, "server listen", "", nil},
 		{&DLNANotifyInterval, "notify interval", "", nil},
 		{&DLNAAllowIps, "allow ips", "", nil},
 		{&DLNADenyIps, "deny ips", "", nil},
 	}},
+	{"airplay", []CfgKey{
+		{&EnableAirPlay, "enable", "", nil},
+		{&AirPlayListen, "listen", "", nil},
+		{&AirPlayBuffer, "buffer", "", nil},
+		{&AirPlayKey, "key", "", parsePath},
+	}},
+	{"library", []CfgKey{
+		{&LibraryDirs, "dirs", "", parseDirs},
+		{&LibraryRescan, "rescan", "", nil},
+	}},
 }
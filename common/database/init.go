@@ -2,7 +2,10 @@ package database
 
 import (
 	"github.com/zwcway/castserver-go/common/bus"
+	"github.com/zwcway/castserver-go/common/library"
 	lg "github.com/zwcway/castserver-go/common/log"
+	"github.com/zwcway/castserver-go/common/playlist"
+	"github.com/zwcway/castserver-go/common/schedule"
 	"github.com/zwcway/castserver-go/common/speaker"
 	"github.com/zwcway/castserver-go/common/utils"
 	"gorm.io/gorm"
@@ -23,6 +26,11 @@ func Init(ctx utils.Context, d *gorm.DB) {
 		&speaker.Line{},
 		&speaker.SpeakerConfig{},
 		&speaker.Speaker{},
+		&schedule.Job{},
+		&playlist.QueueState{},
+		&playlist.QueueItem{},
+		&playlist.Station{},
+		&library.Track{},
 	)
 
 	speaker.BusGetLines.Register(getLines)
@@ -59,6 +67,33 @@ func Init(ctx utils.Context, d *gorm.DB) {
 		}
 		return nil
 	}).ASync()
+
+	playlist.BusGetQueues.Register(getQueues)
+	playlist.BusQueueChanged.Register(saveQueue)
+	playlist.BusQueueDeleted.Register(deleteQueue).ASync()
+	playlist.BusGetStations.Register(getStations)
+	playlist.BusSaveStation.Register(saveStation)
+	playlist.BusStationDeleted.Register(deleteStation).ASync()
+
+	library.BusGetTracks.Register(getTracks)
+	library.BusSaveTracks.Register(saveTracks)
+	library.BusTracksDeleted.Register(deleteTracks)
+
+	schedule.BusGetJobs.Register(getJobs)
+	schedule.BusSaveJob.Register(saveJob)
+	schedule.BusJobDeleted.Register(deleteJob).ASync()
+	schedule.BusJobEdited.Register(func(j *schedule.Job, a ...any) error {
+		um := map[string]any{}
+		for i := 0; i < len(a); i += 2 {
+			um[a[i].(string)] = a[i+1]
+		}
+		result := db.Model(j).UpdateColumns(um)
+		if result.Error != nil {
+			log.Fatal("save job error", lg.Error(result.Error))
+			return result.Error
+		}
+		return nil
+	}).ASync()
 }
 
 func getLines(lineList *[]*speaker.Line) error {
@@ -146,3 +181,165 @@ func deleteSpeaker(o any, a ...any) error {
 	}
 	return result.Error
 }
+
+func getJobs(jobList *[]*schedule.Job) error {
+	jobs := []schedule.Job{}
+	result := db.Find(&jobs)
+	if result.RowsAffected > 0 {
+		for i := 0; i < len(jobs); i++ {
+			*jobList = append(*jobList, &jobs[i])
+		}
+		return nil
+	}
+	if result.Error != nil {
+		log.Fatal("read all jobs error", lg.Error(result.Error))
+	}
+	return result.Error
+}
+
+func saveJob(j *schedule.Job) error {
+	result := db.Save(j)
+	if result.Error != nil {
+		log.Fatal("save job error", lg.Uint("job", uint64(j.ID)), lg.Error(result.Error))
+	}
+	return result.Error
+}
+
+func deleteJob(j *schedule.Job) error {
+	result := db.Delete(j)
+	if result.Error != nil {
+		log.Fatal("delete job error", lg.Uint("job", uint64(j.ID)), lg.Error(result.Error))
+	}
+	return result.Error
+}
+
+func getQueues(states *[]playlist.QueueState, items *[]playlist.QueueItem) error {
+	if result := db.Find(states); result.Error != nil {
+		log.Fatal("read all queues error", lg.Error(result.Error))
+		return result.Error
+	}
+	result := db.Order("line_id, pos").Find(items)
+	if result.Error != nil {
+		log.Fatal("read all queue items error", lg.Error(result.Error))
+	}
+	return result.Error
+}
+
+// 保存整个队列
+func saveQueue(q *playlist.Queue) error {
+	var (
+		state = q.State()
+		items = q.Items()
+	)
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&state).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("line_id = ?", state.LineID).Delete(&playlist.QueueItem{}).Error; err != nil {
+			return err
+		}
+		if len(items) == 0 {
+			return nil
+		}
+		return tx.Create(&items).Error
+	})
+	if err != nil {
+		log.Fatal("save queue error", lg.Uint("line", uint64(state.LineID)), lg.Error(err))
+	}
+	return err
+}
+
+func deleteQueue(q *playlist.Queue) error {
+	line := q.Line()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("line_id = ?", line).Delete(&playlist.QueueItem{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&playlist.QueueState{LineID: line}).Error
+	})
+	if err != nil {
+		log.Fatal("delete queue error", lg.Uint("line", uint64(line)), lg.Error(err))
+	}
+	return err
+}
+
+func getStations(list *[]*playlist.Station) error {
+	stations := []playlist.Station{}
+	result := db.Order("id").Find(&stations)
+	if result.RowsAffected > 0 {
+		for i := 0; i < len(stations); i++ {
+			*list = append(*list, &stations[i])
+		}
+		return nil
+	}
+	if result.Error != nil {
+		log.Fatal("read all stations error", lg.Error(result.Error))
+	}
+	return result.Error
+}
+
+func saveStation(s *playlist.Station) error {
+	result := db.Save(s)
+	if result.Error != nil {
+		log.Fatal("save station error", lg.Uint("station", uint64(s.ID)), lg.Error(result.Error))
+	}
+	return result.Error
+}
+
+func deleteStation(s *playlist.Station) error {
+	result := db.Delete(s)
+	if result.Error != nil {
+		log.Fatal("delete station error", lg.Uint("station", uint64(s.ID)), lg.Error(result.Error))
+	}
+	return result.Error
+}
+
+func getTracks(list *[]*library.Track) error {
+	tracks := []library.Track{}
+	result := db.Find(&tracks)
+	if result.RowsAffected > 0 {
+		for i := 0; i < len(tracks); i++ {
+			*list = append(*list, &tracks[i])
+		}
+		return nil
+	}
+	if result.Error != nil {
+		log.Fatal("read all tracks error", lg.Error(result.Error))
+	}
+	return result.Error
+}
+
+// 扫描的结果可能很多，分批写入
+func saveTracks(list []*library.Track) error {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		return tx.Clauses(clause.OnConflict{UpdateAll: true}).CreateInBatches(list, 200).Error
+	})
+	if err != nil {
+		log.Fatal("save tracks error", lg.Int("count", int64(len(list))), lg.Error(err))
+	}
+	return err
+}
+
+func deleteTracks(list []*library.Track) error {
+	ids := make([]library.TrackID, len(list))
+	for i, t := range list {
+		ids[i] = t.ID
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for len(ids) > 0 {
+			n := len(ids)
+			if n > 500 {
+				n = 500
+			}
+			if err := tx.Delete(&library.Track{}, ids[:n]).Error; err != nil {
+				return err
+			}
+			ids = ids[n:]
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatal("delete tracks error", lg.Int("count", int64(len(list))), lg.Error(err))
+	}
+	return err
+}
@@ -0,0 +1,296 @@
+package dsp
+
+import (
+	"math"
+
+	"github.com/zwcway/castserver-go/common/audio"
+)
+
+// UpmixMode 声道较少的输入扩展至环绕声线路的方式
+type UpmixMode = uint8
+
+const (
+	MatrixUpmix   UpmixMode = iota // 矩阵：中置取和信号，环绕取差信号
+	AmbienceUpmix                  // 环境声提取：环绕声道的差信号经过延迟和低通
+	NoUpmix                        // 不扩展，只输出相同的声道
+	upmixModeMax
+)
+
+func IsUpmixModeValid(m UpmixMode) bool {
+	return m < upmixModeMax
+}
+
+const minus3dB = 0.7071067811865476
+
+type channelGain struct {
+	ch   audio.Channel
+	gain float64
+}
+
+// 输出中不存在的声道，依次尝试混合至相邻的声道，参考 ITU-R BS.775
+var downmixRules = map[audio.Channel][][]channelGain{
+	audio.Channel_FRONT_LEFT:  {{{audio.Channel_FRONT_CENTER, minus3dB}}},
+	audio.Channel_FRONT_RIGHT: {{{audio.Channel_FRONT_CENTER, minus3dB}}},
+	audio.Channel_FRONT_CENTER: {
+		{{audio.Channel_FRONT_LEFT, minus3dB}, {audio.Channel_FRONT_RIGHT, minus3dB}},
+	},
+	audio.Channel_FRONT_LEFT_OF_CENTER: {
+		{{audio.Channel_FRONT_LEFT, 1}},
+		{{audio.Channel_FRONT_CENTER, 1}},
+	},
+	audio.Channel_FRONT_RIGHT_OF_CENTER: {
+		{{audio.Channel_FRONT_RIGHT, 1}},
+		{{audio.Channel_FRONT_CENTER, 1}},
+	},
+	audio.Channel_BACK_LEFT: {
+		{{audio.Channel_SIDE_LEFT, 1}},
+		{{audio.Channel_FRONT_LEFT, minus3dB}},
+	},
+	audio.Channel_BACK_RIGHT: {
+		{{audio.Channel_SIDE_RIGHT, 1}},
+		{{audio.Channel_FRONT_RIGHT, minus3dB}},
+	},
+	audio.Channel_SIDE_LEFT: {
+		{{audio.Channel_BACK_LEFT, 1}},
+		{{audio.Channel_FRONT_LEFT, minus3dB}},
+	},
+	audio.Channel_SIDE_RIGHT: {
+		{{audio.Channel_BACK_RIGHT, 1}},
+		{{audio.Channel_FRONT_RIGHT, minus3dB}},
+	},
+	audio.Channel_BACK_CENTER: {
+		{{audio.Channel_BACK_LEFT, minus3dB}, {audio.Channel_BACK_RIGHT, minus3dB}},
+		{{audio.Channel_SIDE_LEFT, minus3dB}, {audio.Channel_SIDE_RIGHT, minus3dB}},
+	},
+	audio.Channel_TOP_FRONT_LEFT: {
+		{{audio.Channel_FRONT_LEFT, 1}},
+	},
+	audio.Channel_TOP_FRONT_CENTER: {
+		{{audio.Channel_FRONT_CENTER, 1}},
+	},
+	audio.Channel_TOP_FRONT_RIGHT: {
+		{{audio.Channel_FRONT_RIGHT, 1}},
+	},
+	audio.Channel_TOP_BACK_LEFT: {
+		{{audio.Channel_BACK_LEFT, 1}},
+		{{audio.Channel_SIDE_LEFT, 1}},
+	},
+	audio.Channel_TOP_BACK_CENTER: {
+		{{audio.Channel_BACK_CENTER, 1}},
+	},
+	audio.Channel_TOP_BACK_RIGHT: {
+		{{audio.Channel_BACK_RIGHT, 1}},
+		{{audio.Channel_SIDE_RIGHT, 1}},
+	},
+}
+
+// ChannelMatrix 声道混合矩阵，Gains[o][i] 为输入声道 In[i] 混合至输出声道 Out[o] 的增益
+type ChannelMatrix struct {
+	In    []audio.Channel
+	Out   []audio.Channel
+	Gains [][]float64
+
+	// 由扩展产生、输入中不存在的声道，需要额外处理
+	Upmixed audio.ChannelMask
+}
+
+func (m *ChannelMatrix) outIndex(ch audio.Channel) int {
+	for i, c := range m.Out {
+		if c == ch {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m *ChannelMatrix) inIndex(ch audio.Channel) int {
+	for i, c := range m.In {
+		if c == ch {
+			return i
+		}
+	}
+	return -1
+}
+
+// 将输入声道 in 按照规则混合至输出
+func (m *ChannelMatrix) mixTo(in int, ch audio.Channel, gain float64, depth int) {
+	if o := m.outIndex(ch); o >= 0 {
+		m.Gains[o][in] += gain
+		return
+	}
+	alts := downmixRules[ch]
+	if len(alts) == 0 || depth > 3 {
+		// 例如 LFE，直接丢弃
+		return
+	}
+
+	pick := alts[0]
+	for _, alt := range alts {
+		found := true
+		for _, t := range alt {
+			if m.outIndex(t.ch) < 0 {
+				found = false
+				break
+			}
+		}
+		if found {
+			pick = alt
+			break
+		}
+	}
+	for _, t := range pick {
+		m.mixTo(in, t.ch, gain*t.gain, depth+1)
+	}
+}
+
+// 立体声或单声道输入扩展至缺少的声道
+func (m *ChannelMatrix) upmix() {
+	l := m.inIndex(audio.Channel_FRONT_LEFT)
+	r := m.inIndex(audio.Channel_FRONT_RIGHT)
+	c := m.inIndex(audio.Channel_FRONT_CENTER)
+
+	for _, ch := range m.In {
+		if ch != audio.Channel_FRONT_LEFT && ch != audio.Channel_FRONT_RIGHT && ch != audio.Channel_FRONT_CENTER {
+			// 已经是环绕声输入
+			return
+		}
+	}
+	if (l < 0) != (r < 0) {
+		return
+	}
+
+	set := func(ch audio.Channel, gains ...float64) {
+		o := m.outIndex(ch)
+		if o < 0 || m.inIndex(ch) >= 0 {
+			return
+		}
+		for _, g := range m.Gains[o] {
+			if g != 0 {
+				// 已经由其他声道混合
+				return
+			}
+		}
+		for i, g := range gains {
+			m.Gains[o][i] = g
+		}
+		m.Upmixed.Add(ch)
+	}
+	gains := func(lg, rg, cg float64) []float64 {
+		g := make([]float64, len(m.In))
+		if l >= 0 {
+			g[l], g[r] = lg, rg
+		}
+		if c >= 0 {
+			g[c] = cg
+		}
+		return g
+	}
+
+	if l < 0 {
+		// 单声道，铺满前置声道
+		set(audio.Channel_FRONT_LEFT, gains(0, 0, 0.5)...)
+		set(audio.Channel_FRONT_RIGHT, gains(0, 0, 0.5)...)
+		set(audio.Channel_LOW_FREQUENCY, gains(0, 0, 0.5)...)
+		return
+	}
+
+	// 中置取和信号，和左右前置叠加后中间的声像基本不变
+	set(audio.Channel_FRONT_CENTER, gains(0.5*minus3dB, 0.5*minus3dB, 0)...)
+	set(audio.Channel_LOW_FREQUENCY, gains(0.5, 0.5, 0)...)
+
+	// 环绕取差信号，居中的人声不会出现在环绕声道
+	for _, ch := range []audio.Channel{audio.Channel_SIDE_LEFT, audio.Channel_BACK_LEFT} {
+		set(ch, gains(0.5, -0.5, 0)...)
+	}
+	for _, ch := range []audio.Channel{audio.Channel_SIDE_RIGHT, audio.Channel_BACK_RIGHT} {
+		set(ch, gains(-0.5, 0.5, 0)...)
+	}
+}
+
+// 避免多个声道叠加后削波，所有行按照相同比例缩小
+func (m *ChannelMatrix) normalize() {
+	max := 0.0
+	for _, row := range m.Gains {
+		sum := 0.0
+		for _, g := range row {
+			sum += math.Abs(g)
+		}
+		if sum > max {
+			max = sum
+		}
+	}
+	if max <= 1 {
+		return
+	}
+	for _, row := range m.Gains {
+		for i := range row {
+			row[i] /= max
+		}
+	}
+}
+
+// 用户指定的路由覆盖对应的输出声道
+func (m *ChannelMatrix) route(routes []audio.ChannelRoute) {
+	for _, r := range routes {
+		o := m.outIndex(r.To)
+		if o < 0 {
+			continue
+		}
+		for i := range m.Gains[o] {
+			m.Gains[o][i] = 0
+		}
+		m.Upmixed.Del(r.To)
+		for j, from := range r.From {
+			i := m.inIndex(from)
+			if i < 0 {
+				continue
+			}
+			g := 1.0
+			if j < len(r.Gains) {
+				g = r.Gains[j]
+			}
+			m.Gains[o][i] += g
+		}
+	}
+}
+
+// IsIdentity 输出与输入完全一致
+func (m *ChannelMatrix) IsIdentity() bool {
+	if len(m.In) != len(m.Out) {
+		return false
+	}
+	for o, row := range m.Gains {
+		if m.In[o] != m.Out[o] {
+			return false
+		}
+		for i, g := range row {
+			if (i == o && g != 1) || (i != o && g != 0) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// NewChannelMatrix 根据输入和输出的声道布局生成混合矩阵
+func NewChannelMatrix(in, out audio.Layout, mode UpmixMode, routes []audio.ChannelRoute) *ChannelMatrix {
+	m := &ChannelMatrix{
+		In:    in.Slice(),
+		Out:   out.Slice(),
+		Gains: make([][]float64, out.Count),
+	}
+	for o := range m.Gains {
+		m.Gains[o] = make([]float64, len(m.In))
+	}
+
+	for i, ch := range m.In {
+		m.mixTo(i, ch, 1, 0)
+	}
+	if mode != NoUpmix {
+		m.upmix()
+	}
+	m.normalize()
+	m.route(routes)
+
+	return m
+}
@@ -0,0 +1,92 @@
+package dsp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zwcway/castserver-go/common/audio"
+)
+
+func matrixGain(m *ChannelMatrix, out, in audio.Channel) float64 {
+	o, i := m.outIndex(out), m.inIndex(in)
+	if o < 0 || i < 0 {
+		return 0
+	}
+	return m.Gains[o][i]
+}
+
+func TestChannelMatrix(t *testing.T) {
+	const delta = 1e-9
+
+	t.Run("identity", func(t *testing.T) {
+		m := NewChannelMatrix(audio.Layout51, audio.Layout51, MatrixUpmix, nil)
+		assert.True(t, m.IsIdentity())
+	})
+
+	t.Run("5.1 to 2.0", func(t *testing.T) {
+		m := NewChannelMatrix(audio.Layout51, audio.Layout20, MatrixUpmix, nil)
+		norm := 1 + 2*minus3dB
+
+		assert.InDelta(t, 1/norm, matrixGain(m, audio.Channel_FRONT_LEFT, audio.Channel_FRONT_LEFT), delta)
+		assert.InDelta(t, minus3dB/norm, matrixGain(m, audio.Channel_FRONT_LEFT, audio.Channel_FRONT_CENTER), delta)
+		assert.InDelta(t, minus3dB/norm, matrixGain(m, audio.Channel_FRONT_LEFT, audio.Channel_SIDE_LEFT), delta)
+		assert.Zero(t, matrixGain(m, audio.Channel_FRONT_LEFT, audio.Channel_FRONT_RIGHT))
+		assert.Zero(t, matrixGain(m, audio.Channel_FRONT_LEFT, audio.Channel_SIDE_RIGHT))
+		assert.Zero(t, matrixGain(m, audio.Channel_FRONT_LEFT, audio.Channel_LOW_FREQUENCY))
+		assert.InDelta(t, minus3dB/norm, matrixGain(m, audio.Channel_FRONT_RIGHT, audio.Channel_SIDE_RIGHT), delta)
+	})
+
+	t.Run("7.1 to 5.1", func(t *testing.T) {
+		m := NewChannelMatrix(audio.Layout71, audio.Layout51, MatrixUpmix, nil)
+
+		assert.InDelta(t, 0.5, matrixGain(m, audio.Channel_SIDE_LEFT, audio.Channel_SIDE_LEFT), delta)
+		assert.InDelta(t, 0.5, matrixGain(m, audio.Channel_SIDE_LEFT, audio.Channel_BACK_LEFT), delta)
+		assert.InDelta(t, 0.5, matrixGain(m, audio.Channel_LOW_FREQUENCY, audio.Channel_LOW_FREQUENCY), delta)
+		assert.Zero(t, matrixGain(m, audio.Channel_FRONT_LEFT, audio.Channel_BACK_LEFT))
+	})
+
+	t.Run("stereo upmix", func(t *testing.T) {
+		m := NewChannelMatrix(audio.Layout20, audio.Layout51, MatrixUpmix, nil)
+
+		assert.Equal(t, 1.0, matrixGain(m, audio.Channel_FRONT_LEFT, audio.Channel_FRONT_LEFT))
+		assert.Greater(t, matrixGain(m, audio.Channel_FRONT_CENTER, audio.Channel_FRONT_LEFT), 0.0)
+		assert.Equal(t, matrixGain(m, audio.Channel_FRONT_CENTER, audio.Channel_FRONT_LEFT), matrixGain(m, audio.Channel_FRONT_CENTER, audio.Channel_FRONT_RIGHT))
+
+		// 居中的信号不进入环绕声道
+		l := matrixGain(m, audio.Channel_SIDE_LEFT, audio.Channel_FRONT_LEFT)
+		r := matrixGain(m, audio.Channel_SIDE_LEFT, audio.Channel_FRONT_RIGHT)
+		assert.Greater(t, l, 0.0)
+		assert.InDelta(t, 0, l+r, delta)
+
+		assert.True(t, m.Upmixed.Isset(audio.Channel_LOW_FREQUENCY))
+		assert.False(t, m.Upmixed.Isset(audio.Channel_FRONT_LEFT))
+	})
+
+	t.Run("no upmix", func(t *testing.T) {
+		m := NewChannelMatrix(audio.Layout20, audio.Layout51, NoUpmix, nil)
+
+		assert.Zero(t, matrixGain(m, audio.Channel_FRONT_CENTER, audio.Channel_FRONT_LEFT))
+		assert.Zero(t, matrixGain(m, audio.Channel_SIDE_LEFT, audio.Channel_FRONT_LEFT))
+		assert.Equal(t, 1.0, matrixGain(m, audio.Channel_FRONT_RIGHT, audio.Channel_FRONT_RIGHT))
+	})
+
+	t.Run("mono", func(t *testing.T) {
+		m := NewChannelMatrix(audio.Layout10, audio.Layout20, MatrixUpmix, nil)
+		assert.InDelta(t, minus3dB, matrixGain(m, audio.Channel_FRONT_LEFT, audio.Channel_FRONT_CENTER), delta)
+		assert.InDelta(t, minus3dB, matrixGain(m, audio.Channel_FRONT_RIGHT, audio.Channel_FRONT_CENTER), delta)
+	})
+
+	t.Run("route", func(t *testing.T) {
+		routes := []audio.ChannelRoute{{
+			From:  []audio.Channel{audio.Channel_FRONT_LEFT, audio.Channel_FRONT_RIGHT},
+			To:    audio.Channel_FRONT_LEFT,
+			Gains: []float64{0.5},
+		}}
+		m := NewChannelMatrix(audio.Layout20, audio.Layout20, MatrixUpmix, routes)
+
+		assert.False(t, m.IsIdentity())
+		assert.Equal(t, 0.5, matrixGain(m, audio.Channel_FRONT_LEFT, audio.Channel_FRONT_LEFT))
+		assert.Equal(t, 1.0, matrixGain(m, audio.Channel_FRONT_LEFT, audio.Channel_FRONT_RIGHT))
+		assert.Equal(t, 1.0, matrixGain(m, audio.Channel_FRONT_RIGHT, audio.Channel_FRONT_RIGHT))
+	})
+}
@@ -0,0 +1,184 @@
+package dsp
+
+import (
+	"encoding/binary"
+	"math"
+
+	"github.com/zwcway/castserver-go/common/audio"
+)
+
+// IsBitsConvertible 是否支持与 float64 之间的转换
+func IsBitsConvertible(b audio.Bits) bool {
+	switch b {
+	case audio.Bits_S8, audio.Bits_U8,
+		audio.Bits_S16LE, audio.Bits_U16LE,
+		audio.Bits_S24LE, audio.Bits_U24LE,
+		audio.Bits_S32LE, audio.Bits_U32LE,
+		audio.Bits_16LEF, audio.Bits_32LEF, audio.Bits_64LEF:
+		return true
+	}
+	return false
+}
+
+// 整数样本的满量程
+func intScale(bits int) float64 {
+	return float64(int64(1) << (bits - 1))
+}
+
+// 与 swresample 一致，四舍六入五成双并限幅
+func quantizeInt(v float64, bits int) int64 {
+	var (
+		scale = intScale(bits)
+		q     = math.RoundToEven(v * scale)
+	)
+	if q > scale-1 {
+		return int64(scale - 1)
+	}
+	if q < -scale {
+		return int64(-scale)
+	}
+	return int64(q)
+}
+
+// DecodeSamples 将单个声道的 b 格式数据转换为 float64，返回转换的样本数
+func DecodeSamples(b audio.Bits, src []byte, dst []float64) int {
+	size := b.Size()
+	if !IsBitsConvertible(b) || size == 0 {
+		return 0
+	}
+	n := len(src) / size
+	if n > len(dst) {
+		n = len(dst)
+	}
+
+	var (
+		p     []byte
+		bits  = b.ToInt()
+		scale = intScale(bits)
+	)
+	for i := 0; i < n; i++ {
+		p = src[i*size:]
+		switch b {
+		case audio.Bits_S8:
+			dst[i] = float64(int8(p[0])) / scale
+		case audio.Bits_U8:
+			dst[i] = (float64(p[0]) - scale) / scale
+		case audio.Bits_S16LE:
+			dst[i] = float64(int16(binary.LittleEndian.Uint16(p))) / scale
+		case audio.Bits_U16LE:
+			dst[i] = (float64(binary.LittleEndian.Uint16(p)) - scale) / scale
+		case audio.Bits_S24LE:
+			dst[i] = float64(int32(uint32(p[0])<<8|uint32(p[1])<<16|uint32(p[2])<<24)>>8) / scale
+		case audio.Bits_U24LE:
+			dst[i] = (float64(uint32(p[0])|uint32(p[1])<<8|uint32(p[2])<<16) - scale) / scale
+		case audio.Bits_S32LE:
+			dst[i] = float64(int32(binary.LittleEndian.Uint32(p))) / scale
+		case audio.Bits_U32LE:
+			dst[i] = (float64(binary.LittleEndian.Uint32(p)) - scale) / scale
+		case audio.Bits_16LEF:
+			dst[i] = halfToFloat(binary.LittleEndian.Uint16(p))
+		case audio.Bits_32LEF:
+			dst[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(p)))
+		case audio.Bits_64LEF:
+			dst[i] = math.Float64frombits(binary.LittleEndian.Uint64(p))
+		}
+	}
+	return n
+}
+
+// EncodeSamples 将单个声道的 float64 数据转换为 b 格式，返回转换的样本数
+func EncodeSamples(b audio.Bits, src []float64, dst []byte) int {
+	size := b.Size()
+	if !IsBitsConvertible(b) || size == 0 {
+		return 0
+	}
+	n := len(dst) / size
+	if n > len(src) {
+		n = len(src)
+	}
+
+	var (
+		p    []byte
+		bits = b.ToInt()
+		off  = int64(intScale(bits))
+		v    int64
+	)
+	for i := 0; i < n; i++ {
+		p = dst[i*size:]
+		switch b {
+		case audio.Bits_S8:
+			p[0] = byte(int8(quantizeInt(src[i], bits)))
+		case audio.Bits_U8:
+			p[0] = byte(quantizeInt(src[i], bits) + off)
+		case audio.Bits_S16LE:
+			binary.LittleEndian.PutUint16(p, uint16(int16(quantizeInt(src[i], bits))))
+		case audio.Bits_U16LE:
+			binary.LittleEndian.PutUint16(p, uint16(quantizeInt(src[i], bits)+off))
+		case audio.Bits_S24LE, audio.Bits_U24LE:
+			v = quantizeInt(src[i], bits)
+			if b == audio.Bits_U24LE {
+				v += off
+			}
+			p[0], p[1], p[2] = byte(v), byte(v>>8), byte(v>>16)
+		case audio.Bits_S32LE:
+			binary.LittleEndian.PutUint32(p, uint32(int32(quantizeInt(src[i], bits))))
+		case audio.Bits_U32LE:
+			binary.LittleEndian.PutUint32(p, uint32(quantizeInt(src[i], bits)+off))
+		case audio.Bits_16LEF:
+			binary.LittleEndian.PutUint16(p, floatToHalf(src[i]))
+		case audio.Bits_32LEF:
+			binary.LittleEndian.PutUint32(p, math.Float32bits(float32(src[i])))
+		case audio.Bits_64LEF:
+			binary.LittleEndian.PutUint64(p, math.Float64bits(src[i]))
+		}
+	}
+	return n
+}
+
+// IEEE 754 半精度
+func halfToFloat(h uint16) float64 {
+	var (
+		sign = 1.0
+		exp  = int(h>>10) & 0x1f
+		frac = float64(h & 0x3ff)
+	)
+	if h&0x8000 != 0 {
+		sign = -1
+	}
+	switch exp {
+	case 0:
+		return sign * math.Ldexp(frac, -24)
+	case 0x1f:
+		if frac != 0 {
+			return math.NaN()
+		}
+		return math.Inf(int(sign))
+	}
+	return sign * math.Ldexp(1+frac/1024, exp-15)
+}
+
+func floatToHalf(v float64) uint16 {
+	var sign uint16
+	if math.Signbit(v) {
+		sign = 0x8000
+		v = -v
+	}
+	switch {
+	case math.IsNaN(v):
+		return 0x7e00
+	case v >= 65520:
+		return sign | 0x7c00
+	case v < math.Ldexp(1, -14):
+		// 非规格化数
+		return sign | uint16(math.RoundToEven(math.Ldexp(v, 24)))
+	}
+
+	frac, exp := math.Frexp(v) // v = frac * 2^exp, 0.5 <= frac < 1
+	m := uint16(math.RoundToEven((frac*2 - 1) * 1024))
+	e := uint16(exp - 1 + 15)
+	if m == 1024 {
+		m = 0
+		e++
+	}
+	return sign | e<<10 | m
+}
@@ -0,0 +1,154 @@
+package dsp
+
+// 均匀分段的 overlap-save 卷积
+//
+// 冲激响应被切分为 P 段，每段长度为 B，FFT 长度为 2B。
+// 每输入 B 个样本计算一次，固定延迟 B 个样本。
+type Convolver struct {
+	plan  *FFTPlan
+	block int // 分段长度 B
+	parts int // 分段数量 P
+
+	// 每段冲激响应的频谱
+	hr [][]float64
+	hi [][]float64
+
+	// 频域延迟线，保存最近 P 个输入块的频谱
+	xr   [][]float64
+	xi   [][]float64
+	xPos int
+
+	in   []float64 // 最近 2B 个输入样本
+	out  []float64 // 上一块的输出
+	pos  int
+	accR []float64
+	accI []float64
+}
+
+// Latency 延迟的样本数
+func (c *Convolver) Latency() int {
+	return c.block
+}
+
+func (c *Convolver) Taps() int {
+	return c.parts * c.block
+}
+
+func (c *Convolver) Reset() {
+	for p := 0; p < c.parts; p++ {
+		for i := range c.xr[p] {
+			c.xr[p][i] = 0
+			c.xi[p][i] = 0
+		}
+	}
+	for i := range c.in {
+		c.in[i] = 0
+	}
+	for i := range c.out {
+		c.out[i] = 0
+	}
+	c.pos = 0
+	c.xPos = 0
+}
+
+// Process 原地处理，输出相对输入延迟 Latency() 个样本
+func (c *Convolver) Process(data []float64) {
+	for i := 0; i < len(data); i++ {
+		c.in[c.block+c.pos] = data[i]
+		data[i] = c.out[c.pos]
+		c.pos++
+
+		if c.pos == c.block {
+			c.processBlock()
+			c.pos = 0
+		}
+	}
+}
+
+func (c *Convolver) processBlock() {
+	var (
+		n      = c.plan.Len()
+		p, k   int
+		xr, xi []float64
+		hr, hi []float64
+	)
+
+	// 新的输入块放入延迟线
+	c.xPos--
+	if c.xPos < 0 {
+		c.xPos = c.parts - 1
+	}
+	xr = c.xr[c.xPos]
+	xi = c.xi[c.xPos]
+	copy(xr, c.in)
+	for k = 0; k < n; k++ {
+		xi[k] = 0
+	}
+	c.plan.Forward(xr, xi)
+
+	// 保留后半部分作为下一次的前半部分
+	copy(c.in, c.in[c.block:])
+
+	for k = 0; k < n; k++ {
+		c.accR[k] = 0
+		c.accI[k] = 0
+	}
+	for p = 0; p < c.parts; p++ {
+		xr = c.xr[(c.xPos+p)%c.parts]
+		xi = c.xi[(c.xPos+p)%c.parts]
+		hr = c.hr[p]
+		hi = c.hi[p]
+		for k = 0; k < n; k++ {
+			c.accR[k] += xr[k]*hr[k] - xi[k]*hi[k]
+			c.accI[k] += xr[k]*hi[k] + xi[k]*hr[k]
+		}
+	}
+
+	c.plan.Inverse(c.accR, c.accI)
+
+	// 丢弃前半部分的循环卷积混叠
+	copy(c.out, c.accR[c.block:])
+}
+
+// NewConvolver block 为分段长度，会向上取整至 2 的幂
+func NewConvolver(ir []float64, block int) *Convolver {
+	if len(ir) == 0 {
+		return nil
+	}
+	b := 64
+	for b < block {
+		b <<= 1
+	}
+	n := b << 1
+
+	c := &Convolver{
+		plan:  NewFFTPlan(n),
+		block: b,
+		parts: (len(ir) + b - 1) / b,
+		in:    make([]float64, n),
+		out:   make([]float64, b),
+		accR:  make([]float64, n),
+		accI:  make([]float64, n),
+	}
+
+	c.hr = make([][]float64, c.parts)
+	c.hi = make([][]float64, c.parts)
+	c.xr = make([][]float64, c.parts)
+	c.xi = make([][]float64, c.parts)
+
+	for p := 0; p < c.parts; p++ {
+		c.hr[p] = make([]float64, n)
+		c.hi[p] = make([]float64, n)
+		c.xr[p] = make([]float64, n)
+		c.xi[p] = make([]float64, n)
+
+		copy(c.hr[p], ir[p*b:])
+		for i := b; i < n; i++ {
+			// copy 可能多复制了下一段
+			c.hr[p][i] = 0
+		}
+		c.plan.Forward(c.hr[p], c.hi[p])
+	}
+
+	return c
+}
@@ -0,0 +1,98 @@
+package dsp
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func directConvolve(x, h []float64) []float64 {
+	y := make([]float64, len(x))
+	for i := range x {
+		for j := 0; j < len(h) && j <= i; j++ {
+			y[i] += x[i-j] * h[j]
+		}
+	}
+	return y
+}
+
+func TestConvolver_Process(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	h := make([]float64, 1000)
+	for i := range h {
+		h[i] = r.Float64()*2 - 1
+	}
+	x := make([]float64, 5000)
+	for i := range x {
+		x[i] = r.Float64()*2 - 1
+	}
+	want := directConvolve(x, h)
+
+	for _, block := range []int{64, 128, 512} {
+		c := NewConvolver(h, block)
+		assert.Equal(t, block, c.Latency())
+		assert.GreaterOrEqual(t, c.Taps(), len(h))
+
+		got := make([]float64, len(x))
+		copy(got, x)
+		// 不规则的分块长度
+		for i, n := 0, 0; i < len(got); i += n {
+			n = 1 + r.Intn(300)
+			if i+n > len(got) {
+				n = len(got) - i
+			}
+			c.Process(got[i : i+n])
+		}
+
+		for i := c.Latency(); i < len(got); i++ {
+			if math.Abs(got[i]-want[i-c.Latency()]) > 1e-9 {
+				t.Fatalf("block %d sample %d: got %f want %f", block, i, got[i], want[i-c.Latency()])
+			}
+		}
+	}
+}
+
+func TestReadImpulseResponse(t *testing.T) {
+	var (
+		buf  bytes.Buffer
+		data = []int16{1 << 14, -1 << 14, 0, 1 << 13}
+	)
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(36+len(data)*2))
+	buf.WriteString("WAVEfmt ")
+	binary.Write(&buf, binary.LittleEndian, struct {
+		Size             uint32
+		Format, Channels uint16
+		Rate, ByteRate   uint32
+		Align, Bits      uint16
+	}{16, wavFormatPCM, 2, 48000, 48000 * 4, 4, 16})
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(len(data)*2))
+	binary.Write(&buf, binary.LittleEndian, data)
+
+	ir, err := ReadImpulseResponse(&buf)
+	assert.Nil(t, err)
+	assert.Equal(t, 48000, ir.Rate)
+	assert.Equal(t, 2, ir.Channels())
+	assert.Equal(t, []float64{0.5, 0}, ir.Data[0])
+	assert.Equal(t, []float64{-0.5, 0.25}, ir.Data[1])
+
+	t.Run("resample", func(t *testing.T) {
+		ir := &ImpulseResponse{Rate: 44100, Data: [][]float64{make([]float64, 441)}}
+		ir.Data[0][100] = 1
+		nr := ir.Resample(48000)
+		assert.Equal(t, 480, nr.Taps())
+
+		sum := 0.0
+		for _, v := range nr.Data[0] {
+			sum += v
+		}
+		// 直流增益不变
+		assert.InDelta(t, 1, sum, 1e-2)
+	})
+}
@@ -0,0 +1,169 @@
+package dsp
+
+import (
+	"github.com/zwcway/castserver-go/common/audio"
+)
+
+// DitherMode 降低位深时的抖动方式
+type DitherMode = uint8
+
+const (
+	NoDither     DitherMode = iota // 直接舍入
+	TPDFDither                     // 三角概率密度抖动，量化误差与信号无关
+	ShapedDither                   // TPDF 加噪声整形，将噪声移至人耳不敏感的高频
+	ditherModeMax
+)
+
+func IsDitherModeValid(m DitherMode) bool {
+	return m < ditherModeMax
+}
+
+// DitherBits 需要抖动的整数位深，浮点或者 32 位时返回 0
+func DitherBits(b audio.Bits) int {
+	switch b {
+	case audio.Bits_S8, audio.Bits_U8,
+		audio.Bits_S16LE, audio.Bits_U16LE,
+		audio.Bits_S24LE, audio.Bits_U24LE:
+		return b.ToInt()
+	}
+	return 0
+}
+
+// 噪声整形的误差反馈系数
+var (
+	// Lipshitz 等提出的 E 加权滤波器，适用于 44.1kHz 和 48kHz
+	lipshitzShaping = []float64{2.033, -2.165, 1.959, -1.590, 0.6149}
+	// 高采样率时一阶整形即可将噪声移出可听范围
+	firstOrderShaping = []float64{1}
+)
+
+// 限制误差反馈，避免削波时整形滤波器发散
+const ditherMaxError = 2
+
+// Ditherer 将 float64 样本量化至目标位深的精度，量化后的样本转换为整数时没有误差
+type Ditherer struct {
+	mode   DitherMode
+	bits   int
+	rate   int
+	lsb    float64
+	coefs  []float64
+	errors [][]float64 // 每个声道最近的量化误差
+	seed   uint32
+}
+
+// 均匀分布 [-0.5, 0.5)
+func (d *Ditherer) random() float64 {
+	// xorshift32
+	d.seed ^= d.seed << 13
+	d.seed ^= d.seed >> 17
+	d.seed ^= d.seed << 5
+	return float64(d.seed)/(1<<32) - 0.5
+}
+
+func (d *Ditherer) quantize(v float64) float64 {
+	q := v / d.lsb
+	if q >= 0 {
+		q = float64(int64(q + 0.5))
+	} else {
+		q = float64(int64(q - 0.5))
+	}
+	q *= d.lsb
+
+	if q > 1-d.lsb {
+		q = 1 - d.lsb
+	} else if q < -1 {
+		q = -1
+	}
+	return q
+}
+
+// Process data 为 planar 格式，n 为每声道样本数，原地量化
+func (d *Ditherer) Process(data [][]float64, n int) {
+	if d.bits == 0 {
+		return
+	}
+	var (
+		i, k int
+		v, e float64
+		hist []float64
+	)
+	for ch := 0; ch < len(data) && ch < len(d.errors); ch++ {
+		hist = d.errors[ch]
+		for i = 0; i < n; i++ {
+			v = data[ch][i]
+
+			// 减去经过滤波的历史误差
+			for k = 0; k < len(d.coefs); k++ {
+				v -= d.coefs[k] * hist[k]
+			}
+
+			switch d.mode {
+			case TPDFDither, ShapedDither:
+				data[ch][i] = d.quantize(v + (d.random()+d.random())*d.lsb)
+			default:
+				data[ch][i] = d.quantize(v)
+			}
+
+			if len(hist) == 0 {
+				continue
+			}
+			e = data[ch][i] - v
+			if e > ditherMaxError*d.lsb {
+				e = ditherMaxError * d.lsb
+			} else if e < -ditherMaxError*d.lsb {
+				e = -ditherMaxError * d.lsb
+			}
+			copy(hist[1:], hist[:len(hist)-1])
+			hist[0] = e
+		}
+	}
+}
+
+func (d *Ditherer) Mode() DitherMode {
+	return d.mode
+}
+
+func (d *Ditherer) Bits() int {
+	return d.bits
+}
+
+func (d *Ditherer) Rate() int {
+	return d.rate
+}
+
+func (d *Ditherer) Channels() int {
+	return len(d.errors)
+}
+
+func (d *Ditherer) Reset() {
+	for _, hist := range d.errors {
+		for i := range hist {
+			hist[i] = 0
+		}
+	}
+}
+
+// NewDitherer bits 为目标位深，为 0 时不处理
+func NewDitherer(mode DitherMode, bits int, rate int, channels int) *Ditherer {
+	d := &Ditherer{
+		mode:   mode,
+		bits:   bits,
+		rate:   rate,
+		errors: make([][]float64, channels),
+		seed:   0x9E3779B9,
+	}
+	if bits > 0 {
+		d.lsb = 1 / float64(int64(1)<<(bits-1))
+	}
+	if mode == ShapedDither {
+		if rate > 0 && rate <= 48000 {
+			d.coefs = lipshitzShaping
+		} else {
+			d.coefs = firstOrderShaping
+		}
+	}
+	for ch := range d.errors {
+		d.errors[ch] = make([]float64, len(d.coefs))
+	}
+	return d
+}
@@ -0,0 +1,110 @@
+package dsp
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zwcway/castserver-go/common/audio"
+)
+
+func ditherSine(n, rate int, freq, amp float64) []float64 {
+	data := make([]float64, n)
+	for i := range data {
+		data[i] = amp * math.Sin(2*Pi*freq*float64(i)/float64(rate))
+	}
+	return data
+}
+
+// 量化误差在 [0, maxFreq) 内的平均功率
+func ditherNoise(src, dst []float64, rate int, maxFreq float64) float64 {
+	var (
+		n  = len(src)
+		p  = NewFFTPlan(n)
+		re = make([]float64, n)
+		im = make([]float64, n)
+	)
+	for i := range re {
+		re[i] = dst[i] - src[i]
+	}
+	p.Forward(re, im)
+
+	bins := int(maxFreq * float64(n) / float64(rate))
+	e := 0.0
+	for i := 1; i < bins; i++ {
+		e += re[i]*re[i] + im[i]*im[i]
+	}
+	return e / float64(bins-1)
+}
+
+func TestDitherer(t *testing.T) {
+	const (
+		rate = 44100
+		n    = 1 << 16
+		bits = 16
+	)
+	lsb := 1 / float64(int64(1)<<(bits-1))
+
+	run := func(mode DitherMode, src []float64) []float64 {
+		dst := append([]float64{}, src...)
+		NewDitherer(mode, bits, rate, 1).Process([][]float64{dst}, n)
+		return dst
+	}
+
+	t.Run("quantized", func(t *testing.T) {
+		for _, mode := range []DitherMode{NoDither, TPDFDither, ShapedDither} {
+			dst := run(mode, ditherSine(n, rate, 1000, 0.5))
+			for _, v := range dst {
+				// 量化后的样本都在目标位深的精度上
+				assert.Equal(t, math.Round(v/lsb), v/lsb)
+			}
+		}
+	})
+
+	t.Run("tpdf noise floor", func(t *testing.T) {
+		src := ditherSine(n, rate, 1000, 0.25)
+		dst := run(TPDFDither, src)
+
+		sum := 0.0
+		for i := range src {
+			e := dst[i] - src[i]
+			sum += e * e
+		}
+		// 舍入误差 lsb²/12 加上 TPDF 的 lsb²/6，总计 -96.3 dBFS
+		floor := 10 * math.Log10(sum/n)
+		assert.InDelta(t, 20*math.Log10(lsb/2), floor, 0.5)
+	})
+
+	t.Run("tpdf keeps low level signal", func(t *testing.T) {
+		// 幅度小于半个 LSB，直接舍入后完全丢失
+		src := ditherSine(n, rate, 1000, 0.4*lsb)
+
+		for _, v := range run(NoDither, src) {
+			assert.Zero(t, v)
+		}
+
+		dst := run(TPDFDither, src)
+		var xy, xx float64
+		for i := range src {
+			xy += src[i] * dst[i]
+			xx += src[i] * src[i]
+		}
+		assert.InDelta(t, 1, xy/xx, 0.1)
+	})
+
+	t.Run("noise shaping", func(t *testing.T) {
+		src := ditherSine(n, rate, 1000, 0.25)
+		tpdf := ditherNoise(src, run(TPDFDither, src), rate, 4000)
+		shaped := ditherNoise(src, run(ShapedDither, src), rate, 4000)
+
+		// 低频的噪声明显降低
+		assert.Less(t, 10*math.Log10(shaped/tpdf), -6.0)
+	})
+
+	t.Run("bits", func(t *testing.T) {
+		assert.Equal(t, 16, DitherBits(audio.Bits_S16LE))
+		assert.Equal(t, 8, DitherBits(audio.Bits_U8))
+		assert.Zero(t, DitherBits(audio.Bits_32LEF))
+		assert.Zero(t, DitherBits(audio.Bits_S32LE))
+	})
+}
@@ -1,6 +1,8 @@
 package dsp
 
 import (
+	"math"
+	"math/cmplx"
 	"time"
 )
 
@@ -14,13 +16,21 @@ const (
 	NotchFilter                           // 陷波滤波器,IIR
 	LowShelfFilter                        // 低切滤波器
 	HighShelfFilter                       // 高切滤波器
+	BandPassFilter                        // 带通滤波器，峰值增益 0dB
+	AllPassFilter                         // 全通滤波器，只改变相位
+	filterTypeMax
 )
 
+func IsFilterTypeValid(t FilterType) bool {
+	return t >= LowPassFilter && t < filterTypeMax
+}
+
 // FilterParams 滤波器
 type FilterParams struct {
-	Frequency int     `jp:"freq"`
-	Gain      float64 `jp:"g"` // 增益大小
-	Q         float64 `jp:"q"` // Q 值
+	Frequency int        `jp:"freq"`
+	Gain      float64    `jp:"g"`           // 增益大小
+	Q         float64    `jp:"q"`           // Q 值
+	Type      FilterType `jp:"t,omitempty"` // 为 0 时使用 EqualizerProcessor.Type
 }
 
 const FEQ_MAX_SIZE uint8 = 31
@@ -33,23 +43,78 @@ type EqualizerProcessor struct {
 }
 
 func (d *EqualizerProcessor) Set(freq int, gain, q float64) {
+	d.SetFilter(FilterParams{Frequency: freq, Gain: gain, Q: q})
+}
+
+// SetFilter 替换相同频率的频段，否则占用一个空的频段
+func (d *EqualizerProcessor) SetFilter(f FilterParams) {
 	for i, eq := range d.Filters {
 		if eq == nil {
 			continue
 		}
-		if eq.Frequency == freq {
-			d.Filters[i] = &FilterParams{freq, gain, q}
+		if eq.Frequency == f.Frequency {
+			d.Filters[i] = &f
 			return
 		}
 	}
 	for i, eq := range d.Filters {
 		if eq == nil {
-			d.Filters[i] = &FilterParams{freq, gain, q}
+			d.Filters[i] = &f
 			return
 		}
 	}
 }
 
+// FilterType 频段的实际类型
+func (d *EqualizerProcessor) FilterType(f *FilterParams) FilterType {
+	if f.Type != 0 {
+		return f.Type
+	}
+	return d.Type
+}
+
+// Response 所有频段叠加后的幅频响应（dB）和相频响应（角度）
+func (d *EqualizerProcessor) Response(rate int, freqs []float64) (mag []float64, phase []float64) {
+	var (
+		filters = make([]*Filter, 0, len(d.Filters))
+		h       complex128
+	)
+	mag = make([]float64, len(freqs))
+	phase = make([]float64, len(freqs))
+
+	for _, f := range d.Filters {
+		if f == nil {
+			continue
+		}
+		p := *f
+		p.Type = d.FilterType(f)
+		filters = append(filters, NewFilter(p, rate))
+	}
+
+	for i, freq := range freqs {
+		h = 1
+		for _, f := range filters {
+			h *= f.Response(freq)
+		}
+		mag[i] = 20 * math.Log10(math.Max(cmplx.Abs(h), 1e-12))
+		phase[i] = cmplx.Phase(h) * 180 / Pi
+	}
+	return
+}
+
+// ResponseFrequencies 20hz 至 20khz 之间按对数均匀分布的频率
+func ResponseFrequencies(n int) []float64 {
+	if n < 2 {
+		n = 2
+	}
+	freqs := make([]float64, n)
+	step := math.Log(20000.0/20.0) / float64(n-1)
+	for i := 0; i < n; i++ {
+		freqs[i] = 20 * math.Exp(step*float64(i))
+	}
+	return freqs
+}
+
 func (d *EqualizerProcessor) Clear(size uint8) bool {
 	if size > FEQ_MAX_SIZE {
 		return false
@@ -0,0 +1,73 @@
+package dsp
+
+// 预设均衡器的频段
+var presetFrequencies = []int{31, 62, 125, 250, 500, 1000, 2000, 4000, 8000, 16000}
+
+const presetQ = 1.41
+
+// 预设均衡器各频段的增益
+var equalizerPresets = []struct {
+	name  string
+	gains []float64
+}{
+	{"Flat", []float64{0, 0, 0, 0, 0, 0, 0, 0, 0, 0}},
+	{"Bass", []float64{6, 5, 4, 2, 0, 0, 0, 0, 0, 0}},
+	{"Treble", []float64{0, 0, 0, 0, 0, 0, 2, 4, 5, 6}},
+	{"Vocal", []float64{-2, -2, -1, 0, 2, 3, 3, 2, 0, -1}},
+	{"Loudness", []float64{5, 4, 2, 0, -1, 0, 0, 2, 4, 5}},
+}
+
+// EqualizerPresetNames 预设均衡器的名称
+func EqualizerPresetNames() []string {
+	names := make([]string, len(equalizerPresets))
+	for i, p := range equalizerPresets {
+		names[i] = p.name
+	}
+	return names
+}
+
+// EqualizerPresetOf 与 eq 相同的预设均衡器的名称，没有时返回空
+func EqualizerPresetOf(eq *EqualizerProcessor) string {
+	if eq == nil {
+		return ""
+	}
+	for _, p := range equalizerPresets {
+		if isPreset(eq, p.gains) {
+			return p.name
+		}
+	}
+	return ""
+}
+
+func isPreset(eq *EqualizerProcessor, gains []float64) bool {
+	n := 0
+	for _, f := range eq.Filters {
+		if f == nil {
+			continue
+		}
+		i := 0
+		for i < len(presetFrequencies) && presetFrequencies[i] != f.Frequency {
+			i++
+		}
+		if i == len(presetFrequencies) || eq.FilterType(f) != PeakingFilter || f.Gain != gains[i] || f.Q != presetQ {
+			return false
+		}
+		n++
+	}
+	return n == len(presetFrequencies)
+}
+
+// EqualizerPreset 按照名称生成预设均衡器，不存在时返回 nil
+func EqualizerPreset(name string) *EqualizerProcessor {
+	for _, p := range equalizerPresets {
+		if p.name != name {
+			continue
+		}
+		eq := NewPeakingFilterEqualizerProcessor(uint8(len(presetFrequencies)))
+		for i, f := range presetFrequencies {
+			eq.Set(f, p.gains[i], presetQ)
+		}
+		return eq
+	}
+	return nil
+}
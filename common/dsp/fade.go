@@ -0,0 +1,34 @@
+package dsp
+
+import "math"
+
+// FadeCurve 淡入淡出曲线
+type FadeCurve = uint8
+
+const (
+	LinearFade     FadeCurve = iota // 线性，交叉淡化时中间响度略低
+	EqualPowerFade                  // 等功率，交叉淡化时响度保持不变
+	SCurveFade                      // S 型，两端变化平缓
+	fadeCurveMax
+)
+
+func IsFadeCurveValid(c FadeCurve) bool {
+	return c < fadeCurveMax
+}
+
+// FadeGain 淡入曲线在 x（0~1）处的增益，淡出使用 FadeGain(c, 1-x)
+func FadeGain(c FadeCurve, x float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+	switch c {
+	case EqualPowerFade:
+		return math.Sin(x * Pi / 2)
+	case SCurveFade:
+		return 0.5 - 0.5*math.Cos(x*Pi)
+	}
+	return x
+}
@@ -105,3 +105,101 @@ func FFTN(pr []float64, n, rate int, logAxis bool) int {
 	}
 	return i
 }
+
+// FFTPlan 固定长度的复数 FFT，预先计算旋转因子和位反转表，可重复使用
+type FFTPlan struct {
+	n   int
+	cos []float64
+	sin []float64
+	rev []int
+}
+
+func (p *FFTPlan) Len() int {
+	return p.n
+}
+
+// Forward 原地正变换
+func (p *FFTPlan) Forward(re, im []float64) {
+	p.transform(re, im, false)
+}
+
+// Inverse 原地逆变换，结果已除以 n
+func (p *FFTPlan) Inverse(re, im []float64) {
+	p.transform(re, im, true)
+
+	s := 1 / float64(p.n)
+	for i := 0; i < p.n; i++ {
+		re[i] *= s
+		im[i] *= s
+	}
+}
+
+func (p *FFTPlan) transform(re, im []float64, inverse bool) {
+	var (
+		n                   = p.n
+		i, j, k, size, half int
+		step                int
+		wr, wi, tr, ti      float64
+	)
+
+	for i = 0; i < n; i++ {
+		j = p.rev[i]
+		if i < j {
+			re[i], re[j] = re[j], re[i]
+			im[i], im[j] = im[j], im[i]
+		}
+	}
+
+	for size = 2; size <= n; size <<= 1 {
+		half = size >> 1
+		step = n / size
+		for i = 0; i < n; i += size {
+			for k = 0; k < half; k++ {
+				wr = p.cos[k*step]
+				wi = -p.sin[k*step]
+				if inverse {
+					wi = -wi
+				}
+				j = i + k + half
+				tr = wr*re[j] - wi*im[j]
+				ti = wr*im[j] + wi*re[j]
+				re[j] = re[i+k] - tr
+				im[j] = im[i+k] - ti
+				re[i+k] += tr
+				im[i+k] += ti
+			}
+		}
+	}
+}
+
+// NewFFTPlan n 必须是 2 的幂
+func NewFFTPlan(n int) *FFTPlan {
+	if n < 2 || n&(n-1) != 0 {
+		return nil
+	}
+	p := &FFTPlan{
+		n:   n,
+		cos: make([]float64, n/2),
+		sin: make([]float64, n/2),
+		rev: make([]int, n),
+	}
+
+	for i := 0; i < n/2; i++ {
+		p.cos[i] = math.Cos(2 * Pi * float64(i) / float64(n))
+		p.sin[i] = math.Sin(2 * Pi * float64(i) / float64(n))
+	}
+
+	bits := 0
+	for 1<<bits < n {
+		bits++
+	}
+	for i := 0; i < n; i++ {
+		r := 0
+		for b := 0; b < bits; b++ {
+			r |= ((i >> b) & 1) << (bits - 1 - b)
+		}
+		p.rev[i] = r
+	}
+
+	return p
+}
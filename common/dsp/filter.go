@@ -2,13 +2,15 @@ package dsp
 
 import (
 	"math"
+	"math/cmplx"
 )
 
 const Pi float64 = math.Pi
 
 // Robert Bristow-Johnson's audio EQ cookbook
 type Filter struct {
-	t FilterType
+	t    FilterType
+	rate int
 
 	FilterParams
 
@@ -42,6 +44,12 @@ func (f *Filter) Process(input float64) float64 {
 }
 
 func (e *Filter) Init(rate int) {
+	e.rate = rate
+	if rate <= 0 || e.Frequency <= 0 || e.Frequency*2 >= rate {
+		e.bypass()
+		return
+	}
+
 	switch e.t {
 	case LowPassFilter:
 		e.initLowPass(rate)
@@ -49,13 +57,41 @@ func (e *Filter) Init(rate int) {
 		e.initHighPass(rate)
 	case PeakingFilter:
 		e.initPeaking(rate)
+	case NotchFilter:
+		e.initNotch(rate)
+	case LowShelfFilter:
+		e.initLowShelf(rate)
+	case HighShelfFilter:
+		e.initHighShelf(rate)
+	case BandPassFilter:
+		e.initBandPass(rate)
+	case AllPassFilter:
+		e.initAllPass(rate)
+	default:
+		e.bypass()
+	}
+}
+
+// 直通
+func (e *Filter) bypass() {
+	e.a0, e.a1, e.a2 = 1, 0, 0
+	e.b0, e.b1, e.b2 = 1, 0, 0
+}
+
+func (e *Filter) q() float64 {
+	if e.Q <= 0 {
+		return math.Sqrt2 / 2
 	}
+	return e.Q
+}
+
+func (e *Filter) w0(rate int) float64 {
+	return 2.0 * Pi * float64(e.Frequency) / float64(rate)
 }
 
 func (e *Filter) initLowPass(rate int) {
-	q := e.Q
-	w0 := 2.0 * Pi * float64(e.Frequency) / float64(rate)
-	alpha := math.Sin(w0) / (2.0 * q)
+	w0 := e.w0(rate)
+	alpha := math.Sin(w0) / (2.0 * e.q())
 
 	e.a0 = 1.0 + alpha
 	e.a1 = -2.0 * math.Cos(w0)
@@ -66,9 +102,8 @@ func (e *Filter) initLowPass(rate int) {
 }
 
 func (e *Filter) initHighPass(rate int) {
-	q := e.Q
-	w0 := 2.0 * Pi * float64(e.Frequency) / float64(rate)
-	alpha := math.Sin(w0) / (2.0 * q)
+	w0 := e.w0(rate)
+	alpha := math.Sin(w0) / (2.0 * e.q())
 
 	e.a0 = 1.0 + alpha
 	e.a1 = -2.0 * math.Cos(w0)
@@ -79,10 +114,18 @@ func (e *Filter) initHighPass(rate int) {
 }
 
 func (e *Filter) initPeaking(rate int) {
-	width := 0.5
-	w0 := 2.0 * Pi * float64(e.Frequency) / float64(rate)
-	alpha := math.Sin(w0) * math.Sinh(math.Log(2.0)/2.0*width*w0/math.Sin(w0))
-	a := math.Pow(10.0, (e.Gain / 40.0))
+	var (
+		w0    = e.w0(rate)
+		alpha float64
+		a     = math.Pow(10.0, (e.Gain / 40.0))
+	)
+	if e.Q > 0 {
+		alpha = math.Sin(w0) / (2.0 * e.Q)
+	} else {
+		// 未指定 Q 时使用 0.5 倍频程的带宽
+		width := 0.5
+		alpha = math.Sin(w0) * math.Sinh(math.Log(2.0)/2.0*width*w0/math.Sin(w0))
+	}
 
 	e.a0 = 1.0 + alpha/a
 	e.a1 = -2.0 * math.Cos(w0)
@@ -92,8 +135,102 @@ func (e *Filter) initPeaking(rate int) {
 	e.b2 = 1.0 - alpha*a
 }
 
+func (e *Filter) initNotch(rate int) {
+	w0 := e.w0(rate)
+	alpha := math.Sin(w0) / (2.0 * e.q())
+
+	e.a0 = 1.0 + alpha
+	e.a1 = -2.0 * math.Cos(w0)
+	e.a2 = 1.0 - alpha
+	e.b0 = 1.0
+	e.b1 = -2.0 * math.Cos(w0)
+	e.b2 = 1.0
+}
+
+func (e *Filter) initLowShelf(rate int) {
+	w0 := e.w0(rate)
+	a := math.Pow(10.0, (e.Gain / 40.0))
+	alpha := math.Sin(w0) / (2.0 * e.q())
+	cos := math.Cos(w0)
+	sa := 2.0 * math.Sqrt(a) * alpha
+
+	e.a0 = (a + 1) + (a-1)*cos + sa
+	e.a1 = -2.0 * ((a - 1) + (a+1)*cos)
+	e.a2 = (a + 1) + (a-1)*cos - sa
+	e.b0 = a * ((a + 1) - (a-1)*cos + sa)
+	e.b1 = 2.0 * a * ((a - 1) - (a+1)*cos)
+	e.b2 = a * ((a + 1) - (a-1)*cos - sa)
+}
+
+func (e *Filter) initHighShelf(rate int) {
+	w0 := e.w0(rate)
+	a := math.Pow(10.0, (e.Gain / 40.0))
+	alpha := math.Sin(w0) / (2.0 * e.q())
+	cos := math.Cos(w0)
+	sa := 2.0 * math.Sqrt(a) * alpha
+
+	e.a0 = (a + 1) - (a-1)*cos + sa
+	e.a1 = 2.0 * ((a - 1) - (a+1)*cos)
+	e.a2 = (a + 1) - (a-1)*cos - sa
+	e.b0 = a * ((a + 1) + (a-1)*cos + sa)
+	e.b1 = -2.0 * a * ((a - 1) + (a+1)*cos)
+	e.b2 = a * ((a + 1) + (a-1)*cos - sa)
+}
+
+func (e *Filter) initBandPass(rate int) {
+	w0 := e.w0(rate)
+	alpha := math.Sin(w0) / (2.0 * e.q())
+
+	e.a0 = 1.0 + alpha
+	e.a1 = -2.0 * math.Cos(w0)
+	e.a2 = 1.0 - alpha
+	e.b0 = alpha
+	e.b1 = 0
+	e.b2 = -alpha
+}
+
+func (e *Filter) initAllPass(rate int) {
+	w0 := e.w0(rate)
+	alpha := math.Sin(w0) / (2.0 * e.q())
+
+	e.a0 = 1.0 + alpha
+	e.a1 = -2.0 * math.Cos(w0)
+	e.a2 = 1.0 - alpha
+	e.b0 = 1.0 - alpha
+	e.b1 = -2.0 * math.Cos(w0)
+	e.b2 = 1.0 + alpha
+}
+
+// Response 指定频率处的复数响应 H(e^jw)
+func (e *Filter) Response(freq float64) complex128 {
+	if e.rate <= 0 {
+		return 1
+	}
+	w := 2.0 * Pi * freq / float64(e.rate)
+	z1 := cmplx.Exp(complex(0, -w))
+	z2 := z1 * z1
+
+	num := complex(e.b0, 0) + complex(e.b1, 0)*z1 + complex(e.b2, 0)*z2
+	den := complex(e.a0, 0) + complex(e.a1, 0)*z1 + complex(e.a2, 0)*z2
+	return num / den
+}
+
+// Reset 清除历史状态，系数不变
+func (f *Filter) Reset() {
+	f.in1, f.in2 = 0, 0
+	f.out1, f.out2 = 0, 0
+}
+
+// NewBiquad 直接使用系数创建二阶滤波器
+func NewBiquad(b0, b1, b2, a0, a1, a2 float64) *Filter {
+	return &Filter{
+		a0: a0, a1: a1, a2: a2,
+		b0: b0, b1: b1, b2: b2,
+	}
+}
+
 func NewFilter(eq FilterParams, rate int) *Filter {
-	f := &Filter{FilterParams: eq}
+	f := &Filter{FilterParams: eq, t: eq.Type}
 	f.Init(rate)
 	return f
 }
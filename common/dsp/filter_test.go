@@ -0,0 +1,101 @@
+package dsp
+
+import (
+	"math"
+	"math/cmplx"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// 稳定后正弦信号通过滤波器的增益 dB
+func filterSineGain(f *Filter, rate int, freq float64) float64 {
+	var (
+		n   = rate / 2
+		in  = 0.0
+		out = 0.0
+	)
+	for i := 0; i < n; i++ {
+		x := math.Sin(2 * Pi * freq * float64(i) / float64(rate))
+		y := f.Process(x)
+		if i < n/2 {
+			continue
+		}
+		in += x * x
+		out += y * y
+	}
+	return 10 * math.Log10(out/in)
+}
+
+func responseDB(f *Filter, freq float64) float64 {
+	return 20 * math.Log10(cmplx.Abs(f.Response(freq)))
+}
+
+func TestFilter_Response(t *testing.T) {
+	const rate = 48000
+
+	tests := []struct {
+		name  string
+		p     FilterParams
+		freq  float64
+		gain  float64 // 期望的增益 dB
+		delta float64
+	}{
+		{"lowpass cutoff", FilterParams{Frequency: 1000, Q: math.Sqrt2 / 2, Type: LowPassFilter}, 1000, -3.01, 0.05},
+		{"lowpass pass", FilterParams{Frequency: 1000, Q: math.Sqrt2 / 2, Type: LowPassFilter}, 50, 0, 0.05},
+		{"highpass cutoff", FilterParams{Frequency: 1000, Q: math.Sqrt2 / 2, Type: HighPassFilter}, 1000, -3.01, 0.05},
+		{"peaking centre", FilterParams{Frequency: 2000, Gain: 6, Q: 1.4, Type: PeakingFilter}, 2000, 6, 0.05},
+		{"peaking cut", FilterParams{Frequency: 2000, Gain: -9, Q: 1.4, Type: PeakingFilter}, 2000, -9, 0.05},
+		{"peaking far", FilterParams{Frequency: 2000, Gain: 6, Q: 1.4, Type: PeakingFilter}, 100, 0, 0.1},
+		{"lowshelf cutoff", FilterParams{Frequency: 300, Gain: 6, Q: math.Sqrt2 / 2, Type: LowShelfFilter}, 300, 3, 0.05},
+		{"lowshelf shelf", FilterParams{Frequency: 300, Gain: 6, Q: math.Sqrt2 / 2, Type: LowShelfFilter}, 20, 6, 0.1},
+		{"lowshelf high", FilterParams{Frequency: 300, Gain: 6, Q: math.Sqrt2 / 2, Type: LowShelfFilter}, 10000, 0, 0.1},
+		{"highshelf cutoff", FilterParams{Frequency: 5000, Gain: -6, Q: math.Sqrt2 / 2, Type: HighShelfFilter}, 5000, -3, 0.05},
+		{"highshelf shelf", FilterParams{Frequency: 5000, Gain: -6, Q: math.Sqrt2 / 2, Type: HighShelfFilter}, 22000, -6, 0.2},
+		{"highshelf low", FilterParams{Frequency: 5000, Gain: -6, Q: math.Sqrt2 / 2, Type: HighShelfFilter}, 100, 0, 0.1},
+		{"bandpass centre", FilterParams{Frequency: 1000, Q: 2, Type: BandPassFilter}, 1000, 0, 0.05},
+		{"bandpass off", FilterParams{Frequency: 1000, Q: 2, Type: BandPassFilter}, 100, -25, 1},
+		{"notch off", FilterParams{Frequency: 1000, Q: 2, Type: NotchFilter}, 5000, 0, 0.1},
+		{"allpass centre", FilterParams{Frequency: 1000, Q: 0.7, Type: AllPassFilter}, 1000, 0, 1e-6},
+		{"allpass off", FilterParams{Frequency: 1000, Q: 0.7, Type: AllPassFilter}, 9000, 0, 1e-6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := NewFilter(tt.p, rate)
+			assert.InDelta(t, tt.gain, responseDB(f, tt.freq), tt.delta)
+			if tt.gain > -30 {
+				// 实际处理的结果与理论响应一致
+				assert.InDelta(t, tt.gain, filterSineGain(f, rate, tt.freq), tt.delta+0.05)
+			}
+		})
+	}
+
+	// 阻带，双线性变换使高频衰减更快
+	f := NewFilter(FilterParams{Frequency: 1000, Q: math.Sqrt2 / 2, Type: LowPassFilter}, rate)
+	assert.Less(t, responseDB(f, 10000), -40.0)
+	f = NewFilter(FilterParams{Frequency: 1000, Q: math.Sqrt2 / 2, Type: HighPassFilter}, rate)
+	assert.Less(t, responseDB(f, 100), -39.0)
+	f = NewFilter(FilterParams{Frequency: 1000, Q: 2, Type: NotchFilter}, rate)
+	assert.Less(t, responseDB(f, 1000), -100.0)
+	assert.Less(t, filterSineGain(f, rate, 1000), -60.0)
+
+	// 全通在中心频率处相移 180 度
+	f = NewFilter(FilterParams{Frequency: 1000, Q: 0.7, Type: AllPassFilter}, rate)
+	assert.InDelta(t, 180, math.Abs(cmplx.Phase(f.Response(1000))*180/Pi), 1e-6)
+
+	// 超出奈奎斯特频率时直通
+	f = NewFilter(FilterParams{Frequency: 30000, Q: 0.7, Type: LowPassFilter}, rate)
+	assert.InDelta(t, 0, responseDB(f, 10000), 1e-9)
+}
+
+func TestEqualizerProcessor_Response(t *testing.T) {
+	eq := NewPeakingFilterEqualizerProcessor(2)
+	eq.SetFilter(FilterParams{Frequency: 100, Gain: 6, Q: math.Sqrt2 / 2, Type: LowShelfFilter})
+	eq.SetFilter(FilterParams{Frequency: 1000, Gain: -3, Q: 1})
+
+	mag, _ := eq.Response(48000, []float64{1000, 15000})
+	// 频段的响应相乘，dB 相加
+	shelf := NewFilter(FilterParams{Frequency: 100, Gain: 6, Q: math.Sqrt2 / 2, Type: LowShelfFilter}, 48000)
+	assert.InDelta(t, -3+responseDB(shelf, 1000), mag[0], 1e-6)
+	assert.InDelta(t, 0, mag[1], 0.1)
+}
@@ -0,0 +1,218 @@
+package dsp
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// ImpulseMaxTaps 冲激响应最大长度，约 192000hz 下 10 秒
+const ImpulseMaxTaps = 1 << 21
+
+// ImpulseResponse 冲激响应，每个声道独立
+type ImpulseResponse struct {
+	Rate int
+	Data [][]float64
+}
+
+func (r *ImpulseResponse) Channels() int {
+	return len(r.Data)
+}
+
+func (r *ImpulseResponse) Taps() int {
+	if len(r.Data) == 0 {
+		return 0
+	}
+	return len(r.Data[0])
+}
+
+// Resample 转换为指定采样率，返回新的对象
+func (r *ImpulseResponse) Resample(rate int) *ImpulseResponse {
+	if rate == r.Rate || rate <= 0 || r.Rate <= 0 {
+		return r
+	}
+	nr := &ImpulseResponse{Rate: rate, Data: make([][]float64, len(r.Data))}
+	for ch, d := range r.Data {
+		nr.Data[ch] = resampleSinc(d, r.Rate, rate)
+	}
+	return nr
+}
+
+// 离线的加窗 sinc 插值，只用于冲激响应这类短数据
+func resampleSinc(in []float64, from, to int) []float64 {
+	const halfTaps = 32
+
+	var (
+		ratio  = float64(to) / float64(from)
+		cutoff = math.Min(1, ratio) // 降采样时需要低通
+		out    = make([]float64, (len(in)*to+from-1)/from)
+		gain   = cutoff
+		width  = float64(halfTaps) / cutoff
+	)
+
+	for i := range out {
+		t := float64(i) / ratio
+		c := int(math.Floor(t))
+		sum := 0.0
+		for j := c - int(width); j <= c+int(width)+1; j++ {
+			if j < 0 || j >= len(in) {
+				continue
+			}
+			x := t - float64(j)
+			if math.Abs(x) > width {
+				continue
+			}
+			// Blackman 窗
+			w := 0.42 + 0.5*math.Cos(Pi*x/width) + 0.08*math.Cos(2*Pi*x/width)
+			sum += in[j] * sinc(x*cutoff) * w
+		}
+		// 保持冲激响应的能量与采样率无关
+		out[i] = sum * gain / ratio
+	}
+	return out
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	return math.Sin(Pi*x) / (Pi * x)
+}
+
+const (
+	wavFormatPCM        = 1
+	wavFormatFloat      = 3
+	wavFormatExtensible = 0xFFFE
+)
+
+// LoadImpulseResponse 从 WAV 文件中读取冲激响应
+func LoadImpulseResponse(file string) (*ImpulseResponse, error) {
+	fp, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer fp.Close()
+
+	return ReadImpulseResponse(fp)
+}
+
+// ReadImpulseResponse 支持 8/16/24/32 位整型和 32/64 位浮点 WAV
+func ReadImpulseResponse(r io.Reader) (*ImpulseResponse, error) {
+	var (
+		head     [12]byte
+		chunk    [8]byte
+		format   uint16
+		channels int
+		bits     int
+		rate     int
+	)
+
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return nil, err
+	}
+	if string(head[0:4]) != "RIFF" || string(head[8:12]) != "WAVE" {
+		return nil, errors.New("not a wav file")
+	}
+
+	for {
+		if _, err := io.ReadFull(r, chunk[:]); err != nil {
+			if err == io.EOF {
+				return nil, errors.New("wav data chunk not found")
+			}
+			return nil, err
+		}
+		size := int(binary.LittleEndian.Uint32(chunk[4:]))
+
+		switch string(chunk[0:4]) {
+		case "fmt ":
+			if size < 16 {
+				return nil, fmt.Errorf("wav fmt chunk size %d invalid", size)
+			}
+			p := make([]byte, size+size&1)
+			if _, err := io.ReadFull(r, p); err != nil {
+				return nil, err
+			}
+			format = binary.LittleEndian.Uint16(p[0:])
+			channels = int(binary.LittleEndian.Uint16(p[2:]))
+			rate = int(binary.LittleEndian.Uint32(p[4:]))
+			bits = int(binary.LittleEndian.Uint16(p[14:]))
+			if format == wavFormatExtensible && size >= 26 {
+				format = binary.LittleEndian.Uint16(p[24:])
+			}
+		case "data":
+			if channels == 0 {
+				return nil, errors.New("wav fmt chunk not found")
+			}
+			return readWavData(r, size, format, channels, bits, rate)
+		default:
+			if _, err := io.CopyN(io.Discard, r, int64(size+size&1)); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+func readWavData(r io.Reader, size int, format uint16, channels, bits, rate int) (*ImpulseResponse, error) {
+	if format != wavFormatPCM && format != wavFormatFloat {
+		return nil, fmt.Errorf("wav format %d unsupported", format)
+	}
+	if channels <= 0 || rate <= 0 {
+		return nil, fmt.Errorf("wav channels %d or rate %d invalid", channels, rate)
+	}
+	bytes := bits / 8
+	switch {
+	case format == wavFormatPCM && bytes >= 1 && bytes <= 4:
+	case format == wavFormatFloat && (bytes == 4 || bytes == 8):
+	default:
+		return nil, fmt.Errorf("wav bits %d unsupported", bits)
+	}
+
+	frames := size / bytes / channels
+	if frames > ImpulseMaxTaps {
+		return nil, fmt.Errorf("impulse response too long: %d", frames)
+	}
+
+	p := make([]byte, frames*bytes*channels)
+	if _, err := io.ReadFull(r, p); err != nil {
+		return nil, err
+	}
+
+	ir := &ImpulseResponse{Rate: rate, Data: make([][]float64, channels)}
+	for ch := 0; ch < channels; ch++ {
+		ir.Data[ch] = make([]float64, frames)
+	}
+
+	for i := 0; i < frames; i++ {
+		for ch := 0; ch < channels; ch++ {
+			b := p[(i*channels+ch)*bytes:]
+			ir.Data[ch][i] = wavSample(b, format, bytes)
+		}
+	}
+
+	return ir, nil
+}
+
+func wavSample(b []byte, format uint16, bytes int) float64 {
+	if format == wavFormatFloat {
+		if bytes == 4 {
+			return float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(b))
+	}
+
+	switch bytes {
+	case 1:
+		// 8 位是无符号的
+		return (float64(b[0]) - 128) / 128
+	case 2:
+		return float64(int16(binary.LittleEndian.Uint16(b))) / (1 << 15)
+	case 3:
+		v := int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24) >> 8
+		return float64(v) / (1 << 23)
+	default:
+		return float64(int32(binary.LittleEndian.Uint32(b))) / (1 << 31)
+	}
+}
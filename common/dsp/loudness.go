@@ -0,0 +1,225 @@
+package dsp
+
+import (
+	"math"
+
+	"github.com/zwcway/castserver-go/common/audio"
+)
+
+// ITU-R BS.1770 响度测量
+const (
+	LoudnessAbsoluteGate float64 = -70 // 绝对门限 LUFS
+	LoudnessRelativeGate float64 = -10 // 相对门限 LU
+
+	loudnessHistMin  = LoudnessAbsoluteGate
+	loudnessHistMax  = 5.0
+	loudnessHistStep = 0.1 // 直方图精度 LU
+)
+
+// 能量转换为 LUFS
+func energyToLoudness(e float64) float64 {
+	if e <= 0 {
+		return math.Inf(-1)
+	}
+	return -0.691 + 10*math.Log10(e)
+}
+
+// DbToLinear 分贝转换为线性增益
+func DbToLinear(db float64) float64 {
+	return math.Pow(10, db/20)
+}
+
+// LinearToDb 线性增益转换为分贝
+func LinearToDb(v float64) float64 {
+	if v <= 0 {
+		return math.Inf(-1)
+	}
+	return 20 * math.Log10(v)
+}
+
+// 声道权重，LFE 不参与计算，环绕声道 +1.5dB
+func loudnessChannelWeight(ch audio.Channel) float64 {
+	switch ch {
+	case audio.Channel_LOW_FREQUENCY:
+		return 0
+	case audio.Channel_BACK_LEFT, audio.Channel_BACK_RIGHT, audio.Channel_SIDE_LEFT, audio.Channel_SIDE_RIGHT:
+		return 1.41
+	}
+	return 1
+}
+
+// K 计权滤波器，任意采样率下按原始模拟原型重新计算系数
+func newKWeighting(rate int) [2]*Filter {
+	var (
+		f0 = 1681.974450955533
+		g  = 3.999843853973347
+		q  = 0.7071752369554196
+		k  = math.Tan(Pi * f0 / float64(rate))
+		vh = math.Pow(10, g/20)
+		vb = math.Pow(vh, 0.4996667741545416)
+		a0 = 1 + k/q + k*k
+	)
+	shelf := NewBiquad(
+		(vh+vb*k/q+k*k)/a0, 2*(k*k-vh)/a0, (vh-vb*k/q+k*k)/a0,
+		1, 2*(k*k-1)/a0, (1-k/q+k*k)/a0,
+	)
+
+	f0 = 38.13547087602444
+	q = 0.5003270373238773
+	k = math.Tan(Pi * f0 / float64(rate))
+	a0 = 1 + k/q + k*k
+	highPass := NewBiquad(
+		1, -2, 1,
+		1, 2*(k*k-1)/a0, (1-k/q+k*k)/a0,
+	)
+
+	return [2]*Filter{shelf, highPass}
+}
+
+// LoudnessMeter 测量瞬时（400ms）、短期（3s）和门限积分响度
+type LoudnessMeter struct {
+	weights []float64
+	filters [][2]*Filter
+
+	block int         // 100ms 的样本数
+	pos   int         // 当前子块的位置
+	sum   float64     // 当前子块的加权平方和
+	subs  [30]float64 // 最近 3s 的子块能量
+	nsubs int         // 已完成的子块数量
+
+	hist       []int     // 积分响度直方图，每个 400ms 块一个计数
+	histEnergy []float64 // 每个直方图区间的能量和
+}
+
+func (m *LoudnessMeter) Reset() {
+	for _, fs := range m.filters {
+		fs[0].Reset()
+		fs[1].Reset()
+	}
+	m.pos = 0
+	m.sum = 0
+	m.nsubs = 0
+	for i := range m.subs {
+		m.subs[i] = 0
+	}
+	for i := range m.hist {
+		m.hist[i] = 0
+		m.histEnergy[i] = 0
+	}
+}
+
+// Process data 为 planar 格式，n 为每声道样本数
+func (m *LoudnessMeter) Process(data [][]float64, n int) {
+	var (
+		i, ch int
+		s     float64
+	)
+	for i = 0; i < n; i++ {
+		for ch = 0; ch < len(m.filters) && ch < len(data); ch++ {
+			if m.weights[ch] == 0 {
+				continue
+			}
+			s = m.filters[ch][1].Process(m.filters[ch][0].Process(data[ch][i]))
+			m.sum += m.weights[ch] * s * s
+		}
+		m.pos++
+		if m.pos >= m.block {
+			m.endSubBlock()
+		}
+	}
+}
+
+func (m *LoudnessMeter) endSubBlock() {
+	m.subs[m.nsubs%len(m.subs)] = m.sum / float64(m.block)
+	m.nsubs++
+	m.sum = 0
+	m.pos = 0
+
+	// 每 100ms 产生一个 400ms 的块，即 75% 重叠
+	if m.nsubs < 4 {
+		return
+	}
+	e := m.energy(4)
+	l := energyToLoudness(e)
+	if l < loudnessHistMin {
+		return
+	}
+	idx := int((l - loudnessHistMin) / loudnessHistStep)
+	if idx >= len(m.hist) {
+		idx = len(m.hist) - 1
+	}
+	m.hist[idx]++
+	m.histEnergy[idx] += e
+}
+
+// 最近 n 个子块的平均能量
+func (m *LoudnessMeter) energy(n int) float64 {
+	if m.nsubs < n {
+		return 0
+	}
+	e := 0.0
+	for i := 1; i <= n; i++ {
+		e += m.subs[(m.nsubs-i)%len(m.subs)]
+	}
+	return e / float64(n)
+}
+
+// Momentary 瞬时响度 LUFS
+func (m *LoudnessMeter) Momentary() float64 {
+	return energyToLoudness(m.energy(4))
+}
+
+// ShortTerm 短期响度 LUFS
+func (m *LoudnessMeter) ShortTerm() float64 {
+	return energyToLoudness(m.energy(len(m.subs)))
+}
+
+// Integrated 门限积分响度 LUFS
+func (m *LoudnessMeter) Integrated() float64 {
+	var (
+		count  int
+		energy float64
+	)
+	for i := range m.hist {
+		count += m.hist[i]
+		energy += m.histEnergy[i]
+	}
+	if count == 0 {
+		return math.Inf(-1)
+	}
+
+	gate := energyToLoudness(energy/float64(count)) + LoudnessRelativeGate
+	start := int(math.Ceil((gate - loudnessHistMin) / loudnessHistStep))
+	if start < 0 {
+		start = 0
+	}
+
+	count = 0
+	energy = 0
+	for i := start; i < len(m.hist); i++ {
+		count += m.hist[i]
+		energy += m.histEnergy[i]
+	}
+	if count == 0 {
+		return math.Inf(-1)
+	}
+	return energyToLoudness(energy / float64(count))
+}
+
+func NewLoudnessMeter(rate int, chs []audio.Channel) *LoudnessMeter {
+	m := &LoudnessMeter{
+		weights:    make([]float64, len(chs)),
+		filters:    make([][2]*Filter, len(chs)),
+		block:      rate / 10,
+		hist:       make([]int, int((loudnessHistMax-loudnessHistMin)/loudnessHistStep)+1),
+		histEnergy: make([]float64, int((loudnessHistMax-loudnessHistMin)/loudnessHistStep)+1),
+	}
+	if m.block <= 0 {
+		m.block = 1
+	}
+	for i, ch := range chs {
+		m.weights[i] = loudnessChannelWeight(ch)
+		m.filters[i] = newKWeighting(rate)
+	}
+	return m
+}
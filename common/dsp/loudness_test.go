@@ -0,0 +1,45 @@
+package dsp
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zwcway/castserver-go/common/audio"
+)
+
+// EBU Tech 3341: 1kHz 立体声正弦波 -23dBFS 应为 -23 LUFS
+func TestLoudnessMeter(t *testing.T) {
+	for _, rate := range []int{44100, 48000, 96000} {
+		var (
+			m    = NewLoudnessMeter(rate, []audio.Channel{audio.Channel_FRONT_LEFT, audio.Channel_FRONT_RIGHT})
+			amp  = math.Pow(10, -23.0/20)
+			n    = rate * 20
+			data = [][]float64{make([]float64, n), make([]float64, n)}
+		)
+		for i := 0; i < n; i++ {
+			data[0][i] = amp * math.Sin(2*Pi*1000*float64(i)/float64(rate))
+			data[1][i] = data[0][i]
+		}
+		m.Process(data, n)
+
+		assert.InDelta(t, -23, m.Momentary(), 0.1)
+		assert.InDelta(t, -23, m.ShortTerm(), 0.1)
+		assert.InDelta(t, -23, m.Integrated(), 0.1)
+	}
+
+	t.Run("gating", func(t *testing.T) {
+		var (
+			rate = 48000
+			m    = NewLoudnessMeter(rate, []audio.Channel{audio.Channel_FRONT_CENTER})
+			n    = rate * 10
+			data = [][]float64{make([]float64, n)}
+		)
+		// 静音部分低于绝对门限，不影响积分响度
+		for i := n / 2; i < n; i++ {
+			data[0][i] = math.Pow(10, -20.0/20) * math.Sin(2*Pi*1000*float64(i)/float64(rate))
+		}
+		m.Process(data, n)
+		assert.InDelta(t, -23, m.Integrated(), 0.2)
+	})
+}
@@ -0,0 +1,78 @@
+package dsp
+
+import "math"
+
+// ITU-R BS.1770 真峰值，4 倍过采样后取最大绝对值
+const (
+	truePeakFactor = 4
+	truePeakTaps   = 12 // 每个相位的抽头数
+)
+
+// 按相位分解的插值滤波器，系数按照时间顺序排列，最后一个对应最新的样本
+var truePeakCoef = newTruePeakCoef()
+
+// 加 Blackman 窗的 sinc 低通，截止于原采样率的奈奎斯特频率
+func newTruePeakCoef() (c [truePeakFactor][truePeakTaps]float64) {
+	const (
+		n      = truePeakFactor * truePeakTaps
+		center = n / 2
+	)
+	for p := 0; p < truePeakFactor; p++ {
+		sum := 0.0
+		for k := 0; k < truePeakTaps; k++ {
+			j := k*truePeakFactor + p
+			x := float64(j-center) / truePeakFactor
+			h := 1.0
+			if x != 0 {
+				h = math.Sin(math.Pi*x) / (math.Pi * x)
+			}
+			w := 0.42 - 0.5*math.Cos(2*math.Pi*float64(j)/n) + 0.08*math.Cos(4*math.Pi*float64(j)/n)
+			c[p][truePeakTaps-1-k] = h * w
+			sum += h * w
+		}
+		// 每个相位的直流增益为 1
+		for k := range c[p] {
+			c[p][k] /= sum
+		}
+	}
+	return
+}
+
+// TruePeak 单个声道的真峰值检测
+type TruePeak struct {
+	hist [2 * truePeakTaps]float64 // 两份相同的历史，便于连续读取
+	pos  int
+}
+
+// Push 输入一个样本，返回过采样后的最大绝对值
+func (t *TruePeak) Push(v float64) float64 {
+	t.hist[t.pos] = v
+	t.hist[t.pos+truePeakTaps] = v
+	t.pos++
+	if t.pos == truePeakTaps {
+		t.pos = 0
+	}
+
+	var (
+		x    = t.hist[t.pos : t.pos+truePeakTaps]
+		peak float64
+	)
+	for p := range truePeakCoef {
+		y := 0.0
+		for k, c := range truePeakCoef[p] {
+			y += c * x[k]
+		}
+		if y < 0 {
+			y = -y
+		}
+		if y > peak {
+			peak = y
+		}
+	}
+	return peak
+}
+
+// Reset 清空历史
+func (t *TruePeak) Reset() {
+	*t = TruePeak{}
+}
@@ -0,0 +1,42 @@
+package dsp
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTruePeak(t *testing.T) {
+	// 四分之一采样率、相位 45 度的正弦，样本峰值约 -3dB，真峰值为 0dB
+	var (
+		tp         TruePeak
+		samplePeak float64
+		truePeak   float64
+	)
+	for i := 0; i < 480; i++ {
+		v := math.Sin(math.Pi*float64(i)/2 + math.Pi/4)
+		samplePeak = math.Max(samplePeak, math.Abs(v))
+		p := tp.Push(v)
+		if i > truePeakTaps {
+			truePeak = math.Max(truePeak, p)
+		}
+	}
+	assert.InDelta(t, math.Sqrt2/2, samplePeak, 1e-9)
+	assert.InDelta(t, 1.0, truePeak, 0.02)
+
+	// 直流不会过冲
+	tp.Reset()
+	for i := 0; i < 100; i++ {
+		truePeak = tp.Push(0.5)
+	}
+	assert.InDelta(t, 0.5, truePeak, 1e-9)
+
+	// 低频时与样本峰值一致
+	tp.Reset()
+	truePeak = 0
+	for i := 0; i < 4800; i++ {
+		truePeak = math.Max(truePeak, tp.Push(math.Sin(2*math.Pi*100*float64(i)/48000)))
+	}
+	assert.InDelta(t, 1.0, truePeak, 0.01)
+}
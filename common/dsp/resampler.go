@@ -0,0 +1,177 @@
+package dsp
+
+import (
+	"math"
+)
+
+// 多相加窗 sinc 重采样，参数与 swresample 的默认值一致
+const (
+	resampleHalfTaps = 16   // 原始采样率下每侧的抽头数
+	resampleCutoff   = 0.97 // 截止频率相对于较低奈奎斯特频率的比例
+	resampleBeta     = 9    // Kaiser 窗参数
+)
+
+// Resampler 有理数比例的多相重采样，可以分段连续处理
+type Resampler struct {
+	inRate  int
+	outRate int
+
+	l      int         // 插值因子，即相位数量
+	m      int         // 抽取因子
+	radius int         // 每侧需要的输入样本数
+	phases [][]float64 // 每个相位 2*radius 个系数
+
+	pos   int         // 下一个输出样本在缓存中的位置，单位为 1/l 个输入样本
+	tails [][]float64 // 每个声道未用完的输入
+	ext   [][]float64
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// 零阶修正贝塞尔函数
+func besselI0(x float64) float64 {
+	var (
+		sum  = 1.0
+		term = 1.0
+		y    = x * x / 4
+	)
+	for k := 1; k < 50; k++ {
+		term *= y / float64(k*k)
+		sum += term
+		if term < sum*1e-12 {
+			break
+		}
+	}
+	return sum
+}
+
+func (r *Resampler) initPhases() {
+	var (
+		ratio = math.Min(1, float64(r.outRate)/float64(r.inRate))
+		fc    = resampleCutoff * ratio // 相对于输入奈奎斯特频率
+		taps  = 2 * r.radius
+		i0    = besselI0(resampleBeta)
+	)
+
+	r.phases = make([][]float64, r.l)
+	for p := 0; p < r.l; p++ {
+		var (
+			h   = make([]float64, taps)
+			f   = float64(p) / float64(r.l)
+			sum float64
+		)
+		for j := 0; j < taps; j++ {
+			t := f + float64(r.radius-1-j)
+			x := t / float64(r.radius)
+			if x <= -1 || x >= 1 {
+				continue
+			}
+			h[j] = fc * sinc(fc*t) * besselI0(resampleBeta*math.Sqrt(1-x*x)) / i0
+			sum += h[j]
+		}
+		// 每个相位的直流增益为 1
+		for j := range h {
+			h[j] /= sum
+		}
+		r.phases[p] = h
+	}
+}
+
+func (r *Resampler) InRate() int {
+	return r.inRate
+}
+
+func (r *Resampler) OutRate() int {
+	return r.outRate
+}
+
+func (r *Resampler) Channels() int {
+	return len(r.tails)
+}
+
+// OutputSize 输入 n 个样本时最多输出的样本数
+func (r *Resampler) OutputSize(n int) int {
+	return int((int64(len(r.tails[0])+n)*int64(r.l)-int64(r.pos))/int64(r.m)) + 2
+}
+
+// Process in 和 out 为 planar 格式，n 为每声道的输入样本数，返回每声道的输出样本数
+func (r *Resampler) Process(in [][]float64, n int, out [][]float64) int {
+	var (
+		chs  = len(r.tails)
+		size int
+		k    int
+	)
+	for ch := 0; ch < chs; ch++ {
+		r.ext[ch] = append(append(r.ext[ch][:0], r.tails[ch]...), in[ch][:n]...)
+	}
+	size = len(r.ext[0])
+
+	for ; k < len(out[0]); k++ {
+		i := r.pos / r.l
+		if i+r.radius >= size {
+			break
+		}
+		h := r.phases[r.pos%r.l]
+		start := i - r.radius + 1
+		for ch := 0; ch < chs; ch++ {
+			x := r.ext[ch][start : start+len(h)]
+			v := 0.0
+			for j := range h {
+				v += h[j] * x[j]
+			}
+			out[ch][k] = v
+		}
+		r.pos += r.m
+	}
+
+	// 保留下一个输出需要的输入
+	drop := r.pos/r.l - r.radius + 1
+	if drop > size {
+		drop = size
+	}
+	if drop > 0 {
+		r.pos -= drop * r.l
+		for ch := 0; ch < chs; ch++ {
+			r.tails[ch] = append(r.tails[ch][:0], r.ext[ch][drop:]...)
+		}
+	} else {
+		for ch := 0; ch < chs; ch++ {
+			r.tails[ch] = append(r.tails[ch][:0], r.ext[ch]...)
+		}
+	}
+
+	return k
+}
+
+// Reset 清除缓存的输入，输出与下一个输入样本对齐
+func (r *Resampler) Reset() {
+	for ch := range r.tails {
+		r.tails[ch] = append(r.tails[ch][:0], make([]float64, r.radius-1)...)
+	}
+	r.pos = (r.radius - 1) * r.l
+}
+
+func NewResampler(inRate, outRate, channels int) *Resampler {
+	g := gcd(inRate, outRate)
+	r := &Resampler{
+		inRate:  inRate,
+		outRate: outRate,
+		l:       outRate / g,
+		m:       inRate / g,
+		radius:  resampleHalfTaps,
+		tails:   make([][]float64, channels),
+		ext:     make([][]float64, channels),
+	}
+	if outRate < inRate {
+		// 降采样时截止频率降低，需要更宽的窗
+		r.radius = int(math.Ceil(float64(resampleHalfTaps) * float64(inRate) / float64(outRate)))
+	}
+	r.initPhases()
+	r.Reset()
+	return r
+}
@@ -0,0 +1,135 @@
+package dsp
+
+import (
+	"math"
+)
+
+// WindowType 频谱分析的窗函数
+type WindowType = uint8
+
+const (
+	HannWindow WindowType = iota
+	BlackmanHarrisWindow
+	FlatTopWindow
+)
+
+func IsWindowTypeValid(t WindowType) bool {
+	return t <= FlatTopWindow
+}
+
+// 余弦窗的系数
+var windowCoefs = [][]float64{
+	HannWindow:           {0.5, 0.5},
+	BlackmanHarrisWindow: {0.35875, 0.48829, 0.14128, 0.01168},
+	FlatTopWindow:        {0.21557895, 0.41663158, 0.277263158, 0.083578947, 0.006947368},
+}
+
+// Window 归一化的窗，相干增益为 1，正弦信号的幅值与窗无关
+type Window struct {
+	Type WindowType
+	Coef []float64
+	ENBW float64 // 等效噪声带宽，单位为频点
+}
+
+func NewWindow(t WindowType, n int) *Window {
+	if !IsWindowTypeValid(t) {
+		t = HannWindow
+	}
+	var (
+		w       = &Window{Type: t, Coef: make([]float64, n)}
+		a       = windowCoefs[t]
+		sum, sq float64
+	)
+	for i := 0; i < n; i++ {
+		v, sign := 0.0, 1.0
+		for k, c := range a {
+			// 周期窗，适合 FFT
+			v += sign * c * math.Cos(2*Pi*float64(k*i)/float64(n))
+			sign = -sign
+		}
+		w.Coef[i] = v / a[0]
+		sum += w.Coef[i]
+		sq += w.Coef[i] * w.Coef[i]
+	}
+	w.ENBW = float64(n) * sq / (sum * sum)
+	return w
+}
+
+// OctaveBand 分数倍频程的频带，以 1kHz 为基准
+type OctaveBand struct {
+	Low    float64
+	Center float64
+	High   float64
+}
+
+func IsOctaveFractionValid(f int) bool {
+	return f == 1 || f == 3 || f == 6
+}
+
+// OctaveBands 返回覆盖 20Hz 至 20kHz 的 1/fraction 倍频程频带，上边界不超过奈奎斯特频率
+func OctaveBands(fraction int, rate int) []OctaveBand {
+	if !IsOctaveFractionValid(fraction) || rate <= 0 {
+		return nil
+	}
+	var (
+		b     = float64(fraction)
+		half  = math.Pow(2, 1/(2*b))
+		maxFc = math.Min(20000*half, float64(rate)/2/half)
+		first = int(math.Ceil(b*math.Log2(20.0/1000) - 0.5))
+		last  = int(math.Floor(b * math.Log2(maxFc/1000)))
+		bands []OctaveBand
+	)
+	for k := first; k <= last; k++ {
+		fc := 1000 * math.Pow(2, float64(k)/b)
+		bands = append(bands, OctaveBand{Low: fc / half, Center: fc, High: fc * half})
+	}
+	return bands
+}
+
+// BandLevels 将单边幅值谱合并到频带，mag 为 FFT 频点的幅值，binHz 为频点间隔
+//
+// 频带内的能量求和后按窗的等效噪声带宽修正，频带内没有频点时取中心频率的插值
+func BandLevels(mag []float64, binHz, enbw float64, bands []OctaveBand, dst []float64) []float64 {
+	if cap(dst) < len(bands) {
+		dst = make([]float64, len(bands))
+	}
+	dst = dst[:len(bands)]
+	if len(mag) == 0 || binHz <= 0 {
+		for i := range dst {
+			dst[i] = 0
+		}
+		return dst
+	}
+	if enbw <= 0 {
+		enbw = 1
+	}
+
+	for i, b := range bands {
+		var (
+			lo  = int(math.Ceil(b.Low / binHz))
+			hi  = int(math.Ceil(b.High/binHz)) - 1
+			sum float64
+		)
+		if lo < 1 {
+			lo = 1
+		}
+		if hi >= len(mag) {
+			hi = len(mag) - 1
+		}
+		if lo > hi {
+			x := b.Center / binHz
+			j := int(x)
+			if j+1 >= len(mag) {
+				dst[i] = mag[len(mag)-1]
+				continue
+			}
+			dst[i] = mag[j] + (mag[j+1]-mag[j])*(x-float64(j))
+			continue
+		}
+		for j := lo; j <= hi; j++ {
+			sum += mag[j] * mag[j]
+		}
+		dst[i] = math.Sqrt(sum / enbw)
+	}
+	return dst
+}
@@ -0,0 +1,94 @@
+package dsp
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWindow(t *testing.T) {
+	const n = 4096
+	enbw := map[WindowType]float64{
+		HannWindow:           1.5,
+		BlackmanHarrisWindow: 2.0,
+		FlatTopWindow:        3.77,
+	}
+	for wt, want := range enbw {
+		w := NewWindow(wt, n)
+		assert.InDelta(t, want, w.ENBW, 0.01)
+
+		// 任意频率的正弦，幅值读数都接近 1，平顶窗的误差最小
+		for _, bin := range []float64{100, 100.25, 100.5} {
+			var (
+				p  = NewFFTPlan(n)
+				re = make([]float64, n)
+				im = make([]float64, n)
+			)
+			for i := range re {
+				re[i] = math.Sin(2*Pi*bin*float64(i)/n) * w.Coef[i]
+			}
+			p.Forward(re, im)
+			peak := 0.0
+			for i := 90; i < 110; i++ {
+				peak = math.Max(peak, math.Hypot(re[i], im[i])*2/n)
+			}
+			if wt == FlatTopWindow {
+				assert.InDelta(t, 1, peak, 0.002)
+			} else {
+				assert.InDelta(t, 1, peak, 0.16)
+			}
+		}
+	}
+}
+
+func TestOctaveBands(t *testing.T) {
+	bands := OctaveBands(3, 48000)
+	assert.Len(t, bands, 31)
+	assert.InDelta(t, 19.7, bands[0].Center, 0.1)
+	assert.InDelta(t, 1000, bands[17].Center, 1e-9)
+	assert.InDelta(t, 20159, bands[30].Center, 1)
+
+	// 频带首尾相接
+	for i := 1; i < len(bands); i++ {
+		assert.InDelta(t, bands[i-1].High, bands[i].Low, 1e-9)
+	}
+
+	assert.Len(t, OctaveBands(6, 48000), 61)
+	assert.Len(t, OctaveBands(1, 16000), 9)
+	assert.Nil(t, OctaveBands(2, 48000))
+}
+
+func TestBandLevels(t *testing.T) {
+	const (
+		n    = 8192
+		rate = 48000
+	)
+	for _, wt := range []WindowType{HannWindow, BlackmanHarrisWindow, FlatTopWindow} {
+		var (
+			w     = NewWindow(wt, n)
+			p     = NewFFTPlan(n)
+			re    = make([]float64, n)
+			im    = make([]float64, n)
+			mag   = make([]float64, n/2)
+			bands = OctaveBands(3, rate)
+		)
+		for i := range re {
+			re[i] = 0.5 * math.Sin(2*Pi*1000*float64(i)/rate) * w.Coef[i]
+		}
+		p.Forward(re, im)
+		for i := range mag {
+			mag[i] = math.Hypot(re[i], im[i]) * 2 / n
+		}
+
+		levels := BandLevels(mag, float64(rate)/n, w.ENBW, bands, nil)
+		for i, b := range bands {
+			if b.Center == 1000 {
+				// 正弦的能量全部落在 1kHz 频带内
+				assert.InDelta(t, 0.5, levels[i], 0.01)
+			} else if b.Center < 500 || b.Center > 2000 {
+				assert.Less(t, levels[i], 0.001)
+			}
+		}
+	}
+}
@@ -0,0 +1,372 @@
+package element
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/zwcway/castserver-go/common/audio"
+	"github.com/zwcway/castserver-go/common/bus"
+	"github.com/zwcway/castserver-go/common/config"
+	"github.com/zwcway/castserver-go/common/stream"
+)
+
+// 播报的数据只读，可以由多个播报元共享
+type announceClip struct {
+	stream.Announcement
+
+	pos        int
+	converting bool // 输出格式变化，正在转换
+}
+
+// 必须持有锁
+func (c *announceClip) finished() bool {
+	return c.pos >= c.Clip.LastNbSamples
+}
+
+// Announcer 播报元，位于音量元之后，播报的音量不受线路音量和静音的影响
+type Announcer struct {
+	power bool
+
+	queue   []*announceClip
+	current *announceClip
+	format  audio.Format // 最近处理的格式，播报在加入时转换至该格式
+	locker  sync.Mutex
+
+	attack  time.Duration
+	release time.Duration
+
+	gain float64 // 当前压低的增益
+}
+
+func (a *Announcer) Name() string {
+	return "Announcer"
+}
+
+func (a *Announcer) Type() stream.ElementType {
+	return stream.ET_WholeSamples
+}
+
+// 取出正在播放的播报，以及目标增益
+func (a *Announcer) next(format audio.Format) (*announceClip, float64) {
+	a.locker.Lock()
+	defer a.locker.Unlock()
+
+	a.format = format
+	if a.current != nil && a.current.finished() {
+		a.current = nil
+	}
+	if a.current == nil && len(a.queue) > 0 {
+		a.current = a.queue[0]
+		a.queue = a.queue[1:]
+	}
+
+	if a.current != nil {
+		return a.current, math.Pow(10, -a.current.Duck/20)
+	}
+	if len(a.queue) > 0 {
+		return nil, math.Pow(10, -a.queue[0].Duck/20)
+	}
+	return nil, 1
+}
+
+func (a *Announcer) Stream(samples *stream.Samples) {
+	if !a.power || !samples.IsFloat() {
+		return
+	}
+
+	cur, target := a.next(samples.Format)
+	if cur == nil && a.gain == target {
+		return
+	}
+
+	a.duck(samples, target)
+
+	if cur == nil {
+		return
+	}
+	clip, ok := a.prepare(cur, samples.Format)
+	if !ok {
+		return
+	}
+	request := samples.RequestNbSamples
+	if samples.LastNbSamples == 0 {
+		// 没有其它声音时，缓存中可能是旧的数据
+		samples.ResetData()
+		samples.RequestNbSamples = request
+	} else {
+		// 与其它声音的长度保持一致
+		samples.RequestNbSamples = samples.LastNbSamples
+	}
+
+	mixed := mixClip(samples, clip, cur.pos, cur.Volume)
+	samples.RequestNbSamples = request
+
+	a.locker.Lock()
+	cur.pos += mixed
+	if mixed == 0 {
+		cur.pos = clip.LastNbSamples
+	}
+	a.locker.Unlock()
+	if samples.LastNbSamples < mixed {
+		samples.LastNbSamples = mixed
+	}
+}
+
+// 按照时间常数逐个样本向目标增益过渡
+func (a *Announcer) duck(samples *stream.Samples, target float64) {
+	if samples.IsFloat32() {
+		duckPlanar(a, stream.Planar[float32](samples), samples, target)
+	} else {
+		duckPlanar(a, stream.Planar[float64](samples), samples, target)
+	}
+}
+
+func duckPlanar[T stream.Float](a *Announcer, data [][]T, samples *stream.Samples, target float64) {
+	var (
+		chs = int(samples.Format.Count)
+		tc  = a.release
+	)
+	if target < a.gain {
+		tc = a.attack
+	}
+	k := 1.0
+	if n := tc.Seconds() * float64(samples.Format.Rate.ToInt()); n > 1 {
+		k = 1 - math.Exp(-1/n)
+	}
+
+	for i := 0; i < samples.LastNbSamples; i++ {
+		if a.gain != target {
+			a.gain += (target - a.gain) * k
+			if math.Abs(target-a.gain) < 1e-4 {
+				a.gain = target
+			}
+		}
+		if a.gain == 1 {
+			continue
+		}
+		for ch := 0; ch < chs; ch++ {
+			data[ch][i] *= T(a.gain)
+		}
+	}
+	if samples.LastNbSamples == 0 {
+		a.gain = target
+	}
+}
+
+// 返回与输出格式一致的数据。
+// 格式在播报加入之后发生变化时，在其它协程中转换，完成之前跳过
+func (a *Announcer) prepare(c *announceClip, format audio.Format) (*stream.Samples, bool) {
+	a.locker.Lock()
+	defer a.locker.Unlock()
+
+	if c.Clip.Format == format {
+		return c.Clip, true
+	}
+	if !c.converting {
+		c.converting = true
+		go a.convert(c, c.Clip, format)
+	}
+	return nil, false
+}
+
+func (a *Announcer) convert(c *announceClip, clip *stream.Samples, format audio.Format) {
+	converted, err := ConvertClip(clip, format)
+
+	a.locker.Lock()
+	defer a.locker.Unlock()
+
+	c.converting = false
+	if err != nil {
+		// 无法转换，放弃该播报
+		c.pos = clip.LastNbSamples
+		return
+	}
+	if c.Clip != clip {
+		return
+	}
+	if clip.Format.Rate != format.Rate {
+		// 播放中途格式变化，按比例保持进度
+		c.pos = c.pos * format.Rate.ToInt() / clip.Format.Rate.ToInt()
+	}
+	c.Clip = converted
+}
+
+// ConvertClip 将播报转换为 format，格式相同时直接返回 clip，否则返回新的数据，不修改 clip
+func ConvertClip(clip *stream.Samples, format audio.Format) (*stream.Samples, error) {
+	if clip.Format == format {
+		return clip, nil
+	}
+
+	var resample stream.ResampleElement
+	stream.BusResample.GetInstance(nil, &resample, &format)
+	if resample == nil {
+		return nil, fmt.Errorf("no resampler for %s", format.String())
+	}
+	defer resample.Close()
+
+	converted := clip.Clone()
+	resample.On()
+	resample.SetFormat(format)
+	resample.Stream(converted)
+
+	if converted.LastErr != nil {
+		return nil, converted.LastErr
+	}
+	if converted.Format != format {
+		return nil, fmt.Errorf("convert clip to %s failed", format.String())
+	}
+	return converted, nil
+}
+
+// 按照音量叠加播报，相同声道之间混合，返回混合的样本数
+func mixClip(dst *stream.Samples, src *stream.Samples, srcOffset int, g float64) (mixed int) {
+	if !src.IsFloat() || !dst.IsFloat() {
+		return 0
+	}
+	for _, ch := range src.Format.Channels() {
+		if !ch.IsValid() {
+			continue
+		}
+		i, j := src.ChannelIndex[ch], dst.ChannelIndex[ch]
+		if i < 0 || j < 0 {
+			continue
+		}
+		var (
+			dn = dst.RequestNbSamples
+			sn = src.LastNbSamples
+		)
+		switch {
+		case dst.Data32 == nil && src.Data32 == nil:
+			mixed = mixScaled(dst.Data[j][:dn], src.Data[i][:sn], srcOffset, g)
+		case dst.Data32 != nil && src.Data32 != nil:
+			mixed = mixScaled(dst.Data32[j][:dn], src.Data32[i][:sn], srcOffset, g)
+		case dst.Data32 != nil:
+			mixed = mixScaled(dst.Data32[j][:dn], src.Data[i][:sn], srcOffset, g)
+		default:
+			mixed = mixScaled(dst.Data[j][:dn], src.Data32[i][:sn], srcOffset, g)
+		}
+	}
+	return
+}
+
+func mixScaled[D stream.Float, S stream.Float](dst []D, src []S, srcOffset int, g float64) int {
+	n := 0
+	for ; n < len(dst) && srcOffset+n < len(src); n++ {
+		dst[n] += D(float64(src[srcOffset+n]) * g)
+	}
+	return n
+}
+
+func (a *Announcer) Sample(*float64, int, int) {}
+
+func (a *Announcer) OnStarting() {}
+
+func (a *Announcer) OnEnding() {}
+
+func (a *Announcer) OnFormatChanged(newFormat *audio.Format) {}
+
+func (a *Announcer) On() {
+	a.power = true
+}
+
+func (a *Announcer) Off() {
+	a.power = false
+}
+
+func (a *Announcer) IsOn() bool {
+	return a.power
+}
+
+func (a *Announcer) Announce(an stream.Announcement) {
+	if an.Clip == nil || an.Clip.LastNbSamples == 0 {
+		return
+	}
+	if an.Volume < 0 {
+		an.Volume = 0
+	}
+	if an.Duck < 0 {
+		an.Duck = 0
+	}
+
+	// 在调用者的协程中转换，避免占用音频线程
+	a.locker.Lock()
+	format := a.format
+	a.locker.Unlock()
+	if format.IsValid() {
+		if clip, err := ConvertClip(an.Clip, format); err == nil {
+			an.Clip = clip
+		}
+	}
+
+	a.locker.Lock()
+	a.queue = append(a.queue, &announceClip{Announcement: an})
+	a.locker.Unlock()
+}
+
+func (a *Announcer) Format() audio.Format {
+	a.locker.Lock()
+	defer a.locker.Unlock()
+
+	return a.format
+}
+
+func (a *Announcer) SetDucking(attack time.Duration, release time.Duration) {
+	if attack >= 0 {
+		a.attack = attack
+	}
+	if release >= 0 {
+		a.release = release
+	}
+}
+
+func (a *Announcer) Ducking() (time.Duration, time.Duration) {
+	return a.attack, a.release
+}
+
+func (a *Announcer) IsAnnouncing() bool {
+	a.locker.Lock()
+	defer a.locker.Unlock()
+
+	return a.current != nil || len(a.queue) > 0
+}
+
+func (a *Announcer) Pending() int {
+	a.locker.Lock()
+	defer a.locker.Unlock()
+
+	return len(a.queue)
+}
+
+func (a *Announcer) Clear() {
+	a.locker.Lock()
+	defer a.locker.Unlock()
+
+	a.queue = a.queue[:0]
+	a.current = nil
+}
+
+func (a *Announcer) Close() error {
+	bus.UnregisterObj(a)
+
+	a.Clear()
+	a.Off()
+	return nil
+}
+
+func (o *Announcer) Dispatch(e string, a ...any) error {
+	return bus.DispatchObj(o, e, a...)
+}
+func (o *Announcer) Register(e string, c bus.Handler) *bus.HandlerData {
+	return bus.RegisterObj(o, e, c)
+}
+
+func NewAnnouncer() stream.AnnouncerElement {
+	return &Announcer{
+		power:   true,
+		gain:    1,
+		attack:  config.AnnounceAttack,
+		release: config.AnnounceRelease,
+	}
+}
@@ -0,0 +1,152 @@
+package element
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zwcway/castserver-go/common/audio"
+	"github.com/zwcway/castserver-go/common/stream"
+)
+
+func TestAnnouncer(t *testing.T) {
+	format := audio.Format{
+		Sample: audio.Sample{
+			Rate: audio.AudioRate_48000,
+			Bits: audio.Bits_DEFAULT,
+		},
+		Layout: audio.Layout20,
+	}
+	music := func(v float64) *stream.Samples {
+		s := stream.NewSamples(480, format)
+		for ch := range s.Data {
+			for i := range s.Data[ch] {
+				s.Data[ch][i] = v
+			}
+		}
+		s.LastNbSamples = 480
+		return s
+	}
+	clip := func(n int, v float64) *stream.Samples {
+		s := stream.NewSamples(n, format)
+		for ch := range s.Data {
+			for i := range s.Data[ch] {
+				s.Data[ch][i] = v
+			}
+		}
+		s.LastNbSamples = n
+		return s
+	}
+
+	t.Run("duck and release", func(t *testing.T) {
+		a := NewAnnouncer()
+		a.SetDucking(5*time.Millisecond, 20*time.Millisecond)
+		a.Announce(stream.Announcement{Clip: clip(4800, 0.1), Volume: 0.5, Duck: 20})
+		assert.True(t, a.IsAnnouncing())
+
+		// 压低音乐至 -20dB，叠加播报
+		var s *stream.Samples
+		for i := 0; i < 5; i++ {
+			s = music(0.5)
+			a.Stream(s)
+		}
+		assert.InDelta(t, 0.05+0.05, s.Data[0][479], 1e-3)
+
+		// 播报结束后恢复
+		for i := 0; i < 20; i++ {
+			s = music(0.5)
+			a.Stream(s)
+		}
+		assert.False(t, a.IsAnnouncing())
+		assert.InDelta(t, 0.5, s.Data[0][479], 1e-3)
+	})
+
+	t.Run("queue", func(t *testing.T) {
+		a := NewAnnouncer()
+		a.SetDucking(0, 0)
+		a.Announce(stream.Announcement{Clip: clip(480, 0.1), Volume: 1})
+		a.Announce(stream.Announcement{Clip: clip(480, 0.2), Volume: 1})
+		assert.Equal(t, 2, a.Pending())
+
+		// 依次播放，不会重叠
+		for _, want := range []float64{0.1, 0.2, 0} {
+			s := music(0)
+			a.Stream(s)
+			assert.Equal(t, want, s.Data[1][100])
+		}
+		assert.False(t, a.IsAnnouncing())
+	})
+
+	t.Run("no music", func(t *testing.T) {
+		a := NewAnnouncer()
+		a.Announce(stream.Announcement{Clip: clip(100, 0.3), Volume: 1})
+
+		s := music(0.9)
+		s.LastNbSamples = 0
+		a.Stream(s)
+		assert.Equal(t, 100, s.LastNbSamples)
+		assert.Equal(t, 0.3, s.Data[0][50])
+		assert.Zero(t, s.Data[0][200])
+	})
+
+	t.Run("convert", func(t *testing.T) {
+		stream.BusResample.Register(func(resample *stream.ResampleElement, f *audio.Format) error {
+			if f == nil {
+				*resample = NewResample(audio.InternalFormat())
+			} else {
+				*resample = NewResample(*f)
+			}
+			return nil
+		})
+		in := audio.Format{
+			Sample: audio.Sample{Rate: audio.AudioRate_44100, Bits: audio.Bits_DEFAULT},
+			Layout: audio.Layout20,
+		}
+		src := stream.NewSamples(4410, in)
+		for ch := range src.Data {
+			for i := range src.Data[ch] {
+				src.Data[ch][i] = 0.1
+			}
+		}
+		src.LastNbSamples = 4410
+
+		// 已知输出格式时在加入时转换，原始数据不变
+		a := NewAnnouncer()
+		a.Stream(music(0))
+		assert.Equal(t, format, a.Format())
+		a.Announce(stream.Announcement{Clip: src, Volume: 1})
+		assert.Equal(t, in, src.Format)
+		s := music(0)
+		a.Stream(s)
+		assert.InDelta(t, 0.1, s.Data[0][400], 1e-3)
+
+		// 加入时格式未知，在其它协程中转换，完成之前跳过
+		b := NewAnnouncer()
+		b.SetDucking(0, 0)
+		b.Announce(stream.Announcement{Clip: src, Volume: 1})
+		mixed := false
+		for i := 0; i < 100 && !mixed; i++ {
+			s = music(0)
+			b.Stream(s)
+			mixed = s.Data[0][400] != 0
+			time.Sleep(time.Millisecond)
+		}
+		assert.True(t, mixed)
+		assert.Equal(t, in, src.Format)
+	})
+
+	t.Run("clear", func(t *testing.T) {
+		a := NewAnnouncer()
+		a.SetDucking(0, 0)
+		a.Announce(stream.Announcement{Clip: clip(4800, 0.1), Volume: 1, Duck: 6})
+		s := music(0.5)
+		a.Stream(s)
+		assert.InDelta(t, 0.5*math.Pow(10, -6.0/20)+0.1, s.Data[0][10], 1e-9)
+
+		a.Clear()
+		s = music(0.5)
+		a.Stream(s)
+		assert.Equal(t, 0.5, s.Data[0][10])
+	})
+}
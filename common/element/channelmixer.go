@@ -0,0 +1,269 @@
+package element
+
+import (
+	"sync"
+	"time"
+
+	"github.com/zwcway/castserver-go/common/audio"
+	"github.com/zwcway/castserver-go/common/bus"
+	"github.com/zwcway/castserver-go/common/dsp"
+	"github.com/zwcway/castserver-go/common/stream"
+)
+
+const (
+	upmixLFECutoff   = 120  // 扩展出的低音声道截止频率 Hz
+	ambienceCutoff   = 7000 // 环境声截止频率 Hz
+	ambienceDelay    = 15 * time.Millisecond
+	channelMixerQ    = 0.7071
+	channelMixerSize = 2048
+)
+
+// 扩展声道的后处理
+type channelPost struct {
+	filter *dsp.Filter
+	delay  []float64
+	pos    int
+}
+
+func (p *channelPost) process(v float64) float64 {
+	if len(p.delay) > 0 {
+		p.delay[p.pos], v = v, p.delay[p.pos]
+		p.pos++
+		if p.pos >= len(p.delay) {
+			p.pos = 0
+		}
+	}
+	if p.filter != nil {
+		v = p.filter.Process(v)
+	}
+	return v
+}
+
+// 声道混音，按照增益矩阵将输入转换至线路的声道布局
+type ChannelMixer struct {
+	power  bool
+	layout audio.Layout
+	upmix  dsp.UpmixMode
+	routes []audio.ChannelRoute
+
+	in      audio.Layout
+	rate    audio.Rate
+	matrix  *dsp.ChannelMatrix
+	post    []*channelPost
+	inIdx   []int8
+	buf     *stream.Samples
+	changed bool
+
+	locker sync.Mutex
+}
+
+func (c *ChannelMixer) Name() string {
+	return "Channel Mixer"
+}
+
+func (c *ChannelMixer) Type() stream.ElementType {
+	return stream.ET_WholeSamples
+}
+
+func (c *ChannelMixer) Stream(samples *stream.Samples) {
+	if !c.power || samples == nil || samples.LastNbSamples == 0 || !c.layout.IsValid() {
+		return
+	}
+
+	c.locker.Lock()
+	defer c.locker.Unlock()
+
+	if c.changed || c.matrix == nil || c.in != samples.Format.Layout || c.rate != samples.Format.Rate {
+		c.init(samples.Format)
+	}
+	if c.matrix.IsIdentity() {
+		return
+	}
+
+	if samples.IsFloat32() {
+		channelMix[float32](c, samples)
+	} else {
+		channelMix[float64](c, samples)
+	}
+}
+
+func channelMix[T stream.Float](c *ChannelMixer, samples *stream.Samples) {
+	var (
+		n      = samples.LastNbSamples
+		in     = samples.Format
+		out    = samples.Format
+		inIdx  = c.inIdx
+		i, o   int
+		v      float64
+		row    []float64
+		outBuf []T
+	)
+
+	// 复制输入，输出覆盖原有数据
+	c.buf.Reformat(n, in)
+	var (
+		src = stream.Planar[T](samples)
+		buf = stream.Planar[T](c.buf)
+	)
+	for k, ch := range c.matrix.In {
+		inIdx[k] = c.buf.ChannelIndex[ch]
+		if si := samples.ChannelIndex[ch]; si >= 0 {
+			copy(buf[inIdx[k]][:n], src[si][:n])
+		}
+	}
+
+	out.Layout = c.layout
+	samples.Reformat(samples.RequestNbSamples, out)
+	dst := stream.Planar[T](samples)
+
+	for o = 0; o < len(c.matrix.Out); o++ {
+		row = c.matrix.Gains[o]
+		outBuf = dst[samples.ChannelIndex[c.matrix.Out[o]]][:n]
+		for j := range outBuf {
+			v = 0
+			for i = 0; i < len(row); i++ {
+				if row[i] != 0 {
+					v += row[i] * float64(buf[inIdx[i]][j])
+				}
+			}
+			outBuf[j] = T(v)
+		}
+		if p := c.post[o]; p != nil {
+			for j := range outBuf {
+				outBuf[j] = T(p.process(float64(outBuf[j])))
+			}
+		}
+	}
+
+	samples.LastNbSamples = n
+}
+
+// 根据输入格式重新生成矩阵
+func (c *ChannelMixer) init(format audio.Format) {
+	c.in = format.Layout
+	c.rate = format.Rate
+	c.changed = false
+	c.matrix = dsp.NewChannelMatrix(c.in, c.layout, c.upmix, c.routes)
+	c.post = make([]*channelPost, len(c.matrix.Out))
+	c.inIdx = make([]int8, len(c.matrix.In))
+
+	if c.buf == nil {
+		c.buf = stream.NewSamples(channelMixerSize, format)
+	}
+
+	rate := format.Rate.ToInt()
+	for o, ch := range c.matrix.Out {
+		if !c.matrix.Upmixed.Isset(ch) {
+			continue
+		}
+		switch ch {
+		case audio.Channel_LOW_FREQUENCY:
+			c.post[o] = &channelPost{
+				filter: dsp.NewFilter(dsp.FilterParams{Frequency: upmixLFECutoff, Q: channelMixerQ, Type: dsp.LowPassFilter}, rate),
+			}
+		case audio.Channel_SIDE_LEFT, audio.Channel_SIDE_RIGHT, audio.Channel_BACK_LEFT, audio.Channel_BACK_RIGHT:
+			if c.upmix != dsp.AmbienceUpmix {
+				continue
+			}
+			// 延迟使环绕声不影响前方的声像定位，低通去除高频的直达声
+			c.post[o] = &channelPost{
+				filter: dsp.NewFilter(dsp.FilterParams{Frequency: ambienceCutoff, Q: channelMixerQ, Type: dsp.LowPassFilter}, rate),
+				delay:  make([]float64, int(ambienceDelay*time.Duration(rate)/time.Second)),
+			}
+		}
+	}
+}
+
+func (c *ChannelMixer) Sample(*float64, int, int) {}
+
+func (c *ChannelMixer) OnStarting() {}
+
+func (c *ChannelMixer) OnEnding() {}
+
+func (c *ChannelMixer) OnFormatChanged(newFormat *audio.Format) {
+}
+
+func (c *ChannelMixer) On() {
+	c.power = true
+}
+
+func (c *ChannelMixer) Off() {
+	c.power = false
+}
+
+func (c *ChannelMixer) IsOn() bool {
+	return c.power
+}
+
+func (c *ChannelMixer) SetRoute(r []audio.ChannelRoute) {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+
+	c.routes = r
+	c.changed = true
+}
+
+func (c *ChannelMixer) Route() []audio.ChannelRoute {
+	return c.routes
+}
+
+func (c *ChannelMixer) SetLayout(l audio.Layout) {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+
+	c.layout = l
+	c.changed = true
+}
+
+func (c *ChannelMixer) Layout() audio.Layout {
+	return c.layout
+}
+
+func (c *ChannelMixer) SetUpmix(m dsp.UpmixMode) {
+	if !dsp.IsUpmixModeValid(m) {
+		return
+	}
+	c.locker.Lock()
+	defer c.locker.Unlock()
+
+	c.upmix = m
+	c.changed = true
+}
+
+func (c *ChannelMixer) Upmix() dsp.UpmixMode {
+	return c.upmix
+}
+
+func (c *ChannelMixer) Matrix() *dsp.ChannelMatrix {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+
+	return c.matrix
+}
+
+func (c *ChannelMixer) Close() error {
+	bus.UnregisterObj(c)
+
+	c.Off()
+	c.matrix = nil
+	return nil
+}
+
+func (o *ChannelMixer) Dispatch(e string, a ...any) error {
+	return bus.DispatchObj(o, e, a...)
+}
+func (o *ChannelMixer) Register(e string, c bus.Handler) *bus.HandlerData {
+	return bus.RegisterObj(o, e, c)
+}
+
+func NewChannelMixer(layout audio.Layout, upmix dsp.UpmixMode) stream.ChannelMixerElement {
+	c := &ChannelMixer{
+		power:  true,
+		layout: layout,
+		upmix:  upmix,
+	}
+	if !dsp.IsUpmixModeValid(upmix) {
+		c.upmix = dsp.MatrixUpmix
+	}
+	return c
+}
@@ -0,0 +1,79 @@
+package element
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zwcway/castserver-go/common/audio"
+	"github.com/zwcway/castserver-go/common/dsp"
+	"github.com/zwcway/castserver-go/common/stream"
+)
+
+func TestChannelMixer(t *testing.T) {
+	format := audio.Format{
+		Sample: audio.Sample{
+			Rate: audio.AudioRate_44100,
+			Bits: audio.Bits_DEFAULT,
+		},
+		Layout: audio.Layout20,
+	}
+	stereo := func(l, r float64) *stream.Samples {
+		s := stream.NewSamples(64, format)
+		for i := 0; i < s.RequestNbSamples; i++ {
+			s.Data[s.ChannelIndex[audio.Channel_FRONT_LEFT]][i] = l
+			s.Data[s.ChannelIndex[audio.Channel_FRONT_RIGHT]][i] = r
+		}
+		s.LastNbSamples = s.RequestNbSamples
+		return s
+	}
+	channel := func(s *stream.Samples, ch audio.Channel) []float64 {
+		return s.Data[s.ChannelIndex[ch]][:s.LastNbSamples]
+	}
+
+	t.Run("passthrough", func(t *testing.T) {
+		c := NewChannelMixer(audio.Layout20, dsp.MatrixUpmix)
+		samples := stereo(0.25, 0.5)
+		c.Stream(samples)
+
+		assert.Equal(t, audio.Layout20, samples.Format.Layout)
+		assert.Equal(t, 0.25, channel(samples, audio.Channel_FRONT_LEFT)[10])
+		assert.Equal(t, 0.5, channel(samples, audio.Channel_FRONT_RIGHT)[10])
+	})
+
+	t.Run("upmix", func(t *testing.T) {
+		c := NewChannelMixer(audio.Layout51, dsp.MatrixUpmix)
+		samples := stereo(0.5, 0.5)
+		c.Stream(samples)
+
+		assert.Equal(t, audio.Layout51, samples.Format.Layout)
+		assert.Equal(t, 64, samples.LastNbSamples)
+		assert.Equal(t, 0.5, channel(samples, audio.Channel_FRONT_LEFT)[10])
+		assert.Greater(t, channel(samples, audio.Channel_FRONT_CENTER)[10], 0.0)
+		// 居中的信号不进入环绕声道
+		assert.Zero(t, channel(samples, audio.Channel_SIDE_LEFT)[10])
+		assert.Zero(t, channel(samples, audio.Channel_SIDE_RIGHT)[10])
+	})
+
+	t.Run("downmix", func(t *testing.T) {
+		c := NewChannelMixer(audio.Layout10, dsp.MatrixUpmix)
+		samples := stereo(0.5, -0.5)
+		c.Stream(samples)
+
+		assert.Equal(t, audio.Layout10, samples.Format.Layout)
+		assert.Zero(t, channel(samples, audio.Channel_FRONT_CENTER)[10])
+	})
+
+	t.Run("route", func(t *testing.T) {
+		c := NewChannelMixer(audio.Layout20, dsp.MatrixUpmix)
+		c.SetRoute([]audio.ChannelRoute{{
+			From:  []audio.Channel{audio.Channel_FRONT_LEFT},
+			To:    audio.Channel_FRONT_RIGHT,
+			Gains: []float64{0.5},
+		}})
+		samples := stereo(1, 0.25)
+		c.Stream(samples)
+
+		assert.Equal(t, 1.0, channel(samples, audio.Channel_FRONT_LEFT)[10])
+		assert.Equal(t, 0.5, channel(samples, audio.Channel_FRONT_RIGHT)[10])
+	})
+}
@@ -0,0 +1,255 @@
+package element
+
+import (
+	"sync"
+	"time"
+
+	"github.com/zwcway/castserver-go/common/audio"
+	"github.com/zwcway/castserver-go/common/bus"
+	"github.com/zwcway/castserver-go/common/dsp"
+	"github.com/zwcway/castserver-go/common/stream"
+)
+
+// ConvolverBlockSize 默认分段长度，44100hz 下约 23ms 延迟
+const ConvolverBlockSize = 1024
+
+// 长 FIR 滤波器，用于房间校正、箱体模拟等
+type Convolver struct {
+	power  bool
+	format audio.Format
+	block  int
+
+	all *dsp.ImpulseResponse                    // 作用于所有声道
+	irs [audio.Channel_MAX]*dsp.ImpulseResponse // 单独设置的声道，优先于 all
+
+	convs    []*dsp.Convolver // 按声道索引，只在音频线程中使用
+	newConvs []*dsp.Convolver // 已经准备好，等待音频线程替换
+	changed  bool
+	gen      int           // 每次修改递增，丢弃过期的准备结果
+	latency  time.Duration // 当前生效的延迟
+	tmp      []float64     // float32 格式时转换的缓存
+
+	locker sync.Mutex
+}
+
+func (c *Convolver) Name() string {
+	return "Convolver"
+}
+
+func (c *Convolver) Type() stream.ElementType {
+	return stream.ET_WholeSamples
+}
+
+func (c *Convolver) Stream(samples *stream.Samples) {
+	if !c.power || samples == nil || samples.LastNbSamples == 0 {
+		return
+	}
+	c.locker.Lock()
+	if samples.Format.Rate != c.format.Rate || samples.Format.Layout != c.format.Layout {
+		// 格式变更后需要重新转换冲激响应的采样率，在后台准备，完成前沿用旧的
+		c.format = samples.Format
+		c.gen++
+		go c.prepare()
+	}
+	convs := c.convs
+	c.locker.Unlock()
+
+	for ch := 0; ch < int(samples.Format.Layout.Count) && ch < len(convs); ch++ {
+		if convs[ch] == nil {
+			continue
+		}
+		c.tmp = samples.Float64(ch, samples.LastNbSamples, c.tmp)
+		convs[ch].Process(c.tmp)
+		samples.SetFloat64(ch, c.tmp)
+	}
+}
+
+func (c *Convolver) Sample(*float64, int, int) {}
+
+func (c *Convolver) OnStarting() {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+
+	if !c.changed {
+		return
+	}
+	c.convs = c.newConvs
+	c.newConvs = nil
+	c.changed = false
+	c.latency = 0
+	for _, cv := range c.convs {
+		if cv != nil && c.format.Rate.IsValid() {
+			c.latency = time.Duration(cv.Latency()) * time.Second / time.Duration(c.format.Rate.ToInt())
+			break
+		}
+	}
+}
+
+func (c *Convolver) OnEnding() {
+}
+
+func (c *Convolver) OnFormatChanged(newFormat *audio.Format) {
+}
+
+func (c *Convolver) On() {
+	c.power = true
+}
+
+func (c *Convolver) Off() {
+	c.power = false
+}
+
+func (c *Convolver) IsOn() bool {
+	return c.power
+}
+
+func (c *Convolver) SetImpulseResponse(ch audio.Channel, ir *dsp.ImpulseResponse) {
+	if ir != nil && ir.Channels() == 0 {
+		ir = nil
+	}
+
+	c.locker.Lock()
+	if ch.IsValid() {
+		c.irs[ch] = ir
+	} else {
+		c.all = ir
+	}
+	c.gen++
+	c.locker.Unlock()
+
+	c.prepare()
+}
+
+func (c *Convolver) ImpulseResponse(ch audio.Channel) *dsp.ImpulseResponse {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+
+	if ch.IsValid() && c.irs[ch] != nil {
+		return c.irs[ch]
+	}
+	return c.all
+}
+
+func (c *Convolver) LoadFile(ch audio.Channel, file string) error {
+	ir, err := dsp.LoadImpulseResponse(file)
+	if err != nil {
+		return err
+	}
+	c.SetImpulseResponse(ch, ir)
+	return nil
+}
+
+func (c *Convolver) Clear(ch audio.Channel) {
+	c.SetImpulseResponse(ch, nil)
+}
+
+func (c *Convolver) SetBlockSize(size int) {
+	c.locker.Lock()
+	if size <= 0 || size == c.block {
+		c.locker.Unlock()
+		return
+	}
+	c.block = size
+	c.gen++
+	c.locker.Unlock()
+
+	c.prepare()
+}
+
+func (c *Convolver) BlockSize() int {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+
+	return c.block
+}
+
+// Latency 只有开启且存在冲激响应时才有延迟
+func (c *Convolver) Latency() time.Duration {
+	if !c.power {
+		return 0
+	}
+	c.locker.Lock()
+	defer c.locker.Unlock()
+
+	return c.latency
+}
+
+// prepare 在调用者的协程中重新生成卷积器，由音频线程在 OnStarting 中替换
+func (c *Convolver) prepare() {
+	c.locker.Lock()
+	var (
+		gen    = c.gen
+		format = c.format
+		block  = c.block
+		all    = c.all
+		irs    = c.irs
+	)
+	c.locker.Unlock()
+
+	if !format.IsValid() {
+		return
+	}
+	convs := buildConvolvers(format, block, all, &irs)
+
+	c.locker.Lock()
+	defer c.locker.Unlock()
+
+	if gen != c.gen {
+		// 准备期间又被修改，以最新的为准
+		return
+	}
+	c.newConvs = convs
+	c.changed = true
+}
+
+func buildConvolvers(format audio.Format, block int, all *dsp.ImpulseResponse, irs *[audio.Channel_MAX]*dsp.ImpulseResponse) []*dsp.Convolver {
+	var (
+		chs   = format.Channels()
+		convs = make([]*dsp.Convolver, len(chs))
+		rate  = format.Rate.ToInt()
+	)
+
+	if all != nil {
+		all = all.Resample(rate)
+	}
+
+	for i, ch := range chs {
+		var data []float64
+		if ir := irs[ch]; ir != nil {
+			data = ir.Resample(rate).Data[0]
+		} else if all != nil {
+			// 声道数量不足时循环使用
+			data = all.Data[i%all.Channels()]
+		}
+		convs[i] = dsp.NewConvolver(data, block)
+	}
+
+	return convs
+}
+
+func (c *Convolver) Close() error {
+	bus.UnregisterObj(c)
+
+	c.Off()
+	c.locker.Lock()
+	c.gen++
+	c.convs = nil
+	c.newConvs = nil
+	c.changed = false
+	c.latency = 0
+	c.locker.Unlock()
+	return nil
+}
+
+func (o *Convolver) Dispatch(e string, a ...any) error {
+	return bus.DispatchObj(o, e, a...)
+}
+func (o *Convolver) Register(e string, c bus.Handler) *bus.HandlerData {
+	return bus.RegisterObj(o, e, c)
+}
+
+func NewConvolver() stream.ConvolverElement {
+	return &Convolver{
+		block: ConvolverBlockSize,
+	}
+}
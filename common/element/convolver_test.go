@@ -0,0 +1,69 @@
+package element
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zwcway/castserver-go/common/audio"
+	"github.com/zwcway/castserver-go/common/dsp"
+	"github.com/zwcway/castserver-go/common/stream"
+)
+
+func TestConvolver_Prepare(t *testing.T) {
+	format := audio.Format{
+		Sample: audio.Sample{
+			Rate: audio.AudioRate_44100,
+			Bits: audio.Bits_DEFAULT,
+		},
+		Layout: audio.Layout10,
+	}
+	fill := func(s *stream.Samples) {
+		for i := range s.Data[0] {
+			s.Data[0][i] = 1
+		}
+		s.LastNbSamples = s.RequestNbSamples
+	}
+	ready := func(c *Convolver) bool {
+		c.locker.Lock()
+		defer c.locker.Unlock()
+		return c.changed
+	}
+
+	c := NewConvolver().(*Convolver)
+	c.SetBlockSize(64)
+	c.On()
+	// 延迟 1 个样本，增益 0.5
+	c.SetImpulseResponse(audio.Channel_NONE, &dsp.ImpulseResponse{Rate: 44100, Data: [][]float64{{0, 0.5}}})
+	assert.Equal(t, time.Duration(0), c.Latency())
+
+	// 格式未知时不处理，在后台准备
+	samples := stream.NewSamples(256, format)
+	fill(samples)
+	c.OnStarting()
+	c.Stream(samples)
+	assert.Equal(t, 1.0, samples.Data[0][100])
+
+	for i := 0; i < 1000 && !ready(c); i++ {
+		time.Sleep(time.Millisecond)
+	}
+	assert.True(t, ready(c))
+
+	// 在下一次处理前替换
+	fill(samples)
+	c.OnStarting()
+	c.Stream(samples)
+	assert.Equal(t, 64*time.Second/44100, c.Latency())
+	assert.InDelta(t, 0.0, samples.Data[0][64], 1e-9)
+	assert.InDelta(t, 0.5, samples.Data[0][65], 1e-9)
+	assert.InDelta(t, 0.5, samples.Data[0][255], 1e-9)
+
+	// 修改后在调用者的协程中准备完成
+	c.Clear(audio.Channel_NONE)
+	assert.True(t, ready(c))
+	c.OnStarting()
+	assert.Equal(t, time.Duration(0), c.Latency())
+
+	c.Off()
+	assert.Equal(t, time.Duration(0), c.Latency())
+}
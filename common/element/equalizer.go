@@ -1,6 +1,7 @@
 package element
 
 import (
+	"sync"
 	"time"
 
 	"github.com/zwcway/castserver-go/common/audio"
@@ -14,9 +15,11 @@ type Equalizer struct {
 	format    audio.Format
 	equalizer *dsp.EqualizerProcessor
 
-	filters [][]*dsp.Filter
+	filters   [][]*dsp.Filter // 按声道索引，只在音频线程中使用
+	newFilter [][]*dsp.Filter // 已经准备好，等待音频线程替换
+	changed   bool
 
-	newFilter [][]*dsp.Filter
+	locker sync.Mutex
 }
 
 func (e *Equalizer) Name() string {
@@ -31,10 +34,31 @@ func (e *Equalizer) Stream(samples *stream.Samples) {
 	if !e.power || samples == nil || samples.LastNbSamples == 0 {
 		return
 	}
-	for ch := 0; ch < int(samples.Format.Layout.Count); ch++ {
-		for _, f := range e.filters[ch] {
-			for i := 0; i < samples.LastNbSamples; i++ {
-				samples.Data[ch][i] = f.Process(samples.Data[ch][i])
+	e.locker.Lock()
+	if samples.Format.Rate != e.format.Rate || samples.Format.Layout.Count != e.format.Layout.Count {
+		// 滤波器系数与采样率相关，等待替换的滤波器按旧格式生成，一并丢弃
+		e.format = samples.Format
+		e.filters = e.build()
+		e.newFilter = nil
+		e.changed = false
+	}
+	filters := e.filters
+	e.locker.Unlock()
+
+	if samples.IsFloat32() {
+		equalize(filters, stream.Planar[float32](samples), samples)
+	} else {
+		equalize(filters, stream.Planar[float64](samples), samples)
+	}
+}
+
+// 滤波器的状态总是使用 float64，避免低频滤波器在 float32 下失真
+func equalize[T stream.Float](filters [][]*dsp.Filter, data [][]T, samples *stream.Samples) {
+	for ch := 0; ch < int(samples.Format.Layout.Count) && ch < len(filters); ch++ {
+		d := data[ch][:samples.LastNbSamples]
+		for _, f := range filters[ch] {
+			for i := range d {
+				d[i] = T(f.Process(float64(d[i])))
 			}
 		}
 	}
@@ -44,10 +68,15 @@ func (e *Equalizer) Sample(sample *float64, ch int, n int) {
 }
 
 func (e *Equalizer) OnStarting() {
-	if e.newFilter == nil {
+	e.locker.Lock()
+	defer e.locker.Unlock()
+
+	if !e.changed {
 		return
 	}
 	e.filters = e.newFilter
+	e.newFilter = nil
+	e.changed = false
 }
 
 func (e *Equalizer) OnEnding() {
@@ -69,44 +98,73 @@ func (r *Equalizer) IsOn() bool {
 }
 
 func (e *Equalizer) SetFilterType(t dsp.FilterType) {
+	e.locker.Lock()
+	defer e.locker.Unlock()
+
 	e.equalizer.Type = t
 }
 func (e *Equalizer) FilterType() dsp.FilterType {
+	e.locker.Lock()
+	defer e.locker.Unlock()
+
 	return e.equalizer.Type
 }
 
 func (e *Equalizer) SetEqualizer(eq []*dsp.FilterParams) {
+	e.locker.Lock()
+	defer e.locker.Unlock()
+
 	e.equalizer.Filters = eq
-	e.init(&e.newFilter)
+	e.prepare()
 }
 
 func (e *Equalizer) Equalizer() []*dsp.FilterParams {
+	e.locker.Lock()
+	defer e.locker.Unlock()
+
 	return e.equalizer.Filters
 }
 
 func (e *Equalizer) Count() int {
+	e.locker.Lock()
+	defer e.locker.Unlock()
+
 	return len(e.equalizer.Filters)
 }
 
 func (e *Equalizer) Set(freq int, gain, q float64) {
-	e.equalizer.Set(freq, gain, q)
+	e.locker.Lock()
+	defer e.locker.Unlock()
 
-	e.init(&e.newFilter)
-	return
+	e.equalizer.Set(freq, gain, q)
+	e.prepare()
 }
 
 func (e *Equalizer) Delay() time.Duration {
+	e.locker.Lock()
+	defer e.locker.Unlock()
+
 	return e.equalizer.Delay
 }
 
 func (e *Equalizer) SetDelay(delay time.Duration) {
+	e.locker.Lock()
+	defer e.locker.Unlock()
+
 	e.equalizer.Delay = delay
 }
 
-func (e *Equalizer) init(filter *[][]*dsp.Filter) {
-	*filter = make([][]*dsp.Filter, e.format.Layout.Count)
+// prepare 按当前格式生成滤波器，由音频线程在 OnStarting 中替换。调用时需持有锁
+func (e *Equalizer) prepare() {
+	e.newFilter = e.build()
+	e.changed = true
+}
+
+// build 按当前格式和参数生成各声道的滤波器。调用时需持有锁
+func (e *Equalizer) build() [][]*dsp.Filter {
 	chCount := int(e.format.Layout.Count)
 	rate := e.format.Rate.ToInt()
+	filters := make([][]*dsp.Filter, chCount)
 
 	for ch := 0; ch < chCount; ch++ {
 		fch := make([]*dsp.Filter, 0)
@@ -115,20 +173,26 @@ func (e *Equalizer) init(filter *[][]*dsp.Filter) {
 			if f == nil {
 				continue
 			}
-			fch = append(fch, dsp.NewFilter(*f, rate))
+			p := *f
+			p.Type = e.equalizer.FilterType(f)
+			fch = append(fch, dsp.NewFilter(p, rate))
 		}
 
-		(*filter)[ch] = fch
+		filters[ch] = fch
 	}
+	return filters
 }
 
 func (e *Equalizer) Close() error {
 	bus.UnregisterObj(e)
 
 	e.Off()
-	if e.filters != nil {
-		e.filters = e.filters[:0]
-	}
+	e.locker.Lock()
+	e.format = audio.Format{}
+	e.filters = nil
+	e.newFilter = nil
+	e.changed = false
+	e.locker.Unlock()
 	return nil
 }
 
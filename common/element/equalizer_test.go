@@ -0,0 +1,69 @@
+package element
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zwcway/castserver-go/common/audio"
+	"github.com/zwcway/castserver-go/common/dsp"
+	"github.com/zwcway/castserver-go/common/stream"
+)
+
+func TestEqualizer(t *testing.T) {
+	block := func(layout audio.Layout) *stream.Samples {
+		s := stream.NewSamples(480, audio.Format{
+			Sample: audio.Sample{Rate: audio.AudioRate_48000, Bits: audio.Bits_64LEF},
+			Layout: layout,
+		})
+		for ch := range s.Data {
+			for i := range s.Data[ch] {
+				s.Data[ch][i] = 0.5
+			}
+		}
+		s.LastNbSamples = 480
+		return s
+	}
+
+	t.Run("format changed with pending filters", func(t *testing.T) {
+		e := NewEqualizer(dsp.NewPeakingFilterEqualizerProcessor(2)).(*Equalizer)
+		e.On()
+		defer e.Close()
+
+		e.Stream(block(audio.Layout20))
+		// 按双声道生成，尚未替换
+		e.Set(1000, 6, 1)
+
+		e.Stream(block(audio.Layout51))
+		e.OnStarting()
+		assert.NotPanics(t, func() { e.Stream(block(audio.Layout51)) })
+		assert.Len(t, e.filters, 6)
+		assert.Len(t, e.filters[0], 1)
+	})
+
+	t.Run("concurrent set", func(t *testing.T) {
+		e := NewEqualizer(dsp.NewPeakingFilterEqualizerProcessor(4)).(*Equalizer)
+		e.On()
+		defer e.Close()
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				e.Set(100+i, 3, 1)
+				e.SetDelay(0)
+			}
+		}()
+		for i := 0; i < 100; i++ {
+			layout := audio.Layout20
+			if i%10 == 0 {
+				layout = audio.Layout10
+			}
+			e.OnStarting()
+			e.Stream(block(layout))
+		}
+		wg.Wait()
+		assert.Equal(t, 4, e.Count())
+	})
+}
@@ -0,0 +1,280 @@
+package element
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/zwcway/castserver-go/common/audio"
+	"github.com/zwcway/castserver-go/common/bus"
+	"github.com/zwcway/castserver-go/common/stream"
+	"golang.org/x/exp/slices"
+)
+
+// 主线路保留的样本，按照请求的块数计算
+const linkRingBlocks = 4
+
+// 保护所有线路之间的跟随关系，检查和修改需要在同一次加锁内完成
+var linkLocker sync.Mutex
+
+// Link 联动元，位于混音器之后
+//
+// 主线路将混音后的样本写入环形缓存，跟随的线路按照各自的读取位置取出，
+// 替换自身的输入，之后的均衡器、音量和声道路由仍然使用跟随线路的设置
+type Link struct {
+	power bool
+
+	locker    sync.Mutex
+	leader    *Link
+	followers []*Link
+
+	// 主线路，按字节保存，与内部位宽无关
+	ring   [][]byte
+	format audio.Format
+	chIdx  audio.ChannelIndex
+	pos    int64 // 已写入的样本数
+	valid  int64 // 环形缓存中最早的有效位置
+
+	// 跟随的线路
+	cursor int64 // 下一次读取的位置
+	synced bool
+}
+
+func (l *Link) Name() string {
+	return "Link"
+}
+
+func (l *Link) Type() stream.ElementType {
+	return stream.ET_WholeSamples
+}
+
+func (l *Link) Stream(samples *stream.Samples) {
+	if !l.power {
+		return
+	}
+
+	l.locker.Lock()
+	leader := l.leader
+	lead := len(l.followers) > 0
+	l.locker.Unlock()
+
+	if leader != nil {
+		leader.read(samples, l)
+	} else if lead {
+		l.write(samples)
+	}
+}
+
+// 主线路写入样本
+func (l *Link) write(samples *stream.Samples) {
+	n := samples.LastNbSamples
+	if n == 0 {
+		return
+	}
+
+	l.locker.Lock()
+	defer l.locker.Unlock()
+
+	var (
+		chs  = int(samples.Format.Count)
+		bits = samples.Format.Bits.Size()
+		size = linkRingBlocks * n
+	)
+	if samples.RequestNbSamples > n {
+		size = linkRingBlocks * samples.RequestNbSamples
+	}
+	if l.format != samples.Format || len(l.ring) != chs || len(l.ring[0]) < size*bits {
+		l.ring = make([][]byte, chs)
+		for ch := range l.ring {
+			l.ring[ch] = make([]byte, size*bits)
+		}
+		l.format = samples.Format
+		l.valid = l.pos
+	}
+	l.chIdx = append(l.chIdx[:0], samples.ChannelIndex...)
+
+	size = len(l.ring[0]) / bits
+	for ch := 0; ch < chs; ch++ {
+		p := int(l.pos%int64(size)) * bits
+		c := copy(l.ring[ch][p:], samples.RawData[ch][:n*bits])
+		copy(l.ring[ch], samples.RawData[ch][c:n*bits])
+	}
+	l.pos += int64(n)
+	if l.pos-l.valid > int64(size) {
+		l.valid = l.pos - int64(size)
+	}
+}
+
+// 跟随的线路从主线路读取样本
+func (l *Link) read(samples *stream.Samples, f *Link) {
+	l.locker.Lock()
+	defer l.locker.Unlock()
+
+	request := samples.RequestNbSamples
+	if !l.format.IsValid() {
+		// 主线路还没有输出
+		samples.LastNbSamples = 0
+		return
+	}
+	samples.Reformat(request, l.format)
+	samples.ResetData()
+	samples.RequestNbSamples = request
+	if !slices.Equal(samples.ChannelIndex, l.chIdx) {
+		samples.SetChannelIndex(append(audio.ChannelIndex{}, l.chIdx...))
+	}
+
+	// 首次读取或者落后过多时，对齐至主线路最近的一块
+	if !f.synced || f.cursor < l.valid || l.pos-f.cursor > 2*int64(request) {
+		f.cursor = l.pos - int64(request)
+		if f.cursor < l.valid {
+			f.cursor = l.valid
+		}
+		f.synced = true
+	}
+
+	n := int(l.pos - f.cursor)
+	if n > request {
+		n = request
+	}
+	if n <= 0 {
+		return
+	}
+	var (
+		bits = l.format.Bits.Size()
+		size = len(l.ring[0]) / bits
+	)
+	for ch := range l.ring {
+		p := int(f.cursor%int64(size)) * bits
+		c := copy(samples.RawData[ch][:n*bits], l.ring[ch][p:])
+		copy(samples.RawData[ch][c:n*bits], l.ring[ch])
+	}
+	f.cursor += int64(n)
+	samples.LastNbSamples = n
+}
+
+func (l *Link) Sample(*float64, int, int) {}
+
+func (l *Link) OnStarting() {}
+
+func (l *Link) OnEnding() {}
+
+func (l *Link) OnFormatChanged(newFormat *audio.Format) {}
+
+func (l *Link) On() {
+	l.power = true
+}
+
+func (l *Link) Off() {
+	l.power = false
+}
+
+func (l *Link) IsOn() bool {
+	return l.power
+}
+
+func (l *Link) Follow(leader stream.LinkElement) error {
+	var ld *Link
+	if leader != nil {
+		var ok bool
+		if ld, ok = leader.(*Link); !ok {
+			return fmt.Errorf("leader %s can not be linked", leader.Name())
+		}
+		if ld == l {
+			return fmt.Errorf("can not follow itself")
+		}
+	}
+
+	linkLocker.Lock()
+	defer linkLocker.Unlock()
+
+	if ld != nil {
+		if ld.Leader() != nil {
+			return fmt.Errorf("leader is following another")
+		}
+		if l.Followers() > 0 {
+			return fmt.Errorf("leader can not follow another")
+		}
+	}
+
+	l.locker.Lock()
+	old := l.leader
+	l.leader = ld
+	l.synced = false
+	l.locker.Unlock()
+
+	if old == ld {
+		return nil
+	}
+	if old != nil {
+		old.removeFollower(l)
+	}
+	if ld != nil {
+		ld.locker.Lock()
+		ld.followers = append(ld.followers, l)
+		ld.locker.Unlock()
+	}
+	return nil
+}
+
+func (l *Link) removeFollower(f *Link) {
+	l.locker.Lock()
+	defer l.locker.Unlock()
+
+	for i, ff := range l.followers {
+		if ff == f {
+			l.followers = append(l.followers[:i], l.followers[i+1:]...)
+			break
+		}
+	}
+	if len(l.followers) == 0 {
+		// 没有跟随的线路时不再写入
+		l.ring = nil
+		l.format = audio.Format{}
+	}
+}
+
+func (l *Link) Leader() stream.LinkElement {
+	l.locker.Lock()
+	defer l.locker.Unlock()
+
+	if l.leader == nil {
+		return nil
+	}
+	return l.leader
+}
+
+func (l *Link) Followers() int {
+	l.locker.Lock()
+	defer l.locker.Unlock()
+
+	return len(l.followers)
+}
+
+func (l *Link) Close() error {
+	bus.UnregisterObj(l)
+
+	l.Follow(nil)
+
+	l.locker.Lock()
+	followers := l.followers
+	l.followers = nil
+	l.locker.Unlock()
+	for _, f := range followers {
+		f.Follow(nil)
+	}
+
+	l.Off()
+	return nil
+}
+
+func (o *Link) Dispatch(e string, a ...any) error {
+	return bus.DispatchObj(o, e, a...)
+}
+func (o *Link) Register(e string, c bus.Handler) *bus.HandlerData {
+	return bus.RegisterObj(o, e, c)
+}
+
+func NewLink() stream.LinkElement {
+	return &Link{
+		power: true,
+	}
+}
@@ -0,0 +1,111 @@
+package element
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zwcway/castserver-go/common/audio"
+	"github.com/zwcway/castserver-go/common/stream"
+)
+
+func TestLink(t *testing.T) {
+	format := func(layout audio.Layout) audio.Format {
+		return audio.Format{
+			Sample: audio.Sample{
+				Rate: audio.AudioRate_48000,
+				Bits: audio.Bits_DEFAULT,
+			},
+			Layout: layout,
+		}
+	}
+	// 样本值为绝对位置，便于检查时间线
+	block := func(pos int, layout audio.Layout) *stream.Samples {
+		s := stream.NewSamples(480, format(layout))
+		for ch := range s.Data {
+			for i := range s.Data[ch] {
+				s.Data[ch][i] = float64(pos + i)
+			}
+		}
+		s.LastNbSamples = 480
+		return s
+	}
+
+	t.Run("follow", func(t *testing.T) {
+		leader, follower := NewLink(), NewLink()
+		assert.NoError(t, follower.Follow(leader))
+		assert.Equal(t, 1, leader.Followers())
+		assert.Equal(t, leader, follower.Leader())
+
+		// 主线路的输出不变
+		s := block(0, audio.Layout20)
+		leader.Stream(s)
+		assert.Equal(t, 0.0, s.Data[0][0])
+
+		// 跟随的线路替换为主线路的样本和格式
+		f := block(100000, audio.Layout10)
+		follower.Stream(f)
+		assert.Equal(t, audio.Layout20, f.Format.Layout)
+		assert.Equal(t, 480, f.LastNbSamples)
+		assert.Equal(t, 0.0, f.Data[1][0])
+		assert.Equal(t, 479.0, f.Data[1][479])
+
+		// 之后按照相同的时间线连续读取
+		for pos := 480; pos < 4800; pos += 480 {
+			leader.Stream(block(pos, audio.Layout20))
+			f = block(100000, audio.Layout10)
+			follower.Stream(f)
+			assert.Equal(t, float64(pos), f.Data[0][0])
+		}
+
+		// 主线路暂停时没有输出
+		f = block(100000, audio.Layout10)
+		follower.Stream(f)
+		assert.Equal(t, 0, f.LastNbSamples)
+	})
+
+	t.Run("follower ahead of leader", func(t *testing.T) {
+		leader, follower := NewLink(), NewLink()
+		follower.Follow(leader)
+
+		leader.Stream(block(0, audio.Layout20))
+		for pos := 480; pos < 4800; pos += 480 {
+			// 跟随的线路先处理，使用上一块
+			f := block(100000, audio.Layout20)
+			follower.Stream(f)
+			assert.Equal(t, float64(pos-480), f.Data[0][0])
+			leader.Stream(block(pos, audio.Layout20))
+		}
+	})
+
+	t.Run("unlink", func(t *testing.T) {
+		leader, follower := NewLink(), NewLink()
+		follower.Follow(leader)
+		leader.Stream(block(0, audio.Layout20))
+
+		assert.NoError(t, follower.Follow(nil))
+		assert.Equal(t, 0, leader.Followers())
+		assert.Nil(t, follower.Leader())
+
+		// 立即恢复自身的输入
+		f := block(100000, audio.Layout10)
+		follower.Stream(f)
+		assert.Equal(t, 100000.0, f.Data[0][0])
+		assert.Equal(t, audio.Layout10, f.Format.Layout)
+
+		s := block(480, audio.Layout20)
+		leader.Stream(s)
+		assert.Equal(t, 480.0, s.Data[0][0])
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		a, b, c := NewLink(), NewLink(), NewLink()
+		assert.Error(t, a.Follow(a))
+		assert.NoError(t, b.Follow(a))
+		assert.Error(t, c.Follow(b))
+		assert.Error(t, a.Follow(c))
+
+		// 主线路关闭时解除所有跟随
+		a.Close()
+		assert.Nil(t, b.Leader())
+	})
+}
@@ -0,0 +1,268 @@
+package element
+
+import (
+	"math"
+	"sync"
+
+	"github.com/zwcway/castserver-go/common/audio"
+	"github.com/zwcway/castserver-go/common/bus"
+	"github.com/zwcway/castserver-go/common/dsp"
+	"github.com/zwcway/castserver-go/common/stream"
+)
+
+const (
+	LoudnessMaxGain float64 = 12  // 最大提升 dB
+	LoudnessMinGain float64 = -30 // 最大衰减 dB
+
+	replayGainReference float64 = -18 // ReplayGain 2.0 的参考响度 LUFS
+	loudnessSmoothTime  float64 = 0.5 // 增益变化的时间常数，秒
+)
+
+// 响度标准化，将输入调整至目标响度
+type Loudness struct {
+	power  bool
+	format audio.Format
+	mode   stream.LoudnessMode
+	target float64
+
+	meter *dsp.LoudnessMeter
+
+	hasTrack  bool
+	trackGain float64
+	trackPeak float64
+
+	desired float64 // 期望的增益 dB
+	gain    float64 // 当前线性增益，平滑过渡至期望值
+	coef    float64
+	reset   bool
+	jump    bool // 下一次直接使用期望增益
+
+	tmp [][]float64 // float32 格式时转换的缓存
+
+	locker sync.Mutex // 音频线程处理时，其它协程可能读取响度和增益
+}
+
+func (l *Loudness) Name() string {
+	return "Loudness"
+}
+
+func (l *Loudness) Type() stream.ElementType {
+	return stream.ET_WholeSamples
+}
+
+func (l *Loudness) Stream(samples *stream.Samples) {
+	if !l.power || samples == nil || samples.LastNbSamples == 0 {
+		return
+	}
+	l.locker.Lock()
+	defer l.locker.Unlock()
+
+	if l.meter == nil || samples.Format.Rate != l.format.Rate || samples.Format.Layout != l.format.Layout {
+		l.format = samples.Format
+		l.meter = dsp.NewLoudnessMeter(l.format.Rate.ToInt(), l.format.Channels())
+		l.coef = 1 - math.Exp(-1/(loudnessSmoothTime*float64(l.format.Rate.ToInt())))
+	}
+	if l.reset {
+		l.meter.Reset()
+		l.reset = false
+	}
+
+	// 测量增益之前的响度
+	if samples.IsFloat32() {
+		chs := int(samples.Format.Count)
+		if len(l.tmp) != chs {
+			l.tmp = make([][]float64, chs)
+		}
+		for ch := range l.tmp {
+			l.tmp[ch] = samples.Float64(ch, samples.LastNbSamples, l.tmp[ch])
+		}
+		l.meter.Process(l.tmp, samples.LastNbSamples)
+	} else {
+		l.meter.Process(samples.Data, samples.LastNbSamples)
+	}
+
+	l.desired = l.decideGain()
+	want := dsp.DbToLinear(l.desired)
+	if l.jump {
+		l.gain = want
+		l.jump = false
+	}
+
+	if samples.IsFloat32() {
+		loudnessGain(l, stream.Planar[float32](samples), samples, want)
+	} else {
+		loudnessGain(l, stream.Planar[float64](samples), samples, want)
+	}
+}
+
+func loudnessGain[T stream.Float](l *Loudness, data [][]T, samples *stream.Samples, want float64) {
+	chs := int(samples.Format.Layout.Count)
+	if chs > len(data) {
+		chs = len(data)
+	}
+	for i := 0; i < samples.LastNbSamples; i++ {
+		l.gain += (want - l.gain) * l.coef
+		for ch := 0; ch < chs; ch++ {
+			data[ch][i] *= T(l.gain)
+		}
+	}
+}
+
+// 计算期望增益
+func (l *Loudness) decideGain() float64 {
+	var gain float64
+
+	if l.mode == stream.LM_Track && l.hasTrack {
+		gain = l.trackGain + l.target - replayGainReference
+		if l.trackPeak > 0 {
+			// 避免削波
+			gain = math.Min(gain, -dsp.LinearToDb(l.trackPeak))
+		}
+	} else {
+		i := l.meter.Integrated()
+		if math.IsInf(i, -1) {
+			// 还没有足够的数据，保持当前增益
+			return l.desired
+		}
+		gain = l.target - i
+	}
+
+	return math.Max(LoudnessMinGain, math.Min(LoudnessMaxGain, gain))
+}
+
+func (l *Loudness) Sample(*float64, int, int) {}
+
+func (l *Loudness) OnStarting() {}
+
+func (l *Loudness) OnEnding() {}
+
+func (l *Loudness) OnFormatChanged(newFormat *audio.Format) {
+}
+
+func (l *Loudness) On() {
+	l.power = true
+}
+
+func (l *Loudness) Off() {
+	l.power = false
+}
+
+func (l *Loudness) IsOn() bool {
+	return l.power
+}
+
+func (l *Loudness) SetTarget(t float64) {
+	l.locker.Lock()
+	defer l.locker.Unlock()
+
+	l.target = t
+}
+
+func (l *Loudness) Target() float64 {
+	l.locker.Lock()
+	defer l.locker.Unlock()
+
+	return l.target
+}
+
+func (l *Loudness) SetMode(m stream.LoudnessMode) {
+	if !m.IsValid() {
+		return
+	}
+	l.locker.Lock()
+	defer l.locker.Unlock()
+
+	l.mode = m
+}
+
+func (l *Loudness) Mode() stream.LoudnessMode {
+	l.locker.Lock()
+	defer l.locker.Unlock()
+
+	return l.mode
+}
+
+func (l *Loudness) SetTrackGain(gain float64, peak float64) {
+	l.locker.Lock()
+	defer l.locker.Unlock()
+
+	l.trackGain = gain
+	l.trackPeak = peak
+	l.hasTrack = true
+	l.jump = l.mode == stream.LM_Track
+}
+
+func (l *Loudness) ClearTrackGain() {
+	l.locker.Lock()
+	defer l.locker.Unlock()
+
+	l.hasTrack = false
+}
+
+func (l *Loudness) Reset() {
+	l.locker.Lock()
+	defer l.locker.Unlock()
+
+	l.reset = true
+}
+
+func (l *Loudness) Momentary() float64 {
+	l.locker.Lock()
+	defer l.locker.Unlock()
+
+	if l.meter == nil {
+		return math.Inf(-1)
+	}
+	return l.meter.Momentary()
+}
+
+func (l *Loudness) ShortTerm() float64 {
+	l.locker.Lock()
+	defer l.locker.Unlock()
+
+	if l.meter == nil {
+		return math.Inf(-1)
+	}
+	return l.meter.ShortTerm()
+}
+
+func (l *Loudness) Integrated() float64 {
+	l.locker.Lock()
+	defer l.locker.Unlock()
+
+	if l.meter == nil {
+		return math.Inf(-1)
+	}
+	return l.meter.Integrated()
+}
+
+func (l *Loudness) Gain() float64 {
+	l.locker.Lock()
+	defer l.locker.Unlock()
+
+	return dsp.LinearToDb(l.gain)
+}
+
+func (l *Loudness) Close() error {
+	bus.UnregisterObj(l)
+
+	l.Off()
+	l.locker.Lock()
+	l.meter = nil
+	l.locker.Unlock()
+	return nil
+}
+
+func (o *Loudness) Dispatch(e string, a ...any) error {
+	return bus.DispatchObj(o, e, a...)
+}
+func (o *Loudness) Register(e string, c bus.Handler) *bus.HandlerData {
+	return bus.RegisterObj(o, e, c)
+}
+
+func NewLoudness(target float64) stream.LoudnessElement {
+	return &Loudness{
+		target: target,
+		gain:   1,
+	}
+}
@@ -0,0 +1,49 @@
+package element
+
+import (
+	"math"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zwcway/castserver-go/common/audio"
+	"github.com/zwcway/castserver-go/common/stream"
+)
+
+func TestLoudnessConcurrentRead(t *testing.T) {
+	s := stream.NewSamples(480, audio.Format{
+		Sample: audio.Sample{Rate: audio.AudioRate_48000, Bits: audio.Bits_64LEF},
+		Layout: audio.Layout20,
+	})
+	left := make([]float64, 480)
+	for i := range left {
+		left[i] = 0.5 * math.Sin(2*math.Pi*1000*float64(i)/48000)
+	}
+	s.SetFloat64(0, left)
+	s.LastNbSamples = 480
+
+	l := NewLoudness(-23)
+	l.On()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			l.Stream(s)
+		}
+		// 读取的同时关闭
+		l.Close()
+	}()
+
+	for i := 0; i < 200; i++ {
+		l.Momentary()
+		l.ShortTerm()
+		l.Integrated()
+		l.Gain()
+	}
+	wg.Wait()
+
+	assert.True(t, math.IsInf(l.Momentary(), -1))
+	assert.True(t, math.IsInf(l.Integrated(), -1))
+}
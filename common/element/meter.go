@@ -0,0 +1,264 @@
+package element
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/zwcway/castserver-go/common/audio"
+	"github.com/zwcway/castserver-go/common/bus"
+	"github.com/zwcway/castserver-go/common/config"
+	"github.com/zwcway/castserver-go/common/dsp"
+	"github.com/zwcway/castserver-go/common/stream"
+)
+
+type meterChannel struct {
+	stream.PeakLevel
+
+	tp   dsp.TruePeak
+	age  float64 // 峰值已保持的秒数
+	used bool
+}
+
+// Meter 峰值表元，位于音量和播报之后，测量的是实际输出的样本
+type Meter struct {
+	power bool
+
+	locker   sync.Mutex
+	truePeak bool
+	peakHold time.Duration
+	decay    float64 // 保持结束后每秒下降的 dB
+	chs      [audio.Channel_MAX]meterChannel
+	layout   audio.Layout
+	clipping bool
+	clipAge  float64 // 最后一次削波之后的秒数
+}
+
+func (m *Meter) Name() string {
+	return "Meter"
+}
+
+func (m *Meter) Type() stream.ElementType {
+	return stream.ET_WholeSamples
+}
+
+func (m *Meter) Stream(samples *stream.Samples) {
+	n := samples.LastNbSamples
+	if !m.power || n == 0 || !samples.IsFloat() {
+		return
+	}
+	rate := samples.Format.Rate.ToInt()
+	if rate <= 0 {
+		return
+	}
+
+	m.locker.Lock()
+	if m.layout != samples.Format.Layout {
+		// 声道变化时重新测量
+		for i := range m.chs {
+			m.chs[i].used = false
+		}
+		m.layout = samples.Format.Layout
+	}
+	var (
+		dt    = float64(n) / float64(rate)
+		hold  = m.peakHold.Seconds()
+		decay = math.Pow(10, -m.decay*dt/20)
+		clips = m.clips()
+	)
+	for _, ch := range samples.Format.Channels() {
+		idx := int(samples.ChannelIndex[ch])
+		if idx < 0 || idx >= int(samples.Format.Count) {
+			continue
+		}
+		c := &m.chs[ch]
+		if !c.used {
+			c.PeakLevel = stream.PeakLevel{Channel: ch}
+			c.tp.Reset()
+			c.used = true
+		}
+
+		var peak, truePeak float64
+		if samples.IsFloat32() {
+			peak, truePeak, c.Clips = meterPlanar(c, samples.Data32[idx][:n], m.truePeak)
+		} else {
+			peak, truePeak, c.Clips = meterPlanar(c, samples.Data[idx][:n], m.truePeak)
+		}
+
+		c.Peak, c.TruePeak = peak, truePeak
+		if peak >= c.PeakHold || truePeak >= c.TruePeakHold {
+			c.age = 0
+		} else {
+			c.age += dt
+		}
+		if c.age > hold {
+			c.PeakHold *= decay
+			c.TruePeakHold *= decay
+		}
+		c.PeakHold = math.Max(c.PeakHold, peak)
+		c.TruePeakHold = math.Max(c.TruePeakHold, truePeak)
+	}
+
+	var changed bool
+	if m.clips() > clips {
+		// 本块有削波
+		changed = !m.clipping
+		m.clipping = true
+		m.clipAge = 0
+	} else if m.clipping {
+		if m.clipAge += dt; m.clipAge > hold {
+			m.clipping = false
+			changed = true
+		}
+	}
+	clipping := m.clipping
+	m.locker.Unlock()
+
+	if changed {
+		stream.BusMeterClipped.Dispatch(m, clipping)
+	}
+}
+
+// 返回峰值、真峰值和累计的削波样本数
+func meterPlanar[T stream.Float](c *meterChannel, data []T, truePeak bool) (peak float64, tp float64, clips uint64) {
+	clips = c.Clips
+	for _, s := range data {
+		v := float64(s)
+		if truePeak {
+			tp = math.Max(tp, c.tp.Push(v))
+		}
+		if v < 0 {
+			v = -v
+		}
+		if v >= 1 {
+			clips++
+		}
+		if v > peak {
+			peak = v
+		}
+	}
+	return
+}
+
+func (m *Meter) Sample(*float64, int, int) {}
+
+func (m *Meter) OnStarting() {}
+
+func (m *Meter) OnEnding() {}
+
+func (m *Meter) OnFormatChanged(newFormat *audio.Format) {}
+
+func (m *Meter) On() {
+	m.power = true
+}
+
+func (m *Meter) Off() {
+	m.power = false
+}
+
+func (m *Meter) IsOn() bool {
+	return m.power
+}
+
+func (m *Meter) SetTruePeak(b bool) {
+	m.locker.Lock()
+	defer m.locker.Unlock()
+
+	if b && !m.truePeak {
+		for i := range m.chs {
+			m.chs[i].tp.Reset()
+		}
+	}
+	m.truePeak = b
+}
+
+func (m *Meter) TruePeak() bool {
+	m.locker.Lock()
+	defer m.locker.Unlock()
+
+	return m.truePeak
+}
+
+func (m *Meter) SetPeakHold(d time.Duration) {
+	m.locker.Lock()
+	defer m.locker.Unlock()
+
+	if d >= 0 {
+		m.peakHold = d
+	}
+}
+
+func (m *Meter) PeakHold() time.Duration {
+	m.locker.Lock()
+	defer m.locker.Unlock()
+
+	return m.peakHold
+}
+
+func (m *Meter) Levels() (levels []stream.PeakLevel) {
+	m.locker.Lock()
+	defer m.locker.Unlock()
+
+	for _, ch := range m.layout.Channels() {
+		if m.chs[ch].used {
+			levels = append(levels, m.chs[ch].PeakLevel)
+		}
+	}
+	return
+}
+
+func (m *Meter) Clips() uint64 {
+	m.locker.Lock()
+	defer m.locker.Unlock()
+
+	return m.clips()
+}
+
+func (m *Meter) clips() (n uint64) {
+	for i := range m.chs {
+		if m.chs[i].used {
+			n += m.chs[i].Clips
+		}
+	}
+	return
+}
+
+func (m *Meter) IsClipping() bool {
+	m.locker.Lock()
+	defer m.locker.Unlock()
+
+	return m.clipping
+}
+
+func (m *Meter) ResetClips() {
+	m.locker.Lock()
+	defer m.locker.Unlock()
+
+	for i := range m.chs {
+		m.chs[i].Clips = 0
+		m.chs[i].PeakHold = 0
+		m.chs[i].TruePeakHold = 0
+	}
+}
+
+func (m *Meter) Close() error {
+	bus.UnregisterObj(m)
+
+	m.Off()
+	return nil
+}
+
+func (o *Meter) Dispatch(e string, a ...any) error {
+	return bus.DispatchObj(o, e, a...)
+}
+func (o *Meter) Register(e string, c bus.Handler) *bus.HandlerData {
+	return bus.RegisterObj(o, e, c)
+}
+
+func NewMeter() stream.MeterElement {
+	return &Meter{
+		power:    true,
+		peakHold: config.MeterPeakHold,
+		decay:    config.MeterPeakDecay,
+	}
+}
@@ -0,0 +1,89 @@
+package element
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zwcway/castserver-go/common/audio"
+	"github.com/zwcway/castserver-go/common/stream"
+)
+
+func TestMeter(t *testing.T) {
+	for _, bits := range []audio.Bits{audio.Bits_64LEF, audio.Bits_32LEF} {
+		t.Run(bits.String(), func(t *testing.T) {
+			// 左声道为四分之一采样率、相位 45 度的正弦
+			block := func(gain float64) *stream.Samples {
+				s := stream.NewSamples(480, audio.Format{
+					Sample: audio.Sample{Rate: audio.AudioRate_48000, Bits: bits},
+					Layout: audio.Layout20,
+				})
+				left := make([]float64, 480)
+				for i := range left {
+					left[i] = gain * math.Sin(math.Pi*float64(i)/2+math.Pi/4)
+				}
+				s.SetFloat64(0, left)
+				s.LastNbSamples = 480
+				return s
+			}
+
+			m := NewMeter()
+			m.SetPeakHold(50 * time.Millisecond)
+
+			var events []bool
+			stream.BusMeterClipped.Register(m, func(_ stream.MeterElement, clipping bool) error {
+				events = append(events, clipping)
+				return nil
+			})
+			defer m.Close()
+
+			// 样本峰值未超过 0dBFS，真峰值超过
+			m.Stream(block(1.2))
+			levels := m.Levels()
+			if assert.Len(t, levels, 2) {
+				assert.Equal(t, audio.Channel_FRONT_LEFT, levels[0].Channel)
+				assert.InDelta(t, 1.2*math.Sqrt2/2, levels[0].Peak, 1e-6)
+				assert.Zero(t, levels[0].TruePeak)
+				assert.Zero(t, levels[1].Peak)
+			}
+			assert.Zero(t, m.Clips())
+			assert.False(t, m.IsClipping())
+
+			m.SetTruePeak(true)
+			m.Stream(block(1.2))
+			levels = m.Levels()
+			assert.InDelta(t, 1.2, levels[0].TruePeak, 0.03)
+			assert.InDelta(t, 1.2, levels[0].TruePeakHold, 0.03)
+			assert.Zero(t, m.Clips())
+
+			// 削波
+			m.Stream(block(2))
+			assert.Equal(t, uint64(480), m.Clips())
+			assert.True(t, m.IsClipping())
+			assert.Equal(t, []bool{true}, events)
+
+			// 峰值保持 50ms 之后下降，削波提示结束。
+			// 真峰值插值滤波器的余量使削波后的第一块仍达到峰值，多处理一块
+			for i := 0; i < 7; i++ {
+				m.Stream(block(0.1))
+			}
+			levels = m.Levels()
+			assert.False(t, m.IsClipping())
+			assert.Equal(t, []bool{true, false}, events)
+			assert.Less(t, levels[0].PeakHold, 2*math.Sqrt2/2)
+			assert.Greater(t, levels[0].PeakHold, 0.1)
+			assert.Equal(t, uint64(480), levels[0].Clips)
+
+			m.ResetClips()
+			assert.Zero(t, m.Clips())
+			assert.Zero(t, m.Levels()[0].PeakHold)
+
+			// 满幅的样本也算削波
+			full := block(0)
+			full.SetFloat64(0, []float64{1, -1})
+			m.Stream(full)
+			assert.Equal(t, uint64(2), m.Clips())
+		})
+	}
+}
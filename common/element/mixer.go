@@ -1,11 +1,14 @@
 package element
 
 import (
+	"fmt"
 	"sync"
+	"time"
 
 	"github.com/zwcway/castserver-go/common/audio"
 	"github.com/zwcway/castserver-go/common/bus"
 	"github.com/zwcway/castserver-go/common/config"
+	"github.com/zwcway/castserver-go/common/dsp"
 	"github.com/zwcway/castserver-go/common/stream"
 	"github.com/zwcway/castserver-go/common/utils"
 )
@@ -13,6 +16,11 @@ import (
 type mixerStreamer struct {
 	streamer stream.SourceStreamer
 	resample stream.ResampleElement
+	ctl      *mixerControl
+	onFormat *bus.HandlerData // 在源上注册的格式变更事件
+
+	pre    *stream.Samples // 预读的样本，仅由音频线程访问
+	prePos int             // 已经取出的预读样本数
 }
 
 const (
@@ -21,14 +29,44 @@ const (
 	onResample
 )
 
+// 立即切换时的最短淡化时长，避免爆音
+const mixerMinFade = 10 * time.Millisecond
+
+// 当前源结束前多久预读下一个源
+const mixerPrerollAhead = 500 * time.Millisecond
+
+// 曲目切换，所有字段的修改都必须持有锁
+type mixerTransition struct {
+	from    stream.SourceStreamer
+	to      *mixerStreamer
+	now     bool // 立即切换
+	fading  bool // 已经开始交叉淡化
+	ended   bool // from 已经结束
+	preroll bool // 已经预读 to
+	pos     int  // 已经淡化的样本数
+	length  int  // 淡化的总样本数
+}
+
 // 音频混合器
 type Mixer struct {
 	// 与顺序无关
-	streamers []mixerStreamer
+	streamers []*mixerStreamer
+	list      []*mixerStreamer // 音频线程使用的副本
 
 	buffer   *stream.Samples
+	restBuf  *stream.Samples // 预读样本不足时的剩余部分
+	format   audio.Format    // 混合后的输出格式
 	resample uint8
 
+	fade      time.Duration // 交叉淡化时长，0 表示无缝衔接
+	fadeCurve dsp.FadeCurve
+	next      *mixerTransition
+	nextBuf   *stream.Samples
+	retired   []*mixerStreamer // 被替换的 to，等待音频线程释放后关闭
+
+	ids   uint16 // 最近分配的源 ID
+	meter bool   // 测量每个源的电平
+
 	locker sync.Mutex
 }
 
@@ -49,41 +87,67 @@ func (m *Mixer) Len() int {
 
 func (m *Mixer) Add(ss ...stream.SourceStreamer) {
 	m.locker.Lock()
-	defer m.locker.Unlock()
-
-	var resample stream.ResampleElement
-
 	for _, s := range ss {
 		if s == nil {
 			continue
 		}
 
-		stream.BusResample.GetInstance(m, &resample, nil)
+		m.streamers = append(m.streamers, m.newStreamer(s, nil))
+	}
 
-		if resample == nil {
-			m.resample = noResample
-		}
-		m.streamers = append(m.streamers, mixerStreamer{
-			s,
-			resample,
-		})
+	changed := m.decideFormat()
+	m.locker.Unlock()
 
+	if changed {
+		m.notifyFormat()
+	}
+}
+
+// ctl 为空时分配新的控制
+func (m *Mixer) newStreamer(s stream.SourceStreamer, ctl *mixerControl) *mixerStreamer {
+	var resample stream.ResampleElement
+
+	stream.BusResample.GetInstance(m, &resample, nil)
+
+	if resample == nil {
+		m.resample = noResample
+	}
+
+	if ctl == nil {
+		m.ids++
+		ctl = newMixerControl(m.ids)
+	}
+
+	return &mixerStreamer{
+		streamer: s,
+		resample: resample,
+		ctl:      ctl,
 		// 订阅格式变更事件，同步调用
-		stream.BusSourceFormatChanged.Register(s, m.onSourceFormatChanged)
+		onFormat: stream.BusSourceFormatChanged.Register(s, m.onSourceFormatChanged),
 	}
+}
 
-	m.decideFormat()
+// 注销 newStreamer 注册的事件，源上其它模块的事件不受影响
+func (ms *mixerStreamer) unregister() {
+	bus.UnregisterHandler(ms.onFormat)
 }
 
 func (m *Mixer) onSourceFormatChanged(ss stream.SourceStreamer, format *audio.Format, channelIndex audio.ChannelIndex) error {
-	m.decideFormat()
+	m.locker.Lock()
+	changed := m.decideFormat()
+	m.locker.Unlock()
+
+	if changed {
+		m.notifyFormat()
+	}
 	return nil
 }
 
-// 根据每个待混合格式确定合适的统一格式
-func (m *Mixer) decideFormat() {
+// 根据每个待混合格式确定合适的统一格式，返回格式是否改变。
+// 必须持有锁
+func (m *Mixer) decideFormat() bool {
 	if len(m.streamers) == 0 {
-		return
+		return false
 	}
 
 	format := audio.InternalFormat()
@@ -100,7 +164,7 @@ func (m *Mixer) decideFormat() {
 		}
 	}
 
-	m.SetFormat(format)
+	return m.setFormat(format)
 }
 
 func (m *Mixer) Del(s stream.SourceStreamer) {
@@ -108,9 +172,13 @@ func (m *Mixer) Del(s stream.SourceStreamer) {
 	defer m.locker.Unlock()
 
 	for i := 0; i < len(m.streamers); i++ {
-		if m.streamers[i].streamer == s {
+		if ms := m.streamers[i]; ms.streamer == s {
 			utils.SliceQuickRemove(&m.streamers, i)
 			s.Close()
+			ms.unregister()
+			if m.next != nil && m.next.from == s {
+				m.cancelTransition()
+			}
 			return
 		}
 	}
@@ -133,6 +201,144 @@ func (m *Mixer) Clear() {
 	defer m.locker.Unlock()
 
 	m.streamers = m.streamers[:0]
+	m.cancelTransition()
+}
+
+func (m *Mixer) SetCrossfade(d time.Duration, curve dsp.FadeCurve) {
+	if d < 0 {
+		d = 0
+	}
+	if !dsp.IsFadeCurveValid(curve) {
+		curve = dsp.EqualPowerFade
+	}
+	m.locker.Lock()
+	m.fade = d
+	m.fadeCurve = curve
+	m.locker.Unlock()
+}
+
+func (m *Mixer) Crossfade() (time.Duration, dsp.FadeCurve) {
+	m.locker.Lock()
+	defer m.locker.Unlock()
+
+	return m.fade, m.fadeCurve
+}
+
+func (m *Mixer) SetNext(from stream.SourceStreamer, to stream.SourceStreamer) {
+	m.setTransition(from, to, false)
+}
+
+func (m *Mixer) Switch(from stream.SourceStreamer, to stream.SourceStreamer) {
+	m.setTransition(from, to, true)
+}
+
+func (m *Mixer) Next() stream.SourceStreamer {
+	m.locker.Lock()
+	defer m.locker.Unlock()
+
+	if m.next == nil {
+		return nil
+	}
+	return m.next.to.streamer
+}
+
+func (m *Mixer) CancelNext() {
+	m.locker.Lock()
+	defer m.locker.Unlock()
+
+	if m.next != nil && !m.next.fading {
+		m.cancelTransition()
+	}
+}
+
+func (m *Mixer) setTransition(from stream.SourceStreamer, to stream.SourceStreamer, now bool) {
+	if m.addTransition(from, to, now) {
+		m.notifyFormat()
+	}
+}
+
+// 返回格式是否改变
+func (m *Mixer) addTransition(from stream.SourceStreamer, to stream.SourceStreamer, now bool) bool {
+	m.locker.Lock()
+	defer m.locker.Unlock()
+
+	if to == nil || from == to {
+		return false
+	}
+
+	if m.next != nil && m.next.from == from && m.next.fading {
+		// 正在淡化，替换淡入的源。音频线程可能正在读取旧的源，由其负责关闭
+		m.retire(m.next.to)
+		m.next.to = m.newStreamer(to, m.next.to.ctl)
+		m.initNext(to)
+		return false
+	}
+	m.cancelTransition()
+
+	var ctl *mixerControl
+	for _, ms := range m.streamers {
+		if ms.streamer == from {
+			ctl = ms.ctl
+			break
+		}
+	}
+	if ctl == nil {
+		// 当前源不存在，直接加入
+		m.streamers = append(m.streamers, m.newStreamer(to, nil))
+		return m.decideFormat()
+	}
+
+	// 新的源继承当前源的控制，但不继承暂停时的淡出
+	ctl.resetFade()
+	m.next = &mixerTransition{
+		from: from,
+		to:   m.newStreamer(to, ctl),
+		now:  now,
+	}
+	m.initNext(to)
+	return false
+}
+
+// 必须持有锁
+func (m *Mixer) initNext(to stream.SourceStreamer) {
+	format := m.format
+	if m.resample != onResample {
+		f := to.AudioFormat()
+		f.Sample = format.Sample
+		to.SetOutFormat(f)
+	}
+	if m.nextBuf == nil {
+		m.nextBuf = stream.NewSamplesDuration(config.AudioBuferMSDuration, format)
+	} else {
+		m.nextBuf.ResizeDuration(config.AudioBuferMSDuration, format)
+	}
+}
+
+// 必须持有锁
+func (m *Mixer) cancelTransition() {
+	if m.next == nil {
+		return
+	}
+	m.retire(m.next.to)
+	m.next = nil
+}
+
+// 延迟关闭，必须持有锁
+func (m *Mixer) retire(ms *mixerStreamer) {
+	m.retired = append(m.retired, ms)
+}
+
+// 关闭已经被替换的源，在音频线程中调用
+func (m *Mixer) closeRetired() {
+	m.locker.Lock()
+	retired := m.retired
+	m.retired = nil
+	m.locker.Unlock()
+
+	for _, ms := range retired {
+		ms.unregister()
+		ms.streamer.Close()
+	}
 }
 
 func (m *Mixer) Buffer() *stream.Samples {
@@ -161,13 +367,28 @@ func (m *Mixer) SetResample(on bool) {
 }
 
 func (m *Mixer) SetFormat(format audio.Format) {
-	if format == m.buffer.Format {
-		return
+	m.locker.Lock()
+	changed := m.setFormat(format)
+	m.locker.Unlock()
+
+	if changed {
+		m.notifyFormat()
+	}
+}
+
+// 返回格式是否改变，由调用者在释放锁后通知。
+// 必须持有锁
+func (m *Mixer) setFormat(format audio.Format) bool {
+	format.Bits = audio.InternalBits()
+	if format == m.format {
+		return false
 	}
-	format.Bits = audio.Bits_DEFAULT
+	m.format = format
 
 	m.buffer.ResizeDuration(config.AudioBuferMSDuration, format)
-	stream.BusMixerFormatChanged.Dispatch(m, &format, m.buffer.ChannelIndex)
+	if m.nextBuf != nil {
+		m.nextBuf.ResizeDuration(config.AudioBuferMSDuration, format)
+	}
 
 	if m.resample != onResample {
 		// 通知所有输入源变更输出格式
@@ -176,55 +397,392 @@ func (m *Mixer) SetFormat(format audio.Format) {
 			f.Sample = format.Sample
 			ms.streamer.SetOutFormat(f)
 		}
+		if m.next != nil {
+			f := m.next.to.streamer.AudioFormat()
+			f.Sample = format.Sample
+			m.next.to.streamer.SetOutFormat(f)
+		}
 	}
+	return true
+}
+
+// 通知格式变更，不能持有锁，事件的处理可能再次调用混音器
+func (m *Mixer) notifyFormat() {
+	m.locker.Lock()
+	format := m.format
+	channelIndex := m.buffer.ChannelIndex
+	m.locker.Unlock()
 
+	stream.BusMixerFormatChanged.Dispatch(m, &format, channelIndex)
 }
 
 func (m *Mixer) Format() audio.Format {
-	return m.buffer.Format
+	m.locker.Lock()
+	defer m.locker.Unlock()
+
+	return m.format
 }
 
 func (m *Mixer) Stream(samples *stream.Samples) {
-	if len(m.streamers) == 0 {
+	// 上一次调用已经结束，被替换的源不再使用
+	m.closeRetired()
+
+	m.locker.Lock()
+	m.list = append(m.list[:0], m.streamers...)
+	t := m.next
+	var to *mixerStreamer
+	if t != nil {
+		to = t.to
+	}
+	solo := m.hasSolo()
+	meter := m.meter
+	format := m.format
+	m.locker.Unlock()
+
+	if len(m.list) == 0 {
 		return
 	}
 
 	if m.buffer.LessThan(samples) {
-		m.buffer.Resize(samples.RequestNbSamples, samples.Format)
+		m.buffer.Resize(samples.RequestNbSamples, format)
 	}
 
-	mixed := 0
-	for si := 0; si < len(m.streamers); si++ {
-		ms := m.streamers[si]
-
-		m.buffer.ResetData()
-
-		ms.streamer.Stream(m.buffer)
+	// 以混合格式输出，保留输入源的所有声道，由声道混音元转换至线路的布局
+	request := samples.RequestNbSamples
+	samples.Reformat(request, format)
+	samples.ResetData()
+	samples.RequestNbSamples = request
 
-		if m.resample == onResample && ms.resample != nil {
-			ms.resample.Stream(m.buffer)
+	mixed := 0
+	for _, ms := range m.list {
+		var i int
+		if t != nil && ms.streamer == t.from {
+			i = m.streamTransition(samples, ms, t, to, solo, meter)
+		} else {
+			resetBuffer(m.buffer, samples)
+			m.pull(ms, m.buffer)
+			ms.ctl.apply(m.buffer, solo, meter, true)
+			i = m.buffer.MixChannelMap(samples, 0, 0)
 		}
 
-		i := m.buffer.MixChannelMap(samples, 0, 0)
-
 		if mixed < i {
 			mixed = i
 		}
 
 		if ms.streamer.CanRemove() {
 			m.Del(ms.streamer)
-			si--
 		}
 	}
 
 	samples.WrapError(m.buffer.LastErr)
 	samples.LastNbSamples = mixed
-	samples.Format = m.buffer.Format
 	// if mixed > samples.LastNbSamples && mixed <= samples.RequestNbSamples {
 	// 	samples.LastNbSamples = mixed
 	// }
 }
 
+// 优先取出预读的样本
+func (m *Mixer) pull(ms *mixerStreamer, buf *stream.Samples) {
+	if ms.pre == nil {
+		m.pullSource(ms, buf)
+		return
+	}
+
+	pre := ms.pre
+	buf.SetFormatAndIndex(pre.Format, pre.ChannelIndex)
+	n := pre.MixChannelMap(buf, 0, ms.prePos)
+	ms.prePos += n
+	if ms.prePos >= pre.LastNbSamples {
+		ms.pre = nil
+	}
+	buf.LastNbSamples = n
+	if n >= buf.RequestNbSamples {
+		return
+	}
+
+	if m.restBuf == nil {
+		m.restBuf = stream.NewSamples(buf.RequestNbSamples, pre.Format)
+	} else if m.restBuf.RequestNbSamples < buf.RequestNbSamples {
+		m.restBuf.Resize(buf.RequestNbSamples, pre.Format)
+	}
+	m.restBuf.ResetData()
+	m.restBuf.RequestNbSamples = buf.RequestNbSamples - n
+	m.pullSource(ms, m.restBuf)
+	buf.LastNbSamples = n + m.restBuf.MixChannelMap(buf, n, 0)
+	buf.LastErr = m.restBuf.LastErr
+}
+
+func (m *Mixer) pullSource(ms *mixerStreamer, buf *stream.Samples) {
+	ms.streamer.Stream(buf)
+
+	if m.resample == onResample && ms.resample != nil {
+		ms.resample.Stream(buf)
+	}
+}
+
+// 在当前源结束前预读下一个源的第一块，避免切换时等待解码
+func (m *Mixer) preroll(to *mixerStreamer, samples *stream.Samples) {
+	pre := stream.NewSamples(samples.RequestNbSamples, m.format)
+	m.pullSource(to, pre)
+	if pre.LastNbSamples > 0 {
+		to.pre = pre
+		to.prePos = 0
+	}
+}
+
+// 流式处理正在切换的源，返回混合的样本数
+func (m *Mixer) streamTransition(samples *stream.Samples, from *mixerStreamer, t *mixerTransition, to *mixerStreamer, solo bool, meter bool) int {
+	if m.nextBuf.LessThan(samples) {
+		m.nextBuf.Resize(samples.RequestNbSamples, samples.Format)
+	}
+
+	left := remaining(t.from)
+
+	m.locker.Lock()
+	fade, curve := m.fade, m.fadeCurve
+	if !t.fading && (t.now || fade > 0 && left >= 0 && left <= fade) {
+		m.startFade(t, fade)
+	}
+	// 剩余时长未知时立即预读
+	preroll := !t.fading && !t.preroll && left <= fade+mixerPrerollAhead
+	if preroll {
+		t.preroll = true
+	}
+	fading := t.fading
+	m.locker.Unlock()
+
+	if preroll {
+		m.preroll(to, samples)
+	}
+
+	var (
+		ctl   = from.ctl
+		mixed = 0
+		first = true
+	)
+	if !t.ended {
+		resetBuffer(m.buffer, samples)
+		m.pull(from, m.buffer)
+		n := m.buffer.LastNbSamples
+		if fading {
+			m.applyFade(m.buffer, t, false, curve)
+		}
+		ctl.apply(m.buffer, solo, meter, first)
+		first = false
+		mixed = m.buffer.MixChannelMap(samples, 0, 0)
+		ended := isSourceFinished(t.from)
+
+		m.locker.Lock()
+		t.ended = ended
+		m.locker.Unlock()
+
+		if !fading && ended {
+			// 无缝衔接，剩余部分由下一个源填充
+			if n < samples.RequestNbSamples {
+				resetBuffer(m.nextBuf, samples)
+				if rest := samples.RequestNbSamples - n; rest < m.nextBuf.RequestNbSamples {
+					m.nextBuf.RequestNbSamples = rest
+				}
+				m.pull(to, m.nextBuf)
+				ctl.apply(m.nextBuf, solo, meter, first)
+				mixed = n + m.nextBuf.MixChannelMap(samples, n, 0)
+			}
+			m.finishTransition(t)
+			return mixed
+		}
+	}
+	if !fading {
+		return mixed
+	}
+
+	resetBuffer(m.nextBuf, samples)
+	m.pull(to, m.nextBuf)
+	m.applyFade(m.nextBuf, t, true, curve)
+	ctl.apply(m.nextBuf, solo, meter, first)
+	if i := m.nextBuf.MixChannelMap(samples, 0, 0); mixed < i {
+		mixed = i
+	}
+
+	m.locker.Lock()
+	t.pos += m.nextBuf.LastNbSamples
+	done := t.pos >= t.length
+	m.locker.Unlock()
+
+	if done {
+		m.finishTransition(t)
+	}
+	return mixed
+}
+
+// 当前源剩余的时长，未知时返回 -1
+func remaining(s stream.SourceStreamer) time.Duration {
+	fs, ok := s.(stream.FileStreamer)
+	if !ok {
+		return -1
+	}
+	total := fs.TotalDuration()
+	if total <= 0 {
+		return -1
+	}
+	return total - fs.Duration()
+}
+
+// 必须持有锁
+func (m *Mixer) startFade(t *mixerTransition, fade time.Duration) {
+	if t.now && fade < mixerMinFade {
+		fade = mixerMinFade
+	}
+	t.fading = true
+	t.pos = 0
+	t.length = int(fade * time.Duration(m.format.Rate.ToInt()) / time.Second)
+	if t.length <= 0 {
+		t.length = 1
+	}
+}
+
+// pos 和 length 只由音频线程修改
+func (m *Mixer) applyFade(buf *stream.Samples, t *mixerTransition, in bool, curve dsp.FadeCurve) {
+	if buf.IsFloat32() {
+		applyFade(stream.Planar[float32](buf), buf, t, in, curve)
+	} else {
+		applyFade(stream.Planar[float64](buf), buf, t, in, curve)
+	}
+}
+
+func applyFade[T stream.Float](data [][]T, buf *stream.Samples, t *mixerTransition, in bool, curve dsp.FadeCurve) {
+	chs := int(buf.Format.Layout.Count)
+	if chs > len(data) {
+		chs = len(data)
+	}
+	for i := 0; i < buf.LastNbSamples; i++ {
+		x := float64(t.pos+i) / float64(t.length)
+		if !in {
+			x = 1 - x
+		}
+		g := T(dsp.FadeGain(curve, x))
+		for ch := 0; ch < chs; ch++ {
+			data[ch][i] *= g
+		}
+	}
+}
+
+// 切换完成，使用 to 替换 from
+func (m *Mixer) finishTransition(t *mixerTransition) {
+	m.locker.Lock()
+	// to 可能在本次处理期间被替换，使用最新的
+	to := t.to
+	var from *mixerStreamer
+	for i, ms := range m.streamers {
+		if ms.streamer == t.from {
+			from = ms
+			m.streamers[i] = to
+			break
+		}
+	}
+	if m.next == t {
+		m.next = nil
+	}
+	changed := m.decideFormat()
+	m.locker.Unlock()
+
+	if changed {
+		m.notifyFormat()
+	}
+
+	if from != nil {
+		from.unregister()
+	}
+	t.from.Close()
+
+	stream.BusMixerSwitched.Dispatch(m, t.from, to.streamer)
+}
+
+// 只读取需要的样本数，避免多余的数据被丢弃
+func resetBuffer(buf *stream.Samples, samples *stream.Samples) {
+	buf.ResetData()
+	if samples.RequestNbSamples < buf.RequestNbSamples {
+		buf.RequestNbSamples = samples.RequestNbSamples
+	}
+}
+
+func isSourceFinished(s stream.SourceStreamer) bool {
+	if fs, ok := s.(stream.FileStreamer); ok {
+		return fs.IsFinished()
+	}
+	return false
+}
+
+// 是否有源独奏，必须持有锁
+func (m *Mixer) hasSolo() bool {
+	for _, ms := range m.streamers {
+		if ms.ctl.get().Solo {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Mixer) Sources() []stream.MixerSource {
+	m.locker.Lock()
+	defer m.locker.Unlock()
+
+	list := make([]stream.MixerSource, len(m.streamers))
+	for i, ms := range m.streamers {
+		list[i] = ms.ctl.source(ms.streamer)
+	}
+	return list
+}
+
+func (m *Mixer) SetControl(id uint16, c stream.MixerControl) error {
+	if !c.IsValid() {
+		return fmt.Errorf("mixer control invalid")
+	}
+
+	m.locker.Lock()
+	defer m.locker.Unlock()
+
+	for _, ms := range m.streamers {
+		if ms.ctl.id == id {
+			ms.ctl.set(c)
+			return nil
+		}
+	}
+	return fmt.Errorf("mixer source %d not exists", id)
+}
+
+func (m *Mixer) SetMeter(on bool) {
+	m.locker.Lock()
+	defer m.locker.Unlock()
+
+	m.meter = on
+	if !on {
+		for _, ms := range m.streamers {
+			ms.ctl.clearLevels()
+		}
+	}
+}
+
+func (m *Mixer) FadeSource(s stream.SourceStreamer, in bool, d time.Duration) <-chan struct{} {
+	m.locker.Lock()
+	defer m.locker.Unlock()
+
+	for _, ms := range m.streamers {
+		if ms.streamer == s {
+			return ms.ctl.setFade(in, int(d*time.Duration(m.format.Rate.ToInt())/time.Second))
+		}
+	}
+	done := make(chan struct{})
+	close(done)
+	return done
+}
+
+func (m *Mixer) Meter() bool {
+	m.locker.Lock()
+	defer m.locker.Unlock()
+
+	return m.meter
+}
+
 func (e *Mixer) OnStarting() {
 }
 
@@ -240,10 +798,12 @@ func (m *Mixer) Close() error {
 	bus.UnregisterObj(m)
 
 	for _, ss := range m.streamers {
+		ss.unregister()
 		ss.streamer.Close()
 	}
 
 	m.Clear()
+	m.closeRetired()
 	return nil
 }
 
@@ -256,7 +816,8 @@ func (o *Mixer) Register(e string, c bus.Handler) *bus.HandlerData {
 
 func NewMixer(streamers ...stream.SourceStreamer) stream.MixerElement {
 	m := &Mixer{
-		streamers: make([]mixerStreamer, 0),
+		streamers: make([]*mixerStreamer, 0),
+		fadeCurve: dsp.EqualPowerFade,
 		buffer:    stream.NewSamplesDuration(config.AudioBuferMSDuration, audio.DefaultFormat()),
 	}
 	m.Add(streamers...)
@@ -0,0 +1,288 @@
+package element
+
+import (
+	"math"
+	"sync"
+
+	"github.com/zwcway/castserver-go/common/audio"
+	"github.com/zwcway/castserver-go/common/stream"
+)
+
+// 电平表的峰值每秒下降的 dB
+const mixerMeterDecay = 20.0
+
+// 混音器中一个源的控制，切换曲目时由新的源继承
+type mixerControl struct {
+	stream.MixerControl
+	id uint16
+
+	locker sync.Mutex
+	gains  [audio.Channel_MAX]float64 // 上一块结束时的增益，变化时逐个样本过渡
+	levels []stream.MixerLevel
+
+	// 暂停、恢复时的淡入淡出，跨越多块
+	fade       float64
+	fadeTarget float64
+	fadeStep   float64       // 每个样本的变化量
+	fadeDone   chan struct{} // 到达目标后关闭
+	fadeGains  []float64     // 本次处理的淡化增益，仅由音频线程访问
+}
+
+func newMixerControl(id uint16) *mixerControl {
+	c := &mixerControl{id: id, fade: 1, fadeTarget: 1}
+	for i := range c.gains {
+		c.gains[i] = 1
+	}
+	return c
+}
+
+// 在 n 个样本内淡入或者淡出，替换未完成的淡化
+func (c *mixerControl) setFade(in bool, n int) <-chan struct{} {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+
+	if c.fadeDone != nil {
+		close(c.fadeDone)
+	}
+	c.fadeDone = make(chan struct{})
+	c.fadeTarget = 0
+	if in {
+		c.fadeTarget = 1
+	}
+	if n <= 0 {
+		n = 1
+	}
+	c.fadeStep = math.Abs(c.fadeTarget-c.fade) / float64(n)
+	done := c.fadeDone
+	if c.fade == c.fadeTarget {
+		close(c.fadeDone)
+		c.fadeDone = nil
+	}
+	return done
+}
+
+// 新的源继承控制时从完整音量开始
+func (c *mixerControl) resetFade() {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+
+	if c.fadeDone != nil {
+		close(c.fadeDone)
+		c.fadeDone = nil
+	}
+	c.fade, c.fadeTarget = 1, 1
+}
+
+// 逐个样本推进淡化，返回每个样本的增益，没有淡化时返回空
+func (c *mixerControl) stepFade(n int, gains []float64) []float64 {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+
+	gains = gains[:0]
+	if c.fade == 1 && c.fadeTarget == 1 {
+		return gains
+	}
+	for i := 0; i < n; i++ {
+		if c.fade < c.fadeTarget {
+			c.fade = math.Min(c.fade+c.fadeStep, c.fadeTarget)
+		} else if c.fade > c.fadeTarget {
+			c.fade = math.Max(c.fade-c.fadeStep, c.fadeTarget)
+		}
+		gains = append(gains, c.fade)
+	}
+	if c.fade == c.fadeTarget && c.fadeDone != nil {
+		close(c.fadeDone)
+		c.fadeDone = nil
+	}
+	return gains
+}
+
+func (c *mixerControl) set(mc stream.MixerControl) {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+
+	c.MixerControl = mc
+}
+
+func (c *mixerControl) get() stream.MixerControl {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+
+	return c.MixerControl
+}
+
+func (c *mixerControl) source(s stream.SourceStreamer) stream.MixerSource {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+
+	return stream.MixerSource{
+		MixerControl: c.MixerControl,
+		ID:           c.id,
+		Source:       s,
+		Levels:       append([]stream.MixerLevel(nil), c.levels...),
+	}
+}
+
+func (c *mixerControl) clearLevels() {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+
+	c.levels = nil
+}
+
+// 声道的目标增益
+func mixerChannelGain(mc stream.MixerControl, ch audio.Channel, solo bool) float64 {
+	if mc.Mute || (solo && !mc.Solo) {
+		return 0
+	}
+	g := math.Pow(10, mc.Gain/20)
+	switch ch.Side() {
+	case -1:
+		if mc.Pan > 0 {
+			g *= 1 - mc.Pan
+		}
+	case 1:
+		if mc.Pan < 0 {
+			g *= 1 + mc.Pan
+		}
+	}
+	return g
+}
+
+// apply 调整 buf 的增益并测量电平。
+// solo 表示有源独奏，first 表示本次处理中该源的第一块，交叉淡化时同一个源有两块
+func (c *mixerControl) apply(buf *stream.Samples, solo bool, meter bool, first bool) {
+	var (
+		mc = c.get()
+		n  = buf.LastNbSamples
+	)
+	if n <= 0 {
+		return
+	}
+
+	if buf.IsFloat32() {
+		applyControl(c, stream.Planar[float32](buf), buf, mc, solo, first)
+	} else {
+		applyControl(c, stream.Planar[float64](buf), buf, mc, solo, first)
+	}
+
+	// 交叉淡化时同一个源的第二块不再推进
+	if first {
+		c.fadeGains = c.stepFade(n, c.fadeGains)
+	}
+	if len(c.fadeGains) >= n {
+		if buf.IsFloat32() {
+			applyFadeGains(stream.Planar[float32](buf), buf, c.fadeGains[:n])
+		} else {
+			applyFadeGains(stream.Planar[float64](buf), buf, c.fadeGains[:n])
+		}
+	}
+
+	if meter {
+		c.measure(buf, first)
+	}
+}
+
+func applyControl[T stream.Float](c *mixerControl, planar [][]T, buf *stream.Samples, mc stream.MixerControl, solo bool, first bool) {
+	n := buf.LastNbSamples
+	for ch := audio.Channel(1); ch < audio.Channel_MAX && int(ch) < len(buf.ChannelIndex); ch++ {
+		idx := int(buf.ChannelIndex[ch])
+		if idx < 0 || idx >= len(planar) || idx >= int(buf.Format.Count) {
+			continue
+		}
+		var (
+			data   = planar[idx][:n]
+			target = mixerChannelGain(mc, ch, solo)
+			from   = c.gains[ch]
+		)
+		if !first {
+			from = target
+		}
+		if from == target {
+			if target != 1 {
+				for i := range data {
+					data[i] *= T(target)
+				}
+			}
+		} else {
+			step := (target - from) / float64(n)
+			for i := range data {
+				data[i] *= T(from + step*float64(i+1))
+			}
+		}
+		c.gains[ch] = target
+	}
+}
+
+func applyFadeGains[T stream.Float](planar [][]T, buf *stream.Samples, gains []float64) {
+	chs := int(buf.Format.Count)
+	if chs > len(planar) {
+		chs = len(planar)
+	}
+	for ch := 0; ch < chs; ch++ {
+		data := planar[ch]
+		for i, g := range gains {
+			data[i] *= T(g)
+		}
+	}
+}
+
+// 测量峰值和有效值，峰值按照 mixerMeterDecay 下降
+func (c *mixerControl) measure(buf *stream.Samples, first bool) {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+
+	var (
+		n     = buf.LastNbSamples
+		chs   = buf.Format.Channels()
+		decay = 1.0
+	)
+	if rate := buf.Format.Rate.ToInt(); rate > 0 {
+		decay = math.Pow(10, -mixerMeterDecay*float64(n)/float64(rate)/20)
+	}
+	if len(c.levels) != len(chs) {
+		c.levels = make([]stream.MixerLevel, len(chs))
+	}
+
+	for i, ch := range chs {
+		lv := &c.levels[i]
+		if lv.Channel != ch {
+			*lv = stream.MixerLevel{Channel: ch}
+		}
+		idx := int(buf.ChannelIndex[ch])
+		if idx < 0 || idx >= int(buf.Format.Count) {
+			continue
+		}
+
+		var peak, sum float64
+		if buf.IsFloat32() {
+			peak, sum = measurePlanar(buf.Data32[idx][:n])
+		} else {
+			peak, sum = measurePlanar(buf.Data[idx][:n])
+		}
+		rms := math.Sqrt(sum / float64(n))
+
+		if first {
+			lv.Peak = math.Max(peak, lv.Peak*decay)
+			lv.RMS = rms
+		} else {
+			lv.Peak = math.Max(peak, lv.Peak)
+			lv.RMS = math.Max(rms, lv.RMS)
+		}
+	}
+}
+
+// 返回峰值和平方和
+func measurePlanar[T stream.Float](data []T) (peak float64, sum float64) {
+	for _, s := range data {
+		v := float64(s)
+		sum += v * v
+		if v < 0 {
+			v = -v
+		}
+		if v > peak {
+			peak = v
+		}
+	}
+	return
+}
@@ -1,11 +1,15 @@
 package element
 
 import (
+	"math"
 	"os"
 	"testing"
+	"time"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/zwcway/castserver-go/common/audio"
 	"github.com/zwcway/castserver-go/common/bus"
+	"github.com/zwcway/castserver-go/common/dsp"
 	"github.com/zwcway/castserver-go/common/stream"
 	"github.com/zwcway/castserver-go/common/utils"
 	"golang.org/x/exp/slices"
@@ -73,10 +77,306 @@ func TestMixer(t *testing.T) {
 			t.Errorf("mix same error = \n%v\n, want \n%v\n", samples.Data[0], result)
 		}
 	})
+	t.Run("format changed", func(t *testing.T) {
+		mixer := NewMixer()
+		src := &formatMixer{format: format}
+
+		// 在事件中再次调用混音器，通知时不能持有锁
+		var formats []audio.Format
+		stream.BusMixerFormatChanged.Register(mixer, func(m stream.MixerElement, f *audio.Format, _ audio.ChannelIndex) error {
+			assert.Equal(t, *f, m.Format())
+			formats = append(formats, *f)
+			return nil
+		})
+		defer mixer.Close()
+
+		mixer.Add(src)
+		if assert.Len(t, formats, 1) {
+			assert.Equal(t, audio.AudioRate_44100, formats[0].Rate)
+		}
+
+		src.format.Rate = audio.AudioRate_96000
+		src.format.Layout = audio.Layout20
+		stream.BusSourceFormatChanged.Dispatch(src, &src.format, src.format.ChannelIndex())
+		if assert.Len(t, formats, 2) {
+			assert.Equal(t, audio.AudioRate_96000, formats[1].Rate)
+			assert.Equal(t, audio.Layout20, formats[1].Layout)
+		}
+	})
+}
+
+// 格式可以改变的源
+type formatMixer struct {
+	mixer1
+	format audio.Format
+}
+
+func (f *formatMixer) AudioFormat() audio.Format { return f.format }
+
+// 有限长度的文件源，输出固定值
+type fileMixer struct {
+	mixer1
+	value  float64
+	total  int
+	pos    int
+	closed bool
+}
+
+func (f *fileMixer) Stream(samples *stream.Samples) {
+	n := 0
+	for ; n < samples.RequestNbSamples && (f.total <= 0 || f.pos < f.total); n++ {
+		samples.Data[0][n] = f.value
+		f.pos++
+	}
+	samples.BeZeroLeft(n)
+	samples.LastNbSamples = n
+}
+func (f *fileMixer) Close() error                 { f.closed = true; return nil }
+func (f *fileMixer) Len() int                     { return f.total }
+func (f *fileMixer) Position() int                { return f.pos }
+func (f *fileMixer) Seek(p time.Duration) error   { return nil }
+func (f *fileMixer) OpenFile(string) error        { return nil }
+func (f *fileMixer) CurrentFile() string          { return "" }
+func (f *fileMixer) Duration() time.Duration      { return 0 }
+func (f *fileMixer) TotalDuration() time.Duration { return 0 }
+func (f *fileMixer) SetPause(bool)                {}
+func (f *fileMixer) IsPaused() bool               { return false }
+func (f *fileMixer) IsFinished() bool             { return f.total > 0 && f.pos >= f.total }
+
+func TestMixer_Transition(t *testing.T) {
+	format := audio.Format{
+		Sample: audio.Sample{
+			Rate: audio.AudioRate_44100,
+			Bits: audio.Bits_DEFAULT,
+		},
+		Layout: audio.Layout10,
+	}
+
+	t.Run("gapless", func(t *testing.T) {
+		from := &fileMixer{value: 1, total: 12}
+		to := &fileMixer{value: 2}
+		mixer := NewMixer(from)
+		mixer.SetNext(from, to)
+
+		switched := false
+		stream.BusMixerSwitched.Register(mixer, func(m stream.MixerElement, f, t stream.SourceStreamer) error {
+			switched = f == from && t == to
+			return nil
+		})
+		// 其它模块在源上注册的事件不受切换影响
+		finished := false
+		stream.BusSourceFinished.Register(from, func(stream.SourceStreamer) error {
+			finished = true
+			return nil
+		})
+
+		samples := stream.NewSamples(8, format)
+		mixer.Stream(samples)
+		assert.Equal(t, []float64{1, 1, 1, 1, 1, 1, 1, 1}, samples.Data[0][:8])
+		// 总时长未知，已经预读下一个源的第一块
+		assert.Equal(t, 8, to.pos)
+
+		samples.ResetData()
+		mixer.Stream(samples)
+		assert.Equal(t, 8, samples.LastNbSamples)
+		assert.Equal(t, []float64{1, 1, 1, 1, 2, 2, 2, 2}, samples.Data[0][:8])
+		assert.True(t, from.closed)
+		assert.True(t, switched)
+		assert.Nil(t, mixer.Next())
+		stream.BusSourceFinished.Dispatch(from)
+		assert.True(t, finished)
+
+		samples.ResetData()
+		mixer.Stream(samples)
+		assert.Equal(t, []float64{2, 2, 2, 2, 2, 2, 2, 2}, samples.Data[0][:8])
+	})
+
+	t.Run("crossfade", func(t *testing.T) {
+		from := &fileMixer{value: 1}
+		to := &fileMixer{value: 1}
+		mixer := NewMixer(from)
+		// 立即切换时至少淡化 mixerMinFade，分三块处理
+		rate := time.Duration(mixer.Format().Rate.ToInt())
+		n := int(mixerMinFade * rate / time.Second)
+		block := n / 3
+		mixer.SetCrossfade(mixerMinFade, dsp.LinearFade)
+		mixer.Switch(from, to)
+
+		samples := stream.NewSamples(block, format)
+		samples.ResetData()
+		mixer.Stream(samples)
+		assert.False(t, from.closed)
+		assert.Equal(t, to, mixer.Next())
+
+		for i := 0; i < 2; i++ {
+			// 线性交叉淡化的增益之和为 1
+			for _, v := range samples.Data[0][:block] {
+				assert.InDelta(t, 1, v, 1e-9)
+			}
+			samples.ResetData()
+			mixer.Stream(samples)
+		}
+		assert.True(t, from.closed)
+		assert.Nil(t, mixer.Next())
+		assert.Equal(t, 3*block, to.pos)
+		assert.Equal(t, 3*block, from.pos)
+	})
+
+	t.Run("replace while fading", func(t *testing.T) {
+		from := &fileMixer{value: 1}
+		to := &fileMixer{value: 1}
+		other := &fileMixer{value: 1}
+		mixer := NewMixer(from)
+		rate := time.Duration(mixer.Format().Rate.ToInt())
+		mixer.SetCrossfade(16*time.Second/rate+time.Microsecond, dsp.LinearFade)
+		mixer.Switch(from, to)
+
+		samples := stream.NewSamples(8, format)
+		mixer.Stream(samples)
+
+		// 被替换的源由音频线程在下一次处理前关闭
+		mixer.Switch(from, other)
+		assert.False(t, to.closed)
+		assert.Equal(t, other, mixer.Next())
+
+		samples.ResetData()
+		mixer.Stream(samples)
+		assert.True(t, to.closed)
+		assert.Equal(t, 8, to.pos)
+		assert.Equal(t, 8, other.pos)
+	})
+
+	t.Run("cancel next", func(t *testing.T) {
+		from := &fileMixer{value: 1}
+		to := &fileMixer{value: 2}
+		mixer := NewMixer(from)
+		mixer.SetNext(from, to)
+		mixer.CancelNext()
+		assert.Nil(t, mixer.Next())
+
+		samples := stream.NewSamples(8, format)
+		mixer.Stream(samples)
+		assert.True(t, to.closed)
+		assert.Equal(t, 0, to.pos)
+	})
+}
+
+// 立体声源，输出固定值
+type stereoMixer struct {
+	mixer1
+	value float64
+}
+
+func (s *stereoMixer) Stream(samples *stream.Samples) {
+	for ch := 0; ch < 2; ch++ {
+		for i := 0; i < samples.RequestNbSamples; i++ {
+			samples.Data[ch][i] = s.value
+		}
+	}
+	samples.LastNbSamples = samples.RequestNbSamples
+}
+func (stereoMixer) AudioFormat() audio.Format {
+	return audio.Format{
+		Sample: audio.Sample{
+			Rate: audio.AudioRate_44100,
+			Bits: audio.Bits_DEFAULT,
+		},
+		Layout: audio.Layout20,
+	}
+}
+func (stereoMixer) ChannelIndex() audio.ChannelIndex { return audio.Layout20.ChannelIndex() }
+
+func TestMixer_Control(t *testing.T) {
+	format := audio.Format{
+		Sample: audio.Sample{
+			Rate: audio.AudioRate_44100,
+			Bits: audio.Bits_DEFAULT,
+		},
+		Layout: audio.Layout20,
+	}
+	// 增益变化的第一块逐个样本过渡，检查第二块
+	run := func(mixer stream.MixerElement) *stream.Samples {
+		samples := stream.NewSamples(8, format)
+		for i := 0; i < 2; i++ {
+			samples.ResetData()
+			mixer.Stream(samples)
+		}
+		return samples
+	}
+	left := func(s *stream.Samples) float64 { return s.Data[s.ChannelIndex[audio.Channel_FRONT_LEFT]][7] }
+	right := func(s *stream.Samples) float64 { return s.Data[s.ChannelIndex[audio.Channel_FRONT_RIGHT]][7] }
+
+	a, b := &stereoMixer{value: 1}, &stereoMixer{value: 2}
+	mixer := NewMixer(a, b)
+	srcs := mixer.Sources()
+	assert.Len(t, srcs, 2)
+	ida, idb := srcs[0].ID, srcs[1].ID
+	assert.NotEqual(t, ida, idb)
+	assert.Equal(t, 3.0, left(run(mixer)))
+
+	t.Run("mute", func(t *testing.T) {
+		assert.NoError(t, mixer.SetControl(ida, stream.MixerControl{Mute: true}))
+		out := run(mixer)
+		assert.InDelta(t, 2, left(out), 1e-9)
+		assert.NoError(t, mixer.SetControl(ida, stream.MixerControl{}))
+	})
+
+	t.Run("solo", func(t *testing.T) {
+		assert.NoError(t, mixer.SetControl(ida, stream.MixerControl{Solo: true}))
+		assert.InDelta(t, 1, left(run(mixer)), 1e-9)
+		assert.NoError(t, mixer.SetControl(ida, stream.MixerControl{}))
+	})
+
+	t.Run("gain and pan", func(t *testing.T) {
+		assert.NoError(t, mixer.SetControl(idb, stream.MixerControl{Gain: -20 * math.Log10(2), Pan: 0.5}))
+		out := run(mixer)
+		assert.InDelta(t, 1.5, left(out), 1e-9)
+		assert.InDelta(t, 2, right(out), 1e-9)
+		assert.NoError(t, mixer.SetControl(idb, stream.MixerControl{}))
+	})
+
+	t.Run("meter", func(t *testing.T) {
+		mixer.SetMeter(true)
+		run(mixer)
+		lv := mixer.Sources()[1].Levels
+		assert.Len(t, lv, 2)
+		assert.InDelta(t, 2, lv[0].Peak, 1e-9)
+		assert.InDelta(t, 2, lv[0].RMS, 1e-9)
+
+		mixer.SetMeter(false)
+		assert.Empty(t, mixer.Sources()[1].Levels)
+	})
+
+	t.Run("fade source", func(t *testing.T) {
+		rate := time.Duration(mixer.Format().Rate.ToInt())
+		done := mixer.FadeSource(a, false, 16*time.Second/rate)
+		samples := stream.NewSamples(8, format)
+		for i := 0; i < 2; i++ {
+			samples.ResetData()
+			mixer.Stream(samples)
+		}
+		// 只有 a 淡出，b 不受影响
+		assert.InDelta(t, 2, left(samples), 1e-9)
+		select {
+		case <-done:
+		default:
+			t.Fatal("fade out not finished")
+		}
+
+		done = mixer.FadeSource(a, true, 16*time.Second/rate)
+		run(mixer)
+		assert.InDelta(t, 3, left(run(mixer)), 1e-9)
+		<-done
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		assert.Error(t, mixer.SetControl(ida, stream.MixerControl{Gain: stream.MixerGainMax + 1}))
+		assert.Error(t, mixer.SetControl(ida, stream.MixerControl{Pan: -2}))
+		assert.Error(t, mixer.SetControl(idb+1, stream.MixerControl{}))
+	})
 }
 
 func TestMain(m *testing.M) {
 	bus.Init(utils.NewEmptyContext())
-	m.Run()
-	os.Exit(0)
+	os.Exit(m.Run())
 }
@@ -0,0 +1,214 @@
+package element
+
+import (
+	"fmt"
+
+	"github.com/zwcway/castserver-go/common/audio"
+	"github.com/zwcway/castserver-go/common/bus"
+	"github.com/zwcway/castserver-go/common/dsp"
+	"github.com/zwcway/castserver-go/common/stream"
+)
+
+// 纯 Go 实现的转码，依次完成位深解码、声道转换、重采样、抖动和位深编码
+type Resample struct {
+	power  bool
+	format audio.Format
+	dither dsp.DitherMode
+
+	in        audio.Format
+	out       audio.Format
+	matrix    *dsp.ChannelMatrix
+	resampler *dsp.Resampler
+	ditherer  *dsp.Ditherer
+
+	decoded [][]float64
+	mixed   [][]float64
+	rated   [][]float64
+}
+
+func (r *Resample) Name() string {
+	return "Go Resampler"
+}
+
+func (r *Resample) Type() stream.ElementType {
+	return stream.ET_WholeSamples
+}
+
+func growBuffer(buf [][]float64, chs int, n int) [][]float64 {
+	if len(buf) != chs {
+		buf = make([][]float64, chs)
+	}
+	for ch := range buf {
+		if cap(buf[ch]) < n {
+			buf[ch] = make([]float64, n)
+		}
+		buf[ch] = buf[ch][:n]
+	}
+	return buf
+}
+
+func (r *Resample) Stream(samples *stream.Samples) {
+	if !r.power || !r.format.IsValid() || samples.LastNbSamples == 0 {
+		return
+	}
+	out := r.format
+	out.InitFrom(samples.Format)
+	if samples.Format.Equal(out) {
+		return
+	}
+	if !dsp.IsBitsConvertible(samples.Format.Bits) || !dsp.IsBitsConvertible(out.Bits) {
+		samples.LastErr = fmt.Errorf("unsupported conversion from %s to %s", samples.Format.Bits, out.Bits)
+		return
+	}
+	if samples.Format != r.in || out != r.out {
+		r.init(samples.Format, out)
+	}
+
+	var (
+		n    = samples.LastNbSamples
+		in   = samples.Format
+		data [][]float64
+	)
+
+	// 解码为 float64
+	r.decoded = growBuffer(r.decoded, len(r.matrix.In), n)
+	for i, ch := range r.matrix.In {
+		si := samples.ChannelIndex[ch]
+		if si < 0 {
+			continue
+		}
+		if samples.IsFloat() {
+			copy(r.decoded[i], samples.Float64(int(si), n, r.decoded[i]))
+		} else {
+			dsp.DecodeSamples(in.Bits, samples.RawData[si][:in.SamplesSize(n)], r.decoded[i])
+		}
+	}
+	data = r.decoded
+
+	// 声道转换
+	if !r.matrix.IsIdentity() {
+		r.mixed = growBuffer(r.mixed, len(r.matrix.Out), n)
+		for o, row := range r.matrix.Gains {
+			dst := r.mixed[o]
+			for j := range dst {
+				v := 0.0
+				for i, g := range row {
+					if g != 0 {
+						v += g * data[i][j]
+					}
+				}
+				dst[j] = v
+			}
+		}
+		data = r.mixed
+	}
+
+	// 重采样
+	if r.resampler != nil {
+		r.rated = growBuffer(r.rated, len(data), r.resampler.OutputSize(n))
+		n = r.resampler.Process(data, n, r.rated)
+		data = r.rated
+	}
+
+	if r.ditherer != nil {
+		r.ditherer.Process(data, n)
+	}
+
+	// 编码至输出格式，覆盖原有数据
+	samples.Reformat(n, out)
+	for o, ch := range r.matrix.Out {
+		di := samples.ChannelIndex[ch]
+		if samples.IsFloat() {
+			samples.SetFloat64(int(di), data[o][:n])
+		} else {
+			dsp.EncodeSamples(out.Bits, data[o][:n], samples.RawData[di][:out.SamplesSize(n)])
+		}
+	}
+	samples.LastNbSamples = n
+}
+
+func (r *Resample) init(in audio.Format, out audio.Format) {
+	r.in = in
+	r.out = out
+	r.matrix = dsp.NewChannelMatrix(in.Layout, out.Layout, dsp.NoUpmix, nil)
+
+	r.resampler = nil
+	if in.Rate != out.Rate {
+		r.resampler = dsp.NewResampler(in.Rate.ToInt(), out.Rate.ToInt(), int(out.Count))
+	}
+	r.initDither()
+}
+
+func (r *Resample) initDither() {
+	r.ditherer = nil
+	if bits := dsp.DitherBits(r.out.Bits); r.dither != dsp.NoDither && bits > 0 {
+		r.ditherer = dsp.NewDitherer(r.dither, bits, r.out.Rate.ToInt(), int(r.out.Count))
+	}
+}
+
+func (r *Resample) Sample(*float64, int, int) {}
+
+func (r *Resample) OnStarting() {}
+
+func (r *Resample) OnEnding() {}
+
+func (r *Resample) OnFormatChanged(newFormat *audio.Format) {
+}
+
+func (r *Resample) On() {
+	r.power = true
+}
+
+func (r *Resample) Off() {
+	r.power = false
+}
+
+func (r *Resample) IsOn() bool {
+	return r.power
+}
+
+func (r *Resample) SetFormat(format audio.Format) {
+	if !format.IsValid() {
+		return
+	}
+	r.format = format
+}
+
+func (r *Resample) Format() audio.Format {
+	return r.format
+}
+
+func (r *Resample) SetDither(m dsp.DitherMode) {
+	if !dsp.IsDitherModeValid(m) || m == r.dither {
+		return
+	}
+	r.dither = m
+	if r.out.IsValid() {
+		r.initDither()
+	}
+}
+
+func (r *Resample) Dither() dsp.DitherMode {
+	return r.dither
+}
+
+func (r *Resample) Close() error {
+	bus.UnregisterObj(r)
+
+	r.resampler = nil
+	r.ditherer = nil
+	return nil
+}
+
+func (o *Resample) Dispatch(e string, a ...any) error {
+	return bus.DispatchObj(o, e, a...)
+}
+func (o *Resample) Register(e string, c bus.Handler) *bus.HandlerData {
+	return bus.RegisterObj(o, e, c)
+}
+
+func NewResample(format audio.Format) stream.ResampleElement {
+	r := &Resample{}
+	r.SetFormat(format)
+	return r
+}
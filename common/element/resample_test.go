@@ -0,0 +1,144 @@
+package element
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zwcway/castserver-go/common/audio"
+	"github.com/zwcway/castserver-go/common/stream"
+)
+
+// 与 decoder/resample_test.go 相同的输入
+var resampleInputF64 = []byte{
+	0x00, 0x00, 0x00, 0x80, 0xD2, 0xE3, 0x97, 0xBF, 0x00, 0x00, 0x00, 0x00, 0x9A, 0x76, 0x6C, 0x3F,
+	0x00, 0x00, 0x00, 0xA0, 0x99, 0x8F, 0xA2, 0x3F, 0x00, 0x00, 0x00, 0xE0, 0xE4, 0x18, 0xB3, 0x3F,
+	0x00, 0x00, 0x00, 0x80, 0x93, 0xEF, 0xBD, 0x3F, 0x00, 0x00, 0x00, 0xA0, 0x1D, 0x9A, 0xC4, 0x3F,
+	0x00, 0x00, 0x00, 0xC0, 0xAB, 0x16, 0xCA, 0x3F, 0x00, 0x00, 0x00, 0x20, 0x3D, 0x0A, 0xCF, 0x3F,
+	0x00, 0x00, 0x00, 0x00, 0xC5, 0x90, 0xD1, 0x3F, 0x00, 0x00, 0x00, 0xE0, 0x11, 0x12, 0xD3, 0x3F,
+	0x00, 0x00, 0x00, 0xE0, 0xBB, 0xF8, 0xD3, 0x3F, 0x00, 0x00, 0x00, 0x20, 0x0A, 0x3D, 0xD4, 0x3F,
+	0x00, 0x00, 0x00, 0xC0, 0xF5, 0xDE, 0xD3, 0x3F, 0x00, 0x00, 0x00, 0x80, 0x36, 0xE8, 0xD2, 0x3F,
+	0x00, 0x00, 0x00, 0xE0, 0x7D, 0x6E, 0xD1, 0x3F, 0x00, 0x00, 0x00, 0xE0, 0x1C, 0x1E, 0xCF, 0x3F,
+	0x00, 0x00, 0x00, 0xA0, 0x71, 0xCE, 0xCA, 0x3F, 0x00, 0x00, 0x00, 0xA0, 0xB0, 0x1B, 0xC6, 0x3F,
+	0x00, 0x00, 0x00, 0xE0, 0x73, 0x26, 0xC1, 0x3F, 0x00, 0x00, 0x00, 0x60, 0x05, 0x0F, 0xB8, 0x3F,
+}
+
+func TestResample(t *testing.T) {
+	format := func(rate audio.Rate, bits audio.Bits, layout audio.Layout) audio.Format {
+		return audio.Format{
+			Sample: audio.Sample{Rate: rate, Bits: bits},
+			Layout: layout,
+		}
+	}
+
+	t.Run("same as swresample", func(t *testing.T) {
+		r := NewResample(format(audio.AudioRate_44100, audio.Bits_S16LE, audio.Layout10))
+		r.On()
+
+		samples := stream.NewFromBytes(resampleInputF64, format(audio.AudioRate_44100, audio.Bits_64LEF, audio.Layout10))
+		r.Stream(samples)
+
+		// swresample 的输出
+		want := []byte{
+			0x04, 0xFD, 0x72, 0x00, 0xA4, 0x04, 0x8C, 0x09, 0xF8, 0x0E, 0x9A, 0x14, 0x17, 0x1A, 0x0A, 0x1F,
+			0x22, 0x23, 0x24, 0x26, 0xF1, 0x27, 0x7A, 0x28, 0xBE, 0x27, 0xD0, 0x25, 0xDD, 0x22, 0x1E, 0x1F,
+			0xCE, 0x1A, 0x1C, 0x16, 0x26, 0x11, 0x08, 0x0C,
+		}
+
+		assert.Equal(t, len(want)/2, samples.LastNbSamples)
+		assert.Equal(t, r.Format(), samples.Format)
+		assert.Equal(t, want, samples.RawData[0][:samples.LastSamplesSize()])
+	})
+
+	t.Run("rate", func(t *testing.T) {
+		rates := [][2]audio.Rate{
+			{audio.AudioRate_44100, audio.AudioRate_48000},
+			{audio.AudioRate_48000, audio.AudioRate_44100},
+			{audio.AudioRate_44100, audio.AudioRate_96000},
+			{audio.AudioRate_96000, audio.AudioRate_44100},
+		}
+		for _, rr := range rates {
+			for _, freq := range []float64{1000, 10000} {
+				var (
+					in    = format(rr[0], audio.Bits_DEFAULT, audio.Layout10)
+					r     = NewResample(format(rr[1], audio.Bits_DEFAULT, audio.Layout10))
+					inHz  = float64(rr[0].ToInt())
+					outHz = float64(rr[1].ToInt())
+					got   []float64
+					pos   int
+				)
+				r.On()
+
+				// 分段处理，输出应该连续
+				for c := 0; c < 20; c++ {
+					s := stream.NewSamples(1000, in)
+					for i := 0; i < 1000; i++ {
+						s.Data[0][i] = 0.5 * math.Sin(2*math.Pi*freq*float64(pos+i)/inHz)
+					}
+					pos += 1000
+					s.LastNbSamples = 1000
+					r.Stream(s)
+
+					assert.Equal(t, rr[1], s.Format.Rate)
+					got = append(got, s.Data[0][:s.LastNbSamples]...)
+				}
+				assert.InDelta(t, float64(pos)*outHz/inHz, len(got), 64)
+
+				// 输出与输入在时间上对齐，跳过开头的过渡
+				var e, p float64
+				for k := 500; k < len(got); k++ {
+					w := 0.5 * math.Sin(2*math.Pi*freq*float64(k)/outHz)
+					e += (got[k] - w) * (got[k] - w)
+					p += w * w
+				}
+				assert.Less(t, 10*math.Log10(e/p), -85.0, "%v %v", rr, freq)
+			}
+		}
+	})
+
+	t.Run("layout", func(t *testing.T) {
+		r := NewResample(format(audio.AudioRate_44100, audio.Bits_DEFAULT, audio.Layout20))
+		r.On()
+
+		samples := stream.NewSamples(16, format(audio.AudioRate_44100, audio.Bits_DEFAULT, audio.Layout10))
+		for i := range samples.Data[0] {
+			samples.Data[0][i] = 0.5
+		}
+		samples.LastNbSamples = 16
+		r.Stream(samples)
+
+		assert.Equal(t, audio.Layout20, samples.Format.Layout)
+		assert.InDelta(t, 0.5*math.Sqrt2/2, samples.Data[samples.ChannelIndex[audio.Channel_FRONT_LEFT]][8], 1e-9)
+		assert.InDelta(t, 0.5*math.Sqrt2/2, samples.Data[samples.ChannelIndex[audio.Channel_FRONT_RIGHT]][8], 1e-9)
+	})
+
+	t.Run("bits", func(t *testing.T) {
+		for _, bits := range []audio.Bits{audio.Bits_U8, audio.Bits_S16LE, audio.Bits_S24LE, audio.Bits_U24LE, audio.Bits_S32LE, audio.Bits_32LEF} {
+			var (
+				f      = format(audio.AudioRate_44100, audio.Bits_DEFAULT, audio.Layout10)
+				encode = NewResample(format(audio.AudioRate_44100, bits, audio.Layout10))
+				decode = NewResample(f)
+				lsb    = math.Pow(2, -float64(bits.ToInt()-1))
+			)
+			if bits == audio.Bits_32LEF {
+				lsb = 1e-7
+			}
+			encode.On()
+			decode.On()
+
+			samples := stream.NewSamples(64, f)
+			for i := range samples.Data[0] {
+				samples.Data[0][i] = math.Sin(float64(i)) * 0.9
+			}
+			samples.LastNbSamples = 64
+			encode.Stream(samples)
+			assert.Equal(t, bits, samples.Format.Bits)
+			decode.Stream(samples)
+			assert.Equal(t, audio.Bits_DEFAULT, samples.Format.Bits)
+
+			for i := 0; i < 64; i++ {
+				assert.InDelta(t, math.Sin(float64(i))*0.9, samples.Data[0][i], lsb, bits.String())
+			}
+		}
+	})
+}
@@ -0,0 +1,158 @@
+package element
+
+import (
+	"sync"
+	"time"
+
+	"github.com/zwcway/castserver-go/common/audio"
+	"github.com/zwcway/castserver-go/common/bus"
+	"github.com/zwcway/castserver-go/common/config"
+	"github.com/zwcway/castserver-go/common/stream"
+)
+
+// 低于该值的样本视为静音，约 -120dBFS
+const silenceFloor = 1e-6
+
+// Silence 静音检测元，位于管道的最后
+//
+// 连续静音超过指定时长后进入空闲，之后的元不再收到样本，直到再次有信号
+type Silence struct {
+	power bool
+
+	locker  sync.Mutex
+	timeout time.Duration
+	silent  int // 连续静音的样本数
+	idle    bool
+}
+
+func (s *Silence) Name() string {
+	return "Silence"
+}
+
+func (s *Silence) Type() stream.ElementType {
+	return stream.ET_WholeSamples
+}
+
+func (s *Silence) Stream(samples *stream.Samples) {
+	if !s.power {
+		return
+	}
+
+	var (
+		n      = samples.LastNbSamples
+		silent = n == 0 || s.isSilent(samples)
+	)
+	if n == 0 {
+		// 暂停时按照请求的长度计时
+		n = samples.RequestNbSamples
+	}
+
+	s.locker.Lock()
+	var (
+		changed bool
+		limit   = int(s.timeout * time.Duration(samples.Format.Rate.ToInt()) / time.Second)
+	)
+	switch {
+	case !silent || s.timeout <= 0:
+		s.silent = 0
+		changed = s.idle
+		s.idle = false
+	case !s.idle:
+		s.silent += n
+		changed = s.silent >= limit
+		s.idle = changed
+	}
+	idle := s.idle
+	s.locker.Unlock()
+
+	if idle {
+		samples.LastNbSamples = 0
+	}
+	if changed {
+		stream.BusSilenceChanged.Dispatch(s, idle)
+	}
+}
+
+func (s *Silence) isSilent(samples *stream.Samples) bool {
+	if samples.IsFloat32() {
+		return silentPlanar(stream.Planar[float32](samples), samples)
+	}
+	return silentPlanar(stream.Planar[float64](samples), samples)
+}
+
+func silentPlanar[T stream.Float](data [][]T, samples *stream.Samples) bool {
+	n := samples.LastNbSamples
+	for ch := 0; ch < int(samples.Format.Count) && ch < len(data); ch++ {
+		for _, v := range data[ch][:n] {
+			if v > silenceFloor || v < -silenceFloor {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (s *Silence) Sample(*float64, int, int) {}
+
+func (s *Silence) OnStarting() {}
+
+func (s *Silence) OnEnding() {}
+
+func (s *Silence) OnFormatChanged(newFormat *audio.Format) {}
+
+func (s *Silence) On() {
+	s.power = true
+}
+
+func (s *Silence) Off() {
+	s.power = false
+}
+
+func (s *Silence) IsOn() bool {
+	return s.power
+}
+
+func (s *Silence) SetTimeout(d time.Duration) {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	if d < 0 {
+		d = 0
+	}
+	s.timeout = d
+}
+
+func (s *Silence) Timeout() time.Duration {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	return s.timeout
+}
+
+func (s *Silence) IsIdle() bool {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	return s.idle
+}
+
+func (s *Silence) Close() error {
+	bus.UnregisterObj(s)
+
+	s.Off()
+	return nil
+}
+
+func (o *Silence) Dispatch(e string, a ...any) error {
+	return bus.DispatchObj(o, e, a...)
+}
+func (o *Silence) Register(e string, c bus.Handler) *bus.HandlerData {
+	return bus.RegisterObj(o, e, c)
+}
+
+func NewSilence() stream.SilenceElement {
+	return &Silence{
+		power:   true,
+		timeout: config.SilenceTimeout,
+	}
+}
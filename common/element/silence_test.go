@@ -0,0 +1,77 @@
+package element
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zwcway/castserver-go/common/audio"
+	"github.com/zwcway/castserver-go/common/stream"
+)
+
+func TestSilence(t *testing.T) {
+	for _, bits := range []audio.Bits{audio.Bits_64LEF, audio.Bits_32LEF} {
+		t.Run(bits.String(), func(t *testing.T) {
+			block := func(v float64) *stream.Samples {
+				s := stream.NewSamples(480, audio.Format{
+					Sample: audio.Sample{Rate: audio.AudioRate_48000, Bits: bits},
+					Layout: audio.Layout20,
+				})
+				s.SetFloat64(1, []float64{0, v})
+				s.LastNbSamples = 480
+				return s
+			}
+
+			s := NewSilence()
+			s.SetTimeout(100 * time.Millisecond)
+
+			var events []bool
+			stream.BusSilenceChanged.Register(s, func(_ stream.SilenceElement, idle bool) error {
+				events = append(events, idle)
+				return nil
+			})
+			defer s.Close()
+
+			// 10ms 一块，第 10 块进入空闲
+			for i := 1; i < 10; i++ {
+				b := block(0)
+				s.Stream(b)
+				assert.Equal(t, 480, b.LastNbSamples)
+				assert.False(t, s.IsIdle())
+			}
+			// 低于阈值的噪声也是静音
+			b := block(1e-7)
+			s.Stream(b)
+			assert.True(t, s.IsIdle())
+			assert.Equal(t, 0, b.LastNbSamples)
+			assert.Equal(t, []bool{true}, events)
+
+			// 暂停时保持空闲
+			b = block(0)
+			b.LastNbSamples = 0
+			s.Stream(b)
+			assert.True(t, s.IsIdle())
+
+			// 有信号时立即恢复
+			b = block(0.5)
+			s.Stream(b)
+			assert.False(t, s.IsIdle())
+			assert.Equal(t, 480, b.LastNbSamples)
+			assert.Equal(t, []bool{true, false}, events)
+
+			// 重新计时
+			for i := 1; i < 10; i++ {
+				s.Stream(block(0))
+			}
+			assert.False(t, s.IsIdle())
+
+			// 不检测
+			s.SetTimeout(0)
+			for i := 0; i < 100; i++ {
+				s.Stream(block(0))
+			}
+			assert.False(t, s.IsIdle())
+			assert.Len(t, events, 2)
+		})
+	}
+}
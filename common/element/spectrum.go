@@ -2,9 +2,12 @@ package element
 
 import (
 	"math"
+	"sync"
+	"time"
 
 	"github.com/zwcway/castserver-go/common/audio"
 	"github.com/zwcway/castserver-go/common/bus"
+	"github.com/zwcway/castserver-go/common/config"
 	"github.com/zwcway/castserver-go/common/dsp"
 	"github.com/zwcway/castserver-go/common/stream"
 )
@@ -14,17 +17,45 @@ import (
 // 192000 ~93hz
 const SpectrumCount = 2048
 
+const (
+	SpectrumMinSize = 512
+	SpectrumMaxSize = 16384
+
+	spectrumPeakDecay = 20.0 // 峰值保持结束后每秒下降的 dB
+)
+
+func IsSpectrumSizeValid(n int) bool {
+	return n >= SpectrumMinSize && n <= SpectrumMaxSize && n&(n-1) == 0
+}
+
 type Spectrum struct {
 	power bool
+	mu    sync.Mutex
+
+	size       int // 设置的 fft 长度，在下一次处理时生效
+	windowType dsp.WindowType
+	averaging  float64
+	peakHold   time.Duration
 
 	n          int       // fft 计算量
 	pos        int       // 如果样本数量少于 n
+	rate       int       // 当前的采样率
 	s          []float64 // fft 输入数据
+	im         []float64
+	plan       *dsp.FFTPlan
+	window     *dsp.Window
+	mag        []float64 // 平均后的单边幅值，满量程正弦为 1
+	peaks      []float64 // 峰值保持
+	peakAge    []float64 // 峰值已保持的秒数
 	spectrum   []float64 // 输出幅值，大小 < n/2
 	suml       float64   // 音阶绝对值求和
 	levelMeter float64   // 音阶
 	logAxis    bool
 	hasData    bool
+
+	bands     []dsp.OctaveBand
+	bandsFrac int
+	bandsRate int
 }
 
 func (r *Spectrum) Name() string {
@@ -36,11 +67,16 @@ func (r *Spectrum) Type() stream.ElementType {
 }
 
 func (r *Spectrum) zeroData() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	for i := 0; i < len(r.spectrum); i++ {
 		r.spectrum[i] = 0
 	}
 	for i := 0; i < r.n; i++ {
 		r.s[i] = 0
+		r.mag[i>>1] = 0
+		r.peaks[i>>1] = 0
 	}
 	r.levelMeter = 0
 	r.suml = 0
@@ -55,40 +91,44 @@ func (r *Spectrum) Stream(samples *stream.Samples) {
 		r.hasData = false
 		return
 	}
+	if r.n != r.size || r.window.Type != r.windowType {
+		r.init()
+	}
 
+	r.hasData = true
+	r.rate = samples.Format.Rate.ToInt()
+
+	if samples.IsFloat32() {
+		spectrumPush(r, stream.Planar[float32](samples), samples)
+	} else {
+		spectrumPush(r, stream.Planar[float64](samples), samples)
+	}
+}
+
+func spectrumPush[T stream.Float](r *Spectrum, data [][]T, samples *stream.Samples) {
 	var (
-		sam  float64
-		frac float64 // 多声道音阶求平均
-		rms  float64
-		sums float64 // 频谱求和
-		// 不同采样率下保证fft的频率宽度约小于20hz，大于20hz的采样率下求平均，模拟转码
-		c     int = 20 / (samples.Format.Rate.ToInt() / samples.LastNbSamples)
+		sam   float64
+		frac  float64 // 多声道音阶求平均
+		sums  float64 // 频谱求和
+		chs   = int(samples.Format.Count)
 		i, ch int
 	)
-	r.hasData = true
-	if c < 1 {
-		c = 1
-	}
 
-	for i = 0; i < samples.LastNbSamples && r.pos < r.n; i += c {
+	for i = 0; i < samples.LastNbSamples; i++ {
 		frac = 0
 		sums = 0
-		for ch = 0; ch < int(samples.Format.Count); ch++ {
-			// for j = 0; j < c; j++ {
-			sam = samples.Data[ch][i]
+		for ch = 0; ch < chs; ch++ {
+			sam = float64(data[ch][i])
 			sums += sam
 			if sam >= 0 {
 				frac += sam
 			} else {
 				frac += -sam
 			}
-			// }
 		}
-		frac = frac / float64(samples.Format.Count)
+		frac = frac / float64(chs)
 
-		r.s[r.pos] = sums / float64(samples.Format.Count)
-		// 加汉宁窗
-		r.s[r.pos] *= (1 - math.Cos(2*dsp.Pi*float64(r.pos)/float64(r.n-1)))
+		r.s[r.pos] = sums / float64(chs) * r.window.Coef[r.pos]
 		r.pos++
 
 		r.suml += frac * frac
@@ -96,23 +136,89 @@ func (r *Spectrum) Stream(samples *stream.Samples) {
 			// 过滤异常
 			r.suml = 0
 		}
+
+		if r.pos >= r.n {
+			r.pos = 0
+			r.analyze()
+		}
 	}
+}
+
+// 计算一帧的频谱，并更新平均值、峰值和音阶
+func (r *Spectrum) analyze() {
+	var (
+		half  = r.n >> 1
+		scale = 2 / float64(r.n)
+		dt    = float64(r.n) / float64(r.rate)
+		decay = math.Pow(10, -spectrumPeakDecay*dt/20)
+		hold  = r.peakHold.Seconds()
+		a     = r.averaging
+		v     float64
+	)
+	for i := range r.im {
+		r.im[i] = 0
+	}
+	r.plan.Forward(r.s, r.im)
 
-	if r.pos >= r.n-1 {
-		r.pos = 0
-		i = dsp.FFTN(r.s, r.n, samples.Format.Rate.ToInt(), r.logAxis)
-		if len(r.spectrum) != i {
-			r.spectrum = make([]float64, i)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := 0; i < half; i++ {
+		v = math.Sqrt(r.s[i]*r.s[i]+r.im[i]*r.im[i]) * scale
+		if v != v {
+			v = 0
+		}
+		r.mag[i] = a*r.mag[i] + (1-a)*v
+
+		if r.mag[i] >= r.peaks[i] {
+			r.peaks[i] = r.mag[i]
+			r.peakAge[i] = 0
+		} else if r.peakAge[i] += dt; r.peakAge[i] > hold {
+			r.peaks[i] = math.Max(r.mag[i], r.peaks[i]*decay)
 		}
-		copy(r.spectrum, r.s[:i])
+	}
+	r.legacySpectrum()
+
+	rms := math.Sqrt(r.suml / float64(r.n>>3))
+	rms = math.Max(0.0, rms)
+	rms = math.Min(1.0, rms)
+
+	r.levelMeter = rms
+	r.suml = 0
+}
+
+// 兼容原有输出，幅值不随 fft 长度变化
+func (r *Spectrum) legacySpectrum() {
+	var (
+		half  = r.n >> 1
+		scale = float64(SpectrumCount >> 1)
+		m     int
+	)
+	if cap(r.spectrum) < half {
+		r.spectrum = make([]float64, half)
+	}
+	r.spectrum = r.spectrum[:half]
 
-		rms = math.Sqrt(r.suml / float64(r.n>>3))
-		rms = math.Max(0.0, rms)
-		rms = math.Min(1.0, rms)
+	if !r.logAxis {
+		for i := 0; i < half; i++ {
+			r.spectrum[i] = r.mag[i] * scale
+		}
+		return
+	}
 
-		r.levelMeter = rms
-		r.suml = 0
+	for k, j := 0, 0; k < half; k = j + 1 {
+		j = int(math.Pow(float64(k), 1.01))
+		if j >= half {
+			break
+		}
+		p := 0.0
+		for i := k; i <= j; i++ {
+			p = math.Max(p, r.mag[i])
+		}
+		r.spectrum[m] = p * scale
+		m++
 	}
+	r.spectrum = r.spectrum[:m]
 }
 
 func (r *Spectrum) Sample(*float64, int, int) {}
@@ -145,6 +251,46 @@ func (r *Spectrum) LogAxis() bool {
 	return r.logAxis
 }
 
+func (r *Spectrum) SetSize(n int) {
+	if IsSpectrumSizeValid(n) {
+		r.size = n
+	}
+}
+
+func (r *Spectrum) Size() int {
+	return r.size
+}
+
+func (r *Spectrum) SetWindow(t dsp.WindowType) {
+	if dsp.IsWindowTypeValid(t) {
+		r.windowType = t
+	}
+}
+
+func (r *Spectrum) Window() dsp.WindowType {
+	return r.windowType
+}
+
+func (r *Spectrum) SetAveraging(a float64) {
+	if a >= 0 && a < 1 {
+		r.averaging = a
+	}
+}
+
+func (r *Spectrum) Averaging() float64 {
+	return r.averaging
+}
+
+func (r *Spectrum) SetPeakHold(d time.Duration) {
+	if d >= 0 {
+		r.peakHold = d
+	}
+}
+
+func (r *Spectrum) PeakHold() time.Duration {
+	return r.peakHold
+}
+
 func (r *Spectrum) LevelMeter() float64 {
 	if r.levelMeter != r.levelMeter {
 		return 0
@@ -156,6 +302,25 @@ func (r *Spectrum) Spectrum() []float64 {
 	return r.spectrum
 }
 
+func (r *Spectrum) Bands(fraction int) (levels []float64, peaks []float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.rate == 0 || !dsp.IsOctaveFractionValid(fraction) {
+		return
+	}
+	if r.bandsFrac != fraction || r.bandsRate != r.rate {
+		r.bands = dsp.OctaveBands(fraction, r.rate)
+		r.bandsFrac = fraction
+		r.bandsRate = r.rate
+	}
+
+	binHz := float64(r.rate) / float64(r.n)
+	levels = dsp.BandLevels(r.mag, binHz, r.window.ENBW, r.bands, nil)
+	peaks = dsp.BandLevels(r.peaks, binHz, r.window.ENBW, r.bands, nil)
+	return
+}
+
 func (r *Spectrum) Close() error {
 	bus.UnregisterObj(r)
 
@@ -171,16 +336,32 @@ func (o *Spectrum) Register(e string, c bus.Handler) *bus.HandlerData {
 }
 
 func (r *Spectrum) init() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.n = r.size
+	r.pos = 0
+	r.suml = 0
 	r.s = make([]float64, r.n)
-	// r.spectrum = make([]float64, r.n>>1)
+	r.im = make([]float64, r.n)
+	r.plan = dsp.NewFFTPlan(r.n)
+	r.window = dsp.NewWindow(r.windowType, r.n)
+	r.mag = make([]float64, r.n>>1)
+	r.peaks = make([]float64, r.n>>1)
+	r.peakAge = make([]float64, r.n>>1)
+	r.spectrum = r.spectrum[:0]
 }
 
 func NewSpectrum() stream.SpectrumElement {
 	s := &Spectrum{
-		power:   false,
-		n:       SpectrumCount,
-		logAxis: true,
+		power:    false,
+		size:     SpectrumCount,
+		logAxis:  true,
+		peakHold: config.SpectrumPeakHold,
 	}
+	s.SetSize(config.SpectrumSize)
+	s.SetWindow(config.SpectrumWindow)
+	s.SetAveraging(config.SpectrumAveraging)
 	s.init()
 	return s
 }
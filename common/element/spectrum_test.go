@@ -0,0 +1,104 @@
+package element
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zwcway/castserver-go/common/audio"
+	"github.com/zwcway/castserver-go/common/dsp"
+	"github.com/zwcway/castserver-go/common/stream"
+)
+
+func TestSpectrum(t *testing.T) {
+	format := audio.Format{
+		Sample: audio.Sample{
+			Rate: audio.AudioRate_48000,
+			Bits: audio.Bits_DEFAULT,
+		},
+		Layout: audio.Layout10,
+	}
+	var pos int
+	// 每次输入 1024 个样本的正弦
+	feed := func(s stream.SpectrumElement, amp float64) {
+		samples := stream.NewSamples(1024, format)
+		for i := 0; i < 1024; i++ {
+			samples.Data[0][i] = amp * math.Sin(2*math.Pi*1000*float64(pos+i)/48000)
+		}
+		pos += 1024
+		samples.LastNbSamples = 1024
+		s.Stream(samples)
+	}
+	band1k := func(levels []float64) float64 {
+		for i, b := range dsp.OctaveBands(3, 48000) {
+			if b.Center == 1000 {
+				return levels[i]
+			}
+		}
+		return 0
+	}
+
+	t.Run("size and window", func(t *testing.T) {
+		for _, size := range []int{512, 4096, 16384} {
+			for _, w := range []dsp.WindowType{dsp.HannWindow, dsp.BlackmanHarrisWindow, dsp.FlatTopWindow} {
+				if size < 4096 && w != dsp.HannWindow {
+					// 512 点的分辨率约 94hz，主瓣更宽的窗口有部分能量落在 1/3 倍频程之外
+					continue
+				}
+				s := NewSpectrum()
+				s.SetSize(size)
+				s.SetWindow(w)
+				s.SetAveraging(0)
+				s.On()
+				for i := 0; i < 2*size/1024+2; i++ {
+					feed(s, 0.5)
+				}
+
+				levels, _ := s.Bands(3)
+				assert.Len(t, levels, 31)
+				assert.InDelta(t, 0.5, band1k(levels), 0.02, "%d %d", size, w)
+			}
+		}
+
+		s := NewSpectrum()
+		s.SetSize(1000)
+		assert.Equal(t, SpectrumCount, s.Size())
+	})
+
+	t.Run("averaging and peak hold", func(t *testing.T) {
+		s := NewSpectrum()
+		s.SetSize(1024)
+		s.SetAveraging(0.5)
+		s.SetPeakHold(100 * time.Millisecond)
+		s.On()
+
+		for i := 0; i < 20; i++ {
+			feed(s, 0.5)
+		}
+		levels, peaks := s.Bands(3)
+		assert.InDelta(t, 0.5, band1k(levels), 0.02)
+		assert.InDelta(t, 0.5, band1k(peaks), 0.02)
+
+		// 平均后缓慢下降，峰值保持
+		feed(s, 0.1)
+		levels, peaks = s.Bands(3)
+		assert.InDelta(t, 0.3, band1k(levels), 0.02)
+		assert.InDelta(t, 0.5, band1k(peaks), 0.02)
+
+		// 保持时间过后峰值按 20dB/s 下降
+		for i := 0; i < 30; i++ {
+			feed(s, 0.1)
+		}
+		levels, peaks = s.Bands(3)
+		assert.InDelta(t, 0.1, band1k(levels), 0.005)
+		assert.Less(t, band1k(peaks), 0.2)
+		assert.Greater(t, band1k(peaks), 0.12)
+
+		for i := 0; i < 30; i++ {
+			feed(s, 0.1)
+		}
+		_, peaks = s.Bands(3)
+		assert.InDelta(t, 0.1, band1k(peaks), 0.005)
+	})
+}
@@ -2,9 +2,12 @@ package element
 
 import (
 	"math"
+	"sync"
+	"time"
 
 	"github.com/zwcway/castserver-go/common/audio"
 	"github.com/zwcway/castserver-go/common/bus"
+	"github.com/zwcway/castserver-go/common/config"
 	"github.com/zwcway/castserver-go/common/stream"
 )
 
@@ -14,6 +17,20 @@ type Volume struct {
 	gain   float64
 	volume float64
 	mute   bool
+
+	ramp time.Duration // 音量变化的过渡时长
+	fade time.Duration // 静音、暂停时淡入淡出的时长
+
+	faded    bool          // 已经淡出
+	fadeDone chan struct{} // 淡出完成后关闭
+
+	current  float64       // 当前的增益，逐个样本向目标过渡
+	target   float64       // 目标增益
+	step     float64       // 每个样本的增益变化量
+	duration time.Duration // 本次过渡的时长
+	changed  bool
+
+	locker sync.Mutex
 }
 
 func (v *Volume) Name() string {
@@ -25,18 +42,63 @@ func (v *Volume) Type() stream.ElementType {
 }
 
 func (v *Volume) Stream(samples *stream.Samples) {
-	if !v.power || v.gain == 1 {
+	if !v.power {
 		return
 	}
-	for ch := 0; ch < int(samples.Format.Count); ch++ {
-		for i := 0; i < samples.LastNbSamples; i++ {
-			samples.Data[ch][i] *= v.gain
+
+	v.locker.Lock()
+	if v.changed {
+		n := float64(v.duration) * float64(samples.Format.Rate.ToInt()) / float64(time.Second)
+		if n < 1 {
+			n = 1
+		}
+		v.step = (v.target - v.current) / n
+		v.changed = false
+	}
+	target := v.target
+	v.locker.Unlock()
+
+	if v.current == target {
+		if target != 1 {
+			samples.Scale(target)
+		}
+		v.onFaded()
+		return
+	}
+
+	if samples.IsFloat32() {
+		volumeRamp(v, stream.Planar[float32](samples), samples, target)
+	} else {
+		volumeRamp(v, stream.Planar[float64](samples), samples, target)
+	}
+	v.onFaded()
+}
+
+func volumeRamp[T stream.Float](v *Volume, data [][]T, samples *stream.Samples, target float64) {
+	for i := 0; i < samples.LastNbSamples; i++ {
+		v.current += v.step
+		if (v.step > 0 && v.current >= target) || (v.step <= 0 && v.current <= target) {
+			v.current = target
+		}
+		for ch := 0; ch < int(samples.Format.Count); ch++ {
+			data[ch][i] *= T(v.current)
 		}
 	}
 }
 
+// 淡出完成后通知等待者
+func (v *Volume) onFaded() {
+	v.locker.Lock()
+	defer v.locker.Unlock()
+
+	if v.fadeDone != nil && v.faded && v.current == v.target && !v.changed {
+		close(v.fadeDone)
+		v.fadeDone = nil
+	}
+}
+
 func (v *Volume) Sample(sample *float64, ch int, n int) {
-	*sample *= v.gain
+	*sample *= v.current
 }
 func (e *Volume) OnStarting() {
 }
@@ -60,17 +122,46 @@ func (r *Volume) IsOn() bool {
 }
 
 func (v *Volume) SetMute(b bool) {
+	v.locker.Lock()
+	defer v.locker.Unlock()
+
 	v.mute = b
-	v.SetVolume(v.volume)
+	v.update(v.fade)
+}
+
+func (v *Volume) SetMuteRamp(b bool, d time.Duration) {
+	v.locker.Lock()
+	defer v.locker.Unlock()
+
+	v.mute = b
+	v.update(d)
 }
 
 func (v *Volume) Mute() bool {
+	v.locker.Lock()
+	defer v.locker.Unlock()
+
 	return v.mute
 }
 
 func (v *Volume) SetVolume(p float64) {
+	v.locker.Lock()
+	defer v.locker.Unlock()
+
+	v.volume = p
+	v.update(v.ramp)
+}
+
+func (v *Volume) SetVolumeRamp(p float64, d time.Duration) {
+	v.locker.Lock()
+	defer v.locker.Unlock()
+
 	v.volume = p
+	v.update(d)
+}
 
+// 计算目标增益，并在 d 时间内过渡，必须持有锁
+func (v *Volume) update(d time.Duration) {
 	if v.mute || v.volume == 0 {
 		v.gain = 0
 	} else if v.base == 1 {
@@ -78,17 +169,88 @@ func (v *Volume) SetVolume(p float64) {
 	} else {
 		v.gain = math.Pow(v.base, v.volume)
 	}
+
+	target := v.gain
+	if v.faded {
+		target = 0
+	}
+	if target == v.target {
+		// 目标不变时保留尚未生效的过渡时长
+		return
+	}
+	v.target = target
+	v.duration = d
+	v.changed = true
 }
 
 func (v *Volume) Volume() float64 {
+	v.locker.Lock()
+	defer v.locker.Unlock()
+
 	return v.volume
 }
 
+func (v *Volume) SetRamp(ramp time.Duration, fade time.Duration) {
+	v.locker.Lock()
+	defer v.locker.Unlock()
+
+	v.ramp = ramp
+	v.fade = fade
+}
+
+func (v *Volume) Ramp() (time.Duration, time.Duration) {
+	v.locker.Lock()
+	defer v.locker.Unlock()
+
+	return v.ramp, v.fade
+}
+
+func (v *Volume) FadeOut() <-chan struct{} {
+	done := make(chan struct{})
+
+	v.locker.Lock()
+	defer v.locker.Unlock()
+
+	if !v.power {
+		v.faded = true
+		v.update(0)
+		close(done)
+		return done
+	}
+
+	if v.fadeDone != nil {
+		close(v.fadeDone)
+	}
+	v.fadeDone = done
+	v.faded = true
+	v.update(v.fade)
+	return done
+}
+
+func (v *Volume) FadeIn() {
+	v.locker.Lock()
+	defer v.locker.Unlock()
+
+	if v.fadeDone != nil {
+		close(v.fadeDone)
+		v.fadeDone = nil
+	}
+	v.faded = false
+	v.update(v.fade)
+}
+
 func (v *Volume) Close() error {
 	bus.UnregisterObj(v)
 
-	v.volume = 0
 	v.Off()
+
+	v.locker.Lock()
+	v.volume = 0
+	if v.fadeDone != nil {
+		close(v.fadeDone)
+		v.fadeDone = nil
+	}
+	v.locker.Unlock()
 	return nil
 }
 
@@ -100,9 +262,17 @@ func (o *Volume) Register(e string, c bus.Handler) *bus.HandlerData {
 }
 
 func NewVolume(vol float64) stream.VolumeElement {
-	v := &Volume{volume: vol, base: 1, power: true}
+	v := &Volume{
+		volume: vol,
+		base:   1,
+		power:  true,
+		ramp:   config.VolumeRampDuration,
+		fade:   config.VolumeFadeDuration,
+	}
 
-	v.SetVolume(vol)
+	v.update(0)
+	v.current = v.target
+	v.changed = false
 
 	return v
 }
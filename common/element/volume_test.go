@@ -0,0 +1,103 @@
+package element
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zwcway/castserver-go/common/audio"
+	"github.com/zwcway/castserver-go/common/config"
+	"github.com/zwcway/castserver-go/common/stream"
+)
+
+func TestVolume_Ramp(t *testing.T) {
+	format := audio.Format{
+		Sample: audio.Sample{
+			Rate: audio.AudioRate_44100,
+			Bits: audio.Bits_DEFAULT,
+		},
+		Layout: audio.Layout10,
+	}
+	fill := func(s *stream.Samples) {
+		for i := range s.Data[0] {
+			s.Data[0][i] = 1
+		}
+		s.LastNbSamples = s.RequestNbSamples
+	}
+	// 过渡 8 个样本
+	d := 8*time.Second/44100 + time.Microsecond
+
+	t.Run("volume", func(t *testing.T) {
+		v := NewVolume(1)
+		v.SetRamp(d, d)
+		v.SetVolume(0.5)
+
+		samples := stream.NewSamples(10, format)
+		fill(samples)
+		v.Stream(samples)
+		for i := 1; i < 8; i++ {
+			// 单调递减，没有跳变
+			assert.Less(t, samples.Data[0][i], samples.Data[0][i-1])
+			assert.Greater(t, samples.Data[0][i], 0.5)
+		}
+		assert.Equal(t, 0.5, samples.Data[0][8])
+		assert.Equal(t, 0.5, samples.Data[0][9])
+	})
+
+	t.Run("per call ramp", func(t *testing.T) {
+		v := NewVolume(1)
+		v.SetVolumeRamp(0.5, d)
+
+		samples := stream.NewSamples(10, format)
+		fill(samples)
+		v.Stream(samples)
+		assert.Greater(t, samples.Data[0][6], 0.5)
+		assert.Equal(t, 0.5, samples.Data[0][8])
+
+		// 默认的过渡时长不变
+		ramp, fade := v.Ramp()
+		assert.Equal(t, config.VolumeRampDuration, ramp)
+		assert.Equal(t, config.VolumeFadeDuration, fade)
+
+		v.SetMuteRamp(true, 0)
+		fill(samples)
+		v.Stream(samples)
+		assert.Equal(t, 0.0, samples.Data[0][0])
+	})
+
+	t.Run("fade", func(t *testing.T) {
+		v := NewVolume(1)
+		v.SetRamp(d, d)
+
+		// 第 9 个样本到达目标，分两块处理
+		done := v.FadeOut()
+		samples := stream.NewSamples(5, format)
+		fill(samples)
+		v.Stream(samples)
+		select {
+		case <-done:
+			t.Fatal("fade out finished too early")
+		default:
+		}
+
+		fill(samples)
+		v.Stream(samples)
+		select {
+		case <-done:
+		default:
+			t.Fatal("fade out not finished")
+		}
+		assert.Equal(t, 0.0, samples.Data[0][3])
+
+		// 淡出后保持静音，直到淡入
+		v.SetVolume(0.8)
+		fill(samples)
+		v.Stream(samples)
+		assert.Equal(t, 0.0, samples.Data[0][3])
+
+		v.FadeIn()
+		fill(samples)
+		v.Stream(samples)
+		assert.Greater(t, samples.Data[0][3], 0.0)
+	})
+}
@@ -0,0 +1,59 @@
+package library
+
+import (
+	"github.com/zwcway/castserver-go/common/bus"
+)
+
+// 声明事件参数列表
+var (
+	BusGetTracks     = getTracks{}
+	BusSaveTracks    = saveTracks{}
+	BusTracksDeleted = tracksDeleted{}
+	BusScanFinished  = scanFinished{}
+)
+
+type getTracks struct{}
+
+func (getTracks) Dispatch(l *[]*Track) error {
+	return bus.Dispatch("get tracks", l)
+}
+func (getTracks) Register(c func(l *[]*Track) error) *bus.HandlerData {
+	return bus.Register("get tracks", func(o any, a ...any) error {
+		return c(a[0].(*[]*Track))
+	})
+}
+
+// 添加或者更新
+type saveTracks struct{}
+
+func (saveTracks) Dispatch(l []*Track) error {
+	return bus.Dispatch("save tracks", l)
+}
+func (saveTracks) Register(c func(l []*Track) error) *bus.HandlerData {
+	return bus.Register("save tracks", func(o any, a ...any) error {
+		return c(a[0].([]*Track))
+	})
+}
+
+type tracksDeleted struct{}
+
+func (tracksDeleted) Dispatch(l []*Track) error {
+	return bus.Dispatch("tracks deleted", l)
+}
+func (tracksDeleted) Register(c func(l []*Track) error) *bus.HandlerData {
+	return bus.Register("tracks deleted", func(o any, a ...any) error {
+		return c(a[0].([]*Track))
+	})
+}
+
+// 扫描完成，参数为添加、更新和删除的数量
+type scanFinished struct{}
+
+func (scanFinished) Dispatch(added, updated, removed int) error {
+	return bus.Dispatch("library scanned", added, updated, removed)
+}
+func (scanFinished) Register(c func(added, updated, removed int) error) *bus.HandlerData {
+	return bus.Register("library scanned", func(o any, a ...any) error {
+		return c(a[0].(int), a[1].(int), a[2].(int))
+	})
+}
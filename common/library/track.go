@@ -0,0 +1,104 @@
+package library
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/exp/slices"
+)
+
+type TrackID = uint32
+
+// Track 音乐库中的一个文件
+type Track struct {
+	ID      TrackID   `gorm:"primaryKey;column:id;autoIncrement:false"`
+	Path    string    `gorm:"column:path;uniqueIndex"`
+	Folder  string    `gorm:"column:folder;index"` // 所在目录
+	Size    int64     `gorm:"column:size"`
+	ModTime time.Time `gorm:"column:mod_time"`
+
+	Title       string        `gorm:"column:title"`
+	Artist      string        `gorm:"column:artist"`
+	Album       string        `gorm:"column:album"`
+	AlbumArtist string        `gorm:"column:album_artist"`
+	Genre       string        `gorm:"column:genre"`
+	TrackNo     int           `gorm:"column:track_no"`
+	Disc        int           `gorm:"column:disc"`
+	Year        int           `gorm:"column:year"`
+	Duration    time.Duration `gorm:"column:duration"`
+
+	// 封面所在的文件，可以是文件本身（内嵌）或者目录中的图片，空表示没有封面
+	Cover string `gorm:"column:cover"`
+}
+
+// Name 没有标题时使用文件名
+func (t *Track) Name() string {
+	if t.Title != "" {
+		return t.Title
+	}
+	name := filepath.Base(t.Path)
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+// AlbumKey 专辑的艺术家，没有专辑艺术家时使用艺术家
+func (t *Track) AlbumKey() string {
+	if t.AlbumArtist != "" {
+		return t.AlbumArtist
+	}
+	return t.Artist
+}
+
+// IsChanged 文件的大小或者修改时间是否变化
+func (t *Track) IsChanged(size int64, mod time.Time) bool {
+	return t.Size != size || !t.ModTime.Equal(mod)
+}
+
+// 支持的音频文件扩展名和对应的 MIME
+var audioExts = map[string]string{
+	".mp3": "audio/mpeg", ".flac": "audio/flac", ".ogg": "audio/ogg", ".oga": "audio/ogg",
+	".opus": "audio/ogg", ".m4a": "audio/mp4", ".aac": "audio/aac", ".alac": "audio/mp4",
+	".wav": "audio/wav", ".aif": "audio/aiff", ".aiff": "audio/aiff", ".ape": "audio/x-ape",
+	".wv": "audio/x-wavpack", ".wma": "audio/x-ms-wma", ".dsf": "audio/x-dsf",
+	".dff": "audio/x-dff", ".mka": "audio/x-matroska",
+}
+
+func IsAudioFile(name string) bool {
+	return audioExts[strings.ToLower(filepath.Ext(name))] != ""
+}
+
+// MimeType 音频文件的 MIME，不支持时返回空
+func MimeType(name string) string {
+	return audioExts[strings.ToLower(filepath.Ext(name))]
+}
+
+// MimeTypes 支持的所有 MIME，已排序
+func MimeTypes() []string {
+	list := []string{}
+	for _, m := range audioExts {
+		if !slices.Contains(list, m) {
+			list = append(list, m)
+		}
+	}
+	slices.Sort(list)
+	return list
+}
+
+// 目录中作为封面的图片，按照优先级排列
+var coverNames = []string{"cover", "folder", "front", "album"}
+
+// CoverFile 返回目录中的封面图片，没有时返回空
+func CoverFile(files []string) string {
+	for _, n := range coverNames {
+		for _, f := range files {
+			ext := strings.ToLower(filepath.Ext(f))
+			if ext != ".jpg" && ext != ".jpeg" && ext != ".png" {
+				continue
+			}
+			if strings.EqualFold(strings.TrimSuffix(filepath.Base(f), filepath.Ext(f)), n) {
+				return f
+			}
+		}
+	}
+	return ""
+}
@@ -1,6 +1,7 @@
 package pipeline
 
 import (
+	"sync"
 	"time"
 
 	"github.com/zwcway/castserver-go/common/audio"
@@ -30,12 +31,18 @@ type PipeLine struct {
 	format       audio.Format
 	wholeStreams []*PipeLineStreamer
 	oneStreams   []*PipeLineStreamer
+	list         []*PipeLineStreamer // Stream 使用的副本，只在音频线程中使用
 
 	cost    time.Duration
 	maxCost time.Duration
+
+	locker sync.Mutex
 }
 
 func (p *PipeLine) Len() int {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
 	return len(p.wholeStreams) + len(p.oneStreams)
 }
 
@@ -53,11 +60,13 @@ func (p *PipeLine) Prepend(s stream.Element) {
 		cost:   0,
 	}}
 
+	p.locker.Lock()
 	// if s.Type() == stream.ET_OneSample {
 	// 	p.oneStreams = append(ps, p.wholeStreams...)
 	// } else if s.Type() == stream.ET_WholeSamples {
 	p.wholeStreams = append(ps, p.wholeStreams...)
 	// }
+	p.locker.Unlock()
 	p.append(s)
 }
 
@@ -71,11 +80,13 @@ func (p *PipeLine) Append(s ...stream.Element) {
 			stream: ss,
 			cost:   0,
 		}
+		p.locker.Lock()
 		// if ss.Type() == stream.ET_OneSample {
 		// 	p.oneStreams = append(p.oneStreams, ps)
 		// } else if ss.Type() == stream.ET_WholeSamples {
 		p.wholeStreams = append(p.wholeStreams, ps)
 		// }
+		p.locker.Unlock()
 		p.append(ss)
 	}
 }
@@ -92,6 +103,9 @@ func (p *PipeLine) append(ss stream.Element) {
 }
 
 func (p *PipeLine) Clear() {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
 	p.wholeStreams = p.wholeStreams[:0]
 	p.oneStreams = p.oneStreams[:0]
 }
@@ -120,7 +134,11 @@ func (p *PipeLine) CanRemove() bool {
 }
 
 func (p *PipeLine) Close() error {
-	for _, s := range p.wholeStreams {
+	p.locker.Lock()
+	streams := append([]*PipeLineStreamer{}, p.wholeStreams...)
+	p.locker.Unlock()
+
+	for _, s := range streams {
 		if sc, ok := s.stream.(stream.StreamCloser); ok {
 			sc.Close()
 		}
@@ -140,7 +158,12 @@ func (p *PipeLine) Stream(sample *stream.Samples) {
 		buf = p.buffer
 	}
 
-	for _, s := range p.wholeStreams {
+	// 处理期间不持有锁，元素可能再次调用管道
+	p.locker.Lock()
+	p.list = append(p.list[:0], p.wholeStreams...)
+	p.locker.Unlock()
+
+	for _, s := range p.list {
 		s.stream.OnStarting()
 	}
 
@@ -148,7 +171,7 @@ func (p *PipeLine) Stream(sample *stream.Samples) {
 		t time.Time
 		mt time.Time = time.Now()
 	)
-	for _, s := range p.wholeStreams {
+	for _, s := range p.list {
 		t = time.Now()
 		s.stream.Stream(buf)
 		s.cost = time.Since(t)
@@ -179,8 +202,25 @@ func (p *PipeLine) LastMaxCost() time.Duration {
 	return p.maxCost
 }
 
+func (p *PipeLine) Latency() (d time.Duration) {
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	for _, s := range p.wholeStreams {
+		if le, ok := s.stream.(stream.LatencyElement); ok {
+			d += le.Latency()
+		}
+	}
+	return
+}
+
 func (p *PipeLine) Streamers() []*PipeLineStreamer {
-	return append(p.oneStreams, p.wholeStreams...)
+	p.locker.Lock()
+	defer p.locker.Unlock()
+
+	list := make([]*PipeLineStreamer, 0, len(p.oneStreams)+len(p.wholeStreams))
+	list = append(list, p.oneStreams...)
+	return append(list, p.wholeStreams...)
 }
 
 func NewPipeLine(format audio.Format, eles ...stream.Element) stream.PipeLiner {
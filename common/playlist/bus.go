@@ -0,0 +1,83 @@
+package playlist
+
+import (
+	"github.com/zwcway/castserver-go/common/bus"
+)
+
+// 声明事件参数列表
+var (
+	BusGetQueues    = getQueues{}
+	BusQueueChanged = queueChanged{}
+	BusQueueDeleted = queueDeleted{}
+
+	BusGetStations    = getStations{}
+	BusSaveStation    = saveStation{}
+	BusStationDeleted = stationDeleted{}
+)
+
+type getQueues struct{}
+
+func (getQueues) Dispatch(states *[]QueueState, items *[]QueueItem) error {
+	return bus.Dispatch("get queues", states, items)
+}
+func (getQueues) Register(c func(states *[]QueueState, items *[]QueueItem) error) *bus.HandlerData {
+	return bus.Register("get queues", func(o any, a ...any) error {
+		return c(a[0].(*[]QueueState), a[1].(*[]QueueItem))
+	})
+}
+
+// 列表或者播放状态改变
+type queueChanged struct{}
+
+func (queueChanged) Dispatch(q *Queue) error {
+	return bus.DispatchObj(q, "queue changed")
+}
+func (queueChanged) Register(c func(q *Queue) error) *bus.HandlerData {
+	return bus.Register("queue changed", func(o any, a ...any) error {
+		return c(o.(*Queue))
+	})
+}
+
+type queueDeleted struct{}
+
+func (queueDeleted) Dispatch(q *Queue) error {
+	return bus.DispatchObj(q, "queue deleted")
+}
+func (queueDeleted) Register(c func(q *Queue) error) *bus.HandlerData {
+	return bus.Register("queue deleted", func(o any, a ...any) error {
+		return c(o.(*Queue))
+	})
+}
+
+type getStations struct{}
+
+func (getStations) Dispatch(l *[]*Station) error {
+	return bus.Dispatch("get stations", l)
+}
+func (getStations) Register(c func(l *[]*Station) error) *bus.HandlerData {
+	return bus.Register("get stations", func(o any, a ...any) error {
+		return c(a[0].(*[]*Station))
+	})
+}
+
+type saveStation struct{}
+
+func (saveStation) Dispatch(s *Station) error {
+	return bus.DispatchObj(s, "save station")
+}
+func (saveStation) Register(c func(s *Station) error) *bus.HandlerData {
+	return bus.Register("save station", func(o any, a ...any) error {
+		return c(o.(*Station))
+	})
+}
+
+type stationDeleted struct{}
+
+func (stationDeleted) Dispatch(s *Station) error {
+	return bus.DispatchObj(s, "station deleted")
+}
+func (stationDeleted) Register(c func(s *Station) error) *bus.HandlerData {
+	return bus.Register("station deleted", func(o any, a ...any) error {
+		return c(o.(*Station))
+	})
+}
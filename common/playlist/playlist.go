@@ -1,10 +1,11 @@
 package playlist
 
 import (
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/zwcway/castserver-go/common/audio"
-	"github.com/zwcway/castserver-go/common/bus"
 )
 
 type AudioInfo struct {
@@ -13,32 +14,53 @@ type AudioInfo struct {
 	Duration time.Duration
 	Url      string
 
-	Title  string
-	Artist string
-}
-
-type PlayList struct {
-	list    []*AudioInfo
-	current int
-}
+	Title       string
+	Artist      string
+	Album       string
+	AlbumArtist string
+	Genre       string
+	Track       int // 曲目序号
+	Disc        int
+	Year        int
 
-func (pl *PlayList) Add(url string) {
-	ai := &AudioInfo{Url: url}
+	ReadCover bool   // 是否读取内嵌的封面
+	Cover     []byte // 内嵌的封面图片
+	CoverMime string
 
-	bus.DispatchObj(pl, "get audioinfo", ai, len(pl.list))
+	ReplayGain *ReplayGain
+}
 
-	if ai.Duration > 0 {
-		pl.list = append(pl.list, ai)
+// SetTag 解析常用的标签，返回是否为已知标签
+func (ai *AudioInfo) SetTag(key, val string) bool {
+	val = strings.TrimSpace(val)
+	switch strings.ToLower(key) {
+	case "title":
+		ai.Title = val
+	case "artist":
+		ai.Artist = val
+	case "album":
+		ai.Album = val
+	case "album_artist", "albumartist":
+		ai.AlbumArtist = val
+	case "genre":
+		ai.Genre = val
+	case "track":
+		ai.Track = leadingInt(val) // 例如 "3/12"
+	case "disc":
+		ai.Disc = leadingInt(val)
+	case "date", "year":
+		ai.Year = leadingInt(val) // 例如 "2004-05-01"
+	default:
+		return false
 	}
+	return true
 }
 
-func (pl *PlayList) PlayUrl(url string) {
-	for i, ai := range pl.list {
-		if ai.Url == url {
-			pl.current = i
-
-			bus.DispatchObj(pl, "playlist current changed", ai, i)
-			return
-		}
+func leadingInt(s string) int {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
 	}
+	v, _ := strconv.Atoi(s[:i])
+	return v
 }
@@ -0,0 +1,410 @@
+package playlist
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+type ItemID = uint32
+
+// RepeatMode 循环方式
+type RepeatMode = uint8
+
+const (
+	RepeatOff RepeatMode = iota // 播放至最后一首后停止
+	RepeatOne                   // 单曲循环
+	RepeatAll                   // 列表循环
+)
+
+func IsRepeatModeValid(m RepeatMode) bool {
+	return m <= RepeatAll
+}
+
+// QueueItem 队列中的一首，ID 在线路内唯一
+type QueueItem struct {
+	LineID   uint8         `gorm:"primaryKey;autoIncrement:false;column:line_id"`
+	ID       ItemID        `gorm:"primaryKey;autoIncrement:false;column:id"`
+	Pos      int           `gorm:"column:pos"` // 在队列中的顺序
+	Url      string        `gorm:"column:url"`
+	Title    string        `gorm:"column:title"`
+	Artist   string        `gorm:"column:artist"`
+	Duration time.Duration `gorm:"column:duration"`
+}
+
+// QueueState 队列的播放状态
+type QueueState struct {
+	LineID  uint8      `gorm:"primaryKey;autoIncrement:false;column:line_id"`
+	Current ItemID     `gorm:"column:current"` // 0 表示没有播放
+	Shuffle bool       `gorm:"column:shuffle"`
+	Repeat  RepeatMode `gorm:"column:repeat"`
+}
+
+// Queue 线路的播放队列
+type Queue struct {
+	locker   sync.Mutex
+	state    QueueState
+	items    []*QueueItem
+	shuffled []ItemID // 随机播放的顺序
+	lastID   ItemID
+	prepared ItemID // 预先决定的下一首，队列改变时失效
+	rand     *rand.Rand
+}
+
+func NewQueue(line uint8) *Queue {
+	return &Queue{
+		state: QueueState{LineID: line},
+		rand:  rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// LoadQueue 使用保存的状态和列表恢复队列
+func LoadQueue(state QueueState, items []QueueItem) *Queue {
+	q := NewQueue(state.LineID)
+	q.state = state
+
+	sort.SliceStable(items, func(i, j int) bool { return items[i].Pos < items[j].Pos })
+	for i := range items {
+		it := items[i]
+		it.LineID = state.LineID
+		q.items = append(q.items, &it)
+		if it.ID > q.lastID {
+			q.lastID = it.ID
+		}
+	}
+	q.renumber()
+
+	if q.find(q.state.Current) < 0 {
+		q.state.Current = 0
+	}
+	if !IsRepeatModeValid(q.state.Repeat) {
+		q.state.Repeat = RepeatOff
+	}
+	if q.state.Shuffle {
+		q.reshuffle()
+	}
+	return q
+}
+
+func (q *Queue) Line() uint8 {
+	q.locker.Lock()
+	defer q.locker.Unlock()
+
+	return q.state.LineID
+}
+
+func (q *Queue) State() QueueState {
+	q.locker.Lock()
+	defer q.locker.Unlock()
+
+	return q.state
+}
+
+// Items 按照队列顺序返回副本
+func (q *Queue) Items() []QueueItem {
+	q.locker.Lock()
+	defer q.locker.Unlock()
+
+	items := make([]QueueItem, len(q.items))
+	for i, it := range q.items {
+		items[i] = *it
+	}
+	return items
+}
+
+func (q *Queue) Len() int {
+	q.locker.Lock()
+	defer q.locker.Unlock()
+
+	return len(q.items)
+}
+
+// Current 正在播放的一首，没有时返回 nil
+func (q *Queue) Current() *QueueItem {
+	q.locker.Lock()
+	defer q.locker.Unlock()
+
+	return q.item(q.state.Current)
+}
+
+func (q *Queue) Find(id ItemID) *QueueItem {
+	q.locker.Lock()
+	defer q.locker.Unlock()
+
+	return q.item(id)
+}
+
+// Insert 在 pos 之前插入，pos 超出范围时添加至最后，返回新的 ID
+func (q *Queue) Insert(pos int, items ...QueueItem) []ItemID {
+	q.locker.Lock()
+	defer q.locker.Unlock()
+
+	if pos < 0 || pos > len(q.items) {
+		pos = len(q.items)
+	}
+	var (
+		ids   = make([]ItemID, len(items))
+		added = make([]*QueueItem, len(items))
+	)
+	for i := range items {
+		it := items[i]
+		q.lastID++
+		it.ID = q.lastID
+		it.LineID = q.state.LineID
+		ids[i] = it.ID
+		added[i] = &it
+	}
+	q.items = append(q.items[:pos], append(added, q.items[pos:]...)...)
+	q.renumber()
+	q.prepared = 0
+
+	if q.state.Shuffle {
+		// 随机插入至正在播放的之后
+		from := q.indexOf(q.shuffled, q.state.Current) + 1
+		for _, id := range ids {
+			i := from + q.rand.Intn(len(q.shuffled)-from+1)
+			q.shuffled = append(q.shuffled[:i], append([]ItemID{id}, q.shuffled[i:]...)...)
+		}
+	}
+	return ids
+}
+
+// Add 添加至最后
+func (q *Queue) Add(items ...QueueItem) []ItemID {
+	return q.Insert(-1, items...)
+}
+
+// Move 移动至 pos，之后的依次后移
+func (q *Queue) Move(id ItemID, pos int) error {
+	q.locker.Lock()
+	defer q.locker.Unlock()
+
+	i := q.find(id)
+	if i < 0 {
+		return fmt.Errorf("queue item %d not exists", id)
+	}
+	if pos < 0 || pos >= len(q.items) {
+		pos = len(q.items) - 1
+	}
+	it := q.items[i]
+	q.items = append(q.items[:i], q.items[i+1:]...)
+	q.items = append(q.items[:pos], append([]*QueueItem{it}, q.items[pos:]...)...)
+	q.renumber()
+	q.prepared = 0
+	return nil
+}
+
+// Remove 删除后返回删除的数量，删除正在播放的一首时停止
+func (q *Queue) Remove(ids ...ItemID) int {
+	q.locker.Lock()
+	defer q.locker.Unlock()
+
+	n := 0
+	for _, id := range ids {
+		i := q.find(id)
+		if i < 0 {
+			continue
+		}
+		q.items = append(q.items[:i], q.items[i+1:]...)
+		if i = q.indexOf(q.shuffled, id); i >= 0 {
+			q.shuffled = append(q.shuffled[:i], q.shuffled[i+1:]...)
+		}
+		if q.state.Current == id {
+			q.state.Current = 0
+		}
+		n++
+	}
+	q.renumber()
+	if n > 0 {
+		q.prepared = 0
+	}
+	return n
+}
+
+func (q *Queue) Clear() {
+	q.locker.Lock()
+	defer q.locker.Unlock()
+
+	q.items = q.items[:0]
+	q.shuffled = q.shuffled[:0]
+	q.state.Current = 0
+	q.prepared = 0
+}
+
+// Play 跳转至 id，不存在时返回 nil
+func (q *Queue) Play(id ItemID) *QueueItem {
+	q.locker.Lock()
+	defer q.locker.Unlock()
+
+	it := q.item(id)
+	if it != nil {
+		q.state.Current = id
+		q.prepared = 0
+	}
+	return it
+}
+
+// Next 下一首。auto 表示当前播放结束后自动切换，此时遵循单曲循环，并使用 PrepareNext 决定的一首。
+// 没有下一首时停止并返回 nil
+func (q *Queue) Next(auto bool) *QueueItem {
+	q.locker.Lock()
+	defer q.locker.Unlock()
+
+	id := q.prepared
+	q.prepared = 0
+	if !auto || q.find(id) < 0 {
+		id = q.next(auto)
+	}
+	q.state.Current = id
+	return q.item(id)
+}
+
+// PrepareNext 预先决定自动切换的下一首，用于无缝播放，不改变正在播放的一首。
+// 没有下一首时返回 nil
+func (q *Queue) PrepareNext() *QueueItem {
+	q.locker.Lock()
+	defer q.locker.Unlock()
+
+	if q.find(q.prepared) < 0 {
+		q.prepared = q.next(true)
+	}
+	return q.item(q.prepared)
+}
+
+// 计算下一首，列表循环时可能重新随机排序，必须持有锁
+func (q *Queue) next(auto bool) ItemID {
+	if auto && q.state.Repeat == RepeatOne {
+		if q.find(q.state.Current) >= 0 {
+			return q.state.Current
+		}
+	}
+
+	order := q.order()
+	i := q.indexOf(order, q.state.Current) + 1
+	if i >= len(order) {
+		if q.state.Repeat == RepeatOff || len(order) == 0 {
+			return 0
+		}
+		if q.state.Shuffle {
+			// 新的一轮，避免连续播放同一首
+			last := q.state.Current
+			q.reshuffle()
+			if len(q.shuffled) > 1 && q.shuffled[0] == last {
+				q.shuffled[0], q.shuffled[1] = q.shuffled[1], q.shuffled[0]
+			}
+			order = q.shuffled
+		}
+		i = 0
+	}
+	return order[i]
+}
+
+// Prev 上一首，在第一首时列表循环至最后一首，否则从头播放
+func (q *Queue) Prev() *QueueItem {
+	q.locker.Lock()
+	defer q.locker.Unlock()
+
+	order := q.order()
+	if len(order) == 0 {
+		return nil
+	}
+	q.prepared = 0
+	i := q.indexOf(order, q.state.Current) - 1
+	if i < 0 {
+		if q.state.Repeat == RepeatAll && q.state.Current != 0 {
+			i = len(order) - 1
+		} else {
+			i = 0
+		}
+	}
+	q.state.Current = order[i]
+	return q.item(q.state.Current)
+}
+
+// SetShuffle 开启时正在播放的一首排在最前
+func (q *Queue) SetShuffle(b bool) {
+	q.locker.Lock()
+	defer q.locker.Unlock()
+
+	if q.state.Shuffle == b {
+		return
+	}
+	q.state.Shuffle = b
+	q.prepared = 0
+	if b {
+		q.reshuffle()
+	} else {
+		q.shuffled = nil
+	}
+}
+
+func (q *Queue) SetRepeat(m RepeatMode) error {
+	if !IsRepeatModeValid(m) {
+		return fmt.Errorf("repeat mode %d invalid", m)
+	}
+	q.locker.Lock()
+	defer q.locker.Unlock()
+
+	q.state.Repeat = m
+	q.prepared = 0
+	return nil
+}
+
+// 播放顺序，必须持有锁
+func (q *Queue) order() []ItemID {
+	if q.state.Shuffle {
+		return q.shuffled
+	}
+	ids := make([]ItemID, len(q.items))
+	for i, it := range q.items {
+		ids[i] = it.ID
+	}
+	return ids
+}
+
+func (q *Queue) reshuffle() {
+	q.shuffled = q.shuffled[:0]
+	for _, it := range q.items {
+		q.shuffled = append(q.shuffled, it.ID)
+	}
+	q.rand.Shuffle(len(q.shuffled), func(i, j int) {
+		q.shuffled[i], q.shuffled[j] = q.shuffled[j], q.shuffled[i]
+	})
+	if i := q.indexOf(q.shuffled, q.state.Current); i > 0 {
+		q.shuffled[0], q.shuffled[i] = q.shuffled[i], q.shuffled[0]
+	}
+}
+
+func (q *Queue) renumber() {
+	for i, it := range q.items {
+		it.Pos = i
+	}
+}
+
+func (q *Queue) find(id ItemID) int {
+	for i, it := range q.items {
+		if it.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (q *Queue) item(id ItemID) *QueueItem {
+	if i := q.find(id); i >= 0 {
+		it := *q.items[i]
+		return &it
+	}
+	return nil
+}
+
+func (q *Queue) indexOf(ids []ItemID, id ItemID) int {
+	for i, v := range ids {
+		if v == id {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,165 @@
+package playlist
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueue(t *testing.T) {
+	urls := func(q *Queue) []string {
+		var list []string
+		for _, it := range q.Items() {
+			list = append(list, it.Url)
+		}
+		return list
+	}
+	newQueue := func(n int) *Queue {
+		q := NewQueue(1)
+		for i := 0; i < n; i++ {
+			q.Add(QueueItem{Url: string(rune('a' + i))})
+		}
+		return q
+	}
+
+	t.Run("edit", func(t *testing.T) {
+		q := newQueue(3)
+		assert.Equal(t, []string{"a", "b", "c"}, urls(q))
+
+		ids := q.Insert(1, QueueItem{Url: "x"}, QueueItem{Url: "y"})
+		assert.Equal(t, []ItemID{4, 5}, ids)
+		assert.Equal(t, []string{"a", "x", "y", "b", "c"}, urls(q))
+		for i, it := range q.Items() {
+			assert.Equal(t, i, it.Pos)
+			assert.Equal(t, uint8(1), it.LineID)
+		}
+
+		assert.NoError(t, q.Move(1, 4))
+		assert.Equal(t, []string{"x", "y", "b", "c", "a"}, urls(q))
+		assert.NoError(t, q.Move(3, 0))
+		assert.Equal(t, []string{"c", "x", "y", "b", "a"}, urls(q))
+		assert.Error(t, q.Move(100, 0))
+
+		// 删除正在播放的一首时停止
+		q.Play(4)
+		assert.Equal(t, 2, q.Remove(4, 5, 100))
+		assert.Nil(t, q.Current())
+		assert.Equal(t, []string{"c", "b", "a"}, urls(q))
+
+		// 删除后编号不重复使用
+		assert.Equal(t, []ItemID{6}, q.Add(QueueItem{Url: "z"}))
+
+		q.Clear()
+		assert.Equal(t, 0, q.Len())
+		assert.Nil(t, q.Next(false))
+	})
+
+	t.Run("repeat", func(t *testing.T) {
+		q := newQueue(3)
+		assert.Equal(t, "a", q.Next(true).Url)
+		assert.Equal(t, "b", q.Next(true).Url)
+		assert.Equal(t, "a", q.Prev().Url)
+		assert.Equal(t, "a", q.Prev().Url)
+
+		// 单曲循环只在自动切换时生效
+		assert.NoError(t, q.SetRepeat(RepeatOne))
+		assert.Equal(t, "a", q.Next(true).Url)
+		assert.Equal(t, "b", q.Next(false).Url)
+
+		assert.NoError(t, q.SetRepeat(RepeatOff))
+		assert.Equal(t, "c", q.Next(true).Url)
+		assert.Nil(t, q.Next(true))
+		assert.Nil(t, q.Current())
+
+		assert.NoError(t, q.SetRepeat(RepeatAll))
+		q.Play(3)
+		assert.Equal(t, "a", q.Next(true).Url)
+		assert.Equal(t, "c", q.Prev().Url)
+
+		assert.Error(t, q.SetRepeat(RepeatAll+1))
+	})
+
+	t.Run("shuffle", func(t *testing.T) {
+		q := newQueue(10)
+		q.Play(5)
+		q.SetShuffle(true)
+
+		// 正在播放的一首排在最前，之后每首只播放一次
+		seen := map[string]bool{"e": true}
+		for i := 0; i < 9; i++ {
+			it := q.Next(true)
+			if assert.NotNil(t, it) {
+				assert.False(t, seen[it.Url], it.Url)
+				seen[it.Url] = true
+			}
+		}
+		assert.Len(t, seen, 10)
+		assert.Nil(t, q.Next(true))
+
+		// 列表循环时开始新的一轮
+		assert.NoError(t, q.SetRepeat(RepeatAll))
+		q.Play(1)
+		for i := 0; i < 10; i++ {
+			last := q.Current().Url
+			assert.NotEqual(t, last, q.Next(true).Url)
+		}
+
+		// 插入的项目也会播放
+		q.Insert(0, QueueItem{Url: "x"})
+		q.SetRepeat(RepeatOff)
+		found := false
+		for it := q.Next(true); it != nil; it = q.Next(true) {
+			found = found || it.Url == "x"
+		}
+		assert.True(t, found)
+
+		q.SetShuffle(false)
+		q.Play(1)
+		assert.Equal(t, "b", q.Next(false).Url)
+	})
+
+	t.Run("prepare", func(t *testing.T) {
+		q := newQueue(3)
+		q.Play(1)
+		assert.Equal(t, "b", q.PrepareNext().Url)
+		assert.Equal(t, "a", q.Current().Url)
+
+		// 随机播放时自动切换至预先决定的一首
+		q.SetShuffle(true)
+		next := q.PrepareNext()
+		assert.Equal(t, next, q.PrepareNext())
+		assert.Equal(t, next, q.Next(true))
+
+		// 队列改变后重新决定
+		q.SetShuffle(false)
+		q.Play(1)
+		assert.Equal(t, "b", q.PrepareNext().Url)
+		assert.NoError(t, q.Move(3, 1))
+		assert.Equal(t, "c", q.PrepareNext().Url)
+		assert.Equal(t, 1, q.Remove(3))
+		assert.Equal(t, "b", q.PrepareNext().Url)
+
+		// 手动切换不使用预先决定的一首
+		assert.NoError(t, q.SetRepeat(RepeatOne))
+		assert.Equal(t, "a", q.PrepareNext().Url)
+		assert.Equal(t, "b", q.Next(false).Url)
+
+		q.Clear()
+		assert.Nil(t, q.PrepareNext())
+	})
+
+	t.Run("load", func(t *testing.T) {
+		q := LoadQueue(QueueState{LineID: 2, Current: 7, Repeat: 10}, []QueueItem{
+			{ID: 7, Pos: 1, Url: "b"},
+			{ID: 3, Pos: 0, Url: "a"},
+		})
+		assert.Equal(t, []string{"a", "b"}, urls(q))
+		assert.Equal(t, "b", q.Current().Url)
+		assert.Equal(t, RepeatOff, q.State().Repeat)
+		assert.Equal(t, uint8(2), q.Items()[0].LineID)
+		assert.Equal(t, []ItemID{8}, q.Add(QueueItem{Url: "c"}))
+
+		q = LoadQueue(QueueState{LineID: 2, Current: 100}, nil)
+		assert.Nil(t, q.Current())
+	})
+}
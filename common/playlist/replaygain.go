@@ -0,0 +1,66 @@
+package playlist
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ReplayGain 音频文件中的 ReplayGain 标签
+type ReplayGain struct {
+	TrackGain float64 // dB
+	TrackPeak float64 // 线性值，0 表示未知
+	AlbumGain float64
+	AlbumPeak float64
+
+	HasTrack bool
+	HasAlbum bool
+}
+
+// SetTag 解析 replaygain_* 标签，返回是否为 ReplayGain 标签
+func (r *ReplayGain) SetTag(key, val string) bool {
+	var (
+		v   float64
+		err error
+	)
+	key = strings.ToLower(key)
+	if !strings.HasPrefix(key, "replaygain_") {
+		return false
+	}
+
+	// 例如 "-6.48 dB"
+	val = strings.TrimSpace(val)
+	val = strings.TrimSpace(strings.TrimSuffix(strings.TrimSuffix(val, "dB"), "db"))
+	if v, err = strconv.ParseFloat(val, 64); err != nil {
+		return false
+	}
+
+	switch key {
+	case "replaygain_track_gain":
+		r.TrackGain = v
+		r.HasTrack = true
+	case "replaygain_track_peak":
+		r.TrackPeak = v
+	case "replaygain_album_gain":
+		r.AlbumGain = v
+		r.HasAlbum = true
+	case "replaygain_album_peak":
+		r.AlbumPeak = v
+	default:
+		return false
+	}
+	return true
+}
+
+// Track 音轨增益，没有时使用专辑增益
+func (r *ReplayGain) Track() (gain, peak float64, ok bool) {
+	if r == nil {
+		return 0, 0, false
+	}
+	if r.HasTrack {
+		return r.TrackGain, r.TrackPeak, true
+	}
+	if r.HasAlbum {
+		return r.AlbumGain, r.AlbumPeak, true
+	}
+	return 0, 0, false
+}
@@ -0,0 +1,35 @@
+package playlist
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type StationID = uint32
+
+// Station 网络电台，支持 Icecast/Shoutcast、HLS 以及 pls/m3u 列表
+type Station struct {
+	ID    StationID `gorm:"primaryKey;column:id"`
+	Name  string    `gorm:"column:name"`
+	Url   string    `gorm:"column:url"`
+	Genre string    `gorm:"column:genre"`
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (s *Station) Check() error {
+	if strings.TrimSpace(s.Name) == "" {
+		return fmt.Errorf("station name is empty")
+	}
+	u, err := url.Parse(s.Url)
+	if err != nil {
+		return fmt.Errorf("station url invalid: %s", err.Error())
+	}
+	if u.Scheme != "http" && u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("station url must be http or https")
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package schedule
+
+import (
+	"github.com/zwcway/castserver-go/common/bus"
+)
+
+// 声明事件参数列表
+var (
+	BusGetJobs    = getJobs{}
+	BusSaveJob    = saveJob{}
+	BusJobEdited  = jobEdited{}
+	BusJobDeleted = jobDeleted{}
+)
+
+type getJobs struct{}
+
+func (getJobs) Dispatch(l *[]*Job) error {
+	return bus.Dispatch("get jobs", l)
+}
+func (getJobs) Register(c func(l *[]*Job) error) *bus.HandlerData {
+	return bus.Register("get jobs", func(o any, a ...any) error {
+		return c(a[0].(*[]*Job))
+	})
+}
+
+type saveJob struct{}
+
+func (saveJob) Dispatch(j *Job) error {
+	return bus.DispatchObj(j, "save job")
+}
+func (saveJob) Register(c func(j *Job) error) *bus.HandlerData {
+	return bus.Register("save job", func(o any, a ...any) error {
+		return c(o.(*Job))
+	})
+}
+
+type jobEdited struct{}
+
+func (jobEdited) Dispatch(j *Job, args ...any) error {
+	return bus.DispatchObj(j, "job edited", args...)
+}
+func (jobEdited) Register(c func(j *Job, args ...any) error) *bus.HandlerData {
+	return bus.Register("job edited", func(o any, a ...any) error {
+		return c(o.(*Job), a...)
+	})
+}
+
+type jobDeleted struct{}
+
+func (jobDeleted) Dispatch(j *Job) error {
+	return bus.DispatchObj(j, "job deleted")
+}
+func (jobDeleted) Register(c func(j *Job) error) *bus.HandlerData {
+	return bus.Register("job deleted", func(o any, a ...any) error {
+		return c(o.(*Job))
+	})
+}
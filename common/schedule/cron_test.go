@@ -0,0 +1,84 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCron(t *testing.T) {
+	at := func(s string) time.Time {
+		v, err := time.ParseInLocation("2006-01-02 15:04", s, time.UTC)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	tests := []struct {
+		spec string
+		from string
+		want string
+	}{
+		{"* * * * *", "2024-01-01 00:00", "2024-01-01 00:01"},
+		{"30 7 * * *", "2024-01-01 07:30", "2024-01-02 07:30"},
+		{"30 7 * * *", "2024-01-01 07:29", "2024-01-01 07:30"},
+		{"*/15 * * * *", "2024-01-01 10:16", "2024-01-01 10:30"},
+		{"0 9-17/4 * * *", "2024-01-01 13:00", "2024-01-01 17:00"},
+		{"0 8 * * mon-fri", "2024-01-05 09:00", "2024-01-08 08:00"}, // 周五之后是周一
+		{"0 10 * * 7", "2024-01-01 00:00", "2024-01-07 10:00"},
+		{"0 0 29 feb *", "2024-03-01 00:00", "2028-02-29 00:00"},
+		{"0 0 1,15 * 3", "2024-01-01 12:00", "2024-01-03 00:00"}, // 日和周满足其一
+		{"@hourly", "2024-12-31 23:59", "2025-01-01 00:00"},
+		{"0 0 31 4 *", "2024-01-01 00:00", ""},
+	}
+	for _, tt := range tests {
+		c, err := ParseCron(tt.spec)
+		if !assert.NoError(t, err, tt.spec) {
+			continue
+		}
+		got := c.Next(at(tt.from))
+		if tt.want == "" {
+			assert.True(t, got.IsZero(), tt.spec)
+			continue
+		}
+		assert.Equal(t, at(tt.want), got, tt.spec)
+	}
+
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "5-1 * * * *", "*/0 * * * *", "* * * foo *"} {
+		_, err := ParseCron(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestJobMissedRun(t *testing.T) {
+	now := time.Date(2024, 1, 2, 7, 5, 0, 0, time.Local)
+	j := &Job{
+		Cron:    "0 7 * * *",
+		Action:  JobVolume,
+		Missed:  MissedRunOnce,
+		Enabled: true,
+		LastRun: time.Date(2024, 1, 1, 7, 0, 0, 0, time.Local),
+	}
+	assert.NoError(t, j.Check())
+
+	assert.Equal(t, time.Date(2024, 1, 2, 7, 0, 0, 0, time.Local), j.MissedRun(now, 10*time.Minute))
+	assert.True(t, j.MissedRun(now, time.Minute).IsZero())
+
+	j.Grace = time.Hour
+	assert.False(t, j.MissedRun(now, time.Minute).IsZero())
+
+	j.Missed = MissedSkip
+	assert.True(t, j.MissedRun(now, time.Hour).IsZero())
+
+	// 已经执行过
+	j.Missed = MissedRunOnce
+	j.LastRun = time.Date(2024, 1, 2, 7, 0, 0, 0, time.Local)
+	assert.True(t, j.MissedRun(now, time.Hour).IsZero())
+
+	once := &Job{At: now.Add(-time.Minute), Action: JobSleep, Missed: MissedRunOnce, UpdatedAt: now.Add(-time.Hour)}
+	assert.NoError(t, once.Check())
+	assert.Equal(t, now.Add(-time.Minute), once.MissedRun(now, 10*time.Minute))
+	assert.True(t, once.Next(now).IsZero())
+}
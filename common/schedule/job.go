@@ -0,0 +1,142 @@
+package schedule
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/zwcway/castserver-go/common/speaker"
+)
+
+type JobID uint32
+
+// JobAction 定时任务的动作
+type JobAction = uint8
+
+const (
+	JobChime  JobAction = iota // 以播报的方式播放提示音，压低当前的声音
+	JobAlarm                   // 在线路上播放文件，音量从 0 渐变至设置的音量
+	JobSleep                   // 淡出后停止播放
+	JobVolume                  // 在渐变时长内调整音量
+	JobPower                   // 恢复或者停止播放
+)
+
+func IsJobActionValid(a JobAction) bool {
+	return a <= JobPower
+}
+
+// MissedPolicy 服务停止期间错过执行时间的处理方式
+type MissedPolicy = uint8
+
+const (
+	MissedSkip    MissedPolicy = iota // 忽略
+	MissedRunOnce                     // 宽限时间内错过的，启动后补执行一次
+)
+
+func IsMissedPolicyValid(p MissedPolicy) bool {
+	return p <= MissedRunOnce
+}
+
+type Job struct {
+	ID     JobID          `gorm:"primaryKey;column:id"`
+	LineID speaker.LineID `gorm:"column:line_id;index"`
+	Name   string         `gorm:"column:name"`
+
+	Cron string    `gorm:"column:cron"` // 为空时只在 At 执行一次
+	At   time.Time `gorm:"column:at"`
+
+	Action JobAction     `gorm:"column:action"`
+	Url    string        `gorm:"column:url"`    // 提示音和闹钟的文件路径或者 http 地址
+	Volume uint8         `gorm:"column:volume"` // 0 至 100
+	Ramp   time.Duration `gorm:"column:ramp"`   // 音量渐变或者淡出的时长
+	Power  bool          `gorm:"column:power"`
+
+	Missed MissedPolicy  `gorm:"column:missed"`
+	Grace  time.Duration `gorm:"column:grace"` // 补执行的宽限时间，0 表示使用配置
+
+	Enabled bool      `gorm:"column:enabled"`
+	LastRun time.Time `gorm:"column:last_run"`
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	cron *Cron `gorm:"-"`
+}
+
+func (j *Job) String() string {
+	return fmt.Sprintf("%s(%d)", j.Name, j.ID)
+}
+
+// IsOnce 是否为只执行一次的任务
+func (j *Job) IsOnce() bool {
+	return len(j.Cron) == 0
+}
+
+// Check 检查任务的设置，并解析定时表达式
+func (j *Job) Check() (err error) {
+	if !IsJobActionValid(j.Action) {
+		return fmt.Errorf("job action %d invalid", j.Action)
+	}
+	if !IsMissedPolicyValid(j.Missed) {
+		return fmt.Errorf("job missed policy %d invalid", j.Missed)
+	}
+	if j.Volume > 100 {
+		return fmt.Errorf("job volume %d invalid", j.Volume)
+	}
+	if j.Ramp < 0 || j.Grace < 0 {
+		return fmt.Errorf("job duration invalid")
+	}
+	if (j.Action == JobChime || j.Action == JobAlarm) && len(j.Url) == 0 {
+		return fmt.Errorf("job url is empty")
+	}
+
+	j.cron = nil
+	if j.IsOnce() {
+		if j.At.IsZero() {
+			return fmt.Errorf("job time is empty")
+		}
+		return nil
+	}
+	j.cron, err = ParseCron(j.Cron)
+	return
+}
+
+// Next 返回 t 之后的执行时间，没有时返回零值
+func (j *Job) Next(t time.Time) time.Time {
+	if j.IsOnce() {
+		if j.At.After(t) {
+			return j.At
+		}
+		return time.Time{}
+	}
+	if j.cron == nil {
+		var err error
+		if j.cron, err = ParseCron(j.Cron); err != nil {
+			return time.Time{}
+		}
+	}
+	return j.cron.Next(t)
+}
+
+// MissedRun 返回 now 之前错过且需要补执行的时间，没有时返回零值
+func (j *Job) MissedRun(now time.Time, grace time.Duration) time.Time {
+	if j.Missed != MissedRunOnce {
+		return time.Time{}
+	}
+	if j.Grace > 0 {
+		grace = j.Grace
+	}
+
+	from := j.LastRun
+	if from.IsZero() {
+		from = j.UpdatedAt
+	}
+	if from.Before(now.Add(-grace)) {
+		from = now.Add(-grace)
+	}
+
+	t := j.Next(from)
+	if t.IsZero() || t.After(now) {
+		return time.Time{}
+	}
+	return t
+}
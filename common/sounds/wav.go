@@ -0,0 +1,135 @@
+package sounds
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/zwcway/castserver-go/common/audio"
+)
+
+const (
+	wavFormatPCM        = 1
+	wavFormatFloat      = 3
+	wavFormatExtensible = 0xFFFE
+)
+
+// IsWAV 是否为 RIFF/WAVE 数据
+func IsWAV(data []byte) bool {
+	return len(data) >= 12 && bytes.Equal(data[0:4], []byte("RIFF")) && bytes.Equal(data[8:12], []byte("WAVE"))
+}
+
+// LayoutFromCount 按照声道数量返回默认的布局
+func LayoutFromCount(chs int) (audio.Layout, error) {
+	switch chs {
+	case 1:
+		return audio.Layout10, nil
+	case 2:
+		return audio.Layout20, nil
+	}
+	return audio.Layout{}, fmt.Errorf("unsupported channels %d", chs)
+}
+
+// Deinterleave 将交错排列的 PCM 转换为按声道平面排列，与 stream.Samples 一致
+func Deinterleave(pcm []byte, format audio.Format) []byte {
+	var (
+		chs  = int(format.Layout.Count)
+		size = format.Bits.Size()
+		n    int
+		dst  []byte
+	)
+	if chs <= 1 || size == 0 {
+		return pcm
+	}
+	n = len(pcm) / size / chs
+	dst = make([]byte, n*size*chs)
+	for i := 0; i < n; i++ {
+		for ch := 0; ch < chs; ch++ {
+			copy(dst[(ch*n+i)*size:], pcm[(i*chs+ch)*size:(i*chs+ch+1)*size])
+		}
+	}
+	return dst
+}
+
+// ParseWAV 解析 WAV 文件，返回格式和按声道平面排列的 PCM 数据
+func ParseWAV(data []byte) (format audio.Format, pcm []byte, err error) {
+	if !IsWAV(data) {
+		err = fmt.Errorf("not a wav file")
+		return
+	}
+
+	var (
+		pos      = 12
+		hasFmt   bool
+		tag      uint16
+		chs      int
+		rate     int
+		bits     int
+		chunk    string
+		chunkLen int
+	)
+	for pos+8 <= len(data) {
+		chunk = string(data[pos : pos+4])
+		chunkLen = int(binary.LittleEndian.Uint32(data[pos+4:]))
+		pos += 8
+		if chunkLen > len(data)-pos {
+			chunkLen = len(data) - pos
+		}
+
+		switch chunk {
+		case "fmt ":
+			if chunkLen < 16 {
+				err = fmt.Errorf("wav fmt chunk too short")
+				return
+			}
+			tag = binary.LittleEndian.Uint16(data[pos:])
+			chs = int(binary.LittleEndian.Uint16(data[pos+2:]))
+			rate = int(binary.LittleEndian.Uint32(data[pos+4:]))
+			bits = int(binary.LittleEndian.Uint16(data[pos+14:]))
+			if tag == wavFormatExtensible && chunkLen >= 26 {
+				tag = binary.LittleEndian.Uint16(data[pos+24:])
+			}
+			hasFmt = true
+		case "data":
+			if !hasFmt {
+				err = fmt.Errorf("wav data before fmt chunk")
+				return
+			}
+			pcm = data[pos : pos+chunkLen]
+		}
+		// 块按照偶数字节对齐
+		pos += chunkLen + chunkLen&1
+	}
+	if !hasFmt || pcm == nil {
+		err = fmt.Errorf("wav missing fmt or data chunk")
+		return
+	}
+
+	switch {
+	case tag == wavFormatPCM && bits == 8:
+		format.Bits = audio.Bits_U8
+	case tag == wavFormatPCM && bits == 16:
+		format.Bits = audio.Bits_S16LE
+	case tag == wavFormatPCM && bits == 24:
+		format.Bits = audio.Bits_S24LE
+	case tag == wavFormatPCM && bits == 32:
+		format.Bits = audio.Bits_S32LE
+	case tag == wavFormatFloat && bits == 32:
+		format.Bits = audio.Bits_32LEF
+	case tag == wavFormatFloat && bits == 64:
+		format.Bits = audio.Bits_64LEF
+	default:
+		err = fmt.Errorf("unsupported wav format %d/%d", tag, bits)
+		return
+	}
+	format.Rate = audio.NewAudioRate(rate)
+	if !format.Rate.IsValid() {
+		err = fmt.Errorf("unsupported wav rate %d", rate)
+		return
+	}
+	if format.Layout, err = LayoutFromCount(chs); err != nil {
+		return
+	}
+	pcm = Deinterleave(pcm, format)
+	return
+}
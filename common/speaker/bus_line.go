@@ -16,11 +16,16 @@ var (
 	BusLineRefresh = lineRefresh{}
 
 	BusLineInputChanged    = lineInputChanged{}
+	BusLineInputFinished   = lineInputFinished{}
 	BusLineOutputChanged   = lineOutputChanged{}
 	BusLineNameChanged     = lineNameChanged{}
 	BusLineVolumeChanged   = lineVolumeChanged{}
 	BusLineSpeakerAppended = lineSpeakerAppended{}
 	BusLineSpeakerRemoved  = lineSpeakerRemoved{}
+	BusLineLinked          = lineLinked{}
+	BusLineIdleChanged     = lineIdleChanged{}
+	BusLineClipped         = lineClipped{}
+	BusLineMetadataChanged = lineMetadataChanged{}
 )
 
 type getLines struct{}
@@ -89,6 +94,17 @@ func (lineInputChanged) Register(c func(l *Line, newSS stream.SourceStreamer) er
 	})
 }
 
+type lineInputFinished struct{}
+
+func (lineInputFinished) Dispatch(l *Line, ss stream.SourceStreamer) error {
+	return bus.DispatchObj(l, "line input finished", ss)
+}
+func (lineInputFinished) Register(c func(l *Line, ss stream.SourceStreamer) error) *bus.HandlerData {
+	return bus.Register("line input finished", func(o any, a ...any) error {
+		return c(o.(*Line), a[0].(stream.SourceStreamer))
+	})
+}
+
 type lineOutputChanged struct{}
 
 func (lineOutputChanged) Dispatch(l *Line, oldFormat *audio.Format) error {
@@ -122,6 +138,39 @@ func (lineVolumeChanged) Register(c func(l *Line, oldVol float64) error) *bus.Ha
 	})
 }
 
+type lineLinked struct{}
+
+func (lineLinked) Dispatch(l *Line, oldLeader *Line) error {
+	return bus.DispatchObj(l, "line linked", oldLeader)
+}
+func (lineLinked) Register(c func(l *Line, oldLeader *Line) error) *bus.HandlerData {
+	return bus.Register("line linked", func(o any, a ...any) error {
+		return c(o.(*Line), a[0].(*Line))
+	})
+}
+
+type lineIdleChanged struct{}
+
+func (lineIdleChanged) Dispatch(l *Line, idle bool) error {
+	return bus.DispatchObj(l, "line idle changed", idle)
+}
+func (lineIdleChanged) Register(c func(l *Line, idle bool) error) *bus.HandlerData {
+	return bus.Register("line idle changed", func(o any, a ...any) error {
+		return c(o.(*Line), a[0].(bool))
+	})
+}
+
+type lineClipped struct{}
+
+func (lineClipped) Dispatch(l *Line, clipping bool) error {
+	return bus.DispatchObj(l, "line clipped", clipping)
+}
+func (lineClipped) Register(c func(l *Line, clipping bool) error) *bus.HandlerData {
+	return bus.Register("line clipped", func(o any, a ...any) error {
+		return c(o.(*Line), a[0].(bool))
+	})
+}
+
 type lineSpeakerAppended struct{}
 
 func (lineSpeakerAppended) Dispatch(l *Line, sp *Speaker) error {
@@ -154,3 +203,14 @@ func (lineRefresh) Register(c func(l *Line) error) *bus.HandlerData {
 		return c(o.(*Line))
 	})
 }
+
+type lineMetadataChanged struct{}
+
+func (lineMetadataChanged) Dispatch(l *Line) error {
+	return bus.DispatchObj(l, "line metadata changed")
+}
+func (lineMetadataChanged) Register(c func(l *Line) error) *bus.HandlerData {
+	return bus.Register("line metadata changed", func(o any, a ...any) error {
+		return c(o.(*Line))
+	})
+}
@@ -10,6 +10,7 @@ var (
 	BusSpeakerOnline   = speakerOnline{}
 	BusSpeakerOffline  = speakerOffline{}
 	BusSpeakerReonline = speakerReonline{}
+	BusSpeakerClipped  = speakerClipped{}
 )
 
 type speakerCreated struct{}
@@ -88,3 +89,14 @@ func (speakerReonline) Register(c func(sp *Speaker) error) *bus.HandlerData {
 		return c(a[0].(*Speaker))
 	})
 }
+
+type speakerClipped struct{}
+
+func (speakerClipped) Dispatch(sp *Speaker, clipping bool) error {
+	return bus.DispatchObj(sp, "speaker clipped", clipping)
+}
+func (speakerClipped) Register(c func(sp *Speaker, clipping bool) error) *bus.HandlerData {
+	return bus.Register("speaker clipped", func(o any, a ...any) error {
+		return c(o.(*Speaker), a[0].(bool))
+	})
+}
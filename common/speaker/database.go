@@ -73,5 +73,5 @@ func (j DBChannelRoute) Value() (driver.Value, error) {
 	if len(j.R) == 0 {
 		return nil, nil
 	}
-	return jsonpack.Marshal(j)
+	return jsonpack.Marshal(j.R)
 }
@@ -8,6 +8,9 @@ import (
 
 var locker sync.Mutex
 
+// 保护线路之间的跟随关系
+var linkLocker sync.Mutex
+
 func Init() error {
 	return nil
 }
@@ -71,4 +74,16 @@ _sp_:
 		sp.init()
 		bus.Dispatch("speaker created", sp)
 	}
+
+	// 恢复线路联动
+	for _, line := range lineList {
+		if line.LeaderID == 0 {
+			continue
+		}
+		leader := FindLineByID(line.LeaderID)
+		if leader == nil || line.Follow(leader) != nil {
+			line.LeaderID = 0
+			line.Dispatch("line edited", "leader", LineID(0))
+		}
+	}
 }
@@ -3,6 +3,10 @@ package speaker
 import (
 	"errors"
 	"fmt"
+	"image"
+	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/zwcway/castserver-go/common/audio"
@@ -11,12 +15,17 @@ import (
 	"github.com/zwcway/castserver-go/common/dsp"
 	"github.com/zwcway/castserver-go/common/element"
 	"github.com/zwcway/castserver-go/common/pipeline"
+	"github.com/zwcway/castserver-go/common/playlist"
 	"github.com/zwcway/castserver-go/common/stream"
 	"github.com/zwcway/castserver-go/common/utils"
+	"golang.org/x/exp/slices"
 )
 
 var lineList []*Line = make([]*Line, 0)
 
+// LineCrossfadeMax 交叉淡化的最大时长
+const LineCrossfadeMax time.Duration = 12 * time.Second
+
 type Line struct {
 	ID       LineID `gorm:"primaryKey;column:id"`
 	LineName string `gorm:"column:name"`
@@ -28,6 +37,20 @@ type Line struct {
 	EQ      DBeqData       `gorm:"column:eq"`    // 均衡器
 	ChRoute DBChannelRoute `gorm:"column:route"` // 输出的声道路由关系表
 
+	Loudness       bool                `gorm:"column:loudness"`        // 响度标准化
+	LoudnessTarget float64             `gorm:"column:loudness_target"` // 目标响度，0 表示使用配置
+	LoudnessMode   stream.LoudnessMode `gorm:"column:loudness_mode"`
+
+	Crossfade      time.Duration `gorm:"column:crossfade"`       // 交叉淡化时长，0 表示无缝衔接
+	CrossfadeCurve dsp.FadeCurve `gorm:"column:crossfade_curve"` // 交叉淡化曲线
+
+	Upmix  dsp.UpmixMode  `gorm:"column:upmix"`  // 声道较少的输入扩展至环绕声的方式
+	Dither dsp.DitherMode `gorm:"column:dither"` // 输出位深较低时的抖动方式
+
+	LeaderID LineID `gorm:"column:leader"` // 跟随播放的主线路，0 表示不跟随
+
+	Convolver string `gorm:"column:convolver"` // 冲激响应的 WAV 文件，config.ConvolverDir 中的相对路径，空表示不使用
+
 	CreatedAt time.Time
 	UpdatedAt time.Time
 
@@ -38,6 +61,12 @@ type Line struct {
 
 	speakers []*Speaker   `gorm:"-"`
 	spsByCh  [][]*Speaker `gorm:"-"`
+	leader   *Line        `gorm:"-"`
+
+	linkPaused stream.FileStreamer // 开始跟随时暂停的输入
+
+	sourceHandlers map[stream.SourceStreamer][]*bus.HandlerData // registerSource 在每个源上注册的事件
+	sourceLocker   sync.Mutex
 }
 
 func (l *Line) String() string {
@@ -84,13 +113,63 @@ func (l *Line) AddRoute(to audio.Channel, from audio.Channel) {
 	l.changeRoute()
 }
 
+// SetRoute 设置目的声道的所有源声道及增益，from 为空时删除
+func (l *Line) SetRoute(to audio.Channel, from []audio.Channel, gains []float64) error {
+	if !to.IsValid() {
+		return fmt.Errorf("channel %d invalid", to)
+	}
+	for _, ch := range from {
+		if !ch.IsValid() {
+			return fmt.Errorf("channel %d invalid", ch)
+		}
+	}
+	if len(gains) > len(from) {
+		return fmt.Errorf("too many gains")
+	}
+
+	for i, cr := range l.ChRoute.R {
+		if cr.To != to {
+			continue
+		}
+		if len(from) == 0 {
+			utils.SliceQuickRemove(&l.ChRoute.R, i)
+		} else {
+			l.ChRoute.R[i].From = from
+			l.ChRoute.R[i].Gains = gains
+		}
+		l.changeRoute()
+		return nil
+	}
+	if len(from) == 0 {
+		return nil
+	}
+
+	l.ChRoute.R = append(l.ChRoute.R, audio.ChannelRoute{
+		From:  from,
+		To:    to,
+		Gains: gains,
+	})
+	l.changeRoute()
+	return nil
+}
+
 func (l *Line) RemoveRoute(to audio.Channel, from audio.Channel) {
 	for i, cr := range l.ChRoute.R {
 		if cr.To != to {
 			continue
 		}
 		if from.IsValid() {
-			utils.SliceQuickRemoveItem(&l.ChRoute.R[i].From, from)
+			r := &l.ChRoute.R[i]
+			if j := slices.Index(r.From, from); j >= 0 {
+				if len(r.Gains) > 0 {
+					// 保持增益和源声道一一对应
+					for len(r.Gains) < len(r.From) {
+						r.Gains = append(r.Gains, 1)
+					}
+					utils.SliceQuickRemove(&r.Gains, j)
+				}
+				utils.SliceQuickRemove(&r.From, j)
+			}
 		} else {
 			utils.SliceQuickRemove(&l.ChRoute.R, i)
 		}
@@ -100,13 +179,27 @@ func (l *Line) RemoveRoute(to audio.Channel, from audio.Channel) {
 }
 
 func (l *Line) changeRoute() {
+	l.syncRoute()
 	l.Dispatch("line edited", "route", l.ChRoute)
 }
 
 func (l *Line) syncRoute() {
+	l.Input.ChMixerEle.SetRoute(slices.Clone(l.ChRoute.R))
 	l.Dispatch("line route changed")
 }
 
+// SetUpmix 设置声道扩展方式
+func (l *Line) SetUpmix(m dsp.UpmixMode) error {
+	if !dsp.IsUpmixModeValid(m) {
+		return fmt.Errorf("upmix mode %d invalid", m)
+	}
+	l.Upmix = m
+	l.Input.ChMixerEle.SetUpmix(m)
+
+	l.Dispatch("line edited", "upmix", m)
+	return nil
+}
+
 func (l *Line) Equalizer() *dsp.EqualizerProcessor {
 	return l.EQ.Eq
 }
@@ -133,6 +226,317 @@ func (l *Line) syncEqualizer() {
 	l.Dispatch("line eq changed")
 }
 
+func (l *Line) SetLoudness(on bool, target float64, mode stream.LoudnessMode) error {
+	if target > 0 || target < dsp.LoudnessAbsoluteGate {
+		return fmt.Errorf("loudness target %f out of range", target)
+	}
+	if !mode.IsValid() {
+		return fmt.Errorf("loudness mode %d invalid", mode)
+	}
+	l.Loudness = on
+	l.LoudnessTarget = target
+	l.LoudnessMode = mode
+
+	l.syncLoudness()
+
+	l.Dispatch("line edited", "loudness", on, "loudness_target", target, "loudness_mode", mode)
+	return nil
+}
+
+func (l *Line) syncLoudness() {
+	le := l.Input.LoudnessEle
+	if l.LoudnessTarget == 0 {
+		le.SetTarget(config.LoudnessTarget)
+	} else {
+		le.SetTarget(l.LoudnessTarget)
+	}
+	le.SetMode(l.LoudnessMode)
+	if l.Loudness {
+		le.On()
+	} else {
+		le.Off()
+	}
+
+	l.Dispatch("line loudness changed")
+}
+
+// 打开新的文件后读取 ReplayGain 标签
+func (l *Line) onSourceOpened(ss stream.SourceStreamer, url string) error {
+	le := l.Input.LoudnessEle
+	le.Reset()
+
+	if ls, ok := ss.(stream.LiveStreamer); ok && ls.IsLive() {
+		// 网络电台没有回放增益，之后的标题由 BusSourceMetadata 更新
+		le.ClearTrackGain()
+		l.setMetadata(ls.Metadata())
+		return nil
+	}
+	l.setMetadata("", "")
+
+	if !isLocalFile(url) {
+		// 网络地址再次打开会阻塞，不读取标签
+		le.ClearTrackGain()
+		return nil
+	}
+
+	ai := playlist.AudioInfo{Url: url}
+	if err := bus.Dispatch("get audioinfo", &ai); err != nil {
+		le.ClearTrackGain()
+		return err
+	}
+	l.setMetadata(ai.Title, ai.Artist)
+	if gain, peak, ok := ai.ReplayGain.Track(); ok {
+		le.SetTrackGain(gain, peak)
+	} else {
+		le.ClearTrackGain()
+	}
+	return nil
+}
+
+// 本地文件路径或者 file:// 地址
+func isLocalFile(url string) bool {
+	i := strings.Index(url, "://")
+	if i <= 0 {
+		return true
+	}
+	return strings.EqualFold(url[:i], "file")
+}
+
+// SetConvolver 加载冲激响应文件作用于所有声道，file 为空时关闭
+func (l *Line) SetConvolver(file string) error {
+	ce := l.Input.ConvolverEle
+	if file == "" {
+		ce.Off()
+		ce.Clear(audio.Channel_NONE)
+	} else {
+		p, err := convolverPath(file)
+		if err != nil {
+			return err
+		}
+		if err = ce.LoadFile(audio.Channel_NONE, p); err != nil {
+			return err
+		}
+		ce.On()
+	}
+	l.Convolver = file
+
+	l.Dispatch("line edited", "convolver", file)
+	return nil
+}
+
+// 文件已经不存在时保持关闭，不清除设置
+func (l *Line) syncConvolver() {
+	if l.Convolver == "" {
+		return
+	}
+	p, err := convolverPath(l.Convolver)
+	if err != nil {
+		return
+	}
+	if err = l.Input.ConvolverEle.LoadFile(audio.Channel_NONE, p); err == nil {
+		l.Input.ConvolverEle.On()
+	}
+}
+
+// 冲激响应文件只能在 config.ConvolverDir 之中，不能使用绝对路径和 ..
+func convolverPath(file string) (string, error) {
+	if config.ConvolverDir == "" {
+		return "", errors.New("convolver dir not configured")
+	}
+	if !filepath.IsLocal(file) {
+		return "", fmt.Errorf("convolver file %q invalid", file)
+	}
+	return filepath.Join(config.ConvolverDir, file), nil
+}
+
+func (l *Line) SetCrossfade(d time.Duration, curve dsp.FadeCurve) error {
+	if d < 0 || d > LineCrossfadeMax {
+		return fmt.Errorf("crossfade %s out of range", d.String())
+	}
+	if !dsp.IsFadeCurveValid(curve) {
+		return fmt.Errorf("crossfade curve %d invalid", curve)
+	}
+	l.Crossfade = d
+	l.CrossfadeCurve = curve
+
+	l.Input.MixerEle.SetCrossfade(d, curve)
+
+	l.Dispatch("line edited", "crossfade", d, "crossfade_curve", curve)
+	return nil
+}
+
+// SetDither 设置降低位深时的抖动方式，由推送时的转码元使用
+func (l *Line) SetDither(m dsp.DitherMode) error {
+	if !dsp.IsDitherModeValid(m) {
+		return fmt.Errorf("dither mode %d invalid", m)
+	}
+	l.Dither = m
+
+	l.Dispatch("line edited", "dither", m)
+	return nil
+}
+
+// Follow 跟随 leader 播放，使用主线路解码的样本，保留自身的均衡器、音量和声道路由。
+// leader 为 nil 时取消跟随，立即恢复自身的输入
+func (l *Line) Follow(leader *Line) error {
+	linkLocker.Lock()
+	if leader == l.leader {
+		linkLocker.Unlock()
+		return nil
+	}
+
+	var ele stream.LinkElement
+	if leader != nil {
+		if leader.isDeleted {
+			linkLocker.Unlock()
+			return &UnknownLineError{leader.ID}
+		}
+		ele = leader.Input.LinkEle
+	}
+	if err := l.Input.LinkEle.Follow(ele); err != nil {
+		linkLocker.Unlock()
+		return err
+	}
+
+	old := l.leader
+	l.leader = leader
+	l.LeaderID = 0
+	if leader != nil {
+		l.LeaderID = leader.ID
+	}
+	linkLocker.Unlock()
+
+	l.pauseInput(leader != nil)
+
+	l.Dispatch("line edited", "leader", l.LeaderID)
+	BusLineLinked.Dispatch(l, old)
+	return nil
+}
+
+// 跟随期间自身的输入不会被使用，暂停解码，取消跟随时恢复
+func (l *Line) pauseInput(pause bool) {
+	if pause {
+		fs := l.Input.FileStreamer()
+		if l.linkPaused == nil && fs != nil && !fs.IsPaused() && !fs.IsFinished() {
+			l.linkPaused = fs
+			fs.SetPause(true)
+		}
+		return
+	}
+
+	fs := l.linkPaused
+	l.linkPaused = nil
+	if fs != nil && fs == l.Input.FileStreamer() && fs.IsPaused() {
+		fs.SetPause(false)
+	}
+}
+
+// Leader 跟随的主线路
+func (l *Line) Leader() *Line {
+	linkLocker.Lock()
+	defer linkLocker.Unlock()
+
+	return l.leader
+}
+
+// Followers 跟随该线路的线路
+func (l *Line) Followers() []*Line {
+	linkLocker.Lock()
+	defer linkLocker.Unlock()
+
+	lines := []*Line{}
+	for _, ll := range lineList {
+		if ll.leader == l {
+			lines = append(lines, ll)
+		}
+	}
+	return lines
+}
+
+// SwitchInput 从当前的文件切换至 fs，按照交叉淡化设置过渡
+func (l *Line) SwitchInput(fs stream.FileStreamer) {
+	l.Input.MixerEle.Switch(l.Input.FileStreamer(), fs)
+}
+
+// SetNextInput 当前文件结束后播放 fs
+func (l *Line) SetNextInput(fs stream.FileStreamer) {
+	l.Input.MixerEle.SetNext(l.Input.FileStreamer(), fs)
+}
+
+func (l *Line) registerSource(ss stream.SourceStreamer) {
+	hds := []*bus.HandlerData{
+		stream.BusSourceOpened.Register(ss, l.onSourceOpened).ASync(),
+		stream.BusSourcePause.Register(ss, l.onSourcePause).ASync(),
+		stream.BusSourceFinished.Register(ss, func(ss stream.SourceStreamer) error {
+			return BusLineInputFinished.Dispatch(l, ss)
+		}).ASync(),
+		stream.BusSourceMetadata.Register(ss, func(ss stream.SourceStreamer, title string, artist string) error {
+			l.setMetadata(title, artist)
+			return nil
+		}).ASync(),
+	}
+
+	l.sourceLocker.Lock()
+	defer l.sourceLocker.Unlock()
+
+	if l.sourceHandlers == nil {
+		l.sourceHandlers = make(map[stream.SourceStreamer][]*bus.HandlerData)
+	}
+	l.sourceHandlers[ss] = append(l.sourceHandlers[ss], hds...)
+}
+
+// 注销 registerSource 注册的事件，源被替换或者移除时调用。
+// 混音器等其它模块在该源上注册的事件由它们自己注销
+func (l *Line) unregisterSource(ss stream.SourceStreamer) {
+	if ss == nil {
+		return
+	}
+	l.sourceLocker.Lock()
+	hds := l.sourceHandlers[ss]
+	delete(l.sourceHandlers, ss)
+	l.sourceLocker.Unlock()
+
+	for _, hd := range hds {
+		bus.UnregisterHandler(hd)
+	}
+}
+
+func (l *Line) setMetadata(title string, artist string) {
+	if l.Input.Title == title && l.Input.Artist == artist {
+		return
+	}
+	l.Input.Title = title
+	l.Input.Artist = artist
+	BusLineMetadataChanged.Dispatch(l)
+}
+
+// 暂停时只淡出该源，恢复时淡入，不影响其它源和播报。
+// 源在淡出期间继续解码
+func (l *Line) onSourcePause(ss stream.SourceStreamer, pause bool) error {
+	l.Input.MixerEle.FadeSource(ss, !pause, config.VolumeFadeDuration)
+	return nil
+}
+
+// 混音器完成曲目切换
+func (l *Line) onInputSwitched(m stream.MixerElement, from stream.SourceStreamer, to stream.SourceStreamer) error {
+	l.unregisterSource(from)
+	l.Input.ReplaceSource(from, to)
+	l.registerSource(to)
+
+	BusLineInputChanged.Dispatch(l, to)
+
+	if fs, ok := to.(stream.FileStreamer); ok {
+		stream.BusSourceOpened.Dispatch(fs, fs.CurrentFile())
+	}
+	return nil
+}
+
+// 连续静音进入空闲，或者从空闲恢复
+func (l *Line) onSilenceChanged(s stream.SilenceElement, idle bool) error {
+	BusLineIdleChanged.Dispatch(l, idle)
+	return nil
+}
+
 func (l *Line) Speakers() []*Speaker {
 	return l.speakers
 }
@@ -179,6 +583,7 @@ func (l *Line) SetOutput(f audio.Format) {
 
 	old := l.Output
 	l.Output = f
+	l.Input.ChMixerEle.SetLayout(f.Layout)
 
 	for _, sp := range l.speakers {
 		sp.SetSample(f.Sample)
@@ -188,6 +593,16 @@ func (l *Line) SetOutput(f audio.Format) {
 }
 
 func (l *Line) SetVolume(vol uint8, mute bool) {
+	ramp, fade := l.Input.VolumeEle.Ramp()
+	l.setVolume(vol, mute, ramp, fade)
+}
+
+// SetVolumeRamp 与 SetVolume 相同，音量和静音的变化在 d 内过渡
+func (l *Line) SetVolumeRamp(vol uint8, mute bool, d time.Duration) {
+	l.setVolume(vol, mute, d, d)
+}
+
+func (l *Line) setVolume(vol uint8, mute bool, ramp time.Duration, fade time.Duration) {
 	old := l.Input.VolumeEle.Volume()
 
 	args := []any{}
@@ -201,8 +616,8 @@ func (l *Line) SetVolume(vol uint8, mute bool) {
 	}
 	BusLineEdited.Dispatch(l, args...)
 
-	l.Input.VolumeEle.SetVolume(float64(vol) / 100)
-	l.Input.VolumeEle.SetMute(mute)
+	l.Input.VolumeEle.SetVolumeRamp(float64(vol)/100, ramp)
+	l.Input.VolumeEle.SetMuteRamp(mute, fade)
 
 	BusLineVolumeChanged.Dispatch(l, old)
 }
@@ -255,8 +670,11 @@ func (l *Line) decideOutputFormat() audio.Format {
 	// 	format.Bits = l.Output.Bits
 	// }
 
+	// 多个扬声器可以使用同一个声道
 	for _, sp := range l.speakers {
-		channels = append(channels, sp.SampleChannel())
+		if ch := sp.SampleChannel(); !slices.Contains(channels, ch) {
+			channels = append(channels, ch)
+		}
 	}
 	format.Layout = audio.NewLayout(channels...)
 
@@ -268,10 +686,35 @@ func (l *Line) IsDeleted() bool {
 }
 
 func (l *Line) ApplyInput(ss stream.SourceStreamer) {
+	if _, ok := ss.(stream.FileStreamer); ok && l.Input.FileStreamer() != ss {
+		l.unregisterSource(l.Input.FileStreamer())
+	} else if _, ok := ss.(stream.ReceiverStreamer); ok && l.Input.ReceiverStreamer() != ss {
+		l.unregisterSource(l.Input.ReceiverStreamer())
+	}
 	l.Input.ApplySource(ss)
+	l.registerSource(ss)
+	l.Input.VolumeEle.FadeIn()
 	BusLineInputChanged.Dispatch(l, ss)
 }
 
+// RemoveInput 接收端断开，清除它推送的标题和封面
+func (l *Line) RemoveInput(ss stream.SourceStreamer) {
+	if !l.Input.DetachSource(ss) {
+		return
+	}
+	l.unregisterSource(ss)
+	l.Input.Cover = nil
+	l.Input.Title = ""
+	l.Input.Artist = ""
+	BusLineMetadataChanged.Dispatch(l)
+}
+
+// SetCover 接收端推送的封面
+func (l *Line) SetCover(img image.Image) {
+	l.Input.Cover = img
+	BusLineMetadataChanged.Dispatch(l)
+}
+
 func (l *Line) Save() {
 	l.Dispatch("save line")
 }
@@ -280,21 +723,44 @@ func (line *Line) init() {
 	line.spsByCh = make([][]*Speaker, audio.Channel_MAX)
 
 	line.Input.MixerEle = element.NewMixer()
+	line.Input.LinkEle = element.NewLink()
+	line.Input.ChMixerEle = element.NewChannelMixer(line.Output.Layout, line.Upmix)
 	line.Input.VolumeEle = element.NewVolume(float64(line.Volume) / 100)
 	line.Input.SpectrumEle = element.NewSpectrum()
 	line.Input.EqualizerEle = element.NewEqualizer(line.EQ.Eq)
+	line.Input.ConvolverEle = element.NewConvolver()
+	line.Input.LoudnessEle = element.NewLoudness(config.LoudnessTarget)
 	line.Input.PlayerEle = element.NewPlayer()
+	line.Input.AnnouncerEle = element.NewAnnouncer()
+	line.Input.MeterEle = element.NewMeter()
+	line.Input.SilenceEle = element.NewSilence()
 
 	line.Input.PipeLine = pipeline.NewPipeLine(line.Output,
 		line.Input.MixerEle,
+		line.Input.LinkEle,
+		line.Input.ChMixerEle,
+		line.Input.LoudnessEle,
 		line.Input.EqualizerEle,
+		line.Input.ConvolverEle,
 		line.Input.PlayerEle,
 		line.Input.SpectrumEle,
 		line.Input.VolumeEle,
+		line.Input.AnnouncerEle,
+		line.Input.MeterEle,
+		line.Input.SilenceEle,
 	)
 
+	line.Input.MixerEle.SetCrossfade(line.Crossfade, line.CrossfadeCurve)
+	stream.BusMixerSwitched.Register(line.Input.MixerEle, line.onInputSwitched)
+	stream.BusSilenceChanged.Register(line.Input.SilenceEle, line.onSilenceChanged).ASync()
+	stream.BusMeterClipped.Register(line.Input.MeterEle, func(m stream.MeterElement, clipping bool) error {
+		return BusLineClipped.Dispatch(line, clipping)
+	})
+
 	line.syncEqualizer()
+	line.syncLoudness()
 	line.syncRoute()
+	line.syncConvolver()
 
 	line.SetOutput(line.decideOutputFormat())
 }
@@ -378,6 +844,12 @@ func DelLine(id LineID, move LineID) error {
 	}
 	dst.refresh()
 
+	// 解除联动
+	src.Follow(nil)
+	for _, f := range src.Followers() {
+		f.Follow(nil)
+	}
+
 	removeLine(id)
 
 	src.isDeleted = true
@@ -454,6 +926,10 @@ func NewLine(name string) *Line {
 	line.LineName = name
 	line.UUID = generateUUID(name)
 	line.Volume = 50
+	line.Crossfade = config.CrossfadeDuration
+	line.CrossfadeCurve = config.CrossfadeCurve
+	line.Upmix = config.ChannelUpmix
+	line.Dither = config.DitherMode
 	line.init()
 	lineList = append(lineList, &line)
 
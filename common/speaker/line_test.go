@@ -0,0 +1,80 @@
+package speaker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zwcway/castserver-go/common/audio"
+	"github.com/zwcway/castserver-go/common/stream"
+)
+
+// 接收端推送的源，不会触发 BusSourceOpened
+type testSource struct {
+	closed bool
+}
+
+func (s *testSource) Stream(samples *stream.Samples) { samples.LastNbSamples = 0 }
+func (s *testSource) Close() error                   { s.closed = true; return nil }
+func (s *testSource) AudioFormat() audio.Format      { return audio.DefaultFormat() }
+func (s *testSource) ChannelIndex() audio.ChannelIndex {
+	return audio.DefaultFormat().ChannelIndex()
+}
+func (s *testSource) SetOutFormat(audio.Format) error { return nil }
+func (s *testSource) IsPlaying() bool                 { return !s.closed }
+func (s *testSource) CanRemove() bool                 { return s.closed }
+func (s *testSource) SourceType() stream.SourceType   { return stream.ST_Receiver }
+
+// 下一次标题变更时返回标题
+func nextTitle(l *Line) chan string {
+	c := make(chan string, 1)
+	BusLineMetadataChanged.Register(func(ll *Line) error {
+		if ll == l {
+			c <- l.Input.Title
+		}
+		return nil
+	}).Once()
+	return c
+}
+
+func waitTitle(t *testing.T, c chan string) string {
+	select {
+	case title := <-c:
+		return title
+	case <-time.After(time.Second):
+		t.Fatal("metadata not changed")
+	}
+	return ""
+}
+
+func TestLine_SourceHandlers(t *testing.T) {
+	l := NewLine("source")
+	t.Cleanup(func() { removeLine(l.ID) })
+
+	a, b := &testSource{}, &testSource{}
+	l.ApplyInput(a)
+
+	// 切换后旧的源不再影响线路
+	l.onInputSwitched(l.Input.MixerEle, a, b)
+	title := nextTitle(l)
+	stream.BusSourceMetadata.Dispatch(a, "old", "a")
+	stream.BusSourceMetadata.Dispatch(b, "new", "b")
+	assert.Equal(t, "new", waitTitle(t, title))
+
+	// 断开后不再接收
+	l.RemoveInput(b)
+	title = nextTitle(l)
+	stream.BusSourceMetadata.Dispatch(b, "removed", "b")
+	c := &testSource{}
+	l.ApplyInput(c)
+	stream.BusSourceMetadata.Dispatch(c, "next", "c")
+	assert.Equal(t, "next", waitTitle(t, title))
+}
+
+func TestIsLocalFile(t *testing.T) {
+	assert.True(t, isLocalFile("/music/a.flac"))
+	assert.True(t, isLocalFile(`C:\music\a.flac`))
+	assert.True(t, isLocalFile("file:///music/a.flac"))
+	assert.False(t, isLocalFile("http://example.com/a.mp3"))
+	assert.False(t, isLocalFile("HTTPS://example.com/live.m3u8"))
+}
@@ -1,6 +1,61 @@
 package speaker
 
+// 发送和接收队列中的数据包，Data 来自 Speaker.Packets，处理完成后需要归还
 type QueueData struct {
 	Speaker *Speaker
 	Data    []byte
 }
+
+// PacketRing 扬声器的数据包缓存，发送、接收和控制共用，可以并发使用。
+//
+// 空闲的缓存保存在带缓冲的 channel 中，稳定运行时不再申请内存。
+// 为空时 Get 和 Put 退化为直接申请和丢弃
+type PacketRing struct {
+	free chan []byte
+	size int // 新建缓存的最小容量
+}
+
+// Get 取出长度为 n 的缓存，没有空闲或者容量不足时新建
+func (r *PacketRing) Get(n int) []byte {
+	if r == nil {
+		return make([]byte, n)
+	}
+	select {
+	case b := <-r.free:
+		if cap(b) >= n {
+			return b[:n]
+		}
+	default:
+	}
+	size := r.size
+	if size < n {
+		size = n
+	}
+	return make([]byte, n, size)
+}
+
+// Put 归还缓存，空闲的缓存已满时丢弃
+func (r *PacketRing) Put(b []byte) {
+	if r == nil || cap(b) == 0 {
+		return
+	}
+	select {
+	case r.free <- b[:0]:
+	default:
+	}
+}
+
+// 空闲的缓存数量
+func (r *PacketRing) Len() int {
+	if r == nil {
+		return 0
+	}
+	return len(r.free)
+}
+
+func NewPacketRing(slots int, size int) *PacketRing {
+	return &PacketRing{
+		free: make(chan []byte, slots),
+		size: size,
+	}
+}
@@ -9,6 +9,8 @@ import (
 
 	"github.com/zwcway/castserver-go/common/audio"
 	"github.com/zwcway/castserver-go/common/bus"
+	"github.com/zwcway/castserver-go/common/config"
+	"github.com/zwcway/castserver-go/common/dsp"
 	"github.com/zwcway/castserver-go/common/element"
 	"github.com/zwcway/castserver-go/common/pipeline"
 	"github.com/zwcway/castserver-go/common/stream"
@@ -44,6 +46,8 @@ type Speaker struct {
 	Volume uint8 `gorm:"column:volume"`
 	Mute   bool  `gorm:"column:mute"`
 
+	EQ DBeqData `gorm:"column:eq"` // 均衡器，同时保存延迟
+
 	Config SpeakerConfig `gorm:"foreignKey:ID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
 
 	CreatedAt time.Time
@@ -61,10 +65,13 @@ type Speaker struct {
 	SpectrumEle  stream.SpectrumElement  `gorm:"-"`
 	EqualizerEle stream.EqualizerElement `gorm:"-"`
 	PlayerEle    stream.RawPlayerElement `gorm:"-"`
+	AnnouncerEle stream.AnnouncerElement `gorm:"-"`
+	MeterEle     stream.MeterElement     `gorm:"-"`
 
 	ConnTime time.Time      `gorm:"-"`
 	Conn     *net.UDPConn   `gorm:"-"`
 	Queue    chan QueueData `gorm:"-"`
+	Packets  *PacketRing    `gorm:"-"` // 发送、接收和控制的数据包缓存
 
 	Timeout   int       `gorm:"-"` // 超时计数
 	Statistic Statistic `gorm:"-"`
@@ -168,6 +175,56 @@ func (sp *Speaker) SetVolume(vol uint8, mute bool) {
 	bus.DispatchObj(sp, "speaker volume changed")
 }
 
+func (sp *Speaker) Equalizer() *dsp.EqualizerProcessor {
+	return sp.EQ.Eq
+}
+
+// SetEqualizer 替换均衡器，保留当前的延迟
+func (sp *Speaker) SetEqualizer(eq *dsp.EqualizerProcessor) {
+	eq.Delay = sp.Delay()
+	sp.EQ.Eq = eq
+
+	sp.syncEqualizer()
+
+	bus.DispatchObj(sp, "speaker edited", "eq", sp.EQ)
+}
+
+// Delay 延迟，用于补偿与听音位置的距离差
+func (sp *Speaker) Delay() time.Duration {
+	if sp.EQ.Eq == nil {
+		return 0
+	}
+	return sp.EQ.Eq.Delay
+}
+
+func (sp *Speaker) SetDelay(delay time.Duration) error {
+	if delay < 0 || delay > stream.EqualizerDelayMax {
+		return fmt.Errorf("delay %s out of range", delay.String())
+	}
+	if sp.EQ.Eq == nil {
+		sp.EQ.Eq = dsp.NewPeakingFilterEqualizerProcessor(0)
+	}
+	sp.EQ.Eq.Delay = delay
+
+	sp.syncEqualizer()
+
+	bus.DispatchObj(sp, "speaker edited", "eq", sp.EQ)
+	return nil
+}
+
+func (sp *Speaker) syncEqualizer() {
+	if sp.EQ.Eq == nil {
+		sp.EQ.Eq = dsp.NewPeakingFilterEqualizerProcessor(0)
+	}
+	eq := sp.EQ.Eq
+
+	sp.EqualizerEle.SetDelay(eq.Delay)
+	sp.EqualizerEle.SetFilterType(eq.Type)
+	sp.EqualizerEle.SetEqualizer(eq.Filters)
+
+	bus.DispatchObj(sp, "speaker eq changed")
+}
+
 func (sp *Speaker) SetOffline() {
 	sp.State &= ^State_ONLINE
 }
@@ -241,6 +298,8 @@ func (sp *Speaker) Elements() []stream.Element {
 		sp.PlayerEle,
 		sp.SpectrumEle,
 		sp.VolumeEle,
+		sp.AnnouncerEle,
+		sp.MeterEle,
 	}
 }
 
@@ -248,9 +307,22 @@ func (sp *Speaker) init() {
 	sp.MixerEle = element.NewMixer()
 	sp.VolumeEle = element.NewVolume(float64(sp.Volume) / 100)
 	sp.SpectrumEle = element.NewSpectrum()
-	sp.EqualizerEle = element.NewEqualizer(nil)
+	sp.EqualizerEle = element.NewEqualizer(sp.EQ.Eq)
 	sp.PlayerEle = element.NewPlayer()
+	sp.AnnouncerEle = element.NewAnnouncer()
+	sp.MeterEle = element.NewMeter()
 	sp.PipeLine = pipeline.NewPipeLine(sp.Format(), sp.Elements()...)
+	sp.Packets = NewPacketRing(config.ReadQueueSize+config.SendQueueSize, config.ReadBufferSize)
+
+	stream.BusMeterClipped.Register(sp.MeterEle, func(m stream.MeterElement, clipping bool) error {
+		return BusSpeakerClipped.Dispatch(sp, clipping)
+	})
+
+	sp.syncEqualizer()
+	// 保存过均衡器时恢复开启状态
+	if len(sp.EQ.Eq.Filters) > 0 {
+		sp.EqualizerEle.On()
+	}
 }
 
 func (o *Speaker) Dispatch(e string, args ...any) error {
@@ -0,0 +1,84 @@
+package speaker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zwcway/castserver-go/common/audio"
+	"github.com/zwcway/castserver-go/common/bus"
+	"github.com/zwcway/castserver-go/common/dsp"
+	"github.com/zwcway/castserver-go/common/stream"
+	"github.com/zwcway/castserver-go/common/utils"
+)
+
+func TestMain(m *testing.M) {
+	bus.Init(utils.NewEmptyContext())
+	m.Run()
+}
+
+func TestSpeaker_EqualizerDelay(t *testing.T) {
+	sp, err := NewSpeaker("127.0.0.1", 0, audio.Channel_FRONT_LEFT)
+	assert.NoError(t, err)
+	t.Cleanup(func() { removeSpeaker(sp.ID) })
+
+	var edited []any
+	sp.Register("speaker edited", func(o any, a ...any) error {
+		edited = a
+		return nil
+	})
+
+	// 延迟
+	assert.Error(t, sp.SetDelay(-time.Millisecond))
+	assert.Error(t, sp.SetDelay(stream.EqualizerDelayMax+time.Millisecond))
+	assert.Nil(t, edited)
+
+	d := stream.DelayFromDistance(3.4)
+	assert.Equal(t, 10*time.Millisecond, d)
+	assert.NoError(t, sp.SetDelay(d))
+	assert.Equal(t, d, sp.Delay())
+	assert.Equal(t, d, sp.EqualizerEle.Delay())
+	assert.Equal(t, d, sp.Equalizer().Delay)
+	assert.Equal(t, []any{"eq", sp.EQ}, edited)
+
+	// 均衡器
+	eq := dsp.NewPeakingFilterEqualizerProcessor(2)
+	eq.Type = dsp.LowShelfFilter
+	eq.Set(100, 6, 0.7)
+	sp.SetEqualizer(eq)
+	assert.Equal(t, "eq", edited[0])
+	assert.Equal(t, dsp.LowShelfFilter, sp.EqualizerEle.FilterType())
+	assert.Equal(t, eq.Filters, sp.EqualizerEle.Equalizer())
+	// 替换均衡器后保留延迟
+	assert.Equal(t, d, sp.Delay())
+	assert.Equal(t, d, eq.Delay)
+	assert.Equal(t, d, sp.EqualizerEle.Delay())
+}
+
+func TestSpeaker_EqualizerPersist(t *testing.T) {
+	eq := dsp.NewPeakingFilterEqualizerProcessor(2)
+	eq.Set(1000, -3, 1.4)
+	eq.Delay = 20 * time.Millisecond
+
+	v, err := DBeqData{Eq: eq}.Value()
+	assert.NoError(t, err)
+	assert.NotEmpty(t, v)
+
+	// 从数据库加载后应用至扬声器的均衡器元
+	sp := &Speaker{EQ: DBeqData{Eq: eq}}
+	sp.init()
+	assert.Equal(t, 20*time.Millisecond, sp.Delay())
+	assert.Equal(t, 20*time.Millisecond, sp.EqualizerEle.Delay())
+	assert.Equal(t, eq.Filters, sp.EqualizerEle.Equalizer())
+	assert.True(t, sp.EqualizerEle.IsOn())
+
+	// 没有均衡器数据时使用空的均衡器
+	v, err = DBeqData{}.Value()
+	assert.NoError(t, err)
+	assert.Nil(t, v)
+	sp = &Speaker{}
+	sp.init()
+	assert.NotNil(t, sp.Equalizer())
+	assert.Equal(t, time.Duration(0), sp.EqualizerEle.Delay())
+	assert.False(t, sp.EqualizerEle.IsOn())
+}
@@ -0,0 +1,18 @@
+package stream
+
+import "github.com/zwcway/castserver-go/common/bus"
+
+var (
+	BusMeterClipped = meterClipped{}
+)
+
+type meterClipped struct{}
+
+func (meterClipped) Dispatch(m MeterElement, clipping bool) error {
+	return bus.DispatchObj(m, "meter clipped", clipping)
+}
+func (meterClipped) Register(m MeterElement, c func(m MeterElement, clipping bool) error) *bus.HandlerData {
+	return bus.RegisterObj(m, "meter clipped", func(o any, a ...any) error {
+		return c(o.(MeterElement), a[0].(bool))
+	})
+}
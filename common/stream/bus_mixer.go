@@ -7,6 +7,7 @@ import (
 
 var (
 	BusMixerFormatChanged = mixerFormatChanged{}
+	BusMixerSwitched      = mixerSwitched{}
 )
 
 type mixerFormatChanged struct{}
@@ -19,3 +20,14 @@ func (mixerFormatChanged) Register(m MixerElement, c func(m MixerElement, format
 		return c(o.(MixerElement), a[0].(*audio.Format), a[1].(audio.ChannelIndex))
 	})
 }
+
+type mixerSwitched struct{}
+
+func (mixerSwitched) Dispatch(m MixerElement, from SourceStreamer, to SourceStreamer) error {
+	return bus.DispatchObj(m, "mixer switched", from, to)
+}
+func (mixerSwitched) Register(m MixerElement, c func(m MixerElement, from SourceStreamer, to SourceStreamer) error) *bus.HandlerData {
+	return bus.RegisterObj(m, "mixer switched", func(o any, a ...any) error {
+		return c(o.(MixerElement), a[0].(SourceStreamer), a[1].(SourceStreamer))
+	})
+}
@@ -0,0 +1,18 @@
+package stream
+
+import "github.com/zwcway/castserver-go/common/bus"
+
+var (
+	BusSilenceChanged = silenceChanged{}
+)
+
+type silenceChanged struct{}
+
+func (silenceChanged) Dispatch(s SilenceElement, idle bool) error {
+	return bus.DispatchObj(s, "silence changed", idle)
+}
+func (silenceChanged) Register(s SilenceElement, c func(s SilenceElement, idle bool) error) *bus.HandlerData {
+	return bus.RegisterObj(s, "silence changed", func(o any, a ...any) error {
+		return c(o.(SilenceElement), a[0].(bool))
+	})
+}
@@ -7,6 +7,10 @@ import (
 
 var (
 	BusSourceFormatChanged = sourceFormatChanged{}
+	BusSourceOpened        = sourceOpened{}
+	BusSourcePause         = sourcePause{}
+	BusSourceFinished      = sourceFinished{}
+	BusSourceMetadata      = sourceMetadata{}
 )
 
 type sourceFormatChanged struct{}
@@ -19,3 +23,49 @@ func (sourceFormatChanged) Register(ss SourceStreamer, c func(ss SourceStreamer,
 		return c(o.(SourceStreamer), a[0].(*audio.Format), a[1].(audio.ChannelIndex))
 	})
 }
+
+type sourceOpened struct{}
+
+func (sourceOpened) Dispatch(ss SourceStreamer, url string) error {
+	return bus.DispatchObj(ss, "source opened", url)
+}
+func (sourceOpened) Register(ss SourceStreamer, c func(ss SourceStreamer, url string) error) *bus.HandlerData {
+	return bus.RegisterObj(ss, "source opened", func(o any, a ...any) error {
+		return c(o.(SourceStreamer), a[0].(string))
+	})
+}
+
+type sourcePause struct{}
+
+func (sourcePause) Dispatch(ss SourceStreamer, pause bool) error {
+	return bus.DispatchObj(ss, "source pause", pause)
+}
+func (sourcePause) Register(ss SourceStreamer, c func(ss SourceStreamer, pause bool) error) *bus.HandlerData {
+	return bus.RegisterObj(ss, "source pause", func(o any, a ...any) error {
+		return c(o.(SourceStreamer), a[0].(bool))
+	})
+}
+
+// 解码至文件结束，在管道的协程中触发
+type sourceFinished struct{}
+
+func (sourceFinished) Dispatch(ss SourceStreamer) error {
+	return bus.DispatchObj(ss, "source finished")
+}
+func (sourceFinished) Register(ss SourceStreamer, c func(ss SourceStreamer) error) *bus.HandlerData {
+	return bus.RegisterObj(ss, "source finished", func(o any, a ...any) error {
+		return c(o.(SourceStreamer))
+	})
+}
+
+// 网络电台的标题变化
+type sourceMetadata struct{}
+
+func (sourceMetadata) Dispatch(ss SourceStreamer, title string, artist string) error {
+	return bus.DispatchObj(ss, "source metadata", title, artist)
+}
+func (sourceMetadata) Register(ss SourceStreamer, c func(ss SourceStreamer, title string, artist string) error) *bus.HandlerData {
+	return bus.RegisterObj(ss, "source metadata", func(o any, a ...any) error {
+		return c(o.(SourceStreamer), a[0].(string), a[1].(string))
+	})
+}
@@ -51,9 +51,55 @@ type VolumeElement interface {
 
 	SetVolume(float64)
 	Volume() float64
+	// 本次变化在 d 内过渡，不修改默认的过渡时长
+	SetVolumeRamp(float64, time.Duration)
 
 	SetMute(bool)
 	Mute() bool
+	SetMuteRamp(bool, time.Duration)
+
+	// 设置音量变化的过渡时长，以及静音、暂停时淡入淡出的时长
+	SetRamp(ramp time.Duration, fade time.Duration)
+	Ramp() (time.Duration, time.Duration)
+
+	// 淡出至静音，返回的通道在淡出完成后关闭
+	FadeOut() <-chan struct{}
+	// 从静音淡入
+	FadeIn()
+}
+
+// 混音器中单个源的增益范围 dB
+const (
+	MixerGainMin = -60.0
+	MixerGainMax = 12.0
+)
+
+// MixerControl 混音器中单个源的增益、声像、静音和独奏
+type MixerControl struct {
+	Gain float64 // dB
+	Pan  float64 // -1 最左，1 最右，衰减另一侧的声道
+	Mute bool
+	Solo bool // 有源独奏时，其它源静音
+}
+
+func (c MixerControl) IsValid() bool {
+	return c.Gain >= MixerGainMin && c.Gain <= MixerGainMax && c.Pan >= -1 && c.Pan <= 1
+}
+
+// MixerLevel 单个声道的电平，线性
+type MixerLevel struct {
+	Channel audio.Channel
+	Peak    float64
+	RMS     float64
+}
+
+// MixerSource 混音器中的源，切换曲目时保持 ID 和控制
+type MixerSource struct {
+	MixerControl
+
+	ID     uint16
+	Source SourceStreamer
+	Levels []MixerLevel // 没有开启电平表时为空
 }
 
 // MixerElement 音频混音元
@@ -75,6 +121,29 @@ type MixerElement interface {
 	Format() audio.Format   // 获取输出格式
 
 	Buffer() *Samples
+
+	// 设置切换曲目时的交叉淡化时长和曲线，时长为 0 时无缝衔接
+	SetCrossfade(time.Duration, dsp.FadeCurve)
+	Crossfade() (time.Duration, dsp.FadeCurve)
+
+	// 预先加入下一个源，from 即将结束时切换
+	SetNext(from SourceStreamer, to SourceStreamer)
+	// 立即从 from 切换至 to
+	Switch(from SourceStreamer, to SourceStreamer)
+	// 等待切换的源
+	Next() SourceStreamer
+	// 取消尚未开始淡化的切换
+	CancelNext()
+
+	// 所有源的控制和电平
+	Sources() []MixerSource
+	// 设置源的增益、声像、静音和独奏
+	SetControl(id uint16, c MixerControl) error
+	// 开启每个源的电平表
+	SetMeter(bool)
+	Meter() bool
+	// 在 d 内淡入或者淡出单个源，返回的通道在完成后关闭
+	FadeSource(s SourceStreamer, in bool, d time.Duration) <-chan struct{}
 }
 
 // ChannelMixerElement 声道混音元
@@ -83,6 +152,12 @@ type ChannelMixerElement interface {
 
 	SetRoute([]audio.ChannelRoute)
 	Route() []audio.ChannelRoute
+	// 输出的声道布局
+	SetLayout(audio.Layout)
+	Layout() audio.Layout
+	SetUpmix(dsp.UpmixMode)
+	Upmix() dsp.UpmixMode
+	Matrix() *dsp.ChannelMatrix
 }
 
 // RawPlayerElement 临时播放元
@@ -94,12 +169,83 @@ type RawPlayerElement interface {
 	AddPCMWithChannel(audio.Channel, audio.Format, []byte)
 }
 
+// Announcement 一段播报
+type Announcement struct {
+	Clip   *Samples // 只读，可以由多个播报元共享
+	Volume float64  // 播报的线性音量，与线路音量无关
+	Duck   float64  // 播报期间其它声音压低的 dB
+}
+
+// AnnouncerElement 播报元，按顺序播放队列中的播报，并在播报期间压低其它声音
+type AnnouncerElement interface {
+	SwitchElement
+
+	// 在调用者的协程中将数据转换为 Format，Clip 只读，可以共享
+	Announce(Announcement)
+	// 最近处理的格式，尚未处理时无效
+	Format() audio.Format
+	// 压低和恢复的时间常数
+	SetDucking(attack time.Duration, release time.Duration)
+	Ducking() (time.Duration, time.Duration)
+
+	IsAnnouncing() bool
+	Pending() int // 等待播放的数量，不包括正在播放的
+	Clear()       // 清空队列并停止当前的播报
+}
+
+// PeakLevel 单个声道的峰值和削波计数，线性
+type PeakLevel struct {
+	Channel      audio.Channel
+	Peak         float64 // 最近一块的样本峰值
+	TruePeak     float64 // 最近一块的真峰值，未开启时为 0
+	PeakHold     float64
+	TruePeakHold float64
+	Clips        uint64 // 超过 0dBFS 的样本数
+}
+
+// MeterElement 峰值表元，位于均衡器和音量之后，统计削波
+type MeterElement interface {
+	SwitchElement
+
+	SetTruePeak(bool) // 真峰值需要过采样，订阅时开启
+	TruePeak() bool
+	SetPeakHold(time.Duration)
+	PeakHold() time.Duration
+
+	Levels() []PeakLevel
+	Clips() uint64    // 所有声道的削波样本数
+	IsClipping() bool // 峰值保持期间内有削波
+	ResetClips()
+}
+
+// SilenceElement 静音检测元，连续静音超过指定时长后进入空闲，不再输出样本
+type SilenceElement interface {
+	SwitchElement
+
+	SetTimeout(time.Duration) // 0 表示不检测
+	Timeout() time.Duration
+	IsIdle() bool
+}
+
+// LinkElement 联动元，主线路的样本分发至跟随的线路，跟随的线路使用主线路的样本替换自身的输入
+type LinkElement interface {
+	SwitchElement
+
+	// 跟随 leader 播放，nil 表示取消跟随
+	Follow(leader LinkElement) error
+	Leader() LinkElement
+	Followers() int
+}
+
 // ResampleElement 转码元
 type ResampleElement interface {
 	SwitchElement
 
 	SetFormat(audio.Format) // 设置转码目标格式
 	Format() audio.Format   // 获取转码目标格式
+
+	SetDither(dsp.DitherMode) // 降低位深时的抖动方式
+	Dither() dsp.DitherMode
 }
 
 // SpectrumElement 频谱元
@@ -108,9 +254,18 @@ type SpectrumElement interface {
 
 	SetLogAxis(bool)
 	LogAxis() bool
+	SetSize(int) // fft 长度
+	Size() int
+	SetWindow(dsp.WindowType)
+	Window() dsp.WindowType
+	SetAveraging(float64) // 指数平均系数 [0, 1)
+	Averaging() float64
+	SetPeakHold(time.Duration)
+	PeakHold() time.Duration
 
 	LevelMeter() float64
 	Spectrum() []float64
+	Bands(fraction int) (levels []float64, peaks []float64) // 1/fraction 倍频程的幅值和峰值
 }
 
 // EqualizerElement 均衡器元
@@ -133,6 +288,73 @@ type EqualizerElement interface {
 
 const EqualizerDelayMax time.Duration = 300 * time.Millisecond // 大约 102 米
 
+const SpeedOfSound float64 = 340 // 声速，米/秒
+
+// DelayFromDistance 声音传播指定距离（米）所需的时间
+func DelayFromDistance(m float64) time.Duration {
+	return time.Duration(m / SpeedOfSound * float64(time.Second))
+}
+
+// LatencyElement 有固定处理延迟的元
+type LatencyElement interface {
+	Element
+
+	Latency() time.Duration
+}
+
+// ConvolverElement 卷积元
+type ConvolverElement interface {
+	SwitchElement
+	LatencyElement
+
+	// 设置声道的冲激响应，audio.Channel_NONE 表示所有声道
+	SetImpulseResponse(audio.Channel, *dsp.ImpulseResponse)
+	ImpulseResponse(audio.Channel) *dsp.ImpulseResponse
+	// 从 WAV 文件中加载冲激响应
+	LoadFile(audio.Channel, string) error
+	Clear(audio.Channel)
+
+	SetBlockSize(int)
+	BlockSize() int
+}
+
+type LoudnessMode uint8
+
+const (
+	LM_Live  LoudnessMode = iota // 实时测量积分响度
+	LM_Track                     // 使用 ReplayGain 音轨增益，没有标签时实时测量
+
+	LM_MAX
+)
+
+func (m LoudnessMode) IsValid() bool {
+	return m < LM_MAX
+}
+
+// LoudnessElement 响度标准化元
+type LoudnessElement interface {
+	SwitchElement
+
+	// 目标响度 LUFS
+	SetTarget(float64)
+	Target() float64
+
+	SetMode(LoudnessMode)
+	Mode() LoudnessMode
+
+	// 设置音轨的 ReplayGain 增益（dB）和峰值，峰值为 0 表示未知
+	SetTrackGain(gain float64, peak float64)
+	ClearTrackGain()
+
+	// 重新开始测量，切换音轨时调用
+	Reset()
+
+	Momentary() float64
+	ShortTerm() float64
+	Integrated() float64
+	Gain() float64 // 当前应用的增益 dB
+}
+
 type PipeLiner interface {
 	StreamCloser
 
@@ -146,4 +368,7 @@ type PipeLiner interface {
 
 	LastCost() time.Duration
 	LastMaxCost() time.Duration
+
+	// 所有元的延迟总和
+	Latency() time.Duration
 }
@@ -15,7 +15,8 @@ import (
 type Samples struct {
 	RequestNbSamples int          // 请求的每声道样本数量
 	Format           audio.Format // 当前样本格式
-	Data             [][]float64  // 第二维数据是指向 Buffer 的 unsafePoint 数组
+	Data             [][]float64  // 第二维数据是指向 Buffer 的 unsafePoint 数组，float32 格式时为空
+	Data32           [][]float32  // float32 格式时指向 Buffer，其他格式时为 nil
 	RawData          [][]byte     // 第二维数据是指向 Buffer 的 unsafePoint 数组
 	LastErr          error        // 最近一次处理的错误码
 	LastNbSamples    int          // 最近一次处理后剩余的每声道样本数量
@@ -97,11 +98,19 @@ func (s *Samples) setLayout(f audio.Layout) {
 
 	s.Data = make([][]float64, chs)
 	s.RawData = make([][]byte, chs)
+	s.Data32 = nil
+	if s.Format.Bits == audio.Bits_32LEF {
+		s.Data32 = make([][]float32, chs)
+	}
 
 	for ch = 0; ch < chs; ch++ {
 		chBuf = unsafe.Pointer(&s.buffer[ch*samples*bits])
 
-		s.Data[ch] = utils.MakeSlice[float64](chBuf, samples)
+		if s.Data32 != nil {
+			s.Data32[ch] = utils.MakeSlice[float32](chBuf, samples)
+		} else {
+			s.Data[ch] = utils.MakeSlice[float64](chBuf, samples)
+		}
 		s.RawData[ch] = utils.MakeSlice[byte](chBuf, perChSize)
 	}
 
@@ -136,6 +145,7 @@ func (s *Samples) ResetData() {
 	s.buffer[0] = byte(0)
 	s.buffer[1] = byte(0)
 	s.buffer[2] = byte(0)
+	s.buffer[3] = byte(0)
 	s.buffer[4] = byte(0)
 	s.buffer[5] = byte(0)
 	s.buffer[6] = byte(0)
@@ -159,12 +169,61 @@ func (s *Samples) ResetAll() {
 
 func (s *Samples) BeZeroLeft(j int) {
 	for _, ch := range s.Data {
-		for ; j < len(ch); j++ {
-			ch[j] = 0
+		for i := j; i < len(ch); i++ {
+			ch[i] = 0
+		}
+	}
+	for _, ch := range s.Data32 {
+		for i := j; i < len(ch); i++ {
+			ch[i] = 0
 		}
 	}
 }
 
+// 是否是 float32 格式
+func (s *Samples) IsFloat32() bool {
+	return s.Data32 != nil
+}
+
+// 是否可以直接处理样本，即 float32 或者 float64 格式
+func (s *Samples) IsFloat() bool {
+	return s.Data32 != nil || s.Format.Bits == audio.Bits_64LEF
+}
+
+// Float64 返回第 ch 个声道的前 n 个样本。
+// float64 格式时直接返回缓存，float32 格式时转换至 buf，修改后需要调用 SetFloat64 写回
+func (s *Samples) Float64(ch int, n int, buf []float64) []float64 {
+	if s.Data32 == nil {
+		return s.Data[ch][:n]
+	}
+	if cap(buf) < n {
+		buf = make([]float64, n)
+	}
+	buf = buf[:n]
+	for i, v := range s.Data32[ch][:n] {
+		buf[i] = float64(v)
+	}
+	return buf
+}
+
+// SetFloat64 将 Float64 返回的样本写回第 ch 个声道
+func (s *Samples) SetFloat64(ch int, src []float64) {
+	if s.Data32 == nil {
+		if len(src) > 0 && len(s.Data[ch]) > 0 && &src[0] == &s.Data[ch][0] {
+			return
+		}
+		copy(s.Data[ch], src)
+		return
+	}
+	dst := s.Data32[ch]
+	if len(src) > len(dst) {
+		src = src[:len(dst)]
+	}
+	for i, v := range src {
+		dst[i] = float32(v)
+	}
+}
+
 func (s *Samples) ChannelBytes(ch audio.Channel) []byte {
 	c := s.ChannelIndex[ch]
 	if c < 0 {
@@ -217,13 +276,37 @@ func (src *Samples) MixChannelMap(dst *Samples, dstOffset, srcOffset int) (mixed
 }
 
 func (src *Samples) mixChannel(dst *Samples, dstCh, srcCh int8, dstOffset, srcOffset int) int {
+	var (
+		dn = dst.RequestNbSamples
+		sn = src.LastNbSamples
+	)
+	// 单声道的视图共享整个缓存，请求的样本数可能大于声道的长度
+	switch {
+	case dst.Data32 == nil && src.Data32 == nil:
+		return mixPlanar(dst.Data[dstCh], src.Data[srcCh], dn, sn, dstOffset, srcOffset)
+	case dst.Data32 != nil && src.Data32 != nil:
+		return mixPlanar(dst.Data32[dstCh], src.Data32[srcCh], dn, sn, dstOffset, srcOffset)
+	case dst.Data32 != nil:
+		return mixPlanar(dst.Data32[dstCh], src.Data[srcCh], dn, sn, dstOffset, srcOffset)
+	default:
+		return mixPlanar(dst.Data[dstCh], src.Data32[srcCh], dn, sn, dstOffset, srcOffset)
+	}
+}
+
+func mixPlanar[D Float, S Float](dst []D, src []S, dn, sn int, dstOffset, srcOffset int) int {
 	var (
 		i = dstOffset
 		j = srcOffset
 	)
+	if dn > len(dst) {
+		dn = len(dst)
+	}
+	if sn > len(src) {
+		sn = len(src)
+	}
 
-	for i < dst.RequestNbSamples && j < src.LastNbSamples {
-		dst.Data[dstCh][i] += src.Data[srcCh][j]
+	for i < dn && j < sn {
+		dst[i] += D(src[j])
 		i++
 		j++
 	}
@@ -237,7 +320,7 @@ func (src *Samples) Mix(dst *Samples, dstOffset int, srcOffset int) int {
 
 // 相同声道之间混合
 func (src *Samples) MixChannels(dst *Samples, srcChs []audio.Channel, dstOffset int, srcOffset int) int {
-	if src.Format.Bits != audio.Bits_DEFAULT || dst == nil || dst.Format.Bits != audio.Bits_DEFAULT {
+	if !src.IsFloat() || dst == nil || !dst.IsFloat() {
 		return 0
 	}
 	var (
@@ -267,7 +350,7 @@ func (src *Samples) MixChannels(dst *Samples, srcChs []audio.Channel, dstOffset
 }
 
 func (src *Samples) CopyTo(dst *Samples, dstOffset, srcOffset int) int {
-	if src.Format.Bits != audio.Bits_DEFAULT || dst == nil || dst.Format.Bits != audio.Bits_DEFAULT {
+	if !src.IsFloat() || dst == nil || dst.Format.Bits != src.Format.Bits {
 		return 0
 	}
 	var (
@@ -288,7 +371,11 @@ func (src *Samples) CopyTo(dst *Samples, dstOffset, srcOffset int) int {
 		if j < 0 {
 			continue
 		}
-		mixed = copy(dst.Data[i][dstOffset:], src.Data[j][srcOffset:])
+		if src.Data32 != nil {
+			mixed = copy(dst.Data32[i][dstOffset:], src.Data32[j][srcOffset:])
+		} else {
+			mixed = copy(dst.Data[i][dstOffset:], src.Data[j][srcOffset:])
+		}
 	}
 
 	return mixed
@@ -471,13 +558,31 @@ func (s *Samples) Resize(samples int, format audio.Format) {
 		// 缓存空间足够大，变更格式即可
 		s.RequestNbSamples = samples
 		s.SetLayout(format.Layout)
+		bitsChanged := s.Format.Bits != format.Bits
 		s.Format = format
+		if bitsChanged {
+			// 重建对应位宽的声道数据
+			s.setLayout(format.Layout)
+		}
 		return
 	}
 
 	s.resizeSample(samples, format)
 }
 
+// Reformat 变更格式并重建声道索引，不保留原有数据。缓存空间足够时不重新分配
+func (s *Samples) Reformat(samples int, format audio.Format) {
+	if !format.IsValid() || (format == s.Format && samples == s.RequestNbSamples) {
+		return
+	}
+	size := samples * format.Size()
+	if size > cap(s.buffer) {
+		s.resizeSample(samples, format)
+		return
+	}
+	reuseSamples(s, s.buffer[:size], format)
+}
+
 func (s *Samples) ResizeDuration(duration time.Duration, format audio.Format) {
 	samples := sampleSize(duration, &format)
 	s.Resize(samples, format)
@@ -492,20 +597,38 @@ func (s *Samples) ChannelSamples(ch audio.Channel) *Samples {
 	format := s.Format
 	format.Layout = audio.NewLayout(ch)
 
+	// 只引用该声道的数据，重置时不会影响其它声道
+	raw := s.RawData[si]
 	ns := &Samples{}
-	reuseSamples(ns, s.buffer, format)
+	reuseSamples(ns, raw[:len(raw):len(raw)], format)
 
 	// 将任意的声道都映射至第一个
 	for i := 0; i < int(audio.Channel_MAX); i++ {
 		ns.ChannelIndex[i] = 0
 	}
 
-	ns.Data[0] = s.Data[si]
+	if s.Data32 != nil {
+		ns.Data32[0] = s.Data32[si]
+	} else {
+		ns.Data[0] = s.Data[si]
+	}
 	ns.RawData[0] = s.RawData[si]
 
 	return ns
 }
 
+// Clone 复制有效的样本至新的缓存
+func (s *Samples) Clone() *Samples {
+	ns := newSamples(s.LastNbSamples, s.Format)
+	ns.ChannelIndex = append(audio.ChannelIndex{}, s.ChannelIndex...)
+	size := s.Format.SamplesSize(s.LastNbSamples)
+	for ch := range s.RawData {
+		copy(ns.RawData[ch], s.RawData[ch][:size])
+	}
+	ns.LastNbSamples = s.LastNbSamples
+	return ns
+}
+
 func (s *Samples) WrapError(err error) {
 	if err != nil {
 		if s.LastErr != nil {
@@ -515,3 +638,39 @@ func (s *Samples) WrapError(err error) {
 		}
 	}
 }
+
+// Float 内部处理的样本类型
+type Float interface {
+	float32 | float64
+}
+
+// Planar 返回 T 类型的各声道数据，T 与样本格式不一致时返回 nil
+func Planar[T Float](s *Samples) [][]T {
+	var p any = s.Data
+	if s.Data32 != nil {
+		p = s.Data32
+	}
+	d, _ := p.([][]T)
+	return d
+}
+
+// Scale 所有声道的有效样本乘以 g
+func (s *Samples) Scale(g float64) {
+	if s.Data32 != nil {
+		scalePlanar(s.Data32, int(s.Format.Count), s.LastNbSamples, float32(g))
+	} else {
+		scalePlanar(s.Data, int(s.Format.Count), s.LastNbSamples, g)
+	}
+}
+
+func scalePlanar[T Float](data [][]T, chs int, n int, g T) {
+	if chs > len(data) {
+		chs = len(data)
+	}
+	for ch := 0; ch < chs; ch++ {
+		d := data[ch][:n]
+		for i := range d {
+			d[i] *= g
+		}
+	}
+}
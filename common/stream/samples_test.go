@@ -29,3 +29,64 @@ func TestNewSamplesDuration(t *testing.T) {
 		assert.Equal(t, samples.LastNbSamples, 0)
 	})
 }
+
+func TestSamplesFloat32(t *testing.T) {
+	format := func(bits audio.Bits) audio.Format {
+		return audio.Format{
+			Sample: audio.Sample{
+				Rate: audio.AudioRate_48000,
+				Bits: bits,
+			},
+			Layout: audio.Layout20,
+		}
+	}
+
+	s := NewSamples(16, format(audio.Bits_32LEF))
+	assert.True(t, s.IsFloat32())
+	assert.Len(t, s.Data32, 2)
+	assert.Len(t, s.Data32[1], 16)
+	assert.Nil(t, Planar[float64](s))
+	assert.Equal(t, s.Data32, Planar[float32](s))
+
+	for i := range s.Data32[1] {
+		s.Data32[1][i] = 0.5
+	}
+	s.LastNbSamples = 16
+	s.Scale(0.5)
+	assert.Equal(t, float32(0.25), s.Data32[1][15])
+	// 与字节数据共享缓存
+	assert.Equal(t, []byte{0, 0, 0x80, 0x3e}, s.RawData[1][:4])
+
+	buf := s.Float64(1, 16, nil)
+	assert.Equal(t, 0.25, buf[0])
+	buf[0] = 1
+	s.SetFloat64(1, buf)
+	assert.Equal(t, float32(1), s.Data32[1][0])
+
+	t.Run("mix between bits", func(t *testing.T) {
+		d := NewSamples(16, format(audio.Bits_DEFAULT))
+		assert.Nil(t, d.Data32)
+		d.ResetData()
+		d.RequestNbSamples = 16
+		assert.Equal(t, 16, s.MixChannels(d, s.Format.Channels(), 0, 0))
+		assert.Equal(t, 1.0, d.Data[1][0])
+		assert.Equal(t, 0.25, d.Data[1][1])
+
+		s.ResetData()
+		s.RequestNbSamples = 16
+		d.LastNbSamples = 16
+		assert.Equal(t, 16, d.MixChannels(s, d.Format.Channels(), 0, 0))
+		assert.Equal(t, float32(0.25), s.Data32[1][1])
+	})
+
+	t.Run("resize", func(t *testing.T) {
+		d := NewSamples(16, format(audio.Bits_DEFAULT))
+		d.Resize(16, format(audio.Bits_32LEF))
+		assert.True(t, d.IsFloat32())
+		assert.Len(t, d.Data32[1], 16)
+
+		d.Resize(16, format(audio.Bits_S16LE))
+		assert.False(t, d.IsFloat())
+		assert.Nil(t, d.Data32)
+	})
+}
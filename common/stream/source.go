@@ -23,10 +23,17 @@ type Source struct {
 	PipeLine PipeLiner
 
 	MixerEle     MixerElement
+	LinkEle      LinkElement
+	ChMixerEle   ChannelMixerElement
 	VolumeEle    VolumeElement
 	SpectrumEle  SpectrumElement
 	EqualizerEle EqualizerElement
+	ConvolverEle ConvolverElement
+	LoudnessEle  LoudnessElement
 	PlayerEle    RawPlayerElement
+	AnnouncerEle AnnouncerElement
+	MeterEle     MeterElement
+	SilenceEle   SilenceElement
 	// ResampleEle  ResampleElement
 	// PusherEle    SwitchElement
 
@@ -44,13 +51,37 @@ func (s *Source) ApplySource(f SourceStreamer) {
 		s.From = ST_File
 		s.fs = fs
 	} else if rs, ok := f.(ReceiverStreamer); ok {
-		s.From = ST_Receiver
+		s.From = rs.SourceType()
 		s.rs = rs
 	}
 
 	s.MixerEle.Add(f)
 }
 
+// ReplaceSource 混音器完成曲目切换后替换输入源
+func (s *Source) ReplaceSource(from SourceStreamer, to SourceStreamer) {
+	if fs, ok := to.(FileStreamer); ok && (s.fs == nil || s.fs == from) {
+		s.fs = fs
+	} else if rs, ok := to.(ReceiverStreamer); ok && (s.rs == nil || s.rs == from) {
+		s.rs = rs
+	}
+}
+
+// DetachSource 接收端断开后解除关联，混音器在 CanRemove 后自动移除。
+// 已经被其它接收端替换时返回 false
+func (s *Source) DetachSource(f SourceStreamer) bool {
+	if s.rs == nil || s.rs != f {
+		return false
+	}
+	s.rs = nil
+	if s.fs != nil {
+		s.From = ST_File
+	} else {
+		s.From = ST_NONE
+	}
+	return true
+}
+
 func (s *Source) Format() audio.Format {
 	if s.fs != nil {
 		return s.fs.AudioFormat()
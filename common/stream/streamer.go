@@ -1,6 +1,7 @@
 package stream
 
 import (
+	"io"
 	"time"
 
 	"github.com/zwcway/castserver-go/common/audio"
@@ -24,9 +25,9 @@ type StreamSeekCloser interface {
 
 type SourceStreamer interface {
 	StreamCloser
-	AudioFormat() audio.Format         // 获取输入的音频格式
+	AudioFormat() audio.Format        // 获取输入的音频格式
 	ChannelIndex() audio.ChannelIndex // 获取输入的声道布局
-	SetOutFormat(audio.Format) error   // 设置音频输出格式
+	SetOutFormat(audio.Format) error  // 设置音频输出格式
 	IsPlaying() bool
 	CanRemove() bool // 是否可以自动移除
 }
@@ -42,8 +43,25 @@ type FileStreamer interface {
 	TotalDuration() time.Duration // 总时长
 	SetPause(bool)                // 暂停解码
 	IsPaused() bool               // 是否暂停
+	IsFinished() bool             // 是否已经播放结束
 }
 
+// LiveStreamer 网络电台等没有长度的流
+type LiveStreamer interface {
+	FileStreamer
+	OpenStream(name string, r io.ReadCloser) error // 从 r 解码，name 作为当前文件
+	IsLive() bool
+	Metadata() (title string, artist string) // 最近一次收到的标题
+}
+
+// MetadataReader 带有标题的流
+type MetadataReader interface {
+	io.ReadCloser
+	Metadata() (title string, artist string)
+}
+
+// ReceiverStreamer 由接收端推送数据的流
 type ReceiverStreamer interface {
 	SourceStreamer
+	SourceType() SourceType // 来源，如 ST_AirPlay
 }
@@ -13,34 +13,40 @@ type WaitGroup struct {
 }
 
 func (w *WaitGroup) Wait() {
-	if w.c > 0 {
+	if atomic.LoadInt32(&w.c) > 0 {
 		w.wg.Wait()
 	}
 }
 
 func (w *WaitGroup) Go(cb func(<-chan struct{})) {
+	w.lock.Lock()
 	if w.exitC == nil {
 		w.exitC = make(chan struct{})
 	}
+	exitC := w.exitC
 	atomic.AddInt32(&w.c, 1)
 	w.wg.Add(1)
-	go w.routine(cb)
+	w.lock.Unlock()
+
+	go w.routine(exitC, cb)
 }
 
+// ExitAndWait 通知所有协程退出并等待。之后调用 Go 的协程使用新的退出信号
 func (w *WaitGroup) ExitAndWait() {
-	if w.c == 0 || w.exitC == nil {
-		return
-	}
 	w.lock.Lock()
-	defer w.lock.Unlock()
+	exitC := w.exitC
+	w.exitC = nil
+	w.lock.Unlock()
 
-	close(w.exitC)
+	if exitC == nil {
+		return
+	}
+	close(exitC)
 	w.Wait()
-	w.exitC = nil
 }
 
-func (w *WaitGroup) routine(cb func(<-chan struct{})) {
-	cb(w.exitC)
+func (w *WaitGroup) routine(exitC <-chan struct{}, cb func(<-chan struct{})) {
+	cb(exitC)
 	atomic.AddInt32(&w.c, -1)
 	w.wg.Done()
 }
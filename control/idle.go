@@ -0,0 +1,63 @@
+package control
+
+import (
+	"time"
+
+	lg "github.com/zwcway/castserver-go/common/log"
+	"github.com/zwcway/castserver-go/common/protocol"
+	"github.com/zwcway/castserver-go/common/speaker"
+)
+
+// UDP 可能丢包，空闲状态变化后按照间隔重复发送
+const (
+	idleResendTimes    = 3
+	idleResendInterval = time.Second
+)
+
+// Idle 线路没有信号时通知扬声器空闲，扬声器可以关闭功放
+type Idle struct {
+	f    Control
+	Idle bool
+}
+
+func (s *Idle) Pack(p *protocol.Package) (err error) {
+	s.f.Pack(p)
+	if s.Idle {
+		p.WriteUint8(1)
+	} else {
+		p.WriteUint8(0)
+	}
+	return
+}
+
+// ControlLineIdle 通知线路的所有扬声器，状态再次改变之前重复发送
+func ControlLineIdle(line *speaker.Line, idle bool) {
+	controlLineIdle(line, idle, idleResendTimes)
+}
+
+func controlLineIdle(line *speaker.Line, idle bool, times int) {
+	if line.IsDeleted() || line.Input.SilenceEle.IsIdle() != idle {
+		return
+	}
+	for _, sp := range line.Speakers() {
+		ControlSpeakerIdle(sp, idle)
+	}
+	if times > 1 {
+		time.AfterFunc(idleResendInterval, func() {
+			controlLineIdle(line, idle, times-1)
+		})
+	}
+}
+
+func ControlSpeakerIdle(sp *speaker.Speaker, idle bool) {
+	s := Idle{
+		f:    Control{Command_IDLE, sp.ID},
+		Idle: idle,
+	}
+
+	err := writePacket(sp, s.Pack)
+	if err != nil {
+		log.Error("ControlSpeakerIdle error", lg.String("speaker", sp.String()), lg.Error(err))
+		return
+	}
+}
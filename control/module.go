@@ -25,12 +25,23 @@ func (controlModule) Init(ctx utils.Context) error {
 	}
 	bus.Register("speaker connected", c)
 	bus.Register("speaker format changed", c)
+	bus.Register("speaker connected", func(o any, a ...any) error {
+		sp := o.(*speaker.Speaker)
+		if sp.Line != nil && sp.Line.Input.SilenceEle.IsIdle() {
+			ControlSpeakerIdle(sp, true)
+		}
+		return nil
+	})
 
 	bus.Register("speaker volume changed", func(o any, a ...any) error {
 		sp := o.(*speaker.Speaker)
 		ControlSpeakerVolume(sp, float64(sp.Volume), sp.Mute)
 		return nil
 	})
+	speaker.BusLineIdleChanged.Register(func(line *speaker.Line, idle bool) error {
+		ControlLineIdle(line, idle)
+		return nil
+	}).ASync()
 	return nil
 }
 
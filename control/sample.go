@@ -14,8 +14,8 @@ type Sample struct {
 	channel audio.Channel
 }
 
-func (s *Sample) Pack() (p *protocol.Package, err error) {
-	p, _ = s.f.Pack()
+func (s *Sample) Pack(p *protocol.Package) (err error) {
+	s.f.Pack(p)
 	p.WriteUint8((uint8(s.bit) << 4) | uint8(s.rate))
 	p.WriteUint8(uint8(s.channel))
 
@@ -30,13 +30,7 @@ func ControlSample(sp *speaker.Speaker) {
 		channel: sp.SampleChannel(),
 	}
 
-	p, err := s.Pack()
-	if err != nil {
-		log.Error("encode sample package error", lg.String("speaker", sp.String()), lg.Error(err))
-		return
-	}
-
-	err = sp.WriteUDP(p.Bytes())
+	err := writePacket(sp, s.Pack)
 	if err != nil {
 		log.Error("ControlSample error", lg.String("speaker", sp.String()), lg.Error(err))
 		return
@@ -14,8 +14,8 @@ type Time struct {
 	offset uint16
 }
 
-func (s *Time) Pack() (p *protocol.Package, err error) {
-	p, err = s.f.Pack()
+func (s *Time) Pack(p *protocol.Package) (err error) {
+	s.f.Pack(p)
 	p.WriteUint32(s.server)
 	p.WriteUint16(s.offset)
 
@@ -28,13 +28,7 @@ func ControlTime(sp *speaker.Speaker) {
 		f:      Control{Command_TIME, sp.ID},
 		server: uint32(time.Now().UnixMilli()),
 	}
-	p, err := t.Pack()
-	if err != nil {
-		log.Error("encode time package error", lg.Uint("speaker", uint64(sp.ID)), lg.Error(err))
-		return
-	}
-
-	err = sp.WriteUDP(p.Bytes())
+	err := writePacket(sp, t.Pack)
 	if err != nil {
 		log.Error("write speaker error", lg.Uint("speaker", uint64(sp.ID)), lg.Error(err))
 		return
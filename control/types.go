@@ -13,6 +13,7 @@ const (
 	Command_CHUNK
 	Command_TIME
 	Command_VOLUME
+	Command_IDLE
 
 	Command_MAX
 )
@@ -22,10 +23,24 @@ type Control struct {
 	spid speaker.SpeakerID
 }
 
-func (f *Control) Pack() (p *protocol.Package, err error) {
-	p = protocol.NewPackage(16)
+// 控制数据包的最大长度
+const controlPacketSize = 16
+
+func (f *Control) Pack(p *protocol.Package) (err error) {
 	p.WriteUint8(uint8(protocol.PT_Control))
 	p.WriteUint8(uint8((protocol.VERSION&0x0F)<<4) | uint8(f.cmd&0x0F))
 	p.WriteUint32(uint32(f.spid))
 	return
 }
+
+// 使用扬声器的数据包缓存发送
+func writePacket(sp *speaker.Speaker, pack func(p *protocol.Package) error) error {
+	data := sp.Packets.Get(controlPacketSize)
+	defer sp.Packets.Put(data)
+
+	p := protocol.FromBinary(data)
+	if err := pack(p); err != nil {
+		return err
+	}
+	return sp.WriteUDP(p.Bytes())
+}
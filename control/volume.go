@@ -12,11 +12,8 @@ type Volume struct {
 	Mute   bool
 }
 
-func (s *Volume) Pack(id speaker.SpeakerID) (p *protocol.Package, err error) {
-	s.f.cmd = Command_VOLUME
-	s.f.spid = id
-
-	p, _ = s.f.Pack()
+func (s *Volume) Pack(p *protocol.Package) (err error) {
+	s.f.Pack(p)
 	p.WriteUint8(uint8(s.Volume))
 	if s.Mute {
 		p.WriteUint8(1)
@@ -35,17 +32,12 @@ func ControlSpeakerVolume(sp *speaker.Speaker, vol float64, mute bool) {
 		return
 	}
 	s := Volume{
+		f:      Control{Command_VOLUME, sp.ID},
 		Volume: int(vol * 100),
 		Mute:   mute,
 	}
 
-	p, err := s.Pack(sp.ID)
-	if err != nil {
-		log.Error("encode volume package error", lg.Uint("speaker", uint64(sp.ID)), lg.Error(err))
-		return
-	}
-
-	err = sp.WriteUDP(p.Bytes())
+	err := writePacket(sp, s.Pack)
 	if err != nil {
 		log.Error("write speaker error", lg.Uint("speaker", uint64(sp.ID)), lg.Error(err))
 		return
@@ -0,0 +1,78 @@
+package decoder
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/zwcway/castserver-go/common/audio"
+	"github.com/zwcway/castserver-go/common/stream"
+)
+
+// 解码器连续没有输出的最长时间
+const clipIdleTimeout = 5 * time.Second
+
+// DecodeClip 将整个文件解码至内存，用于播报等短音频，超过 maxDuration 时返回错误
+func DecodeClip(file string, maxDuration time.Duration) (*stream.Samples, error) {
+	fs, err := newFileStreamer()
+	if err != nil {
+		return nil, err
+	}
+	if err := fs.OpenFile(file); err != nil {
+		return nil, err
+	}
+	defer fs.Close()
+	fs.SetPause(false)
+
+	out := audio.InternalFormat()
+	out.InitFrom(fs.AudioFormat())
+
+	var (
+		buf    = stream.NewSamples(4096, out)
+		format audio.Format
+		data   [][]byte
+		max    int
+		idle   time.Time
+	)
+	for !fs.IsFinished() {
+		buf.LastNbSamples = 0
+		fs.Stream(buf)
+		if buf.LastNbSamples == 0 {
+			if buf.LastErr != nil && !fs.IsFinished() {
+				return nil, buf.LastErr
+			}
+			if idle.IsZero() {
+				idle = time.Now()
+			} else if time.Since(idle) > clipIdleTimeout {
+				return nil, fmt.Errorf("clip decoding stalled for %s", clipIdleTimeout)
+			}
+			time.Sleep(time.Millisecond)
+			continue
+		}
+		idle = time.Time{}
+		if !format.IsValid() {
+			format = buf.Format
+			data = make([][]byte, format.Count)
+			max = int(maxDuration.Seconds() * float64(format.Rate.ToInt()))
+		} else if buf.Format != format {
+			return nil, fmt.Errorf("clip format changed")
+		}
+		for ch := range data {
+			data[ch] = append(data[ch], buf.RawData[ch][:buf.LastSamplesSize()]...)
+		}
+		if max > 0 && len(data[0]) > format.SamplesSize(max) {
+			return nil, fmt.Errorf("clip longer than %s", maxDuration)
+		}
+	}
+	if len(data) == 0 || len(data[0]) == 0 {
+		return nil, fmt.Errorf("clip is empty")
+	}
+
+	n := len(data[0]) / format.Bits.Size()
+	clip := stream.NewSamples(n, format)
+	clip.SetChannelIndex(buf.ChannelIndex)
+	for ch := range data {
+		copy(clip.RawData[ch], data[ch])
+	}
+	clip.LastNbSamples = n
+	return clip, nil
+}
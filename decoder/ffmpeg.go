@@ -0,0 +1,20 @@
+//go:build cgo
+// +build cgo
+
+package decoder
+
+import (
+	"github.com/zwcway/castserver-go/common/audio"
+	"github.com/zwcway/castserver-go/common/playlist"
+	"github.com/zwcway/castserver-go/common/stream"
+	"github.com/zwcway/castserver-go/decoder/ffmpeg"
+)
+
+// newFileStreamer 使用 ffmpeg 解码文件和网络流
+func newFileStreamer() (stream.FileStreamer, error) {
+	return ffmpeg.New(audio.InternalFormat()), nil
+}
+
+func audioInfo(url string, ai *playlist.AudioInfo) error {
+	return ffmpeg.AudioInfo(url, ai)
+}
@@ -15,6 +15,17 @@ static const int64_t go_seek_time(const AVStream *in, int seconds)
     return target_time;
 }
 
+// 返回内嵌封面所在的流，没有时返回 NULL
+static AVStream *go_attached_pic(const AVFormatContext *fmt)
+{
+    for (unsigned int i = 0; i < fmt->nb_streams; i++)
+    {
+        if (fmt->streams[i]->disposition & AV_DISPOSITION_ATTACHED_PIC)
+            return fmt->streams[i];
+    }
+    return NULL;
+}
+
 static const uint8_t go_get_array(const uint8_t *arr, int index)
 {
     return arr[index];
@@ -7,12 +7,16 @@ package ffmpeg
 import "C"
 import (
 	"fmt"
+	"io"
+	"os"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 	"unsafe"
 
 	"github.com/zwcway/castserver-go/common/audio"
+	"github.com/zwcway/castserver-go/common/config"
 	"github.com/zwcway/castserver-go/common/playlist"
 	"github.com/zwcway/castserver-go/common/stream"
 	"github.com/zwcway/castserver-go/decoder/ffmpeg/avutil"
@@ -34,9 +38,7 @@ func AudioInfo(f string, ai *playlist.AudioInfo) (err error) {
 	defer func() {
 		C.free(unsafe.Pointer(cFileName))
 		C.free(unsafe.Pointer(cEmptyStr))
-		if err != nil {
-			C.go_free(&ctx)
-		}
+		C.go_free(&ctx)
 	}()
 
 	rate := C.int(0)
@@ -62,18 +64,31 @@ func AudioInfo(f string, ai *playlist.AudioInfo) (err error) {
 	ai.Duration = time.Duration(ctx.formatCtx.duration) * time.Microsecond
 	ai.Position = time.Duration(ctx.duration) * time.Second
 
-	for {
-		tag = C.av_dict_get(ctx.formatCtx.metadata, cEmptyStr, tag, C.AV_DICT_IGNORE_SUFFIX)
-		if tag == nil {
-			break
+	rg := playlist.ReplayGain{}
+	// ReplayGain 可能在容器或者音频流的标签中
+	for _, meta := range []*C.AVDictionary{ctx.formatCtx.metadata, ctx.stream.metadata} {
+		tag = nil
+		for {
+			tag = C.av_dict_get(meta, cEmptyStr, tag, C.AV_DICT_IGNORE_SUFFIX)
+			if tag == nil {
+				break
+			}
+			key := strings.ToLower(C.GoString(tag.key))
+			val := C.GoString(tag.value)
+			if !ai.SetTag(key, val) {
+				rg.SetTag(key, val)
+			}
 		}
-		key := strings.ToLower(C.GoString(tag.key))
-		val := C.GoString(tag.value)
-		switch key {
-		case "title":
-			ai.Title = val
-		case "artist":
-			ai.Artist = val
+	}
+	if rg.HasTrack || rg.HasAlbum {
+		ai.ReplayGain = &rg
+	}
+
+	if st := C.go_attached_pic(ctx.formatCtx); ai.ReadCover && st != nil && st.attached_pic.size > 0 {
+		ai.Cover = C.GoBytes(unsafe.Pointer(st.attached_pic.data), st.attached_pic.size)
+		ai.CoverMime = "image/jpeg"
+		if st.codecpar.codec_id == C.AV_CODEC_ID_PNG {
+			ai.CoverMime = "image/png"
 		}
 	}
 	return nil
@@ -83,6 +98,7 @@ type AVFormatContext struct {
 	format   audio.Format
 	fileName string
 	pause    bool
+	pauseAt  atomic.Int64 // 暂停后继续解码至该时间（UnixNano），供混音器淡出
 	finished bool
 
 	ctx                *C.GOAVDecoder
@@ -95,12 +111,63 @@ type AVFormatContext struct {
 	posDecodeNbSamples  int // 每次读取后，buffer中还剩下的每声道的samples数量
 	pos                 int // 当前已解码的位置
 
+	// 网络电台，通过管道读取
+	input io.ReadCloser
+	pipe  *os.File
+
 	lock sync.Mutex
 }
 
 func (c *AVFormatContext) OpenFile(fileName string) (err error) {
+	c.Close()
+	return c.open(fileName, fileName)
+}
+
+// OpenStream 通过管道从 r 解码，Close 时关闭 r
+func (c *AVFormatContext) OpenStream(name string, r io.ReadCloser) error {
+	c.Close()
+
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		r.Close()
+		return err
+	}
+
+	c.lock.Lock()
+	c.input = r
+	c.pipe = pr
+	c.lock.Unlock()
+
+	go func() {
+		io.Copy(pw, r)
+		pw.Close()
+	}()
+
+	// Fd 会将读取端设置为阻塞模式。失败时由 Close 关闭 r
+	return c.open(fmt.Sprintf("pipe:%d", pr.Fd()), name)
+}
+
+func (c *AVFormatContext) IsLive() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.input != nil
+}
+
+func (c *AVFormatContext) Metadata() (title string, artist string) {
+	c.lock.Lock()
+	mr, ok := c.input.(stream.MetadataReader)
+	c.lock.Unlock()
+
+	if ok {
+		return mr.Metadata()
+	}
+	return "", ""
+}
+
+func (c *AVFormatContext) open(path string, fileName string) (err error) {
 	c.fileName = fileName
-	cFileName := C.CString(fileName)
+	cFileName := C.CString(path)
 
 	defer func() {
 		C.free(unsafe.Pointer(cFileName))
@@ -109,8 +176,6 @@ func (c *AVFormatContext) OpenFile(fileName string) (err error) {
 		}
 	}()
 
-	c.Close()
-
 	rate := C.int(0)
 	format := C.enum_AVSampleFormat(C.AV_SAMPLE_FMT_NONE)
 	channels := C.int(0)
@@ -148,6 +213,7 @@ func (c *AVFormatContext) OpenFile(fileName string) (err error) {
 	}
 
 	stream.BusSourceFormatChanged.Dispatch(c, &c.format, c.channelIndex)
+	stream.BusSourceOpened.Dispatch(c, fileName)
 
 	return nil
 }
@@ -245,14 +311,35 @@ func (c *AVFormatContext) Position() int {
 	return int(c.ctx.avFrame.pkt_pos)
 }
 
+// SetPause 不等待淡出，暂停后继续解码至淡出结束
 func (c *AVFormatContext) SetPause(p bool) {
+	if p == c.pause {
+		return
+	}
+	if p && !c.finished {
+		c.pauseAt.Store(time.Now().Add(config.VolumeFadeDuration).UnixNano())
+	} else {
+		c.pauseAt.Store(0)
+	}
 	c.pause = p
+	if !p || !c.finished {
+		stream.BusSourcePause.Dispatch(c, p)
+	}
+}
+
+// 暂停并且淡出已经结束
+func (c *AVFormatContext) isHalted() bool {
+	return c.finished || c.pause && time.Now().UnixNano() >= c.pauseAt.Load()
 }
 
 func (c *AVFormatContext) IsPaused() bool {
 	return c.pause
 }
 
+func (c *AVFormatContext) IsFinished() bool {
+	return c.finished
+}
+
 func (c *AVFormatContext) decode() (n int, err error) {
 	ret := C.go_decode(c.ctx)
 	if ret < 0 {
@@ -286,7 +373,7 @@ func (c *AVFormatContext) Stream(samples *stream.Samples) {
 
 	samples.SetFormatAndIndex(c.outputFmt, c.channelIndex)
 
-	if c.pause || c.finished {
+	if c.isHalted() {
 		// samples.BeZero()
 		return
 	}
@@ -300,6 +387,7 @@ func (c *AVFormatContext) Stream(samples *stream.Samples) {
 				if c.ctx.finished > C.int(0) {
 					c.finished = true
 					c.pause = true
+					stream.BusSourceFinished.Dispatch(c)
 				}
 				// 余下数据置零
 				samples.BeZeroLeft(samples.RequestNbSamples - nbSamples)
@@ -334,6 +422,14 @@ func (c *AVFormatContext) Seek(p time.Duration) error {
 }
 
 func (c *AVFormatContext) Close() error {
+	c.lock.Lock()
+	input := c.input
+	c.lock.Unlock()
+	if input != nil {
+		// 先断开连接，使正在等待数据的解码返回
+		input.Close()
+	}
+
 	c.lock.Lock()
 	defer c.lock.Unlock()
 
@@ -341,8 +437,14 @@ func (c *AVFormatContext) Close() error {
 	c.lastDecodeNbSamples = 0
 	c.posDecodeNbSamples = 0
 	c.pause = true
+	c.pauseAt.Store(0)
 	C.go_free(&c.ctx)
 	c.ctx = nil
+	if c.pipe != nil {
+		c.pipe.Close()
+		c.pipe = nil
+	}
+	c.input = nil
 	return nil
 }
 
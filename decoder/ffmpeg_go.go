@@ -0,0 +1,22 @@
+//go:build !cgo
+// +build !cgo
+
+package decoder
+
+import (
+	"errors"
+
+	"github.com/zwcway/castserver-go/common/playlist"
+	"github.com/zwcway/castserver-go/common/stream"
+)
+
+var errNoDecoder = errors.New("decoder requires cgo")
+
+// newFileStreamer 没有 ffmpeg 时无法解码文件
+func newFileStreamer() (stream.FileStreamer, error) {
+	return nil, errNoDecoder
+}
+
+func audioInfo(url string, ai *playlist.AudioInfo) error {
+	return errNoDecoder
+}
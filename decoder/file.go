@@ -1,24 +1,78 @@
 package decoder
 
 import (
-	"github.com/zwcway/castserver-go/common/audio"
 	"github.com/zwcway/castserver-go/common/speaker"
 	"github.com/zwcway/castserver-go/common/stream"
-	"github.com/zwcway/castserver-go/decoder/ffmpeg"
 )
 
-func FileStreamer(uuid string) stream.FileStreamer {
+func FileStreamer(uuid string) (stream.FileStreamer, error) {
 	l := speaker.FindLineByUUID(uuid)
 	return FileStreamerFromLine(l)
 }
 
-func FileStreamerFromLine(line *speaker.Line) stream.FileStreamer {
+func FileStreamerFromLine(line *speaker.Line) (stream.FileStreamer, error) {
 	fs := line.Input.FileStreamer()
 
 	if fs == nil {
-		fs = ffmpeg.New(audio.InternalFormat())
+		var err error
+		if fs, err = newFileStreamer(); err != nil {
+			return nil, err
+		}
 		line.ApplyInput(fs)
 	}
 
-	return fs
+	return fs, nil
+}
+
+// OpenFile 在线路上打开文件。
+// 线路正在播放时，由混音器按照交叉淡化设置从当前文件过渡至新文件
+func OpenFile(line *speaker.Line, file string) (stream.FileStreamer, error) {
+	cur := line.Input.FileStreamer()
+	if cur == nil || !cur.IsPlaying() {
+		fs, err := FileStreamerFromLine(line)
+		if err != nil {
+			return nil, err
+		}
+		return fs, fs.OpenFile(file)
+	}
+
+	next, err := openFile(file)
+	if err != nil {
+		return nil, err
+	}
+	line.SwitchInput(next)
+
+	return next, nil
+}
+
+// OpenNextFile 预先打开下一个文件，当前文件结束时无缝衔接
+func OpenNextFile(line *speaker.Line, file string) error {
+	cur := line.Input.FileStreamer()
+	if cur == nil || cur.CurrentFile() == "" || cur.IsFinished() {
+		fs, err := FileStreamerFromLine(line)
+		if err != nil {
+			return err
+		}
+		return fs.OpenFile(file)
+	}
+
+	next, err := openFile(file)
+	if err != nil {
+		return err
+	}
+	line.SetNextInput(next)
+
+	return nil
+}
+
+func openFile(file string) (stream.FileStreamer, error) {
+	fs, err := newFileStreamer()
+	if err != nil {
+		return nil, err
+	}
+	if err := fs.OpenFile(file); err != nil {
+		return nil, err
+	}
+	fs.SetPause(false)
+	return fs, nil
 }
@@ -0,0 +1,245 @@
+package decoder
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 直播列表从倒数第几个分片开始播放
+const hlsLiveSegments = 3
+
+// 列表已经结束，不需要重新连接
+var errHlsEnded = errors.New("hls playlist ended")
+
+type hlsSegment struct {
+	seq int64
+	url string
+}
+
+type hlsPlaylist struct {
+	variants []string // 主列表中按照码率从高到低排列的子列表
+	segments []hlsSegment
+	target   time.Duration
+	end      bool
+}
+
+// parseM3U8 解析 HLS 列表，相对地址按照 base 转换
+func parseM3U8(base *url.URL, r io.Reader) (*hlsPlaylist, error) {
+	var (
+		pl        = &hlsPlaylist{target: 10 * time.Second}
+		scanner   = bufio.NewScanner(r)
+		seq       int64
+		segment   bool
+		variant   bool
+		bandwidth int
+		rates     []int
+	)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#EXT-X-TARGETDURATION:"):
+			if v, err := strconv.ParseFloat(line[22:], 64); err == nil && v > 0 {
+				pl.target = time.Duration(v * float64(time.Second))
+			}
+		case strings.HasPrefix(line, "#EXT-X-MEDIA-SEQUENCE:"):
+			seq, _ = strconv.ParseInt(line[22:], 10, 64)
+		case strings.HasPrefix(line, "#EXT-X-KEY:"):
+			if !strings.Contains(line, "METHOD=NONE") {
+				return nil, fmt.Errorf("encrypted hls not supported")
+			}
+		case line == "#EXT-X-ENDLIST":
+			pl.end = true
+		case strings.HasPrefix(line, "#EXTINF:"):
+			segment = true
+		case strings.HasPrefix(line, "#EXT-X-STREAM-INF:"):
+			variant = true
+			bandwidth = 0
+			for _, attr := range strings.Split(line[18:], ",") {
+				if v, ok := strings.CutPrefix(attr, "BANDWIDTH="); ok {
+					bandwidth, _ = strconv.Atoi(v)
+				}
+			}
+		case strings.HasPrefix(line, "#"):
+		default:
+			u, err := base.Parse(line)
+			if err != nil {
+				return nil, err
+			}
+			if variant {
+				// 按照码率插入
+				i := 0
+				for i < len(rates) && rates[i] >= bandwidth {
+					i++
+				}
+				rates = append(rates[:i], append([]int{bandwidth}, rates[i:]...)...)
+				pl.variants = append(pl.variants[:i], append([]string{u.String()}, pl.variants[i:]...)...)
+			} else if segment {
+				pl.segments = append(pl.segments, hlsSegment{seq: seq, url: u.String()})
+				seq++
+			}
+			segment, variant = false, false
+		}
+	}
+	return pl, scanner.Err()
+}
+
+// hlsReader 依次下载媒体列表中的分片，直播时按照分片时长重新读取列表
+type hlsReader struct {
+	cli  *http.Client
+	url  string
+	done chan struct{}
+
+	queue  []hlsSegment
+	next   int64 // 下一个分片的序号
+	target time.Duration
+	end    bool
+	loaded time.Time
+
+	locker sync.Mutex
+	body   io.ReadCloser
+	closed bool
+}
+
+// newHlsReader 使用已经读取的列表，主列表时选择码率最高的子列表
+func newHlsReader(cli *http.Client, u string, pl *hlsPlaylist) (*hlsReader, error) {
+	r := &hlsReader{
+		cli:  cli,
+		url:  u,
+		done: make(chan struct{}),
+		next: -1,
+	}
+	if len(pl.variants) > 0 {
+		var err error
+		r.url = pl.variants[0]
+		if pl, err = r.fetch(); err != nil {
+			return nil, err
+		}
+	}
+	r.update(pl)
+	return r, nil
+}
+
+func (r *hlsReader) fetch() (*hlsPlaylist, error) {
+	base, err := url.Parse(r.url)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.cli.Get(r.url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("hls playlist %s", resp.Status)
+	}
+	r.loaded = time.Now()
+	return parseM3U8(base, resp.Body)
+}
+
+func (r *hlsReader) update(pl *hlsPlaylist) {
+	r.target = pl.target
+	r.end = pl.end
+	segs := pl.segments
+	if r.next < 0 && !pl.end && len(segs) > hlsLiveSegments {
+		segs = segs[len(segs)-hlsLiveSegments:]
+	}
+	for _, s := range segs {
+		if s.seq >= r.next {
+			r.queue = append(r.queue, s)
+			r.next = s.seq + 1
+		}
+	}
+	if r.next < 0 {
+		r.next = 0
+	}
+}
+
+func (r *hlsReader) Read(p []byte) (int, error) {
+	for {
+		r.locker.Lock()
+		body, closed := r.body, r.closed
+		r.locker.Unlock()
+		if closed {
+			return 0, io.ErrClosedPipe
+		}
+
+		if body != nil {
+			n, err := body.Read(p)
+			if err == io.EOF {
+				r.setBody(nil)
+				if n > 0 {
+					return n, nil
+				}
+				continue
+			}
+			return n, err
+		}
+
+		if len(r.queue) == 0 {
+			if r.end {
+				return 0, errHlsEnded
+			}
+			// 等待直播列表更新
+			select {
+			case <-r.done:
+				return 0, io.ErrClosedPipe
+			case <-time.After(time.Until(r.loaded.Add(r.target / 2))):
+			}
+			pl, err := r.fetch()
+			if err != nil {
+				return 0, err
+			}
+			r.update(pl)
+			continue
+		}
+
+		s := r.queue[0]
+		r.queue = r.queue[1:]
+		resp, err := r.cli.Get(s.url)
+		if err != nil {
+			return 0, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return 0, fmt.Errorf("hls segment %s", resp.Status)
+		}
+		r.setBody(resp.Body)
+	}
+}
+
+func (r *hlsReader) setBody(body io.ReadCloser) {
+	r.locker.Lock()
+	defer r.locker.Unlock()
+
+	if r.body != nil {
+		r.body.Close()
+	}
+	r.body = body
+	if r.closed && body != nil {
+		body.Close()
+	}
+}
+
+func (r *hlsReader) Close() error {
+	r.locker.Lock()
+	defer r.locker.Unlock()
+
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	close(r.done)
+	if r.body != nil {
+		r.body.Close()
+	}
+	return nil
+}
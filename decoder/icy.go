@@ -0,0 +1,91 @@
+package decoder
+
+import (
+	"io"
+	"strings"
+)
+
+// icyReader 去除 Shoutcast/Icecast 每 metaint 字节插入的元数据
+type icyReader struct {
+	r       io.Reader
+	metaint int
+	left    int // 距离下一个元数据块的字节数
+	meta    []byte
+	onMeta  func(title string)
+}
+
+func newIcyReader(r io.Reader, metaint int, onMeta func(title string)) *icyReader {
+	return &icyReader{
+		r:       r,
+		metaint: metaint,
+		left:    metaint,
+		onMeta:  onMeta,
+	}
+}
+
+func (r *icyReader) Read(p []byte) (n int, err error) {
+	if r.metaint <= 0 {
+		return r.r.Read(p)
+	}
+	if r.left == 0 {
+		if err = r.readMeta(); err != nil {
+			return 0, err
+		}
+		r.left = r.metaint
+	}
+	if len(p) > r.left {
+		p = p[:r.left]
+	}
+	n, err = r.r.Read(p)
+	r.left -= n
+	return
+}
+
+// 元数据块的第一个字节为长度，单位 16 字节
+func (r *icyReader) readMeta() error {
+	var size [1]byte
+	if _, err := io.ReadFull(r.r, size[:]); err != nil {
+		return err
+	}
+	if size[0] == 0 {
+		return nil
+	}
+	if n := int(size[0]) * 16; cap(r.meta) < n {
+		r.meta = make([]byte, n)
+	} else {
+		r.meta = r.meta[:n]
+	}
+	if _, err := io.ReadFull(r.r, r.meta); err != nil {
+		return err
+	}
+	if title, ok := parseIcyMeta(string(r.meta)); ok && r.onMeta != nil {
+		r.onMeta(title)
+	}
+	return nil
+}
+
+// parseIcyMeta 解析 StreamTitle='...';StreamUrl='...';
+func parseIcyMeta(meta string) (title string, ok bool) {
+	meta = strings.TrimRight(meta, "\x00")
+	const key = "StreamTitle='"
+	i := strings.Index(meta, key)
+	if i < 0 {
+		return "", false
+	}
+	meta = meta[i+len(key):]
+	// 标题中可能有单引号，以 '; 结束
+	if j := strings.Index(meta, "';"); j >= 0 {
+		meta = meta[:j]
+	} else {
+		meta = strings.TrimSuffix(meta, "'")
+	}
+	return strings.TrimSpace(meta), true
+}
+
+// splitStreamTitle 将 "艺术家 - 标题" 拆分
+func splitStreamTitle(s string) (title string, artist string) {
+	if i := strings.Index(s, " - "); i > 0 {
+		return strings.TrimSpace(s[i+3:]), strings.TrimSpace(s[:i])
+	}
+	return s, ""
+}
@@ -3,30 +3,35 @@ package decoder
 import (
 	"github.com/zwcway/castserver-go/common/audio"
 	"github.com/zwcway/castserver-go/common/bus"
+	lg "github.com/zwcway/castserver-go/common/log"
 	"github.com/zwcway/castserver-go/common/playlist"
 	"github.com/zwcway/castserver-go/common/stream"
 	"github.com/zwcway/castserver-go/common/utils"
-	"github.com/zwcway/castserver-go/decoder/ffmpeg"
 )
 
 var (
 	Module = decoderModule{}
+
+	radioLog lg.Logger
 )
 
 type decoderModule struct{}
 
 func (decoderModule) Init(ctx utils.Context) error {
+	radioLog = ctx.Logger("radio")
+
 	bus.Register("get audioinfo", func(o any, a ...any) error {
 		ai := a[0].(*playlist.AudioInfo)
 
-		return ffmpeg.AudioInfo(ai.Url, ai)
+		return audioInfo(ai.Url, ai)
 	})
 
+	// 唯一的转码实现，由构建标签和配置选择
 	stream.BusResample.Register(func(resample *stream.ResampleElement, format *audio.Format) error {
 		if format == nil {
-			*resample = NewResample(audio.InternalFormat())
+			*resample = newResample(audio.InternalFormat())
 		} else {
-			*resample = NewResample(*format)
+			*resample = newResample(*format)
 		}
 		return nil
 	})
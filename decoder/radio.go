@@ -0,0 +1,426 @@
+package decoder
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zwcway/castserver-go/common/config"
+	lg "github.com/zwcway/castserver-go/common/log"
+	"github.com/zwcway/castserver-go/common/speaker"
+	"github.com/zwcway/castserver-go/common/stream"
+)
+
+const (
+	// 超过该时长没有收到数据时重新连接
+	radioIdleTimeout = 15 * time.Second
+	// 电台列表文件的最大长度
+	radioPlaylistMax = 64 * 1024
+	// 电台列表嵌套的最大层数
+	radioPlaylistDepth = 3
+)
+
+var (
+	// 电台的连接不能设置总的超时时间
+	radioClient = &http.Client{
+		Transport: &http.Transport{
+			Proxy:                 http.ProxyFromEnvironment,
+			DialContext:           dialIcy,
+			ResponseHeaderTimeout: 10 * time.Second,
+			TLSHandshakeTimeout:   10 * time.Second,
+		},
+	}
+	// 列表和分片
+	hlsClient = &http.Client{Timeout: 30 * time.Second}
+)
+
+// RadioStream 网络电台，支持 Icecast/Shoutcast 和 HLS，断开后按照退避时间重新连接
+type RadioStream struct {
+	url     string
+	log     lg.Logger
+	backoff time.Duration // 第一次重试的等待时间
+	onMeta  func(title string, artist string)
+
+	locker sync.Mutex
+	conn   io.ReadCloser
+	done   chan struct{}
+	closed bool
+	title  string
+	artist string
+
+	retries  int  // 连续失败的次数
+	received bool // 当前连接是否收到过数据
+}
+
+func NewRadioStream(url string, log lg.Logger) *RadioStream {
+	return &RadioStream{
+		url:     url,
+		log:     log,
+		backoff: time.Second,
+		done:    make(chan struct{}),
+	}
+}
+
+func (r *RadioStream) Url() string {
+	return r.url
+}
+
+// Metadata 最近一次收到的标题
+func (r *RadioStream) Metadata() (title string, artist string) {
+	r.locker.Lock()
+	defer r.locker.Unlock()
+
+	return r.title, r.artist
+}
+
+// OnMetadata 标题变化时调用 f，在读取的协程中执行
+func (r *RadioStream) OnMetadata(f func(title string, artist string)) {
+	r.locker.Lock()
+	defer r.locker.Unlock()
+
+	r.onMeta = f
+}
+
+func (r *RadioStream) setMetadata(s string) {
+	title, artist := splitStreamTitle(s)
+
+	r.locker.Lock()
+	if r.title == title && r.artist == artist {
+		r.locker.Unlock()
+		return
+	}
+	r.title, r.artist = title, artist
+	f := r.onMeta
+	r.locker.Unlock()
+
+	if f != nil {
+		f(title, artist)
+	}
+}
+
+// Connect 建立第一次连接，用于在播放前检查地址是否可用
+func (r *RadioStream) Connect() error {
+	conn, err := r.open(r.url, 0)
+	if err != nil {
+		return err
+	}
+	return r.setConn(conn)
+}
+
+func (r *RadioStream) Read(p []byte) (int, error) {
+	for {
+		conn, err := r.current()
+		if err != nil {
+			return 0, err
+		}
+		n, err := conn.Read(p)
+		if n > 0 {
+			r.retries = 0
+			r.received = true
+			return n, nil
+		}
+		if r.isClosed() || err == errHlsEnded {
+			return 0, io.EOF
+		}
+		r.log.Info("radio disconnected", lg.String("url", r.url), lg.Error(err))
+		if !r.received {
+			r.retries++
+		}
+		r.setConn(nil)
+	}
+}
+
+// 当前的连接，断开时按照退避时间重新连接
+func (r *RadioStream) current() (io.ReadCloser, error) {
+	r.locker.Lock()
+	conn := r.conn
+	r.locker.Unlock()
+	if conn != nil {
+		return conn, nil
+	}
+
+	for {
+		if max := config.RadioRetries; max > 0 && r.retries >= max {
+			return nil, fmt.Errorf("radio %s retries exceeded", r.url)
+		}
+		if r.retries > 0 {
+			select {
+			case <-r.done:
+				return nil, io.EOF
+			case <-time.After(r.wait()):
+			}
+		}
+		conn, err := r.open(r.url, 0)
+		if err == nil {
+			r.received = false
+			return conn, r.setConn(conn)
+		}
+		if r.isClosed() {
+			return nil, io.EOF
+		}
+		r.log.Info("radio reconnect failed", lg.String("url", r.url), lg.Int("retries", int64(r.retries)), lg.Error(err))
+		r.retries++
+	}
+}
+
+// 等待时间从 backoff 开始加倍
+func (r *RadioStream) wait() time.Duration {
+	d := r.backoff
+	for i := 1; i < r.retries && d < config.RadioBackoffMax; i++ {
+		d *= 2
+	}
+	if d > config.RadioBackoffMax {
+		d = config.RadioBackoffMax
+	}
+	return d
+}
+
+func (r *RadioStream) setConn(conn io.ReadCloser) error {
+	r.locker.Lock()
+	defer r.locker.Unlock()
+
+	if r.conn != nil {
+		r.conn.Close()
+	}
+	r.conn = conn
+	if r.closed && conn != nil {
+		conn.Close()
+		r.conn = nil
+		return io.EOF
+	}
+	return nil
+}
+
+func (r *RadioStream) isClosed() bool {
+	r.locker.Lock()
+	defer r.locker.Unlock()
+
+	return r.closed
+}
+
+func (r *RadioStream) Close() error {
+	r.locker.Lock()
+	defer r.locker.Unlock()
+
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	close(r.done)
+	if r.conn != nil {
+		r.conn.Close()
+		r.conn = nil
+	}
+	return nil
+}
+
+// 连接 u，电台列表时连接其中的第一个地址
+func (r *RadioStream) open(u string, depth int) (io.ReadCloser, error) {
+	if depth > radioPlaylistDepth {
+		return nil, fmt.Errorf("radio playlist nested too deep")
+	}
+	base, err := url.Parse(u)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Icy-MetaData", "1")
+
+	resp, err := radioClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("radio %s", resp.Status)
+	}
+
+	var (
+		ct  = strings.ToLower(resp.Header.Get("Content-Type"))
+		ext = strings.ToLower(path.Ext(base.Path))
+	)
+	if !isRadioPlaylist(ct, ext) {
+		metaint, _ := strconv.Atoi(resp.Header.Get("icy-metaint"))
+		return &radioConn{
+			Reader: newIcyReader(newIdleReader(resp.Body, radioIdleTimeout), metaint, r.setMetadata),
+			Closer: resp.Body,
+		}, nil
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, radioPlaylistMax))
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Contains(data, []byte("#EXT-X-")) {
+		pl, err := parseM3U8(base, bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		return newHlsReader(hlsClient, u, pl)
+	}
+
+	next, err := parseRadioPlaylist(base, data)
+	if err != nil {
+		return nil, err
+	}
+	return r.open(next, depth+1)
+}
+
+func isRadioPlaylist(contentType string, ext string) bool {
+	switch ext {
+	case ".m3u", ".m3u8", ".pls":
+		return true
+	}
+	return strings.Contains(contentType, "mpegurl") || strings.Contains(contentType, "scpls")
+}
+
+// parseRadioPlaylist 返回 pls 或者 m3u 中的第一个地址
+func parseRadioPlaylist(base *url.URL, data []byte) (string, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == '[' {
+			continue
+		}
+		if i := strings.IndexByte(line, '='); i > 0 {
+			// pls 的 File1=http://...
+			if !strings.HasPrefix(strings.ToLower(line), "file") {
+				continue
+			}
+			line = strings.TrimSpace(line[i+1:])
+		}
+		u, err := base.Parse(line)
+		if err != nil {
+			return "", err
+		}
+		return u.String(), nil
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", fmt.Errorf("radio playlist is empty")
+}
+
+type radioConn struct {
+	io.Reader
+	io.Closer
+}
+
+// idleReader 超过 timeout 没有读取到数据时关闭连接
+type idleReader struct {
+	r     io.ReadCloser
+	timer *time.Timer
+	d     time.Duration
+}
+
+func newIdleReader(r io.ReadCloser, d time.Duration) *idleReader {
+	return &idleReader{
+		r:     r,
+		d:     d,
+		timer: time.AfterFunc(d, func() { r.Close() }),
+	}
+}
+
+func (r *idleReader) Read(p []byte) (int, error) {
+	r.timer.Reset(r.d)
+	n, err := r.r.Read(p)
+	if err != nil {
+		r.timer.Stop()
+	}
+	return n, err
+}
+
+// Shoutcast v1 的响应以 "ICY 200 OK" 开头，替换为 HTTP/1.0 后由 net/http 解析
+func dialIcy(ctx context.Context, network string, addr string) (net.Conn, error) {
+	conn, err := (&net.Dialer{Timeout: 10 * time.Second}).DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	return &icyConn{Conn: conn}, nil
+}
+
+type icyConn struct {
+	net.Conn
+	checked bool
+	pending []byte
+}
+
+func (c *icyConn) Read(p []byte) (int, error) {
+	if len(c.pending) > 0 {
+		n := copy(p, c.pending)
+		c.pending = c.pending[n:]
+		return n, nil
+	}
+	if c.checked {
+		return c.Conn.Read(p)
+	}
+
+	var buf [4]byte
+	n, err := io.ReadAtLeast(c.Conn, buf[:], len(buf))
+	c.checked = true
+	c.pending = buf[:n]
+	if n == len(buf) && string(buf[:]) == "ICY " {
+		c.pending = []byte("HTTP/1.0 ")
+	}
+	if n == 0 {
+		return 0, err
+	}
+	return c.Read(p)
+}
+
+// OpenRadio 在线路上播放网络电台，线路正在播放时按照交叉淡化设置过渡
+func OpenRadio(line *speaker.Line, url string) (stream.FileStreamer, error) {
+	rs := NewRadioStream(url, radioLog)
+	if err := rs.Connect(); err != nil {
+		return nil, err
+	}
+
+	cur := line.Input.FileStreamer()
+	if cur == nil || !cur.IsPlaying() {
+		fs, err := FileStreamerFromLine(line)
+		if err != nil {
+			rs.Close()
+			return nil, err
+		}
+		return fs, openRadio(fs, rs)
+	}
+
+	next, err := newFileStreamer()
+	if err != nil {
+		rs.Close()
+		return nil, err
+	}
+	if err := openRadio(next, rs); err != nil {
+		return nil, err
+	}
+	next.SetPause(false)
+	line.SwitchInput(next)
+
+	return next, nil
+}
+
+func openRadio(fs stream.FileStreamer, rs *RadioStream) error {
+	ls, ok := fs.(stream.LiveStreamer)
+	if !ok {
+		rs.Close()
+		return fmt.Errorf("live stream not supported")
+	}
+	rs.OnMetadata(func(title string, artist string) {
+		stream.BusSourceMetadata.Dispatch(fs, title, artist)
+	})
+	return ls.OpenStream(rs.Url(), rs)
+}
@@ -0,0 +1,266 @@
+package decoder
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zwcway/castserver-go/common/config"
+	lg "github.com/zwcway/castserver-go/common/log"
+)
+
+// icyBlock 按照 metaint 插入元数据
+func icyBlock(data string, metaint int, titles ...string) []byte {
+	var buf bytes.Buffer
+	for i := 0; len(data) > 0; i++ {
+		n := metaint
+		if n > len(data) {
+			n = len(data)
+		}
+		buf.WriteString(data[:n])
+		data = data[n:]
+		if n < metaint {
+			break
+		}
+		meta := ""
+		if i < len(titles) && titles[i] != "" {
+			meta = fmt.Sprintf("StreamTitle='%s';", titles[i])
+		}
+		size := (len(meta) + 15) / 16
+		buf.WriteByte(byte(size))
+		buf.WriteString(meta)
+		buf.Write(make([]byte, size*16-len(meta)))
+	}
+	return buf.Bytes()
+}
+
+func newTestRadio(u string) *RadioStream {
+	r := NewRadioStream(u, lg.NewMemroy())
+	r.backoff = time.Millisecond
+	return r
+}
+
+func TestIcyReader(t *testing.T) {
+	var titles []string
+	src := icyBlock("abcdefghijklmnopqrs", 4, "Artist - Song", "", "It's 'quoted'")
+	r := newIcyReader(iotest{bytes.NewReader(src)}, 4, func(title string) {
+		titles = append(titles, title)
+	})
+	data, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "abcdefghijklmnopqrs", string(data))
+	assert.Equal(t, []string{"Artist - Song", "It's 'quoted'"}, titles)
+
+	title, artist := splitStreamTitle("Artist - Song - Live")
+	assert.Equal(t, "Song - Live", title)
+	assert.Equal(t, "Artist", artist)
+	title, artist = splitStreamTitle("News")
+	assert.Equal(t, "News", title)
+	assert.Equal(t, "", artist)
+
+	_, ok := parseIcyMeta("StreamUrl='';")
+	assert.False(t, ok)
+}
+
+// iotest 每次只读取一个字节
+type iotest struct{ r io.Reader }
+
+func (r iotest) Read(p []byte) (int, error) {
+	if len(p) > 1 {
+		p = p[:1]
+	}
+	return r.r.Read(p)
+}
+
+func TestParseM3U8(t *testing.T) {
+	base, _ := url.Parse("http://radio.local/live/master.m3u8")
+	pl, err := parseM3U8(base, strings.NewReader(`#EXTM3U
+#EXT-X-STREAM-INF:BANDWIDTH=64000,CODECS="mp4a.40.5"
+low/index.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=128000,CODECS="mp4a.40.2"
+http://cdn.local/high/index.m3u8
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"http://cdn.local/high/index.m3u8", "http://radio.local/live/low/index.m3u8"}, pl.variants)
+
+	pl, err = parseM3U8(base, strings.NewReader(`#EXTM3U
+#EXT-X-TARGETDURATION:6
+#EXT-X-MEDIA-SEQUENCE:100
+#EXTINF:6.0,
+seg100.aac
+#EXTINF:6.0,
+/seg101.aac
+#EXT-X-ENDLIST
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, 6*time.Second, pl.target)
+	assert.True(t, pl.end)
+	assert.Equal(t, []hlsSegment{{100, "http://radio.local/live/seg100.aac"}, {101, "http://radio.local/seg101.aac"}}, pl.segments)
+
+	_, err = parseM3U8(base, strings.NewReader("#EXT-X-KEY:METHOD=AES-128,URI=\"key\"\n"))
+	assert.Error(t, err)
+}
+
+func TestRadioStream(t *testing.T) {
+	retries := config.RadioRetries
+	defer func() { config.RadioRetries = retries }()
+	config.RadioRetries = 3
+
+	t.Run("reconnect", func(t *testing.T) {
+		var (
+			locker sync.Mutex
+			conns  int
+			fail   bool
+		)
+		mux := http.NewServeMux()
+		mux.HandleFunc("/station.pls", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "audio/x-scpls")
+			fmt.Fprint(w, "[playlist]\nNumberOfEntries=1\nFile1=/stream\nTitle1=Test\n")
+		})
+		mux.HandleFunc("/stream", func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "1", r.Header.Get("Icy-MetaData"))
+			locker.Lock()
+			conns++
+			n := conns
+			locker.Unlock()
+
+			w.Header().Set("icy-metaint", "4")
+			switch {
+			case fail:
+				w.WriteHeader(http.StatusNotFound)
+			case n == 1:
+				// 发送一部分后断开
+				w.Write(icyBlock("abcdefgh", 4, "A - One"))
+			case n < 4:
+				// 连接成功但是没有数据
+				w.WriteHeader(http.StatusServiceUnavailable)
+			default:
+				w.Write(icyBlock("ijklm", 4, "B - Two"))
+			}
+		})
+		srv := httptest.NewServer(mux)
+		defer srv.Close()
+
+		var titles []string
+		r := newTestRadio(srv.URL + "/station.pls")
+		r.OnMetadata(func(title string, artist string) {
+			titles = append(titles, artist+":"+title)
+		})
+		assert.NoError(t, r.Connect())
+
+		buf := make([]byte, 13)
+		_, err := io.ReadFull(r, buf)
+		assert.NoError(t, err)
+		assert.Equal(t, "abcdefghijklm", string(buf))
+		assert.Equal(t, []string{"A:One", "B:Two"}, titles)
+		title, artist := r.Metadata()
+		assert.Equal(t, "Two", title)
+		assert.Equal(t, "B", artist)
+
+		// 之后连续失败
+		locker.Lock()
+		fail = true
+		locker.Unlock()
+		_, err = r.Read(buf)
+		assert.Error(t, err)
+		assert.NoError(t, r.Close())
+	})
+
+	t.Run("close", func(t *testing.T) {
+		block := make(chan struct{})
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("data"))
+			w.(http.Flusher).Flush()
+			<-block
+		}))
+		defer srv.Close()
+		defer close(block)
+
+		r := newTestRadio(srv.URL)
+		assert.NoError(t, r.Connect())
+		buf := make([]byte, 4)
+		_, err := io.ReadFull(r, buf)
+		assert.NoError(t, err)
+
+		// 关闭时结束正在等待的读取
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			r.Close()
+		}()
+		_, err = r.Read(buf)
+		assert.Equal(t, io.EOF, err)
+	})
+
+	t.Run("hls", func(t *testing.T) {
+		var (
+			locker sync.Mutex
+			last   = 4
+		)
+		mux := http.NewServeMux()
+		mux.HandleFunc("/master.m3u8", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+			fmt.Fprint(w, "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=64000\nmedia.m3u8\n")
+		})
+		mux.HandleFunc("/media.m3u8", func(w http.ResponseWriter, r *http.Request) {
+			locker.Lock()
+			defer locker.Unlock()
+
+			fmt.Fprint(w, "#EXTM3U\n#EXT-X-TARGETDURATION:0.02\n#EXT-X-MEDIA-SEQUENCE:0\n")
+			for i := 0; i <= last; i++ {
+				fmt.Fprintf(w, "#EXTINF:0.02,\nseg%d.ts\n", i)
+			}
+			if last >= 6 {
+				fmt.Fprint(w, "#EXT-X-ENDLIST\n")
+			}
+			last++
+		})
+		mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/seg"), ".ts"))
+		})
+		srv := httptest.NewServer(mux)
+		defer srv.Close()
+
+		r := newTestRadio(srv.URL + "/master.m3u8")
+		assert.NoError(t, r.Connect())
+		data, err := io.ReadAll(r)
+		assert.NoError(t, err)
+		// 直播从倒数第三个分片开始，列表结束后不再重新连接
+		assert.Equal(t, "23456", string(data))
+	})
+
+	t.Run("shoutcast", func(t *testing.T) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer ln.Close()
+		go func() {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			http.ReadRequest(bufio.NewReader(conn))
+			conn.Write([]byte("ICY 200 OK\r\nicy-name: Test\r\nicy-metaint: 4\r\n\r\n"))
+			conn.Write(icyBlock("abcd", 4, "Live"))
+		}()
+
+		r := newTestRadio("http://" + ln.Addr().String() + "/")
+		assert.NoError(t, r.Connect())
+		buf := make([]byte, 4)
+		_, err = io.ReadFull(r, buf)
+		assert.NoError(t, err)
+		assert.Equal(t, "abcd", string(buf))
+		r.Close()
+	})
+}
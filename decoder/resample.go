@@ -1,8 +1,14 @@
+//go:build cgo
+// +build cgo
+
 package decoder
 
 import (
 	"github.com/zwcway/castserver-go/common/audio"
 	"github.com/zwcway/castserver-go/common/bus"
+	"github.com/zwcway/castserver-go/common/config"
+	"github.com/zwcway/castserver-go/common/dsp"
+	"github.com/zwcway/castserver-go/common/element"
 	"github.com/zwcway/castserver-go/common/stream"
 	"github.com/zwcway/castserver-go/decoder/ffmpeg/resample"
 )
@@ -10,8 +16,12 @@ import (
 type Resample struct {
 	power  bool
 	format audio.Format
+	dither dsp.DitherMode
 
-	swrCtx *resample.Resample
+	swrCtx   *resample.Resample
+	rateCtx  *resample.Resample // 抖动之前转换采样率和声道，保持内部位宽
+	ditherer *dsp.Ditherer
+	tmp      [][]float64 // float32 格式时转换的缓存
 }
 
 func (r *Resample) Name() string {
@@ -30,6 +40,8 @@ func (r *Resample) Stream(samples *stream.Samples) {
 		return
 	}
 
+	r.applyDither(samples)
+
 	r.swrCtx.SetIn(samples.Format)
 
 	if r.swrCtx == nil || !r.swrCtx.Inited() {
@@ -40,6 +52,51 @@ func (r *Resample) Stream(samples *stream.Samples) {
 	r.swrCtx.Stream(samples)
 }
 
+// 在内部位宽下量化至目标位深，之后的位深转换没有误差。
+// float32 的尾数有 24 位，量化后的样本可以无损保存
+func (r *Resample) applyDither(samples *stream.Samples) {
+	bits := dsp.DitherBits(r.format.Bits)
+	if r.dither == dsp.NoDither || bits == 0 || !samples.IsFloat() {
+		return
+	}
+
+	f := r.format
+	f.Bits = samples.Format.Bits
+	if !samples.Format.Equal(f) {
+		if r.rateCtx == nil {
+			r.rateCtx = &resample.Resample{}
+		}
+		r.rateCtx.SetIn(samples.Format)
+		r.rateCtx.SetOut(f)
+		if !r.rateCtx.Inited() || r.rateCtx.Stream(samples) != nil {
+			return
+		}
+	}
+
+	var (
+		chs  = int(samples.Format.Count)
+		rate = samples.Format.Rate.ToInt()
+		d    = r.ditherer
+	)
+	if d == nil || d.Mode() != r.dither || d.Bits() != bits || d.Rate() != rate || d.Channels() != chs {
+		r.ditherer = dsp.NewDitherer(r.dither, bits, rate, chs)
+	}
+	if !samples.IsFloat32() {
+		r.ditherer.Process(samples.Data, samples.LastNbSamples)
+		return
+	}
+	if len(r.tmp) != chs {
+		r.tmp = make([][]float64, chs)
+	}
+	for ch := range r.tmp {
+		r.tmp[ch] = samples.Float64(ch, samples.LastNbSamples, r.tmp[ch])
+	}
+	r.ditherer.Process(r.tmp, samples.LastNbSamples)
+	for ch := range r.tmp {
+		samples.SetFloat64(ch, r.tmp[ch])
+	}
+}
+
 func (r *Resample) Sample(*float64, int, int) {}
 func (e *Resample) OnStarting() {
 }
@@ -74,10 +131,24 @@ func (r *Resample) Format() audio.Format {
 	return r.format
 }
 
+func (r *Resample) SetDither(m dsp.DitherMode) {
+	if !dsp.IsDitherModeValid(m) {
+		return
+	}
+	r.dither = m
+}
+
+func (r *Resample) Dither() dsp.DitherMode {
+	return r.dither
+}
+
 func (r *Resample) Close() error {
 	bus.UnregisterObj(r)
 
 	r.swrCtx.Close()
+	if r.rateCtx != nil {
+		r.rateCtx.Close()
+	}
 	return nil
 }
 
@@ -97,3 +168,11 @@ func NewResample(format audio.Format) stream.ResampleElement {
 
 	return r
 }
+
+// 按照配置选择转码实现
+func newResample(format audio.Format) stream.ResampleElement {
+	if config.ResampleEngine == config.ResampleEngineGo {
+		return element.NewResample(format)
+	}
+	return NewResample(format)
+}
@@ -0,0 +1,19 @@
+//go:build !cgo
+// +build !cgo
+
+package decoder
+
+import (
+	"github.com/zwcway/castserver-go/common/audio"
+	"github.com/zwcway/castserver-go/common/element"
+	"github.com/zwcway/castserver-go/common/stream"
+)
+
+// NewResample 没有 ffmpeg 时使用纯 Go 的转码
+func NewResample(format audio.Format) stream.ResampleElement {
+	return element.NewResample(format)
+}
+
+func newResample(format audio.Format) stream.ResampleElement {
+	return NewResample(format)
+}
@@ -1,10 +1,15 @@
+//go:build cgo
+// +build cgo
+
 package decoder
 
 import (
+	"math"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/zwcway/castserver-go/common/audio"
+	"github.com/zwcway/castserver-go/common/element"
 	"github.com/zwcway/castserver-go/common/stream"
 )
 
@@ -57,3 +62,56 @@ func TestResample_Stream(t *testing.T) {
 		assert.Equal(t, samples.ChannelBytes(0), want)
 	})
 }
+
+// 纯 Go 转码与 swresample 的采样率转换结果一致
+func TestResample_Parity(t *testing.T) {
+	var (
+		in  = audio.Format{Sample: audio.Sample{Rate: audio.AudioRate_44100, Bits: audio.Bits_DEFAULT}, Layout: audio.Layout10}
+		out = audio.Format{Sample: audio.Sample{Rate: audio.AudioRate_48000, Bits: audio.Bits_DEFAULT}, Layout: audio.Layout10}
+		ff  = NewResample(out)
+		gr  = element.NewResample(out)
+
+		ffOut, goOut []float64
+	)
+	ff.On()
+	gr.On()
+
+	for c, pos := 0, 0; c < 20; c++ {
+		a := stream.NewSamples(1024, in)
+		for i := 0; i < 1024; i++ {
+			a.Data[0][i] = 0.5 * math.Sin(2*math.Pi*1000*float64(pos+i)/44100)
+		}
+		a.LastNbSamples = 1024
+		pos += 1024
+		b := a.Clone()
+
+		ff.Stream(a)
+		gr.Stream(b)
+		ffOut = append(ffOut, a.Data[0][:a.LastNbSamples]...)
+		goOut = append(goOut, b.Data[0][:b.LastNbSamples]...)
+	}
+
+	// 两者的延迟不同，按照互相关对齐后比较
+	n := len(goOut)
+	if len(ffOut) < n {
+		n = len(ffOut)
+	}
+	assert.InDelta(t, len(ffOut), len(goOut), 64)
+
+	best, lag := math.Inf(1), 0
+	for d := -64; d <= 64; d++ {
+		var e float64
+		for k := 1000; k < n-1000; k++ {
+			x := goOut[k] - ffOut[k+d]
+			e += x * x
+		}
+		if e < best {
+			best, lag = e, d
+		}
+	}
+	var p float64
+	for k := 1000; k < n-1000; k++ {
+		p += ffOut[k+lag] * ffOut[k+lag]
+	}
+	assert.Less(t, 10*math.Log10(best/p), -60.0, "lag %d", lag)
+}
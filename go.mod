@@ -4,6 +4,7 @@ go 1.20
 
 require (
 	github.com/fasthttp/websocket v1.5.1
+	github.com/fsnotify/fsnotify v1.6.0
 	github.com/go-ini/ini v1.67.0
 	github.com/hajimehoshi/oto/v2 v2.3.1
 	github.com/jackpal/gateway v1.0.7
@@ -12,7 +13,6 @@ require (
 	github.com/pkg/errors v0.9.1
 	github.com/stretchr/testify v1.8.4
 	github.com/valyala/fasthttp v1.44.0
-	github.com/zwcway/fasthttp-upnp v0.0.0-20230327113116-cfeb3e90ec00
 	go.uber.org/zap v1.24.0
 	golang.org/x/exp v0.0.0-20230303215020-44a13b063f3e
 	golang.org/x/net v0.8.0
@@ -56,5 +56,3 @@ require (
 )
 
 replace github.com/zwcway/castserver-go => ./
-
-// replace github.com/zwcway/fasthttp-upnp => ../upnp
@@ -0,0 +1,312 @@
+package indexer
+
+import (
+	"fmt"
+	"mime"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/zwcway/castserver-go/common/bus"
+	"github.com/zwcway/castserver-go/common/config"
+	"github.com/zwcway/castserver-go/common/library"
+	"github.com/zwcway/castserver-go/common/playlist"
+)
+
+type Artist struct {
+	Name   string
+	Albums int
+	Tracks int
+}
+
+type Album struct {
+	Name     string
+	Artist   string
+	Year     int
+	Tracks   int
+	Duration time.Duration
+	Cover    library.TrackID // 有封面的曲目，0 表示没有
+}
+
+// Status 返回曲目数量、是否正在扫描和上一次扫描的时间
+func Status() (count int, busy bool, last time.Time) {
+	locker.RLock()
+	defer locker.RUnlock()
+
+	return len(tracks), scanning.Load(), lastScan
+}
+
+// 复制满足 f 的曲目，必须持有锁
+func collect(f func(t *library.Track) bool) []library.Track {
+	list := []library.Track{}
+	for _, t := range tracks {
+		if f(t) {
+			list = append(list, *t)
+		}
+	}
+	return list
+}
+
+// 按照碟片、曲目序号和路径排序
+func sortTracks(list []library.Track) {
+	sort.Slice(list, func(i, j int) bool {
+		a, b := &list[i], &list[j]
+		if a.Disc != b.Disc {
+			return a.Disc < b.Disc
+		}
+		if a.TrackNo != b.TrackNo {
+			return a.TrackNo < b.TrackNo
+		}
+		return a.Path < b.Path
+	})
+}
+
+func less(a, b string) bool {
+	la, lb := strings.ToLower(a), strings.ToLower(b)
+	if la != lb {
+		return la < lb
+	}
+	return a < b
+}
+
+// Artists 按照专辑艺术家分组
+func Artists() []Artist {
+	locker.RLock()
+	defer locker.RUnlock()
+
+	var (
+		artists = map[string]*Artist{}
+		albums  = map[[2]string]bool{}
+	)
+	for _, t := range tracks {
+		name := t.AlbumKey()
+		a, ok := artists[name]
+		if !ok {
+			a = &Artist{Name: name}
+			artists[name] = a
+		}
+		a.Tracks++
+		if k := [2]string{name, t.Album}; !albums[k] {
+			albums[k] = true
+			a.Albums++
+		}
+	}
+
+	list := make([]Artist, 0, len(artists))
+	for _, a := range artists {
+		list = append(list, *a)
+	}
+	sort.Slice(list, func(i, j int) bool { return less(list[i].Name, list[j].Name) })
+	return list
+}
+
+// Albums 艺术家的专辑，artist 为 nil 时返回所有专辑
+func Albums(artist *string) []Album {
+	locker.RLock()
+	defer locker.RUnlock()
+
+	albums := map[[2]string]*Album{}
+	for _, t := range tracks {
+		name := t.AlbumKey()
+		if artist != nil && *artist != name {
+			continue
+		}
+		k := [2]string{name, t.Album}
+		a, ok := albums[k]
+		if !ok {
+			a = &Album{Name: t.Album, Artist: name}
+			albums[k] = a
+		}
+		a.Tracks++
+		a.Duration += t.Duration
+		if t.Year > a.Year {
+			a.Year = t.Year
+		}
+		if t.Cover != "" && (a.Cover == 0 || t.ID < a.Cover) {
+			a.Cover = t.ID
+		}
+	}
+
+	list := make([]Album, 0, len(albums))
+	for _, a := range albums {
+		list = append(list, *a)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		a, b := &list[i], &list[j]
+		if a.Artist != b.Artist {
+			return less(a.Artist, b.Artist)
+		}
+		if a.Year != b.Year {
+			return a.Year < b.Year
+		}
+		return less(a.Name, b.Name)
+	})
+	return list
+}
+
+// AlbumTracks 专辑中的曲目，按照曲目序号排列
+func AlbumTracks(artist string, album string) []library.Track {
+	locker.RLock()
+	defer locker.RUnlock()
+
+	list := collect(func(t *library.Track) bool {
+		return t.Album == album && t.AlbumKey() == artist
+	})
+	sortTracks(list)
+	return list
+}
+
+// Folder 返回目录中的子目录和曲目，dir 为空时返回音乐库的目录
+func Folder(dir string) ([]string, []library.Track, error) {
+	if dir == "" {
+		return append([]string{}, config.LibraryDirs...), []library.Track{}, nil
+	}
+	dir = filepath.Clean(dir)
+	if !isLibraryPath(dir) {
+		return nil, nil, fmt.Errorf("%s is not in library", dir)
+	}
+
+	locker.RLock()
+	defer locker.RUnlock()
+
+	var (
+		sub  = map[string]bool{}
+		dirs = []string{}
+	)
+	for _, t := range tracks {
+		if t.Folder == dir || !isUnder(t.Folder, dir) {
+			continue
+		}
+		// 只取下一级目录
+		rel, _ := filepath.Rel(dir, t.Folder)
+		name := strings.SplitN(rel, string(filepath.Separator), 2)[0]
+		if !sub[name] {
+			sub[name] = true
+			dirs = append(dirs, filepath.Join(dir, name))
+		}
+	}
+	sort.Slice(dirs, func(i, j int) bool { return less(dirs[i], dirs[j]) })
+
+	list := collect(func(t *library.Track) bool { return t.Folder == dir })
+	sort.Slice(list, func(i, j int) bool { return less(list[i].Path, list[j].Path) })
+	return dirs, list, nil
+}
+
+// Search 标题、艺术家、专辑或者文件名包含所有关键字的曲目
+func Search(q string, limit int) []library.Track {
+	words := strings.Fields(strings.ToLower(q))
+	if len(words) == 0 {
+		return []library.Track{}
+	}
+
+	locker.RLock()
+	list := collect(func(t *library.Track) bool {
+		text := strings.ToLower(strings.Join([]string{t.Title, t.Artist, t.AlbumArtist, t.Album, filepath.Base(t.Path)}, "\n"))
+		for _, w := range words {
+			if !strings.Contains(text, w) {
+				return false
+			}
+		}
+		return true
+	})
+	locker.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		a, b := &list[i], &list[j]
+		if a.AlbumKey() != b.AlbumKey() {
+			return less(a.AlbumKey(), b.AlbumKey())
+		}
+		if a.Album != b.Album {
+			return less(a.Album, b.Album)
+		}
+		if a.Disc != b.Disc {
+			return a.Disc < b.Disc
+		}
+		if a.TrackNo != b.TrackNo {
+			return a.TrackNo < b.TrackNo
+		}
+		return a.Path < b.Path
+	})
+	if limit > 0 && len(list) > limit {
+		list = list[:limit]
+	}
+	return list
+}
+
+// Tracks 按照 ids 的顺序返回曲目，忽略不存在的
+func Tracks(ids ...library.TrackID) []library.Track {
+	locker.RLock()
+	defer locker.RUnlock()
+
+	list := make([]library.Track, 0, len(ids))
+	for _, id := range ids {
+		if t, ok := byID[id]; ok {
+			list = append(list, *t)
+		}
+	}
+	return list
+}
+
+func FindTrack(id library.TrackID) *library.Track {
+	locker.RLock()
+	defer locker.RUnlock()
+
+	if t, ok := byID[id]; ok {
+		c := *t
+		return &c
+	}
+	return nil
+}
+
+// Cover 读取曲目的封面
+func Cover(id library.TrackID) ([]byte, string, error) {
+	t := FindTrack(id)
+	if t == nil {
+		return nil, "", fmt.Errorf("track %d not exists", id)
+	}
+	if t.Cover == "" {
+		return nil, "", fmt.Errorf("track %d has no cover", id)
+	}
+
+	if t.Cover != t.Path {
+		data, err := os.ReadFile(t.Cover)
+		if err != nil {
+			return nil, "", err
+		}
+		return data, mime.TypeByExtension(filepath.Ext(t.Cover)), nil
+	}
+
+	ai := playlist.AudioInfo{Url: t.Path, ReadCover: true}
+	if err := bus.Dispatch("get audioinfo", &ai); err != nil {
+		return nil, "", err
+	}
+	if len(ai.Cover) == 0 {
+		return nil, "", fmt.Errorf("track %d has no cover", id)
+	}
+	return ai.Cover, ai.CoverMime, nil
+}
+
+// QueueItems 转换为队列的项目
+func QueueItems(list []library.Track) []playlist.QueueItem {
+	items := make([]playlist.QueueItem, len(list))
+	for i, t := range list {
+		items[i] = playlist.QueueItem{
+			Url:      t.Path,
+			Title:    t.Name(),
+			Artist:   t.Artist,
+			Duration: t.Duration,
+		}
+	}
+	return items
+}
+
+func isLibraryPath(p string) bool {
+	for _, dir := range config.LibraryDirs {
+		if isUnder(p, dir) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,32 @@
+package indexer
+
+import (
+	lg "github.com/zwcway/castserver-go/common/log"
+	"github.com/zwcway/castserver-go/common/utils"
+)
+
+var (
+	ctx utils.Context
+	log lg.Logger
+)
+
+type indexerModule struct{}
+
+var Module = indexerModule{}
+
+func (indexerModule) Init(c utils.Context) error {
+	ctx = c
+	log = ctx.Logger("library")
+	return nil
+}
+
+func (indexerModule) Start() error {
+	loadTracks()
+
+	go scanRoutine(ctx)
+	return nil
+}
+
+func (indexerModule) DeInit() {
+
+}
@@ -0,0 +1,301 @@
+package indexer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/zwcway/castserver-go/common/bus"
+	"github.com/zwcway/castserver-go/common/config"
+	"github.com/zwcway/castserver-go/common/library"
+	lg "github.com/zwcway/castserver-go/common/log"
+	"github.com/zwcway/castserver-go/common/playlist"
+	"github.com/zwcway/castserver-go/common/utils"
+)
+
+var (
+	tracks = map[string]*library.Track{} // 按照路径
+	byID   = map[library.TrackID]*library.Track{}
+	lastID library.TrackID
+	locker sync.RWMutex
+
+	scanning atomic.Bool
+	lastScan time.Time
+	rescan   = make(chan struct{}, 1)
+)
+
+// 读取保存的音乐库
+func loadTracks() {
+	list := []*library.Track{}
+	if err := library.BusGetTracks.Dispatch(&list); err != nil {
+		log.Error("load tracks failed", lg.Error(err))
+	}
+
+	locker.Lock()
+	defer locker.Unlock()
+
+	for _, t := range list {
+		put(t)
+	}
+}
+
+// 必须持有锁
+func put(t *library.Track) {
+	if old, ok := byID[t.ID]; ok && old.Path != t.Path {
+		delete(tracks, old.Path)
+	}
+	tracks[t.Path] = t
+	byID[t.ID] = t
+	if t.ID > lastID {
+		lastID = t.ID
+	}
+}
+
+// Rescan 立即重新扫描，正在扫描时忽略
+func Rescan() {
+	select {
+	case rescan <- struct{}{}:
+	default:
+	}
+}
+
+// 启动时和定时扫描整个音乐库，期间监视目录的变化，只更新变化的目录。
+// 无法监视时只依靠定时扫描
+func scanRoutine(ctx utils.Context) {
+	var tick <-chan time.Time
+	if config.LibraryRescan > 0 {
+		ticker := time.NewTicker(config.LibraryRescan)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	var (
+		w      = newWatcher()
+		events <-chan fsnotify.Event
+		errs   <-chan error
+		flush  <-chan time.Time
+	)
+	if w != nil {
+		defer w.Close()
+		events, errs, flush = w.Events, w.Errors, w.timer.C
+	}
+
+	full := true
+	for {
+		if full {
+			if s := update(ctx, config.LibraryDirs, false); s != nil {
+				w.watch(s.dirs, true)
+			}
+			full = false
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-tick:
+			full = true
+		case <-rescan:
+			full = true
+		case ev := <-events:
+			w.add(ev)
+		case err := <-errs:
+			log.Warn("watch library failed", lg.Error(err))
+		case <-flush:
+			if dirs := w.take(); len(dirs) > 0 {
+				if s := update(ctx, dirs, true); s != nil {
+					w.watch(s.dirs, false)
+				}
+			}
+		}
+	}
+}
+
+// 一次扫描的结果
+type scanner struct {
+	ctx     context.Context
+	seen    map[string]bool
+	changed []*library.Track
+	failed  []string // 无法读取的目录，其中的文件不删除
+	dirs    []string // 读取过的目录
+	added   int
+	updated int
+	removed int
+}
+
+// 扫描 dirs，只读取新增和变化的文件，返回添加、更新和删除的数量
+func scan(ctx context.Context, dirs []string) (added, updated, removed int) {
+	if s := update(ctx, dirs, false); s != nil {
+		return s.added, s.updated, s.removed
+	}
+	return
+}
+
+// 扫描 dirs。partial 为 true 时只删除 dirs 之中已经不存在的曲目，否则删除其它所有曲目。
+// 正在扫描或者被取消时返回 nil
+func update(ctx context.Context, dirs []string, partial bool) *scanner {
+	if !scanning.CompareAndSwap(false, true) {
+		return nil
+	}
+	defer scanning.Store(false)
+
+	s := &scanner{ctx: ctx, seen: map[string]bool{}}
+	for _, dir := range dirs {
+		s.scanDir(dir)
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	var gone []*library.Track
+	locker.Lock()
+	for _, t := range s.changed {
+		if t.ID == 0 {
+			lastID++
+			t.ID = lastID
+		}
+		put(t)
+	}
+	for p, t := range tracks {
+		if s.seen[p] || s.isFailed(p) || partial && !isUnderAny(p, dirs) {
+			continue
+		}
+		delete(tracks, p)
+		delete(byID, t.ID)
+		gone = append(gone, t)
+	}
+	if !partial {
+		lastScan = time.Now()
+	}
+	s.removed = len(gone)
+	locker.Unlock()
+
+	if len(s.changed) > 0 {
+		library.BusSaveTracks.Dispatch(s.changed)
+	}
+	if len(gone) > 0 {
+		library.BusTracksDeleted.Dispatch(gone)
+	}
+	if s.added+s.updated+len(gone) > 0 {
+		log.Info("library scanned", lg.Int("added", int64(s.added)), lg.Int("updated", int64(s.updated)), lg.Int("removed", int64(len(gone))))
+	}
+	library.BusScanFinished.Dispatch(s.added, s.updated, len(gone))
+	return s
+}
+
+func (s *scanner) scanDir(dir string) {
+	if s.ctx.Err() != nil {
+		return
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		log.Warn("read library dir failed", lg.String("dir", dir), lg.Error(err))
+		s.failed = append(s.failed, dir)
+		return
+	}
+	s.dirs = append(s.dirs, dir)
+
+	var files, images []string
+	for _, e := range entries {
+		name := e.Name()
+		if strings.HasPrefix(name, ".") {
+			continue
+		}
+		p := filepath.Join(dir, name)
+		if e.IsDir() {
+			// 不跟随目录的符号链接，避免循环
+			s.scanDir(p)
+			continue
+		}
+		if library.IsAudioFile(name) {
+			files = append(files, p)
+		} else {
+			images = append(images, p)
+		}
+	}
+
+	cover := library.CoverFile(images)
+	for _, p := range files {
+		s.scanFile(p, dir, cover)
+	}
+}
+
+func (s *scanner) scanFile(p string, dir string, cover string) {
+	fi, err := os.Stat(p)
+	if err != nil || !fi.Mode().IsRegular() {
+		return
+	}
+
+	locker.RLock()
+	old := tracks[p]
+	locker.RUnlock()
+
+	if old != nil && !old.IsChanged(fi.Size(), fi.ModTime()) {
+		s.seen[p] = true
+		if old.Cover == old.Path || old.Cover == cover {
+			return
+		}
+		// 目录中的封面变化
+		t := *old
+		t.Cover = cover
+		s.changed = append(s.changed, &t)
+		s.updated++
+		return
+	}
+
+	ai := playlist.AudioInfo{Url: p, ReadCover: true}
+	if err := bus.Dispatch("get audioinfo", &ai); err != nil {
+		log.Debug("read audio info failed", lg.String("file", p), lg.Error(err))
+		return
+	}
+	s.seen[p] = true
+
+	t := &library.Track{
+		Path:        p,
+		Folder:      dir,
+		Size:        fi.Size(),
+		ModTime:     fi.ModTime(),
+		Title:       ai.Title,
+		Artist:      ai.Artist,
+		Album:       ai.Album,
+		AlbumArtist: ai.AlbumArtist,
+		Genre:       ai.Genre,
+		TrackNo:     ai.Track,
+		Disc:        ai.Disc,
+		Year:        ai.Year,
+		Duration:    ai.Duration,
+		Cover:       cover,
+	}
+	if len(ai.Cover) > 0 {
+		t.Cover = p
+	}
+	if old != nil {
+		t.ID = old.ID
+		s.updated++
+	} else {
+		s.added++
+	}
+	s.changed = append(s.changed, t)
+}
+
+func (s *scanner) isFailed(p string) bool {
+	return isUnderAny(p, s.failed)
+}
+
+// p 是否为 dir 或者在 dir 之中
+func isUnder(p string, dir string) bool {
+	return p == dir || strings.HasPrefix(p, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
+
+func isUnderAny(p string, dirs []string) bool {
+	for _, dir := range dirs {
+		if isUnder(p, dir) {
+			return true
+		}
+	}
+	return false
+}
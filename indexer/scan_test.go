@@ -0,0 +1,224 @@
+package indexer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zwcway/castserver-go/common/bus"
+	"github.com/zwcway/castserver-go/common/config"
+	"github.com/zwcway/castserver-go/common/library"
+	"github.com/zwcway/castserver-go/common/playlist"
+	"github.com/zwcway/castserver-go/common/utils"
+)
+
+// 测试文件的内容为 "标题|艺术家|专辑|序号|cover"
+func testAudioInfo(o any, a ...any) error {
+	ai := a[0].(*playlist.AudioInfo)
+	data, err := os.ReadFile(ai.Url)
+	if err != nil {
+		return err
+	}
+	f := strings.Split(string(data), "|")
+	for len(f) < 5 {
+		f = append(f, "")
+	}
+	ai.Title, ai.Artist, ai.Album = f[0], f[1], f[2]
+	ai.Track, _ = strconv.Atoi(f[3])
+	ai.Duration = time.Minute
+	if f[4] == "cover" && ai.ReadCover {
+		ai.Cover = []byte("embedded")
+		ai.CoverMime = "image/jpeg"
+	}
+	return nil
+}
+
+func TestScan(t *testing.T) {
+	root := t.TempDir()
+	write := func(name string, data string) {
+		p := filepath.Join(root, name)
+		os.MkdirAll(filepath.Dir(p), 0755)
+		assert.NoError(t, os.WriteFile(p, []byte(data), 0644))
+	}
+	write("a/1.mp3", "One|A|First|1|cover")
+	write("a/2.flac", "Two|A|First|2")
+	write("a/notes.txt", "ignored")
+	write("b/c/3.ogg", "Three|B|Second|1")
+	write(".hidden/4.mp3", "Four|C|Hidden|1")
+	write("b/c/folder.jpg", "image")
+
+	config.LibraryDirs = []string{root}
+	defer func() { config.LibraryDirs = []string{} }()
+
+	added, updated, removed := scan(context.Background(), config.LibraryDirs)
+	assert.Equal(t, []int{3, 0, 0}, []int{added, updated, removed})
+
+	count, busy, last := Status()
+	assert.Equal(t, 3, count)
+	assert.False(t, busy)
+	assert.False(t, last.IsZero())
+
+	// 没有变化时不重新读取
+	added, updated, removed = scan(context.Background(), config.LibraryDirs)
+	assert.Equal(t, []int{0, 0, 0}, []int{added, updated, removed})
+
+	t.Run("browse", func(t *testing.T) {
+		artists := Artists()
+		assert.Equal(t, []Artist{{"A", 1, 2}, {"B", 1, 1}}, artists)
+
+		artist := "A"
+		albums := Albums(&artist)
+		if assert.Len(t, albums, 1) {
+			assert.Equal(t, "First", albums[0].Name)
+			assert.Equal(t, 2*time.Minute, albums[0].Duration)
+			assert.NotZero(t, albums[0].Cover)
+		}
+		assert.Len(t, Albums(nil), 2)
+
+		list := AlbumTracks("A", "First")
+		if assert.Len(t, list, 2) {
+			assert.Equal(t, "One", list[0].Name())
+			assert.Equal(t, "Two", list[1].Name())
+		}
+
+		dirs, list, err := Folder(root)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{filepath.Join(root, "a"), filepath.Join(root, "b")}, dirs)
+		assert.Empty(t, list)
+		dirs, list, err = Folder(filepath.Join(root, "b"))
+		assert.NoError(t, err)
+		assert.Equal(t, []string{filepath.Join(root, "b", "c")}, dirs)
+		assert.Empty(t, list)
+		_, _, err = Folder(filepath.Dir(root))
+		assert.Error(t, err)
+
+		found := Search("a two", 0)
+		if assert.Len(t, found, 1) {
+			assert.Equal(t, "Two", found[0].Title)
+		}
+		assert.Len(t, Search("first", 1), 1)
+		assert.Empty(t, Search("  ", 0))
+
+		items := QueueItems(Tracks(found[0].ID, 1000))
+		if assert.Len(t, items, 1) {
+			assert.Equal(t, filepath.Join(root, "a", "2.flac"), items[0].Url)
+		}
+	})
+
+	t.Run("cover", func(t *testing.T) {
+		list := Search("one", 0)
+		data, mime, err := Cover(list[0].ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "embedded", string(data))
+		assert.Equal(t, "image/jpeg", mime)
+
+		list = Search("three", 0)
+		data, _, err = Cover(list[0].ID)
+		assert.NoError(t, err)
+		assert.Equal(t, "image", string(data))
+
+		list = Search("two", 0)
+		_, _, err = Cover(list[0].ID)
+		assert.Error(t, err)
+	})
+
+	t.Run("rescan", func(t *testing.T) {
+		id := Search("two", 0)[0].ID
+
+		write("a/2.flac", "Two (live)|A|First|2")
+		write("a/cover.png", "image")
+		os.Remove(filepath.Join(root, "b", "c", "3.ogg"))
+		write("d/5.mp3", "Five|D|Third|1")
+
+		added, updated, removed := scan(context.Background(), config.LibraryDirs)
+		assert.Equal(t, []int{1, 1, 1}, []int{added, updated, removed})
+
+		// 修改的文件保持原来的编号
+		tr := FindTrack(id)
+		if assert.NotNil(t, tr) {
+			assert.Equal(t, "Two (live)", tr.Title)
+			assert.Equal(t, filepath.Join(root, "a", "cover.png"), tr.Cover)
+		}
+		assert.Empty(t, Search("three", 0))
+
+		// 无法读取的目录中的曲目不删除
+		added, updated, removed = scan(context.Background(), []string{filepath.Join(root, "missing")})
+		assert.Equal(t, 3, removed)
+		count, _, _ := Status()
+		assert.Equal(t, 0, count)
+	})
+}
+
+func TestWatch(t *testing.T) {
+	root := t.TempDir()
+	write := func(name string, data string) {
+		p := filepath.Join(root, name)
+		os.MkdirAll(filepath.Dir(p), 0755)
+		assert.NoError(t, os.WriteFile(p, []byte(data), 0644))
+	}
+	write("a/1.mp3", "One|A|First|1")
+	write("b/2.mp3", "Two|B|Second|1")
+
+	s := update(context.Background(), []string{root}, false)
+	if !assert.NotNil(t, s) {
+		return
+	}
+	w := newWatcher()
+	if !assert.NotNil(t, w) {
+		return
+	}
+	defer w.Close()
+	w.watch(s.dirs, true)
+	assert.ElementsMatch(t, []string{root, filepath.Join(root, "a"), filepath.Join(root, "b")}, w.WatchList())
+
+	write("a/3.mp3", "Three|A|First|2")
+	os.Remove(filepath.Join(root, "a", "1.mp3"))
+	write("c/d/4.mp3", "Four|C|Third|1")
+	write("a/.hidden", "ignored")
+
+	// 等待所有事件
+	for quiet := false; !quiet; {
+		select {
+		case ev := <-w.Events:
+			w.add(ev)
+		case <-time.After(100 * time.Millisecond):
+			quiet = true
+		}
+	}
+	dirs := w.take()
+	assert.Equal(t, []string{filepath.Join(root, "a"), filepath.Join(root, "c")}, dirs)
+	assert.Empty(t, w.take())
+
+	// 只删除更新的目录中不存在的曲目
+	s = update(context.Background(), dirs, true)
+	if assert.NotNil(t, s) {
+		assert.Equal(t, []int{2, 0, 1}, []int{s.added, s.updated, s.removed})
+		w.watch(s.dirs, false)
+	}
+	assert.Len(t, Search("two", 0), 1)
+	assert.Len(t, Search("four", 0), 1)
+	assert.Contains(t, w.WatchList(), filepath.Join(root, "c", "d"))
+
+	// 包含在其它目录之中的只更新一次
+	w.dirty[filepath.Join(root, "c", "d")] = true
+	w.dirty[filepath.Join(root, "c")] = true
+	w.dirty[filepath.Join(root, "missing")] = true
+	assert.Equal(t, []string{filepath.Join(root, "c")}, w.take())
+}
+
+func TestCoverFile(t *testing.T) {
+	assert.Equal(t, "x/Folder.JPG", library.CoverFile([]string{"x/back.jpg", "x/Folder.JPG", "x/album.png"}))
+	assert.Equal(t, "", library.CoverFile([]string{"x/cover.gif"}))
+}
+
+func TestMain(m *testing.M) {
+	bus.Init(utils.NewEmptyContext())
+	bus.Register("get audioinfo", testAudioInfo)
+	log = utils.NewEmptyContext().Logger("library")
+	os.Exit(m.Run())
+}
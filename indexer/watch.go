@@ -0,0 +1,120 @@
+package indexer
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	lg "github.com/zwcway/castserver-go/common/log"
+)
+
+// 最后一次变化之后等待的时间，合并复制文件等连续的变化
+const watchDelay = 2 * time.Second
+
+// 监视音乐库中的目录，记录发生变化的目录
+type watcher struct {
+	*fsnotify.Watcher
+
+	dirty map[string]bool // 等待更新的目录
+	timer *time.Timer
+}
+
+// 无法监视时返回 nil，nil 的方法不做任何事
+func newWatcher() *watcher {
+	fw, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Warn("watch library failed, rescan periodically only", lg.Error(err))
+		return nil
+	}
+	timer := time.NewTimer(watchDelay)
+	timer.Stop()
+
+	return &watcher{Watcher: fw, dirty: map[string]bool{}, timer: timer}
+}
+
+func (w *watcher) Close() error {
+	if w == nil {
+		return nil
+	}
+	w.timer.Stop()
+	return w.Watcher.Close()
+}
+
+// 监视扫描过的目录。full 为 true 时 dirs 是整个音乐库，移除其它目录
+func (w *watcher) watch(dirs []string, full bool) {
+	if w == nil {
+		return
+	}
+	for _, dir := range dirs {
+		if err := w.Add(dir); err != nil {
+			// 通常是超过了系统的监视数量限制，其余的由定时扫描处理
+			log.Warn("watch library dir failed", lg.String("dir", dir), lg.Error(err))
+			break
+		}
+	}
+	if !full {
+		return
+	}
+
+	keep := make(map[string]bool, len(dirs))
+	for _, dir := range dirs {
+		keep[dir] = true
+	}
+	for _, dir := range w.WatchList() {
+		if !keep[dir] {
+			w.Remove(dir)
+		}
+	}
+}
+
+// 记录变化的目录，等待 watchDelay 之后更新
+func (w *watcher) add(ev fsnotify.Event) {
+	if w == nil || ev.Op == fsnotify.Chmod || strings.HasPrefix(filepath.Base(ev.Name), ".") {
+		return
+	}
+
+	dir := filepath.Dir(ev.Name)
+	if ev.Has(fsnotify.Create) {
+		if fi, err := os.Stat(ev.Name); err == nil && fi.IsDir() {
+			// 新建或者移入的目录，扫描其中所有的文件
+			dir = ev.Name
+		}
+	}
+	w.dirty[dir] = true
+	w.timer.Reset(watchDelay)
+}
+
+// 取出等待更新的目录，去掉已经删除的和包含在其它目录之中的
+func (w *watcher) take() []string {
+	if w == nil {
+		return nil
+	}
+
+	var dirs []string
+	for dir := range w.dirty {
+		// 删除的目录由其上级目录的变化处理
+		if fi, err := os.Stat(dir); err == nil && fi.IsDir() {
+			dirs = append(dirs, dir)
+		}
+	}
+	w.dirty = map[string]bool{}
+
+	var list []string
+	for _, dir := range dirs {
+		nested := false
+		for _, d := range dirs {
+			if d != dir && isUnder(dir, d) {
+				nested = true
+				break
+			}
+		}
+		if !nested {
+			list = append(list, dir)
+		}
+	}
+	sort.Strings(list)
+	return list
+}
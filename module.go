@@ -6,9 +6,12 @@ import (
 	"github.com/zwcway/castserver-go/control"
 	"github.com/zwcway/castserver-go/decoder"
 	"github.com/zwcway/castserver-go/detector"
+	"github.com/zwcway/castserver-go/indexer"
 	"github.com/zwcway/castserver-go/mutexer"
+	"github.com/zwcway/castserver-go/player"
 	"github.com/zwcway/castserver-go/pusher"
 	"github.com/zwcway/castserver-go/receiver"
+	"github.com/zwcway/castserver-go/scheduler"
 	"github.com/zwcway/castserver-go/web"
 )
 
@@ -26,6 +29,9 @@ var mods = []Module{
 	pusher.Module,
 	control.Module,
 	receiver.Module,
+	scheduler.Module,
+	player.Module,
+	indexer.Module,
 	web.Module,
 }
 
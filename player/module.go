@@ -0,0 +1,39 @@
+package player
+
+import (
+	lg "github.com/zwcway/castserver-go/common/log"
+	"github.com/zwcway/castserver-go/common/speaker"
+	"github.com/zwcway/castserver-go/common/utils"
+)
+
+var (
+	ctx utils.Context
+	log lg.Logger
+)
+
+type playerModule struct{}
+
+var Module = playerModule{}
+
+func (playerModule) Init(c utils.Context) error {
+	ctx = c
+	log = ctx.Logger("player")
+
+	speaker.BusLineDeleted.Register(func(src *speaker.Line, dst *speaker.Line) error {
+		deleteQueue(src.ID)
+		return nil
+	})
+	speaker.BusLineInputFinished.Register(onInputFinished)
+	speaker.BusLineInputChanged.Register(onInputChanged).ASync()
+	return nil
+}
+
+func (playerModule) Start() error {
+	loadQueues()
+	loadStations()
+	return nil
+}
+
+func (playerModule) DeInit() {
+
+}
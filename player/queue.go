@@ -0,0 +1,305 @@
+package player
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/zwcway/castserver-go/common/bus"
+	lg "github.com/zwcway/castserver-go/common/log"
+	"github.com/zwcway/castserver-go/common/playlist"
+	"github.com/zwcway/castserver-go/common/speaker"
+	"github.com/zwcway/castserver-go/common/stream"
+	"github.com/zwcway/castserver-go/decoder"
+)
+
+var (
+	queues  = map[speaker.LineID]*playlist.Queue{}
+	pending = map[speaker.LineID]stream.FileStreamer{} // 混音器中等待衔接的下一首
+	locker  sync.Mutex
+)
+
+// 读取保存的队列
+func loadQueues() {
+	var (
+		states = []playlist.QueueState{}
+		items  = []playlist.QueueItem{}
+	)
+	if err := playlist.BusGetQueues.Dispatch(&states, &items); err != nil {
+		log.Error("load queues failed", lg.Error(err))
+	}
+
+	locker.Lock()
+	defer locker.Unlock()
+
+	for _, s := range states {
+		if speaker.FindLineByID(s.LineID) == nil {
+			continue
+		}
+		list := []playlist.QueueItem{}
+		for _, it := range items {
+			if it.LineID == s.LineID {
+				list = append(list, it)
+			}
+		}
+		queues[s.LineID] = playlist.LoadQueue(s, list)
+	}
+}
+
+// Queue 返回线路的播放队列，没有时新建
+func Queue(line speaker.LineID) *playlist.Queue {
+	locker.Lock()
+	defer locker.Unlock()
+
+	q, ok := queues[line]
+	if !ok {
+		q = playlist.NewQueue(line)
+		queues[line] = q
+	}
+	return q
+}
+
+func findQueue(line speaker.LineID) *playlist.Queue {
+	locker.Lock()
+	defer locker.Unlock()
+
+	return queues[line]
+}
+
+func deleteQueue(line speaker.LineID) {
+	locker.Lock()
+	q, ok := queues[line]
+	delete(queues, line)
+	delete(pending, line)
+	locker.Unlock()
+
+	if ok {
+		playlist.BusQueueDeleted.Dispatch(q)
+	}
+}
+
+func changed(q *playlist.Queue) {
+	playlist.BusQueueChanged.Dispatch(q)
+}
+
+// Add 读取音频信息后插入至 pos 之前，pos 为 -1 时添加至最后
+func Add(line *speaker.Line, urls []string, pos int) ([]playlist.ItemID, error) {
+	items := make([]playlist.QueueItem, len(urls))
+	for i, url := range urls {
+		ai := playlist.AudioInfo{Url: url}
+		if err := bus.Dispatch("get audioinfo", &ai); err != nil {
+			return nil, err
+		}
+		items[i] = playlist.QueueItem{
+			Url:      url,
+			Title:    ai.Title,
+			Artist:   ai.Artist,
+			Duration: ai.Duration,
+		}
+	}
+
+	return AddItems(line, items, pos), nil
+}
+
+// AddItems 插入已知信息的项目，例如音乐库中的曲目
+func AddItems(line *speaker.Line, items []playlist.QueueItem, pos int) []playlist.ItemID {
+	q := Queue(line.ID)
+	ids := q.Insert(pos, items...)
+	changed(q)
+	queueNext(line, q)
+	return ids
+}
+
+func Remove(line *speaker.Line, ids ...playlist.ItemID) int {
+	q := Queue(line.ID)
+	n := q.Remove(ids...)
+	if n > 0 {
+		changed(q)
+		queueNext(line, q)
+	}
+	return n
+}
+
+func Move(line *speaker.Line, id playlist.ItemID, pos int) error {
+	q := Queue(line.ID)
+	if err := q.Move(id, pos); err != nil {
+		return err
+	}
+	changed(q)
+	queueNext(line, q)
+	return nil
+}
+
+func Clear(line *speaker.Line) {
+	q := Queue(line.ID)
+	q.Clear()
+	changed(q)
+	queueNext(line, q)
+}
+
+// SetMode 设置随机播放和循环方式，nil 表示不修改
+func SetMode(line *speaker.Line, shuffle *bool, repeat *playlist.RepeatMode) error {
+	q := Queue(line.ID)
+	if repeat != nil {
+		if err := q.SetRepeat(*repeat); err != nil {
+			return err
+		}
+	}
+	if shuffle != nil {
+		q.SetShuffle(*shuffle)
+	}
+	changed(q)
+	queueNext(line, q)
+	return nil
+}
+
+// Play 播放队列中的 id
+func Play(line *speaker.Line, id playlist.ItemID) error {
+	q := Queue(line.ID)
+	it := q.Play(id)
+	if it == nil {
+		return fmt.Errorf("queue item %d not exists", id)
+	}
+	changed(q)
+	return play(line, q, it)
+}
+
+// Next 手动切换至下一首，最后一首时按照循环方式处理
+func Next(line *speaker.Line) error {
+	q := Queue(line.ID)
+	it := q.Next(false)
+	changed(q)
+	if it == nil {
+		stop(line)
+		return nil
+	}
+	return play(line, q, it)
+}
+
+func Prev(line *speaker.Line) error {
+	q := Queue(line.ID)
+	it := q.Prev()
+	if it == nil {
+		return nil
+	}
+	changed(q)
+	return play(line, q, it)
+}
+
+func play(line *speaker.Line, q *playlist.Queue, it *playlist.QueueItem) error {
+	cancelNext(line)
+	fs, err := decoder.OpenFile(line, it.Url)
+	if err != nil {
+		log.Error("play queue item failed", lg.String("url", it.Url), lg.Error(err))
+		return err
+	}
+	fs.SetPause(false)
+	if fs == line.Input.FileStreamer() {
+		// 在当前的源中直接打开。否则由混音器过渡，完成后在 onInputChanged 中处理
+		queueNext(line, q)
+	}
+	return nil
+}
+
+func stop(line *speaker.Line) {
+	cancelNext(line)
+	if fs := line.Input.FileStreamer(); fs != nil && fs.IsPlaying() {
+		fs.SetPause(true)
+	}
+}
+
+// 队列中的曲目开始播放后，预先打开下一首，结束时由混音器无缝衔接或者交叉淡化
+func queueNext(line *speaker.Line, q *playlist.Queue) {
+	fs := line.Input.FileStreamer()
+	cur := q.Current()
+	if fs == nil || cur == nil || cur.Url != fs.CurrentFile() || fs.IsFinished() {
+		// 不是由队列播放的，或者已经停止
+		cancelNext(line)
+		return
+	}
+	it := q.PrepareNext()
+	if it == nil {
+		cancelNext(line)
+		return
+	}
+
+	locker.Lock()
+	p := pending[line.ID]
+	locker.Unlock()
+	if p != nil && p == line.Input.MixerEle.Next() && p.CurrentFile() == it.Url {
+		return
+	}
+
+	if err := decoder.OpenNextFile(line, it.Url); err != nil {
+		log.Error("open next queue item failed", lg.String("url", it.Url), lg.Error(err))
+		cancelNext(line)
+		return
+	}
+	next, _ := line.Input.MixerEle.Next().(stream.FileStreamer)
+
+	locker.Lock()
+	pending[line.ID] = next
+	locker.Unlock()
+}
+
+// 取消由队列预先打开的下一首
+func cancelNext(line *speaker.Line) {
+	locker.Lock()
+	p := pending[line.ID]
+	delete(pending, line.ID)
+	locker.Unlock()
+
+	if p != nil && p == line.Input.MixerEle.Next() {
+		line.Input.MixerEle.CancelNext()
+	}
+}
+
+// 混音器切换至预先打开的下一首时队列随之前进
+func onInputChanged(line *speaker.Line, ss stream.SourceStreamer) error {
+	q := findQueue(line.ID)
+	if q == nil {
+		return nil
+	}
+
+	locker.Lock()
+	p := pending[line.ID]
+	advanced := p != nil && ss == p
+	if advanced {
+		delete(pending, line.ID)
+	}
+	locker.Unlock()
+
+	if advanced {
+		q.Next(true)
+		changed(q)
+	}
+	queueNext(line, q)
+	return nil
+}
+
+// 队列中的文件播放结束，并且没有预先打开下一首时切换
+func onInputFinished(line *speaker.Line, ss stream.SourceStreamer) error {
+	fs, ok := ss.(stream.FileStreamer)
+	if !ok || fs != line.Input.FileStreamer() || !fs.IsFinished() {
+		// 已经切换至其它文件
+		return nil
+	}
+	if line.Input.MixerEle.Next() != nil {
+		// 由混音器衔接
+		return nil
+	}
+	q := findQueue(line.ID)
+	if q == nil {
+		return nil
+	}
+	if cur := q.Current(); cur == nil || cur.Url != fs.CurrentFile() {
+		// 不是由队列播放的
+		return nil
+	}
+
+	it := q.Next(true)
+	changed(q)
+	if it == nil {
+		return nil
+	}
+	return play(line, q, it)
+}
@@ -0,0 +1,128 @@
+package player
+
+import (
+	"fmt"
+	"sync"
+
+	lg "github.com/zwcway/castserver-go/common/log"
+	"github.com/zwcway/castserver-go/common/playlist"
+	"github.com/zwcway/castserver-go/common/speaker"
+	"github.com/zwcway/castserver-go/decoder"
+)
+
+var (
+	stations      []*playlist.Station
+	stationLocker sync.Mutex
+)
+
+// 读取保存的电台列表
+func loadStations() {
+	list := []*playlist.Station{}
+	if err := playlist.BusGetStations.Dispatch(&list); err != nil {
+		log.Error("load stations failed", lg.Error(err))
+	}
+
+	stationLocker.Lock()
+	defer stationLocker.Unlock()
+
+	stations = list
+}
+
+func Stations() []playlist.Station {
+	stationLocker.Lock()
+	defer stationLocker.Unlock()
+
+	list := make([]playlist.Station, len(stations))
+	for i, s := range stations {
+		list[i] = *s
+	}
+	return list
+}
+
+func FindStation(id playlist.StationID) *playlist.Station {
+	stationLocker.Lock()
+	defer stationLocker.Unlock()
+
+	if i := findStation(id); i >= 0 {
+		s := *stations[i]
+		return &s
+	}
+	return nil
+}
+
+func findStation(id playlist.StationID) int {
+	for i, s := range stations {
+		if s.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// SaveStation 添加或者修改电台，ID 为 0 时添加
+func SaveStation(s *playlist.Station) error {
+	if err := s.Check(); err != nil {
+		return err
+	}
+
+	stationLocker.Lock()
+	defer stationLocker.Unlock()
+
+	var (
+		st = &playlist.Station{}
+		i  = -1
+	)
+	if s.ID > 0 {
+		if i = findStation(s.ID); i < 0 {
+			return fmt.Errorf("station %d not exists", s.ID)
+		}
+		st = stations[i]
+		s.CreatedAt = st.CreatedAt
+	}
+	saved := *st
+	*st = *s
+
+	if err := playlist.BusSaveStation.Dispatch(st); err != nil {
+		*st = saved
+		return err
+	}
+	if i < 0 {
+		stations = append(stations, st)
+	}
+	*s = *st
+	return nil
+}
+
+func DeleteStation(id playlist.StationID) error {
+	stationLocker.Lock()
+	defer stationLocker.Unlock()
+
+	i := findStation(id)
+	if i < 0 {
+		return fmt.Errorf("station %d not exists", id)
+	}
+	s := stations[i]
+	stations = append(stations[:i], stations[i+1:]...)
+	playlist.BusStationDeleted.Dispatch(s)
+	return nil
+}
+
+// PlayStation 在线路上播放保存的电台
+func PlayStation(line *speaker.Line, id playlist.StationID) error {
+	s := FindStation(id)
+	if s == nil {
+		return fmt.Errorf("station %d not exists", id)
+	}
+	return PlayRadio(line, s.Url)
+}
+
+// PlayRadio 在线路上播放网络电台，断开后自动重新连接
+func PlayRadio(line *speaker.Line, url string) error {
+	fs, err := decoder.OpenRadio(line, url)
+	if err != nil {
+		log.Error("play radio failed", lg.String("url", url), lg.Error(err))
+		return err
+	}
+	fs.SetPause(false)
+	return nil
+}
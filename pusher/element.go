@@ -1,11 +1,14 @@
 package pusher
 
 import (
+	"sync"
 	"time"
 
 	"github.com/zwcway/castserver-go/common/audio"
 	"github.com/zwcway/castserver-go/common/bus"
+	"github.com/zwcway/castserver-go/common/config"
 	lg "github.com/zwcway/castserver-go/common/log"
+	"github.com/zwcway/castserver-go/common/protocol"
 	"github.com/zwcway/castserver-go/common/speaker"
 	"github.com/zwcway/castserver-go/common/stream"
 )
@@ -18,6 +21,13 @@ type Element struct {
 	chBuf  [audio.Channel_MAX]*stream.Samples
 
 	resample stream.ResampleElement
+
+	idle    bool // 线路处于空闲，恢复时需要预卷
+	preroll int  // 恢复后需要额外拉取的块数
+
+	compensation time.Duration // 与联动线路对齐的额外延迟
+
+	tick sync.Mutex // 串行化线路的推送，主线路与自身的时钟都可能驱动
 }
 
 func (e *Element) Name() string {
@@ -87,6 +97,9 @@ func (e *Element) Stream(samples *stream.Samples) {
 		return
 	}
 	if samples.LastNbSamples == 0 {
+		if se := e.line.Input.SilenceEle; se != nil && se.IsIdle() {
+			e.idle = true
+		}
 		return
 	}
 	var (
@@ -94,7 +107,7 @@ func (e *Element) Stream(samples *stream.Samples) {
 		i      int
 		c      int
 		ch     audio.Channel
-		from   []audio.Channel
+		from   = []audio.Channel{0}
 		buf    *stream.Samples
 		format = samples.Format
 		layout = samples.Format.Layout
@@ -112,7 +125,8 @@ func (e *Element) Stream(samples *stream.Samples) {
 			continue
 		}
 
-		from = e.line.ChannelRoute(ch)
+		// 声道路由已经由声道混音元完成
+		from[0] = ch
 		layout = samples.Format.Layout
 		if !layout.IntersectSlice(from) {
 			// 批量判断声道是否存在
@@ -141,8 +155,11 @@ func (e *Element) Stream(samples *stream.Samples) {
 	}
 
 	// 由于存在声道路由功能，如果先转码后路由，样本数据可能已经不是float64格式，不方便混合
+	e.resample.SetDither(e.line.Dither)
 	e.resample.Stream(e.buffer)
 
+	e.compensation = latencyCompensation(e.line)
+
 	for i, ch = range chList {
 		if !ch.IsValid() {
 			continue
@@ -153,11 +170,17 @@ func (e *Element) Stream(samples *stream.Samples) {
 		}
 		buf.Format.Sample = e.buffer.Format.Sample
 
+		// 转码可能改变了声道数据的位置，从转码后的缓存取出
+		data := e.buffer.ChannelBytes(ch)
 		for _, sp := range e.line.SpeakersByChannel(ch) {
 			// TODO 为防止转码耗时过长，克隆新的缓存，并放置后台转码和推送
-			e.PushSpeaker(sp, buf)
+			e.push(sp, e.buffer.Format.Sample, data)
 		}
 	}
+	if e.idle {
+		e.idle = false
+		e.preroll = prerollBlocks(config.SilencePreroll, samples)
+	}
 }
 func (e *Element) OnStarting() {
 }
@@ -168,7 +191,27 @@ func (e *Element) OnEnding() {
 func (e *Element) OnFormatChanged(newFormat *audio.Format) {
 }
 
+// 从空闲恢复时，扬声器的缓存已经播放完毕，
+// 由定时器立即额外拉取这些块的样本，使用真实的音频填充扬声器的缓存
+func (e *Element) takePreroll() int {
+	n := e.preroll
+	e.preroll = 0
+	return n
+}
+
+func prerollBlocks(d time.Duration, samples *stream.Samples) int {
+	if d <= 0 || samples.RequestNbSamples <= 0 {
+		return 0
+	}
+	n := int(d * time.Duration(samples.Format.Rate.ToInt()) / time.Second)
+	return (n + samples.RequestNbSamples - 1) / samples.RequestNbSamples
+}
+
 func (e *Element) PushSpeaker(sp *speaker.Speaker, samples *stream.Samples) {
+	e.push(sp, samples.Format.Sample, samples.ChannelBytes(0))
+}
+
+func (e *Element) push(sp *speaker.Speaker, sample audio.Sample, samples []byte) {
 	queue := sp.Queue
 	if queue == nil || sp.Conn == nil {
 		// log.Error("speaker not connected", lg.String("speaker", sp.String()))
@@ -180,32 +223,35 @@ func (e *Element) PushSpeaker(sp *speaker.Speaker, samples *stream.Samples) {
 	}
 
 	// 填充slient实现延迟
-	delay := sp.EqualizerEle.Delay()
+	delay := sp.EqualizerEle.Delay() + e.compensation
 
 	buf := ServerPush{
 		Ver:      1,
 		Compress: 0,
-		Rate:     samples.Format.Rate,
-		Bits:     samples.Format.Bits,
+		Rate:     sample.Rate,
+		Bits:     sample.Bits,
 		Time:     uint16(delay) + 1,
-		Samples:  samples.ChannelBytes(0),
-	}
-	p, err := buf.Pack()
-	if err != nil {
-		return
+		Samples:  samples,
 	}
 
 	if delayChanged(sp, delay) {
 		// 更改了延迟时间，抛弃旧的队列，生成新的队列
 		refreshPushQueue(sp, delay)
+		queue = sp.Queue
 	}
 
 	// 按照采样率填充指定大小的静音样本实现延迟指定时间
 	delayBufSize := bufSizeWithDelay(delay, sp.Format())
 
-	// TODO 使用缓存池
-	data := make([]byte, delayBufSize+p.DataSize())
-	copy(data[delayBufSize:], p.Bytes())
+	// 由发送协程归还
+	data := sp.Packets.Get(delayBufSize + buf.Size())
+	for i := 0; i < delayBufSize; i++ {
+		data[i] = 0
+	}
+	if err := buf.PackTo(protocol.FromBinary(data[delayBufSize:])); err != nil {
+		sp.Packets.Put(data)
+		return
+	}
 
 	sp.Statistic.Queue += uint32(len(data))
 
@@ -221,8 +267,29 @@ func (o *Element) Register(e string, c func(o any, a ...any) error) *bus.Handler
 	return bus.RegisterObj(o, e, c)
 }
 
+// latencyCompensation 联动的线路各自经过自己的管道，
+// 以延迟最大的线路为准，其余线路额外延迟差值，保持同步播放
+func latencyCompensation(line *speaker.Line) time.Duration {
+	leader := line
+	for leader.Leader() != nil {
+		leader = leader.Leader()
+	}
+	followers := leader.Followers()
+	if len(followers) == 0 {
+		return 0
+	}
+
+	max := leader.Input.PipeLine.Latency()
+	for _, f := range followers {
+		if d := f.Input.PipeLine.Latency(); d > max {
+			max = d
+		}
+	}
+	return max - line.Input.PipeLine.Latency()
+}
+
 func bufSizeWithDelay(delay time.Duration, f audio.Format) int {
-	return int((delay * time.Duration(f.Rate.ToInt()*f.Bits.Size()) * time.Second) / (time.Microsecond * 100))
+	return int(delay*time.Duration(f.Rate.ToInt())/time.Second) * f.Bits.Size()
 }
 
 func NewElement(line *speaker.Line) stream.SwitchElement {
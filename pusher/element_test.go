@@ -0,0 +1,25 @@
+package pusher
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zwcway/castserver-go/common/audio"
+)
+
+func TestBufSizeWithDelay(t *testing.T) {
+	f := audio.Format{
+		Sample: audio.Sample{
+			Rate: audio.AudioRate_48000,
+			Bits: audio.Bits_S16LE,
+		},
+		Layout: audio.Layout10,
+	}
+	// 10ms 为 480 个样本
+	assert.Equal(t, 960, bufSizeWithDelay(10*time.Millisecond, f))
+	assert.Equal(t, 0, bufSizeWithDelay(0, f))
+
+	f.Bits = audio.Bits_S24LE
+	assert.Equal(t, 48*3, bufSizeWithDelay(time.Millisecond, f))
+}
@@ -16,12 +16,19 @@ type ServerPush struct {
 
 const ServerPushHeaderSize uint16 = 7
 
-var globalBuffer = protocol.NewPackage(65535)
+// 数据包的总长度
+func (s *ServerPush) Size() int {
+	return int(ServerPushHeaderSize) + len(s.Samples)
+}
 
 func (s *ServerPush) Pack() (p *protocol.Package, err error) {
-	p = globalBuffer
-	p.Reset()
+	p = protocol.NewPackage(s.Size())
+	err = s.PackTo(p)
+	return
+}
 
+// PackTo 写入 p，p 可以来自 Speaker.Packets
+func (s *ServerPush) PackTo(p *protocol.Package) (err error) {
 	err = p.WriteUint8(uint8(protocol.PT_SpeakerDataPush))
 	if err != nil {
 		return
@@ -0,0 +1,148 @@
+package pusher
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zwcway/castserver-go/common/audio"
+	"github.com/zwcway/castserver-go/common/element"
+	"github.com/zwcway/castserver-go/common/protocol"
+	"github.com/zwcway/castserver-go/common/speaker"
+	"github.com/zwcway/castserver-go/common/stream"
+)
+
+func TestServerPush_Pack(t *testing.T) {
+	s := ServerPush{
+		Ver:     1,
+		Rate:    audio.AudioRate_48000,
+		Bits:    audio.Bits_S16LE,
+		Time:    3,
+		Samples: []byte{1, 2, 3, 4},
+	}
+	p, err := s.Pack()
+	assert.NoError(t, err)
+	assert.Equal(t, s.Size(), p.DataSize())
+
+	data := make([]byte, 32)
+	assert.NoError(t, s.PackTo(protocol.FromBinary(data)))
+	assert.Equal(t, p.Bytes(), data[:s.Size()])
+	assert.Equal(t, uint8(protocol.PT_SpeakerDataPush), data[0])
+	assert.Equal(t, []byte{4, 0, 1, 2, 3, 4}, data[5:11])
+
+	assert.Error(t, s.PackTo(protocol.FromBinary(make([]byte, 8))))
+}
+
+// 连接至本地的 UDP 端口，只发送不读取
+func newTestSpeakers(tb testing.TB, n int) []*speaker.Speaker {
+	l, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		tb.Skip(err)
+	}
+	tb.Cleanup(func() { l.Close() })
+
+	sps := make([]*speaker.Speaker, n)
+	for i := range sps {
+		conn, err := net.DialUDP("udp", nil, l.LocalAddr().(*net.UDPAddr))
+		if err != nil {
+			tb.Skip(err)
+		}
+		tb.Cleanup(func() { conn.Close() })
+
+		sps[i] = &speaker.Speaker{
+			ID:           speaker.SpeakerID(i + 1),
+			Rate:         uint8(audio.AudioRate_48000),
+			Bits:         uint8(audio.Bits_S16LE),
+			EqualizerEle: element.NewEqualizer(nil),
+			Conn:         conn,
+			Queue:        make(chan speaker.QueueData, 4),
+			Packets:      speaker.NewPacketRing(8, 1024),
+		}
+	}
+	return sps
+}
+
+func newTestSamples() *stream.Samples {
+	s := stream.NewSamples(480, audio.Format{
+		Sample: audio.Sample{
+			Rate: audio.AudioRate_48000,
+			Bits: audio.Bits_S16LE,
+		},
+		Layout: audio.Layout10,
+	})
+	s = s.ChannelSamples(audio.Channel_FRONT_CENTER)
+	s.LastNbSamples = 480
+	return s
+}
+
+// 一次定时器触发：生成所有扬声器的数据包并发送
+func pushTick(e *Element, sps []*speaker.Speaker, samples *stream.Samples) {
+	for _, sp := range sps {
+		e.PushSpeaker(sp, samples)
+	}
+	for _, sp := range sps {
+		pushPacket(<-sp.Queue)
+	}
+}
+
+func TestPushSpeaker_Allocs(t *testing.T) {
+	var (
+		e       = &Element{}
+		sps     = newTestSpeakers(t, 4)
+		samples = newTestSamples()
+	)
+
+	// 第一次申请缓存
+	pushTick(e, sps, samples)
+	for _, sp := range sps {
+		assert.Equal(t, 1, sp.Packets.Len())
+		assert.Zero(t, sp.Statistic.Queue)
+		assert.Equal(t, uint64(480*2+ServerPushHeaderSize), sp.Statistic.Spend)
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		pushTick(e, sps, samples)
+	})
+	assert.Zero(t, allocs)
+}
+
+func TestPacketRing(t *testing.T) {
+	r := speaker.NewPacketRing(2, 16)
+	a := r.Get(4)
+	assert.Len(t, a, 4)
+	assert.Equal(t, 16, cap(a))
+
+	r.Put(a)
+	r.Put(make([]byte, 8))
+	r.Put(make([]byte, 8)) // 已满，丢弃
+	assert.Equal(t, 2, r.Len())
+
+	// 容量不足时新建
+	b := r.Get(32)
+	assert.Len(t, b, 32)
+	assert.Equal(t, 1, r.Len())
+
+	var nilRing *speaker.PacketRing
+	assert.Len(t, nilRing.Get(4), 4)
+	nilRing.Put(b)
+}
+
+func BenchmarkPushSpeaker(b *testing.B) {
+	for _, n := range []int{8, 16, 32} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			var (
+				e       = &Element{}
+				sps     = newTestSpeakers(b, n)
+				samples = newTestSamples()
+			)
+			pushTick(e, sps, samples)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				pushTick(e, sps, samples)
+			}
+		})
+	}
+}
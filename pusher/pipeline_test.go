@@ -0,0 +1,255 @@
+package pusher
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zwcway/castserver-go/common/audio"
+	"github.com/zwcway/castserver-go/common/bus"
+	"github.com/zwcway/castserver-go/common/config"
+	"github.com/zwcway/castserver-go/common/element"
+	"github.com/zwcway/castserver-go/common/speaker"
+	"github.com/zwcway/castserver-go/common/stream"
+	"github.com/zwcway/castserver-go/common/utils"
+)
+
+const pipelineBlock = 480
+
+func TestMain(m *testing.M) {
+	ctx := utils.NewEmptyContext()
+	bus.Init(ctx)
+	log = ctx.Logger("pusher")
+
+	stream.BusResample.Register(func(resample *stream.ResampleElement, f *audio.Format) error {
+		if f == nil {
+			*resample = element.NewResample(audio.InternalFormat())
+		} else {
+			*resample = element.NewResample(*f)
+		}
+		return nil
+	})
+	m.Run()
+}
+
+// 立体声正弦波源，输出内部位宽
+type sineSource struct {
+	pos  int
+	mute bool
+}
+
+func (s *sineSource) Stream(samples *stream.Samples) {
+	if samples.IsFloat32() {
+		sineFill(s, stream.Planar[float32](samples), samples)
+	} else {
+		sineFill(s, stream.Planar[float64](samples), samples)
+	}
+}
+
+func sineFill[T stream.Float](s *sineSource, data [][]T, samples *stream.Samples) {
+	n := samples.RequestNbSamples
+	for i := 0; i < n; i++ {
+		v := 0.0
+		if !s.mute {
+			v = 0.5 * math.Sin(2*math.Pi*1000*float64(s.pos+i)/48000)
+		}
+		for ch := range data {
+			data[ch][i] = T(v)
+		}
+	}
+	s.pos += n
+	samples.LastNbSamples = n
+}
+
+func (s *sineSource) Close() error { return nil }
+func (s *sineSource) AudioFormat() audio.Format {
+	f := audio.InternalFormat()
+	f.Rate = audio.AudioRate_48000
+	f.Layout = audio.Layout20
+	return f
+}
+func (s *sineSource) ChannelIndex() audio.ChannelIndex { return audio.Layout20.ChannelIndex() }
+func (s *sineSource) SetOutFormat(audio.Format) error  { return nil }
+func (s *sineSource) IsPlaying() bool                  { return true }
+func (s *sineSource) CanRemove() bool                  { return false }
+func (s *sineSource) SourceType() stream.SourceType    { return stream.ST_Receiver }
+
+var testLineSeq int
+
+// 创建一条真实的线路，包含推送元和 n 个连接至本地 UDP 端口的扬声器
+func newTestLine(tb testing.TB, bits audio.Bits, n int) (*speaker.Line, *sineSource) {
+	audio.SetInternalBits(bits)
+	defer audio.SetInternalBits(audio.Bits_DEFAULT)
+
+	l, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		tb.Skip(err)
+	}
+	tb.Cleanup(func() { l.Close() })
+
+	testLineSeq++
+	line := speaker.NewLine(fmt.Sprintf("bench %d", testLineSeq))
+	for i := 0; i < n; i++ {
+		ch := audio.Channel_FRONT_LEFT
+		if i%2 == 1 {
+			ch = audio.Channel_FRONT_RIGHT
+		}
+		sp, err := speaker.NewSpeaker(fmt.Sprintf("10.%d.%d.%d", testLineSeq, i/250, i%250+1), line.ID, ch)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		sp.EqualizerEle.Set(60, -3, 1)
+		sp.EqualizerEle.Set(4000, 2, 1)
+		sp.EqualizerEle.On()
+
+		// 与真实的设备一样只支持整数位宽，重新决定线路的输出格式
+		sp.Config.RateMask.CombineSlice([]audio.Rate{audio.AudioRate_48000})
+		sp.Config.BitsMask.CombineSlice([]audio.Bits{audio.Bits_S32LE})
+		line.AppendSpeaker(sp)
+
+		conn, err := net.DialUDP("udp", nil, l.LocalAddr().(*net.UDPAddr))
+		if err != nil {
+			tb.Skip(err)
+		}
+		tb.Cleanup(func() { conn.Close() })
+		sp.Conn = conn
+		sp.Queue = make(chan speaker.QueueData, config.SendQueueSize)
+	}
+
+	line.Input.EqualizerEle.Set(100, 3, 1)
+	line.Input.EqualizerEle.Set(1000, -2, 1)
+	line.Input.EqualizerEle.Set(8000, 4, 0.7)
+	line.Input.EqualizerEle.On()
+	src := &sineSource{}
+	line.Input.MixerEle.Add(src)
+
+	// 与 TriggerAddLine 相同，但是由测试驱动
+	e := NewElement(line)
+	line.Input.PipeLine.Append(e)
+	e.On()
+	setLinePusher(line, e.(*Element))
+	tb.Cleanup(func() { setLinePusher(line, nil) })
+	line.Input.PipeLine.SetBuffer(stream.NewSamples(pipelineBlock, line.Output))
+
+	return line, src
+}
+
+// 一次定时器触发：线路和所有扬声器的管道，之后编码并发送所有数据包，返回每个扬声器的数据包个数
+func pipelineTick(line *speaker.Line, last map[*speaker.Speaker][]byte) (packets int) {
+	tickLine(line)
+	for _, sp := range line.Speakers() {
+		n := 0
+		for len(sp.Queue) > 0 {
+			d := <-sp.Queue
+			if last != nil {
+				last[sp] = append(last[sp][:0], d.Data...)
+			}
+			pushPacket(d)
+			n++
+		}
+		packets = n
+	}
+	return
+}
+
+func TestPipeLine_Float32(t *testing.T) {
+	var (
+		l64, _ = newTestLine(t, audio.Bits_64LEF, 2)
+		l32, _ = newTestLine(t, audio.Bits_32LEF, 2)
+		p64    = map[*speaker.Speaker][]byte{}
+		p32    = map[*speaker.Speaker][]byte{}
+		sp64   = l64.Speakers()
+		sp32   = l32.Speakers()
+	)
+
+	for i := 0; i < 10; i++ {
+		audio.SetInternalBits(audio.Bits_64LEF)
+		pipelineTick(l64, p64)
+		audio.SetInternalBits(audio.Bits_32LEF)
+		pipelineTick(l32, p32)
+	}
+	audio.SetInternalBits(audio.Bits_DEFAULT)
+
+	assert.True(t, l32.Input.MixerEle.Buffer().IsFloat32())
+	assert.False(t, l64.Input.MixerEle.Buffer().IsFloat32())
+
+	// 转码至 32 位整数之后，两者的差别小于 16 位的精度
+	for i := range sp64 {
+		a, b := p64[sp64[i]], p32[sp32[i]]
+		assert.NotEmpty(t, a)
+		assert.Equal(t, len(a), len(b))
+
+		diff, peak := 0, 0
+		for j := int(ServerPushHeaderSize); j+3 < len(a) && j+3 < len(b); j += 4 {
+			x := int(int32(binary.LittleEndian.Uint32(a[j:])))
+			y := int(int32(binary.LittleEndian.Uint32(b[j:])))
+			if x-y > 1<<16 || y-x > 1<<16 {
+				diff++
+			}
+			if x > peak {
+				peak = x
+			}
+		}
+		assert.Zero(t, diff)
+		assert.Greater(t, peak, 1<<24)
+	}
+}
+
+func TestPipeLine_Preroll(t *testing.T) {
+	line, src := newTestLine(t, audio.Bits_64LEF, 2)
+	line.Input.SilenceEle.SetTimeout(50 * time.Millisecond)
+	last := map[*speaker.Speaker][]byte{}
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, 1, pipelineTick(line, last))
+	}
+
+	// 连续静音后不再推送
+	src.mute = true
+	for i := 0; i < 10 && !line.Input.SilenceEle.IsIdle(); i++ {
+		pipelineTick(line, last)
+	}
+	assert.True(t, line.Input.SilenceEle.IsIdle())
+	assert.Zero(t, pipelineTick(line, last))
+
+	// 恢复时立即推送预卷的真实样本，之后每次只推送一块
+	src.mute = false
+	blocks := int(config.SilencePreroll * 48000 / time.Second / pipelineBlock)
+	assert.Equal(t, 1+blocks, pipelineTick(line, last))
+	assert.Equal(t, 1, pipelineTick(line, last))
+	for _, sp := range line.Speakers() {
+		peak := 0
+		for j := int(ServerPushHeaderSize); j+3 < len(last[sp]); j += 4 {
+			if x := int(int32(binary.LittleEndian.Uint32(last[sp][j:]))); x > peak {
+				peak = x
+			}
+		}
+		assert.Greater(t, peak, 1<<24)
+	}
+}
+
+// 每次操作是一次定时器触发，包含线路、所有扬声器的管道、转码和数据包的编码发送
+func BenchmarkPipeLine(b *testing.B) {
+	for _, bits := range []audio.Bits{audio.Bits_64LEF, audio.Bits_32LEF} {
+		for _, speakers := range []int{8, 16, 32} {
+			line, _ := newTestLine(b, bits, speakers)
+
+			b.Run(fmt.Sprintf("%s/%d", bits, speakers), func(b *testing.B) {
+				audio.SetInternalBits(bits)
+				defer audio.SetInternalBits(audio.Bits_DEFAULT)
+
+				pipelineTick(line, nil)
+
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					pipelineTick(line, nil)
+				}
+			})
+		}
+	}
+}
@@ -29,19 +29,29 @@ func pushRoutine(queue spQueueCtrl, done <-chan struct{}) {
 			return
 		case d = <-queue.sp.Queue:
 		}
-		if d.Speaker == nil || d.Speaker.IsDeleted() {
-			continue
-		}
+		pushPacket(d)
+	}
+}
+
+// 发送一个数据包，完成后归还缓存
+func pushPacket(d speaker.QueueData) {
+	if d.Speaker == nil {
+		return
+	}
+	defer d.Speaker.Packets.Put(d.Data)
+
+	if d.Speaker.IsDeleted() {
+		return
+	}
 
-		// TODO 按MTU拆包
+	// TODO 按MTU拆包
 
-		d.Speaker.Statistic.Queue -= uint32(len(d.Data))
+	d.Speaker.Statistic.Queue -= uint32(len(d.Data))
 
-		err := d.Speaker.WriteUDP(d.Data)
-		if err != nil {
-			// log.Error("push to speaker error", lg.Error(err))
-			continue
-		}
+	err := d.Speaker.WriteUDP(d.Data)
+	if err != nil {
+		// log.Error("push to speaker error", lg.Error(err))
+		return
 	}
 }
 
@@ -10,9 +10,15 @@ import (
 var receiveQueue chan speaker.QueueData
 
 func receiveSpeakerRoutine(sp *speaker.Speaker) {
+	var receiveBuffer []byte
+	defer func() {
+		sp.Packets.Put(receiveBuffer)
+	}()
 
 	for {
-		receiveBuffer := make([]byte, config.ReadBufferSize)
+		if receiveBuffer == nil {
+			receiveBuffer = sp.Packets.Get(config.ReadBufferSize)
+		}
 
 		numBytes, addrPort, err := sp.Conn.ReadFromUDPAddrPort(receiveBuffer)
 		if err != nil {
@@ -29,11 +35,11 @@ func receiveSpeakerRoutine(sp *speaker.Speaker) {
 			return
 		}
 
-		if len(receiveQueue) < cap(receiveQueue) {
-			receiveQueue <- speaker.QueueData{
-				Speaker: sp,
-				Data:    receiveBuffer[:numBytes],
-			}
+		// 队列已满时丢弃，缓存用于下一次读取
+		select {
+		case receiveQueue <- speaker.QueueData{Speaker: sp, Data: receiveBuffer[:numBytes]}:
+			receiveBuffer = nil
+		default:
 		}
 	}
 }
@@ -73,6 +73,48 @@ func linePushTimerRoutine(line *speaker.Line) {
 			continue
 		}
 
-		line.Input.PipeLine.Stream(nil)
+		// 跟随的线路使用主线路的时钟
+		if line.Leader() != nil {
+			continue
+		}
+
+		tickLine(line)
+	}
+}
+
+// 一次定时器触发，同时驱动跟随的线路。从空闲恢复时立即额外拉取预卷的样本
+func tickLine(line *speaker.Line) {
+	lines := append([]*speaker.Line{line}, line.Followers()...)
+	elements := make([]*Element, len(lines))
+	for i, l := range lines {
+		elements[i] = linePusher(l)
 	}
+
+	n := 0
+	for i, l := range lines {
+		streamLine(l, elements[i])
+		if e := elements[i]; e != nil {
+			if p := e.takePreroll(); p > n {
+				n = p
+			}
+		}
+	}
+	for ; n > 0; n-- {
+		for i, l := range lines {
+			streamLine(l, elements[i])
+			if e := elements[i]; e != nil {
+				e.takePreroll()
+			}
+		}
+	}
+}
+
+// 跟随的线路由主线路的时钟驱动，与自身的时钟互斥
+func streamLine(line *speaker.Line, e *Element) {
+	if e != nil {
+		e.tick.Lock()
+		defer e.tick.Unlock()
+	}
+
+	line.Input.PipeLine.Stream(nil)
 }
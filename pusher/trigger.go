@@ -1,6 +1,8 @@
 package pusher
 
 import (
+	"sync"
+
 	"github.com/zwcway/castserver-go/common/bus"
 	lg "github.com/zwcway/castserver-go/common/log"
 	"github.com/zwcway/castserver-go/common/speaker"
@@ -16,8 +18,31 @@ const (
 var (
 	lastTrigger    = trigger_local
 	currentTrigger = lastTrigger
+
+	pushers       = make(map[*speaker.Line]*Element) // 线路的推送元
+	pushersLocker sync.Mutex
 )
 
+// 线路的推送元，定时器的协程与线路的增删同时访问
+func linePusher(line *speaker.Line) *Element {
+	pushersLocker.Lock()
+	defer pushersLocker.Unlock()
+
+	return pushers[line]
+}
+
+// e 为空时删除
+func setLinePusher(line *speaker.Line, e *Element) {
+	pushersLocker.Lock()
+	defer pushersLocker.Unlock()
+
+	if e == nil {
+		delete(pushers, line)
+		return
+	}
+	pushers[line] = e
+}
+
 func initTrigger() {
 	err := localspeaker.Init()
 	if err != nil {
@@ -50,10 +75,14 @@ func TriggerAddLine(line *speaker.Line) {
 	e := NewElement(line)
 	line.Input.PipeLine.Append(e)
 	e.On()
+	if pe, ok := e.(*Element); ok {
+		setLinePusher(line, pe)
+	}
 
 	TimerAddLine(line)
 }
 
 func TriggerRemoveLine(line *speaker.Line) {
 	TimerRemoveLine(line)
+	setLinePusher(line, nil)
 }
@@ -0,0 +1,53 @@
+package receiver
+
+import (
+	"github.com/zwcway/castserver-go/common/config"
+	"github.com/zwcway/castserver-go/common/speaker"
+	"github.com/zwcway/castserver-go/receiver/airplay"
+)
+
+func initAirPlay() error {
+	var err error
+
+	if !config.EnableAirPlay {
+		return nil
+	}
+
+	airplayInstance, err = airplay.NewAirPlayServer(ctx)
+	if err != nil {
+		return err
+	}
+	airplayInstance.ListenAndServe()
+
+	// 已经存在的线路
+	for _, line := range speaker.LineList() {
+		airplayInstance.AddLine(line)
+	}
+
+	speaker.BusLineNameChanged.Register(EditAirPlay)
+	speaker.BusLineCreated.Register(AddAirPlay)
+	speaker.BusLineDeleted.Register(DelAirPlay)
+
+	return nil
+}
+
+func AddAirPlay(line *speaker.Line) error {
+	if airplayInstance != nil {
+		airplayInstance.AddLine(line)
+	}
+	return nil
+}
+
+func DelAirPlay(line, dst *speaker.Line) error {
+	if airplayInstance != nil {
+		airplayInstance.DelLine(line)
+	}
+	return nil
+}
+
+func EditAirPlay(line *speaker.Line, old *string) error {
+	if airplayInstance != nil {
+		airplayInstance.ChangeName(line)
+	}
+	return nil
+}
@@ -1 +1,197 @@
-package airplay
\ No newline at end of file
+package airplay
+
+import (
+	"crypto/rsa"
+	"crypto/sha1"
+	"fmt"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/zwcway/castserver-go/common/config"
+	lg "github.com/zwcway/castserver-go/common/log"
+	"github.com/zwcway/castserver-go/common/speaker"
+	"github.com/zwcway/castserver-go/common/utils"
+)
+
+// 服务名的最大长度，DNS 标签不能超过 63 字节
+const maxInstanceName = 63
+
+// AirPlayServer 每个线路作为一个 RAOP 接收端，通过 mDNS 广播
+type AirPlayServer struct {
+	ctx utils.Context
+	log lg.Logger
+
+	mdns    *mdnsResponder
+	key     *rsa.PrivateKey // 未配置时不支持加密
+	locker  sync.Mutex
+	servers map[speaker.LineID]*lineServer
+}
+
+type lineServer struct {
+	raop  *raopServer
+	entry *mdnsEntry
+}
+
+func NewAirPlayServer(ctx utils.Context) (s *AirPlayServer, err error) {
+	s = &AirPlayServer{
+		ctx:     ctx,
+		log:     ctx.Logger("airplay"),
+		servers: map[speaker.LineID]*lineServer{},
+	}
+	s.mdns, err = newMDNSResponder(config.AirPlayListen, s.log)
+	if err != nil {
+		// 没有 mDNS 时仍然可以手动连接
+		s.log.Warn("mdns listen failed", lg.Error(err))
+		s.mdns, err = nil, nil
+	}
+	if config.AirPlayKey != "" {
+		if s.key, err = loadKey(config.AirPlayKey); err != nil {
+			s.log.Warn("load airplay key failed, only unencrypted audio is accepted", lg.Error(err))
+			s.key, err = nil, nil
+		}
+	}
+	return
+}
+
+func (s *AirPlayServer) ListenAndServe() {
+	if s == nil || s.mdns == nil {
+		return
+	}
+	go s.mdns.serve()
+}
+
+// 线路的 RTSP 地址，端口为配置的端口加线路 ID
+func lineListenAddr(line *speaker.Line) string {
+	listen := config.AirPlayListen
+	addr := listen.AddrPort.Addr()
+	if listen.Iface != nil {
+		if ip := utils.InterfaceAddr(listen.Iface, false); ip != nil {
+			addr = *utils.IpNetToAddr(ip)
+		}
+	}
+	if !addr.IsValid() {
+		addr = netip.IPv4Unspecified()
+	}
+	port := listen.AddrPort.Port()
+	if port > 0 {
+		port += uint16(line.ID)
+	}
+	return netip.AddrPortFrom(addr, port).String()
+}
+
+// 每个线路使用不同的硬件地址，重启后不变
+func deviceAddr(line *speaker.Line) []byte {
+	host, _ := os.Hostname()
+	sum := sha1.Sum([]byte(fmt.Sprintf("%s%s%d", config.APPNAME, host, line.ID)))
+	return sum[:6]
+}
+
+func deviceID(line *speaker.Line) string {
+	return fmt.Sprintf("%X", deviceAddr(line))
+}
+
+func instanceName(line *speaker.Line) string {
+	name := deviceID(line) + "@" + strings.ReplaceAll(line.LineName, ".", " ")
+	for len(name) > maxInstanceName {
+		r := []rune(name)
+		name = string(r[:len(r)-1])
+	}
+	return name
+}
+
+// encrypt 为 true 时同时支持 RSA 加密
+func raopTXT(encrypt bool) []string {
+	et := "et=0"
+	if encrypt {
+		et = "et=0,1"
+	}
+	return []string{
+		"txtvers=1", "ch=2", "cn=0,1", et, "sv=false", "da=true",
+		"sr=44100", "ss=16", "pw=false", "vn=3", "tp=UDP", "md=0,1,2",
+		"vs=105.1", "am=" + strings.ReplaceAll(config.APPNAME, " ", ""),
+	}
+}
+
+func (s *AirPlayServer) AddLine(line *speaker.Line) error {
+	if s == nil {
+		return nil
+	}
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	if _, ok := s.servers[line.ID]; ok {
+		return nil
+	}
+	raop, err := newRaopServer(line, s.log, lineListenAddr(line), s.key)
+	if err != nil {
+		s.log.Error("listen rtsp failed", lg.String("line", line.LineName), lg.Error(err))
+		return err
+	}
+	ls := &lineServer{
+		raop: raop,
+		entry: &mdnsEntry{
+			instance: instanceName(line),
+			port:     raop.Port(),
+			txt:      raopTXT(s.key != nil),
+		},
+	}
+	s.servers[line.ID] = ls
+	s.mdns.register(ls.entry)
+
+	s.log.Info("airplay receiver", lg.String("line", line.LineName), lg.Int("port", int64(ls.entry.port)))
+	return nil
+}
+
+func (s *AirPlayServer) DelLine(line *speaker.Line) {
+	if s == nil {
+		return
+	}
+	s.locker.Lock()
+	ls, ok := s.servers[line.ID]
+	delete(s.servers, line.ID)
+	s.locker.Unlock()
+
+	if !ok {
+		return
+	}
+	s.mdns.unregister(ls.entry.instance)
+	ls.raop.Close()
+}
+
+// ChangeName 重新广播新的服务名
+func (s *AirPlayServer) ChangeName(line *speaker.Line) {
+	if s == nil {
+		return
+	}
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	ls, ok := s.servers[line.ID]
+	if !ok {
+		return
+	}
+	s.mdns.unregister(ls.entry.instance)
+	ls.entry = &mdnsEntry{
+		instance: instanceName(line),
+		port:     ls.entry.port,
+		txt:      ls.entry.txt,
+	}
+	s.mdns.register(ls.entry)
+}
+
+func (s *AirPlayServer) Close() {
+	if s == nil {
+		return
+	}
+	s.locker.Lock()
+	servers := s.servers
+	s.servers = map[speaker.LineID]*lineServer{}
+	s.locker.Unlock()
+
+	s.mdns.Close()
+	for _, ls := range servers {
+		ls.raop.Close()
+	}
+}
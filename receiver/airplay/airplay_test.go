@@ -0,0 +1,508 @@
+package airplay
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zwcway/castserver-go/common/audio"
+	"github.com/zwcway/castserver-go/common/bus"
+	"github.com/zwcway/castserver-go/common/config"
+	"github.com/zwcway/castserver-go/common/speaker"
+	"github.com/zwcway/castserver-go/common/stream"
+	"github.com/zwcway/castserver-go/common/utils"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// 模拟发送端
+type rtspClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *textproto.Reader
+	cseq int
+}
+
+func (c *rtspClient) do(method string, header map[string]string, body []byte) (int, textproto.MIMEHeader, []byte) {
+	c.cseq++
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s rtsp://127.0.0.1/1 RTSP/1.0\r\nCSeq: %d\r\n", method, c.cseq)
+	for k, v := range header {
+		fmt.Fprintf(&buf, "%s: %s\r\n", k, v)
+	}
+	if len(body) > 0 {
+		fmt.Fprintf(&buf, "Content-Length: %d\r\n", len(body))
+	}
+	buf.WriteString("\r\n")
+	buf.Write(body)
+	_, err := c.conn.Write(buf.Bytes())
+	assert.NoError(c.t, err)
+
+	line, err := c.r.ReadLine()
+	assert.NoError(c.t, err)
+	parts := strings.SplitN(line, " ", 3)
+	assert.Len(c.t, parts, 3)
+	status, _ := strconv.Atoi(parts[1])
+	h, err := c.r.ReadMIMEHeader()
+	assert.NoError(c.t, err)
+	assert.Equal(c.t, strconv.Itoa(c.cseq), h.Get("CSeq"))
+	var res []byte
+	if cl := h.Get("Content-Length"); cl != "" {
+		n, _ := strconv.Atoi(cl)
+		res = make([]byte, n)
+		io.ReadFull(c.r.R, res)
+	}
+	return status, h, res
+}
+
+func rtpPacket(pt byte, seq uint16, payload []byte) []byte {
+	p := make([]byte, 12, 12+len(payload))
+	p[0] = 0x80
+	p[1] = pt
+	binary.BigEndian.PutUint16(p[2:], seq)
+	binary.BigEndian.PutUint32(p[4:], uint32(seq)*352)
+	return append(p, payload...)
+}
+
+func readUDP(t *testing.T, conn *net.UDPConn) []byte {
+	buf := make([]byte, 2048)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := conn.ReadFromUDP(buf)
+	assert.NoError(t, err)
+	return buf[:n]
+}
+
+func dmapTag(tag string, val []byte) []byte {
+	p := make([]byte, 8, 8+len(val))
+	copy(p, tag)
+	binary.BigEndian.PutUint32(p[4:], uint32(len(val)))
+	return append(p, val...)
+}
+
+func TestRaopReceiver(t *testing.T) {
+	bus.Init(utils.NewEmptyContext())
+	config.AirPlayBuffer = 20 * time.Millisecond
+
+	line := speaker.NewLine("airplay")
+	srv, err := newRaopServer(line, utils.NewEmptyContext().Logger("airplay"), "127.0.0.1:0", nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer srv.Close()
+
+	control, _ := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	timing, _ := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	defer control.Close()
+	defer timing.Close()
+
+	conn, err := net.Dial("tcp4", fmt.Sprintf("127.0.0.1:%d", srv.Port()))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+	c := &rtspClient{t: t, conn: conn, r: textproto.NewReader(bufio.NewReader(conn))}
+
+	status, h, _ := c.do("OPTIONS", nil, nil)
+	assert.Equal(t, 200, status)
+	assert.Contains(t, h.Get("Public"), "ANNOUNCE")
+
+	// 不支持加密
+	status, _, _ = c.do("ANNOUNCE", map[string]string{"Content-Type": "application/sdp"},
+		[]byte("v=0\r\nm=audio 0 RTP/AVP 96\r\na=rtpmap:96 AppleLossless\r\na=fmtp:"+testFmtp+"\r\na=rsaaeskey:AAAA\r\n"))
+	assert.Equal(t, 415, status)
+	status, _, _ = c.do("RECORD", nil, nil)
+	assert.Equal(t, 455, status)
+
+	status, _, _ = c.do("ANNOUNCE", map[string]string{"Content-Type": "application/sdp"},
+		[]byte("v=0\r\nm=audio 0 RTP/AVP 96\r\na=rtpmap:96 AppleLossless\r\na=fmtp:"+testFmtp+"\r\n"))
+	assert.Equal(t, 200, status)
+
+	status, h, _ = c.do("SETUP", map[string]string{
+		"Transport": fmt.Sprintf("RTP/AVP/UDP;unicast;interleaved=0-1;mode=record;control_port=%d;timing_port=%d",
+			control.LocalAddr().(*net.UDPAddr).Port, timing.LocalAddr().(*net.UDPAddr).Port),
+	}, nil)
+	assert.Equal(t, 200, status)
+	ports := map[string]int{}
+	for _, kv := range strings.Split(h.Get("Transport"), ";") {
+		k, v, _ := strings.Cut(kv, "=")
+		ports[k], _ = strconv.Atoi(v)
+	}
+	server := func(name string) *net.UDPAddr {
+		assert.NotZero(t, ports[name])
+		return &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: ports[name]}
+	}
+
+	// 接收端向发送端同步时钟，发送端的时钟快 1 秒
+	p := readUDP(t, timing)
+	assert.Equal(t, byte(0x80|ptTimingRequest), p[1])
+	reply := make([]byte, 32)
+	reply[0], reply[1] = 0x80, 0x80|ptTimingReply
+	copy(reply[8:16], p[24:32])
+	ahead := ntpTime(time.Now().Add(time.Second))
+	binary.BigEndian.PutUint64(reply[16:], ahead)
+	binary.BigEndian.PutUint64(reply[24:], ahead)
+	timing.WriteToUDP(reply, server("timing_port"))
+	// 发送端的时钟请求
+	req := make([]byte, 32)
+	req[0], req[1] = 0x80, 0x80|ptTimingRequest
+	binary.BigEndian.PutUint64(req[24:], 0x1122334455667788)
+	timing.WriteToUDP(req, server("timing_port"))
+	p = readUDP(t, timing)
+	assert.Equal(t, byte(0x80|ptTimingReply), p[1])
+	assert.Equal(t, uint64(0x1122334455667788), binary.BigEndian.Uint64(p[8:16]))
+	assert.InDelta(t, time.Second, srv.session.rtp.ClockDelta(), float64(100*time.Millisecond))
+
+	status, h, _ = c.do("RECORD", map[string]string{"RTP-Info": "seq=100;rtptime=0"}, nil)
+	assert.Equal(t, 200, status)
+	assert.NotEmpty(t, h.Get("Audio-Latency"))
+	assert.Equal(t, stream.ST_AirPlay, line.Input.From)
+	rs, ok := line.Input.ReceiverStreamer().(*raopStreamer)
+	if !assert.True(t, ok) {
+		return
+	}
+
+	// 每帧的样本为 序号*1000+i
+	dec, _ := newALACDecoder(testFmtp)
+	frame := func(seq uint16) ([]int16, []int16, []byte) {
+		left, right := make([]int16, 352), make([]int16, 352)
+		for i := range left {
+			left[i] = int16(int(seq)*1000 + i)
+			right[i] = -left[i]
+		}
+		return left, right, encodeALAC(dec, left, right, true, 0, 0, [2]alacChannel{{quant: 9, mult: 4}, {predType: 15, quant: 9, mult: 4}})
+	}
+	audioPort := server("server_port")
+	for _, seq := range []uint16{10, 11, 13} {
+		_, _, payload := frame(seq)
+		control.WriteToUDP(rtpPacket(ptAudio, seq, payload), audioPort)
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// 丢失的包请求重传
+	p = readUDP(t, control)
+	assert.Equal(t, byte(0x80|ptResendRequest), p[1])
+	assert.Equal(t, uint16(12), binary.BigEndian.Uint16(p[4:6]))
+	assert.Equal(t, uint16(1), binary.BigEndian.Uint16(p[6:8]))
+	_, _, payload := frame(12)
+	resend := append([]byte{0x80, 0x80 | ptResendReply, 0, 1}, rtpPacket(ptAudio, 12, payload)...)
+	control.WriteToUDP(resend, server("control_port"))
+
+	assert.Eventually(t, func() bool {
+		rs.locker.Lock()
+		defer rs.locker.Unlock()
+		return len(rs.frames) == 4
+	}, time.Second, 5*time.Millisecond)
+	assert.True(t, rs.IsPlaying())
+
+	format := audio.Format{
+		Sample: audio.Sample{Rate: audio.AudioRate_44100, Bits: audio.Bits_64LEF},
+		Layout: audio.Layout20,
+	}
+	samples := stream.NewSamples(352*4, format)
+	rs.Stream(samples)
+	assert.Equal(t, 352*4, samples.LastNbSamples)
+	for k, seq := range []uint16{10, 11, 12, 13} {
+		left, right, _ := frame(seq)
+		assert.Equal(t, float64(left[5])/32768, samples.Data[0][k*352+5], "seq %d", seq)
+		assert.Equal(t, float64(right[351])/32768, samples.Data[1][k*352+351], "seq %d", seq)
+	}
+	// 缓冲耗尽后重新缓冲
+	rs.Stream(samples)
+	assert.Equal(t, 0, samples.LastNbSamples)
+	assert.False(t, rs.IsPlaying())
+
+	// 音量
+	status, _, _ = c.do("SET_PARAMETER", map[string]string{"Content-Type": "text/parameters"}, []byte("volume: -15.000000\r\n"))
+	assert.Equal(t, 200, status)
+	assert.Equal(t, uint8(50), line.Volume)
+	assert.False(t, line.Mute)
+	c.do("SET_PARAMETER", map[string]string{"Content-Type": "text/parameters"}, []byte("volume: -144.000000\r\n"))
+	assert.True(t, line.Mute)
+	assert.Equal(t, uint8(50), line.Volume)
+	_, _, body := c.do("GET_PARAMETER", map[string]string{"Content-Type": "text/parameters"}, []byte("volume\r\n"))
+	assert.Equal(t, "volume: -144.000000\r\n", string(body))
+
+	// 标题和封面
+	dmap := dmapTag("mlit", append(append(dmapTag("minm", []byte("Song")), dmapTag("asar", []byte("Singer"))...), dmapTag("asal", []byte("Album"))...))
+	titles := make(chan string, 1)
+	speaker.BusLineMetadataChanged.Register(func(l *speaker.Line) error {
+		titles <- l.Input.Title + "|" + l.Input.Artist
+		return nil
+	}).Once()
+	status, _, _ = c.do("SET_PARAMETER", map[string]string{"Content-Type": "application/x-dmap-tagged"}, dmap)
+	assert.Equal(t, 200, status)
+	select {
+	case title := <-titles:
+		assert.Equal(t, "Song|Singer", title)
+	case <-time.After(time.Second):
+		t.Error("metadata not changed")
+	}
+
+	var cover bytes.Buffer
+	png.Encode(&cover, image.NewRGBA(image.Rect(0, 0, 2, 3)))
+	status, _, _ = c.do("SET_PARAMETER", map[string]string{"Content-Type": "image/png"}, cover.Bytes())
+	assert.Equal(t, 200, status)
+	if assert.NotNil(t, line.Input.Cover) {
+		assert.Equal(t, image.Rect(0, 0, 2, 3), line.Input.Cover.Bounds())
+	}
+	status, _, _ = c.do("SET_PARAMETER", map[string]string{"Content-Type": "image/jpeg"}, []byte("bad"))
+	assert.Equal(t, 415, status)
+
+	// FLUSH 丢弃旧数据，从新的序号开始
+	_, _, payload = frame(14)
+	control.WriteToUDP(rtpPacket(ptAudio, 14, payload), audioPort)
+	status, _, _ = c.do("FLUSH", map[string]string{"RTP-Info": "seq=200;rtptime=70400"}, nil)
+	assert.Equal(t, 200, status)
+	for _, seq := range []uint16{199, 200, 201, 202} {
+		_, _, payload := frame(seq)
+		control.WriteToUDP(rtpPacket(ptAudio, seq, payload), audioPort)
+	}
+	assert.Eventually(t, rs.IsPlaying, time.Second, 5*time.Millisecond)
+	rs.Stream(samples)
+	assert.Equal(t, 352*3, samples.LastNbSamples)
+	left, _, _ := frame(200)
+	assert.Equal(t, float64(left[0])/32768, samples.Data[0][0])
+
+	status, _, _ = c.do("TEARDOWN", nil, nil)
+	assert.Equal(t, 200, status)
+	assert.True(t, rs.CanRemove())
+	assert.Equal(t, stream.ST_NONE, line.Input.From)
+	assert.Nil(t, line.Input.ReceiverStreamer())
+	assert.Nil(t, line.Input.Cover)
+	assert.Equal(t, "", line.Input.Title)
+}
+
+func TestRaopEncryption(t *testing.T) {
+	bus.Init(utils.NewEmptyContext())
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if !assert.NoError(t, err) {
+		return
+	}
+	line := speaker.NewLine("airplay encrypted")
+	srv, err := newRaopServer(line, utils.NewEmptyContext().Logger("airplay"), "127.0.0.1:0", key)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp4", fmt.Sprintf("127.0.0.1:%d", srv.Port()))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+	c := &rtspClient{t: t, conn: conn, r: textproto.NewReader(bufio.NewReader(conn))}
+
+	// 对 challenge、本机地址和硬件地址签名
+	challenge := []byte("0123456789abcdef")
+	status, h, _ := c.do("OPTIONS", map[string]string{"Apple-Challenge": base64.StdEncoding.EncodeToString(challenge)}, nil)
+	assert.Equal(t, 200, status)
+	sig, err := decodeBase64(h.Get("Apple-Response"))
+	assert.NoError(t, err)
+	signed := append(append(challenge, 127, 0, 0, 1), deviceAddr(line)...)
+	signed = append(signed, make([]byte, 32-len(signed))...)
+	assert.NoError(t, rsa.VerifyPKCS1v15(&key.PublicKey, 0, signed, sig))
+
+	aesKey, iv := []byte("0123456789abcdef"), []byte("fedcba9876543210")
+	ek, err := rsa.EncryptOAEP(sha1.New(), rand.Reader, &key.PublicKey, aesKey, nil)
+	assert.NoError(t, err)
+	status, _, _ = c.do("ANNOUNCE", map[string]string{"Content-Type": "application/sdp"},
+		[]byte("v=0\r\nm=audio 0 RTP/AVP 96\r\na=rtpmap:96 L16/44100/2\r\na=rsaaeskey:"+
+			base64.RawStdEncoding.EncodeToString(ek)+"\r\na=aesiv:"+base64.StdEncoding.EncodeToString(iv)+"\r\n"))
+	assert.Equal(t, 200, status)
+
+	srv.locker.Lock()
+	dec, ok := srv.session.decoder.(*decryptDecoder)
+	srv.locker.Unlock()
+	if !assert.True(t, ok) {
+		return
+	}
+
+	// 末尾不足一块的部分不加密，每个包从同一个 IV 开始
+	pcm := make([]byte, 36)
+	for i := range pcm {
+		pcm[i] = byte(i)
+	}
+	want, _ := (&pcmDecoder{channels: 2}).Decode(pcm)
+	block, _ := aes.NewCipher(aesKey)
+	enc := append([]byte{}, pcm...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(enc[:32], enc[:32])
+	for i := 0; i < 2; i++ {
+		out, err := dec.Decode(enc)
+		assert.NoError(t, err)
+		assert.Equal(t, want, out)
+	}
+
+	// 不支持 FairPlay
+	status, _, _ = c.do("ANNOUNCE", map[string]string{"Content-Type": "application/sdp"},
+		[]byte("v=0\r\nm=audio 0 RTP/AVP 96\r\na=rtpmap:96 L16/44100/2\r\na=fpaeskey:AAAA\r\n"))
+	assert.Equal(t, 415, status)
+}
+
+// 模拟线路正在播放的文件
+type testFileStreamer struct {
+	stream.FileStreamer
+	locker sync.Mutex
+	paused bool
+}
+
+func (s *testFileStreamer) AudioFormat() audio.Format {
+	return audio.Format{Sample: audio.Sample{Rate: audio.AudioRate_44100, Bits: audio.Bits_S16LE}, Layout: audio.Layout20}
+}
+func (s *testFileStreamer) SetOutFormat(audio.Format) error { return nil }
+func (s *testFileStreamer) IsFinished() bool                { return false }
+func (s *testFileStreamer) IsPaused() bool {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	return s.paused
+}
+func (s *testFileStreamer) SetPause(p bool) {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+	s.paused = p
+}
+
+func TestRaopPauseFile(t *testing.T) {
+	bus.Init(utils.NewEmptyContext())
+
+	line := speaker.NewLine("airplay pause")
+	fs := &testFileStreamer{}
+	line.ApplyInput(fs)
+
+	srv, err := newRaopServer(line, utils.NewEmptyContext().Logger("airplay"), "127.0.0.1:0", nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer srv.Close()
+
+	dial := func() *rtspClient {
+		conn, err := net.Dial("tcp4", fmt.Sprintf("127.0.0.1:%d", srv.Port()))
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		t.Cleanup(func() { conn.Close() })
+		return &rtspClient{t: t, conn: conn, r: textproto.NewReader(bufio.NewReader(conn))}
+	}
+	start := func(c *rtspClient) {
+		status, _, _ := c.do("ANNOUNCE", map[string]string{"Content-Type": "application/sdp"},
+			[]byte("v=0\r\nm=audio 0 RTP/AVP 96\r\na=rtpmap:96 L16/44100/2\r\n"))
+		assert.Equal(t, 200, status)
+		status, _, _ = c.do("SETUP", map[string]string{"Transport": "RTP/AVP/UDP;unicast;mode=record"}, nil)
+		assert.Equal(t, 200, status)
+		status, _, _ = c.do("RECORD", nil, nil)
+		assert.Equal(t, 200, status)
+	}
+
+	// 断开时恢复接入时暂停的文件
+	c := dial()
+	start(c)
+	assert.True(t, fs.IsPaused())
+	status, _, _ := c.do("TEARDOWN", nil, nil)
+	assert.Equal(t, 200, status)
+	assert.False(t, fs.IsPaused())
+
+	// 被其它发送端抢占时不恢复，由新的发送端断开时恢复
+	start(c)
+	assert.True(t, fs.IsPaused())
+	start(dial())
+	assert.Eventually(t, func() bool {
+		srv.locker.Lock()
+		defer srv.locker.Unlock()
+		return len(srv.sessions) == 1
+	}, time.Second, 5*time.Millisecond)
+	assert.True(t, fs.IsPaused())
+
+	// 关闭服务时恢复
+	srv.Close()
+	assert.False(t, fs.IsPaused())
+	assert.Nil(t, line.Input.ReceiverStreamer())
+	assert.Equal(t, stream.ST_File, line.Input.From)
+
+	// 关闭后不再接受连接
+	_, err = net.Dial("tcp4", fmt.Sprintf("127.0.0.1:%d", srv.Port()))
+	assert.Error(t, err)
+}
+
+func TestMDNSAnswer(t *testing.T) {
+	m := &mdnsResponder{
+		log:     utils.NewEmptyContext().Logger("airplay"),
+		host:    "castserver.local.",
+		ips:     []net.IP{net.IPv4(192, 168, 1, 2)},
+		entries: map[string]*mdnsEntry{},
+	}
+	e := &mdnsEntry{instance: "0A0B0C0D0E0F@Living Room", port: 5001, txt: raopTXT(false)}
+	m.register(e)
+
+	query := func(id uint16, name string, qtype dnsmessage.Type) []byte {
+		msg := dnsmessage.Message{
+			Header:    dnsmessage.Header{ID: id},
+			Questions: []dnsmessage.Question{{Name: dnsmessage.MustNewName(name), Type: qtype, Class: dnsmessage.ClassINET}},
+		}
+		p, err := msg.Pack()
+		assert.NoError(t, err)
+		return p
+	}
+
+	res, unicast := m.answer(query(0, raopServiceType, dnsmessage.TypePTR), false)
+	assert.False(t, unicast)
+	var msg dnsmessage.Message
+	if !assert.NoError(t, msg.Unpack(res)) {
+		return
+	}
+	assert.True(t, msg.Header.Response)
+	if assert.Len(t, msg.Answers, 1) {
+		assert.Equal(t, e.name(), msg.Answers[0].Body.(*dnsmessage.PTRResource).PTR.String())
+	}
+	var (
+		port uint16
+		txt  []string
+		ip   [4]byte
+	)
+	for _, r := range msg.Additionals {
+		switch b := r.Body.(type) {
+		case *dnsmessage.SRVResource:
+			port = b.Port
+			assert.Equal(t, "castserver.local.", b.Target.String())
+		case *dnsmessage.TXTResource:
+			txt = b.TXT
+		case *dnsmessage.AResource:
+			ip = b.A
+		}
+	}
+	assert.Equal(t, uint16(5001), port)
+	assert.Contains(t, txt, "cn=0,1")
+	assert.Contains(t, txt, "et=0")
+	assert.Equal(t, [4]byte{192, 168, 1, 2}, ip)
+
+	// 非 5353 端口的查询带上 ID 和问题
+	res, _ = m.answer(query(1234, strings.ToLower(e.name()), dnsmessage.TypeSRV), true)
+	if assert.NoError(t, msg.Unpack(res)) {
+		assert.Equal(t, uint16(1234), msg.Header.ID)
+		assert.Len(t, msg.Questions, 1)
+		assert.Len(t, msg.Answers, 1)
+	}
+
+	res, _ = m.answer(query(0, "_airplay._tcp.local.", dnsmessage.TypePTR), false)
+	assert.Nil(t, res)
+
+	m.unregister(e.instance)
+	res, _ = m.answer(query(0, raopServiceType, dnsmessage.TypePTR), false)
+	assert.Nil(t, res)
+}
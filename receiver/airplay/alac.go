@@ -0,0 +1,401 @@
+package airplay
+
+import (
+	"errors"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// ALAC 的元素类型
+const (
+	alacSCE = 0 // 单声道
+	alacCPE = 1 // 立体声
+	alacEND = 7
+)
+
+var errALACInvalid = errors.New("invalid alac frame")
+
+// 按位读取，高位在前
+type bitReader struct {
+	buf []byte
+	pos int
+	err bool // 读取超出末尾
+}
+
+func (r *bitReader) left() int {
+	return len(r.buf)*8 - r.pos
+}
+
+func (r *bitReader) peek(n int) uint32 {
+	if n == 0 {
+		return 0
+	}
+	var v uint64
+	p := r.pos
+	for i := 0; i < 5; i++ {
+		v <<= 8
+		if idx := p/8 + i; idx < len(r.buf) {
+			v |= uint64(r.buf[idx])
+		}
+	}
+	v <<= 24 + p%8
+	return uint32(v >> (64 - n))
+}
+
+func (r *bitReader) skip(n int) {
+	r.pos += n
+	if r.pos > len(r.buf)*8 {
+		r.err = true
+	}
+}
+
+func (r *bitReader) read(n int) uint32 {
+	v := r.peek(n)
+	r.skip(n)
+	return v
+}
+
+func (r *bitReader) readSigned(n int) int32 {
+	return signExtend(int32(r.read(n)), n)
+}
+
+// 连续的 1 的个数，最多 max 个
+func (r *bitReader) unary(max int) int {
+	n := 0
+	for n < max && r.read(1) == 1 {
+		n++
+	}
+	return n
+}
+
+func signExtend(v int32, bits int) int32 {
+	shift := 32 - bits
+	return (v << shift) >> shift
+}
+
+func log2(v uint32) int {
+	if v == 0 {
+		return 0
+	}
+	return bits.Len32(v) - 1
+}
+
+func signOnly(v int32) int32 {
+	switch {
+	case v > 0:
+		return 1
+	case v < 0:
+		return -1
+	}
+	return 0
+}
+
+// alacDecoder 解码 RAOP 使用的 ALAC 帧，参数来自 SDP 的 fmtp
+type alacDecoder struct {
+	frameLength int
+	sampleSize  int
+	pb          uint32 // rice_initial_history
+	mb          uint32 // rice_history_mult
+	kb          int    // rice_limit
+	channels    int
+
+	predict [2][]int32
+	output  [2][]int32
+	extra   [2][]int32
+}
+
+// fmtp 格式：96 352 0 16 40 10 14 2 255 0 0 44100
+func newALACDecoder(fmtp string) (*alacDecoder, error) {
+	fields := strings.Fields(fmtp)
+	if len(fields) == 12 {
+		fields = fields[1:]
+	}
+	if len(fields) != 11 {
+		return nil, errors.New("invalid alac fmtp: " + fmtp)
+	}
+	v := make([]int, len(fields))
+	for i, f := range fields {
+		n, err := strconv.Atoi(f)
+		if err != nil {
+			return nil, errors.New("invalid alac fmtp: " + fmtp)
+		}
+		v[i] = n
+	}
+	d := &alacDecoder{
+		frameLength: v[0],
+		sampleSize:  v[2],
+		pb:          uint32(v[3]),
+		mb:          uint32(v[4]),
+		kb:          v[5],
+		channels:    v[6],
+	}
+	if d.frameLength <= 0 || d.frameLength > 4096 || d.channels < 1 || d.channels > 2 || d.sampleSize != 16 {
+		return nil, errors.New("unsupported alac fmtp: " + fmtp)
+	}
+	for ch := 0; ch < 2; ch++ {
+		d.predict[ch] = make([]int32, d.frameLength)
+		d.output[ch] = make([]int32, d.frameLength)
+		d.extra[ch] = make([]int32, d.frameLength)
+	}
+	return d, nil
+}
+
+func (d *alacDecoder) Channels() int {
+	return d.channels
+}
+
+// Decode 返回交错的 16 位样本
+func (d *alacDecoder) Decode(p []byte) ([]int16, error) {
+	r := &bitReader{buf: p}
+	var (
+		out []int16
+		ch  = 0
+	)
+	for r.left() >= 3 {
+		element := r.read(3)
+		if element == alacEND {
+			break
+		}
+		if element != alacSCE && element != alacCPE {
+			return nil, errALACInvalid
+		}
+		chs := 1
+		if element == alacCPE {
+			chs = 2
+		}
+		if ch+chs > d.channels {
+			return nil, errALACInvalid
+		}
+		n, err := d.decodeElement(r, chs)
+		if err != nil {
+			return nil, err
+		}
+		if out == nil {
+			out = make([]int16, n*d.channels)
+		} else if len(out) != n*d.channels {
+			return nil, errALACInvalid
+		}
+		for c := 0; c < chs; c++ {
+			for i := 0; i < n; i++ {
+				out[i*d.channels+ch+c] = int16(d.output[c][i])
+			}
+		}
+		ch += chs
+	}
+	if out == nil {
+		return nil, errALACInvalid
+	}
+	return out, nil
+}
+
+func (d *alacDecoder) decodeElement(r *bitReader, chs int) (int, error) {
+	r.skip(4)  // element instance tag
+	r.skip(12) // unused header
+
+	hasSize := r.read(1) == 1
+	extraBits := int(r.read(2)) << 3
+	bps := d.sampleSize - extraBits + chs - 1
+	if bps > 32 || bps <= 0 {
+		return 0, errALACInvalid
+	}
+	compressed := r.read(1) == 0
+
+	n := d.frameLength
+	if hasSize {
+		n = int(r.read(32))
+	}
+	if n <= 0 || n > d.frameLength {
+		return 0, errALACInvalid
+	}
+
+	var decorrShift, decorrWeight int
+	if compressed {
+		var (
+			coefs    [2][32]int32
+			order    [2]int
+			quant    [2]int
+			predType [2]int
+			mult     [2]uint32
+		)
+		decorrShift = int(r.read(8))
+		decorrWeight = int(r.read(8))
+		if chs == 2 && decorrWeight != 0 && decorrShift > 31 {
+			return 0, errALACInvalid
+		}
+		for ch := 0; ch < chs; ch++ {
+			predType[ch] = int(r.read(4))
+			quant[ch] = int(r.read(4))
+			mult[ch] = r.read(3)
+			order[ch] = int(r.read(5))
+			if order[ch] >= d.frameLength || quant[ch] == 0 {
+				return 0, errALACInvalid
+			}
+			for i := order[ch] - 1; i >= 0; i-- {
+				coefs[ch][i] = r.readSigned(16)
+			}
+		}
+		if extraBits > 0 {
+			for i := 0; i < n; i++ {
+				for ch := 0; ch < chs; ch++ {
+					d.extra[ch][i] = int32(r.read(extraBits))
+				}
+			}
+		}
+		for ch := 0; ch < chs; ch++ {
+			d.riceDecompress(r, d.predict[ch][:n], bps, mult[ch]*d.mb/4)
+			if predType[ch] == 15 {
+				// 先做一次一阶预测
+				lpcPrediction(d.predict[ch][:n], d.predict[ch][:n], bps, nil, 31, 0)
+			}
+			lpcPrediction(d.predict[ch][:n], d.output[ch][:n], bps, coefs[ch][:order[ch]], order[ch], quant[ch])
+		}
+	} else {
+		for i := 0; i < n; i++ {
+			for ch := 0; ch < chs; ch++ {
+				d.output[ch][i] = r.readSigned(d.sampleSize)
+			}
+		}
+		extraBits = 0
+	}
+	if r.err {
+		return 0, errALACInvalid
+	}
+
+	if chs == 2 && decorrWeight != 0 {
+		decorrelateStereo(d.output[0][:n], d.output[1][:n], decorrShift, decorrWeight)
+	}
+	if extraBits > 0 {
+		for ch := 0; ch < chs; ch++ {
+			for i := 0; i < n; i++ {
+				d.output[ch][i] = d.output[ch][i]<<extraBits | d.extra[ch][i]
+			}
+		}
+	}
+	return n, nil
+}
+
+// 自适应 Golomb 编码
+func (d *alacDecoder) decodeScalar(r *bitReader, k int, bps int) uint32 {
+	x := uint32(r.unary(9))
+	if x > 8 {
+		return r.read(bps)
+	}
+	if k != 1 {
+		extra := r.peek(k)
+		x = x<<k - x
+		if extra > 1 {
+			x += extra - 1
+			r.skip(k)
+		} else {
+			r.skip(k - 1)
+		}
+	}
+	return x
+}
+
+func (d *alacDecoder) riceDecompress(r *bitReader, out []int32, bps int, mult uint32) {
+	var (
+		history = d.pb
+		signMod = uint32(0)
+		n       = len(out)
+	)
+	for i := 0; i < n; i++ {
+		k := log2(history>>9 + 3)
+		if k > d.kb {
+			k = d.kb
+		}
+		x := d.decodeScalar(r, k, bps) + signMod
+		signMod = 0
+		out[i] = int32(x>>1) ^ -int32(x&1)
+
+		if x > 0xffff {
+			history = 0xffff
+		} else {
+			history += x*mult - (history*mult)>>9
+		}
+
+		// 连续的 0 单独编码
+		if history < 128 && i+1 < n {
+			k = 7 - log2(history) + int((history+16)>>6)
+			if k > d.kb {
+				k = d.kb
+			}
+			block := int(d.decodeScalar(r, k, 16))
+			if block > 0 {
+				if block >= n-i {
+					block = n - i - 1
+				}
+				for j := 0; j < block; j++ {
+					out[i+1+j] = 0
+				}
+				i += block
+			}
+			if block <= 0xffff {
+				signMod = 1
+			}
+			history = 0
+		}
+	}
+}
+
+func lpcPrediction(errs []int32, out []int32, bps int, coefs []int32, order int, quant int) {
+	n := len(errs)
+	if n == 0 {
+		return
+	}
+	out[0] = errs[0]
+	if n <= 1 {
+		return
+	}
+	if order == 0 {
+		copy(out[1:], errs[1:])
+		return
+	}
+	if order == 31 {
+		for i := 1; i < n; i++ {
+			out[i] = signExtend(out[i-1]+errs[i], bps)
+		}
+		return
+	}
+
+	i := 1
+	for ; i <= order && i < n; i++ {
+		out[i] = signExtend(out[i-1]+errs[i], bps)
+	}
+	for ; i < n; i++ {
+		pred := out[i-order : i]
+		d := out[i-order-1]
+		errVal := errs[i]
+
+		val := int64(0)
+		for j := 0; j < order; j++ {
+			val += int64(pred[j]-d) * int64(coefs[j])
+		}
+		val = (val + 1<<(quant-1)) >> quant
+		out[i] = signExtend(int32(val)+d+errVal, bps)
+
+		// 调整预测系数
+		sign := signOnly(errVal)
+		if sign != 0 {
+			for j := 0; j < order && errVal*sign > 0; j++ {
+				v := d - pred[j]
+				s := signOnly(v) * sign
+				coefs[j] -= s
+				v *= s
+				errVal -= (v >> quant) * int32(j+1)
+			}
+		}
+	}
+}
+
+func decorrelateStereo(left []int32, right []int32, shift int, weight int) {
+	for i := range left {
+		a := left[i]
+		b := right[i]
+		a -= (b * int32(weight)) >> shift
+		b += a
+		left[i] = b
+		right[i] = a
+	}
+}
@@ -0,0 +1,272 @@
+package airplay
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testFmtp = "96 352 0 16 40 10 14 2 255 0 0 44100"
+
+type bitWriter struct {
+	buf []byte
+	n   int
+}
+
+func (w *bitWriter) write(v uint32, bits int) {
+	for i := bits - 1; i >= 0; i-- {
+		if w.n%8 == 0 {
+			w.buf = append(w.buf, 0)
+		}
+		if v>>i&1 == 1 {
+			w.buf[len(w.buf)-1] |= 0x80 >> (w.n % 8)
+		}
+		w.n++
+	}
+}
+
+func (w *bitWriter) writeScalar(x uint32, k int, bps int) {
+	q, r := x, uint32(0)
+	if k != 1 {
+		m := uint32(1)<<k - 1
+		q, r = x/m, x%m
+	}
+	if q > 8 {
+		w.write(0x1ff, 9)
+		w.write(x, bps)
+		return
+	}
+	w.write(1<<q-1, int(q))
+	w.write(0, 1)
+	if k == 1 {
+		return
+	}
+	if r == 0 {
+		w.write(0, k-1)
+	} else {
+		w.write(r+1, k)
+	}
+}
+
+func zigzag(v int32) uint32 {
+	if v >= 0 {
+		return uint32(v) << 1
+	}
+	return uint32(-v)<<1 - 1
+}
+
+// 与 riceDecompress 对应的编码
+func (w *bitWriter) writeRice(d *alacDecoder, errs []int32, bps int, mult uint32) {
+	history, signMod := d.pb, uint32(0)
+	n := len(errs)
+	for i := 0; i < n; i++ {
+		k := log2(history>>9 + 3)
+		if k > d.kb {
+			k = d.kb
+		}
+		x := zigzag(errs[i])
+		w.writeScalar(x-signMod, k, bps)
+		signMod = 0
+		if x > 0xffff {
+			history = 0xffff
+		} else {
+			history += x*mult - (history*mult)>>9
+		}
+		if history < 128 && i+1 < n {
+			k = 7 - log2(history) + int((history+16)>>6)
+			if k > d.kb {
+				k = d.kb
+			}
+			block := 0
+			for i+1+block < n && errs[i+1+block] == 0 && block < 0xffff {
+				block++
+			}
+			w.writeScalar(uint32(block), k, 16)
+			i += block
+			signMod = 1
+			history = 0
+		}
+	}
+}
+
+// 与 lpcPrediction 对应，计算残差
+func lpcResidual(samples []int32, bps int, coefs []int32, order int, quant int) []int32 {
+	n := len(samples)
+	errs := make([]int32, n)
+	errs[0] = samples[0]
+	coefs = append([]int32{}, coefs...)
+	if order == 0 {
+		copy(errs, samples)
+		return errs
+	}
+	i := 1
+	for ; (i <= order || order == 31) && i < n; i++ {
+		errs[i] = signExtend(samples[i]-samples[i-1], bps)
+	}
+	for ; i < n; i++ {
+		pred := samples[i-order : i]
+		d := samples[i-order-1]
+		val := int64(0)
+		for j := 0; j < order; j++ {
+			val += int64(pred[j]-d) * int64(coefs[j])
+		}
+		val = (val + 1<<(quant-1)) >> quant
+		errVal := signExtend(samples[i]-int32(val)-d, bps)
+		errs[i] = errVal
+
+		sign := signOnly(errVal)
+		if sign != 0 {
+			for j := 0; j < order && errVal*sign > 0; j++ {
+				v := d - pred[j]
+				s := signOnly(v) * sign
+				coefs[j] -= s
+				v *= s
+				errVal -= (v >> quant) * int32(j+1)
+			}
+		}
+	}
+	return errs
+}
+
+type alacChannel struct {
+	predType int
+	quant    int
+	mult     uint32
+	coefs    []int32
+}
+
+// 编码立体声帧，weight 为 0 时不做声道去相关
+func encodeALAC(d *alacDecoder, left, right []int16, compressed bool, shift, weight int, chs [2]alacChannel) []byte {
+	n := len(left)
+	w := &bitWriter{}
+	w.write(alacCPE, 3)
+	w.write(0, 4)
+	w.write(0, 12)
+	hasSize := n != d.frameLength
+	w.write(boolBit(hasSize), 1)
+	w.write(0, 2)
+	w.write(boolBit(!compressed), 1)
+	if hasSize {
+		w.write(uint32(n), 32)
+	}
+	if !compressed {
+		for i := 0; i < n; i++ {
+			w.write(uint32(uint16(left[i])), 16)
+			w.write(uint32(uint16(right[i])), 16)
+		}
+		w.write(alacEND, 3)
+		return w.buf
+	}
+
+	bps := d.sampleSize + 1
+	data := [2][]int32{make([]int32, n), make([]int32, n)}
+	for i := 0; i < n; i++ {
+		l, r := int32(left[i]), int32(right[i])
+		if weight != 0 {
+			data[0][i] = r + ((l-r)*int32(weight))>>shift
+			data[1][i] = l - r
+		} else {
+			data[0][i], data[1][i] = l, r
+		}
+	}
+	w.write(uint32(shift), 8)
+	w.write(uint32(weight), 8)
+	for _, c := range chs {
+		w.write(uint32(c.predType), 4)
+		w.write(uint32(c.quant), 4)
+		w.write(c.mult, 3)
+		w.write(uint32(len(c.coefs)), 5)
+		for i := len(c.coefs) - 1; i >= 0; i-- {
+			w.write(uint32(uint16(c.coefs[i])), 16)
+		}
+	}
+	for ch, c := range chs {
+		errs := lpcResidual(data[ch], bps, c.coefs, len(c.coefs), c.quant)
+		if c.predType == 15 {
+			errs = lpcResidual(errs, bps, nil, 31, 0)
+		}
+		w.writeRice(d, errs, bps, c.mult*d.mb/4)
+	}
+	w.write(alacEND, 3)
+	return w.buf
+}
+
+func boolBit(b bool) uint32 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func testWave(n int, freq float64, amp float64) []int16 {
+	s := make([]int16, n)
+	for i := range s {
+		s[i] = int16(amp * math.Sin(2*math.Pi*freq*float64(i)/44100))
+	}
+	return s
+}
+
+func interleave(left, right []int16) []int16 {
+	out := make([]int16, 0, len(left)*2)
+	for i := range left {
+		out = append(out, left[i], right[i])
+	}
+	return out
+}
+
+func TestALACDecoder(t *testing.T) {
+	d, err := newALACDecoder(testFmtp)
+	assert.NoError(t, err)
+	assert.Equal(t, 352, d.frameLength)
+
+	_, err = newALACDecoder("96 352 0 24 40 10 14 2 255 0 0 44100")
+	assert.Error(t, err)
+
+	left := testWave(352, 440, 12000)
+	right := testWave(352, 660, 30000)
+	// 中间插入静音，测试连续 0 的编码
+	for i := 100; i < 200; i++ {
+		left[i], right[i] = 0, 0
+	}
+	right[300] = -32768
+	want := interleave(left, right)
+
+	plain := alacChannel{quant: 9, mult: 4}
+	tests := []struct {
+		name       string
+		compressed bool
+		shift      int
+		weight     int
+		chs        [2]alacChannel
+	}{
+		{"uncompressed", false, 0, 0, [2]alacChannel{}},
+		{"order 0", true, 0, 0, [2]alacChannel{plain, plain}},
+		{"first order", true, 0, 0, [2]alacChannel{{predType: 15, quant: 9, mult: 4}, {predType: 15, quant: 9, mult: 4}}},
+		{"adaptive lpc", true, 0, 0, [2]alacChannel{
+			{quant: 9, mult: 4, coefs: []int32{-300, 800}},
+			{quant: 9, mult: 4, coefs: []int32{100, -200, 300, 500}},
+		}},
+		{"decorrelate", true, 2, 3, [2]alacChannel{
+			{quant: 9, mult: 4, coefs: []int32{-300, 800}},
+			{predType: 15, quant: 9, mult: 4},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := encodeALAC(d, left, right, tt.compressed, tt.shift, tt.weight, tt.chs)
+			got, err := d.Decode(p)
+			assert.NoError(t, err)
+			assert.Equal(t, want, got)
+		})
+	}
+
+	// 不完整的帧
+	p := encodeALAC(d, left[:10], right[:10], false, 0, 0, [2]alacChannel{})
+	got, err := d.Decode(p)
+	assert.NoError(t, err)
+	assert.Equal(t, interleave(left[:10], right[:10]), got)
+
+	_, err = d.Decode(p[:20])
+	assert.Error(t, err)
+}
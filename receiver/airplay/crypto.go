@@ -0,0 +1,108 @@
+package airplay
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"net"
+	"os"
+	"strings"
+)
+
+// 加密的音频使用 config.AirPlayKey 指定的 RSA 私钥。
+// 发送端使用内置的 AirPort Express 公钥验证 Apple-Challenge 的回复并加密 AES 密钥，
+// 所以只有对应的私钥才能被 iTunes 等发送端接受。本项目不包含该私钥，未配置时只接受不加密的音频。
+// FairPlay 加密（fpaeskey）不支持
+
+// 读取 PEM 格式的 PKCS#1 或者 PKCS#8 私钥
+func loadKey(file string) (*rsa.PrivateKey, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("invalid pem key: " + file)
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := k.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("not a rsa key: " + file)
+	}
+	return key, nil
+}
+
+// SDP 和头部中的 base64 可能没有补齐
+func decodeBase64(s string) ([]byte, error) {
+	return base64.RawStdEncoding.DecodeString(strings.TrimRight(strings.TrimSpace(s), "="))
+}
+
+// Apple-Challenge 的回复，对 challenge、本机地址和硬件地址签名，不足 32 字节时补零
+func challengeResponse(key *rsa.PrivateKey, challenge string, ip net.IP, hwAddr []byte) (string, error) {
+	c, err := decodeBase64(challenge)
+	if err != nil {
+		return "", err
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	buf := append(append(c, ip...), hwAddr...)
+	for len(buf) < 32 {
+		buf = append(buf, 0)
+	}
+	sig, err := rsa.SignPKCS1v15(nil, key, 0, buf)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawStdEncoding.EncodeToString(sig), nil
+}
+
+// 使用私钥解开 ANNOUNCE 中的 AES 密钥
+func newPacketCipher(key *rsa.PrivateKey, aesKey string, aesIV string) (cipher.Block, []byte, error) {
+	ek, err := decodeBase64(aesKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	iv, err := decodeBase64(aesIV)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(iv) != aes.BlockSize {
+		return nil, nil, errors.New("invalid aes iv")
+	}
+	k, err := rsa.DecryptOAEP(sha1.New(), nil, key, ek, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	block, err := aes.NewCipher(k)
+	if err != nil {
+		return nil, nil, err
+	}
+	return block, iv, nil
+}
+
+// 解密后再解码。每个包都从同一个 IV 开始，末尾不足一块的部分不加密
+type decryptDecoder struct {
+	frameDecoder
+	block cipher.Block
+	iv    []byte
+	buf   []byte // 由 raopStreamer 的锁保护
+}
+
+func (d *decryptDecoder) Decode(p []byte) ([]int16, error) {
+	d.buf = append(d.buf[:0], p...)
+	n := len(p) / aes.BlockSize * aes.BlockSize
+	cipher.NewCBCDecrypter(d.block, d.iv).CryptBlocks(d.buf[:n], d.buf[:n])
+	return d.frameDecoder.Decode(d.buf)
+}
@@ -0,0 +1,307 @@
+package airplay
+
+import (
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/zwcway/castserver-go/common/config"
+	lg "github.com/zwcway/castserver-go/common/log"
+	"github.com/zwcway/castserver-go/common/utils"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	mdnsPort        = 5353
+	mdnsTTL         = 120
+	mdnsCacheFlush  = 1 << 15 // 回复中的缓存刷新位
+	mdnsUnicast     = 1 << 15 // 查询中要求单播回复
+	raopServiceType = "_raop._tcp.local."
+	servicesQuery   = "_services._dns-sd._udp.local."
+)
+
+var mdnsGroup = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: mdnsPort}
+
+// mdnsEntry 一个 RAOP 服务
+type mdnsEntry struct {
+	instance string // 设备ID@名称
+	port     uint16
+	txt      []string
+}
+
+func (e *mdnsEntry) name() string {
+	return e.instance + "." + raopServiceType
+}
+
+// mdnsResponder 只回答 RAOP 服务相关的查询
+type mdnsResponder struct {
+	log  lg.Logger
+	conn *net.UDPConn
+	host string // 主机名.local.
+	ips  []net.IP
+
+	locker  sync.Mutex
+	entries map[string]*mdnsEntry
+}
+
+func newMDNSResponder(listen config.Interface, log lg.Logger) (*mdnsResponder, error) {
+	conn, err := net.ListenMulticastUDP("udp4", listen.Iface, mdnsGroup)
+	if err != nil {
+		return nil, err
+	}
+	host, _ := os.Hostname()
+	if i := strings.IndexByte(host, '.'); i > 0 {
+		host = host[:i]
+	}
+	if host == "" {
+		host = "castserver"
+	}
+	return &mdnsResponder{
+		log:     log,
+		conn:    conn,
+		host:    host + ".local.",
+		ips:     listenIPv4(listen),
+		entries: map[string]*mdnsEntry{},
+	}, nil
+}
+
+// 广播的 IPv4 地址
+func listenIPv4(listen config.Interface) []net.IP {
+	var ifaces []*net.Interface
+	if listen.Iface != nil {
+		ifaces = []*net.Interface{listen.Iface}
+	} else if addr := listen.AddrPort.Addr(); addr.IsValid() && !addr.IsUnspecified() {
+		return []net.IP{addr.AsSlice()}
+	} else {
+		ifaces = utils.Interfaces()
+	}
+
+	ips := []net.IP{}
+	for _, iface := range ifaces {
+		for _, a := range utils.InterfaceAddrs(iface, nil) {
+			if ip := a.IP.To4(); ip != nil {
+				ips = append(ips, ip)
+			}
+		}
+	}
+	return ips
+}
+
+func (m *mdnsResponder) serve() {
+	buf := make([]byte, 9000)
+	for {
+		n, src, err := m.conn.ReadFromUDP(buf)
+		if err != nil {
+			if !utils.IsConnectCloseError(err) {
+				m.log.Error("read mdns failed", lg.Error(err))
+			}
+			return
+		}
+		// 非 5353 端口的查询按单播 DNS 回复
+		legacy := src.Port != mdnsPort
+		res, unicast := m.answer(buf[:n], legacy)
+		if res == nil {
+			continue
+		}
+		dst := mdnsGroup
+		if unicast || legacy {
+			dst = src
+		}
+		if _, err = m.conn.WriteToUDP(res, dst); err != nil {
+			m.log.Warn("send mdns failed", lg.Error(err))
+		}
+	}
+}
+
+// answer 回复查询，unicast 表示查询方要求单播回复
+func (m *mdnsResponder) answer(query []byte, legacy bool) (res []byte, unicast bool) {
+	var p dnsmessage.Parser
+	h, err := p.Start(query)
+	if err != nil || h.Response {
+		return nil, false
+	}
+	questions, err := p.AllQuestions()
+	if err != nil {
+		return nil, false
+	}
+
+	m.locker.Lock()
+	defer m.locker.Unlock()
+
+	var (
+		answers     []dnsmessage.Resource
+		additionals []dnsmessage.Resource
+		withHost    bool
+	)
+	unicast = true
+	for _, q := range questions {
+		if q.Class&mdnsUnicast == 0 {
+			unicast = false
+		}
+		name := q.Name.String()
+		switch {
+		case strings.EqualFold(name, raopServiceType) && (q.Type == dnsmessage.TypePTR || q.Type == dnsmessage.TypeALL):
+			for _, e := range m.entries {
+				answers = append(answers, m.ptr(raopServiceType, e.name(), mdnsTTL))
+				additionals = append(additionals, m.srv(e, mdnsTTL, !legacy), m.txt(e, mdnsTTL, !legacy))
+				withHost = true
+			}
+		case strings.EqualFold(name, servicesQuery) && (q.Type == dnsmessage.TypePTR || q.Type == dnsmessage.TypeALL):
+			if len(m.entries) > 0 {
+				answers = append(answers, m.ptr(servicesQuery, raopServiceType, mdnsTTL))
+			}
+		case strings.EqualFold(name, m.host) && (q.Type == dnsmessage.TypeA || q.Type == dnsmessage.TypeALL):
+			answers = append(answers, m.addresses(mdnsTTL, !legacy)...)
+		default:
+			for _, e := range m.entries {
+				if !strings.EqualFold(name, e.name()) {
+					continue
+				}
+				if q.Type == dnsmessage.TypeSRV || q.Type == dnsmessage.TypeALL {
+					answers = append(answers, m.srv(e, mdnsTTL, !legacy))
+					withHost = true
+				}
+				if q.Type == dnsmessage.TypeTXT || q.Type == dnsmessage.TypeALL {
+					answers = append(answers, m.txt(e, mdnsTTL, !legacy))
+				}
+			}
+		}
+	}
+	if len(answers) == 0 {
+		return nil, false
+	}
+	if withHost {
+		additionals = append(additionals, m.addresses(mdnsTTL, !legacy)...)
+	}
+
+	header := dnsmessage.Header{Response: true, Authoritative: true}
+	if !legacy {
+		questions = nil
+	} else {
+		header.ID = h.ID
+	}
+	res, err = buildMessage(header, questions, answers, additionals)
+	if err != nil {
+		m.log.Error("build mdns response failed", lg.Error(err))
+		return nil, false
+	}
+	return res, unicast
+}
+
+func (m *mdnsResponder) ptr(name string, target string, ttl uint32) dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(name), Type: dnsmessage.TypePTR, Class: dnsmessage.ClassINET, TTL: ttl},
+		Body:   &dnsmessage.PTRResource{PTR: dnsmessage.MustNewName(target)},
+	}
+}
+
+func (m *mdnsResponder) srv(e *mdnsEntry, ttl uint32, flush bool) dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(e.name()), Type: dnsmessage.TypeSRV, Class: recordClass(flush), TTL: ttl},
+		Body:   &dnsmessage.SRVResource{Port: e.port, Target: dnsmessage.MustNewName(m.host)},
+	}
+}
+
+func (m *mdnsResponder) txt(e *mdnsEntry, ttl uint32, flush bool) dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(e.name()), Type: dnsmessage.TypeTXT, Class: recordClass(flush), TTL: ttl},
+		Body:   &dnsmessage.TXTResource{TXT: e.txt},
+	}
+}
+
+func (m *mdnsResponder) addresses(ttl uint32, flush bool) []dnsmessage.Resource {
+	list := make([]dnsmessage.Resource, 0, len(m.ips))
+	for _, ip := range m.ips {
+		a := dnsmessage.AResource{}
+		copy(a.A[:], ip.To4())
+		list = append(list, dnsmessage.Resource{
+			Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(m.host), Type: dnsmessage.TypeA, Class: recordClass(flush), TTL: ttl},
+			Body:   &a,
+		})
+	}
+	return list
+}
+
+// 唯一的记录设置缓存刷新位
+func recordClass(flush bool) dnsmessage.Class {
+	if flush {
+		return dnsmessage.ClassINET | mdnsCacheFlush
+	}
+	return dnsmessage.ClassINET
+}
+
+func buildMessage(h dnsmessage.Header, questions []dnsmessage.Question, answers []dnsmessage.Resource, additionals []dnsmessage.Resource) ([]byte, error) {
+	msg := dnsmessage.Message{
+		Header:      h,
+		Questions:   questions,
+		Answers:     answers,
+		Additionals: additionals,
+	}
+	return msg.Pack()
+}
+
+// 广播服务，ttl 为 0 时通知下线
+func (m *mdnsResponder) announce(e *mdnsEntry, ttl uint32) {
+	if m.conn == nil {
+		return
+	}
+	answers := []dnsmessage.Resource{
+		m.ptr(raopServiceType, e.name(), ttl),
+		m.srv(e, ttl, true),
+		m.txt(e, ttl, true),
+	}
+	if ttl > 0 {
+		answers = append(answers, m.addresses(ttl, true)...)
+	}
+	res, err := buildMessage(dnsmessage.Header{Response: true, Authoritative: true}, nil, answers, nil)
+	if err != nil {
+		m.log.Error("build mdns announcement failed", lg.Error(err))
+		return
+	}
+	if _, err = m.conn.WriteToUDP(res, mdnsGroup); err != nil {
+		m.log.Warn("send mdns failed", lg.Error(err))
+	}
+}
+
+func (m *mdnsResponder) register(e *mdnsEntry) {
+	if m == nil {
+		return
+	}
+	m.locker.Lock()
+	defer m.locker.Unlock()
+
+	m.entries[e.instance] = e
+	m.announce(e, mdnsTTL)
+}
+
+func (m *mdnsResponder) unregister(instance string) {
+	if m == nil {
+		return
+	}
+	m.locker.Lock()
+	defer m.locker.Unlock()
+
+	e, ok := m.entries[instance]
+	if !ok {
+		return
+	}
+	delete(m.entries, instance)
+	m.announce(e, 0)
+}
+
+func (m *mdnsResponder) Close() {
+	if m == nil {
+		return
+	}
+	m.locker.Lock()
+	for _, e := range m.entries {
+		m.announce(e, 0)
+	}
+	m.entries = map[string]*mdnsEntry{}
+	m.locker.Unlock()
+
+	if m.conn != nil {
+		m.conn.Close()
+	}
+}
@@ -0,0 +1,223 @@
+package airplay
+
+import (
+	"encoding/binary"
+	"net"
+	"sync"
+	"time"
+
+	lg "github.com/zwcway/castserver-go/common/log"
+	"github.com/zwcway/castserver-go/common/utils"
+)
+
+// RTP 负载类型
+const (
+	ptTimingRequest = 0x52
+	ptTimingReply   = 0x53
+	ptSync          = 0x54
+	ptResendRequest = 0x55
+	ptResendReply   = 0x56
+	ptAudio         = 0x60
+)
+
+// 发送端时钟的同步间隔
+const timingInterval = 3 * time.Second
+
+// 1900 年至 1970 年的秒数
+const ntpEpochOffset = 2208988800
+
+func ntpTime(t time.Time) uint64 {
+	sec := uint64(t.Unix() + ntpEpochOffset)
+	frac := uint64(t.Nanosecond()) << 32 / uint64(time.Second)
+	return sec<<32 | frac
+}
+
+func ntpToTime(v uint64) time.Time {
+	sec := int64(v>>32) - ntpEpochOffset
+	nsec := int64((v & 0xffffffff) * uint64(time.Second) >> 32)
+	return time.Unix(sec, nsec)
+}
+
+// rtpChannels 音频、控制、时钟三个 UDP 端口
+type rtpChannels struct {
+	log      lg.Logger
+	streamer *raopStreamer
+
+	audio   *net.UDPConn
+	control *net.UDPConn
+	timing  *net.UDPConn
+
+	// 发送端的控制和时钟端口
+	remoteControl *net.UDPAddr
+	remoteTiming  *net.UDPAddr
+
+	locker     sync.Mutex
+	resendSeq  uint16
+	clockDelta time.Duration // 发送端时钟减去本机时钟
+
+	wg utils.WaitGroup
+}
+
+func listenRTP(ip net.IP, log lg.Logger, s *raopStreamer) (c *rtpChannels, err error) {
+	c = &rtpChannels{log: log, streamer: s}
+
+	for _, conn := range []**net.UDPConn{&c.audio, &c.control, &c.timing} {
+		*conn, err = net.ListenUDP("udp", &net.UDPAddr{IP: ip})
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func udpPort(conn *net.UDPConn) int {
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+func (c *rtpChannels) serve(remote net.IP, controlPort int, timingPort int) {
+	if controlPort > 0 {
+		c.remoteControl = &net.UDPAddr{IP: remote, Port: controlPort}
+	}
+	if timingPort > 0 {
+		c.remoteTiming = &net.UDPAddr{IP: remote, Port: timingPort}
+	}
+
+	c.wg.Go(func(<-chan struct{}) { c.readRoutine(c.audio, c.onAudio) })
+	c.wg.Go(func(<-chan struct{}) { c.readRoutine(c.control, c.onControl) })
+	c.wg.Go(func(<-chan struct{}) { c.readRoutine(c.timing, c.onTiming) })
+	c.wg.Go(c.timingRoutine)
+}
+
+func (c *rtpChannels) readRoutine(conn *net.UDPConn, handler func([]byte, *net.UDPAddr)) {
+	buf := make([]byte, 2048)
+	for {
+		n, src, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if !utils.IsConnectCloseError(err) {
+				c.log.Error("read rtp failed", lg.Error(err))
+			}
+			return
+		}
+		if n < 4 {
+			continue
+		}
+		handler(buf[:n], src)
+	}
+}
+
+func (c *rtpChannels) onAudio(p []byte, src *net.UDPAddr) {
+	if len(p) < 12 || p[1]&0x7f != ptAudio {
+		return
+	}
+	c.pushAudio(p)
+}
+
+func (c *rtpChannels) pushAudio(p []byte) {
+	seq := binary.BigEndian.Uint16(p[2:4])
+	first, count := c.streamer.push(seq, p[12:])
+	if count > 0 {
+		c.requestResend(first, count)
+	}
+}
+
+// 请求重传丢失的包，发送端在控制端口回复
+func (c *rtpChannels) requestResend(first uint16, count uint16) {
+	if c.remoteControl == nil {
+		return
+	}
+	c.locker.Lock()
+	c.resendSeq++
+	seq := c.resendSeq
+	c.locker.Unlock()
+
+	p := make([]byte, 8)
+	p[0] = 0x80
+	p[1] = 0x80 | ptResendRequest
+	binary.BigEndian.PutUint16(p[2:], seq)
+	binary.BigEndian.PutUint16(p[4:], first)
+	binary.BigEndian.PutUint16(p[6:], count)
+	c.control.WriteToUDP(p, c.remoteControl)
+}
+
+func (c *rtpChannels) onControl(p []byte, src *net.UDPAddr) {
+	switch p[1] & 0x7f {
+	case ptSync:
+		// 按序号缓冲播放，不需要按时间同步
+	case ptResendReply:
+		// 重传的包前面有 4 字节的头
+		if len(p) < 16 || p[5]&0x7f != ptAudio {
+			return
+		}
+		c.pushAudio(p[4:])
+	}
+}
+
+func (c *rtpChannels) onTiming(p []byte, src *net.UDPAddr) {
+	if len(p) < 32 {
+		return
+	}
+	now := time.Now()
+	switch p[1] & 0x7f {
+	case ptTimingRequest:
+		r := make([]byte, 32)
+		r[0] = 0x80
+		r[1] = 0x80 | ptTimingReply
+		binary.BigEndian.PutUint16(r[2:], 7)
+		copy(r[8:16], p[24:32])
+		binary.BigEndian.PutUint64(r[16:], ntpTime(now))
+		binary.BigEndian.PutUint64(r[24:], ntpTime(time.Now()))
+		c.timing.WriteToUDP(r, src)
+	case ptTimingReply:
+		origin := ntpToTime(binary.BigEndian.Uint64(p[8:16]))
+		received := ntpToTime(binary.BigEndian.Uint64(p[16:24]))
+		sent := ntpToTime(binary.BigEndian.Uint64(p[24:32]))
+		c.locker.Lock()
+		c.clockDelta = (received.Sub(origin) + sent.Sub(now)) / 2
+		c.locker.Unlock()
+	}
+}
+
+func (c *rtpChannels) requestTiming() {
+	if c.remoteTiming == nil {
+		return
+	}
+	p := make([]byte, 32)
+	p[0] = 0x80
+	p[1] = 0x80 | ptTimingRequest
+	binary.BigEndian.PutUint16(p[2:], 7)
+	binary.BigEndian.PutUint64(p[24:], ntpTime(time.Now()))
+	c.timing.WriteToUDP(p, c.remoteTiming)
+}
+
+func (c *rtpChannels) timingRoutine(done <-chan struct{}) {
+	ticker := time.NewTicker(timingInterval)
+	defer ticker.Stop()
+
+	c.requestTiming()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			c.requestTiming()
+		}
+	}
+}
+
+// ClockDelta 发送端时钟与本机时钟的差
+func (c *rtpChannels) ClockDelta() time.Duration {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+
+	return c.clockDelta
+}
+
+func (c *rtpChannels) Close() {
+	for _, conn := range []*net.UDPConn{c.audio, c.control, c.timing} {
+		if conn != nil {
+			conn.Close()
+		}
+	}
+	c.wg.ExitAndWait()
+}
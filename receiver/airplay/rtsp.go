@@ -0,0 +1,542 @@
+package airplay
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rsa"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"math"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zwcway/castserver-go/common/config"
+	lg "github.com/zwcway/castserver-go/common/log"
+	"github.com/zwcway/castserver-go/common/speaker"
+	"github.com/zwcway/castserver-go/common/stream"
+	"github.com/zwcway/castserver-go/common/utils"
+)
+
+// AirPlay 的音量范围，-144 表示静音
+const (
+	volumeMin  = -30.0
+	volumeMute = -144.0
+)
+
+// L16 没有帧长参数时使用的每包样本数
+const defaultFrameLength = 352
+
+var rtspStatus = map[int]string{
+	200: "OK",
+	400: "Bad Request",
+	415: "Unsupported Media Type",
+	453: "Not Enough Bandwidth",
+	455: "Method Not Valid in This State",
+	501: "Not Implemented",
+}
+
+type rtspRequest struct {
+	method string
+	uri    string
+	header textproto.MIMEHeader
+	body   []byte
+}
+
+type rtspResponse struct {
+	status int
+	header [][2]string
+	body   []byte
+}
+
+func (r *rtspResponse) set(key string, val string) {
+	r.header = append(r.header, [2]string{key, val})
+}
+
+func readRequest(r *textproto.Reader) (*rtspRequest, error) {
+	line, err := r.ReadLine()
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.SplitN(line, " ", 3)
+	if len(parts) != 3 || !strings.HasPrefix(parts[2], "RTSP/") {
+		return nil, errors.New("invalid rtsp request: " + line)
+	}
+	req := &rtspRequest{method: parts[0], uri: parts[1]}
+	if req.header, err = r.ReadMIMEHeader(); err != nil {
+		return nil, err
+	}
+	if cl := req.header.Get("Content-Length"); cl != "" {
+		n, err := strconv.Atoi(cl)
+		if err != nil || n < 0 || n > 8<<20 {
+			return nil, errors.New("invalid content length: " + cl)
+		}
+		req.body = make([]byte, n)
+		if _, err = io.ReadFull(r.R, req.body); err != nil {
+			return nil, err
+		}
+	}
+	return req, nil
+}
+
+func writeResponse(w io.Writer, cseq string, res *rtspResponse) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "RTSP/1.0 %d %s\r\n", res.status, rtspStatus[res.status])
+	fmt.Fprintf(&buf, "CSeq: %s\r\n", cseq)
+	buf.WriteString("Server: AirTunes/105.1\r\n")
+	for _, h := range res.header {
+		fmt.Fprintf(&buf, "%s: %s\r\n", h[0], h[1])
+	}
+	if len(res.body) > 0 {
+		fmt.Fprintf(&buf, "Content-Length: %d\r\n", len(res.body))
+	}
+	buf.WriteString("\r\n")
+	buf.Write(res.body)
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// raopSession 一个发送端的连接
+type raopSession struct {
+	conn net.Conn
+
+	// 请求和连接断开时的清理互斥，保护 rtp、streamer 等
+	locker sync.Mutex
+
+	decoder     frameDecoder
+	rate        int
+	frameLength int
+
+	streamer *raopStreamer
+	rtp      *rtpChannels
+	applied  bool // 已经接入线路
+
+	title  string
+	artist string
+}
+
+// raopServer 一个线路的 RTSP 服务，同一时间只接受一个发送端
+type raopServer struct {
+	line *speaker.Line
+	log  lg.Logger
+	ln   net.Listener
+	key  *rsa.PrivateKey // 为 nil 时只接受不加密的音频
+
+	locker   sync.Mutex
+	session  *raopSession
+	sessions map[*raopSession]struct{}
+	paused   stream.FileStreamer // 接入时暂停的文件，当前发送端断开时恢复
+	closed   bool
+	wg       utils.WaitGroup
+}
+
+func newRaopServer(line *speaker.Line, log lg.Logger, addr string, key *rsa.PrivateKey) (*raopServer, error) {
+	ln, err := net.Listen("tcp4", addr)
+	if err != nil {
+		return nil, err
+	}
+	s := &raopServer{
+		line:     line,
+		log:      log,
+		ln:       ln,
+		key:      key,
+		sessions: map[*raopSession]struct{}{},
+	}
+	s.wg.Go(func(<-chan struct{}) { s.acceptRoutine() })
+	return s, nil
+}
+
+func (s *raopServer) Port() uint16 {
+	return uint16(s.ln.Addr().(*net.TCPAddr).Port)
+}
+
+func (s *raopServer) acceptRoutine() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			if !utils.IsConnectCloseError(err) {
+				s.log.Error("accept rtsp failed", lg.Error(err))
+			}
+			return
+		}
+		sess := &raopSession{conn: conn}
+		// 关闭后不再增加协程，Close 才能等待所有协程退出
+		s.locker.Lock()
+		if s.closed {
+			s.locker.Unlock()
+			conn.Close()
+			return
+		}
+		s.sessions[sess] = struct{}{}
+		s.wg.Go(func(<-chan struct{}) { s.serveConn(sess) })
+		s.locker.Unlock()
+	}
+}
+
+func (s *raopServer) serveConn(sess *raopSession) {
+	defer func() {
+		sess.locker.Lock()
+		s.teardown(sess)
+		sess.locker.Unlock()
+		sess.conn.Close()
+
+		s.locker.Lock()
+		delete(s.sessions, sess)
+		s.locker.Unlock()
+	}()
+
+	r := textproto.NewReader(bufio.NewReader(sess.conn))
+	for {
+		req, err := readRequest(r)
+		if err != nil {
+			if err != io.EOF && !utils.IsConnectCloseError(err) {
+				s.log.Warn("read rtsp failed", lg.String("from", sess.conn.RemoteAddr().String()), lg.Error(err))
+			}
+			return
+		}
+		res := s.handle(sess, req)
+		if err = writeResponse(sess.conn, req.header.Get("CSeq"), res); err != nil {
+			return
+		}
+	}
+}
+
+func (s *raopServer) handle(sess *raopSession, req *rtspRequest) *rtspResponse {
+	sess.locker.Lock()
+	defer sess.locker.Unlock()
+
+	res := &rtspResponse{status: 200}
+	res.set("Audio-Jack-Status", "connected; type=analog")
+	if ch := req.header.Get("Apple-Challenge"); ch != "" && s.key != nil {
+		ip := sess.conn.LocalAddr().(*net.TCPAddr).IP
+		if resp, err := challengeResponse(s.key, ch, ip, deviceAddr(s.line)); err == nil {
+			res.set("Apple-Response", resp)
+		} else {
+			s.log.Warn("invalid apple challenge", lg.Error(err))
+		}
+	}
+
+	switch req.method {
+	case "OPTIONS":
+		res.set("Public", "ANNOUNCE, SETUP, RECORD, PAUSE, FLUSH, TEARDOWN, OPTIONS, GET_PARAMETER, SET_PARAMETER")
+	case "ANNOUNCE":
+		res.status = s.announce(sess, req)
+	case "SETUP":
+		res.status = s.setup(sess, req, res)
+	case "RECORD":
+		if sess.streamer == nil {
+			res.status = 455
+			break
+		}
+		s.record(sess)
+		res.set("Audio-Latency", strconv.Itoa(sess.streamer.bufferFrames*sess.frameLength))
+	case "FLUSH":
+		if sess.streamer != nil {
+			seq, ok := rtpInfoSeq(req.header.Get("RTP-Info"))
+			sess.streamer.flush(seq, ok)
+		}
+	case "TEARDOWN":
+		s.teardown(sess)
+	case "SET_PARAMETER":
+		res.status = s.setParameter(sess, req)
+	case "GET_PARAMETER":
+		if strings.Contains(string(req.body), "volume") {
+			res.set("Content-Type", "text/parameters")
+			res.body = []byte(fmt.Sprintf("volume: %.6f\r\n", airplayVolume(s.line.Volume, s.line.Mute)))
+		}
+	case "PAUSE":
+	default:
+		res.status = 501
+	}
+	return res
+}
+
+func (s *raopServer) announce(sess *raopSession, req *rtspRequest) int {
+	var rtpmap, fmtp, aesKey, aesIV string
+	for _, l := range strings.Split(string(req.body), "\n") {
+		l = strings.TrimSpace(l)
+		switch {
+		case strings.HasPrefix(l, "a=rtpmap:"):
+			rtpmap = l[len("a=rtpmap:"):]
+		case strings.HasPrefix(l, "a=fmtp:"):
+			fmtp = l[len("a=fmtp:"):]
+		case strings.HasPrefix(l, "a=rsaaeskey:"):
+			aesKey = l[len("a=rsaaeskey:"):]
+		case strings.HasPrefix(l, "a=aesiv:"):
+			aesIV = l[len("a=aesiv:"):]
+		case strings.HasPrefix(l, "a=fpaeskey:"):
+			s.log.Warn("fairplay not supported", lg.String("from", sess.conn.RemoteAddr().String()))
+			return 415
+		}
+	}
+	// 去掉负载类型
+	if i := strings.IndexByte(rtpmap, ' '); i > 0 {
+		rtpmap = rtpmap[i+1:]
+	}
+
+	switch {
+	case strings.HasPrefix(rtpmap, "AppleLossless"):
+		dec, err := newALACDecoder(fmtp)
+		if err != nil {
+			s.log.Warn("invalid announce", lg.Error(err))
+			return 415
+		}
+		fields := strings.Fields(fmtp)
+		sess.rate, _ = strconv.Atoi(fields[len(fields)-1])
+		sess.decoder, sess.frameLength = dec, dec.frameLength
+	case strings.HasPrefix(rtpmap, "L16"):
+		// L16/44100/2
+		sl := strings.Split(rtpmap, "/")
+		sess.rate, sess.frameLength = 44100, defaultFrameLength
+		chs := 2
+		if len(sl) > 1 {
+			sess.rate, _ = strconv.Atoi(sl[1])
+		}
+		if len(sl) > 2 {
+			chs, _ = strconv.Atoi(sl[2])
+		}
+		if chs != 1 && chs != 2 {
+			return 415
+		}
+		sess.decoder = &pcmDecoder{channels: chs}
+	default:
+		s.log.Warn("codec not supported", lg.String("rtpmap", rtpmap))
+		return 415
+	}
+	if !rateSupported(sess.rate) {
+		return 415
+	}
+	if aesKey != "" {
+		if s.key == nil {
+			s.log.Warn("encrypted stream not supported without airplay key", lg.String("from", sess.conn.RemoteAddr().String()))
+			return 415
+		}
+		block, iv, err := newPacketCipher(s.key, aesKey, aesIV)
+		if err != nil {
+			s.log.Warn("invalid aes key", lg.Error(err))
+			return 415
+		}
+		sess.decoder = &decryptDecoder{frameDecoder: sess.decoder, block: block, iv: iv}
+	}
+
+	// 新的发送端抢占线路
+	s.locker.Lock()
+	old := s.session
+	s.session = sess
+	s.locker.Unlock()
+	if old != nil && old != sess {
+		old.conn.Close()
+	}
+	return 200
+}
+
+func rateSupported(rate int) bool {
+	return rate == 44100 || rate == 48000
+}
+
+func (s *raopServer) setup(sess *raopSession, req *rtspRequest, res *rtspResponse) int {
+	if sess.decoder == nil {
+		return 455
+	}
+	if sess.rtp != nil {
+		s.teardown(sess)
+	}
+	var controlPort, timingPort int
+	for _, kv := range strings.Split(req.header.Get("Transport"), ";") {
+		k, v, _ := strings.Cut(kv, "=")
+		switch k {
+		case "control_port":
+			controlPort, _ = strconv.Atoi(v)
+		case "timing_port":
+			timingPort, _ = strconv.Atoi(v)
+		}
+	}
+
+	bufferSamples := int(config.AirPlayBuffer * time.Duration(sess.rate) / time.Second)
+	sess.streamer = newRaopStreamer(sess.decoder, sess.rate, sess.frameLength, bufferSamples)
+
+	local := sess.conn.LocalAddr().(*net.TCPAddr)
+	remote := sess.conn.RemoteAddr().(*net.TCPAddr)
+	rtp, err := listenRTP(local.IP, s.log, sess.streamer)
+	if err != nil {
+		s.log.Error("listen rtp failed", lg.Error(err))
+		sess.streamer = nil
+		return 453
+	}
+	sess.rtp = rtp
+	rtp.serve(remote.IP, controlPort, timingPort)
+
+	res.set("Transport", fmt.Sprintf("RTP/AVP/UDP;unicast;mode=record;server_port=%d;control_port=%d;timing_port=%d",
+		udpPort(rtp.audio), udpPort(rtp.control), udpPort(rtp.timing)))
+	res.set("Session", "1")
+	return 200
+}
+
+// 接入线路，暂停正在播放的文件
+func (s *raopServer) record(sess *raopSession) {
+	if sess.applied {
+		return
+	}
+	// 抢占线路的发送端沿用之前暂停的文件
+	s.locker.Lock()
+	if s.session == nil {
+		s.session = sess
+	}
+	if fs := s.line.Input.FileStreamer(); s.paused == nil && fs != nil && !fs.IsPaused() && !fs.IsFinished() {
+		s.paused = fs
+		fs.SetPause(true)
+	}
+	s.locker.Unlock()
+	s.line.ApplyInput(sess.streamer)
+	sess.applied = true
+	if sess.title != "" || sess.artist != "" {
+		stream.BusSourceMetadata.Dispatch(sess.streamer, sess.title, sess.artist)
+	}
+	s.log.Info("airplay start", lg.String("line", s.line.LineName), lg.String("from", sess.conn.RemoteAddr().String()))
+}
+
+// 断开线路并释放端口，调用者持有 sess.locker
+func (s *raopServer) teardown(sess *raopSession) {
+	if sess.rtp != nil {
+		sess.rtp.Close()
+		sess.rtp = nil
+	}
+	if sess.streamer != nil {
+		sess.streamer.Close()
+		if sess.applied {
+			s.line.RemoveInput(sess.streamer)
+			s.log.Info("airplay stop", lg.String("line", s.line.LineName))
+		}
+		sess.streamer = nil
+		sess.applied = false
+	}
+	var fs stream.FileStreamer
+	s.locker.Lock()
+	if s.session == sess {
+		s.session = nil
+		fs, s.paused = s.paused, nil
+	}
+	s.locker.Unlock()
+
+	// 恢复接入时暂停的文件，期间线路切换了文件则不恢复
+	if fs != nil && fs == s.line.Input.FileStreamer() && fs.IsPaused() {
+		fs.SetPause(false)
+	}
+}
+
+func (s *raopServer) setParameter(sess *raopSession, req *rtspRequest) int {
+	ct := req.header.Get("Content-Type")
+	switch {
+	case ct == "text/parameters":
+		for _, l := range strings.Split(string(req.body), "\n") {
+			k, v, ok := strings.Cut(strings.TrimSpace(l), ":")
+			if !ok || k != "volume" {
+				continue
+			}
+			db, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil {
+				return 400
+			}
+			vol, mute := lineVolume(db)
+			if mute {
+				vol = s.line.Volume
+			}
+			s.line.SetVolume(vol, mute)
+		}
+	case ct == "application/x-dmap-tagged":
+		tags := parseDMAP(req.body)
+		sess.title, sess.artist = string(tags["minm"]), string(tags["asar"])
+		if sess.applied {
+			stream.BusSourceMetadata.Dispatch(sess.streamer, sess.title, sess.artist)
+		}
+	case strings.HasPrefix(ct, "image/"):
+		if len(req.body) == 0 || ct == "image/none" {
+			s.line.SetCover(nil)
+			break
+		}
+		img, _, err := image.Decode(bytes.NewReader(req.body))
+		if err != nil {
+			s.log.Warn("invalid cover", lg.String("type", ct), lg.Error(err))
+			return 415
+		}
+		s.line.SetCover(img)
+	}
+	return 200
+}
+
+// 线路音量 0 至 100 对应 -30 至 0 dB
+func lineVolume(db float64) (vol uint8, mute bool) {
+	if db <= volumeMute {
+		return 0, true
+	}
+	db = math.Max(volumeMin, math.Min(0, db))
+	return uint8(math.Round((db - volumeMin) / -volumeMin * 100)), false
+}
+
+func airplayVolume(vol uint8, mute bool) float64 {
+	if mute {
+		return volumeMute
+	}
+	return volumeMin + float64(vol)/100*-volumeMin
+}
+
+// RTP-Info: seq=12345;rtptime=67890
+func rtpInfoSeq(info string) (uint16, bool) {
+	for _, kv := range strings.Split(info, ";") {
+		k, v, _ := strings.Cut(strings.TrimSpace(kv), "=")
+		if k != "seq" {
+			continue
+		}
+		seq, err := strconv.ParseUint(v, 10, 16)
+		return uint16(seq), err == nil
+	}
+	return 0, false
+}
+
+// 解析 DMAP 元数据，mlit 为容器
+func parseDMAP(p []byte) map[string][]byte {
+	tags := map[string][]byte{}
+	var parse func(p []byte)
+	parse = func(p []byte) {
+		for len(p) >= 8 {
+			tag := string(p[:4])
+			n := int(binary.BigEndian.Uint32(p[4:8]))
+			if n > len(p)-8 {
+				return
+			}
+			if tag == "mlit" {
+				parse(p[8 : 8+n])
+			} else {
+				tags[tag] = p[8 : 8+n]
+			}
+			p = p[8+n:]
+		}
+	}
+	parse(p)
+	return tags
+}
+
+// Close 停止接受连接并断开所有发送端，等待连接的清理结束
+func (s *raopServer) Close() {
+	s.locker.Lock()
+	if s.closed {
+		s.locker.Unlock()
+		return
+	}
+	s.closed = true
+	s.ln.Close()
+	for sess := range s.sessions {
+		sess.conn.Close()
+	}
+	s.locker.Unlock()
+
+	s.wg.ExitAndWait()
+}
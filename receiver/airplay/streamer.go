@@ -0,0 +1,241 @@
+package airplay
+
+import (
+	"sync"
+
+	"github.com/zwcway/castserver-go/common/audio"
+	"github.com/zwcway/castserver-go/common/stream"
+)
+
+// 最多缓存的帧数，超出时丢弃最早的帧
+const maxBufferFrames = 1024
+
+type frameDecoder interface {
+	Decode(p []byte) ([]int16, error) // 返回交错的样本
+	Channels() int
+}
+
+// L16 大端 PCM
+type pcmDecoder struct {
+	channels int
+}
+
+func (d *pcmDecoder) Channels() int {
+	return d.channels
+}
+
+func (d *pcmDecoder) Decode(p []byte) ([]int16, error) {
+	if len(p)%(2*d.channels) != 0 {
+		return nil, errALACInvalid
+	}
+	out := make([]int16, len(p)/2)
+	for i := range out {
+		out[i] = int16(uint16(p[2*i])<<8 | uint16(p[2*i+1]))
+	}
+	return out, nil
+}
+
+// raopStreamer 按序号缓存收到的音频帧，缓冲足够后由混音器读取
+type raopStreamer struct {
+	locker sync.Mutex
+
+	decoder      frameDecoder
+	format       audio.Format
+	outFormat    audio.Format
+	channelIndex audio.ChannelIndex
+	bufferFrames int // 开始播放前需要缓冲的帧数
+	frameLength  int
+
+	frames  map[uint16][]int16
+	next    uint16 // 下一个要播放的序号
+	highest uint16 // 收到的最大序号
+	synced  bool   // 已经收到第一个包
+	started bool
+	closed  bool
+
+	cur     []int16
+	curPos  int     // cur 中已经读取的每声道样本数
+	silence []int16 // 代替丢失的帧，只读
+}
+
+func newRaopStreamer(dec frameDecoder, rate int, frameLength int, bufferSamples int) *raopStreamer {
+	layout := audio.Layout20
+	if dec.Channels() == 1 {
+		layout = audio.Layout10
+	}
+	s := &raopStreamer{
+		decoder: dec,
+		format: audio.Format{
+			Sample: audio.Sample{
+				Rate: audio.NewAudioRate(rate),
+				Bits: audio.Bits_S16LE,
+			},
+			Layout: layout,
+		},
+		frameLength:  frameLength,
+		bufferFrames: (bufferSamples + frameLength - 1) / frameLength,
+		frames:       map[uint16][]int16{},
+		silence:      make([]int16, frameLength*dec.Channels()),
+	}
+	s.outFormat = audio.InternalFormat()
+	s.outFormat.Rate = s.format.Rate
+	s.outFormat.Layout = layout
+	s.channelIndex = layout.ChannelIndex()
+	return s
+}
+
+// 序号 a 是否在 b 之前，处理回绕
+func seqBefore(a, b uint16) bool {
+	return int16(a-b) < 0
+}
+
+// push 收到一个音频包，返回需要重传的序号范围
+// 音频和重传分别在不同的协程中收到，解码器必须持有锁
+func (s *raopStreamer) push(seq uint16, payload []byte) (first uint16, count uint16) {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	if s.closed {
+		return
+	}
+	pcm, err := s.decoder.Decode(payload)
+	if err != nil {
+		return
+	}
+	if !s.synced {
+		s.synced = true
+		s.next = seq
+		s.highest = seq
+	} else if seqBefore(seq, s.next) {
+		// 已经播放过或者 FLUSH 前的包
+		return
+	} else if seqBefore(s.highest, seq) {
+		if gap := seq - s.highest - 1; gap > 0 && gap < maxBufferFrames {
+			first, count = s.highest+1, gap
+		}
+		s.highest = seq
+	}
+	s.frames[seq] = pcm
+
+	for len(s.frames) > maxBufferFrames {
+		delete(s.frames, s.next)
+		s.next++
+	}
+	if !s.started && len(s.frames) >= s.bufferFrames {
+		s.started = true
+	}
+	return
+}
+
+// flush 丢弃 seq 之前的所有数据，重新缓冲
+func (s *raopStreamer) flush(seq uint16, hasSeq bool) {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	s.frames = map[uint16][]int16{}
+	s.cur = nil
+	s.curPos = 0
+	s.started = false
+	s.synced = hasSeq
+	s.next = seq
+	s.highest = seq - 1
+}
+
+func (s *raopStreamer) Stream(samples *stream.Samples) {
+	samples.SetFormatAndIndex(s.outFormat, s.channelIndex)
+
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	if !s.started || s.closed {
+		samples.LastNbSamples = 0
+		return
+	}
+
+	var (
+		chs = s.decoder.Channels()
+		n   = 0
+	)
+	for n < samples.RequestNbSamples {
+		if s.curPos >= len(s.cur)/chs {
+			if len(s.frames) == 0 {
+				// 缓冲耗尽，重新缓冲
+				s.started = false
+				break
+			}
+			pcm, ok := s.frames[s.next]
+			if !ok {
+				// 丢包，以静音代替
+				pcm = s.silence
+			}
+			delete(s.frames, s.next)
+			s.next++
+			s.cur, s.curPos = pcm, 0
+		}
+		c := len(s.cur)/chs - s.curPos
+		if c > samples.RequestNbSamples-n {
+			c = samples.RequestNbSamples - n
+		}
+		for ch := 0; ch < chs; ch++ {
+			if samples.IsFloat32() {
+				dst := samples.Data32[ch][n : n+c]
+				for i := range dst {
+					dst[i] = float32(s.cur[(s.curPos+i)*chs+ch]) / 32768
+				}
+			} else {
+				dst := samples.Data[ch][n : n+c]
+				for i := range dst {
+					dst[i] = float64(s.cur[(s.curPos+i)*chs+ch]) / 32768
+				}
+			}
+		}
+		s.curPos += c
+		n += c
+	}
+	samples.LastNbSamples = n
+}
+
+func (s *raopStreamer) Close() error {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	s.closed = true
+	s.frames = map[uint16][]int16{}
+	s.cur = nil
+	return nil
+}
+
+func (s *raopStreamer) AudioFormat() audio.Format {
+	return s.format
+}
+
+func (s *raopStreamer) ChannelIndex() audio.ChannelIndex {
+	return s.channelIndex
+}
+
+// 只转换位宽，采样率由混音器的重采样处理
+func (s *raopStreamer) SetOutFormat(f audio.Format) error {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	s.outFormat.Bits = audio.InternalBits()
+	return nil
+}
+
+func (s *raopStreamer) IsPlaying() bool {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	return s.started && !s.closed
+}
+
+func (s *raopStreamer) CanRemove() bool {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	return s.closed
+}
+
+func (s *raopStreamer) SourceType() stream.SourceType {
+	return stream.ST_AirPlay
+}
@@ -1,8 +1,11 @@
 package receiver
 
 import (
+	"os"
+
 	"github.com/zwcway/castserver-go/common/config"
 	"github.com/zwcway/castserver-go/common/speaker"
+	"github.com/zwcway/castserver-go/common/utils"
 	"github.com/zwcway/castserver-go/receiver/dlna"
 )
 
@@ -23,6 +26,26 @@ func initDlna() error {
 	speaker.BusLineCreated.Register(AddDLNA)
 	speaker.BusLineDeleted.Register(DelDLNA)
 
+	return initMediaServer()
+}
+
+// 媒体服务器只有一个设备，UUID 由主机名生成，重启后不变
+func initMediaServer() error {
+	var err error
+
+	if !config.DLNAMediaServer {
+		return nil
+	}
+
+	mediaInstance, err = dlna.NewMediaServer(ctx)
+	if err != nil {
+		return err
+	}
+	go mediaInstance.ListenAndServe()
+
+	host, _ := os.Hostname()
+	mediaInstance.AddNewInstance(config.APPNAME+" Library", utils.MakeUUID(config.APPNAME+host+"media server"))
+
 	return nil
 }
 
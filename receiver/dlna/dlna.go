@@ -2,14 +2,13 @@ package dlna
 
 import (
 	"strings"
+	"time"
 
 	"github.com/zwcway/castserver-go/common/config"
 	"github.com/zwcway/castserver-go/common/log"
 	"github.com/zwcway/castserver-go/common/utils"
 	"github.com/zwcway/castserver-go/receiver/dlna/service"
-	upnp "github.com/zwcway/fasthttp-upnp"
-	upnps "github.com/zwcway/fasthttp-upnp/service"
-	"github.com/zwcway/fasthttp-upnp/ssdp"
+	"github.com/zwcway/castserver-go/receiver/dlna/upnp"
 )
 
 type DLNAServer struct {
@@ -31,7 +30,7 @@ func (s *DLNAServer) ListenAndServe() {
 func (s *DLNAServer) onError(err error) {
 	if upnp.IsIPDenyError(err) {
 		s.log.Warn("ip denied", log.Error(err))
-	} else if ssdp.IsRequestError(err) {
+	} else if upnp.IsRequestError(err) {
 	} else {
 		s.log.Warn("error", log.Error(err))
 	}
@@ -56,14 +55,14 @@ func (s *DLNAServer) AddNewInstance(name string, uuid string) string {
 	if s == nil || s.upnp == nil {
 		return ""
 	}
-	return s.upnp.AddServer(name, uuid, "")
+	return s.upnp.AddServer(name, uuid)
 }
 
 func (s *DLNAServer) ChangeName(uuid string, newName string) {
 	if s == nil || s.upnp == nil {
 		return
 	}
-	s.upnp.AddServer(newName, uuid, "")
+	s.upnp.AddServer(newName, uuid)
 }
 
 func (s *DLNAServer) DelInstance(uuid string) {
@@ -73,20 +72,21 @@ func (s *DLNAServer) DelInstance(uuid string) {
 	s.upnp.DelServer(uuid)
 }
 
-func (s *DLNAServer) newUPnPServer(ctx utils.Context) (err error) {
+func (s *DLNAServer) newUPnPServer(ctx utils.Context, dt upnp.DeviceType, list []*upnp.Controller, listen config.Interface) (err error) {
 	s.upnp, err = upnp.NewDeviceServer(ctx)
 	if err != nil {
 		return
 	}
-	s.upnp.DeviceType = upnps.DeviceType_MediaRenderer
+	s.upnp.DeviceType = dt
 	s.upnp.Manufacturer = config.APPNAME
 	s.upnp.ServerName = config.NameVersion()
 	s.upnp.RootDescNamespaces = map[string]string{
 		"xmlns:dlna": "urn:schemas-dlna-org:device-1-0",
 	}
-	s.upnp.ServiceList = service.NewServiceList(ctx)
-	s.upnp.ListenInterface = config.DLNAListen.Iface
-	s.upnp.ListenPort = config.DLNAListen.AddrPort.Port()
+	s.upnp.ServiceList = list
+	s.upnp.ListenInterface = listen.Iface
+	s.upnp.ListenPort = listen.AddrPort.Port()
+	s.upnp.NotifyInterval = time.Duration(config.DLNANotifyInterval) * time.Second
 	s.upnp.DenyIps = config.DLNADenyIps
 	s.upnp.AllowIps = config.DLNAAllowIps
 	s.upnp.ErrorHandler = s.onError
@@ -114,7 +114,25 @@ func NewDLNAServer(ctx utils.Context) (s *DLNAServer, err error) {
 	s.log = ctx.Logger("dlna")
 	s.c = make(chan int, 1)
 
-	err = s.newUPnPServer(ctx)
+	err = s.newUPnPServer(ctx, upnp.DeviceType_MediaRenderer, service.NewServiceList(ctx), config.DLNAListen)
+	if err != nil {
+		return
+	}
+	service.SetNotifier(s.upnp.Notify)
+
+	err = s.upnp.Init()
+
+	return
+}
+
+// NewMediaServer 媒体服务器，控制端通过它浏览音乐库
+func NewMediaServer(ctx utils.Context) (s *DLNAServer, err error) {
+	s = &DLNAServer{}
+	s.ctx = ctx
+	s.log = ctx.Logger("dlna server")
+	s.c = make(chan int, 1)
+
+	err = s.newUPnPServer(ctx, upnp.DeviceType_MediaServer, service.NewMediaServiceList(ctx), config.DLNAServerListen)
 	if err != nil {
 		return
 	}
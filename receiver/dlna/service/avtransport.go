@@ -3,32 +3,103 @@ package service
 import (
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/valyala/fasthttp"
+	"github.com/zwcway/castserver-go/common/config"
 	lg "github.com/zwcway/castserver-go/common/log"
+	"github.com/zwcway/castserver-go/common/speaker"
 	"github.com/zwcway/castserver-go/common/utils"
 	"github.com/zwcway/castserver-go/decoder"
 	"github.com/zwcway/castserver-go/decoder/localspeaker"
-	"github.com/zwcway/fasthttp-upnp/avtransport1"
-	"github.com/zwcway/fasthttp-upnp/soap"
+	"github.com/zwcway/castserver-go/receiver/dlna/upnp"
+	"github.com/zwcway/castserver-go/receiver/dlna/upnp/avtransport1"
 )
 
-var playUri string
-var metaData string
+// 线路和对应的渲染器
+func lineRenderer(uuid string) (*speaker.Line, *renderer, error) {
+	line := speaker.FindLineByUUID(uuid)
+	if line == nil {
+		return nil, nil, &upnp.Error{Code: 500, Desc: "line not found"}
+	}
+	return line, findRenderer(uuid), nil
+}
+
+// 订阅后的第一个事件，包含渲染器的所有状态
+func avtEvents(uuid string) map[string]string {
+	vars := map[string]lastChangeVar{}
+
+	_, r, err := lineRenderer(uuid)
+	if err != nil {
+		return map[string]string{"LastChange": lastChange(avtNS, vars)}
+	}
+	r.locker.Lock()
+	defer r.locker.Unlock()
+
+	r.sync()
+	total, _ := r.duration()
+	tracks := "1"
+	if r.uri == "" {
+		tracks = "0"
+	}
+	for n, v := range map[string]string{
+		"TransportState":             r.state,
+		"TransportStatus":            r.status,
+		"TransportPlaySpeed":         "1",
+		"CurrentPlayMode":            "NORMAL",
+		"PlaybackStorageMedium":      "NETWORK",
+		"NumberOfTracks":             tracks,
+		"CurrentTrack":               tracks,
+		"CurrentTrackDuration":       utils.FormatDuration(total),
+		"CurrentMediaDuration":       utils.FormatDuration(total),
+		"AVTransportURI":             r.uri,
+		"AVTransportURIMetaData":     r.meta,
+		"CurrentTrackURI":            r.uri,
+		"CurrentTrackMetaData":       r.meta,
+		"NextAVTransportURI":         r.nextUri,
+		"NextAVTransportURIMetaData": r.nextMeta,
+		"CurrentTransportActions":    r.actions(),
+	} {
+		vars[n] = lastChangeVar{val: v}
+	}
+	return map[string]string{"LastChange": lastChange(avtNS, vars)}
+}
 
 func setAVTransportURIHandler(input any, output any, ctx *fasthttp.RequestCtx, uuid string) error {
 	in := input.(*avtransport1.ArgInSetAVTransportURI)
 	// out := output.(*avtransport1.ArgOutSetAVTransportURI)
 
-	playUri = in.CurrentURI
-	metaData = in.CurrentURIMetaData
+	line, r, err := lineRenderer(uuid)
+	if err != nil {
+		return err
+	}
+	r.locker.Lock()
+	defer r.locker.Unlock()
 
-	audioFS := decoder.FileStreamer(uuid)
+	// 正在播放时继续播放新的文件
+	playing := r.state == transportPlaying
+	r.setState(transportTransitioning)
+	r.setUri(in.CurrentURI, in.CurrentURIMetaData)
+	r.setNextUri("", "")
 
-	var err error
-	if err = audioFS.OpenFile(playUri); err != nil {
+	audioFS, err := decoder.OpenFile(line, in.CurrentURI)
+	if err != nil {
 		log.Error("create decoder failed", lg.Error(err))
-		return &soap.Error{Code: 500, Desc: err.Error()}
+		r.setUri("", "")
+		r.setStatus("ERROR_OCCURRED")
+		r.setState(transportNoMedia)
+		return &upnp.Error{Code: 500, Desc: err.Error()}
+	}
+	r.fs = audioFS
+	r.setStatus("OK")
+	r.set("CurrentTrackDuration", utils.FormatDuration(audioFS.TotalDuration()))
+	if playing {
+		audioFS.SetPause(false)
+		r.fresh = false
+		r.setState(transportPlaying)
+	} else {
+		r.fresh = true
+		r.setState(transportStopped)
 	}
 
 	log.Info("set uri", lg.String("url", in.CurrentURI), lg.Any("format", audioFS.AudioFormat()))
@@ -36,20 +107,113 @@ func setAVTransportURIHandler(input any, output any, ctx *fasthttp.RequestCtx, u
 	return nil
 }
 
+// 下一个文件，播放时预先打开以便无缝衔接
+func avtSetNextAVTransportURI(input any, output any, ctx *fasthttp.RequestCtx, uuid string) error {
+	in := input.(*avtransport1.ArgInSetNextAVTransportURI)
+
+	line, r, err := lineRenderer(uuid)
+	if err != nil {
+		return err
+	}
+	r.locker.Lock()
+	defer r.locker.Unlock()
+
+	if in.NextURI != "" && (r.state == transportPlaying || r.state == transportPaused) {
+		if err = decoder.OpenNextFile(line, in.NextURI); err != nil {
+			log.Error("open next file failed", lg.String("url", in.NextURI), lg.Error(err))
+			return &upnp.Error{Code: 500, Desc: err.Error()}
+		}
+	}
+	r.setNextUri(in.NextURI, in.NextURIMetaData)
+
+	log.Info("set next uri", lg.String("url", in.NextURI))
+
+	return nil
+}
+
+func avtGetTransportInfo(input any, output any, ctx *fasthttp.RequestCtx, uuid string) error {
+	out := output.(*avtransport1.ArgOutGetTransportInfo)
+
+	_, r, err := lineRenderer(uuid)
+	if err != nil {
+		return err
+	}
+	r.locker.Lock()
+	defer r.locker.Unlock()
+
+	r.sync()
+	out.CurrentTransportState = r.state
+	out.CurrentTransportStatus = r.status
+	out.CurrentSpeed = "1"
+
+	return nil
+}
+
+func avtGetMediaInfo(input any, output any, ctx *fasthttp.RequestCtx, uuid string) error {
+	out := output.(*avtransport1.ArgOutGetMediaInfo)
+
+	_, r, err := lineRenderer(uuid)
+	if err != nil {
+		return err
+	}
+	r.locker.Lock()
+	defer r.locker.Unlock()
+
+	total, _ := r.duration()
+	if r.uri != "" {
+		out.NrTracks = 1
+	}
+	out.MediaDuration = utils.FormatDuration(total)
+	out.CurrentURI = r.uri
+	out.CurrentURIMetaData = r.meta
+	out.NextURI = r.nextUri
+	out.NextURIMetaData = r.nextMeta
+	out.PlayMedium = "NETWORK"
+	out.RecordMedium = "NOT_IMPLEMENTED"
+	out.WriteStatus = "NOT_IMPLEMENTED"
+
+	return nil
+}
+
 func avtGetPositionInfo(input any, output any, ctx *fasthttp.RequestCtx, uuid string) error {
 	out := output.(*avtransport1.ArgOutGetPositionInfo)
 
-	audioFS := decoder.FileStreamer(uuid)
+	_, r, err := lineRenderer(uuid)
+	if err != nil {
+		return err
+	}
+	r.locker.Lock()
+	defer r.locker.Unlock()
 
-	dur := utils.FormatDuration(audioFS.Duration())
-	out.TrackDuration = dur
-	out.TrackURI = audioFS.CurrentFile()
-	out.RelTime = dur
-	out.AbsTime = dur
-	out.Track = 0
-	out.TrackMetaData = metaData
-	out.AbsCount = int32(audioFS.Position())
-	out.RelCount = int32(audioFS.Position())
+	r.sync()
+	total, pos := r.duration()
+	if r.uri != "" {
+		out.Track = 1
+	}
+	out.TrackDuration = utils.FormatDuration(total)
+	out.TrackURI = r.uri
+	out.TrackMetaData = r.meta
+	out.RelTime = utils.FormatDuration(pos)
+	out.AbsTime = out.RelTime
+	// 不支持计数
+	out.RelCount = 2147483647
+	out.AbsCount = 2147483647
+
+	return nil
+}
+
+func avtGetCurrentTransportActions(input any, output any, ctx *fasthttp.RequestCtx, uuid string) error {
+	out := output.(*avtransport1.ArgOutGetCurrentTransportActions)
+
+	_, r, err := lineRenderer(uuid)
+	if err != nil {
+		return err
+	}
+	r.locker.Lock()
+	defer r.locker.Unlock()
+
+	r.sync()
+	out.Actions = r.actions()
 
 	return nil
 }
@@ -57,62 +221,166 @@ func avtGetPositionInfo(input any, output any, ctx *fasthttp.RequestCtx, uuid st
 func avtPlay(input any, output any, ctx *fasthttp.RequestCtx, uuid string) error {
 	// in := input.(*avtransport1.ArgInPlay)
 
-	if playUri == "" {
+	line, r, err := lineRenderer(uuid)
+	if err != nil {
+		return err
+	}
+	r.locker.Lock()
+	defer r.locker.Unlock()
+
+	r.sync()
+	switch r.state {
+	case transportNoMedia, transportTransitioning:
+		return &upnp.Error{Code: 701, Desc: "Transition not available"}
+	case transportPlaying:
 		return nil
 	}
-	audioFS := decoder.FileStreamer(uuid)
 
-	if audioFS.CurrentFile() == "" { // 重新播放
-		var err error
-		if err = audioFS.OpenFile(playUri); err != nil {
+	if r.state == transportStopped && (!r.fresh || r.fs == nil || r.fs.CurrentFile() != r.uri) {
+		// 停止后从头播放
+		r.setState(transportTransitioning)
+		if r.fs, err = decoder.OpenFile(line, r.uri); err != nil {
 			log.Error("create decoder failed", lg.Error(err))
-			return &soap.Error{Code: 500, Desc: err.Error()}
+			r.fs = nil
+			r.setStatus("ERROR_OCCURRED")
+			r.setState(transportStopped)
+			return &upnp.Error{Code: 500, Desc: err.Error()}
 		}
 		localspeaker.Init()
 	}
-	audioFS.SetPause(false)
+	r.fs.SetPause(false)
+	r.fresh = false
+	r.setStatus("OK")
+	r.setState(transportPlaying)
+
+	if r.nextUri != "" {
+		if err = decoder.OpenNextFile(line, r.nextUri); err != nil {
+			log.Error("open next file failed", lg.String("url", r.nextUri), lg.Error(err))
+		}
+	}
 
 	return nil
 }
 
 func avtPause(input any, output any, ctx *fasthttp.RequestCtx, uuid string) error {
-	if playUri == "" {
+	_, r, err := lineRenderer(uuid)
+	if err != nil {
+		return err
+	}
+	r.locker.Lock()
+	defer r.locker.Unlock()
+
+	r.sync()
+	switch r.state {
+	case transportPaused:
 		return nil
+	case transportPlaying:
+	default:
+		return &upnp.Error{Code: 701, Desc: "Transition not available"}
 	}
-	decoder.FileStreamer(uuid).SetPause(true)
+	r.fs.SetPause(true)
+	r.setState(transportPaused)
 
 	return nil
 }
 
 func avtStop(input any, output any, ctx *fasthttp.RequestCtx, uuid string) error {
-	if playUri == "" {
+	_, r, err := lineRenderer(uuid)
+	if err != nil {
+		return err
+	}
+	r.locker.Lock()
+	defer r.locker.Unlock()
+
+	r.sync()
+	switch r.state {
+	case transportNoMedia, transportStopped:
 		return nil
 	}
-	decoder.FileStreamer(uuid).Close()
+	if fs := r.fs; fs != nil && fs.CurrentFile() == r.uri {
+		// 淡出后停止，不阻塞请求
+		fs.SetPause(true)
+		time.AfterFunc(config.VolumeFadeDuration, func() {
+			r.locker.Lock()
+			defer r.locker.Unlock()
+			if r.state == transportStopped && r.fs == fs && fs.IsPaused() {
+				fs.Close()
+			}
+		})
+	}
+	r.fresh = false
+	r.setState(transportStopped)
 	return nil
 }
 
 func avtSeek(input any, output any, ctx *fasthttp.RequestCtx, uuid string) error {
 	in := input.(*avtransport1.ArgInSeek)
 
-	if playUri == "" {
-		return nil
+	_, r, err := lineRenderer(uuid)
+	if err != nil {
+		return err
+	}
+	r.locker.Lock()
+	defer r.locker.Unlock()
+
+	r.sync()
+	if r.state != transportPlaying && r.state != transportPaused {
+		return &upnp.Error{Code: 701, Desc: "Transition not available"}
 	}
 	switch in.Unit {
 	case "ABS_TIME", "REL_TIME":
 		d, err := utils.ParseDuration(in.Target)
 		if err != nil {
-			return &soap.Error{Code: fasthttp.StatusBadRequest, Desc: err.Error()}
+			return &upnp.Error{Code: fasthttp.StatusBadRequest, Desc: err.Error()}
 		}
-		err = decoder.FileStreamer(uuid).Seek(d)
+		err = r.fs.Seek(d)
 		if err != nil {
-			return &soap.Error{Code: fasthttp.StatusBadRequest, Desc: err.Error()}
+			return &upnp.Error{Code: fasthttp.StatusBadRequest, Desc: err.Error()}
 		}
+	default:
+		return &upnp.Error{Code: 710, Desc: "Seek mode not supported"}
 	}
 
 	return nil
 }
 
+// 立即播放下一个文件
+func avtNext(input any, output any, ctx *fasthttp.RequestCtx, uuid string) error {
+	line, r, err := lineRenderer(uuid)
+	if err != nil {
+		return err
+	}
+	r.locker.Lock()
+	defer r.locker.Unlock()
+
+	if r.nextUri == "" {
+		return &upnp.Error{Code: 711, Desc: "Illegal seek target"}
+	}
+	r.sync()
+	playing := r.state == transportPlaying
+	r.setState(transportTransitioning)
+	r.setUri(r.nextUri, r.nextMeta)
+	r.setNextUri("", "")
+
+	audioFS, err := decoder.OpenFile(line, r.uri)
+	if err != nil {
+		log.Error("create decoder failed", lg.Error(err))
+		r.setStatus("ERROR_OCCURRED")
+		r.setState(transportStopped)
+		return &upnp.Error{Code: 500, Desc: err.Error()}
+	}
+	r.fs = audioFS
+	r.set("CurrentTrackDuration", utils.FormatDuration(audioFS.TotalDuration()))
+	r.fresh = !playing
+	if playing {
+		audioFS.SetPause(false)
+		r.setState(transportPlaying)
+	} else {
+		r.setState(transportStopped)
+	}
+	return nil
+}
+
 func parseSpeed(sp string) float64 {
 	sl := strings.Split(sp, "/")
 	if len(sl) == 1 {
@@ -0,0 +1,102 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zwcway/castserver-go/common/bus"
+	"github.com/zwcway/castserver-go/common/speaker"
+	"github.com/zwcway/castserver-go/common/utils"
+	"github.com/zwcway/castserver-go/receiver/dlna/upnp"
+	"github.com/zwcway/castserver-go/receiver/dlna/upnp/avtransport1"
+)
+
+func upnpCode(err error) int {
+	if e, ok := err.(*upnp.Error); ok {
+		return e.Code
+	}
+	return 0
+}
+
+func TestAVTransport(t *testing.T) {
+	bus.Init(utils.NewEmptyContext())
+	log = utils.NewEmptyContext().Logger("dlna srv")
+
+	line := speaker.NewLine("dlna")
+	defer func() {
+		// 丢弃尚未发送的事件
+		r := findRenderer(line.UUID)
+		r.avt.flush()
+		r.rcs.flush()
+		deleteRenderer(line.UUID)
+	}()
+
+	// 没有打开文件
+	var info avtransport1.ArgOutGetTransportInfo
+	assert.NoError(t, avtGetTransportInfo(&avtransport1.ArgInGetTransportInfo{}, &info, nil, line.UUID))
+	assert.Equal(t, avtransport1.ArgOutGetTransportInfo{CurrentTransportState: transportNoMedia, CurrentTransportStatus: "OK", CurrentSpeed: "1"}, info)
+	assert.Equal(t, 701, upnpCode(avtPlay(&avtransport1.ArgInPlay{}, &avtransport1.ArgOutPlay{}, nil, line.UUID)))
+	assert.Equal(t, 701, upnpCode(avtPause(&avtransport1.ArgInPause{}, &avtransport1.ArgOutPause{}, nil, line.UUID)))
+	assert.Equal(t, 711, upnpCode(avtNext(&avtransport1.ArgInNext{}, &avtransport1.ArgOutNext{}, nil, line.UUID)))
+	assert.Equal(t, 500, upnpCode(avtGetTransportInfo(&avtransport1.ArgInGetTransportInfo{}, &info, nil, "unknown")))
+
+	ev := avtEvents(line.UUID)["LastChange"]
+	assert.Contains(t, ev, `<Event xmlns="urn:schemas-upnp-org:metadata-1-0/AVT/"><InstanceID val="0">`)
+	assert.Contains(t, ev, `<TransportState val="NO_MEDIA_PRESENT"/>`)
+	assert.Contains(t, ev, `<NumberOfTracks val="0"/>`)
+	assert.Contains(t, ev, `<PlaybackStorageMedium val="NETWORK"/>`)
+	assert.Contains(t, ev, `<CurrentTransportActions val=""/>`)
+	assert.Equal(t, `<Event xmlns="urn:schemas-upnp-org:metadata-1-0/AVT/"><InstanceID val="0"></InstanceID></Event>`, avtEvents("unknown")["LastChange"])
+
+	// 停止时只保存下一个文件
+	assert.NoError(t, avtSetNextAVTransportURI(&avtransport1.ArgInSetNextAVTransportURI{NextURI: "http://a/2.mp3", NextURIMetaData: "<m/>"}, &avtransport1.ArgOutSetNextAVTransportURI{}, nil, line.UUID))
+
+	r := findRenderer(line.UUID)
+	fs := &testFileStreamer{file: "http://a/1.mp3"}
+	r.locker.Lock()
+	r.setUri("http://a/1.mp3", "")
+	r.fs = fs
+	r.setState(transportPlaying)
+	r.locker.Unlock()
+
+	var media avtransport1.ArgOutGetMediaInfo
+	assert.NoError(t, avtGetMediaInfo(&avtransport1.ArgInGetMediaInfo{}, &media, nil, line.UUID))
+	assert.Equal(t, uint32(1), media.NrTracks)
+	assert.Equal(t, "00:01:00", media.MediaDuration)
+	assert.Equal(t, "http://a/1.mp3", media.CurrentURI)
+	assert.Equal(t, "http://a/2.mp3", media.NextURI)
+	assert.Equal(t, "<m/>", media.NextURIMetaData)
+	assert.Equal(t, "NETWORK", media.PlayMedium)
+
+	var pos avtransport1.ArgOutGetPositionInfo
+	assert.NoError(t, avtGetPositionInfo(&avtransport1.ArgInGetPositionInfo{}, &pos, nil, line.UUID))
+	assert.Equal(t, uint32(1), pos.Track)
+	assert.Equal(t, "00:01:00", pos.TrackDuration)
+	assert.Equal(t, "00:00:10", pos.RelTime)
+
+	var actions avtransport1.ArgOutGetCurrentTransportActions
+	assert.NoError(t, avtGetCurrentTransportActions(&avtransport1.ArgInGetCurrentTransportActions{}, &actions, nil, line.UUID))
+	assert.Equal(t, "Pause,Stop,Seek", actions.Actions)
+
+	// 暂停
+	assert.NoError(t, avtPause(&avtransport1.ArgInPause{}, &avtransport1.ArgOutPause{}, nil, line.UUID))
+	assert.True(t, fs.paused)
+	assert.NoError(t, avtGetCurrentTransportActions(&avtransport1.ArgInGetCurrentTransportActions{}, &actions, nil, line.UUID))
+	assert.Equal(t, "Play,Stop,Seek", actions.Actions)
+	assert.Equal(t, 710, upnpCode(avtSeek(&avtransport1.ArgInSeek{Unit: "TRACK_NR", Target: "1"}, &avtransport1.ArgOutSeek{}, nil, line.UUID)))
+
+	ev = avtEvents(line.UUID)["LastChange"]
+	assert.Contains(t, ev, `<TransportState val="PAUSED_PLAYBACK"/>`)
+	assert.Contains(t, ev, `<AVTransportURI val="http://a/1.mp3"/>`)
+	assert.Contains(t, ev, `<NextAVTransportURI val="http://a/2.mp3"/>`)
+	assert.Contains(t, ev, `<NextAVTransportURIMetaData val="&lt;m/&gt;"/>`)
+	assert.Contains(t, ev, `<CurrentTrackDuration val="00:01:00"/>`)
+	assert.Contains(t, ev, `<CurrentTransportActions val="Play,Stop,Seek"/>`)
+
+	// 继续播放，没有下一个文件时不需要解码器
+	assert.NoError(t, avtSetNextAVTransportURI(&avtransport1.ArgInSetNextAVTransportURI{}, &avtransport1.ArgOutSetNextAVTransportURI{}, nil, line.UUID))
+	assert.NoError(t, avtPlay(&avtransport1.ArgInPlay{Speed: "1"}, &avtransport1.ArgOutPlay{}, nil, line.UUID))
+	assert.False(t, fs.paused)
+	assert.NoError(t, avtGetTransportInfo(&avtransport1.ArgInGetTransportInfo{}, &info, nil, line.UUID))
+	assert.Equal(t, transportPlaying, info.CurrentTransportState)
+}
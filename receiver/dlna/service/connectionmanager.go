@@ -0,0 +1,44 @@
+package service
+
+import (
+	"strings"
+
+	"github.com/valyala/fasthttp"
+	"github.com/zwcway/castserver-go/common/library"
+	"github.com/zwcway/castserver-go/receiver/dlna/upnp"
+	"github.com/zwcway/castserver-go/receiver/dlna/upnp/connectionmanager1"
+)
+
+// 媒体服务器只提供文件，不接收
+func cmGetProtocolInfo(input any, output any, ctx *fasthttp.RequestCtx, uuid string) error {
+	out := output.(*connectionmanager1.ArgOutGetProtocolInfo)
+
+	list := library.MimeTypes()
+	for i, m := range list {
+		list[i] = "http-get:*:" + m + ":*"
+	}
+	out.Source = strings.Join(list, ",")
+	out.Sink = ""
+	return nil
+}
+
+func cmGetCurrentConnectionIDs(input any, output any, ctx *fasthttp.RequestCtx, uuid string) error {
+	out := output.(*connectionmanager1.ArgOutGetCurrentConnectionIDs)
+	out.ConnectionIDs = "0"
+	return nil
+}
+
+func cmGetCurrentConnectionInfo(input any, output any, ctx *fasthttp.RequestCtx, uuid string) error {
+	in := input.(*connectionmanager1.ArgInGetCurrentConnectionInfo)
+	out := output.(*connectionmanager1.ArgOutGetCurrentConnectionInfo)
+
+	if in.ConnectionID != 0 {
+		return &upnp.Error{Code: 706, Desc: "Invalid connection reference"}
+	}
+	out.RcsID = -1
+	out.AVTransportID = -1
+	out.PeerConnectionID = -1
+	out.Direction = "Output"
+	out.Status = "OK"
+	return nil
+}
@@ -0,0 +1,464 @@
+package service
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/valyala/fasthttp"
+	"github.com/zwcway/castserver-go/common/config"
+	"github.com/zwcway/castserver-go/common/library"
+	"github.com/zwcway/castserver-go/common/utils"
+	"github.com/zwcway/castserver-go/indexer"
+	"github.com/zwcway/castserver-go/receiver/dlna/upnp"
+	"github.com/zwcway/castserver-go/receiver/dlna/upnp/contentdirectory1"
+)
+
+// 对象的编号
+//
+//	0                     根目录
+//	artists               艺术家列表
+//	artist/<艺术家>         艺术家的专辑
+//	albums                专辑列表
+//	album/<艺术家>/<专辑>    专辑的曲目
+//	folders               音乐库的目录
+//	folder/<路径>           目录中的子目录和曲目
+//	track/<编号>            曲目
+const (
+	cdRoot    = "0"
+	cdArtists = "artists"
+	cdAlbums  = "albums"
+	cdFolders = "folders"
+)
+
+const (
+	classFolder = "object.container.storageFolder"
+	classArtist = "object.container.person.musicArtist"
+	classAlbum  = "object.container.album.musicAlbum"
+	classTrack  = "object.item.audioItem.musicTrack"
+)
+
+// 音乐库每次扫描出变化时增加
+var systemUpdateID atomic.Uint32
+
+type cdObject struct {
+	id     string
+	parent string
+	title  string
+	class  string
+	count  int // 容器中的对象数量
+
+	artist string // 艺术家或者专辑的艺术家
+	track  *library.Track
+	cover  library.TrackID
+}
+
+func escapeID(s string) string {
+	return url.PathEscape(s)
+}
+
+func onLibraryScanned(added, updated, removed int) error {
+	if added+updated+removed > 0 {
+		systemUpdateID.Add(1)
+	}
+	return nil
+}
+
+func rootObject() cdObject {
+	return cdObject{id: cdRoot, parent: "-1", title: config.APPNAME, class: classFolder, count: 3}
+}
+
+func rootChildren() []cdObject {
+	return []cdObject{
+		{id: cdArtists, parent: cdRoot, title: "Artists", class: classFolder, count: len(indexer.Artists())},
+		{id: cdAlbums, parent: cdRoot, title: "Albums", class: classFolder, count: len(indexer.Albums(nil))},
+		{id: cdFolders, parent: cdRoot, title: "Folders", class: classFolder, count: len(config.LibraryDirs)},
+	}
+}
+
+func artistObject(a indexer.Artist) cdObject {
+	return cdObject{id: "artist/" + escapeID(a.Name), parent: cdArtists, title: a.Name, class: classArtist, count: a.Albums}
+}
+
+func albumObject(a indexer.Album, parent string) cdObject {
+	return cdObject{
+		id:     "album/" + escapeID(a.Artist) + "/" + escapeID(a.Name),
+		parent: parent,
+		title:  a.Name,
+		class:  classAlbum,
+		count:  a.Tracks,
+		artist: a.Artist,
+		cover:  a.Cover,
+	}
+}
+
+func folderObject(dir string, parent string) cdObject {
+	dirs, list, _ := indexer.Folder(dir)
+	return cdObject{
+		id:     "folder/" + escapeID(dir),
+		parent: parent,
+		title:  filepath.Base(dir),
+		class:  classFolder,
+		count:  len(dirs) + len(list),
+	}
+}
+
+func trackObject(t library.Track, parent string) cdObject {
+	cover := library.TrackID(0)
+	if t.Cover != "" {
+		cover = t.ID
+	}
+	return cdObject{
+		id:     "track/" + strconv.FormatUint(uint64(t.ID), 10),
+		parent: parent,
+		title:  t.Name(),
+		class:  classTrack,
+		track:  &t,
+		cover:  cover,
+	}
+}
+
+func albumParent(t *library.Track) string {
+	return "album/" + escapeID(t.AlbumKey()) + "/" + escapeID(t.Album)
+}
+
+// 解析编号中的参数
+func splitID(id string, n int) ([]string, bool) {
+	parts := strings.SplitN(id, "/", n+1)
+	if len(parts) != n+1 {
+		return nil, false
+	}
+	for i := 1; i < len(parts); i++ {
+		v, err := url.PathUnescape(parts[i])
+		if err != nil {
+			return nil, false
+		}
+		parts[i] = v
+	}
+	return parts[1:], true
+}
+
+// 查找对象本身
+func cdMetadata(id string) (cdObject, bool) {
+	switch id {
+	case cdRoot:
+		return rootObject(), true
+	case cdArtists, cdAlbums, cdFolders:
+		for _, o := range rootChildren() {
+			if o.id == id {
+				return o, true
+			}
+		}
+	}
+
+	switch {
+	case strings.HasPrefix(id, "artist/"):
+		p, ok := splitID(id, 1)
+		if !ok {
+			break
+		}
+		for _, a := range indexer.Artists() {
+			if a.Name == p[0] {
+				return artistObject(a), true
+			}
+		}
+	case strings.HasPrefix(id, "album/"):
+		p, ok := splitID(id, 2)
+		if !ok {
+			break
+		}
+		for _, a := range indexer.Albums(&p[0]) {
+			if a.Name == p[1] {
+				return albumObject(a, "artist/"+escapeID(a.Artist)), true
+			}
+		}
+	case strings.HasPrefix(id, "folder/"):
+		p, ok := splitID(id, 1)
+		if !ok {
+			break
+		}
+		if _, _, err := indexer.Folder(p[0]); err != nil {
+			break
+		}
+		return folderObject(p[0], folderParent(p[0])), true
+	case strings.HasPrefix(id, "track/"):
+		tid, err := strconv.ParseUint(id[len("track/"):], 10, 32)
+		if err != nil {
+			break
+		}
+		if t := indexer.FindTrack(library.TrackID(tid)); t != nil {
+			return trackObject(*t, albumParent(t)), true
+		}
+	}
+	return cdObject{}, false
+}
+
+// 音乐库的目录属于 folders
+func folderParent(dir string) string {
+	for _, root := range config.LibraryDirs {
+		if root == dir {
+			return cdFolders
+		}
+	}
+	return "folder/" + escapeID(filepath.Dir(dir))
+}
+
+// 容器中的对象
+func cdChildren(id string) ([]cdObject, bool) {
+	list := []cdObject{}
+
+	switch id {
+	case cdRoot:
+		return rootChildren(), true
+	case cdArtists:
+		for _, a := range indexer.Artists() {
+			list = append(list, artistObject(a))
+		}
+		return list, true
+	case cdAlbums:
+		for _, a := range indexer.Albums(nil) {
+			list = append(list, albumObject(a, cdAlbums))
+		}
+		return list, true
+	case cdFolders:
+		dirs, _, _ := indexer.Folder("")
+		for _, d := range dirs {
+			list = append(list, folderObject(d, cdFolders))
+		}
+		return list, true
+	}
+
+	switch {
+	case strings.HasPrefix(id, "artist/"):
+		p, ok := splitID(id, 1)
+		if !ok {
+			break
+		}
+		for _, a := range indexer.Albums(&p[0]) {
+			list = append(list, albumObject(a, id))
+		}
+		return list, true
+	case strings.HasPrefix(id, "album/"):
+		p, ok := splitID(id, 2)
+		if !ok {
+			break
+		}
+		for _, t := range indexer.AlbumTracks(p[0], p[1]) {
+			list = append(list, trackObject(t, id))
+		}
+		return list, true
+	case strings.HasPrefix(id, "folder/"):
+		p, ok := splitID(id, 1)
+		if !ok {
+			break
+		}
+		dirs, tracks, err := indexer.Folder(p[0])
+		if err != nil {
+			break
+		}
+		for _, d := range dirs {
+			list = append(list, folderObject(d, id))
+		}
+		for _, t := range tracks {
+			list = append(list, trackObject(t, id))
+		}
+		return list, true
+	}
+	return nil, false
+}
+
+// 按照请求的范围截取
+func cdSlice(list []cdObject, start, count uint32) []cdObject {
+	if int(start) >= len(list) {
+		return nil
+	}
+	list = list[start:]
+	if count > 0 && int(count) < len(list) {
+		list = list[:count]
+	}
+	return list
+}
+
+func xmlEscape(b *strings.Builder, s string) {
+	for _, r := range s {
+		switch r {
+		case '&':
+			b.WriteString("&amp;")
+		case '<':
+			b.WriteString("&lt;")
+		case '>':
+			b.WriteString("&gt;")
+		case '"':
+			b.WriteString("&quot;")
+		case '\'':
+			b.WriteString("&apos;")
+		default:
+			b.WriteRune(r)
+		}
+	}
+}
+
+func didlElement(b *strings.Builder, name string, val string) {
+	if val == "" {
+		return
+	}
+	b.WriteString("<" + name + ">")
+	xmlEscape(b, val)
+	b.WriteString("</" + name + ">")
+}
+
+// DIDL-Lite 格式的对象列表，host 为 web 服务的地址
+func didl(list []cdObject, host string) string {
+	var b strings.Builder
+
+	b.WriteString(`<DIDL-Lite xmlns="urn:schemas-upnp-org:metadata-1-0/DIDL-Lite/" xmlns:dc="http://purl.org/dc/elements/1.1/" xmlns:upnp="urn:schemas-upnp-org:metadata-1-0/upnp/" xmlns:dlna="urn:schemas-dlna-org:metadata-1-0/">`)
+	for _, o := range list {
+		tag := "container"
+		if o.track != nil {
+			tag = "item"
+		}
+		b.WriteString("<" + tag + ` id="`)
+		xmlEscape(&b, o.id)
+		b.WriteString(`" parentID="`)
+		xmlEscape(&b, o.parent)
+		b.WriteString(`" restricted="1"`)
+		if o.track == nil {
+			fmt.Fprintf(&b, ` childCount="%d" searchable="1"`, o.count)
+		}
+		b.WriteString(">")
+
+		didlElement(&b, "dc:title", o.title)
+		didlElement(&b, "upnp:class", o.class)
+		if t := o.track; t != nil {
+			didlElement(&b, "dc:creator", t.Artist)
+			didlElement(&b, "upnp:artist", t.Artist)
+			didlElement(&b, "upnp:album", t.Album)
+			didlElement(&b, "upnp:albumArtist", t.AlbumArtist)
+			didlElement(&b, "upnp:genre", t.Genre)
+			if t.TrackNo > 0 {
+				didlElement(&b, "upnp:originalTrackNumber", strconv.Itoa(t.TrackNo))
+			}
+			if t.Year > 0 {
+				didlElement(&b, "dc:date", fmt.Sprintf("%04d-01-01", t.Year))
+			}
+		} else if o.artist != "" {
+			didlElement(&b, "dc:creator", o.artist)
+			didlElement(&b, "upnp:artist", o.artist)
+		}
+		if o.cover > 0 {
+			didlElement(&b, "upnp:albumArtURI", fmt.Sprintf("http://%s/cover?id=%d", host, o.cover))
+		}
+		if t := o.track; t != nil {
+			mime := library.MimeType(t.Path)
+			fmt.Fprintf(&b, `<res protocolInfo="http-get:*:%s:DLNA.ORG_OP=01;DLNA.ORG_CI=0" size="%d"`, mime, t.Size)
+			if t.Duration > 0 {
+				fmt.Fprintf(&b, ` duration="%s"`, utils.FormatDuration(t.Duration))
+			}
+			b.WriteString(">")
+			xmlEscape(&b, MediaUrl(host, t))
+			b.WriteString("</res>")
+		}
+		b.WriteString("</" + tag + ">")
+	}
+	b.WriteString("</DIDL-Lite>")
+
+	return b.String()
+}
+
+// MediaUrl 曲目在 web 服务中的地址，带有扩展名便于渲染器识别格式
+func MediaUrl(host string, t *library.Track) string {
+	return fmt.Sprintf("http://%s/media/%d%s", host, t.ID, strings.ToLower(filepath.Ext(t.Path)))
+}
+
+// web 服务的地址，监听所有地址时使用控制端连接的地址
+func mediaHost(ctx *fasthttp.RequestCtx) string {
+	addr := config.HTTPListen.AddrPort.Addr()
+	ip := addr.String()
+	if !addr.IsValid() || addr.IsUnspecified() {
+		ip = ctx.LocalIP().String()
+	}
+	return net.JoinHostPort(ip, strconv.Itoa(int(config.HTTPListen.AddrPort.Port())))
+}
+
+func cdBrowse(input any, output any, ctx *fasthttp.RequestCtx, uuid string) error {
+	in := input.(*contentdirectory1.ArgInBrowse)
+	out := output.(*contentdirectory1.ArgOutBrowse)
+
+	var list []cdObject
+	switch in.BrowseFlag {
+	case "BrowseMetadata":
+		o, ok := cdMetadata(in.ObjectID)
+		if !ok {
+			return &upnp.Error{Code: 701, Desc: "No such object"}
+		}
+		list = []cdObject{o}
+		out.TotalMatches = 1
+	case "BrowseDirectChildren":
+		all, ok := cdChildren(in.ObjectID)
+		if !ok {
+			return &upnp.Error{Code: 701, Desc: "No such object"}
+		}
+		list = cdSlice(all, in.StartingIndex, in.RequestedCount)
+		out.TotalMatches = uint32(len(all))
+	default:
+		return &upnp.Error{Code: 402, Desc: "Invalid Args"}
+	}
+
+	out.Result = didl(list, mediaHost(ctx))
+	out.NumberReturned = uint32(len(list))
+	out.UpdateID = systemUpdateID.Load()
+	return nil
+}
+
+var searchTermRegexp = regexp.MustCompile(`(?:dc:title|dc:creator|upnp:artist|upnp:album|upnp:genre)\s+contains\s+"((?:[^"\\]|\\.)*)"`)
+
+// 只支持按照关键字查找曲目
+func searchTerms(criteria string) string {
+	terms := []string{}
+	for _, m := range searchTermRegexp.FindAllStringSubmatch(criteria, -1) {
+		terms = append(terms, strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(m[1]))
+	}
+	return strings.Join(terms, " ")
+}
+
+func cdSearch(input any, output any, ctx *fasthttp.RequestCtx, uuid string) error {
+	in := input.(*contentdirectory1.ArgInSearch)
+	out := output.(*contentdirectory1.ArgOutSearch)
+
+	all := []cdObject{}
+	if !strings.Contains(in.SearchCriteria, "object.container") {
+		for _, t := range indexer.Search(searchTerms(in.SearchCriteria), 0) {
+			all = append(all, trackObject(t, albumParent(&t)))
+		}
+	}
+	list := cdSlice(all, in.StartingIndex, in.RequestedCount)
+
+	out.Result = didl(list, mediaHost(ctx))
+	out.NumberReturned = uint32(len(list))
+	out.TotalMatches = uint32(len(all))
+	out.UpdateID = systemUpdateID.Load()
+	return nil
+}
+
+func cdGetSearchCapabilities(input any, output any, ctx *fasthttp.RequestCtx, uuid string) error {
+	out := output.(*contentdirectory1.ArgOutGetSearchCapabilities)
+	out.SearchCaps = "dc:title,dc:creator,upnp:artist,upnp:album,upnp:genre"
+	return nil
+}
+
+func cdGetSortCapabilities(input any, output any, ctx *fasthttp.RequestCtx, uuid string) error {
+	out := output.(*contentdirectory1.ArgOutGetSortCapabilities)
+	out.SortCaps = ""
+	return nil
+}
+
+func cdGetSystemUpdateID(input any, output any, ctx *fasthttp.RequestCtx, uuid string) error {
+	out := output.(*contentdirectory1.ArgOutGetSystemUpdateID)
+	out.Id = systemUpdateID.Load()
+	return nil
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zwcway/castserver-go/common/library"
+)
+
+func TestContentDirectory(t *testing.T) {
+	t.Run("id", func(t *testing.T) {
+		tr := &library.Track{AlbumArtist: "A/B & C", Album: "100% Live"}
+		id := albumParent(tr)
+		assert.Equal(t, "album/A%2FB%20&%20C/100%25%20Live", id)
+
+		p, ok := splitID(id, 2)
+		assert.True(t, ok)
+		assert.Equal(t, []string{"A/B & C", "100% Live"}, p)
+
+		_, ok = splitID("album/only", 2)
+		assert.False(t, ok)
+		_, ok = splitID("artist/%zz", 1)
+		assert.False(t, ok)
+	})
+
+	t.Run("slice", func(t *testing.T) {
+		list := make([]cdObject, 5)
+		assert.Len(t, cdSlice(list, 0, 0), 5)
+		assert.Len(t, cdSlice(list, 3, 0), 2)
+		assert.Len(t, cdSlice(list, 1, 2), 2)
+		assert.Len(t, cdSlice(list, 5, 2), 0)
+	})
+
+	t.Run("search", func(t *testing.T) {
+		assert.Equal(t, "foo bar", searchTerms(`upnp:class derivedfrom "object.item.audioItem" and (dc:title contains "foo" or upnp:artist contains "bar")`))
+		assert.Equal(t, `say "hi"`, searchTerms(`dc:title contains "say \"hi\""`))
+		assert.Equal(t, "", searchTerms(`*`))
+	})
+
+	t.Run("didl", func(t *testing.T) {
+		tr := library.Track{
+			ID:       7,
+			Path:     "/music/a/01 <One>.FLAC",
+			Size:     1234,
+			Title:    "One & Only",
+			Artist:   "A",
+			Album:    "First",
+			TrackNo:  1,
+			Year:     2001,
+			Duration: 3*time.Minute + 500*time.Millisecond,
+			Cover:    "/music/a/cover.jpg",
+		}
+		list := []cdObject{
+			{id: "album/A/First", parent: "artist/A", title: "First", class: classAlbum, count: 1, artist: "A", cover: 7},
+			trackObject(tr, "album/A/First"),
+		}
+		s := didl(list, "192.168.1.2:4415")
+
+		var doc struct {
+			Containers []struct {
+				ID         string `xml:"id,attr"`
+				ChildCount int    `xml:"childCount,attr"`
+				Title      string `xml:"title"`
+				Art        string `xml:"albumArtURI"`
+			} `xml:"container"`
+			Items []struct {
+				ID     string `xml:"id,attr"`
+				Parent string `xml:"parentID,attr"`
+				Title  string `xml:"title"`
+				Class  string `xml:"class"`
+				Date   string `xml:"date"`
+				Res    struct {
+					Protocol string `xml:"protocolInfo,attr"`
+					Size     int64  `xml:"size,attr"`
+					Duration string `xml:"duration,attr"`
+					Url      string `xml:",chardata"`
+				} `xml:"res"`
+			} `xml:"item"`
+		}
+		assert.NoError(t, xml.NewDecoder(strings.NewReader(s)).Decode(&doc))
+		if assert.Len(t, doc.Containers, 1) {
+			assert.Equal(t, 1, doc.Containers[0].ChildCount)
+			assert.Equal(t, "http://192.168.1.2:4415/cover?id=7", doc.Containers[0].Art)
+		}
+		if assert.Len(t, doc.Items, 1) {
+			it := doc.Items[0]
+			assert.Equal(t, "track/7", it.ID)
+			assert.Equal(t, "album/A/First", it.Parent)
+			assert.Equal(t, "One & Only", it.Title)
+			assert.Equal(t, classTrack, it.Class)
+			assert.Equal(t, "2001-01-01", it.Date)
+			assert.Equal(t, "http-get:*:audio/flac:DLNA.ORG_OP=01;DLNA.ORG_CI=0", it.Res.Protocol)
+			assert.Equal(t, int64(1234), it.Res.Size)
+			assert.Equal(t, "00:03:00.5", it.Res.Duration)
+			assert.Equal(t, "http://192.168.1.2:4415/media/7.flac", it.Res.Url)
+		}
+	})
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LastChange 的最小间隔
+const lastChangeInterval = 200 * time.Millisecond
+
+// NotifyHandler 向订阅者发送服务的状态变量
+type NotifyHandler func(uuid string, serviceName string, vars map[string]string)
+
+var notifier NotifyHandler
+
+// SetNotifier 设置发送事件的方法
+func SetNotifier(n NotifyHandler) {
+	notifier = n
+}
+
+type lastChangeVar struct {
+	channel string // 音量等按照声道区分的变量
+	val     string
+}
+
+// 合并短时间内的修改，作为一个 LastChange 事件发送
+type lastChanger struct {
+	uuid    string
+	service string
+	ns      string
+
+	locker  sync.Mutex
+	changed map[string]lastChangeVar
+	pending bool
+}
+
+func newLastChanger(uuid string, service string, ns string) *lastChanger {
+	return &lastChanger{uuid: uuid, service: service, ns: ns}
+}
+
+func (c *lastChanger) set(name string, val string) {
+	c.setChannel(name, "", val)
+}
+
+func (c *lastChanger) setChannel(name string, channel string, val string) {
+	c.locker.Lock()
+	defer c.locker.Unlock()
+
+	if c.changed == nil {
+		c.changed = map[string]lastChangeVar{}
+	}
+	c.changed[name] = lastChangeVar{channel, val}
+	if c.pending {
+		return
+	}
+	c.pending = true
+	time.AfterFunc(lastChangeInterval, c.flush)
+}
+
+func (c *lastChanger) flush() {
+	c.locker.Lock()
+	vars := c.changed
+	c.changed = nil
+	c.pending = false
+	c.locker.Unlock()
+
+	if len(vars) == 0 || notifier == nil {
+		return
+	}
+	notifier(c.uuid, c.service, map[string]string{"LastChange": lastChange(c.ns, vars)})
+}
+
+// LastChange 事件的内容，变量按照名称排序
+func lastChange(ns string, vars map[string]lastChangeVar) string {
+	names := make([]string, 0, len(vars))
+	for n := range vars {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString(`<Event xmlns="` + ns + `"><InstanceID val="0">`)
+	for _, n := range names {
+		v := vars[n]
+		b.WriteString("<" + n)
+		if v.channel != "" {
+			b.WriteString(` channel="` + v.channel + `"`)
+		}
+		b.WriteString(` val="`)
+		xmlEscape(&b, v.val)
+		b.WriteString(`"/>`)
+	}
+	b.WriteString("</InstanceID></Event>")
+	return b.String()
+}
@@ -1,27 +1,89 @@
 package service
 
 import (
+	"github.com/zwcway/castserver-go/common/bus"
+	"github.com/zwcway/castserver-go/common/library"
 	lg "github.com/zwcway/castserver-go/common/log"
+	"github.com/zwcway/castserver-go/common/speaker"
 	"github.com/zwcway/castserver-go/common/utils"
-	"github.com/zwcway/fasthttp-upnp/avtransport1"
-	"github.com/zwcway/fasthttp-upnp/service"
+	"github.com/zwcway/castserver-go/receiver/dlna/upnp"
+	"github.com/zwcway/castserver-go/receiver/dlna/upnp/avtransport1"
+	"github.com/zwcway/castserver-go/receiver/dlna/upnp/connectionmanager1"
+	"github.com/zwcway/castserver-go/receiver/dlna/upnp/contentdirectory1"
+	"github.com/zwcway/castserver-go/receiver/dlna/upnp/renderingcontrol1"
 )
 
 var log lg.Logger
 
-func NewServiceList(ctx utils.Context) []*service.Controller {
+// NewServiceList 渲染器的服务
+func NewServiceList(ctx utils.Context) []*upnp.Controller {
 	log = ctx.Logger("dlna srv")
 
-	return []*service.Controller{
+	// 在其它协程中处理，操作可能在持有渲染器的锁时触发这些事件
+	speaker.BusLineInputChanged.Register(onLineInputChanged).ASync()
+	speaker.BusLineInputFinished.Register(onLineInputFinished).ASync()
+	speaker.BusLineDeleted.Register(onLineDeleted)
+	speaker.BusLineVolumeChanged.Register(onLineVolumeChanged)
+	bus.Register("line eq changed", onLineEqualizerChanged)
+	bus.Register("line eq power", onLineEqualizerChanged)
+
+	// 服务描述中列出所有预设
+	renderingcontrol1.Service.Variable("A_ARG_TYPE_PresetName").AllowedValues = presetNames()
+
+	return []*upnp.Controller{
 		{
-			ServiceName: avtransport1.NAME,
-			Actions: []*service.Action{
+			Service: avtransport1.Service,
+			Events:  avtEvents,
+			Actions: []*upnp.Action{
 				avtransport1.SetAVTransportURI(setAVTransportURIHandler),
+				avtransport1.SetNextAVTransportURI(avtSetNextAVTransportURI),
+				avtransport1.GetTransportInfo(avtGetTransportInfo),
+				avtransport1.GetMediaInfo(avtGetMediaInfo),
 				avtransport1.GetPositionInfo(avtGetPositionInfo),
+				avtransport1.GetCurrentTransportActions(avtGetCurrentTransportActions),
 				avtransport1.Play(avtPlay),
 				avtransport1.Pause(avtPause),
 				avtransport1.Stop(avtStop),
 				avtransport1.Seek(avtSeek),
+				avtransport1.Next(avtNext),
+			},
+		},
+		{
+			Service: renderingcontrol1.Service,
+			Events:  rcsEvents,
+			Actions: []*upnp.Action{
+				renderingcontrol1.GetVolume(rcsGetVolume),
+				renderingcontrol1.SetVolume(rcsSetVolume),
+				renderingcontrol1.GetMute(rcsGetMute),
+				renderingcontrol1.SetMute(rcsSetMute),
+				renderingcontrol1.ListPresets(rcsListPresets),
+				renderingcontrol1.SelectPreset(rcsSelectPreset),
+			},
+		},
+	}
+}
+
+// NewMediaServiceList 媒体服务器的服务
+func NewMediaServiceList(ctx utils.Context) []*upnp.Controller {
+	library.BusScanFinished.Register(onLibraryScanned)
+
+	return []*upnp.Controller{
+		{
+			Service: contentdirectory1.Service,
+			Actions: []*upnp.Action{
+				contentdirectory1.Browse(cdBrowse),
+				contentdirectory1.Search(cdSearch),
+				contentdirectory1.GetSearchCapabilities(cdGetSearchCapabilities),
+				contentdirectory1.GetSortCapabilities(cdGetSortCapabilities),
+				contentdirectory1.GetSystemUpdateID(cdGetSystemUpdateID),
+			},
+		},
+		{
+			Service: connectionmanager1.Service,
+			Actions: []*upnp.Action{
+				connectionmanager1.GetProtocolInfo(cmGetProtocolInfo),
+				connectionmanager1.GetCurrentConnectionIDs(cmGetCurrentConnectionIDs),
+				connectionmanager1.GetCurrentConnectionInfo(cmGetCurrentConnectionInfo),
 			},
 		},
 	}
@@ -0,0 +1,19 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zwcway/castserver-go/common/utils"
+	"github.com/zwcway/castserver-go/receiver/dlna/upnp/renderingcontrol1"
+)
+
+func TestServiceList(t *testing.T) {
+	ctx := utils.NewEmptyContext()
+
+	// 每个操作的参数都关联了服务中的状态变量
+	for _, c := range append(NewServiceList(ctx), NewMediaServiceList(ctx)...) {
+		assert.Nil(t, c.Validate(), c.Service.Name)
+	}
+	assert.Equal(t, presetNames(), renderingcontrol1.Service.Variable("A_ARG_TYPE_PresetName").AllowedValues)
+}
@@ -0,0 +1,203 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"github.com/zwcway/castserver-go/common/speaker"
+	"github.com/zwcway/castserver-go/common/stream"
+	"github.com/zwcway/castserver-go/common/utils"
+	"github.com/zwcway/castserver-go/receiver/dlna/upnp/avtransport1"
+	"github.com/zwcway/castserver-go/receiver/dlna/upnp/renderingcontrol1"
+)
+
+// 传输状态
+const (
+	transportStopped       = "STOPPED"
+	transportPlaying       = "PLAYING"
+	transportPaused        = "PAUSED_PLAYBACK"
+	transportTransitioning = "TRANSITIONING"
+	transportNoMedia       = "NO_MEDIA_PRESENT"
+)
+
+// LastChange 的命名空间
+const (
+	avtNS = "urn:schemas-upnp-org:metadata-1-0/AVT/"
+	rcsNS = "urn:schemas-upnp-org:metadata-1-0/RCS/"
+)
+
+var (
+	renderers       = map[string]*renderer{}
+	renderersLocker sync.Mutex
+)
+
+// 每个线路作为一个渲染器，保存自身的传输状态
+type renderer struct {
+	uuid   string
+	locker sync.Mutex
+
+	state    string
+	status   string
+	uri      string
+	meta     string
+	nextUri  string
+	nextMeta string
+	fresh    bool                // 刚打开，停在开头
+	fs       stream.FileStreamer // 当前文件的解码器
+
+	avt *lastChanger
+	rcs *lastChanger
+}
+
+func findRenderer(uuid string) *renderer {
+	renderersLocker.Lock()
+	defer renderersLocker.Unlock()
+
+	r, ok := renderers[uuid]
+	if !ok {
+		r = &renderer{
+			uuid:   uuid,
+			state:  transportNoMedia,
+			status: "OK",
+			avt:    newLastChanger(uuid, avtransport1.NAME, avtNS),
+			rcs:    newLastChanger(uuid, renderingcontrol1.NAME, rcsNS),
+		}
+		renderers[uuid] = r
+	}
+	return r
+}
+
+func deleteRenderer(uuid string) {
+	renderersLocker.Lock()
+	defer renderersLocker.Unlock()
+
+	delete(renderers, uuid)
+}
+
+func (r *renderer) set(name string, val string) {
+	r.avt.set(name, val)
+}
+
+func (r *renderer) setState(state string) {
+	if r.state == state {
+		return
+	}
+	r.state = state
+	r.set("TransportState", state)
+	r.set("CurrentTransportActions", r.actions())
+}
+
+func (r *renderer) setStatus(status string) {
+	if r.status == status {
+		return
+	}
+	r.status = status
+	r.set("TransportStatus", status)
+}
+
+func (r *renderer) setUri(uri string, meta string) {
+	r.uri, r.meta = uri, meta
+	tracks := "1"
+	if uri == "" {
+		tracks = "0"
+	}
+	r.set("AVTransportURI", uri)
+	r.set("AVTransportURIMetaData", meta)
+	r.set("CurrentTrackURI", uri)
+	r.set("CurrentTrackMetaData", meta)
+	r.set("NumberOfTracks", tracks)
+}
+
+func (r *renderer) setNextUri(uri string, meta string) {
+	r.nextUri, r.nextMeta = uri, meta
+	r.set("NextAVTransportURI", uri)
+	r.set("NextAVTransportURIMetaData", meta)
+}
+
+// 当前状态下可以执行的操作
+func (r *renderer) actions() string {
+	switch r.state {
+	case transportPlaying:
+		return "Pause,Stop,Seek"
+	case transportPaused:
+		return "Play,Stop,Seek"
+	case transportStopped:
+		return "Play,Seek"
+	}
+	return ""
+}
+
+// 与线路的实际状态同步，网页等其它途径也会控制线路
+func (r *renderer) sync() {
+	if r.state == transportNoMedia || r.state == transportStopped || r.state == transportTransitioning {
+		return
+	}
+	fs := r.fs
+	switch {
+	case fs == nil || fs.CurrentFile() != r.uri || fs.IsFinished():
+		r.setState(transportStopped)
+	case fs.IsPaused():
+		r.setState(transportPaused)
+	default:
+		r.setState(transportPlaying)
+	}
+}
+
+func (r *renderer) duration() (total time.Duration, pos time.Duration) {
+	fs := r.fs
+	if fs == nil || fs.CurrentFile() != r.uri || r.state == transportStopped {
+		return
+	}
+	return fs.TotalDuration(), fs.Duration()
+}
+
+// 线路切换了输入，可能是无缝播放下一个文件，也可能被其它途径占用
+func onLineInputChanged(line *speaker.Line, ss stream.SourceStreamer) error {
+	r := findRenderer(line.UUID)
+	r.locker.Lock()
+	defer r.locker.Unlock()
+
+	if r.state == transportNoMedia || r.state == transportTransitioning {
+		return nil
+	}
+	fs, ok := ss.(stream.FileStreamer)
+	if !ok {
+		r.setState(transportStopped)
+		return nil
+	}
+	switch fs.CurrentFile() {
+	case r.uri:
+		r.fs = fs
+	case r.nextUri:
+		r.setUri(r.nextUri, r.nextMeta)
+		r.setNextUri("", "")
+		r.set("CurrentTrackDuration", utils.FormatDuration(fs.TotalDuration()))
+		r.fs = fs
+		r.fresh = false
+		r.setState(transportPlaying)
+	default:
+		r.setState(transportStopped)
+	}
+	return nil
+}
+
+// 文件播放结束，有下一个文件时由混音器衔接
+func onLineInputFinished(line *speaker.Line, ss stream.SourceStreamer) error {
+	r := findRenderer(line.UUID)
+	r.locker.Lock()
+	defer r.locker.Unlock()
+
+	fs, ok := ss.(stream.FileStreamer)
+	if !ok || fs.CurrentFile() != r.uri || r.state != transportPlaying {
+		return nil
+	}
+	if r.nextUri == "" {
+		r.setState(transportStopped)
+	}
+	return nil
+}
+
+func onLineDeleted(line *speaker.Line, dst *speaker.Line) error {
+	deleteRenderer(line.UUID)
+	return nil
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zwcway/castserver-go/common/dsp"
+	"github.com/zwcway/castserver-go/common/element"
+	"github.com/zwcway/castserver-go/common/speaker"
+	"github.com/zwcway/castserver-go/common/stream"
+)
+
+type testFileStreamer struct {
+	stream.FileStreamer
+	file   string
+	paused bool
+}
+
+func (s *testFileStreamer) CurrentFile() string          { return s.file }
+func (s *testFileStreamer) Duration() time.Duration      { return 10 * time.Second }
+func (s *testFileStreamer) TotalDuration() time.Duration { return time.Minute }
+func (s *testFileStreamer) IsFinished() bool             { return false }
+func (s *testFileStreamer) IsPaused() bool               { return s.paused }
+func (s *testFileStreamer) SetPause(p bool)              { s.paused = p }
+
+func TestRenderer(t *testing.T) {
+	events := make(chan map[string]string, 4)
+	SetNotifier(func(uuid string, serviceName string, vars map[string]string) {
+		// 其它测试中的线路
+		if uuid != "test" {
+			return
+		}
+		vars["service"] = serviceName
+		events <- vars
+	})
+	defer SetNotifier(nil)
+
+	line := &speaker.Line{UUID: "test"}
+	defer deleteRenderer(line.UUID)
+
+	r := findRenderer(line.UUID)
+	assert.Equal(t, transportNoMedia, r.state)
+
+	r.locker.Lock()
+	r.setUri("http://a/1.mp3", `<DIDL-Lite a="1"/>`)
+	r.setNextUri("http://a/2.mp3", "")
+	r.fs = &testFileStreamer{file: "http://a/1.mp3"}
+	r.setState(transportPlaying)
+	r.locker.Unlock()
+
+	// 多次修改合并为一个事件
+	vars := <-events
+	assert.Equal(t, `<Event xmlns="urn:schemas-upnp-org:metadata-1-0/AVT/"><InstanceID val="0">`+
+		`<AVTransportURI val="http://a/1.mp3"/>`+
+		`<AVTransportURIMetaData val="&lt;DIDL-Lite a=&quot;1&quot;/&gt;"/>`+
+		`<CurrentTrackMetaData val="&lt;DIDL-Lite a=&quot;1&quot;/&gt;"/>`+
+		`<CurrentTrackURI val="http://a/1.mp3"/>`+
+		`<CurrentTransportActions val="Pause,Stop,Seek"/>`+
+		`<NextAVTransportURI val="http://a/2.mp3"/>`+
+		`<NextAVTransportURIMetaData val=""/>`+
+		`<NumberOfTracks val="1"/>`+
+		`<TransportState val="PLAYING"/>`+
+		`</InstanceID></Event>`, vars["LastChange"])
+
+	// 当前文件结束，混音器衔接下一个文件
+	assert.NoError(t, onLineInputFinished(line, r.fs))
+	assert.Equal(t, transportPlaying, r.state)
+	next := &testFileStreamer{file: "http://a/2.mp3"}
+	assert.NoError(t, onLineInputChanged(line, next))
+	assert.Equal(t, "http://a/2.mp3", r.uri)
+	assert.Equal(t, "", r.nextUri)
+	assert.Equal(t, stream.FileStreamer(next), r.fs)
+	vars = <-events
+	assert.Contains(t, vars["LastChange"], `<CurrentTrackDuration val="00:01:00"/>`)
+	assert.NotContains(t, vars["LastChange"], "TransportState")
+
+	// 没有下一个文件时停止
+	assert.NoError(t, onLineInputFinished(line, next))
+	assert.Equal(t, transportStopped, r.state)
+	<-events
+
+	// 线路被其它途径占用
+	r.locker.Lock()
+	r.setState(transportPlaying)
+	r.locker.Unlock()
+	assert.NoError(t, onLineInputChanged(line, &testFileStreamer{file: "/music/3.mp3"}))
+	assert.Equal(t, transportStopped, r.state)
+	vars = <-events
+	assert.Contains(t, vars["LastChange"], `<TransportState val="STOPPED"/>`)
+
+	// 音量的修改
+	line.Volume, line.Mute = 30, true
+	assert.NoError(t, onLineVolumeChanged(line, 0))
+	vars = <-events
+	assert.Equal(t, "RenderingControl", vars["service"])
+	assert.Equal(t, `<Event xmlns="urn:schemas-upnp-org:metadata-1-0/RCS/"><InstanceID val="0">`+
+		`<Mute channel="Master" val="1"/><Volume channel="Master" val="30"/>`+
+		`</InstanceID></Event>`, vars["LastChange"])
+
+	assert.Equal(t, []string{"FactoryDefaults", "Flat", "Bass", "Treble", "Vocal", "Loudness"}, presetNames())
+	if eq := dsp.EqualizerPreset("Bass"); assert.NotNil(t, eq) {
+		assert.Len(t, eq.Filters, 10)
+		assert.Equal(t, 6.0, eq.Filters[0].Gain)
+		assert.Equal(t, "Bass", dsp.EqualizerPresetOf(eq))
+		eq.Set(31, 5, 1.41)
+		assert.Equal(t, "", dsp.EqualizerPresetOf(eq))
+	}
+	assert.Nil(t, dsp.EqualizerPreset("Unknown"))
+
+	// 均衡器的修改
+	line.EQ.Eq = dsp.EqualizerPreset("Vocal")
+	line.Input.EqualizerEle = element.NewEqualizer(line.EQ.Eq)
+	assert.NoError(t, onLineEqualizerChanged(line))
+	vars = <-events
+	assert.Contains(t, vars["LastChange"], `<PresetName val="FactoryDefaults"/>`)
+	assert.Contains(t, vars["LastChange"], `<PresetNameList val="FactoryDefaults,Flat,Bass,Treble,Vocal,Loudness"/>`)
+	line.Input.EqualizerEle.On()
+	assert.NoError(t, onLineEqualizerChanged(line, true))
+	vars = <-events
+	assert.Contains(t, vars["LastChange"], `<PresetName val="Vocal"/>`)
+}
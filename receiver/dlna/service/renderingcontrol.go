@@ -0,0 +1,178 @@
+package service
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+	"github.com/zwcway/castserver-go/common/dsp"
+	"github.com/zwcway/castserver-go/common/speaker"
+	"github.com/zwcway/castserver-go/receiver/dlna/upnp"
+	"github.com/zwcway/castserver-go/receiver/dlna/upnp/renderingcontrol1"
+)
+
+// 恢复平直的均衡器并取消静音
+const presetFactoryDefaults = "FactoryDefaults"
+
+func presetNames() []string {
+	return append([]string{presetFactoryDefaults}, dsp.EqualizerPresetNames()...)
+}
+
+// 只有主声道
+func checkChannel(ch string) error {
+	if ch != "Master" {
+		return &upnp.Error{Code: 402, Desc: "Invalid Args"}
+	}
+	return nil
+}
+
+func boolVal(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+// 线路的均衡器对应的预设，均衡器关闭时为 FactoryDefaults，自定义时为空
+func currentPreset(line *speaker.Line) string {
+	if !line.Input.EqualizerEle.IsOn() {
+		return presetFactoryDefaults
+	}
+	return dsp.EqualizerPresetOf(line.Equalizer())
+}
+
+// 均衡器被修改或者开关时通知控制端当前的预设
+func onLineEqualizerChanged(o any, a ...any) error {
+	line := o.(*speaker.Line)
+	r := findRenderer(line.UUID)
+	r.rcs.set("PresetNameList", strings.Join(presetNames(), ","))
+	r.rcs.set("PresetName", currentPreset(line))
+	return nil
+}
+
+// 网页等其它途径修改音量时通知控制端
+func onLineVolumeChanged(line *speaker.Line, old float64) error {
+	r := findRenderer(line.UUID)
+	r.rcs.setChannel("Volume", "Master", strconv.Itoa(int(line.Volume)))
+	r.rcs.setChannel("Mute", "Master", boolVal(line.Mute))
+	return nil
+}
+
+// 订阅后的第一个事件，包含线路当前的音量和预设
+func rcsEvents(uuid string) map[string]string {
+	vars := map[string]lastChangeVar{}
+
+	if line, _, err := lineRenderer(uuid); err == nil {
+		vars["Volume"] = lastChangeVar{"Master", strconv.Itoa(int(line.Volume))}
+		vars["Mute"] = lastChangeVar{"Master", boolVal(line.Mute)}
+		vars["PresetNameList"] = lastChangeVar{val: strings.Join(presetNames(), ",")}
+		vars["PresetName"] = lastChangeVar{val: currentPreset(line)}
+	}
+	return map[string]string{"LastChange": lastChange(rcsNS, vars)}
+}
+
+func rcsGetVolume(input any, output any, ctx *fasthttp.RequestCtx, uuid string) error {
+	in := input.(*renderingcontrol1.ArgInGetVolume)
+	out := output.(*renderingcontrol1.ArgOutGetVolume)
+
+	if err := checkChannel(in.Channel); err != nil {
+		return err
+	}
+	line, _, err := lineRenderer(uuid)
+	if err != nil {
+		return err
+	}
+	out.CurrentVolume = uint16(line.Volume)
+	return nil
+}
+
+func rcsSetVolume(input any, output any, ctx *fasthttp.RequestCtx, uuid string) error {
+	in := input.(*renderingcontrol1.ArgInSetVolume)
+
+	if err := checkChannel(in.Channel); err != nil {
+		return err
+	}
+	if in.DesiredVolume > 100 {
+		return &upnp.Error{Code: 402, Desc: "Invalid Args"}
+	}
+	line, _, err := lineRenderer(uuid)
+	if err != nil {
+		return err
+	}
+	line.SetVolume(uint8(in.DesiredVolume), line.Mute)
+	return nil
+}
+
+func rcsGetMute(input any, output any, ctx *fasthttp.RequestCtx, uuid string) error {
+	in := input.(*renderingcontrol1.ArgInGetMute)
+	out := output.(*renderingcontrol1.ArgOutGetMute)
+
+	if err := checkChannel(in.Channel); err != nil {
+		return err
+	}
+	line, _, err := lineRenderer(uuid)
+	if err != nil {
+		return err
+	}
+	out.CurrentMute = line.Mute
+	return nil
+}
+
+func rcsSetMute(input any, output any, ctx *fasthttp.RequestCtx, uuid string) error {
+	in := input.(*renderingcontrol1.ArgInSetMute)
+
+	if err := checkChannel(in.Channel); err != nil {
+		return err
+	}
+	line, _, err := lineRenderer(uuid)
+	if err != nil {
+		return err
+	}
+	line.SetVolume(line.Volume, in.DesiredMute)
+	return nil
+}
+
+func rcsListPresets(input any, output any, ctx *fasthttp.RequestCtx, uuid string) error {
+	out := output.(*renderingcontrol1.ArgOutListPresets)
+
+	if _, _, err := lineRenderer(uuid); err != nil {
+		return err
+	}
+	out.CurrentPresetNameList = strings.Join(presetNames(), ",")
+	return nil
+}
+
+// 预设对应线路的均衡器
+func rcsSelectPreset(input any, output any, ctx *fasthttp.RequestCtx, uuid string) error {
+	in := input.(*renderingcontrol1.ArgInSelectPreset)
+
+	line, _, err := lineRenderer(uuid)
+	if err != nil {
+		return err
+	}
+
+	if in.PresetName == presetFactoryDefaults {
+		line.Input.EqualizerEle.Off()
+		line.SetEqualizer(dsp.NewPeakingFilterEqualizerProcessor(0))
+		line.Dispatch("line eq clean")
+		line.Dispatch("line eq power", false)
+		if line.Mute {
+			line.SetVolume(line.Volume, false)
+		}
+		return nil
+	}
+
+	eq := dsp.EqualizerPreset(in.PresetName)
+	if eq == nil {
+		return &upnp.Error{Code: 701, Desc: "Invalid Name"}
+	}
+	if err = line.SetEqualizer(eq); err != nil {
+		return &upnp.Error{Code: 501, Desc: err.Error()}
+	}
+	on := line.Input.EqualizerEle.IsOn()
+	line.Input.EqualizerEle.On()
+	if !on {
+		line.Dispatch("line eq power", true)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zwcway/castserver-go/common/bus"
+	"github.com/zwcway/castserver-go/common/speaker"
+	"github.com/zwcway/castserver-go/common/utils"
+	"github.com/zwcway/castserver-go/receiver/dlna/upnp/renderingcontrol1"
+)
+
+func TestRenderingControl(t *testing.T) {
+	bus.Init(utils.NewEmptyContext())
+
+	line := speaker.NewLine("dlna rcs")
+	defer func() {
+		r := findRenderer(line.UUID)
+		r.avt.flush()
+		r.rcs.flush()
+		deleteRenderer(line.UUID)
+	}()
+
+	// 音量
+	var vol renderingcontrol1.ArgOutGetVolume
+	assert.Equal(t, 402, upnpCode(rcsGetVolume(&renderingcontrol1.ArgInGetVolume{Channel: "LF"}, &vol, nil, line.UUID)))
+	assert.Equal(t, 402, upnpCode(rcsSetVolume(&renderingcontrol1.ArgInSetVolume{Channel: "Master", DesiredVolume: 101}, &renderingcontrol1.ArgOutSetVolume{}, nil, line.UUID)))
+	assert.Equal(t, 500, upnpCode(rcsGetVolume(&renderingcontrol1.ArgInGetVolume{Channel: "Master"}, &vol, nil, "unknown")))
+	assert.NoError(t, rcsSetVolume(&renderingcontrol1.ArgInSetVolume{Channel: "Master", DesiredVolume: 30}, &renderingcontrol1.ArgOutSetVolume{}, nil, line.UUID))
+	assert.NoError(t, rcsGetVolume(&renderingcontrol1.ArgInGetVolume{Channel: "Master"}, &vol, nil, line.UUID))
+	assert.Equal(t, uint16(30), vol.CurrentVolume)
+
+	var mute renderingcontrol1.ArgOutGetMute
+	assert.NoError(t, rcsSetMute(&renderingcontrol1.ArgInSetMute{Channel: "Master", DesiredMute: true}, &renderingcontrol1.ArgOutSetMute{}, nil, line.UUID))
+	assert.NoError(t, rcsGetMute(&renderingcontrol1.ArgInGetMute{Channel: "Master"}, &mute, nil, line.UUID))
+	assert.True(t, mute.CurrentMute)
+
+	// 预设
+	var presets renderingcontrol1.ArgOutListPresets
+	assert.NoError(t, rcsListPresets(&renderingcontrol1.ArgInListPresets{}, &presets, nil, line.UUID))
+	assert.Equal(t, "FactoryDefaults,Flat,Bass,Treble,Vocal,Loudness", presets.CurrentPresetNameList)
+
+	assert.Equal(t, 701, upnpCode(rcsSelectPreset(&renderingcontrol1.ArgInSelectPreset{PresetName: "Unknown"}, &renderingcontrol1.ArgOutSelectPreset{}, nil, line.UUID)))
+	assert.NoError(t, rcsSelectPreset(&renderingcontrol1.ArgInSelectPreset{PresetName: "Bass"}, &renderingcontrol1.ArgOutSelectPreset{}, nil, line.UUID))
+	assert.True(t, line.Input.EqualizerEle.IsOn())
+	assert.Equal(t, "Bass", currentPreset(line))
+
+	assert.Equal(t, `<Event xmlns="urn:schemas-upnp-org:metadata-1-0/RCS/"><InstanceID val="0">`+
+		`<Mute channel="Master" val="1"/>`+
+		`<PresetName val="Bass"/>`+
+		`<PresetNameList val="FactoryDefaults,Flat,Bass,Treble,Vocal,Loudness"/>`+
+		`<Volume channel="Master" val="30"/>`+
+		`</InstanceID></Event>`, rcsEvents(line.UUID)["LastChange"])
+	assert.Equal(t, `<Event xmlns="urn:schemas-upnp-org:metadata-1-0/RCS/"><InstanceID val="0"></InstanceID></Event>`, rcsEvents("unknown")["LastChange"])
+
+	// 恢复默认时关闭均衡器并取消静音
+	assert.NoError(t, rcsSelectPreset(&renderingcontrol1.ArgInSelectPreset{PresetName: "FactoryDefaults"}, &renderingcontrol1.ArgOutSelectPreset{}, nil, line.UUID))
+	assert.False(t, line.Input.EqualizerEle.IsOn())
+	assert.False(t, line.Mute)
+	assert.Contains(t, rcsEvents(line.UUID)["LastChange"], `<PresetName val="FactoryDefaults"/>`)
+}
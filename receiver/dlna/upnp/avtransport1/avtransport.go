@@ -0,0 +1,175 @@
+package avtransport1
+
+import (
+	"github.com/zwcway/castserver-go/receiver/dlna/upnp"
+)
+
+const NAME = "AVTransport"
+
+var Service = &upnp.Service{
+	Name:    NAME,
+	Version: 1,
+	Variables: []*upnp.StateVariable{
+		{Name: "TransportState", DataType: "string", AllowedValues: []string{"STOPPED", "PLAYING", "TRANSITIONING", "PAUSED_PLAYBACK", "NO_MEDIA_PRESENT"}},
+		{Name: "TransportStatus", DataType: "string", AllowedValues: []string{"OK", "ERROR_OCCURRED"}},
+		{Name: "PlaybackStorageMedium", DataType: "string", AllowedValues: []string{"NONE", "NETWORK"}},
+		{Name: "RecordStorageMedium", DataType: "string", AllowedValues: []string{"NOT_IMPLEMENTED"}},
+		{Name: "PossiblePlaybackStorageMedia", DataType: "string"},
+		{Name: "PossibleRecordStorageMedia", DataType: "string"},
+		{Name: "CurrentPlayMode", DataType: "string", AllowedValues: []string{"NORMAL"}},
+		{Name: "TransportPlaySpeed", DataType: "string", AllowedValues: []string{"1"}},
+		{Name: "RecordMediumWriteStatus", DataType: "string", AllowedValues: []string{"NOT_IMPLEMENTED"}},
+		{Name: "CurrentRecordQualityMode", DataType: "string", AllowedValues: []string{"NOT_IMPLEMENTED"}},
+		{Name: "PossibleRecordQualityModes", DataType: "string"},
+		{Name: "NumberOfTracks", DataType: "ui4", Range: &upnp.ValueRange{Min: 0, Max: 1}},
+		{Name: "CurrentTrack", DataType: "ui4", Range: &upnp.ValueRange{Min: 0, Max: 1, Step: 1}},
+		{Name: "CurrentTrackDuration", DataType: "string"},
+		{Name: "CurrentMediaDuration", DataType: "string"},
+		{Name: "CurrentTrackMetaData", DataType: "string"},
+		{Name: "CurrentTrackURI", DataType: "string"},
+		{Name: "AVTransportURI", DataType: "string"},
+		{Name: "AVTransportURIMetaData", DataType: "string"},
+		{Name: "NextAVTransportURI", DataType: "string"},
+		{Name: "NextAVTransportURIMetaData", DataType: "string"},
+		{Name: "RelativeTimePosition", DataType: "string"},
+		{Name: "AbsoluteTimePosition", DataType: "string"},
+		{Name: "RelativeCounterPosition", DataType: "i4"},
+		{Name: "AbsoluteCounterPosition", DataType: "i4"},
+		{Name: "CurrentTransportActions", DataType: "string"},
+		{Name: "LastChange", DataType: "string", SendEvents: true},
+		{Name: "A_ARG_TYPE_SeekMode", DataType: "string", AllowedValues: []string{"ABS_TIME", "REL_TIME"}},
+		{Name: "A_ARG_TYPE_SeekTarget", DataType: "string"},
+		{Name: "A_ARG_TYPE_InstanceID", DataType: "ui4"},
+	},
+}
+
+type ArgInSetAVTransportURI struct {
+	InstanceID         uint32 `upnp:"A_ARG_TYPE_InstanceID"`
+	CurrentURI         string `upnp:"AVTransportURI"`
+	CurrentURIMetaData string `upnp:"AVTransportURIMetaData"`
+}
+type ArgOutSetAVTransportURI struct{}
+
+func SetAVTransportURI(handler upnp.ActionHandler) *upnp.Action {
+	return upnp.NewAction("SetAVTransportURI", handler, ArgInSetAVTransportURI{}, ArgOutSetAVTransportURI{})
+}
+
+type ArgInSetNextAVTransportURI struct {
+	InstanceID      uint32 `upnp:"A_ARG_TYPE_InstanceID"`
+	NextURI         string `upnp:"NextAVTransportURI"`
+	NextURIMetaData string `upnp:"NextAVTransportURIMetaData"`
+}
+type ArgOutSetNextAVTransportURI struct{}
+
+func SetNextAVTransportURI(handler upnp.ActionHandler) *upnp.Action {
+	return upnp.NewAction("SetNextAVTransportURI", handler, ArgInSetNextAVTransportURI{}, ArgOutSetNextAVTransportURI{})
+}
+
+type ArgInGetMediaInfo struct {
+	InstanceID uint32 `upnp:"A_ARG_TYPE_InstanceID"`
+}
+type ArgOutGetMediaInfo struct {
+	NrTracks           uint32 `upnp:"NumberOfTracks"`
+	MediaDuration      string `upnp:"CurrentMediaDuration"`
+	CurrentURI         string `upnp:"AVTransportURI"`
+	CurrentURIMetaData string `upnp:"AVTransportURIMetaData"`
+	NextURI            string `upnp:"NextAVTransportURI"`
+	NextURIMetaData    string `upnp:"NextAVTransportURIMetaData"`
+	PlayMedium         string `upnp:"PlaybackStorageMedium"`
+	RecordMedium       string `upnp:"RecordStorageMedium"`
+	WriteStatus        string `upnp:"RecordMediumWriteStatus"`
+}
+
+func GetMediaInfo(handler upnp.ActionHandler) *upnp.Action {
+	return upnp.NewAction("GetMediaInfo", handler, ArgInGetMediaInfo{}, ArgOutGetMediaInfo{})
+}
+
+type ArgInGetTransportInfo struct {
+	InstanceID uint32 `upnp:"A_ARG_TYPE_InstanceID"`
+}
+type ArgOutGetTransportInfo struct {
+	CurrentTransportState  string `upnp:"TransportState"`
+	CurrentTransportStatus string `upnp:"TransportStatus"`
+	CurrentSpeed           string `upnp:"TransportPlaySpeed"`
+}
+
+func GetTransportInfo(handler upnp.ActionHandler) *upnp.Action {
+	return upnp.NewAction("GetTransportInfo", handler, ArgInGetTransportInfo{}, ArgOutGetTransportInfo{})
+}
+
+type ArgInGetPositionInfo struct {
+	InstanceID uint32 `upnp:"A_ARG_TYPE_InstanceID"`
+}
+type ArgOutGetPositionInfo struct {
+	Track         uint32 `upnp:"CurrentTrack"`
+	TrackDuration string `upnp:"CurrentTrackDuration"`
+	TrackMetaData string `upnp:"CurrentTrackMetaData"`
+	TrackURI      string `upnp:"CurrentTrackURI"`
+	RelTime       string `upnp:"RelativeTimePosition"`
+	AbsTime       string `upnp:"AbsoluteTimePosition"`
+	RelCount      int32  `upnp:"RelativeCounterPosition"`
+	AbsCount      int32  `upnp:"AbsoluteCounterPosition"`
+}
+
+func GetPositionInfo(handler upnp.ActionHandler) *upnp.Action {
+	return upnp.NewAction("GetPositionInfo", handler, ArgInGetPositionInfo{}, ArgOutGetPositionInfo{})
+}
+
+type ArgInGetCurrentTransportActions struct {
+	InstanceID uint32 `upnp:"A_ARG_TYPE_InstanceID"`
+}
+type ArgOutGetCurrentTransportActions struct {
+	Actions string `upnp:"CurrentTransportActions"`
+}
+
+func GetCurrentTransportActions(handler upnp.ActionHandler) *upnp.Action {
+	return upnp.NewAction("GetCurrentTransportActions", handler, ArgInGetCurrentTransportActions{}, ArgOutGetCurrentTransportActions{})
+}
+
+type ArgInPlay struct {
+	InstanceID uint32 `upnp:"A_ARG_TYPE_InstanceID"`
+	Speed      string `upnp:"TransportPlaySpeed"`
+}
+type ArgOutPlay struct{}
+
+func Play(handler upnp.ActionHandler) *upnp.Action {
+	return upnp.NewAction("Play", handler, ArgInPlay{}, ArgOutPlay{})
+}
+
+type ArgInPause struct {
+	InstanceID uint32 `upnp:"A_ARG_TYPE_InstanceID"`
+}
+type ArgOutPause struct{}
+
+func Pause(handler upnp.ActionHandler) *upnp.Action {
+	return upnp.NewAction("Pause", handler, ArgInPause{}, ArgOutPause{})
+}
+
+type ArgInStop struct {
+	InstanceID uint32 `upnp:"A_ARG_TYPE_InstanceID"`
+}
+type ArgOutStop struct{}
+
+func Stop(handler upnp.ActionHandler) *upnp.Action {
+	return upnp.NewAction("Stop", handler, ArgInStop{}, ArgOutStop{})
+}
+
+type ArgInSeek struct {
+	InstanceID uint32 `upnp:"A_ARG_TYPE_InstanceID"`
+	Unit       string `upnp:"A_ARG_TYPE_SeekMode"`
+	Target     string `upnp:"A_ARG_TYPE_SeekTarget"`
+}
+type ArgOutSeek struct{}
+
+func Seek(handler upnp.ActionHandler) *upnp.Action {
+	return upnp.NewAction("Seek", handler, ArgInSeek{}, ArgOutSeek{})
+}
+
+type ArgInNext struct {
+	InstanceID uint32 `upnp:"A_ARG_TYPE_InstanceID"`
+}
+type ArgOutNext struct{}
+
+func Next(handler upnp.ActionHandler) *upnp.Action {
+	return upnp.NewAction("Next", handler, ArgInNext{}, ArgOutNext{})
+}
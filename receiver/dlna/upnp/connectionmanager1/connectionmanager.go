@@ -0,0 +1,60 @@
+package connectionmanager1
+
+import (
+	"github.com/zwcway/castserver-go/receiver/dlna/upnp"
+)
+
+const NAME = "ConnectionManager"
+
+var Service = &upnp.Service{
+	Name:    NAME,
+	Version: 1,
+	Variables: []*upnp.StateVariable{
+		{Name: "SourceProtocolInfo", DataType: "string", SendEvents: true},
+		{Name: "SinkProtocolInfo", DataType: "string", SendEvents: true},
+		{Name: "CurrentConnectionIDs", DataType: "string", SendEvents: true},
+		{Name: "A_ARG_TYPE_ConnectionStatus", DataType: "string", AllowedValues: []string{"OK", "ContentFormatMismatch", "InsufficientBandwidth", "UnreliableChannel", "Unknown"}},
+		{Name: "A_ARG_TYPE_ConnectionManager", DataType: "string"},
+		{Name: "A_ARG_TYPE_Direction", DataType: "string", AllowedValues: []string{"Input", "Output"}},
+		{Name: "A_ARG_TYPE_ProtocolInfo", DataType: "string"},
+		{Name: "A_ARG_TYPE_ConnectionID", DataType: "i4"},
+		{Name: "A_ARG_TYPE_AVTransportID", DataType: "i4"},
+		{Name: "A_ARG_TYPE_RcsID", DataType: "i4"},
+	},
+}
+
+type ArgInGetProtocolInfo struct{}
+type ArgOutGetProtocolInfo struct {
+	Source string `upnp:"SourceProtocolInfo"`
+	Sink   string `upnp:"SinkProtocolInfo"`
+}
+
+func GetProtocolInfo(handler upnp.ActionHandler) *upnp.Action {
+	return upnp.NewAction("GetProtocolInfo", handler, ArgInGetProtocolInfo{}, ArgOutGetProtocolInfo{})
+}
+
+type ArgInGetCurrentConnectionIDs struct{}
+type ArgOutGetCurrentConnectionIDs struct {
+	ConnectionIDs string `upnp:"CurrentConnectionIDs"`
+}
+
+func GetCurrentConnectionIDs(handler upnp.ActionHandler) *upnp.Action {
+	return upnp.NewAction("GetCurrentConnectionIDs", handler, ArgInGetCurrentConnectionIDs{}, ArgOutGetCurrentConnectionIDs{})
+}
+
+type ArgInGetCurrentConnectionInfo struct {
+	ConnectionID int32 `upnp:"A_ARG_TYPE_ConnectionID"`
+}
+type ArgOutGetCurrentConnectionInfo struct {
+	RcsID                 int32  `upnp:"A_ARG_TYPE_RcsID"`
+	AVTransportID         int32  `upnp:"A_ARG_TYPE_AVTransportID"`
+	ProtocolInfo          string `upnp:"A_ARG_TYPE_ProtocolInfo"`
+	PeerConnectionManager string `upnp:"A_ARG_TYPE_ConnectionManager"`
+	PeerConnectionID      int32  `upnp:"A_ARG_TYPE_ConnectionID"`
+	Direction             string `upnp:"A_ARG_TYPE_Direction"`
+	Status                string `upnp:"A_ARG_TYPE_ConnectionStatus"`
+}
+
+func GetCurrentConnectionInfo(handler upnp.ActionHandler) *upnp.Action {
+	return upnp.NewAction("GetCurrentConnectionInfo", handler, ArgInGetCurrentConnectionInfo{}, ArgOutGetCurrentConnectionInfo{})
+}
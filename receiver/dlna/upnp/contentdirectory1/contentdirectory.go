@@ -0,0 +1,91 @@
+package contentdirectory1
+
+import (
+	"github.com/zwcway/castserver-go/receiver/dlna/upnp"
+)
+
+const NAME = "ContentDirectory"
+
+var Service = &upnp.Service{
+	Name:    NAME,
+	Version: 1,
+	Variables: []*upnp.StateVariable{
+		{Name: "SearchCapabilities", DataType: "string"},
+		{Name: "SortCapabilities", DataType: "string"},
+		{Name: "SystemUpdateID", DataType: "ui4", SendEvents: true},
+		{Name: "A_ARG_TYPE_ObjectID", DataType: "string"},
+		{Name: "A_ARG_TYPE_Result", DataType: "string"},
+		{Name: "A_ARG_TYPE_SearchCriteria", DataType: "string"},
+		{Name: "A_ARG_TYPE_BrowseFlag", DataType: "string", AllowedValues: []string{"BrowseMetadata", "BrowseDirectChildren"}},
+		{Name: "A_ARG_TYPE_Filter", DataType: "string"},
+		{Name: "A_ARG_TYPE_SortCriteria", DataType: "string"},
+		{Name: "A_ARG_TYPE_Index", DataType: "ui4"},
+		{Name: "A_ARG_TYPE_Count", DataType: "ui4"},
+		{Name: "A_ARG_TYPE_UpdateID", DataType: "ui4"},
+	},
+}
+
+type ArgInBrowse struct {
+	ObjectID       string `upnp:"A_ARG_TYPE_ObjectID"`
+	BrowseFlag     string `upnp:"A_ARG_TYPE_BrowseFlag"`
+	Filter         string `upnp:"A_ARG_TYPE_Filter"`
+	StartingIndex  uint32 `upnp:"A_ARG_TYPE_Index"`
+	RequestedCount uint32 `upnp:"A_ARG_TYPE_Count"`
+	SortCriteria   string `upnp:"A_ARG_TYPE_SortCriteria"`
+}
+type ArgOutBrowse struct {
+	Result         string `upnp:"A_ARG_TYPE_Result"`
+	NumberReturned uint32 `upnp:"A_ARG_TYPE_Count"`
+	TotalMatches   uint32 `upnp:"A_ARG_TYPE_Count"`
+	UpdateID       uint32 `upnp:"A_ARG_TYPE_UpdateID"`
+}
+
+func Browse(handler upnp.ActionHandler) *upnp.Action {
+	return upnp.NewAction("Browse", handler, ArgInBrowse{}, ArgOutBrowse{})
+}
+
+type ArgInSearch struct {
+	ContainerID    string `upnp:"A_ARG_TYPE_ObjectID"`
+	SearchCriteria string `upnp:"A_ARG_TYPE_SearchCriteria"`
+	Filter         string `upnp:"A_ARG_TYPE_Filter"`
+	StartingIndex  uint32 `upnp:"A_ARG_TYPE_Index"`
+	RequestedCount uint32 `upnp:"A_ARG_TYPE_Count"`
+	SortCriteria   string `upnp:"A_ARG_TYPE_SortCriteria"`
+}
+type ArgOutSearch struct {
+	Result         string `upnp:"A_ARG_TYPE_Result"`
+	NumberReturned uint32 `upnp:"A_ARG_TYPE_Count"`
+	TotalMatches   uint32 `upnp:"A_ARG_TYPE_Count"`
+	UpdateID       uint32 `upnp:"A_ARG_TYPE_UpdateID"`
+}
+
+func Search(handler upnp.ActionHandler) *upnp.Action {
+	return upnp.NewAction("Search", handler, ArgInSearch{}, ArgOutSearch{})
+}
+
+type ArgInGetSearchCapabilities struct{}
+type ArgOutGetSearchCapabilities struct {
+	SearchCaps string `upnp:"SearchCapabilities"`
+}
+
+func GetSearchCapabilities(handler upnp.ActionHandler) *upnp.Action {
+	return upnp.NewAction("GetSearchCapabilities", handler, ArgInGetSearchCapabilities{}, ArgOutGetSearchCapabilities{})
+}
+
+type ArgInGetSortCapabilities struct{}
+type ArgOutGetSortCapabilities struct {
+	SortCaps string `upnp:"SortCapabilities"`
+}
+
+func GetSortCapabilities(handler upnp.ActionHandler) *upnp.Action {
+	return upnp.NewAction("GetSortCapabilities", handler, ArgInGetSortCapabilities{}, ArgOutGetSortCapabilities{})
+}
+
+type ArgInGetSystemUpdateID struct{}
+type ArgOutGetSystemUpdateID struct {
+	Id uint32 `upnp:"SystemUpdateID"`
+}
+
+func GetSystemUpdateID(handler upnp.ActionHandler) *upnp.Action {
+	return upnp.NewAction("GetSystemUpdateID", handler, ArgInGetSystemUpdateID{}, ArgOutGetSystemUpdateID{})
+}
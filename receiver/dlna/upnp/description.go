@@ -0,0 +1,129 @@
+package upnp
+
+import (
+	"bytes"
+	"encoding/xml"
+	"sort"
+	"strconv"
+)
+
+const deviceNS = "urn:schemas-upnp-org:device-1-0"
+const serviceNS = "urn:schemas-upnp-org:service-1-0"
+
+func writeElement(b *bytes.Buffer, name string, val string) {
+	b.WriteString("<" + name + ">")
+	xml.EscapeText(b, []byte(val))
+	b.WriteString("</" + name + ">")
+}
+
+// 各个路径相对于设备描述的地址
+func scpdPath(s *Service) string {
+	return "/" + s.Name + "/scpd.xml"
+}
+
+func controlPath(uuid string, s *Service) string {
+	return "/" + uuid + "/" + s.Name + "/control"
+}
+
+func eventPath(uuid string, s *Service) string {
+	return "/" + uuid + "/" + s.Name + "/event"
+}
+
+func descriptionPath(uuid string) string {
+	return "/" + uuid + "/description.xml"
+}
+
+// 设备描述
+func (s *DeviceServer) writeDescription(b *bytes.Buffer, d *device) {
+	b.WriteString(`<?xml version="1.0" encoding="utf-8"?>` + "\n")
+	b.WriteString(`<root xmlns="` + deviceNS + `"`)
+	names := make([]string, 0, len(s.RootDescNamespaces))
+	for n := range s.RootDescNamespaces {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		b.WriteString(" " + n + `="`)
+		xml.EscapeText(b, []byte(s.RootDescNamespaces[n]))
+		b.WriteString(`"`)
+	}
+	b.WriteString(`><specVersion><major>1</major><minor>0</minor></specVersion><device>`)
+	writeElement(b, "deviceType", string(s.DeviceType))
+	writeElement(b, "friendlyName", d.name)
+	writeElement(b, "manufacturer", s.Manufacturer)
+	writeElement(b, "modelName", s.ServerName)
+	writeElement(b, "UDN", "uuid:"+d.uuid)
+	switch s.DeviceType {
+	case DeviceType_MediaRenderer:
+		b.WriteString(`<dlna:X_DLNADOC xmlns:dlna="urn:schemas-dlna-org:device-1-0">DMR-1.50</dlna:X_DLNADOC>`)
+	case DeviceType_MediaServer:
+		b.WriteString(`<dlna:X_DLNADOC xmlns:dlna="urn:schemas-dlna-org:device-1-0">DMS-1.50</dlna:X_DLNADOC>`)
+	}
+	b.WriteString("<serviceList>")
+	for _, c := range s.ServiceList {
+		b.WriteString("<service>")
+		writeElement(b, "serviceType", c.Service.Type())
+		writeElement(b, "serviceId", c.Service.ID())
+		writeElement(b, "SCPDURL", scpdPath(c.Service))
+		writeElement(b, "controlURL", controlPath(d.uuid, c.Service))
+		writeElement(b, "eventSubURL", eventPath(d.uuid, c.Service))
+		b.WriteString("</service>")
+	}
+	b.WriteString("</serviceList></device></root>")
+}
+
+func writeArguments(b *bytes.Buffer, args []argument, direction string) {
+	for _, arg := range args {
+		b.WriteString("<argument>")
+		writeElement(b, "name", arg.name)
+		writeElement(b, "direction", direction)
+		writeElement(b, "relatedStateVariable", arg.variable)
+		b.WriteString("</argument>")
+	}
+}
+
+// 服务描述，只包含实现的操作
+func writeScpd(b *bytes.Buffer, c *Controller) {
+	b.WriteString(`<?xml version="1.0" encoding="utf-8"?>` + "\n")
+	b.WriteString(`<scpd xmlns="` + serviceNS + `"><specVersion><major>1</major><minor>0</minor></specVersion>`)
+
+	b.WriteString("<actionList>")
+	for _, a := range c.Actions {
+		b.WriteString("<action>")
+		writeElement(b, "name", a.Name)
+		b.WriteString("<argumentList>")
+		writeArguments(b, arguments(a.argIn), "in")
+		writeArguments(b, arguments(a.argOut), "out")
+		b.WriteString("</argumentList></action>")
+	}
+	b.WriteString("</actionList>")
+
+	b.WriteString("<serviceStateTable>")
+	for _, v := range c.Service.Variables {
+		if v.SendEvents {
+			b.WriteString(`<stateVariable sendEvents="yes">`)
+		} else {
+			b.WriteString(`<stateVariable sendEvents="no">`)
+		}
+		writeElement(b, "name", v.Name)
+		writeElement(b, "dataType", v.DataType)
+		if len(v.AllowedValues) > 0 {
+			b.WriteString("<allowedValueList>")
+			for _, a := range v.AllowedValues {
+				writeElement(b, "allowedValue", a)
+			}
+			b.WriteString("</allowedValueList>")
+		}
+		if r := v.Range; r != nil {
+			b.WriteString("<allowedValueRange>")
+			writeElement(b, "minimum", strconv.Itoa(r.Min))
+			writeElement(b, "maximum", strconv.Itoa(r.Max))
+			if r.Step > 0 {
+				writeElement(b, "step", strconv.Itoa(r.Step))
+			}
+			b.WriteString("</allowedValueRange>")
+		}
+		b.WriteString("</stateVariable>")
+	}
+	b.WriteString("</serviceStateTable></scpd>")
+}
@@ -0,0 +1,40 @@
+package upnp
+
+import (
+	"errors"
+	"fmt"
+	"net"
+)
+
+// IPDenyError 请求的地址不在允许的范围内
+type IPDenyError struct {
+	IP net.IP
+}
+
+func (e *IPDenyError) Error() string {
+	return fmt.Sprintf("ip %s denied", e.IP.String())
+}
+
+func IsIPDenyError(err error) bool {
+	var e *IPDenyError
+	return errors.As(err, &e)
+}
+
+// RequestError 无法解析的 SSDP 请求，局域网中经常出现，不需要提示
+type RequestError struct {
+	From net.Addr
+	Err  error
+}
+
+func (e *RequestError) Error() string {
+	return fmt.Sprintf("invalid ssdp request from %s: %s", e.From.String(), e.Err.Error())
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+func IsRequestError(err error) bool {
+	var e *RequestError
+	return errors.As(err, &e)
+}
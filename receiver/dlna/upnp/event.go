@@ -0,0 +1,281 @@
+package upnp
+
+import (
+	"bytes"
+	"crypto/rand"
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	eventNS = "urn:schemas-upnp-org:event-1-0"
+	// 订阅的最长时间，控制端需要在此之前续订
+	subscribeTimeout = 1800 * time.Second
+	eventTimeout     = 5 * time.Second
+)
+
+// subscription 一个控制端对设备中一个服务的订阅
+type subscription struct {
+	sid       string
+	uuid      string
+	service   string
+	callbacks []string
+	expire    time.Time // 由 DeviceServer.locker 保护
+
+	locker  sync.Mutex
+	pending [][]byte
+	wake    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+func newSID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return fmt.Sprintf("uuid:%x-%x-%x-%x-%x", b[:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+func newSubscription(uuid string, service string, callbacks []string, timeout time.Duration) *subscription {
+	return &subscription{
+		sid:       newSID(),
+		uuid:      uuid,
+		service:   service,
+		callbacks: callbacks,
+		expire:    time.Now().Add(timeout),
+		wake:      make(chan struct{}, 1),
+		done:      make(chan struct{}),
+	}
+}
+
+// 事件按照顺序发送，不阻塞调用者
+func (sub *subscription) push(body []byte) {
+	sub.locker.Lock()
+	sub.pending = append(sub.pending, body)
+	sub.locker.Unlock()
+
+	select {
+	case sub.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (sub *subscription) take() [][]byte {
+	sub.locker.Lock()
+	defer sub.locker.Unlock()
+
+	list := sub.pending
+	sub.pending = nil
+	return list
+}
+
+func (sub *subscription) stop() {
+	sub.once.Do(func() { close(sub.done) })
+}
+
+// 属性集，变量按照名称排序
+func propertySet(vars map[string]string) []byte {
+	names := make([]string, 0, len(vars))
+	for n := range vars {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	var b bytes.Buffer
+	b.WriteString(`<?xml version="1.0" encoding="utf-8"?>` + "\n")
+	b.WriteString(`<e:propertyset xmlns:e="` + eventNS + `">`)
+	for _, n := range names {
+		b.WriteString("<e:property>")
+		writeElement(&b, n, vars[n])
+		b.WriteString("</e:property>")
+	}
+	b.WriteString("</e:propertyset>")
+	return b.Bytes()
+}
+
+// TIMEOUT 头，例如 Second-1800，不能超过 subscribeTimeout
+func parseTimeout(s string) time.Duration {
+	s = strings.TrimSpace(s)
+	if len(s) > 7 && strings.EqualFold(s[:7], "Second-") {
+		if n, err := strconv.Atoi(s[7:]); err == nil && n > 0 && time.Duration(n)*time.Second < subscribeTimeout {
+			return time.Duration(n) * time.Second
+		}
+	}
+	return subscribeTimeout
+}
+
+var callbackRegexp = regexp.MustCompile(`<(http://[^>]+)>`)
+
+// CALLBACK 头，例如 <http://192.168.1.2:8080/event><http://...>
+func parseCallback(s string) []string {
+	list := []string{}
+	for _, m := range callbackRegexp.FindAllStringSubmatch(s, -1) {
+		list = append(list, m[1])
+	}
+	return list
+}
+
+func (s *DeviceServer) writeSubscribed(ctx *fasthttp.RequestCtx, sid string, timeout time.Duration) {
+	ctx.Response.Header.Set("SID", sid)
+	ctx.Response.Header.Set("TIMEOUT", "Second-"+strconv.Itoa(int(timeout/time.Second)))
+	ctx.SetStatusCode(fasthttp.StatusOK)
+}
+
+// 订阅或者续订
+func (s *DeviceServer) subscribe(ctx *fasthttp.RequestCtx, uuid string, c *Controller) {
+	header := &ctx.Request.Header
+	sid := string(header.Peek("SID"))
+	timeout := parseTimeout(string(header.Peek("TIMEOUT")))
+
+	if sid != "" {
+		if len(header.Peek("CALLBACK")) > 0 || len(header.Peek("NT")) > 0 {
+			ctx.SetStatusCode(fasthttp.StatusBadRequest)
+			return
+		}
+		s.locker.Lock()
+		sub, ok := s.subs[sid]
+		ok = ok && sub.uuid == uuid && sub.service == c.Service.Name
+		if ok {
+			sub.expire = time.Now().Add(timeout)
+		}
+		s.locker.Unlock()
+		if !ok {
+			ctx.SetStatusCode(fasthttp.StatusPreconditionFailed)
+			return
+		}
+		s.writeSubscribed(ctx, sid, timeout)
+		return
+	}
+
+	callbacks := parseCallback(string(header.Peek("CALLBACK")))
+	if string(header.Peek("NT")) != "upnp:event" || len(callbacks) == 0 {
+		ctx.SetStatusCode(fasthttp.StatusPreconditionFailed)
+		return
+	}
+
+	sub := newSubscription(uuid, c.Service.Name, callbacks, timeout)
+	s.locker.Lock()
+	closed := s.closed
+	if !closed {
+		s.subs[sub.sid] = sub
+	}
+	s.locker.Unlock()
+	if closed {
+		ctx.SetStatusCode(fasthttp.StatusServiceUnavailable)
+		return
+	}
+
+	sub.push(propertySet(c.initialEvents(uuid)))
+	s.writeSubscribed(ctx, sub.sid, timeout)
+
+	// 第一个事件需要在订阅的回复之后发送
+	ctx.Hijack(func(net.Conn) {
+		go s.deliver(sub)
+	})
+}
+
+func (s *DeviceServer) unsubscribe(ctx *fasthttp.RequestCtx, uuid string, c *Controller) {
+	header := &ctx.Request.Header
+	sid := string(header.Peek("SID"))
+	if sid == "" {
+		ctx.SetStatusCode(fasthttp.StatusPreconditionFailed)
+		return
+	}
+	if len(header.Peek("CALLBACK")) > 0 || len(header.Peek("NT")) > 0 {
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
+		return
+	}
+
+	s.locker.Lock()
+	sub, ok := s.subs[sid]
+	ok = ok && sub.uuid == uuid && sub.service == c.Service.Name
+	if ok {
+		delete(s.subs, sid)
+		sub.stop()
+	}
+	s.locker.Unlock()
+
+	if !ok {
+		ctx.SetStatusCode(fasthttp.StatusPreconditionFailed)
+		return
+	}
+	ctx.SetStatusCode(fasthttp.StatusOK)
+}
+
+func (s *DeviceServer) expireSubscriptions() {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	now := time.Now()
+	for sid, sub := range s.subs {
+		if now.After(sub.expire) {
+			delete(s.subs, sid)
+			sub.stop()
+		}
+	}
+}
+
+// Notify 向订阅了设备中此服务的控制端发送状态变量
+func (s *DeviceServer) Notify(uuid string, service string, vars map[string]string) {
+	body := propertySet(vars)
+
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	now := time.Now()
+	for _, sub := range s.subs {
+		if sub.uuid == uuid && sub.service == service && now.Before(sub.expire) {
+			sub.push(body)
+		}
+	}
+}
+
+func (s *DeviceServer) deliver(sub *subscription) {
+	var seq uint32
+	for {
+		select {
+		case <-sub.done:
+			return
+		case <-sub.wake:
+		}
+		for _, body := range sub.take() {
+			s.sendEvent(sub, seq, body)
+			// 溢出后从 1 开始，0 只用于第一个事件
+			if seq++; seq == 0 {
+				seq = 1
+			}
+		}
+	}
+}
+
+func (s *DeviceServer) sendEvent(sub *subscription, seq uint32, body []byte) {
+	req := fasthttp.AcquireRequest()
+	res := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseRequest(req)
+	defer fasthttp.ReleaseResponse(res)
+
+	req.Header.DisableNormalizing()
+	req.Header.SetMethod("NOTIFY")
+	req.Header.SetContentType(`text/xml; charset="utf-8"`)
+	req.Header.Set("NT", "upnp:event")
+	req.Header.Set("NTS", "upnp:propchange")
+	req.Header.Set("SID", sub.sid)
+	req.Header.Set("SEQ", strconv.FormatUint(uint64(seq), 10))
+	req.SetBody(body)
+
+	var err error
+	for _, cb := range sub.callbacks {
+		req.SetRequestURI(cb)
+		if err = s.client.DoTimeout(req, res, eventTimeout); err == nil {
+			return
+		}
+	}
+	s.onError(fmt.Errorf("send event to %s failed: %w", strings.Join(sub.callbacks, ","), err))
+}
@@ -0,0 +1,88 @@
+package renderingcontrol1
+
+import (
+	"github.com/zwcway/castserver-go/receiver/dlna/upnp"
+)
+
+const NAME = "RenderingControl"
+
+var Service = &upnp.Service{
+	Name:    NAME,
+	Version: 1,
+	Variables: []*upnp.StateVariable{
+		{Name: "PresetNameList", DataType: "string"},
+		{Name: "LastChange", DataType: "string", SendEvents: true},
+		{Name: "Mute", DataType: "boolean"},
+		{Name: "Volume", DataType: "ui2", Range: &upnp.ValueRange{Min: 0, Max: 100, Step: 1}},
+		{Name: "A_ARG_TYPE_Channel", DataType: "string", AllowedValues: []string{"Master"}},
+		{Name: "A_ARG_TYPE_InstanceID", DataType: "ui4"},
+		{Name: "A_ARG_TYPE_PresetName", DataType: "string", AllowedValues: []string{"FactoryDefaults"}},
+	},
+}
+
+type ArgInListPresets struct {
+	InstanceID uint32 `upnp:"A_ARG_TYPE_InstanceID"`
+}
+type ArgOutListPresets struct {
+	CurrentPresetNameList string `upnp:"PresetNameList"`
+}
+
+func ListPresets(handler upnp.ActionHandler) *upnp.Action {
+	return upnp.NewAction("ListPresets", handler, ArgInListPresets{}, ArgOutListPresets{})
+}
+
+type ArgInSelectPreset struct {
+	InstanceID uint32 `upnp:"A_ARG_TYPE_InstanceID"`
+	PresetName string `upnp:"A_ARG_TYPE_PresetName"`
+}
+type ArgOutSelectPreset struct{}
+
+func SelectPreset(handler upnp.ActionHandler) *upnp.Action {
+	return upnp.NewAction("SelectPreset", handler, ArgInSelectPreset{}, ArgOutSelectPreset{})
+}
+
+type ArgInGetMute struct {
+	InstanceID uint32 `upnp:"A_ARG_TYPE_InstanceID"`
+	Channel    string `upnp:"A_ARG_TYPE_Channel"`
+}
+type ArgOutGetMute struct {
+	CurrentMute bool `upnp:"Mute"`
+}
+
+func GetMute(handler upnp.ActionHandler) *upnp.Action {
+	return upnp.NewAction("GetMute", handler, ArgInGetMute{}, ArgOutGetMute{})
+}
+
+type ArgInSetMute struct {
+	InstanceID  uint32 `upnp:"A_ARG_TYPE_InstanceID"`
+	Channel     string `upnp:"A_ARG_TYPE_Channel"`
+	DesiredMute bool   `upnp:"Mute"`
+}
+type ArgOutSetMute struct{}
+
+func SetMute(handler upnp.ActionHandler) *upnp.Action {
+	return upnp.NewAction("SetMute", handler, ArgInSetMute{}, ArgOutSetMute{})
+}
+
+type ArgInGetVolume struct {
+	InstanceID uint32 `upnp:"A_ARG_TYPE_InstanceID"`
+	Channel    string `upnp:"A_ARG_TYPE_Channel"`
+}
+type ArgOutGetVolume struct {
+	CurrentVolume uint16 `upnp:"Volume"`
+}
+
+func GetVolume(handler upnp.ActionHandler) *upnp.Action {
+	return upnp.NewAction("GetVolume", handler, ArgInGetVolume{}, ArgOutGetVolume{})
+}
+
+type ArgInSetVolume struct {
+	InstanceID    uint32 `upnp:"A_ARG_TYPE_InstanceID"`
+	Channel       string `upnp:"A_ARG_TYPE_Channel"`
+	DesiredVolume uint16 `upnp:"Volume"`
+}
+type ArgOutSetVolume struct{}
+
+func SetVolume(handler upnp.ActionHandler) *upnp.Action {
+	return upnp.NewAction("SetVolume", handler, ArgInSetVolume{}, ArgOutSetVolume{})
+}
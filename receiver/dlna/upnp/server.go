@@ -0,0 +1,376 @@
+package upnp
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"net/netip"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	"github.com/zwcway/castserver-go/common/utils"
+)
+
+const defaultNotifyInterval = 30 * time.Second
+
+// DeviceServer 在一个 HTTP 服务中提供多个相同类型的设备，并通过 SSDP 广播
+type DeviceServer struct {
+	ctx utils.Context
+
+	DeviceType         DeviceType
+	Manufacturer       string
+	ServerName         string
+	RootDescNamespaces map[string]string // 设备描述中额外的命名空间
+	ServiceList        []*Controller
+
+	ListenInterface *net.Interface // 为空时监听所有地址
+	ListenPort      uint16         // 为 0 时随机分配
+	NotifyInterval  time.Duration  // SSDP 广播的间隔
+
+	DenyIps  []*net.IPNet
+	AllowIps []*net.IPNet // 为空时允许所有地址
+
+	ErrorHandler        func(err error)
+	InfoHandler         func(msg string)
+	BeforeRequestHandle func(ctx *fasthttp.RequestCtx) bool // 返回 false 时不再处理请求
+	AfterRequestHandle  func(ctx *fasthttp.RequestCtx) bool
+
+	ip       net.IP // 广播的地址
+	http     *fasthttp.Server
+	listener net.Listener
+	ssdp     *net.UDPConn
+	client   *fasthttp.Client
+
+	locker  sync.Mutex
+	devices map[string]*device
+	subs    map[string]*subscription
+	closed  bool
+	done    chan struct{}
+}
+
+type device struct {
+	uuid string
+	name string
+}
+
+func NewDeviceServer(ctx utils.Context) (*DeviceServer, error) {
+	return &DeviceServer{
+		ctx:            ctx,
+		NotifyInterval: defaultNotifyInterval,
+		client:         &fasthttp.Client{NoDefaultUserAgentHeader: true},
+		devices:        map[string]*device{},
+		subs:           map[string]*subscription{},
+		done:           make(chan struct{}),
+	}, nil
+}
+
+// Init 开始监听，SSDP 失败时设备只能通过地址访问
+func (s *DeviceServer) Init() (err error) {
+	if len(s.ServiceList) == 0 {
+		return errors.New("upnp service list is empty")
+	}
+	for _, c := range s.ServiceList {
+		if err = c.Validate(); err != nil {
+			return err
+		}
+	}
+
+	ip := net.IPv4zero
+	if s.ListenInterface != nil {
+		if a := utils.InterfaceAddr(s.ListenInterface, false); a != nil {
+			ip = a.IP
+		}
+	}
+	s.listener, err = net.Listen("tcp4", net.JoinHostPort(ip.String(), strconv.Itoa(int(s.ListenPort))))
+	if err != nil {
+		return err
+	}
+	s.ListenPort = uint16(s.listener.Addr().(*net.TCPAddr).Port)
+
+	s.ip = ip
+	if ip.IsUnspecified() {
+		if addr := utils.DefaultAddr(); addr != nil {
+			s.ip = addr.AsSlice()
+		}
+	}
+
+	s.http = &fasthttp.Server{
+		Handler:              s.handle,
+		Name:                 s.serverHeader(),
+		NoDefaultContentType: true,
+		ReadTimeout:          30 * time.Second,
+		WriteTimeout:         30 * time.Second,
+	}
+
+	s.ssdp, err = net.ListenMulticastUDP("udp4", s.ListenInterface, ssdpGroup)
+	if err != nil {
+		s.onError(err)
+		s.ssdp, err = nil, nil
+	}
+
+	s.onInfo("upnp listen on " + s.listener.Addr().String())
+	return nil
+}
+
+// Serve 阻塞直到 Close
+func (s *DeviceServer) Serve() {
+	if s.ssdp != nil {
+		go s.serveSSDP()
+	}
+	go s.aliveRoutine()
+
+	if err := s.http.Serve(s.listener); err != nil && !utils.IsConnectCloseError(err) {
+		s.onError(err)
+	}
+}
+
+func (s *DeviceServer) Close() {
+	s.locker.Lock()
+	if s.closed {
+		s.locker.Unlock()
+		return
+	}
+	s.closed = true
+	devices := make([]*device, 0, len(s.devices))
+	for _, d := range s.devices {
+		devices = append(devices, d)
+	}
+	for sid, sub := range s.subs {
+		delete(s.subs, sid)
+		sub.stop()
+	}
+	s.locker.Unlock()
+
+	close(s.done)
+	for _, d := range devices {
+		s.notify(d, ssdpByeBye)
+	}
+	if s.ssdp != nil {
+		s.ssdp.Close()
+	}
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	if s.http != nil {
+		s.http.Shutdown()
+	}
+}
+
+// AddServer 增加一个设备，或者修改已有设备的名称。uuid 为空时生成一个新的 uuid
+func (s *DeviceServer) AddServer(name string, uuid string) string {
+	if uuid == "" {
+		uuid = utils.MakeUUID(name + strconv.FormatInt(time.Now().UnixNano(), 10))
+	}
+
+	s.locker.Lock()
+	d, ok := s.devices[uuid]
+	if ok {
+		d.name = name
+	} else {
+		d = &device{uuid: uuid, name: name}
+		s.devices[uuid] = d
+	}
+	closed := s.closed
+	s.locker.Unlock()
+
+	if !ok && !closed {
+		s.notify(d, ssdpAlive)
+	}
+	return uuid
+}
+
+func (s *DeviceServer) DelServer(uuid string) {
+	s.locker.Lock()
+	d, ok := s.devices[uuid]
+	delete(s.devices, uuid)
+	for sid, sub := range s.subs {
+		if sub.uuid == uuid {
+			delete(s.subs, sid)
+			sub.stop()
+		}
+	}
+	s.locker.Unlock()
+
+	if ok {
+		s.notify(d, ssdpByeBye)
+	}
+}
+
+func (s *DeviceServer) findDevice(uuid string) *device {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	return s.devices[uuid]
+}
+
+func (s *DeviceServer) findController(name string) *Controller {
+	for _, c := range s.ServiceList {
+		if c.Service.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func (s *DeviceServer) onError(err error) {
+	if s.ErrorHandler != nil {
+		s.ErrorHandler(err)
+	}
+}
+
+func (s *DeviceServer) onInfo(msg string) {
+	if s.InfoHandler != nil {
+		s.InfoHandler(msg)
+	}
+}
+
+func (s *DeviceServer) serverHeader() string {
+	return runtime.GOOS + "/" + runtime.Version() + " UPnP/1.0 " + s.ServerName
+}
+
+func (s *DeviceServer) allowed(ip net.IP) bool {
+	for _, n := range s.DenyIps {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	if len(s.AllowIps) == 0 {
+		return true
+	}
+	for _, n := range s.AllowIps {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// 设备描述的地址，local 为请求方可以访问的本机地址
+func (s *DeviceServer) location(local net.IP, uuid string) string {
+	addr := netip.AddrPortFrom(netip.IPv4Unspecified(), s.ListenPort)
+	if ip, ok := netip.AddrFromSlice(local); ok {
+		addr = netip.AddrPortFrom(ip.Unmap(), s.ListenPort)
+	}
+	return "http://" + addr.String() + descriptionPath(uuid)
+}
+
+func (s *DeviceServer) handle(ctx *fasthttp.RequestCtx) {
+	if ip := ctx.RemoteIP(); !s.allowed(ip) {
+		s.onError(&IPDenyError{IP: ip})
+		ctx.SetStatusCode(fasthttp.StatusForbidden)
+		return
+	}
+	if s.BeforeRequestHandle != nil && !s.BeforeRequestHandle(ctx) {
+		return
+	}
+
+	// SID、EXT 等头保持大写
+	ctx.Response.Header.DisableNormalizing()
+	s.route(ctx)
+
+	if s.AfterRequestHandle != nil {
+		s.AfterRequestHandle(ctx)
+	}
+}
+
+// route 按路径分发请求：
+//
+//	/<服务>/scpd.xml             服务描述
+//	/<uuid>/description.xml      设备描述
+//	/<uuid>/<服务>/control        操作
+//	/<uuid>/<服务>/event          订阅事件
+func (s *DeviceServer) route(ctx *fasthttp.RequestCtx) {
+	parts := strings.Split(strings.Trim(string(ctx.Path()), "/"), "/")
+	method := string(ctx.Method())
+
+	switch {
+	case len(parts) == 2 && parts[1] == "scpd.xml" && method == fasthttp.MethodGet:
+		if c := s.findController(parts[0]); c != nil {
+			var b bytes.Buffer
+			writeScpd(&b, c)
+			writeXML(ctx, b.Bytes())
+			return
+		}
+	case len(parts) == 2 && parts[1] == "description.xml" && method == fasthttp.MethodGet:
+		if d := s.findDevice(parts[0]); d != nil {
+			var b bytes.Buffer
+			s.locker.Lock()
+			s.writeDescription(&b, d)
+			s.locker.Unlock()
+			writeXML(ctx, b.Bytes())
+			return
+		}
+	case len(parts) == 3:
+		d := s.findDevice(parts[0])
+		c := s.findController(parts[1])
+		if d == nil || c == nil {
+			break
+		}
+		switch {
+		case parts[2] == "control" && method == fasthttp.MethodPost:
+			s.control(ctx, d.uuid, c)
+			return
+		case parts[2] == "event" && method == "SUBSCRIBE":
+			s.subscribe(ctx, d.uuid, c)
+			return
+		case parts[2] == "event" && method == "UNSUBSCRIBE":
+			s.unsubscribe(ctx, d.uuid, c)
+			return
+		}
+	}
+	ctx.SetStatusCode(fasthttp.StatusNotFound)
+}
+
+func writeXML(ctx *fasthttp.RequestCtx, body []byte) {
+	ctx.SetContentType(`text/xml; charset="utf-8"`)
+	ctx.SetBody(body)
+}
+
+func (s *DeviceServer) control(ctx *fasthttp.RequestCtx, uuid string, c *Controller) {
+	var b bytes.Buffer
+
+	fault := func(e *Error) {
+		writeFault(&b, e)
+		ctx.SetStatusCode(fasthttp.StatusInternalServerError)
+		writeXML(ctx, b.Bytes())
+	}
+
+	name, args, err := parseSoap(ctx.PostBody())
+	if err != nil {
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
+		return
+	}
+	typ, header := parseSoapAction(string(ctx.Request.Header.Peek("SOAPACTION")))
+	if header != "" && (header != name || typ != c.Service.Type()) {
+		fault(&Error{Code: 401, Desc: "Invalid Action"})
+		return
+	}
+	a := c.action(name)
+	if a == nil {
+		fault(&Error{Code: 401, Desc: "Invalid Action"})
+		return
+	}
+
+	in := reflect.New(a.argIn)
+	out := reflect.New(a.argOut)
+	if err = decodeArgs(in.Elem(), args); err == nil {
+		err = a.Handler(in.Interface(), out.Interface(), ctx, uuid)
+	}
+	if err != nil {
+		var e *Error
+		if !errors.As(err, &e) {
+			e = &Error{Code: 501, Desc: err.Error()}
+		}
+		fault(e)
+		return
+	}
+
+	writeResponse(&b, c.Service.Type(), a.Name, out.Elem())
+	ctx.Response.Header.Set("EXT", "")
+	writeXML(ctx, b.Bytes())
+}
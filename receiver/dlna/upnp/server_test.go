@@ -0,0 +1,286 @@
+package upnp
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/valyala/fasthttp"
+	"github.com/zwcway/castserver-go/common/utils"
+)
+
+var testService = &Service{
+	Name:    "Test",
+	Version: 1,
+	Variables: []*StateVariable{
+		{Name: "LastChange", DataType: "string", SendEvents: true},
+		{Name: "Name", DataType: "string"},
+		{Name: "Mute", DataType: "boolean"},
+		{Name: "Count", DataType: "ui2", Range: &ValueRange{Min: 0, Max: 100, Step: 1}},
+		{Name: "Channel", DataType: "string", AllowedValues: []string{"Master"}},
+		{Name: "Offset", DataType: "i4"},
+		{Name: "A_ARG_TYPE_InstanceID", DataType: "ui4"},
+	},
+}
+
+type testEvent struct {
+	sid  string
+	seq  int
+	body string
+}
+
+func newTestServer(t *testing.T) *DeviceServer {
+	s, err := NewDeviceServer(utils.NewEmptyContext())
+	assert.Nil(t, err)
+
+	s.DeviceType = DeviceType_MediaRenderer
+	s.Manufacturer = "castserver"
+	s.ServerName = "castserver/test"
+	s.RootDescNamespaces = map[string]string{"xmlns:dlna": "urn:schemas-dlna-org:device-1-0"}
+	s.ServiceList = []*Controller{{
+		Service: testService,
+		Actions: []*Action{
+			NewAction("Get", func(input any, output any, ctx *fasthttp.RequestCtx, uuid string) error {
+				*output.(*testArgOut) = testArgOut{Name: uuid, Mute: true, Count: 42}
+				return nil
+			}, struct{}{}, testArgOut{}),
+			NewAction("Set", func(input any, output any, ctx *fasthttp.RequestCtx, uuid string) error {
+				in := input.(*testArgIn)
+				if in.InstanceID != 0 {
+					return &Error{Code: 718, Desc: "Invalid InstanceID"}
+				}
+				if in.Offset < 0 {
+					return errors.New("negative offset")
+				}
+				return nil
+			}, testArgIn{}, struct{}{}),
+		},
+		Events: func(uuid string) map[string]string {
+			return map[string]string{"LastChange": "init " + uuid}
+		},
+	}}
+	s.ListenInterface = nil
+	s.ListenPort = 0
+
+	assert.Nil(t, s.Init())
+	// 测试中不广播
+	if s.ssdp != nil {
+		s.ssdp.Close()
+		s.ssdp = nil
+	}
+	go s.Serve()
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func testRequest(t *testing.T, s *DeviceServer, method string, path string, headers map[string]string, body string) (int, string, *fasthttp.ResponseHeader) {
+	req := fasthttp.AcquireRequest()
+	res := fasthttp.AcquireResponse()
+	defer fasthttp.ReleaseRequest(req)
+	defer fasthttp.ReleaseResponse(res)
+
+	req.Header.SetMethod(method)
+	req.SetRequestURI("http://127.0.0.1:" + strconv.Itoa(int(s.ListenPort)) + path)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	req.SetBodyString(body)
+
+	assert.Nil(t, fasthttp.DoTimeout(req, res, time.Second))
+
+	header := &fasthttp.ResponseHeader{}
+	res.Header.CopyTo(header)
+	return res.StatusCode(), string(res.Body()), header
+}
+
+func testSoapBody(action string, args string) string {
+	return `<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body>` +
+		`<u:` + action + ` xmlns:u="urn:schemas-upnp-org:service:Test:1">` + args + `</u:` + action + `></s:Body></s:Envelope>`
+}
+
+func TestDeviceServer(t *testing.T) {
+	s := newTestServer(t)
+	uuid := s.AddServer("Room <1>", "")
+	assert.NotEmpty(t, uuid)
+	assert.Equal(t, uuid, s.AddServer("Room <2>", uuid))
+
+	t.Run("validate", func(t *testing.T) {
+		assert.Nil(t, s.ServiceList[0].Validate())
+
+		c := &Controller{Service: testService, Actions: []*Action{
+			NewAction("Bad", func(any, any, *fasthttp.RequestCtx, string) error { return nil }, struct{ Volume uint16 }{}, struct{}{}),
+		}}
+		assert.NotNil(t, c.Validate())
+	})
+
+	t.Run("description", func(t *testing.T) {
+		code, body, _ := testRequest(t, s, "GET", "/"+uuid+"/description.xml", nil, "")
+		assert.Equal(t, fasthttp.StatusOK, code)
+		assert.Contains(t, body, `<root xmlns="urn:schemas-upnp-org:device-1-0" xmlns:dlna="urn:schemas-dlna-org:device-1-0">`)
+		assert.Contains(t, body, `<friendlyName>Room &lt;2&gt;</friendlyName>`)
+		assert.Contains(t, body, `<UDN>uuid:`+uuid+`</UDN>`)
+		assert.Contains(t, body, `DMR-1.50`)
+		assert.Contains(t, body, `<service><serviceType>urn:schemas-upnp-org:service:Test:1</serviceType><serviceId>urn:upnp-org:serviceId:Test</serviceId>`+
+			`<SCPDURL>/Test/scpd.xml</SCPDURL><controlURL>/`+uuid+`/Test/control</controlURL><eventSubURL>/`+uuid+`/Test/event</eventSubURL></service>`)
+
+		code, _, _ = testRequest(t, s, "GET", "/unknown/description.xml", nil, "")
+		assert.Equal(t, fasthttp.StatusNotFound, code)
+	})
+
+	t.Run("scpd", func(t *testing.T) {
+		code, body, _ := testRequest(t, s, "GET", "/Test/scpd.xml", nil, "")
+		assert.Equal(t, fasthttp.StatusOK, code)
+		assert.Contains(t, body, `<action><name>Get</name><argumentList>`+
+			`<argument><name>Name</name><direction>out</direction><relatedStateVariable>Name</relatedStateVariable></argument>`+
+			`<argument><name>Mute</name><direction>out</direction><relatedStateVariable>Mute</relatedStateVariable></argument>`+
+			`<argument><name>Count</name><direction>out</direction><relatedStateVariable>Count</relatedStateVariable></argument>`+
+			`</argumentList></action>`)
+		assert.Contains(t, body, `<argument><name>InstanceID</name><direction>in</direction><relatedStateVariable>A_ARG_TYPE_InstanceID</relatedStateVariable></argument>`)
+		assert.Contains(t, body, `<stateVariable sendEvents="yes"><name>LastChange</name><dataType>string</dataType></stateVariable>`)
+		assert.Contains(t, body, `<stateVariable sendEvents="no"><name>Count</name><dataType>ui2</dataType>`+
+			`<allowedValueRange><minimum>0</minimum><maximum>100</maximum><step>1</step></allowedValueRange></stateVariable>`)
+		assert.Contains(t, body, `<allowedValueList><allowedValue>Master</allowedValue></allowedValueList>`)
+	})
+
+	t.Run("control", func(t *testing.T) {
+		path := "/" + uuid + "/Test/control"
+
+		code, body, header := testRequest(t, s, "POST", path, map[string]string{
+			"SOAPACTION": `"urn:schemas-upnp-org:service:Test:1#Get"`,
+		}, testSoapBody("Get", ""))
+		assert.Equal(t, fasthttp.StatusOK, code)
+		assert.Contains(t, body, `<u:GetResponse xmlns:u="urn:schemas-upnp-org:service:Test:1"><Name>`+uuid+`</Name><Mute>1</Mute><Count>42</Count></u:GetResponse>`)
+		assert.NotNil(t, header.Peek("EXT"))
+
+		code, _, _ = testRequest(t, s, "POST", path, nil, testSoapBody("Set", "<InstanceID>0</InstanceID><Channel>Master</Channel>"))
+		assert.Equal(t, fasthttp.StatusOK, code)
+
+		code, body, _ = testRequest(t, s, "POST", path, nil, testSoapBody("Set", "<InstanceID>1</InstanceID>"))
+		assert.Equal(t, fasthttp.StatusInternalServerError, code)
+		assert.Contains(t, body, `<errorCode>718</errorCode>`)
+
+		code, body, _ = testRequest(t, s, "POST", path, nil, testSoapBody("Set", "<InstanceID>x</InstanceID>"))
+		assert.Equal(t, fasthttp.StatusInternalServerError, code)
+		assert.Contains(t, body, `<errorCode>402</errorCode>`)
+
+		code, body, _ = testRequest(t, s, "POST", path, nil, testSoapBody("Set", "<Offset>-1</Offset>"))
+		assert.Equal(t, fasthttp.StatusInternalServerError, code)
+		assert.Contains(t, body, `<errorCode>501</errorCode><errorDescription>negative offset</errorDescription>`)
+
+		code, body, _ = testRequest(t, s, "POST", path, nil, testSoapBody("Unknown", ""))
+		assert.Equal(t, fasthttp.StatusInternalServerError, code)
+		assert.Contains(t, body, `<errorCode>401</errorCode>`)
+
+		// SOAPACTION 与请求的操作不一致
+		code, body, _ = testRequest(t, s, "POST", path, map[string]string{
+			"SOAPACTION": `"urn:schemas-upnp-org:service:Test:1#Set"`,
+		}, testSoapBody("Get", ""))
+		assert.Equal(t, fasthttp.StatusInternalServerError, code)
+		assert.Contains(t, body, `<errorCode>401</errorCode>`)
+
+		code, _, _ = testRequest(t, s, "POST", path, nil, "not xml")
+		assert.Equal(t, fasthttp.StatusBadRequest, code)
+
+		code, _, _ = testRequest(t, s, "POST", "/unknown/Test/control", nil, testSoapBody("Get", ""))
+		assert.Equal(t, fasthttp.StatusNotFound, code)
+	})
+
+	t.Run("event", func(t *testing.T) {
+		events := make(chan testEvent, 4)
+		cb := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "NOTIFY", r.Method)
+			assert.Equal(t, "upnp:event", r.Header.Get("NT"))
+			assert.Equal(t, "upnp:propchange", r.Header.Get("NTS"))
+			seq, err := strconv.Atoi(r.Header.Get("SEQ"))
+			assert.Nil(t, err)
+			body, _ := io.ReadAll(r.Body)
+			events <- testEvent{sid: r.Header.Get("SID"), seq: seq, body: string(body)}
+		}))
+		defer cb.Close()
+
+		path := "/" + uuid + "/Test/event"
+
+		code, _, header := testRequest(t, s, "SUBSCRIBE", path, map[string]string{
+			"CALLBACK": "<" + cb.URL + "/event>",
+			"NT":       "upnp:event",
+			"TIMEOUT":  "Second-300",
+		}, "")
+		assert.Equal(t, fasthttp.StatusOK, code)
+		sid := string(header.Peek("SID"))
+		assert.NotEmpty(t, sid)
+		assert.Equal(t, "Second-300", string(header.Peek("TIMEOUT")))
+
+		// 订阅后的第一个事件
+		e := <-events
+		assert.Equal(t, sid, e.sid)
+		assert.Equal(t, 0, e.seq)
+		assert.Equal(t, `<?xml version="1.0" encoding="utf-8"?>`+"\n"+
+			`<e:propertyset xmlns:e="urn:schemas-upnp-org:event-1-0"><e:property><LastChange>init `+uuid+`</LastChange></e:property></e:propertyset>`, e.body)
+
+		s.Notify(uuid, "Test", map[string]string{"LastChange": "a&b"})
+		s.Notify("other", "Test", map[string]string{"LastChange": "other"})
+		s.Notify(uuid, "Test", map[string]string{"LastChange": "c"})
+		e = <-events
+		assert.Equal(t, 1, e.seq)
+		assert.Contains(t, e.body, `<LastChange>a&amp;b</LastChange>`)
+		e = <-events
+		assert.Equal(t, 2, e.seq)
+		assert.Contains(t, e.body, `<LastChange>c</LastChange>`)
+
+		// 续订
+		code, _, header = testRequest(t, s, "SUBSCRIBE", path, map[string]string{"SID": sid}, "")
+		assert.Equal(t, fasthttp.StatusOK, code)
+		assert.Equal(t, sid, string(header.Peek("SID")))
+		assert.Equal(t, "Second-1800", string(header.Peek("TIMEOUT")))
+
+		code, _, _ = testRequest(t, s, "SUBSCRIBE", path, map[string]string{"SID": sid, "NT": "upnp:event"}, "")
+		assert.Equal(t, fasthttp.StatusBadRequest, code)
+		code, _, _ = testRequest(t, s, "SUBSCRIBE", path, map[string]string{"SID": "uuid:unknown"}, "")
+		assert.Equal(t, fasthttp.StatusPreconditionFailed, code)
+		code, _, _ = testRequest(t, s, "SUBSCRIBE", path, map[string]string{"NT": "upnp:event"}, "")
+		assert.Equal(t, fasthttp.StatusPreconditionFailed, code)
+
+		code, _, _ = testRequest(t, s, "UNSUBSCRIBE", path, map[string]string{"SID": sid}, "")
+		assert.Equal(t, fasthttp.StatusOK, code)
+		code, _, _ = testRequest(t, s, "UNSUBSCRIBE", path, map[string]string{"SID": sid}, "")
+		assert.Equal(t, fasthttp.StatusPreconditionFailed, code)
+
+		// 取消订阅后不再通知
+		s.Notify(uuid, "Test", map[string]string{"LastChange": "d"})
+		select {
+		case e = <-events:
+			t.Fatalf("unexpected event %v", e)
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		assert.Equal(t, 300*time.Second, parseTimeout("Second-300"))
+		assert.Equal(t, subscribeTimeout, parseTimeout("Second-infinite"))
+		assert.Equal(t, subscribeTimeout, parseTimeout("Second-86400"))
+		assert.Equal(t, subscribeTimeout, parseTimeout(""))
+
+		assert.Equal(t, []string{"http://a/1", "http://b:80/2"}, parseCallback("<http://a/1><http://b:80/2>"))
+		assert.Len(t, parseCallback("http://a/1"), 0)
+	})
+
+	t.Run("allow", func(t *testing.T) {
+		_, deny, _ := net.ParseCIDR("192.168.1.10/32")
+		_, allow, _ := net.ParseCIDR("192.168.1.0/24")
+		s := &DeviceServer{DenyIps: []*net.IPNet{deny}}
+		assert.True(t, s.allowed(net.IPv4(10, 0, 0, 1)))
+		assert.False(t, s.allowed(net.IPv4(192, 168, 1, 10)))
+
+		s.AllowIps = []*net.IPNet{allow}
+		assert.True(t, s.allowed(net.IPv4(192, 168, 1, 2)))
+		assert.False(t, s.allowed(net.IPv4(192, 168, 1, 10)))
+		assert.False(t, s.allowed(net.IPv4(10, 0, 0, 1)))
+	})
+}
@@ -0,0 +1,153 @@
+package upnp
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+
+	"github.com/valyala/fasthttp"
+)
+
+// DeviceType 设备的类型
+type DeviceType string
+
+const (
+	DeviceType_MediaRenderer DeviceType = "urn:schemas-upnp-org:device:MediaRenderer:1"
+	DeviceType_MediaServer   DeviceType = "urn:schemas-upnp-org:device:MediaServer:1"
+)
+
+// ActionHandler 处理控制端的请求，input 和 output 为操作的参数结构体的指针，uuid 为请求的设备
+type ActionHandler func(input any, output any, ctx *fasthttp.RequestCtx, uuid string) error
+
+// Action 服务中的一个操作。
+// 参数结构体的字段名即参数名，upnp 标签为关联的状态变量，没有标签时为同名的状态变量
+type Action struct {
+	Name    string
+	Handler ActionHandler
+
+	argIn  reflect.Type
+	argOut reflect.Type
+}
+
+// NewAction in 和 out 为参数结构体的零值
+func NewAction(name string, handler ActionHandler, in any, out any) *Action {
+	return &Action{
+		Name:    name,
+		Handler: handler,
+		argIn:   reflect.TypeOf(in),
+		argOut:  reflect.TypeOf(out),
+	}
+}
+
+// StateVariable 服务的状态变量
+type StateVariable struct {
+	Name          string
+	DataType      string // ui2、ui4、i4、string、boolean
+	SendEvents    bool
+	AllowedValues []string
+	Range         *ValueRange
+}
+
+type ValueRange struct {
+	Min  int
+	Max  int
+	Step int
+}
+
+// Service 服务的类型
+type Service struct {
+	Name      string
+	Version   int
+	Variables []*StateVariable
+}
+
+func (s *Service) Type() string {
+	return "urn:schemas-upnp-org:service:" + s.Name + ":" + strconv.Itoa(s.Version)
+}
+
+func (s *Service) ID() string {
+	return "urn:upnp-org:serviceId:" + s.Name
+}
+
+func (s *Service) Variable(name string) *StateVariable {
+	for _, v := range s.Variables {
+		if v.Name == name {
+			return v
+		}
+	}
+	return nil
+}
+
+// Controller 设备提供的一个服务和它实现的操作
+type Controller struct {
+	Service *Service
+	Actions []*Action
+
+	// Events 设备当前所有需要通知的状态变量，作为订阅后的第一个事件。为空时使用状态变量的空值
+	Events func(uuid string) map[string]string
+}
+
+func (c *Controller) action(name string) *Action {
+	for _, a := range c.Actions {
+		if a.Name == name {
+			return a
+		}
+	}
+	return nil
+}
+
+// Validate 检查每个操作的参数都关联了服务中的状态变量
+func (c *Controller) Validate() error {
+	for _, a := range c.Actions {
+		if a.Handler == nil {
+			return fmt.Errorf("%s action %s has no handler", c.Service.Name, a.Name)
+		}
+		for _, t := range []reflect.Type{a.argIn, a.argOut} {
+			for _, arg := range arguments(t) {
+				if c.Service.Variable(arg.variable) == nil {
+					return fmt.Errorf("%s action %s argument %s: unknown state variable %s", c.Service.Name, a.Name, arg.name, arg.variable)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Controller) initialEvents(uuid string) map[string]string {
+	if c.Events != nil {
+		return c.Events(uuid)
+	}
+	vars := map[string]string{}
+	for _, v := range c.Service.Variables {
+		if v.SendEvents {
+			vars[v.Name] = ""
+		}
+	}
+	return vars
+}
+
+// 参数名和关联的状态变量
+type argument struct {
+	name     string
+	variable string
+	field    int
+}
+
+func arguments(t reflect.Type) []argument {
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil
+	}
+	args := make([]argument, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		v := f.Tag.Get("upnp")
+		if v == "" {
+			v = f.Name
+		}
+		args = append(args, argument{name: f.Name, variable: v, field: i})
+	}
+	return args
+}
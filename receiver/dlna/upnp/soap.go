@@ -0,0 +1,161 @@
+package upnp
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	soapEnvelopeNS = "http://schemas.xmlsoap.org/soap/envelope/"
+	soapEncodingNS = "http://schemas.xmlsoap.org/soap/encoding/"
+	controlNS      = "urn:schemas-upnp-org:control-1-0"
+)
+
+// Error 操作失败时返回给控制端的 UPnP 错误
+type Error struct {
+	Code int
+	Desc string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("upnp error %d: %s", e.Code, e.Desc)
+}
+
+var errInvalidArgs = &Error{Code: 402, Desc: "Invalid Args"}
+
+type soapEnvelope struct {
+	Body struct {
+		Action soapAction `xml:",any"`
+	} `xml:"Body"`
+}
+
+type soapAction struct {
+	XMLName xml.Name
+	Args    []soapArg `xml:",any"`
+}
+
+type soapArg struct {
+	XMLName xml.Name
+	Value   string `xml:",chardata"`
+}
+
+// 解析请求中的操作名和参数
+func parseSoap(body []byte) (string, map[string]string, error) {
+	var env soapEnvelope
+	if err := xml.Unmarshal(body, &env); err != nil {
+		return "", nil, err
+	}
+	args := make(map[string]string, len(env.Body.Action.Args))
+	for _, a := range env.Body.Action.Args {
+		args[a.XMLName.Local] = a.Value
+	}
+	return env.Body.Action.XMLName.Local, args, nil
+}
+
+// SOAPACTION 头中的服务类型和操作名，例如 "urn:schemas-upnp-org:service:AVTransport:1#Play"
+func parseSoapAction(header string) (string, string) {
+	header = strings.Trim(strings.TrimSpace(header), `"`)
+	i := strings.LastIndexByte(header, '#')
+	if i < 0 {
+		return "", ""
+	}
+	return header[:i], header[i+1:]
+}
+
+func parseBool(s string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "1", "true", "yes":
+		return true, nil
+	case "0", "false", "no":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid boolean %q", s)
+}
+
+// 按照参数名设置结构体的字段，控制端省略的参数保持零值
+func decodeArgs(v reflect.Value, args map[string]string) error {
+	for _, arg := range arguments(v.Type()) {
+		s, ok := args[arg.name]
+		if !ok {
+			continue
+		}
+		f := v.Field(arg.field)
+		switch f.Kind() {
+		case reflect.String:
+			f.SetString(s)
+		case reflect.Bool:
+			b, err := parseBool(s)
+			if err != nil {
+				return errInvalidArgs
+			}
+			f.SetBool(b)
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			i, err := strconv.ParseInt(strings.TrimSpace(s), 10, f.Type().Bits())
+			if err != nil {
+				return errInvalidArgs
+			}
+			f.SetInt(i)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			i, err := strconv.ParseUint(strings.TrimSpace(s), 10, f.Type().Bits())
+			if err != nil {
+				return errInvalidArgs
+			}
+			f.SetUint(i)
+		default:
+			return fmt.Errorf("unsupported argument %s", arg.name)
+		}
+	}
+	return nil
+}
+
+func formatArg(f reflect.Value) string {
+	switch f.Kind() {
+	case reflect.String:
+		return f.String()
+	case reflect.Bool:
+		if f.Bool() {
+			return "1"
+		}
+		return "0"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(f.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(f.Uint(), 10)
+	}
+	return ""
+}
+
+func writeEnvelope(b *bytes.Buffer, body func()) {
+	b.WriteString(`<?xml version="1.0" encoding="utf-8"?>` + "\n")
+	b.WriteString(`<s:Envelope xmlns:s="` + soapEnvelopeNS + `" s:encodingStyle="` + soapEncodingNS + `"><s:Body>`)
+	body()
+	b.WriteString(`</s:Body></s:Envelope>`)
+}
+
+// 操作的返回值，按照字段的顺序输出
+func writeResponse(b *bytes.Buffer, serviceType string, action string, out reflect.Value) {
+	writeEnvelope(b, func() {
+		b.WriteString(`<u:` + action + `Response xmlns:u="` + serviceType + `">`)
+		if out.IsValid() {
+			for _, arg := range arguments(out.Type()) {
+				b.WriteString("<" + arg.name + ">")
+				xml.EscapeText(b, []byte(formatArg(out.Field(arg.field))))
+				b.WriteString("</" + arg.name + ">")
+			}
+		}
+		b.WriteString(`</u:` + action + `Response>`)
+	})
+}
+
+func writeFault(b *bytes.Buffer, e *Error) {
+	writeEnvelope(b, func() {
+		b.WriteString(`<s:Fault><faultcode>s:Client</faultcode><faultstring>UPnPError</faultstring><detail>`)
+		b.WriteString(`<UPnPError xmlns="` + controlNS + `"><errorCode>` + strconv.Itoa(e.Code) + `</errorCode><errorDescription>`)
+		xml.EscapeText(b, []byte(e.Desc))
+		b.WriteString(`</errorDescription></UPnPError></detail></s:Fault>`)
+	})
+}
@@ -0,0 +1,88 @@
+package upnp
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testArgIn struct {
+	InstanceID uint32 `upnp:"A_ARG_TYPE_InstanceID"`
+	Channel    string
+	Mute       bool
+	Offset     int32
+}
+
+type testArgOut struct {
+	Name  string
+	Mute  bool
+	Count uint16
+}
+
+func TestSoap(t *testing.T) {
+	t.Run("parse", func(t *testing.T) {
+		name, args, err := parseSoap([]byte(`<?xml version="1.0"?>
+<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/">
+<s:Body><u:SetMute xmlns:u="urn:schemas-upnp-org:service:RenderingControl:1">
+<InstanceID>0</InstanceID><Channel>Master</Channel><DesiredMute>1</DesiredMute>
+</u:SetMute></s:Body></s:Envelope>`))
+		assert.Nil(t, err)
+		assert.Equal(t, "SetMute", name)
+		assert.Equal(t, map[string]string{"InstanceID": "0", "Channel": "Master", "DesiredMute": "1"}, args)
+
+		_, _, err = parseSoap([]byte(`<s:Envelope`))
+		assert.NotNil(t, err)
+	})
+
+	t.Run("action header", func(t *testing.T) {
+		typ, name := parseSoapAction(`"urn:schemas-upnp-org:service:AVTransport:1#Play"`)
+		assert.Equal(t, "urn:schemas-upnp-org:service:AVTransport:1", typ)
+		assert.Equal(t, "Play", name)
+
+		typ, name = parseSoapAction("")
+		assert.Equal(t, "", typ)
+		assert.Equal(t, "", name)
+	})
+
+	t.Run("decode", func(t *testing.T) {
+		var in testArgIn
+		err := decodeArgs(reflect.ValueOf(&in).Elem(), map[string]string{
+			"InstanceID": "3", "Channel": "Master", "Mute": "true", "Offset": "-5", "Unknown": "x",
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, testArgIn{InstanceID: 3, Channel: "Master", Mute: true, Offset: -5}, in)
+
+		// 省略的参数为零值
+		in = testArgIn{}
+		assert.Nil(t, decodeArgs(reflect.ValueOf(&in).Elem(), map[string]string{"Mute": "0"}))
+		assert.Equal(t, testArgIn{}, in)
+
+		assert.Equal(t, errInvalidArgs, decodeArgs(reflect.ValueOf(&in).Elem(), map[string]string{"InstanceID": "-1"}))
+		assert.Equal(t, errInvalidArgs, decodeArgs(reflect.ValueOf(&in).Elem(), map[string]string{"Mute": "on"}))
+		assert.Equal(t, errInvalidArgs, decodeArgs(reflect.ValueOf(&in).Elem(), map[string]string{"Offset": "4294967296"}))
+	})
+
+	t.Run("response", func(t *testing.T) {
+		var b bytes.Buffer
+		writeResponse(&b, "urn:test:1", "Get", reflect.ValueOf(testArgOut{Name: "a<b", Mute: true, Count: 7}))
+		assert.Equal(t, `<?xml version="1.0" encoding="utf-8"?>`+"\n"+
+			`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/"><s:Body>`+
+			`<u:GetResponse xmlns:u="urn:test:1"><Name>a&lt;b</Name><Mute>1</Mute><Count>7</Count></u:GetResponse>`+
+			`</s:Body></s:Envelope>`, b.String())
+
+		// 返回值可以被解析
+		name, args, err := parseSoap(b.Bytes())
+		assert.Nil(t, err)
+		assert.Equal(t, "GetResponse", name)
+		assert.Equal(t, map[string]string{"Name": "a<b", "Mute": "1", "Count": "7"}, args)
+	})
+
+	t.Run("fault", func(t *testing.T) {
+		var b bytes.Buffer
+		writeFault(&b, &Error{Code: 718, Desc: "Invalid InstanceID"})
+		assert.Contains(t, b.String(), `<s:Fault><faultcode>s:Client</faultcode><faultstring>UPnPError</faultstring><detail>`+
+			`<UPnPError xmlns="urn:schemas-upnp-org:control-1-0"><errorCode>718</errorCode><errorDescription>Invalid InstanceID</errorDescription></UPnPError>`)
+	})
+}
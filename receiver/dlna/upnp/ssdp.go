@@ -0,0 +1,229 @@
+package upnp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zwcway/castserver-go/common/utils"
+)
+
+const (
+	ssdpMaxAge   = 1800
+	ssdpAlive    = "ssdp:alive"
+	ssdpByeBye   = "ssdp:byebye"
+	ssdpAll      = "ssdp:all"
+	ssdpRoot     = "upnp:rootdevice"
+	ssdpMaxDelay = 5 // M-SEARCH 中 MX 的最大值
+)
+
+var ssdpGroup = &net.UDPAddr{IP: net.IPv4(239, 255, 255, 250), Port: 1900}
+
+// ssdpTarget 设备的一个通知类型
+type ssdpTarget struct {
+	uuid string
+	nt   string
+	usn  string
+}
+
+// 根设备、设备本身、设备类型和每个服务各一个
+func (s *DeviceServer) targets(d *device) []ssdpTarget {
+	udn := "uuid:" + d.uuid
+	list := []ssdpTarget{
+		{d.uuid, ssdpRoot, udn + "::" + ssdpRoot},
+		{d.uuid, udn, udn},
+		{d.uuid, string(s.DeviceType), udn + "::" + string(s.DeviceType)},
+	}
+	for _, c := range s.ServiceList {
+		list = append(list, ssdpTarget{d.uuid, c.Service.Type(), udn + "::" + c.Service.Type()})
+	}
+	return list
+}
+
+// 与搜索目标匹配的通知类型
+func (s *DeviceServer) search(st string) []ssdpTarget {
+	s.locker.Lock()
+	defer s.locker.Unlock()
+
+	list := []ssdpTarget{}
+	for _, d := range s.devices {
+		for _, t := range s.targets(d) {
+			if st == ssdpAll || st == t.nt {
+				list = append(list, t)
+			}
+		}
+	}
+	return list
+}
+
+// 解析 M-SEARCH 请求，其它设备的 NOTIFY 返回空的搜索目标
+func parseMSearch(b []byte) (st string, mx int, err error) {
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(b)))
+	if err != nil {
+		return "", 0, err
+	}
+	switch req.Method {
+	case "NOTIFY":
+		return "", 0, nil
+	case "M-SEARCH":
+	default:
+		return "", 0, fmt.Errorf("unknown method %s", req.Method)
+	}
+	if req.Header.Get("MAN") != `"ssdp:discover"` {
+		return "", 0, errors.New("invalid MAN header")
+	}
+	st = req.Header.Get("ST")
+	if st == "" {
+		return "", 0, errors.New("missing ST header")
+	}
+	mx, err = strconv.Atoi(req.Header.Get("MX"))
+	if err != nil || mx < 1 {
+		mx = 1
+	}
+	if mx > ssdpMaxDelay {
+		mx = ssdpMaxDelay
+	}
+	return st, mx, nil
+}
+
+func (s *DeviceServer) serveSSDP() {
+	buf := make([]byte, 2048)
+	for {
+		n, src, err := s.ssdp.ReadFromUDP(buf)
+		if err != nil {
+			if !utils.IsConnectCloseError(err) {
+				s.onError(err)
+			}
+			return
+		}
+		if !s.allowed(src.IP) {
+			s.onError(&IPDenyError{IP: src.IP})
+			continue
+		}
+		st, mx, err := parseMSearch(buf[:n])
+		if err != nil {
+			s.onError(&RequestError{From: src, Err: err})
+			continue
+		}
+		if st == "" {
+			continue
+		}
+		targets := s.search(st)
+		if len(targets) == 0 {
+			continue
+		}
+		// 在 MX 秒内随机延迟回复，避免同时回复
+		delay := time.Duration(rand.Int63n(int64(mx) * int64(time.Second)))
+		time.AfterFunc(delay, func() { s.reply(src, targets) })
+	}
+}
+
+func (s *DeviceServer) writeHeaders(b *strings.Builder, headers ...string) {
+	for i := 0; i+1 < len(headers); i += 2 {
+		b.WriteString(headers[i] + ": " + headers[i+1] + "\r\n")
+	}
+	b.WriteString("\r\n")
+}
+
+// 单播回复搜索，LOCATION 使用与请求方通讯的本机地址
+func (s *DeviceServer) reply(dst *net.UDPAddr, targets []ssdpTarget) {
+	conn, err := net.DialUDP("udp4", nil, dst)
+	if err != nil {
+		s.onError(err)
+		return
+	}
+	defer conn.Close()
+
+	local := conn.LocalAddr().(*net.UDPAddr).IP
+	for _, t := range targets {
+		var b strings.Builder
+		b.WriteString("HTTP/1.1 200 OK\r\n")
+		s.writeHeaders(&b,
+			"CACHE-CONTROL", "max-age="+strconv.Itoa(ssdpMaxAge),
+			"DATE", time.Now().UTC().Format(http.TimeFormat),
+			"EXT", "",
+			"LOCATION", s.location(local, t.uuid),
+			"SERVER", s.serverHeader(),
+			"ST", t.nt,
+			"USN", t.usn,
+		)
+		if _, err = conn.Write([]byte(b.String())); err != nil {
+			s.onError(err)
+			return
+		}
+	}
+}
+
+// 广播设备上线或者下线
+func (s *DeviceServer) notify(d *device, nts string) {
+	if s.ssdp == nil {
+		return
+	}
+	for _, t := range s.targets(d) {
+		var b strings.Builder
+		b.WriteString("NOTIFY * HTTP/1.1\r\n")
+		if nts == ssdpAlive {
+			s.writeHeaders(&b,
+				"HOST", ssdpGroup.String(),
+				"CACHE-CONTROL", "max-age="+strconv.Itoa(ssdpMaxAge),
+				"LOCATION", s.location(s.ip, t.uuid),
+				"NT", t.nt,
+				"NTS", nts,
+				"SERVER", s.serverHeader(),
+				"USN", t.usn,
+			)
+		} else {
+			s.writeHeaders(&b,
+				"HOST", ssdpGroup.String(),
+				"NT", t.nt,
+				"NTS", nts,
+				"USN", t.usn,
+			)
+		}
+		if _, err := s.ssdp.WriteToUDP([]byte(b.String()), ssdpGroup); err != nil {
+			if !utils.IsConnectCloseError(err) {
+				s.onError(err)
+			}
+			return
+		}
+	}
+}
+
+// 定时广播所有设备，同时清理过期的订阅
+func (s *DeviceServer) aliveRoutine() {
+	interval := s.NotifyInterval
+	if interval <= 0 {
+		interval = defaultNotifyInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.locker.Lock()
+		devices := make([]*device, 0, len(s.devices))
+		for _, d := range s.devices {
+			devices = append(devices, d)
+		}
+		s.locker.Unlock()
+
+		for _, d := range devices {
+			s.notify(d, ssdpAlive)
+		}
+		s.expireSubscriptions()
+
+		select {
+		case <-s.done:
+			return
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
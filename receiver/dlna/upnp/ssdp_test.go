@@ -0,0 +1,57 @@
+package upnp
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSSDP(t *testing.T) {
+	t.Run("m-search", func(t *testing.T) {
+		st, mx, err := parseMSearch([]byte("M-SEARCH * HTTP/1.1\r\nHOST: 239.255.255.250:1900\r\nMAN: \"ssdp:discover\"\r\nMX: 3\r\nST: ssdp:all\r\n\r\n"))
+		assert.Nil(t, err)
+		assert.Equal(t, "ssdp:all", st)
+		assert.Equal(t, 3, mx)
+
+		// MX 超出范围
+		_, mx, err = parseMSearch([]byte("M-SEARCH * HTTP/1.1\r\nMAN: \"ssdp:discover\"\r\nMX: 120\r\nST: upnp:rootdevice\r\n\r\n"))
+		assert.Nil(t, err)
+		assert.Equal(t, ssdpMaxDelay, mx)
+		_, mx, err = parseMSearch([]byte("M-SEARCH * HTTP/1.1\r\nMAN: \"ssdp:discover\"\r\nST: upnp:rootdevice\r\n\r\n"))
+		assert.Nil(t, err)
+		assert.Equal(t, 1, mx)
+
+		st, _, err = parseMSearch([]byte("NOTIFY * HTTP/1.1\r\nNT: upnp:rootdevice\r\nNTS: ssdp:alive\r\n\r\n"))
+		assert.Nil(t, err)
+		assert.Equal(t, "", st)
+
+		_, _, err = parseMSearch([]byte("M-SEARCH * HTTP/1.1\r\nMX: 1\r\nST: ssdp:all\r\n\r\n"))
+		assert.NotNil(t, err)
+		_, _, err = parseMSearch([]byte("M-SEARCH * HTTP/1.1\r\nMAN: \"ssdp:discover\"\r\nMX: 1\r\n\r\n"))
+		assert.NotNil(t, err)
+		_, _, err = parseMSearch([]byte("GET / HTTP/1.1\r\n\r\n"))
+		assert.NotNil(t, err)
+	})
+
+	t.Run("search", func(t *testing.T) {
+		s := newTestServer(t)
+		s.AddServer("one", "u1")
+
+		assert.Len(t, s.search(ssdpAll), 4)
+		assert.Equal(t, []ssdpTarget{{"u1", ssdpRoot, "uuid:u1::upnp:rootdevice"}}, s.search(ssdpRoot))
+		assert.Equal(t, []ssdpTarget{{"u1", "uuid:u1", "uuid:u1"}}, s.search("uuid:u1"))
+		assert.Equal(t, []ssdpTarget{{"u1", string(DeviceType_MediaRenderer), "uuid:u1::" + string(DeviceType_MediaRenderer)}}, s.search(string(DeviceType_MediaRenderer)))
+		assert.Equal(t, []ssdpTarget{{"u1", "urn:schemas-upnp-org:service:Test:1", "uuid:u1::urn:schemas-upnp-org:service:Test:1"}}, s.search("urn:schemas-upnp-org:service:Test:1"))
+		assert.Len(t, s.search("urn:schemas-upnp-org:service:Other:1"), 0)
+
+		s.DelServer("u1")
+		assert.Len(t, s.search(ssdpAll), 0)
+	})
+
+	t.Run("location", func(t *testing.T) {
+		s := &DeviceServer{ListenPort: 4415}
+		assert.Equal(t, "http://192.168.1.2:4415/u1/description.xml", s.location(net.IPv4(192, 168, 1, 2), "u1"))
+		assert.Equal(t, "http://0.0.0.0:4415/u1/description.xml", s.location(nil, "u1"))
+	})
+}
@@ -3,6 +3,7 @@ package receiver
 import (
 	lg "github.com/zwcway/castserver-go/common/log"
 	"github.com/zwcway/castserver-go/common/utils"
+	"github.com/zwcway/castserver-go/receiver/airplay"
 	"github.com/zwcway/castserver-go/receiver/dlna"
 )
 
@@ -11,7 +12,10 @@ var (
 	log    lg.Logger
 	Module receiveModel
 
-	dlnaInstance *dlna.DLNAServer
+	dlnaInstance  *dlna.DLNAServer
+	mediaInstance *dlna.DLNAServer
+
+	airplayInstance *airplay.AirPlayServer
 )
 
 type receiveModel struct {
@@ -22,7 +26,10 @@ func (receiveModel) Init(uctx utils.Context) error {
 	log = ctx.Logger("receiver")
 
 	err := initDlna()
-	return err
+	if err != nil {
+		return err
+	}
+	return initAirPlay()
 }
 
 func (receiveModel) Start() error {
@@ -31,4 +38,6 @@ func (receiveModel) Start() error {
 
 func (receiveModel) DeInit() {
 	dlnaInstance.Close()
+	mediaInstance.Close()
+	airplayInstance.Close()
 }
@@ -0,0 +1,209 @@
+package scheduler
+
+import (
+	"sync"
+	"time"
+
+	"github.com/zwcway/castserver-go/common/config"
+	lg "github.com/zwcway/castserver-go/common/log"
+	"github.com/zwcway/castserver-go/common/schedule"
+	"github.com/zwcway/castserver-go/common/speaker"
+	"github.com/zwcway/castserver-go/common/stream"
+	"github.com/zwcway/castserver-go/decoder"
+)
+
+// 提示音的最大时长
+const chimeMaxDuration = 60 * time.Second
+
+func runJob(j *schedule.Job) {
+	line := speaker.FindLineByID(j.LineID)
+	if line == nil {
+		log.Warn("job line not exists", lg.String("job", j.String()), lg.Uint("line", uint64(j.LineID)))
+		return
+	}
+	log.Info("run job", lg.String("job", j.String()), lg.String("line", line.String()), lg.Uint("action", uint64(j.Action)))
+
+	var err error
+	switch j.Action {
+	case schedule.JobChime:
+		err = chime(line, j.Url, j.Volume)
+	case schedule.JobAlarm:
+		err = alarm(line, j.Url, j.Volume, j.Ramp)
+	case schedule.JobSleep:
+		sleep(line, j.Ramp)
+	case schedule.JobVolume:
+		rampVolume(line, j.Volume, j.Ramp)
+	case schedule.JobPower:
+		if j.Power {
+			wakeUp(line)
+		} else {
+			sleep(line, j.Ramp)
+		}
+	}
+	if err != nil {
+		log.Error("run job failed", lg.String("job", j.String()), lg.Error(err))
+	}
+}
+
+// 播放提示音，期间压低线路的声音
+func chime(line *speaker.Line, url string, vol uint8) error {
+	clip, err := decoder.DecodeClip(url, chimeMaxDuration)
+	if err != nil {
+		return err
+	}
+	line.Input.AnnouncerEle.Announce(stream.Announcement{
+		Clip:   clip,
+		Volume: float64(vol) / 100,
+		Duck:   config.AnnounceDuck,
+	})
+	return nil
+}
+
+// 从静音开始播放，在 ramp 时长内渐变至 vol。
+// 闹钟的音量只作用于音量元，不保存为线路的音量，闹钟结束后恢复
+func alarm(line *speaker.Line, url string, vol uint8, ramp time.Duration) error {
+	ve := line.Input.VolumeEle
+	ve.SetVolumeRamp(0, 0)
+
+	fs, err := decoder.OpenFile(line, url)
+	if err != nil {
+		restoreVolume(line)
+		return err
+	}
+	startAlarm(line, fs)
+	fs.SetPause(false)
+
+	// 取消静音也使用 ramp 过渡
+	ve.SetMuteRamp(false, ramp)
+	ve.SetVolumeRamp(float64(vol)/100, ramp)
+	return nil
+}
+
+func rampVolume(line *speaker.Line, vol uint8, ramp time.Duration) {
+	line.SetVolumeRamp(vol, line.Mute, ramp)
+}
+
+// 在 fade 时长内淡出后暂停，其它输入无法暂停时静音
+func sleep(line *speaker.Line, fade time.Duration) {
+	fs := line.Input.FileStreamer()
+	if fs == nil || !fs.IsPlaying() {
+		line.SetVolumeRamp(line.Volume, true, fade)
+		return
+	}
+
+	// 只淡出文件，唤醒时取消
+	cancel := startSleep(line)
+	defer stopSleep(line, cancel)
+
+	done := line.Input.MixerEle.FadeSource(fs, false, fade)
+	select {
+	case <-cancel:
+		return
+	case <-done:
+	case <-time.After(fade + sleepFadeTimeout):
+		// 管道没有运行时不会完成淡出
+	}
+	select {
+	case <-cancel:
+		return
+	default:
+	}
+	if fs == line.Input.FileStreamer() && fs.IsPlaying() {
+		fs.SetPause(true)
+	}
+}
+
+// 恢复播放并取消静音
+func wakeUp(line *speaker.Line) {
+	cancelSleep(line)
+
+	if fs := line.Input.FileStreamer(); fs != nil && !fs.IsFinished() {
+		if fs.IsPaused() {
+			fs.SetPause(false)
+		} else {
+			// 正在淡出
+			line.Input.MixerEle.FadeSource(fs, true, config.VolumeFadeDuration)
+		}
+	}
+	if line.Mute {
+		line.SetVolume(line.Volume, false)
+	}
+}
+
+// 等待淡出的额外时长
+const sleepFadeTimeout = 100 * time.Millisecond
+
+var (
+	// 线路正在播放的闹钟
+	alarms = make(map[*speaker.Line]stream.SourceStreamer)
+	// 线路正在淡出的睡眠，关闭通道时取消
+	sleeps      = make(map[*speaker.Line]chan struct{})
+	stateLocker sync.Mutex
+)
+
+func startAlarm(line *speaker.Line, ss stream.SourceStreamer) {
+	stateLocker.Lock()
+	defer stateLocker.Unlock()
+
+	alarms[line] = ss
+}
+
+// 恢复线路保存的音量和静音
+func restoreVolume(line *speaker.Line) {
+	line.SetVolume(line.Volume, line.Mute)
+}
+
+// 闹钟播放结束，或者线路切换至其它输入
+func stopAlarm(line *speaker.Line, ss stream.SourceStreamer, finished bool) {
+	stateLocker.Lock()
+	cur, ok := alarms[line]
+	if !ok || (cur == ss) != finished {
+		stateLocker.Unlock()
+		return
+	}
+	delete(alarms, line)
+	stateLocker.Unlock()
+
+	restoreVolume(line)
+}
+
+func onLineInputFinished(line *speaker.Line, ss stream.SourceStreamer) error {
+	stopAlarm(line, ss, true)
+	return nil
+}
+
+func onLineInputChanged(line *speaker.Line, ss stream.SourceStreamer) error {
+	stopAlarm(line, ss, false)
+	return nil
+}
+
+func startSleep(line *speaker.Line) chan struct{} {
+	stateLocker.Lock()
+	defer stateLocker.Unlock()
+
+	if c, ok := sleeps[line]; ok {
+		close(c)
+	}
+	c := make(chan struct{})
+	sleeps[line] = c
+	return c
+}
+
+func stopSleep(line *speaker.Line, c chan struct{}) {
+	stateLocker.Lock()
+	defer stateLocker.Unlock()
+
+	if sleeps[line] == c {
+		delete(sleeps, line)
+	}
+}
+
+func cancelSleep(line *speaker.Line) {
+	stateLocker.Lock()
+	defer stateLocker.Unlock()
+
+	if c, ok := sleeps[line]; ok {
+		close(c)
+		delete(sleeps, line)
+	}
+}
@@ -0,0 +1,40 @@
+package scheduler
+
+import (
+	lg "github.com/zwcway/castserver-go/common/log"
+	"github.com/zwcway/castserver-go/common/speaker"
+	"github.com/zwcway/castserver-go/common/utils"
+)
+
+var (
+	ctx utils.Context
+	log lg.Logger
+)
+
+type schedulerModule struct{}
+
+var Module = schedulerModule{}
+
+func (schedulerModule) Init(c utils.Context) error {
+	ctx = c
+	log = ctx.Logger("scheduler")
+
+	speaker.BusLineDeleted.Register(func(src *speaker.Line, dst *speaker.Line) error {
+		deleteLineJobs(src.ID)
+		return nil
+	})
+	speaker.BusLineInputFinished.Register(onLineInputFinished).ASync()
+	speaker.BusLineInputChanged.Register(onLineInputChanged).ASync()
+	return nil
+}
+
+func (schedulerModule) Start() error {
+	loadJobs()
+
+	go scheduleRoutine(ctx)
+	return nil
+}
+
+func (schedulerModule) DeInit() {
+
+}
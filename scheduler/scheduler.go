@@ -0,0 +1,257 @@
+package scheduler
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/zwcway/castserver-go/common/config"
+	lg "github.com/zwcway/castserver-go/common/log"
+	"github.com/zwcway/castserver-go/common/schedule"
+	"github.com/zwcway/castserver-go/common/speaker"
+	"github.com/zwcway/castserver-go/common/utils"
+)
+
+type entry struct {
+	job  *schedule.Job
+	next time.Time // 下一次执行时间，零值表示不执行
+}
+
+var (
+	entries []*entry
+	locker  sync.Mutex
+	wake    = make(chan struct{}, 1)
+)
+
+// 重新计算最近的执行时间
+func notify() {
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
+
+func (e *entry) reschedule(from time.Time) {
+	e.next = time.Time{}
+	if e.job.Enabled {
+		e.next = e.job.Next(from)
+	}
+}
+
+// 读取保存的任务，补执行错过的任务
+func loadJobs() {
+	var (
+		jobs = []*schedule.Job{}
+		now  = time.Now()
+	)
+	if err := schedule.BusGetJobs.Dispatch(&jobs); err != nil {
+		log.Error("load jobs failed", lg.Error(err))
+	}
+
+	locker.Lock()
+	defer locker.Unlock()
+
+	for _, j := range jobs {
+		if err := j.Check(); err != nil {
+			log.Warn("job invalid", lg.String("job", j.String()), lg.Error(err))
+			j.Enabled = false
+		}
+		e := &entry{job: j}
+		entries = append(entries, e)
+		if !j.Enabled {
+			continue
+		}
+
+		if t := j.MissedRun(now, config.ScheduleMissedGrace); !t.IsZero() {
+			log.Info("run missed job", lg.String("job", j.String()), lg.Time("time", t))
+			e.next = now
+			continue
+		}
+		e.reschedule(now)
+		if e.next.IsZero() && j.IsOnce() {
+			// 已经错过且不需要补执行
+			j.Enabled = false
+			schedule.BusJobEdited.Dispatch(j, "enabled", false)
+		}
+	}
+}
+
+func scheduleRoutine(ctx utils.Context) {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(runDue(time.Now()))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-wake:
+		case <-timer.C:
+		}
+	}
+}
+
+// 执行到期的任务，返回距离下一次执行的时长
+func runDue(now time.Time) time.Duration {
+	locker.Lock()
+	defer locker.Unlock()
+
+	var next time.Time
+	for _, e := range entries {
+		if e.next.IsZero() {
+			continue
+		}
+		if !e.next.After(now) {
+			run(e.job, now)
+			e.reschedule(now)
+			if e.job.IsOnce() {
+				e.job.Enabled = false
+				schedule.BusJobEdited.Dispatch(e.job, "enabled", false)
+			}
+		}
+		if !e.next.IsZero() && (next.IsZero() || e.next.Before(next)) {
+			next = e.next
+		}
+	}
+
+	if next.IsZero() {
+		// 没有任务时定期检查
+		return time.Hour
+	}
+	return next.Sub(now)
+}
+
+func run(j *schedule.Job, now time.Time) {
+	j.LastRun = now
+	schedule.BusJobEdited.Dispatch(j, "last_run", now)
+
+	// 淡入淡出需要等待，不阻塞其它任务
+	job := *j
+	go runJob(&job)
+}
+
+// Jobs 返回线路任务的副本，line 为 0 时返回所有任务
+func Jobs(line speaker.LineID) []*schedule.Job {
+	locker.Lock()
+	defer locker.Unlock()
+
+	jobs := []*schedule.Job{}
+	for _, e := range entries {
+		if line == 0 || e.job.LineID == line {
+			j := *e.job
+			jobs = append(jobs, &j)
+		}
+	}
+	return jobs
+}
+
+// FindJob 返回任务的副本
+func FindJob(id schedule.JobID) *schedule.Job {
+	locker.Lock()
+	defer locker.Unlock()
+
+	if e := findEntry(id); e != nil {
+		j := *e.job
+		return &j
+	}
+	return nil
+}
+
+func findEntry(id schedule.JobID) *entry {
+	for _, e := range entries {
+		if e.job.ID == id {
+			return e
+		}
+	}
+	return nil
+}
+
+// SaveJob 添加或者修改任务，ID 为 0 时添加
+func SaveJob(j *schedule.Job) error {
+	if err := j.Check(); err != nil {
+		return err
+	}
+	if speaker.FindLineByID(j.LineID) == nil {
+		return &speaker.UnknownLineError{Line: uint8(j.LineID)}
+	}
+
+	locker.Lock()
+	defer locker.Unlock()
+
+	var (
+		nj    = *j
+		e     = &entry{}
+		isNew = j.ID == 0
+	)
+	if !isNew {
+		if e = findEntry(j.ID); e == nil {
+			return fmt.Errorf("job %d not exists", j.ID)
+		}
+		nj.LastRun = e.job.LastRun
+		nj.CreatedAt = e.job.CreatedAt
+	}
+
+	if err := schedule.BusSaveJob.Dispatch(&nj); err != nil {
+		return err
+	}
+	// 替换指针，不修改之前返回的副本
+	e.job = &nj
+	if isNew {
+		entries = append(entries, e)
+	}
+	*j = nj
+
+	e.reschedule(time.Now())
+	notify()
+	return nil
+}
+
+func DeleteJob(id schedule.JobID) error {
+	locker.Lock()
+	defer locker.Unlock()
+
+	for i, e := range entries {
+		if e.job.ID == id {
+			entries = append(entries[:i], entries[i+1:]...)
+			schedule.BusJobDeleted.Dispatch(e.job)
+			notify()
+			return nil
+		}
+	}
+	return fmt.Errorf("job %d not exists", id)
+}
+
+// SleepTimer 在 d 之后淡出并停止播放，替换线路原有的睡眠定时，d 为 0 时取消
+func SleepTimer(line speaker.LineID, d time.Duration, fade time.Duration) (*schedule.Job, error) {
+	for _, j := range Jobs(line) {
+		if j.Action == schedule.JobSleep && j.IsOnce() {
+			DeleteJob(j.ID)
+		}
+	}
+	if d <= 0 {
+		return nil, nil
+	}
+
+	j := &schedule.Job{
+		LineID:  line,
+		Name:    "sleep",
+		At:      time.Now().Add(d),
+		Action:  schedule.JobSleep,
+		Ramp:    fade,
+		Enabled: true,
+	}
+	return j, SaveJob(j)
+}
+
+func deleteLineJobs(line speaker.LineID) {
+	for _, j := range Jobs(line) {
+		DeleteJob(j.ID)
+	}
+}
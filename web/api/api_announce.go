@@ -0,0 +1,209 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/zwcway/castserver-go/common/audio"
+	"github.com/zwcway/castserver-go/common/config"
+	"github.com/zwcway/castserver-go/common/element"
+	lg "github.com/zwcway/castserver-go/common/log"
+	"github.com/zwcway/castserver-go/common/sounds"
+	"github.com/zwcway/castserver-go/common/speaker"
+	"github.com/zwcway/castserver-go/common/stream"
+	"github.com/zwcway/castserver-go/decoder"
+	"github.com/zwcway/castserver-go/web/websockets"
+)
+
+// 播报的最大时长
+const announceMaxDuration = 60 * time.Second
+
+type requestAnnounce struct {
+	Lines    []uint8  `jp:"lines,omitempty"`
+	Speakers []uint32 `jp:"sps,omitempty"`
+	All      bool     `jp:"all,omitempty"` // 所有线路
+
+	Url  string `jp:"url,omitempty"`  // config.AnnounceDir 中的相对路径
+	Data []byte `jp:"data,omitempty"` // WAV、MP3 或者交错排列的 PCM 数据
+
+	// PCM 数据的格式
+	Rate     int `jp:"rate,omitempty"`
+	Bits     int `jp:"bits,omitempty"`
+	Channels int `jp:"chs,omitempty"`
+
+	Volume *uint8   `jp:"vol,omitempty"`  // 0 至 100
+	Duck   *float64 `jp:"duck,omitempty"` // 压低的 dB
+}
+
+type requestAnnounceStop struct {
+	Lines    []uint8  `jp:"lines,omitempty"`
+	Speakers []uint32 `jp:"sps,omitempty"`
+	All      bool     `jp:"all,omitempty"`
+}
+
+// 播报文件只能在 config.AnnounceDir 之中，不能使用绝对路径和 ..。
+// 也不能包含 :，避免被 ffmpeg 当作协议打开
+func announcePath(file string) (string, error) {
+	if config.AnnounceDir == "" {
+		return "", errors.New("announce dir not configured")
+	}
+	if !filepath.IsLocal(file) || strings.ContainsRune(file, ':') {
+		return "", fmt.Errorf("announce file %q invalid", file)
+	}
+	return filepath.Join(config.AnnounceDir, file), nil
+}
+
+// 读取播报的音频，其它格式交由 ffmpeg 解码
+func announceClip(p *requestAnnounce) (*stream.Samples, error) {
+	if len(p.Url) > 0 {
+		file, err := announcePath(p.Url)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.DecodeClip(file, announceMaxDuration)
+	}
+	if len(p.Data) == 0 {
+		return nil, fmt.Errorf("announcement is empty")
+	}
+
+	var (
+		format audio.Format
+		pcm    []byte
+		err    error
+	)
+	switch {
+	case p.Rate > 0 || p.Bits > 0 || p.Channels > 0:
+		format.Rate = audio.NewAudioRate(p.Rate)
+		format.Bits = audio.NewAudioBits(p.Bits)
+		if format.Layout, err = sounds.LayoutFromCount(p.Channels); err != nil {
+			return nil, err
+		}
+		if !format.IsValid() {
+			return nil, fmt.Errorf("pcm format invalid: %s", format.String())
+		}
+		pcm = sounds.Deinterleave(p.Data, format)
+	case sounds.IsWAV(p.Data):
+		if format, pcm, err = sounds.ParseWAV(p.Data); err != nil {
+			return nil, err
+		}
+	default:
+		f, err := os.CreateTemp(config.ReceiveTempDir, "announce-*")
+		if err != nil {
+			return nil, err
+		}
+		defer os.Remove(f.Name())
+		_, err = f.Write(p.Data)
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+		return decoder.DecodeClip(f.Name(), announceMaxDuration)
+	}
+
+	if time.Duration(len(pcm)/format.Size())*time.Second/time.Duration(format.Rate.ToInt()) > announceMaxDuration {
+		return nil, fmt.Errorf("clip longer than %s", announceMaxDuration)
+	}
+	return stream.NewFromBytes(pcm, format), nil
+}
+
+func announceTargets(lines []uint8, sps []uint32, all bool) (eles []stream.AnnouncerElement, err error) {
+	if all {
+		for _, l := range speaker.LineList() {
+			eles = append(eles, l.Input.AnnouncerEle)
+		}
+		return
+	}
+	for _, id := range lines {
+		l := speaker.FindLineByID(speaker.LineID(id))
+		if l == nil {
+			return nil, &speaker.UnknownLineError{Line: id}
+		}
+		eles = append(eles, l.Input.AnnouncerEle)
+	}
+	for _, id := range sps {
+		sp := speaker.FindSpeakerByID(speaker.SpeakerID(id))
+		if sp == nil {
+			return nil, fmt.Errorf("speaker %d not exists", id)
+		}
+		eles = append(eles, sp.AnnouncerEle)
+	}
+	if len(eles) == 0 {
+		err = fmt.Errorf("announcement has no target")
+	}
+	return
+}
+
+func apiAnnounce(c *websockets.WSConnection, req Requester, log lg.Logger) (any, error) {
+	var p requestAnnounce
+	err := req.Unmarshal(&p)
+	if err != nil {
+		return nil, err
+	}
+
+	an := stream.Announcement{
+		Volume: float64(config.AnnounceVolume) / 100,
+		Duck:   config.AnnounceDuck,
+	}
+	if p.Volume != nil {
+		if *p.Volume > 100 {
+			return nil, fmt.Errorf("volume invalid")
+		}
+		an.Volume = float64(*p.Volume) / 100
+	}
+	if p.Duck != nil {
+		if *p.Duck < 0 || *p.Duck > 60 {
+			return nil, fmt.Errorf("duck invalid")
+		}
+		an.Duck = *p.Duck
+	}
+
+	eles, err := announceTargets(p.Lines, p.Speakers, p.All)
+	if err != nil {
+		return nil, err
+	}
+	clip, err := announceClip(&p)
+	if err != nil {
+		return nil, err
+	}
+
+	// 在请求的协程中转换，相同格式的目标共享同一份只读数据
+	clips := make(map[audio.Format]*stream.Samples)
+	for _, e := range eles {
+		an.Clip = clip
+		if f := e.Format(); f.IsValid() {
+			c, ok := clips[f]
+			if !ok {
+				if c, err = element.ConvertClip(clip, f); err != nil {
+					return nil, err
+				}
+				clips[f] = c
+			}
+			an.Clip = c
+		}
+		e.Announce(an)
+	}
+
+	return true, nil
+}
+
+func apiAnnounceStop(c *websockets.WSConnection, req Requester, log lg.Logger) (any, error) {
+	var p requestAnnounceStop
+	err := req.Unmarshal(&p)
+	if err != nil {
+		return nil, err
+	}
+
+	eles, err := announceTargets(p.Lines, p.Speakers, p.All)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range eles {
+		e.Clear()
+	}
+
+	return true, nil
+}
@@ -0,0 +1,205 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/zwcway/castserver-go/common/config"
+	"github.com/zwcway/castserver-go/common/library"
+	lg "github.com/zwcway/castserver-go/common/log"
+	"github.com/zwcway/castserver-go/indexer"
+	"github.com/zwcway/castserver-go/player"
+	"github.com/zwcway/castserver-go/web/websockets"
+)
+
+// 搜索结果的默认数量
+const librarySearchLimit = 200
+
+type responseLibraryStatus struct {
+	Dirs     []string `jp:"dirs"`
+	Tracks   int      `jp:"tracks"`
+	Scanning bool     `jp:"scanning"`
+	LastScan int64    `jp:"last,omitempty"` // unix 秒
+}
+
+type responseArtist struct {
+	Name   string `jp:"name"`
+	Albums int    `jp:"albums"`
+	Tracks int    `jp:"tracks"`
+}
+
+type responseAlbum struct {
+	Name     string `jp:"name"`
+	Artist   string `jp:"artist"`
+	Year     int    `jp:"year,omitempty"`
+	Tracks   int    `jp:"tracks"`
+	Duration int    `jp:"dur"`             // 秒
+	Cover    uint32 `jp:"cover,omitempty"` // 使用该曲目的封面
+}
+
+type responseFolder struct {
+	Path   string                      `jp:"path"`
+	Dirs   []string                    `jp:"dirs"`
+	Tracks []*websockets.ResponseTrack `jp:"tracks"`
+}
+
+type requestAlbums struct {
+	Artist *string `jp:"artist,omitempty"` // 不设置时返回所有专辑
+}
+
+type requestAlbum struct {
+	Artist string `jp:"artist"`
+	Album  string `jp:"album"`
+}
+
+type requestFolder struct {
+	Path string `jp:"path,omitempty"` // 为空时返回音乐库的目录
+}
+
+type requestSearch struct {
+	Query string `jp:"q"`
+	Limit int    `jp:"limit,omitempty"`
+}
+
+// 按照 ids、专辑或者目录添加至线路的队列
+type requestEnqueue struct {
+	Line   uint8    `jp:"line"`
+	IDs    []uint32 `jp:"ids,omitempty"`
+	Artist *string  `jp:"artist,omitempty"`
+	Album  *string  `jp:"album,omitempty"`
+	Folder string   `jp:"folder,omitempty"`
+	Pos    *int     `jp:"pos,omitempty"`  // 插入至 pos 之前，不设置时添加至最后
+	Play   bool     `jp:"play,omitempty"` // 添加后播放第一首
+}
+
+func apiLibraryStatus(c *websockets.WSConnection, req Requester, log lg.Logger) (any, error) {
+	count, scanning, last := indexer.Status()
+	r := &responseLibraryStatus{
+		Dirs:     config.LibraryDirs,
+		Tracks:   count,
+		Scanning: scanning,
+	}
+	if !last.IsZero() {
+		r.LastScan = last.Unix()
+	}
+	return r, nil
+}
+
+func apiLibraryScan(c *websockets.WSConnection, req Requester, log lg.Logger) (any, error) {
+	indexer.Rescan()
+	return true, nil
+}
+
+func apiLibraryArtists(c *websockets.WSConnection, req Requester, log lg.Logger) (any, error) {
+	artists := indexer.Artists()
+	list := make([]*responseArtist, len(artists))
+	for i, a := range artists {
+		list[i] = &responseArtist{
+			Name:   a.Name,
+			Albums: a.Albums,
+			Tracks: a.Tracks,
+		}
+	}
+	return list, nil
+}
+
+func apiLibraryAlbums(c *websockets.WSConnection, req Requester, log lg.Logger) (any, error) {
+	var p requestAlbums
+	err := req.Unmarshal(&p)
+	if err != nil {
+		return nil, err
+	}
+
+	albums := indexer.Albums(p.Artist)
+	list := make([]*responseAlbum, len(albums))
+	for i, a := range albums {
+		list[i] = &responseAlbum{
+			Name:     a.Name,
+			Artist:   a.Artist,
+			Year:     a.Year,
+			Tracks:   a.Tracks,
+			Duration: int(a.Duration.Seconds()),
+			Cover:    a.Cover,
+		}
+	}
+	return list, nil
+}
+
+func apiLibraryAlbum(c *websockets.WSConnection, req Requester, log lg.Logger) (any, error) {
+	var p requestAlbum
+	err := req.Unmarshal(&p)
+	if err != nil {
+		return nil, err
+	}
+
+	return websockets.NewResponseTracks(indexer.AlbumTracks(p.Artist, p.Album)), nil
+}
+
+func apiLibraryFolder(c *websockets.WSConnection, req Requester, log lg.Logger) (any, error) {
+	var p requestFolder
+	err := req.Unmarshal(&p)
+	if err != nil {
+		return nil, err
+	}
+
+	dirs, tracks, err := indexer.Folder(p.Path)
+	if err != nil {
+		return nil, err
+	}
+	return &responseFolder{
+		Path:   p.Path,
+		Dirs:   dirs,
+		Tracks: websockets.NewResponseTracks(tracks),
+	}, nil
+}
+
+func apiLibrarySearch(c *websockets.WSConnection, req Requester, log lg.Logger) (any, error) {
+	var p requestSearch
+	err := req.Unmarshal(&p)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.Limit <= 0 {
+		p.Limit = librarySearchLimit
+	}
+	return websockets.NewResponseTracks(indexer.Search(p.Query, p.Limit)), nil
+}
+
+func apiLibraryEnqueue(c *websockets.WSConnection, req Requester, log lg.Logger) (any, error) {
+	var p requestEnqueue
+	err := req.Unmarshal(&p)
+	if err != nil {
+		return nil, err
+	}
+	nl, err := queueLine(p.Line)
+	if err != nil {
+		return nil, err
+	}
+
+	var tracks []library.Track
+	switch {
+	case len(p.IDs) > 0:
+		tracks = indexer.Tracks(p.IDs...)
+	case p.Album != nil && p.Artist != nil:
+		tracks = indexer.AlbumTracks(*p.Artist, *p.Album)
+	case p.Folder != "":
+		if _, tracks, err = indexer.Folder(p.Folder); err != nil {
+			return nil, err
+		}
+	}
+	if len(tracks) == 0 {
+		return nil, fmt.Errorf("no track to enqueue")
+	}
+
+	pos := -1
+	if p.Pos != nil {
+		pos = *p.Pos
+	}
+	ids := player.AddItems(nl, indexer.QueueItems(tracks), pos)
+	if p.Play {
+		if err = player.Play(nl, ids[0]); err != nil {
+			return nil, err
+		}
+	}
+	return ids, nil
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/zwcway/castserver-go/common/audio"
+	"github.com/zwcway/castserver-go/common/dsp"
+	lg "github.com/zwcway/castserver-go/common/log"
+	"github.com/zwcway/castserver-go/common/speaker"
+	"github.com/zwcway/castserver-go/web/websockets"
+)
+
+type requestLineUpmix struct {
+	ID   uint8 `jp:"id"`
+	Mode uint8 `jp:"mode"` // 0 矩阵，1 环境声提取，2 不扩展
+}
+
+type requestLineRoute struct {
+	ID    uint8     `jp:"id"`
+	To    uint8     `jp:"to"`
+	From  []uint8   `jp:"from,omitempty"`  // 为空时删除该路由
+	Gains []float32 `jp:"gains,omitempty"` // 对应 from 的增益，缺省为 1
+}
+
+func apiLineSetUpmix(c *websockets.WSConnection, req Requester, log lg.Logger) (any, error) {
+	var p requestLineUpmix
+	err := req.Unmarshal(&p)
+	if err != nil {
+		return nil, err
+	}
+
+	nl := speaker.FindLineByID(speaker.LineID(p.ID))
+	if nl == nil {
+		return nil, fmt.Errorf("line[%d] not exists", p.ID)
+	}
+
+	if err = nl.SetUpmix(dsp.UpmixMode(p.Mode)); err != nil {
+		return nil, err
+	}
+
+	return websockets.NewResponseChannelMix(nl), nil
+}
+
+func apiLineSetRoute(c *websockets.WSConnection, req Requester, log lg.Logger) (any, error) {
+	var p requestLineRoute
+	err := req.Unmarshal(&p)
+	if err != nil {
+		return nil, err
+	}
+
+	nl := speaker.FindLineByID(speaker.LineID(p.ID))
+	if nl == nil {
+		return nil, fmt.Errorf("line[%d] not exists", p.ID)
+	}
+
+	from := make([]audio.Channel, len(p.From))
+	for i, ch := range p.From {
+		from[i] = audio.Channel(ch)
+	}
+	var gains []float64
+	for _, g := range p.Gains {
+		gains = append(gains, float64(g))
+	}
+
+	if err = nl.SetRoute(audio.Channel(p.To), from, gains); err != nil {
+		return nil, err
+	}
+
+	return websockets.NewResponseChannelMix(nl), nil
+}
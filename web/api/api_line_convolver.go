@@ -0,0 +1,33 @@
+package api
+
+import (
+	"fmt"
+
+	lg "github.com/zwcway/castserver-go/common/log"
+	"github.com/zwcway/castserver-go/common/speaker"
+	"github.com/zwcway/castserver-go/web/websockets"
+)
+
+type requestLineConvolver struct {
+	ID   uint8  `jp:"id"`
+	File string `jp:"file"` // 冲激响应的 WAV 文件，空表示关闭
+}
+
+func apiLineSetConvolver(c *websockets.WSConnection, req Requester, log lg.Logger) (any, error) {
+	var p requestLineConvolver
+	err := req.Unmarshal(&p)
+	if err != nil {
+		return nil, err
+	}
+
+	nl := speaker.FindLineByID(speaker.LineID(p.ID))
+	if nl == nil {
+		return nil, fmt.Errorf("line[%d] not exists", p.ID)
+	}
+
+	if err = nl.SetConvolver(p.File); err != nil {
+		return nil, err
+	}
+
+	return websockets.NewResponseLineInfo(nl), nil
+}
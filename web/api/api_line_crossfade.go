@@ -0,0 +1,41 @@
+package api
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/zwcway/castserver-go/common/dsp"
+	lg "github.com/zwcway/castserver-go/common/log"
+	"github.com/zwcway/castserver-go/common/speaker"
+	"github.com/zwcway/castserver-go/web/websockets"
+)
+
+type requestLineCrossfade struct {
+	ID    uint8   `jp:"id"`
+	MS    float32 `jp:"ms"`              // 交叉淡化时长，0 表示无缝衔接
+	Curve *uint8  `jp:"curve,omitempty"` // 淡化曲线，不设置时保持原值
+}
+
+func apiLineSetCrossfade(c *websockets.WSConnection, req Requester, log lg.Logger) (any, error) {
+	var p requestLineCrossfade
+	err := req.Unmarshal(&p)
+	if err != nil {
+		return nil, err
+	}
+
+	nl := speaker.FindLineByID(speaker.LineID(p.ID))
+	if nl == nil {
+		return nil, fmt.Errorf("line[%d] not exists", p.ID)
+	}
+
+	curve := nl.CrossfadeCurve
+	if p.Curve != nil {
+		curve = dsp.FadeCurve(*p.Curve)
+	}
+
+	if err = nl.SetCrossfade(time.Duration(float64(p.MS)*float64(time.Millisecond)), curve); err != nil {
+		return nil, err
+	}
+
+	return websockets.NewResponseCrossfade(nl), nil
+}
@@ -0,0 +1,34 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/zwcway/castserver-go/common/dsp"
+	lg "github.com/zwcway/castserver-go/common/log"
+	"github.com/zwcway/castserver-go/common/speaker"
+	"github.com/zwcway/castserver-go/web/websockets"
+)
+
+type requestLineDither struct {
+	ID   uint8 `jp:"id"`
+	Mode uint8 `jp:"mode"` // 0 不抖动，1 TPDF，2 TPDF 加噪声整形
+}
+
+func apiLineSetDither(c *websockets.WSConnection, req Requester, log lg.Logger) (any, error) {
+	var p requestLineDither
+	err := req.Unmarshal(&p)
+	if err != nil {
+		return nil, err
+	}
+
+	nl := speaker.FindLineByID(speaker.LineID(p.ID))
+	if nl == nil {
+		return nil, fmt.Errorf("line[%d] not exists", p.ID)
+	}
+
+	if err = nl.SetDither(dsp.DitherMode(p.Mode)); err != nil {
+		return nil, err
+	}
+
+	return websockets.NewResponseLineInfo(nl), nil
+}
@@ -2,8 +2,11 @@ package api
 
 import (
 	"fmt"
+	"time"
 	"unicode/utf8"
 
+	"github.com/zwcway/castserver-go/common/dsp"
+	"github.com/zwcway/castserver-go/common/element"
 	lg "github.com/zwcway/castserver-go/common/log"
 	"github.com/zwcway/castserver-go/common/speaker"
 	"github.com/zwcway/castserver-go/web/websockets"
@@ -13,6 +16,11 @@ type requestLineEdit struct {
 	ID              uint8   `jp:"id"`
 	Name            *string `jp:"name,omitempty"`
 	SpectrumLogAxis *bool   `jp:"sl,omitempty"`
+
+	SpectrumSize      *int     `jp:"ss,omitempty"`
+	SpectrumWindow    *uint8   `jp:"sw,omitempty"`
+	SpectrumAveraging *float64 `jp:"sa,omitempty"`
+	SpectrumPeakHold  *int     `jp:"sp,omitempty"` // 毫秒
 }
 
 func apiLineEdit(c *websockets.WSConnection, req Requester, log lg.Logger) (ret any, err error) {
@@ -35,8 +43,38 @@ func apiLineEdit(c *websockets.WSConnection, req Requester, log lg.Logger) (ret
 		nl.SetName(*p.Name)
 	}
 
+	if p.SpectrumSize != nil && !element.IsSpectrumSizeValid(*p.SpectrumSize) {
+		err = fmt.Errorf("spectrum size invalid")
+		return
+	}
+	if p.SpectrumWindow != nil && !dsp.IsWindowTypeValid(*p.SpectrumWindow) {
+		err = fmt.Errorf("spectrum window invalid")
+		return
+	}
+	if p.SpectrumAveraging != nil && (*p.SpectrumAveraging < 0 || *p.SpectrumAveraging >= 1) {
+		err = fmt.Errorf("spectrum averaging invalid")
+		return
+	}
+	if p.SpectrumPeakHold != nil && *p.SpectrumPeakHold < 0 {
+		err = fmt.Errorf("spectrum peak hold invalid")
+		return
+	}
+
+	se := nl.Input.SpectrumEle
 	if p.SpectrumLogAxis != nil {
-		nl.Input.SpectrumEle.SetLogAxis(*p.SpectrumLogAxis)
+		se.SetLogAxis(*p.SpectrumLogAxis)
+	}
+	if p.SpectrumSize != nil {
+		se.SetSize(*p.SpectrumSize)
+	}
+	if p.SpectrumWindow != nil {
+		se.SetWindow(*p.SpectrumWindow)
+	}
+	if p.SpectrumAveraging != nil {
+		se.SetAveraging(*p.SpectrumAveraging)
+	}
+	if p.SpectrumPeakHold != nil {
+		se.SetPeakHold(time.Duration(*p.SpectrumPeakHold) * time.Millisecond)
 	}
 
 	ret = true
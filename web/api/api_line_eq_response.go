@@ -0,0 +1,97 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/zwcway/castserver-go/common/audio"
+	"github.com/zwcway/castserver-go/common/dsp"
+	lg "github.com/zwcway/castserver-go/common/log"
+	"github.com/zwcway/castserver-go/common/speaker"
+	"github.com/zwcway/castserver-go/web/websockets"
+)
+
+const eqResponseMaxPoints = 1024
+
+type requestLineEQResponse struct {
+	ID     uint8 `jp:"id"`
+	Points int   `jp:"n,omitempty"` // 曲线的点数
+}
+
+type requestEQResponse struct {
+	Rate       int          `jp:"rate,omitempty"`
+	Points     int          `jp:"n,omitempty"`
+	Type       uint8        `jp:"t,omitempty"` // 默认类型
+	Equalizers [][4]float32 `jp:"eqs"`         // 频率,增益,Q,类型
+}
+
+func eqResponsePoints(n int) int {
+	if n <= 0 {
+		return 200
+	}
+	if n > eqResponseMaxPoints {
+		return eqResponseMaxPoints
+	}
+	return n
+}
+
+func eqResponseRate(rate int) int {
+	if audio.NewAudioRate(rate).IsValid() {
+		return rate
+	}
+	return audio.AudioRate_48000.ToInt()
+}
+
+// 当前线路均衡器的响应曲线
+func apiLineEqualizerResponse(c *websockets.WSConnection, req Requester, log lg.Logger) (any, error) {
+	var p requestLineEQResponse
+	err := req.Unmarshal(&p)
+	if err != nil {
+		return nil, err
+	}
+
+	nl := speaker.FindLineByID(speaker.LineID(p.ID))
+	if nl == nil {
+		return nil, fmt.Errorf("line[%d] not exists", p.ID)
+	}
+
+	return websockets.NewResponseEqualizerCurve(nl.Equalizer(), eqResponseRate(nl.Output.Rate.ToInt()), eqResponsePoints(p.Points)), nil
+}
+
+// 任意参数的响应曲线，用于界面调整时预览
+func apiEqualizerResponse(c *websockets.WSConnection, req Requester, log lg.Logger) (any, error) {
+	var p requestEQResponse
+	err := req.Unmarshal(&p)
+	if err != nil {
+		return nil, err
+	}
+	if len(p.Equalizers) > int(dsp.FEQ_MAX_SIZE) {
+		return nil, fmt.Errorf("seg invalid")
+	}
+	if p.Type == 0 {
+		p.Type = dsp.PeakingFilter
+	}
+	if !dsp.IsFilterTypeValid(p.Type) {
+		return nil, fmt.Errorf("filter type invalid")
+	}
+
+	eq := dsp.NewPeakingFilterEqualizerProcessor(uint8(len(p.Equalizers)))
+	eq.Type = p.Type
+
+	for _, e := range p.Equalizers {
+		f := dsp.FilterParams{
+			Frequency: int(e[0]),
+			Gain:      float64(e[1]),
+			Q:         float64(e[2]),
+			Type:      dsp.FilterType(e[3]),
+		}
+		if !dsp.IsFrequencyValid(f.Frequency) {
+			return nil, fmt.Errorf("frequency invalid")
+		}
+		if f.Type != 0 && !dsp.IsFilterTypeValid(f.Type) {
+			return nil, fmt.Errorf("filter type invalid")
+		}
+		eq.SetFilter(f)
+	}
+
+	return websockets.NewResponseEqualizerCurve(eq, eqResponseRate(p.Rate), eqResponsePoints(p.Points)), nil
+}
@@ -11,9 +11,11 @@ import (
 
 type requestLineEQ struct {
 	ID        uint8   `jp:"id"`
-	Seg       uint8   `jp:"seg"`  // 均衡器数量
-	Frequency int     `jp:"freq"` // 频率
-	Gain      float32 `jp:"gain"` // 增益
+	Seg       uint8   `jp:"seg"`         // 均衡器数量
+	Frequency int     `jp:"freq"`        // 频率
+	Gain      float32 `jp:"gain"`        // 增益
+	Q         float32 `jp:"q,omitempty"` // Q 值
+	Type      uint8   `jp:"t,omitempty"` // 滤波器类型，为 0 时使用默认类型
 }
 
 func apiLineSetEqualizer(c *websockets.WSConnection, req Requester, log lg.Logger) (any, error) {
@@ -28,6 +30,12 @@ func apiLineSetEqualizer(c *websockets.WSConnection, req Requester, log lg.Logge
 	if p.Seg > dsp.FEQ_MAX_SIZE {
 		return nil, fmt.Errorf("seg invalid")
 	}
+	if p.Type != 0 && !dsp.IsFilterTypeValid(p.Type) {
+		return nil, fmt.Errorf("filter type invalid")
+	}
+	if p.Q < 0 {
+		return nil, fmt.Errorf("q invalid")
+	}
 
 	nl := speaker.FindLineByID(speaker.LineID(p.ID))
 	if nl == nil {
@@ -40,7 +48,12 @@ func apiLineSetEqualizer(c *websockets.WSConnection, req Requester, log lg.Logge
 		eq.Clear(p.Seg)
 	}
 
-	eq.Set(p.Frequency, float64(p.Gain), 0)
+	eq.SetFilter(dsp.FilterParams{
+		Frequency: p.Frequency,
+		Gain:      float64(p.Gain),
+		Q:         float64(p.Q),
+		Type:      p.Type,
+	})
 
 	if err = nl.SetEqualizer(eq); err != nil {
 		return nil, err
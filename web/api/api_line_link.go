@@ -0,0 +1,40 @@
+package api
+
+import (
+	"fmt"
+
+	lg "github.com/zwcway/castserver-go/common/log"
+	"github.com/zwcway/castserver-go/common/speaker"
+	"github.com/zwcway/castserver-go/web/websockets"
+)
+
+type requestLineLink struct {
+	ID     uint8 `jp:"id"`
+	Leader uint8 `jp:"leader"` // 跟随的主线路，0 表示取消跟随
+}
+
+func apiLineLink(c *websockets.WSConnection, req Requester, log lg.Logger) (any, error) {
+	var p requestLineLink
+	err := req.Unmarshal(&p)
+	if err != nil {
+		return nil, err
+	}
+
+	nl := speaker.FindLineByID(speaker.LineID(p.ID))
+	if nl == nil {
+		return nil, fmt.Errorf("line[%d] not exists", p.ID)
+	}
+
+	var leader *speaker.Line
+	if p.Leader > 0 {
+		if leader = speaker.FindLineByID(speaker.LineID(p.Leader)); leader == nil {
+			return nil, fmt.Errorf("line[%d] not exists", p.Leader)
+		}
+	}
+
+	if err = nl.Follow(leader); err != nil {
+		return nil, err
+	}
+
+	return websockets.NewResponseLineInfo(nl), nil
+}
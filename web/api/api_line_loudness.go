@@ -0,0 +1,45 @@
+package api
+
+import (
+	"fmt"
+
+	lg "github.com/zwcway/castserver-go/common/log"
+	"github.com/zwcway/castserver-go/common/speaker"
+	"github.com/zwcway/castserver-go/common/stream"
+	"github.com/zwcway/castserver-go/web/websockets"
+)
+
+type requestLineLoudness struct {
+	ID     uint8    `jp:"id"`
+	Enable bool     `jp:"enable"`
+	Target *float32 `jp:"target,omitempty"` // 目标响度 LUFS，不设置时保持原值
+	Mode   *uint8   `jp:"mode,omitempty"`   // 0 实时测量，1 使用 ReplayGain
+}
+
+func apiLineSetLoudness(c *websockets.WSConnection, req Requester, log lg.Logger) (any, error) {
+	var p requestLineLoudness
+	err := req.Unmarshal(&p)
+	if err != nil {
+		return nil, err
+	}
+
+	nl := speaker.FindLineByID(speaker.LineID(p.ID))
+	if nl == nil {
+		return nil, fmt.Errorf("line[%d] not exists", p.ID)
+	}
+
+	target := nl.LoudnessTarget
+	if p.Target != nil {
+		target = float64(*p.Target)
+	}
+	mode := nl.LoudnessMode
+	if p.Mode != nil {
+		mode = stream.LoudnessMode(*p.Mode)
+	}
+
+	if err = nl.SetLoudness(p.Enable, target, mode); err != nil {
+		return nil, err
+	}
+
+	return websockets.NewResponseLoudness(nl), nil
+}
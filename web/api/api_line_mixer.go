@@ -0,0 +1,70 @@
+package api
+
+import (
+	"fmt"
+
+	lg "github.com/zwcway/castserver-go/common/log"
+	"github.com/zwcway/castserver-go/common/speaker"
+	"github.com/zwcway/castserver-go/web/websockets"
+)
+
+// 不设置的字段保持原值
+type requestLineMixer struct {
+	ID     uint8    `jp:"id"`
+	Source uint16   `jp:"src,omitempty"`  // 0 表示只设置电平表
+	Gain   *float32 `jp:"gain,omitempty"` // dB
+	Pan    *float32 `jp:"pan,omitempty"`  // -1 ~ 1
+	Mute   *bool    `jp:"mute,omitempty"`
+	Solo   *bool    `jp:"solo,omitempty"`
+	Meter  *bool    `jp:"meter,omitempty"`
+}
+
+func apiLineSetMixer(c *websockets.WSConnection, req Requester, log lg.Logger) (any, error) {
+	var p requestLineMixer
+	err := req.Unmarshal(&p)
+	if err != nil {
+		return nil, err
+	}
+
+	nl := speaker.FindLineByID(speaker.LineID(p.ID))
+	if nl == nil {
+		return nil, &speaker.UnknownLineError{Line: p.ID}
+	}
+	mixer := nl.Input.MixerEle
+
+	if p.Meter != nil {
+		mixer.SetMeter(*p.Meter)
+	}
+
+	if p.Source > 0 {
+		found := false
+		for _, s := range mixer.Sources() {
+			if s.ID != p.Source {
+				continue
+			}
+			found = true
+			ctl := s.MixerControl
+			if p.Gain != nil {
+				ctl.Gain = float64(*p.Gain)
+			}
+			if p.Pan != nil {
+				ctl.Pan = float64(*p.Pan)
+			}
+			if p.Mute != nil {
+				ctl.Mute = *p.Mute
+			}
+			if p.Solo != nil {
+				ctl.Solo = *p.Solo
+			}
+			if err = mixer.SetControl(p.Source, ctl); err != nil {
+				return nil, err
+			}
+			break
+		}
+		if !found {
+			return nil, fmt.Errorf("mixer source %d not exists", p.Source)
+		}
+	}
+
+	return websockets.NewResponseLineSource(nl), nil
+}
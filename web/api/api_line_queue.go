@@ -0,0 +1,194 @@
+package api
+
+import (
+	lg "github.com/zwcway/castserver-go/common/log"
+	"github.com/zwcway/castserver-go/common/playlist"
+	"github.com/zwcway/castserver-go/common/speaker"
+	"github.com/zwcway/castserver-go/player"
+	"github.com/zwcway/castserver-go/web/websockets"
+)
+
+type requestQueue struct {
+	ID uint8 `jp:"id"`
+}
+
+type requestQueueAdd struct {
+	ID   uint8    `jp:"id"`
+	Urls []string `jp:"urls"`
+	Pos  *int     `jp:"pos,omitempty"` // 插入至 pos 之前，不设置时添加至最后
+}
+
+type requestQueueItems struct {
+	ID    uint8    `jp:"id"`
+	Items []uint32 `jp:"items"`
+}
+
+type requestQueueItem struct {
+	ID   uint8  `jp:"id"`
+	Item uint32 `jp:"item"`
+	Pos  int    `jp:"pos,omitempty"`
+}
+
+type requestQueueMode struct {
+	ID      uint8  `jp:"id"`
+	Shuffle *bool  `jp:"shuffle,omitempty"`
+	Repeat  *uint8 `jp:"repeat,omitempty"` // 0 不循环，1 单曲循环，2 列表循环
+}
+
+func queueLine(id uint8) (*speaker.Line, error) {
+	nl := speaker.FindLineByID(speaker.LineID(id))
+	if nl == nil {
+		return nil, &speaker.UnknownLineError{Line: id}
+	}
+	return nl, nil
+}
+
+func apiLineQueue(c *websockets.WSConnection, req Requester, log lg.Logger) (any, error) {
+	var p requestQueue
+	err := req.Unmarshal(&p)
+	if err != nil {
+		return nil, err
+	}
+	nl, err := queueLine(p.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return websockets.NewResponseQueue(player.Queue(nl.ID)), nil
+}
+
+func apiQueueAdd(c *websockets.WSConnection, req Requester, log lg.Logger) (any, error) {
+	var p requestQueueAdd
+	err := req.Unmarshal(&p)
+	if err != nil {
+		return nil, err
+	}
+	nl, err := queueLine(p.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	pos := -1
+	if p.Pos != nil {
+		pos = *p.Pos
+	}
+	return player.Add(nl, p.Urls, pos)
+}
+
+func apiQueueRemove(c *websockets.WSConnection, req Requester, log lg.Logger) (any, error) {
+	var p requestQueueItems
+	err := req.Unmarshal(&p)
+	if err != nil {
+		return nil, err
+	}
+	nl, err := queueLine(p.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return player.Remove(nl, p.Items...), nil
+}
+
+func apiQueueMove(c *websockets.WSConnection, req Requester, log lg.Logger) (any, error) {
+	var p requestQueueItem
+	err := req.Unmarshal(&p)
+	if err != nil {
+		return nil, err
+	}
+	nl, err := queueLine(p.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = player.Move(nl, p.Item, p.Pos); err != nil {
+		return nil, err
+	}
+	return true, nil
+}
+
+func apiQueueClear(c *websockets.WSConnection, req Requester, log lg.Logger) (any, error) {
+	var p requestQueue
+	err := req.Unmarshal(&p)
+	if err != nil {
+		return nil, err
+	}
+	nl, err := queueLine(p.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	player.Clear(nl)
+	return true, nil
+}
+
+func apiQueuePlay(c *websockets.WSConnection, req Requester, log lg.Logger) (any, error) {
+	var p requestQueueItem
+	err := req.Unmarshal(&p)
+	if err != nil {
+		return nil, err
+	}
+	nl, err := queueLine(p.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = player.Play(nl, p.Item); err != nil {
+		return nil, err
+	}
+	return true, nil
+}
+
+func apiQueueNext(c *websockets.WSConnection, req Requester, log lg.Logger) (any, error) {
+	var p requestQueue
+	err := req.Unmarshal(&p)
+	if err != nil {
+		return nil, err
+	}
+	nl, err := queueLine(p.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = player.Next(nl); err != nil {
+		return nil, err
+	}
+	return true, nil
+}
+
+func apiQueuePrev(c *websockets.WSConnection, req Requester, log lg.Logger) (any, error) {
+	var p requestQueue
+	err := req.Unmarshal(&p)
+	if err != nil {
+		return nil, err
+	}
+	nl, err := queueLine(p.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = player.Prev(nl); err != nil {
+		return nil, err
+	}
+	return true, nil
+}
+
+func apiQueueSetMode(c *websockets.WSConnection, req Requester, log lg.Logger) (any, error) {
+	var p requestQueueMode
+	err := req.Unmarshal(&p)
+	if err != nil {
+		return nil, err
+	}
+	nl, err := queueLine(p.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var repeat *playlist.RepeatMode
+	if p.Repeat != nil {
+		repeat = (*playlist.RepeatMode)(p.Repeat)
+	}
+	if err = player.SetMode(nl, p.Shuffle, repeat); err != nil {
+		return nil, err
+	}
+	return websockets.NewResponseQueue(player.Queue(nl.ID)), nil
+}
@@ -0,0 +1,39 @@
+package api
+
+import (
+	"fmt"
+
+	lg "github.com/zwcway/castserver-go/common/log"
+	"github.com/zwcway/castserver-go/common/speaker"
+	"github.com/zwcway/castserver-go/web/websockets"
+)
+
+// 线路和扬声器二选一
+type requestResetClips struct {
+	Line    uint8  `jp:"line,omitempty"`
+	Speaker uint32 `jp:"sp,omitempty"`
+}
+
+func apiResetClips(c *websockets.WSConnection, req Requester, log lg.Logger) (any, error) {
+	var p requestResetClips
+	err := req.Unmarshal(&p)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.Speaker > 0 {
+		sp := speaker.FindSpeakerByID(speaker.SpeakerID(p.Speaker))
+		if sp == nil {
+			return nil, &Error{4, fmt.Errorf("speaker[%d] not exists", p.Speaker)}
+		}
+		sp.MeterEle.ResetClips()
+		return true, nil
+	}
+
+	nl := speaker.FindLineByID(speaker.LineID(p.Line))
+	if nl == nil {
+		return nil, &speaker.UnknownLineError{Line: p.Line}
+	}
+	nl.Input.MeterEle.ResetClips()
+	return true, nil
+}
@@ -0,0 +1,104 @@
+package api
+
+import (
+	"fmt"
+
+	lg "github.com/zwcway/castserver-go/common/log"
+	"github.com/zwcway/castserver-go/common/playlist"
+	"github.com/zwcway/castserver-go/player"
+	"github.com/zwcway/castserver-go/web/websockets"
+)
+
+// 修改电台时，不设置的字段保持原值
+type requestStationSet struct {
+	ID    uint32  `jp:"id,omitempty"` // 0 表示添加
+	Name  *string `jp:"name,omitempty"`
+	Url   *string `jp:"url,omitempty"`
+	Genre *string `jp:"genre,omitempty"`
+}
+
+type requestStationDelete struct {
+	ID uint32 `jp:"id"`
+}
+
+// 播放保存的电台或者直接播放地址
+type requestPlayRadio struct {
+	Line    uint8  `jp:"line"`
+	Station uint32 `jp:"id,omitempty"`
+	Url     string `jp:"url,omitempty"`
+}
+
+func apiStationList(c *websockets.WSConnection, req Requester, log lg.Logger) (any, error) {
+	stations := player.Stations()
+	list := make([]*websockets.ResponseStation, len(stations))
+	for i := range stations {
+		list[i] = websockets.NewResponseStation(&stations[i])
+	}
+	return list, nil
+}
+
+func apiStationSet(c *websockets.WSConnection, req Requester, log lg.Logger) (any, error) {
+	var p requestStationSet
+	err := req.Unmarshal(&p)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &playlist.Station{}
+	if p.ID > 0 {
+		if s = player.FindStation(p.ID); s == nil {
+			return nil, fmt.Errorf("station %d not exists", p.ID)
+		}
+	}
+	if p.Name != nil {
+		s.Name = *p.Name
+	}
+	if p.Url != nil {
+		s.Url = *p.Url
+	}
+	if p.Genre != nil {
+		s.Genre = *p.Genre
+	}
+
+	if err = player.SaveStation(s); err != nil {
+		return nil, err
+	}
+	return websockets.NewResponseStation(s), nil
+}
+
+func apiStationDelete(c *websockets.WSConnection, req Requester, log lg.Logger) (any, error) {
+	var p requestStationDelete
+	err := req.Unmarshal(&p)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = player.DeleteStation(p.ID); err != nil {
+		return nil, err
+	}
+	return true, nil
+}
+
+func apiPlayRadio(c *websockets.WSConnection, req Requester, log lg.Logger) (any, error) {
+	var p requestPlayRadio
+	err := req.Unmarshal(&p)
+	if err != nil {
+		return nil, err
+	}
+	nl, err := queueLine(p.Line)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.Station > 0 {
+		err = player.PlayStation(nl, p.Station)
+	} else if p.Url != "" {
+		err = player.PlayRadio(nl, p.Url)
+	} else {
+		err = fmt.Errorf("radio url is empty")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return true, nil
+}
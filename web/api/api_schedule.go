@@ -0,0 +1,169 @@
+package api
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/zwcway/castserver-go/common/config"
+	lg "github.com/zwcway/castserver-go/common/log"
+	"github.com/zwcway/castserver-go/common/schedule"
+	"github.com/zwcway/castserver-go/common/speaker"
+	"github.com/zwcway/castserver-go/scheduler"
+	"github.com/zwcway/castserver-go/web/websockets"
+)
+
+type requestJobList struct {
+	Line uint8 `jp:"line,omitempty"` // 0 表示所有线路
+}
+
+// 修改任务时，不设置的字段保持原值
+type requestJobSet struct {
+	ID     uint32   `jp:"id,omitempty"` // 0 表示添加
+	Line   *uint8   `jp:"line,omitempty"`
+	Name   *string  `jp:"name,omitempty"`
+	Cron   *string  `jp:"cron,omitempty"`
+	At     *int64   `jp:"at,omitempty"` // unix 秒
+	Action *uint8   `jp:"act,omitempty"`
+	Url    *string  `jp:"url,omitempty"`
+	Volume *uint8   `jp:"vol,omitempty"`
+	Ramp   *float32 `jp:"ramp,omitempty"` // 毫秒
+	Power  *bool    `jp:"power,omitempty"`
+	Missed *uint8   `jp:"missed,omitempty"`
+	Grace  *int64   `jp:"grace,omitempty"` // 秒
+	On     *bool    `jp:"on,omitempty"`
+}
+
+type requestJobDelete struct {
+	ID uint32 `jp:"id"`
+}
+
+type requestSleepTimer struct {
+	Line    uint8   `jp:"line"`
+	Minutes float32 `jp:"min"`            // 0 表示取消
+	Fade    float32 `jp:"fade,omitempty"` // 淡出毫秒
+}
+
+func apiJobList(c *websockets.WSConnection, req Requester, log lg.Logger) (any, error) {
+	var p requestJobList
+	err := req.Unmarshal(&p)
+	if err != nil {
+		return nil, err
+	}
+
+	jobs := scheduler.Jobs(speaker.LineID(p.Line))
+	list := make([]*websockets.ResponseJob, len(jobs))
+	for i, j := range jobs {
+		list[i] = websockets.NewResponseJob(j)
+	}
+	return list, nil
+}
+
+func apiJobSet(c *websockets.WSConnection, req Requester, log lg.Logger) (any, error) {
+	var p requestJobSet
+	err := req.Unmarshal(&p)
+	if err != nil {
+		return nil, err
+	}
+
+	j := &schedule.Job{Enabled: true}
+	if p.ID > 0 {
+		old := scheduler.FindJob(schedule.JobID(p.ID))
+		if old == nil {
+			return nil, fmt.Errorf("job %d not exists", p.ID)
+		}
+		*j = *old
+	} else {
+		if p.Line == nil {
+			return nil, fmt.Errorf("job line is empty")
+		}
+		if p.Action != nil && *p.Action == schedule.JobChime {
+			j.Volume = uint8(config.AnnounceVolume)
+		} else if l := speaker.FindLineByID(speaker.LineID(*p.Line)); l != nil {
+			j.Volume = l.Volume
+		}
+	}
+
+	if p.Line != nil {
+		j.LineID = speaker.LineID(*p.Line)
+	}
+	if p.Name != nil {
+		j.Name = *p.Name
+	}
+	if p.Cron != nil {
+		j.Cron = *p.Cron
+	}
+	if p.At != nil {
+		j.At = time.Unix(*p.At, 0)
+	}
+	if p.Action != nil {
+		j.Action = *p.Action
+	}
+	if p.Url != nil {
+		j.Url = *p.Url
+	}
+	if p.Volume != nil {
+		j.Volume = *p.Volume
+	}
+	if p.Ramp != nil {
+		j.Ramp = time.Duration(float64(*p.Ramp) * float64(time.Millisecond))
+	}
+	if p.Power != nil {
+		j.Power = *p.Power
+	}
+	if p.Missed != nil {
+		j.Missed = *p.Missed
+	}
+	if p.Grace != nil {
+		j.Grace = time.Duration(*p.Grace) * time.Second
+	}
+	if p.On != nil {
+		j.Enabled = *p.On
+	}
+
+	if err = scheduler.SaveJob(j); err != nil {
+		return nil, err
+	}
+	return websockets.NewResponseJob(j), nil
+}
+
+func apiJobDelete(c *websockets.WSConnection, req Requester, log lg.Logger) (any, error) {
+	var p requestJobDelete
+	err := req.Unmarshal(&p)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = scheduler.DeleteJob(schedule.JobID(p.ID)); err != nil {
+		return nil, err
+	}
+	return true, nil
+}
+
+func apiSleepTimer(c *websockets.WSConnection, req Requester, log lg.Logger) (any, error) {
+	var p requestSleepTimer
+	err := req.Unmarshal(&p)
+	if err != nil {
+		return nil, err
+	}
+
+	nl := speaker.FindLineByID(speaker.LineID(p.Line))
+	if nl == nil {
+		return nil, &speaker.UnknownLineError{Line: p.Line}
+	}
+	if p.Minutes < 0 || p.Fade < 0 {
+		return nil, fmt.Errorf("sleep timer invalid")
+	}
+
+	fade := config.VolumeFadeDuration
+	if p.Fade > 0 {
+		fade = time.Duration(float64(p.Fade) * float64(time.Millisecond))
+	}
+	j, err := scheduler.SleepTimer(nl.ID, time.Duration(float64(p.Minutes)*float64(time.Minute)), fade)
+	if err != nil {
+		return nil, err
+	}
+	if j == nil {
+		return true, nil
+	}
+	return websockets.NewResponseJob(j), nil
+}
@@ -0,0 +1,50 @@
+package api
+
+import (
+	"fmt"
+	"time"
+
+	lg "github.com/zwcway/castserver-go/common/log"
+	"github.com/zwcway/castserver-go/common/speaker"
+	"github.com/zwcway/castserver-go/common/stream"
+	"github.com/zwcway/castserver-go/web/websockets"
+)
+
+type requestSpeakerDelay struct {
+	ID    uint32   `jp:"id"`
+	MS    *float32 `jp:"ms,omitempty"` // 毫秒
+	Meter *float32 `jp:"m,omitempty"`  // 与听音位置的距离差，单位米
+}
+
+func apiSpeakerSetDelay(c *websockets.WSConnection, req Requester, log lg.Logger) (any, error) {
+	var (
+		p     requestSpeakerDelay
+		delay time.Duration
+	)
+	err := req.Unmarshal(&p)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.MS != nil {
+		delay = time.Duration(float64(*p.MS) * float64(time.Millisecond))
+	} else if p.Meter != nil {
+		delay = stream.DelayFromDistance(float64(*p.Meter))
+	} else {
+		return nil, fmt.Errorf("delay required")
+	}
+	if delay < 0 || delay > stream.EqualizerDelayMax {
+		return nil, fmt.Errorf("delay invalid, max %dms", stream.EqualizerDelayMax.Milliseconds())
+	}
+
+	sp := speaker.FindSpeakerByID(speaker.SpeakerID(p.ID))
+	if sp == nil {
+		return nil, &Error{4, fmt.Errorf("speaker[%d] not exists", p.ID)}
+	}
+
+	if err = sp.SetDelay(delay); err != nil {
+		return nil, err
+	}
+
+	return float32(sp.Delay()) / float32(time.Millisecond), nil
+}
@@ -0,0 +1,62 @@
+package api
+
+import (
+	"fmt"
+
+	"github.com/zwcway/castserver-go/common/dsp"
+	lg "github.com/zwcway/castserver-go/common/log"
+	"github.com/zwcway/castserver-go/common/speaker"
+	"github.com/zwcway/castserver-go/web/websockets"
+)
+
+type requestSpeakerEQ struct {
+	ID        uint32  `jp:"id"`
+	Seg       uint8   `jp:"seg"`         // 均衡器数量
+	Frequency int     `jp:"freq"`        // 频率
+	Gain      float32 `jp:"gain"`        // 增益
+	Q         float32 `jp:"q,omitempty"` // Q 值
+	Type      uint8   `jp:"t,omitempty"` // 滤波器类型，为 0 时使用默认类型
+}
+
+func apiSpeakerSetEqualizer(c *websockets.WSConnection, req Requester, log lg.Logger) (any, error) {
+	var p requestSpeakerEQ
+	err := req.Unmarshal(&p)
+	if err != nil {
+		return nil, err
+	}
+	if !dsp.IsFrequencyValid(p.Frequency) {
+		return nil, fmt.Errorf("frequency invalid")
+	}
+	if p.Seg > dsp.FEQ_MAX_SIZE {
+		return nil, fmt.Errorf("seg invalid")
+	}
+	if p.Type != 0 && !dsp.IsFilterTypeValid(p.Type) {
+		return nil, fmt.Errorf("filter type invalid")
+	}
+	if p.Q < 0 {
+		return nil, fmt.Errorf("q invalid")
+	}
+
+	sp := speaker.FindSpeakerByID(speaker.SpeakerID(p.ID))
+	if sp == nil {
+		return nil, &Error{4, fmt.Errorf("speaker[%d] not exists", p.ID)}
+	}
+
+	eq := sp.Equalizer()
+
+	if len(eq.Filters) != int(p.Seg) {
+		eq.Clear(p.Seg)
+	}
+
+	eq.SetFilter(dsp.FilterParams{
+		Frequency: p.Frequency,
+		Gain:      float64(p.Gain),
+		Q:         float64(p.Q),
+		Type:      p.Type,
+	})
+
+	sp.SetEqualizer(eq)
+	sp.EqualizerEle.On()
+
+	return websockets.NewResponseSpeakerEqualizer(sp), nil
+}
@@ -10,6 +10,8 @@ type reqSubscribe struct {
 	Event  []websockets.Event `jp:"evt"`
 	SubEvt websockets.Event   `jp:"sub,omitempty"`
 	Arg    int                `jp:"arg,omitempty"`
+	Bands  uint8              `jp:"bands,omitempty"` // 频谱按 1/bands 倍频程合并，0 为原始频点
+	FPS    uint8              `jp:"fps,omitempty"`   // 频谱的帧率
 }
 
 var SubscribeFunction func(c *websockets.WSConnection, evt int)
@@ -27,7 +29,8 @@ func apiSubscribe(c *websockets.WSConnection, req Requester, log log1.Logger) (a
 	}
 
 	if params.Action {
-		websockets.Subscribe(c, params.Event, params.SubEvt, params.Arg)
+		opt := websockets.SpectrumOption{Bands: params.Bands, FPS: params.FPS}
+		websockets.Subscribe(c, params.Event, params.SubEvt, params.Arg, opt)
 	} else {
 		websockets.Unsubscribe(c, params.Event, params.SubEvt, params.Arg)
 	}
@@ -8,25 +8,65 @@ import (
 )
 
 var apiRouterList = map[string]apiRouter{
-	"subscribe":     {apiSubscribe},
-	"speakerList":   {apiSpeakerList},
-	"speakerInfo":   {apiSpeakerInfo},
-	"speakerVolume": {apiSpeakerVolume},
-	"setSpeaker":    {apiSpeakerEdit},
-	"lineList":      {apiLineList},
-	"lineInfo":      {apiLineInfo},
-	"deleteLine":    {apiLineDelete},
-	"createLine":    {apiLineCreate},
-	"lineVolume":    {apiLineVolume},
-	"setLine":       {apiLineEdit},
-	"linePipeLine":  {apiLinePipeLineInfo},
-	"setLineEQ":     {apiLineSetEqualizer},
-	"clearLineEQ":   {apiLineClearEqualizer},
-	"enableLineEQ":  {apiLineSetEqualizerEnable},
-	"linePlayer":    {apiLinePlayer},
-	"lineSeek":      {apiLinePlayerSeek},
-	"soundTest":     {apiTestSound},
-	"status":        {apiStatus},
+	"subscribe":        {apiSubscribe},
+	"speakerList":      {apiSpeakerList},
+	"speakerInfo":      {apiSpeakerInfo},
+	"speakerVolume":    {apiSpeakerVolume},
+	"setSpeaker":       {apiSpeakerEdit},
+	"setSpeakerEQ":     {apiSpeakerSetEqualizer},
+	"setSpeakerDelay":  {apiSpeakerSetDelay},
+	"lineList":         {apiLineList},
+	"lineInfo":         {apiLineInfo},
+	"deleteLine":       {apiLineDelete},
+	"createLine":       {apiLineCreate},
+	"lineVolume":       {apiLineVolume},
+	"setLine":          {apiLineEdit},
+	"linePipeLine":     {apiLinePipeLineInfo},
+	"setLineEQ":        {apiLineSetEqualizer},
+	"clearLineEQ":      {apiLineClearEqualizer},
+	"enableLineEQ":     {apiLineSetEqualizerEnable},
+	"lineEQResponse":   {apiLineEqualizerResponse},
+	"eqResponse":       {apiEqualizerResponse},
+	"setLineLoudness":  {apiLineSetLoudness},
+	"setLineCrossfade": {apiLineSetCrossfade},
+	"setLineUpmix":     {apiLineSetUpmix},
+	"setLineRoute":     {apiLineSetRoute},
+	"setLineDither":    {apiLineSetDither},
+	"setLineConvolver": {apiLineSetConvolver},
+	"linkLine":         {apiLineLink},
+	"linePlayer":       {apiLinePlayer},
+	"setLineMixer":     {apiLineSetMixer},
+	"resetClips":       {apiResetClips},
+	"lineQueue":        {apiLineQueue},
+	"queueAdd":         {apiQueueAdd},
+	"queueRemove":      {apiQueueRemove},
+	"queueMove":        {apiQueueMove},
+	"queueClear":       {apiQueueClear},
+	"queuePlay":        {apiQueuePlay},
+	"queueNext":        {apiQueueNext},
+	"queuePrev":        {apiQueuePrev},
+	"setQueueMode":     {apiQueueSetMode},
+	"stationList":      {apiStationList},
+	"stationSet":       {apiStationSet},
+	"stationDelete":    {apiStationDelete},
+	"playRadio":        {apiPlayRadio},
+	"libraryStatus":    {apiLibraryStatus},
+	"libraryScan":      {apiLibraryScan},
+	"libraryArtists":   {apiLibraryArtists},
+	"libraryAlbums":    {apiLibraryAlbums},
+	"libraryAlbum":     {apiLibraryAlbum},
+	"libraryFolder":    {apiLibraryFolder},
+	"librarySearch":    {apiLibrarySearch},
+	"libraryEnqueue":   {apiLibraryEnqueue},
+	"lineSeek":         {apiLinePlayerSeek},
+	"soundTest":        {apiTestSound},
+	"announce":         {apiAnnounce},
+	"stopAnnounce":     {apiAnnounceStop},
+	"jobList":          {apiJobList},
+	"setJob":           {apiJobSet},
+	"deleteJob":        {apiJobDelete},
+	"sleepTimer":       {apiSleepTimer},
+	"status":           {apiStatus},
 }
 
 func ApiDispatch(mt int, msg []byte, conn *websockets.WSConnection) {
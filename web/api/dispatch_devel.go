@@ -259,8 +259,7 @@ func apiPlayFile(c *websockets.WSConnection, req Requester, log lg.Logger) (ret
 		err = errNoLine
 		return
 	}
-	audio := decoder.FileStreamer(line.UUID)
-	err = audio.OpenFile(file.File)
+	audio, err := decoder.OpenFile(line, file.File)
 	if err != nil {
 		return
 	}
@@ -285,7 +284,10 @@ func apiPlayPause(c *websockets.WSConnection, req Requester, log lg.Logger) (ret
 		err = errNoLine
 		return
 	}
-	audio := decoder.FileStreamer(line.UUID)
+	audio, err := decoder.FileStreamer(line.UUID)
+	if err != nil {
+		return
+	}
 	audio.SetPause(p.Pause)
 	return true, nil
 }
@@ -306,6 +308,10 @@ type debugStatusRsp struct {
 	FilePlaying  bool            `jp:"fplay"`
 	FileName     string          `jp:"furl"`
 	SpectrumLog  bool            `jp:"sl"`
+	SpectrumSize int             `jp:"ss"`
+	SpectrumWin  uint8           `jp:"sw"`
+	SpectrumAvg  float64         `jp:"sa"`
+	SpectrumPeak int             `jp:"sp"`
 	Elements     []elementStatus `jp:"eles"`
 }
 
@@ -334,7 +340,12 @@ func apiDebugStatus(c *websockets.WSConnection, req Requester, log lg.Logger) (r
 			resp.FilePlaying = !fs.IsPaused()
 			resp.FileName = fs.CurrentFile()
 		}
-		resp.SpectrumLog = line.Input.SpectrumEle.LogAxis()
+		se := line.Input.SpectrumEle
+		resp.SpectrumLog = se.LogAxis()
+		resp.SpectrumSize = se.Size()
+		resp.SpectrumWin = se.Window()
+		resp.SpectrumAvg = se.Averaging()
+		resp.SpectrumPeak = int(se.PeakHold().Milliseconds())
 		if line.Input.PipeLine != nil {
 			pl, _ = line.Input.PipeLine.(*pipeline.PipeLine)
 		}
@@ -0,0 +1,31 @@
+package web
+
+import (
+	"strconv"
+
+	"github.com/valyala/fasthttp"
+	"github.com/zwcway/castserver-go/common/library"
+	"github.com/zwcway/castserver-go/indexer"
+)
+
+// 音乐库曲目的封面，/cover?id=曲目
+func coverHandler(ctx *fasthttp.RequestCtx) {
+	if !ctx.IsGet() {
+		ctx.Error("Method not allowed", fasthttp.StatusMethodNotAllowed)
+		return
+	}
+	id, err := strconv.ParseUint(string(ctx.QueryArgs().Peek("id")), 10, 32)
+	if err != nil {
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
+		return
+	}
+
+	data, mime, err := indexer.Cover(library.TrackID(id))
+	if err != nil {
+		ctx.SetStatusCode(fasthttp.StatusNotFound)
+		return
+	}
+	ctx.Response.Header.Set("Cache-Control", "max-age=86400")
+	ctx.SetContentType(mime)
+	ctx.Write(data)
+}
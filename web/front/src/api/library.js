@@ -0,0 +1,40 @@
+import { socket } from '@/common/request';
+
+export function libraryStatus() {
+  return socket.send('libraryStatus', {});
+}
+
+export function libraryScan() {
+  return socket.send('libraryScan', {});
+}
+
+export function libraryArtists() {
+  return socket.send('libraryArtists', {});
+}
+
+// artist 不设置时返回所有专辑
+export function libraryAlbums(artist) {
+  return socket.send('libraryAlbums', { artist });
+}
+
+export function libraryAlbum(artist, album) {
+  return socket.send('libraryAlbum', { artist, album });
+}
+
+// path 为空时返回音乐库的目录
+export function libraryFolder(path) {
+  return socket.send('libraryFolder', { path });
+}
+
+export function librarySearch(q, limit) {
+  return socket.send('librarySearch', { q, limit });
+}
+
+// opt: { ids } 或者 { artist, album } 或者 { folder }，pos 不设置时添加至最后
+export function libraryEnqueue(line, opt, pos, play) {
+  return socket.send('libraryEnqueue', { line: parseInt(line), ...opt, pos, play });
+}
+
+export function coverUrl(id) {
+  return `/cover?id=${id}`;
+}
@@ -59,8 +59,14 @@ export function removeListenLineSpeakerChanged(id) {
   socket.removeEvent(Event.Line_Speaker, id);
 }
 
-export function listenLineSpectrum(id, callback) {
-  return socket.receiveEvent(Event.Line_Spectrum, id, callback);
+// opt: { bands: 0 原始频点、3 或 6 倍频程, fps: 帧率 }
+export function listenLineSpectrum(id, callback, opt) {
+  return socket.receiveEvent(Event.Line_Spectrum, id, callback, undefined, opt);
+}
+
+// opt: { ss: fft 长度, sw: 窗函数, sa: 平均系数, sp: 峰值保持毫秒 }
+export function setLineSpectrum(id, opt) {
+  return socket.send('setLine', Object.assign({}, opt, { id }));
 }
 
 export function removeListenLineSpectrum(id) {
@@ -75,6 +81,141 @@ export function removeListenLineInput(id) {
   socket.removeEvent(Event.Line_Input, id);
 }
 
+export function listenLineLoudness(id, callback) {
+  return socket.receiveEvent(Event.Line_Loudness, id, callback);
+}
+
+export function removeListenLineLoudness(id) {
+  socket.removeEvent(Event.Line_Loudness, id);
+}
+
+export function listenLineClip(id, callback) {
+  return socket.receiveEvent(Event.Line_Clip, id, callback);
+}
+
+export function removeListenLineClip(id) {
+  socket.removeEvent(Event.Line_Clip, id);
+}
+
+export function resetLineClips(id) {
+  return socket.send('resetClips', { line: parseInt(id) });
+}
+
+export function getLineQueue(id) {
+  return socket.send('lineQueue', { id: parseInt(id) });
+}
+
+export function listenLineQueue(id, callback) {
+  return socket.receiveEvent(Event.Line_Queue, id, callback);
+}
+
+export function removeListenLineQueue(id) {
+  socket.removeEvent(Event.Line_Queue, id);
+}
+
+// pos 不设置时添加至最后
+export function addQueue(id, urls, pos) {
+  return socket.send('queueAdd', { id: parseInt(id), urls, pos });
+}
+
+export function removeQueue(id, items) {
+  return socket.send('queueRemove', { id: parseInt(id), items });
+}
+
+export function moveQueue(id, item, pos) {
+  return socket.send('queueMove', { id: parseInt(id), item, pos });
+}
+
+export function clearQueue(id) {
+  return socket.send('queueClear', { id: parseInt(id) });
+}
+
+// cmd: queuePlay、queueNext、queuePrev
+export function controlQueue(id, cmd, item) {
+  return socket.send(cmd, { id: parseInt(id), item });
+}
+
+// repeat: 0 不循环，1 单曲循环，2 列表循环
+export function setQueueMode(id, shuffle, repeat) {
+  return socket.send('setQueueMode', { id: parseInt(id), shuffle, repeat });
+}
+
+export function setLineLoudness(id, enable, target, mode) {
+  return socket.send('setLineLoudness', { id, enable, target, mode });
+}
+
+export function setLineUpmix(id, mode) {
+  return socket.send('setLineUpmix', { id, mode });
+}
+
+export function setLineRoute(id, to, from, gains) {
+  return socket.send('setLineRoute', { id, to, from, gains });
+}
+
+export function setLineDither(id, mode) {
+  return socket.send('setLineDither', { id, mode });
+}
+
+// file 为空时关闭
+export function setLineConvolver(id, file) {
+  return socket.send('setLineConvolver', { id, file });
+}
+
+export function setLineMixer(id, opt) {
+  return socket.send('setLineMixer', { ...opt, id: parseInt(id) });
+}
+
+// opt: { lines, sps, all, url 或 data, vol, duck }
+export function announce(opt) {
+  return socket.send('announce', opt);
+}
+
+export function stopAnnounce(opt) {
+  return socket.send('stopAnnounce', opt);
+}
+
+export function linkLine(id, leader) {
+  return socket.send('linkLine', { id: parseInt(id), leader: parseInt(leader) });
+}
+
+export function unlinkLine(id) {
+  return socket.send('linkLine', { id: parseInt(id), leader: 0 });
+}
+
+export function jobList(line) {
+  return socket.send('jobList', line ? { line: parseInt(line) } : {});
+}
+
+export function setJob(job) {
+  return socket.send('setJob', job);
+}
+
+export function deleteJob(id) {
+  return socket.send('deleteJob', { id: parseInt(id) });
+}
+
+export function sleepTimer(line, min, fade) {
+  return socket.send('sleepTimer', { line: parseInt(line), min, fade });
+}
+
+export function stationList() {
+  return socket.send('stationList', {});
+}
+
+// id 为 0 时添加
+export function setStation(station) {
+  return socket.send('stationSet', station);
+}
+
+export function deleteStation(id) {
+  return socket.send('stationDelete', { id: parseInt(id) });
+}
+
+// 播放保存的电台 station，或者直接播放 url
+export function playRadio(line, station, url) {
+  return socket.send('playRadio', { line: parseInt(line), id: station, url });
+}
+
 export function playerSeek(id, pos) {
   return socket.send('lineSeek', { id, pos });
 }
@@ -34,6 +34,19 @@ export function listenSpeakerSpectrum(ids, callback) {
   return socket.receiveEvent(Event.SP_Spectrum, ids, callback);
 }
 
+export function removeListenSpeakerClip(ids) {
+  socket.removeEvent(Event.SP_Clip, ids);
+}
+
+export function listenSpeakerClip(ids, callback) {
+  if (!(callback instanceof Function)) return;
+  return socket.receiveEvent(Event.SP_Clip, ids, callback);
+}
+
+export function resetSpeakerClips(id) {
+  return socket.send('resetClips', { sp: parseInt(id) });
+}
+
 export function getSpeakerInfo(id) {
   return socket.send('speakerInfo', id).then(speaker => {
     return formatSpeaker(speaker);
@@ -21,6 +21,10 @@ const Event = Object.freeze({
   Line_Spectrum: 23,
   Line_LevelMeter: 24,
   Line_Input: 25,
+  Line_Loudness: 26,
+  Line_Clip: 27,
+  SP_Clip: 28,
+  Line_Queue: 29,
 });
 
 export { socket, Command, Event };
@@ -244,8 +244,8 @@ function sendPing() {
   return ws.send('ping');
 }
 
-function sendSubscribe(act, evt, sub, arg) {
-  let data = { evt, act }
+function sendSubscribe(act, evt, sub, arg, opt) {
+  let data = Object.assign({}, opt, { evt, act })
 
   if (sub) {
     data['sub'] = sub;
@@ -257,7 +257,7 @@ function sendSubscribe(act, evt, sub, arg) {
   return send('subscribe', data);
 }
 
-function receiveEvent(evt, arg, cb, sub) {
+function receiveEvent(evt, arg, cb, sub, opt) {
   if (!(evt instanceof Array)) evt = [evt];
 
   if (arg instanceof Function) {
@@ -283,7 +283,7 @@ function receiveEvent(evt, arg, cb, sub) {
           receiver[e + ''] = cb;
       }
     });
-    sendSubscribe(true, evt, sub, a)
+    sendSubscribe(true, evt, sub, a, opt)
   });
 }
 
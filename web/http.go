@@ -88,11 +88,17 @@ func requestHandle(ctx *fasthttp.RequestCtx) {
 	if api.ApiDispatchDevel(ctx) {
 		return
 	}
+	if strings.HasPrefix(uri, "/media/") {
+		mediaHandler(ctx)
+		return
+	}
 	switch uri {
 	case "/api":
 		websockets.WSHandler(ctx)
 	case "/status":
 		statusHandler(ctx)
+	case "/cover":
+		coverHandler(ctx)
 	default:
 		if uri == "/" {
 			uri += "index.html"
@@ -0,0 +1,86 @@
+package web
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+	"github.com/zwcway/castserver-go/common/library"
+	"github.com/zwcway/castserver-go/indexer"
+)
+
+// 音乐库曲目的文件，/media/曲目.扩展名，支持 Range
+func mediaHandler(ctx *fasthttp.RequestCtx) {
+	if !ctx.IsGet() && !ctx.IsHead() {
+		ctx.Error("Method not allowed", fasthttp.StatusMethodNotAllowed)
+		return
+	}
+	name := path.Base(string(ctx.Path()))
+	id, err := strconv.ParseUint(strings.TrimSuffix(name, path.Ext(name)), 10, 32)
+	if err != nil {
+		ctx.SetStatusCode(fasthttp.StatusBadRequest)
+		return
+	}
+	t := indexer.FindTrack(library.TrackID(id))
+	if t == nil {
+		ctx.SetStatusCode(fasthttp.StatusNotFound)
+		return
+	}
+
+	fp, err := os.Open(t.Path)
+	if err != nil {
+		ctx.SetStatusCode(fasthttp.StatusNotFound)
+		return
+	}
+	st, err := fp.Stat()
+	if err != nil {
+		fp.Close()
+		ctx.SetStatusCode(fasthttp.StatusInternalServerError)
+		return
+	}
+
+	var (
+		size  = int(st.Size())
+		start = 0
+		end   = size - 1
+	)
+	ctx.SetContentType(library.MimeType(t.Path))
+	ctx.Response.Header.SetLastModified(st.ModTime())
+	ctx.Response.Header.Set("Accept-Ranges", "bytes")
+	ctx.Response.Header.Set("transferMode.dlna.org", "Streaming")
+	ctx.Response.Header.Set("contentFeatures.dlna.org", "DLNA.ORG_OP=01;DLNA.ORG_CI=0")
+
+	if r := ctx.Request.Header.Peek(fasthttp.HeaderRange); len(r) > 0 {
+		start, end, err = fasthttp.ParseByteRange(r, size)
+		if err != nil {
+			fp.Close()
+			ctx.Response.Header.Set(fasthttp.HeaderContentRange, fmt.Sprintf("bytes */%d", size))
+			ctx.SetStatusCode(fasthttp.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		ctx.Response.Header.SetContentRange(start, end, size)
+		ctx.SetStatusCode(fasthttp.StatusPartialContent)
+	}
+
+	n := end - start + 1
+	if ctx.IsHead() || n <= 0 {
+		fp.Close()
+		ctx.Response.Header.SetContentLength(n)
+		ctx.Response.SkipBody = true
+		return
+	}
+	if _, err = fp.Seek(int64(start), io.SeekStart); err != nil {
+		fp.Close()
+		ctx.SetStatusCode(fasthttp.StatusInternalServerError)
+		return
+	}
+	// 发送完成后关闭文件
+	ctx.SetBodyStream(struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(fp, int64(n)), fp}, n)
+}
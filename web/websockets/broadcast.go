@@ -2,7 +2,9 @@ package websockets
 
 import (
 	"github.com/zwcway/castserver-go/common/audio"
+	"github.com/zwcway/castserver-go/common/playlist"
 	"github.com/zwcway/castserver-go/common/speaker"
+	"github.com/zwcway/castserver-go/common/stream"
 	"github.com/zwcway/go-jsonpack"
 )
 
@@ -75,9 +77,53 @@ func BroadcastLineInputEvent(line *speaker.Line) error {
 	return Broadcast(Event_Line_Input, 0, int(line.ID), msg)
 }
 
-// Broadcast 开始广播事件
-func Broadcast(evt Event, sub Event, arg int, msg []byte) error {
-	// 格式： event+cmd+evt+data
+type notifyClip struct {
+	Clip   bool               `jp:"clip"`
+	Clips  int                `jp:"n"`
+	Levels []*notifyPeakLevel `jp:"levels"`
+}
+
+func clipMessage(me stream.MeterElement, clipping bool) ([]byte, error) {
+	return jsonpack.Marshal(notifyClip{
+		Clip:   clipping,
+		Clips:  int(me.Clips()),
+		Levels: newNotifyPeakLevels(me),
+	})
+}
+
+// BroadcastLineClipEvent 广播线路开始或者停止削波
+func BroadcastLineClipEvent(line *speaker.Line, clipping bool) error {
+	msg, err := clipMessage(line.Input.MeterEle, clipping)
+	if err != nil {
+		return err
+	}
+
+	return Broadcast(Event_Line_Clip, 0, int(line.ID), msg)
+}
+
+// BroadcastSpeakerClipEvent 广播扬声器开始或者停止削波
+func BroadcastSpeakerClipEvent(sp *speaker.Speaker, clipping bool) error {
+	msg, err := clipMessage(sp.MeterEle, clipping)
+	if err != nil {
+		return err
+	}
+
+	return Broadcast(Event_SP_Clip, 0, int(sp.ID), msg)
+}
+
+// BroadcastQueueEvent 广播播放队列的改变
+func BroadcastQueueEvent(q *playlist.Queue) error {
+	resp := NewResponseQueue(q)
+	msg, err := jsonpack.Marshal(resp)
+	if err != nil {
+		return err
+	}
+
+	return Broadcast(Event_Line_Queue, 0, int(resp.Line), msg)
+}
+
+// 格式： event+cmd+evt+data
+func eventMessage(evt Event, sub Event, arg int, msg []byte) []byte {
 	eventMsg := make([]byte, 8+len(msg))
 	eventMsg[0] = 'e'
 	eventMsg[1] = 'v'
@@ -89,6 +135,12 @@ func Broadcast(evt Event, sub Event, arg int, msg []byte) error {
 	eventMsg[7] = byte(arg)
 
 	copy(eventMsg[8:], msg)
+	return eventMsg
+}
+
+// Broadcast 开始广播事件
+func Broadcast(evt Event, sub Event, arg int, msg []byte) error {
+	eventMsg := eventMessage(evt, sub, arg, msg)
 
 	// log.Debug("broadcast event",
 	// 	lg.Uint8("cmd", cmd),
@@ -107,7 +159,7 @@ func Broadcast(evt Event, sub Event, arg int, msg []byte) error {
 	return nil
 }
 
-func Subscribe(c *WSConnection, evt []Event, sub Event, arg int) {
+func Subscribe(c *WSConnection, evt []Event, sub Event, arg int, opt SpectrumOption) {
 	ses, ok := WSHub.broadcast[c]
 	if !ok { // 设备已断开
 		return
@@ -115,10 +167,12 @@ func Subscribe(c *WSConnection, evt []Event, sub Event, arg int) {
 	if len(evt) == 0 {
 		return
 	}
+	opt.check()
 	addEvts := []Event{}
 	for _, ee := range evt {
-		// 检查已经已经订阅过
-		if findBEvent(ses, ee, sub, arg) {
+		// 检查已经已经订阅过，重复订阅时更新频谱的参数
+		if i := findBEvent(ses, ee, sub, arg); i >= 0 {
+			ses[i].opt = opt
 			continue
 		}
 
@@ -140,7 +194,7 @@ func Subscribe(c *WSConnection, evt []Event, sub Event, arg int) {
 	// 事件为空，表示接收该cmd下的所有事件
 	hasSpectrumEvent := false
 	for _, e := range addEvts {
-		WSHub.broadcast[c] = append(WSHub.broadcast[c], broadcastEvent{e, sub, arg})
+		WSHub.broadcast[c] = append(WSHub.broadcast[c], broadcastEvent{e, sub, arg, opt})
 
 		if isSpectrumEvent(e) {
 			appendSpectrum(e, arg)
@@ -3,6 +3,7 @@ package websockets
 import (
 	"github.com/zwcway/castserver-go/common/audio"
 	"github.com/zwcway/castserver-go/common/bus"
+	"github.com/zwcway/castserver-go/common/playlist"
 	"github.com/zwcway/castserver-go/common/speaker"
 )
 
@@ -49,9 +50,35 @@ func register() {
 		BroadcastLineInputEvent(line)
 		return nil
 	}).ASync()
+	speaker.BusLineIdleChanged.Register(func(line *speaker.Line, idle bool) error {
+		// 音频信号停止或者恢复
+		BroadcastLineInputEvent(line)
+		return nil
+	}).ASync()
+	speaker.BusLineMetadataChanged.Register(func(line *speaker.Line) error {
+		// 曲目或者网络电台的标题变化
+		BroadcastLineInputEvent(line)
+		return nil
+	}).ASync()
+	speaker.BusLineClipped.Register(func(line *speaker.Line, clipping bool) error {
+		BroadcastLineClipEvent(line, clipping)
+		return nil
+	}).ASync()
+	speaker.BusSpeakerClipped.Register(func(sp *speaker.Speaker, clipping bool) error {
+		BroadcastSpeakerClipEvent(sp, clipping)
+		return nil
+	}).ASync()
+	playlist.BusQueueChanged.Register(func(q *playlist.Queue) error {
+		BroadcastQueueEvent(q)
+		return nil
+	}).ASync()
 	speaker.BusLineVolumeChanged.Register(func(line *speaker.Line, oldVol float64) error {
 		BroadcastLineEvent(line, Event_Line_Edited)
 		return nil
 	}).ASync()
+	speaker.BusLineLinked.Register(func(line *speaker.Line, oldLeader *speaker.Line) error {
+		BroadcastLineEvent(line, Event_Line_Edited)
+		return nil
+	}).ASync()
 
 }
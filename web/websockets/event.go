@@ -30,7 +30,11 @@ const (
 	Event_Line_Speaker
 	Event_Line_Spectrum // 频谱图
 	Event_Line_LevelMeter
-	Event_Line_Input // 有音频信号进入
+	Event_Line_Input    // 有音频信号进入
+	Event_Line_Loudness // 响度
+	Event_Line_Clip     // 削波
+	Event_SP_Clip
+	Event_Line_Queue // 播放队列
 
 	Event_SRV_Exited
 
@@ -41,6 +45,7 @@ type broadcastEvent struct {
 	evt Event
 	sub Event
 	arg int
+	opt SpectrumOption
 }
 
 var CommandEventMap = map[Command][]Event{
@@ -51,18 +56,21 @@ var CommandEventMap = map[Command][]Event{
 		Event_SP_Detected,
 		Event_SP_Moved,
 		Event_SP_Edited,
+		Event_SP_Clip,
 	},
 	Command_LINE: {
 		Event_Line_Created,
 		Event_Line_Deleted,
 		Event_Line_Edited,
 		Event_Line_Input,
+		Event_Line_Clip,
+		Event_Line_Queue,
 	},
 	Command_SERVER: {},
 }
 
 func isSpectrumEvent(e Event) bool {
-	return e == Event_Line_Spectrum || e == Event_Line_LevelMeter || e == Event_SP_Spectrum || e == Event_SP_LevelMeter
+	return e == Event_Line_Spectrum || e == Event_Line_LevelMeter || e == Event_SP_Spectrum || e == Event_SP_LevelMeter || e == Event_Line_Loudness
 }
 
 func FindEvent(cmd Command, e Event) bool {
@@ -88,14 +96,14 @@ func findEvent(es []Event, e Event) bool {
 
 	return false
 }
-func findBEvent(es []broadcastEvent, evt Event, sub Event, arg int) bool {
-	for _, ee := range es {
+func findBEvent(es []broadcastEvent, evt Event, sub Event, arg int) int {
+	for i, ee := range es {
 		if ee.evt == evt && ee.sub == sub && ee.arg == arg {
-			return true
+			return i
 		}
 	}
 
-	return false
+	return -1
 }
 
 func hasSpectrumEvent(list broadcastMap) bool {
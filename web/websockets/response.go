@@ -1,14 +1,24 @@
 package websockets
 
 import (
+	"math"
+	"time"
+
 	"github.com/zwcway/castserver-go/common/audio"
+	"github.com/zwcway/castserver-go/common/dsp"
+	"github.com/zwcway/castserver-go/common/library"
+	"github.com/zwcway/castserver-go/common/playlist"
+	"github.com/zwcway/castserver-go/common/schedule"
 	"github.com/zwcway/castserver-go/common/speaker"
+	"github.com/zwcway/castserver-go/common/stream"
 )
 
 type ResponseSpeakerInfo struct {
 	ResponseSpeakerItem
 
-	Statistic speaker.Statistic `jp:"statistic"`
+	Statistic  speaker.Statistic  `jp:"statistic"`
+	Delay      float32            `jp:"delay"` // 毫秒
+	Equalizers *ResponseEqualizer `jp:"eq,omitempty"`
 }
 
 func NewResponseSpeakerInfo(sp *speaker.Speaker) *ResponseSpeakerInfo {
@@ -16,6 +26,8 @@ func NewResponseSpeakerInfo(sp *speaker.Speaker) *ResponseSpeakerInfo {
 	return &ResponseSpeakerInfo{
 		ResponseSpeakerItem: *NewResponseSpeakerItem(sp),
 		Statistic:           sp.Statistic,
+		Delay:               float32(sp.Delay()) / float32(time.Millisecond),
+		Equalizers:          NewResponseSpeakerEqualizer(sp),
 	}
 }
 
@@ -76,6 +88,66 @@ type ResponseLineSource struct {
 	// 文件播放
 	Duration int `jp:"cur,omitempty"`
 	Total    int `jp:"dur,omitempty"`
+
+	Meter   bool                   `jp:"meter"`
+	Sources []*ResponseMixerSource `jp:"srcs,omitempty"`
+
+	Idle bool `jp:"idle"` // 连续静音，已停止推送
+
+	Title  string `jp:"title,omitempty"`
+	Artist string `jp:"artist,omitempty"`
+}
+
+type ResponseMixerLevel struct {
+	Channel int     `jp:"ch"`
+	Peak    float32 `jp:"peak"` // dBFS
+	RMS     float32 `jp:"rms"`  // dBFS
+}
+
+type ResponseMixerSource struct {
+	ID     uint16                `jp:"id"`
+	Name   string                `jp:"name,omitempty"`
+	Gain   float32               `jp:"gain"`
+	Pan    float32               `jp:"pan"`
+	Mute   bool                  `jp:"mute"`
+	Solo   bool                  `jp:"solo"`
+	Levels []*ResponseMixerLevel `jp:"levels,omitempty"`
+}
+
+// 电平转换为 dBFS，静音时为下限
+func levelToDB(v float64) float32 {
+	if v <= 0 {
+		return stream.MixerGainMin * 2
+	}
+	db := 20 * math.Log10(v)
+	if db < stream.MixerGainMin*2 {
+		db = stream.MixerGainMin * 2
+	}
+	return float32(db)
+}
+
+func NewResponseMixerSource(s *stream.MixerSource) *ResponseMixerSource {
+	r := &ResponseMixerSource{
+		ID:   s.ID,
+		Gain: float32(s.Gain),
+		Pan:  float32(s.Pan),
+		Mute: s.Mute,
+		Solo: s.Solo,
+	}
+	switch src := s.Source.(type) {
+	case stream.FileStreamer:
+		r.Name = src.CurrentFile()
+	case interface{ Name() string }:
+		r.Name = src.Name()
+	}
+	for _, lv := range s.Levels {
+		r.Levels = append(r.Levels, &ResponseMixerLevel{
+			Channel: int(lv.Channel),
+			Peak:    levelToDB(lv.Peak),
+			RMS:     levelToDB(lv.RMS),
+		})
+	}
+	return r
 }
 
 func NewResponseLineSource(line *speaker.Line) *ResponseLineSource {
@@ -83,6 +155,10 @@ func NewResponseLineSource(line *speaker.Line) *ResponseLineSource {
 		return nil
 	}
 	format := line.Input.MixerEle.Format()
+	var sources []*ResponseMixerSource
+	for _, s := range line.Input.MixerEle.Sources() {
+		sources = append(sources, NewResponseMixerSource(&s))
+	}
 	return &ResponseLineSource{
 		Rate:     format.Rate.ToInt(),
 		Bits:     format.Bits.String(),
@@ -91,6 +167,11 @@ func NewResponseLineSource(line *speaker.Line) *ResponseLineSource {
 		Type:     int(line.Input.From),
 		Duration: int(line.Input.Duration().Seconds()),
 		Total:    int(line.Input.TotalDuration().Seconds() - 1),
+		Meter:    line.Input.MixerEle.Meter(),
+		Sources:  sources,
+		Idle:     line.Input.SilenceEle.IsIdle(),
+		Title:    line.Input.Title,
+		Artist:   line.Input.Artist,
 	}
 }
 
@@ -118,7 +199,120 @@ func NewResponseLineList(ls *speaker.Line) *ResponseLineList {
 type ResponseEqualizer struct {
 	Switch     bool         `jp:"enable"`
 	Seg        uint8        `jp:"seg"`
-	Equalizers [][3]float32 `jp:"eqs,omitempty"`
+	Equalizers [][4]float32 `jp:"eqs,omitempty"` // 频率,增益,Q,类型
+}
+
+type ResponseEqualizerCurve struct {
+	Frequency []float32 `jp:"f"`
+	Magnitude []float32 `jp:"m"` // dB
+	Phase     []float32 `jp:"p"` // 角度
+}
+
+func NewResponseEqualizerCurve(eq *dsp.EqualizerProcessor, rate int, points int) *ResponseEqualizerCurve {
+	if eq == nil {
+		return nil
+	}
+	freqs := dsp.ResponseFrequencies(points)
+	mag, phase := eq.Response(rate, freqs)
+
+	curve := &ResponseEqualizerCurve{
+		Frequency: make([]float32, len(freqs)),
+		Magnitude: make([]float32, len(freqs)),
+		Phase:     make([]float32, len(freqs)),
+	}
+	for i := range freqs {
+		curve.Frequency[i] = float32(freqs[i])
+		curve.Magnitude[i] = float32(mag[i])
+		curve.Phase[i] = float32(phase[i])
+	}
+	return curve
+}
+
+type ResponseLoudness struct {
+	Switch bool    `jp:"enable"`
+	Target float32 `jp:"target"` // LUFS
+	Mode   uint8   `jp:"mode"`
+}
+
+func NewResponseLoudness(line *speaker.Line) *ResponseLoudness {
+	if line == nil || line.Input.LoudnessEle == nil {
+		return nil
+	}
+	le := line.Input.LoudnessEle
+	return &ResponseLoudness{
+		Switch: le.IsOn(),
+		Target: float32(le.Target()),
+		Mode:   uint8(le.Mode()),
+	}
+}
+
+type ResponseCrossfade struct {
+	Duration float32 `jp:"ms"`
+	Curve    uint8   `jp:"curve"`
+}
+
+func NewResponseCrossfade(line *speaker.Line) *ResponseCrossfade {
+	if line == nil || line.Input.MixerEle == nil {
+		return nil
+	}
+	d, curve := line.Input.MixerEle.Crossfade()
+	return &ResponseCrossfade{
+		Duration: float32(d) / float32(time.Millisecond),
+		Curve:    curve,
+	}
+}
+
+type ResponseChannelRoute struct {
+	To    uint8     `jp:"to"`
+	From  []uint8   `jp:"from"`
+	Gains []float32 `jp:"gains,omitempty"`
+}
+
+type ResponseChannelMix struct {
+	Upmix  uint8                   `jp:"upmix"`
+	Routes []*ResponseChannelRoute `jp:"routes,omitempty"`
+	In     []uint8                 `jp:"in,omitempty"`
+	Out    []uint8                 `jp:"out,omitempty"`
+	Matrix [][]float32             `jp:"matrix,omitempty"` // [输出][输入] 的增益
+}
+
+func NewResponseChannelMix(line *speaker.Line) *ResponseChannelMix {
+	if line == nil || line.Input.ChMixerEle == nil {
+		return nil
+	}
+	ce := line.Input.ChMixerEle
+	resp := &ResponseChannelMix{
+		Upmix: ce.Upmix(),
+	}
+	for _, r := range ce.Route() {
+		cr := &ResponseChannelRoute{To: uint8(r.To)}
+		for _, ch := range r.From {
+			cr.From = append(cr.From, uint8(ch))
+		}
+		for _, g := range r.Gains {
+			cr.Gains = append(cr.Gains, float32(g))
+		}
+		resp.Routes = append(resp.Routes, cr)
+	}
+
+	m := ce.Matrix()
+	if m == nil {
+		return resp
+	}
+	for _, ch := range m.In {
+		resp.In = append(resp.In, uint8(ch))
+	}
+	for _, ch := range m.Out {
+		resp.Out = append(resp.Out, uint8(ch))
+	}
+	resp.Matrix = make([][]float32, len(m.Gains))
+	for o, row := range m.Gains {
+		resp.Matrix[o] = make([]float32, len(row))
+		for i, g := range row {
+			resp.Matrix[o][i] = float32(g)
+		}
+	}
+	return resp
 }
 
 type ResponseLineInfo struct {
@@ -129,24 +323,45 @@ type ResponseLineInfo struct {
 	Speakers   []*ResponseSpeakerItem `jp:"speakers,omitempty"`
 	Input      *ResponseLineSource    `jp:"source,omitempty"`
 	Equalizers *ResponseEqualizer     `jp:"eq,omitempty"`
+	Loudness   *ResponseLoudness      `jp:"loudness,omitempty"`
+	Crossfade  *ResponseCrossfade     `jp:"crossfade,omitempty"`
+	ChannelMix *ResponseChannelMix    `jp:"chmix,omitempty"`
+	Dither     uint8                  `jp:"dither"`
+	Convolver  string                 `jp:"convolver,omitempty"` // 冲激响应文件
+	Latency    uint16                 `jp:"latency"`             // 管道的处理延迟，毫秒
+	Leader     uint8                  `jp:"leader"`              // 跟随的主线路，0 表示不跟随
+	Followers  []uint8                `jp:"followers,omitempty"`
 }
 
 func NewResponseEqualizer(line *speaker.Line) *ResponseEqualizer {
 	if line == nil || line.Input.EqualizerEle == nil {
 		return nil
 	}
-	eq := line.Equalizer()
+	return newResponseEqualizer(line.Input.EqualizerEle, line.Equalizer())
+}
+
+func NewResponseSpeakerEqualizer(sp *speaker.Speaker) *ResponseEqualizer {
+	if sp == nil || sp.EqualizerEle == nil {
+		return nil
+	}
+	return newResponseEqualizer(sp.EqualizerEle, sp.Equalizer())
+}
+
+func newResponseEqualizer(ele stream.EqualizerElement, eq *dsp.EqualizerProcessor) *ResponseEqualizer {
+	if eq == nil {
+		return nil
+	}
 	list := &ResponseEqualizer{
-		Switch:     line.Input.EqualizerEle.IsOn(),
+		Switch:     ele.IsOn(),
 		Seg:        uint8(len(eq.Filters)),
-		Equalizers: make([][3]float32, len(eq.Filters)),
+		Equalizers: make([][4]float32, len(eq.Filters)),
 	}
 
 	for i, e := range eq.Filters {
 		if e == nil {
 			continue
 		}
-		list.Equalizers[i] = [3]float32{float32(e.Frequency), float32(e.Gain), float32(e.Q)}
+		list.Equalizers[i] = [4]float32{float32(e.Frequency), float32(e.Gain), float32(e.Q), float32(eq.FilterType(e))}
 	}
 	return list
 }
@@ -163,11 +378,21 @@ func NewResponseLineInfo(line *speaker.Line) *ResponseLineInfo {
 		Speakers:   make([]*ResponseSpeakerItem, line.SpeakerCount()),
 		Input:      NewResponseLineSource(line),
 		Equalizers: NewResponseEqualizer(line),
+		Loudness:   NewResponseLoudness(line),
+		Crossfade:  NewResponseCrossfade(line),
+		ChannelMix: NewResponseChannelMix(line),
+		Dither:     line.Dither,
+		Convolver:  line.Convolver,
+		Latency:    uint16(line.Input.PipeLine.Latency().Milliseconds()),
+		Leader:     uint8(line.LeaderID),
 	}
 
 	for i, s := range line.Speakers() {
 		info.Speakers[i] = NewResponseSpeakerItem(s)
 	}
+	for _, f := range line.Followers() {
+		info.Followers = append(info.Followers, uint8(f.ID))
+	}
 
 	return info
 }
@@ -186,3 +411,154 @@ func NewResponseChannelInfo(ch audio.Channel) *ResponseChannelInfo {
 		Name: ch.String(),
 	}
 }
+
+type ResponseJob struct {
+	ID      uint32  `jp:"id"`
+	Line    uint8   `jp:"line"`
+	Name    string  `jp:"name"`
+	Cron    string  `jp:"cron,omitempty"`
+	At      int64   `jp:"at,omitempty"` // unix 秒
+	Action  uint8   `jp:"act"`
+	Url     string  `jp:"url,omitempty"`
+	Volume  uint8   `jp:"vol"`
+	Ramp    float32 `jp:"ramp"` // 毫秒
+	Power   bool    `jp:"power"`
+	Missed  uint8   `jp:"missed"`
+	Grace   int64   `jp:"grace"` // 秒
+	Enabled bool    `jp:"on"`
+	LastRun int64   `jp:"last,omitempty"`
+	NextRun int64   `jp:"next,omitempty"`
+}
+
+func unixTime(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+func NewResponseJob(j *schedule.Job) *ResponseJob {
+	if j == nil {
+		return nil
+	}
+	r := &ResponseJob{
+		ID:      uint32(j.ID),
+		Line:    uint8(j.LineID),
+		Name:    j.Name,
+		Cron:    j.Cron,
+		At:      unixTime(j.At),
+		Action:  j.Action,
+		Url:     j.Url,
+		Volume:  j.Volume,
+		Ramp:    float32(j.Ramp) / float32(time.Millisecond),
+		Power:   j.Power,
+		Missed:  j.Missed,
+		Grace:   int64(j.Grace / time.Second),
+		Enabled: j.Enabled,
+		LastRun: unixTime(j.LastRun),
+	}
+	if j.Enabled {
+		r.NextRun = unixTime(j.Next(time.Now()))
+	}
+	return r
+}
+
+type ResponseQueueItem struct {
+	ID       uint32 `jp:"id"`
+	Url      string `jp:"url"`
+	Title    string `jp:"title,omitempty"`
+	Artist   string `jp:"artist,omitempty"`
+	Duration int    `jp:"dur"` // 秒
+}
+
+type ResponseQueue struct {
+	Line    uint8                `jp:"line"`
+	Current uint32               `jp:"cur"` // 0 表示没有播放
+	Shuffle bool                 `jp:"shuffle"`
+	Repeat  uint8                `jp:"repeat"`
+	Items   []*ResponseQueueItem `jp:"items"`
+}
+
+func NewResponseQueue(q *playlist.Queue) *ResponseQueue {
+	var (
+		state = q.State()
+		items = q.Items()
+	)
+	r := &ResponseQueue{
+		Line:    state.LineID,
+		Current: state.Current,
+		Shuffle: state.Shuffle,
+		Repeat:  state.Repeat,
+		Items:   make([]*ResponseQueueItem, len(items)),
+	}
+	for i, it := range items {
+		r.Items[i] = &ResponseQueueItem{
+			ID:       it.ID,
+			Url:      it.Url,
+			Title:    it.Title,
+			Artist:   it.Artist,
+			Duration: int(it.Duration.Seconds()),
+		}
+	}
+	return r
+}
+
+type ResponseStation struct {
+	ID    uint32 `jp:"id"`
+	Name  string `jp:"name"`
+	Url   string `jp:"url"`
+	Genre string `jp:"genre,omitempty"`
+}
+
+func NewResponseStation(s *playlist.Station) *ResponseStation {
+	if s == nil {
+		return nil
+	}
+	return &ResponseStation{
+		ID:    s.ID,
+		Name:  s.Name,
+		Url:   s.Url,
+		Genre: s.Genre,
+	}
+}
+
+type ResponseTrack struct {
+	ID       uint32 `jp:"id"`
+	Title    string `jp:"title"`
+	Artist   string `jp:"artist,omitempty"`
+	Album    string `jp:"album,omitempty"`
+	Genre    string `jp:"genre,omitempty"`
+	Track    int    `jp:"no,omitempty"`
+	Disc     int    `jp:"disc,omitempty"`
+	Year     int    `jp:"year,omitempty"`
+	Duration int    `jp:"dur"` // 秒
+	Path     string `jp:"path"`
+	Cover    bool   `jp:"cover"` // 通过 /cover?id= 获取
+}
+
+func NewResponseTrack(t *library.Track) *ResponseTrack {
+	if t == nil {
+		return nil
+	}
+	return &ResponseTrack{
+		ID:       t.ID,
+		Title:    t.Name(),
+		Artist:   t.Artist,
+		Album:    t.Album,
+		Genre:    t.Genre,
+		Track:    t.TrackNo,
+		Disc:     t.Disc,
+		Year:     t.Year,
+		Duration: int(t.Duration.Seconds()),
+		Path:     t.Path,
+		Cover:    t.Cover != "",
+	}
+}
+
+func NewResponseTracks(list []library.Track) []*ResponseTrack {
+	tracks := make([]*ResponseTrack, len(list))
+	for i := range list {
+		tracks[i] = NewResponseTrack(&list[i])
+	}
+	return tracks
+}
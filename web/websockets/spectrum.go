@@ -1,17 +1,22 @@
 package websockets
 
 import (
+	"math"
 	"runtime"
 	"sync"
 	"time"
 
+	"github.com/zwcway/castserver-go/common/dsp"
 	"github.com/zwcway/castserver-go/common/speaker"
 	"github.com/zwcway/castserver-go/common/stream"
 	"github.com/zwcway/castserver-go/common/utils"
 	"github.com/zwcway/go-jsonpack"
 )
 
-var ticker = time.NewTicker(50 * time.Millisecond)
+// 频谱的最大帧率，与定时器一致
+const spectrumMaxFPS = 20
+
+var ticker = time.NewTicker(time.Second / spectrumMaxFPS)
 var ctlSignal chan struct{}
 var wg sync.WaitGroup
 var locker sync.Mutex
@@ -22,13 +27,157 @@ type eventService struct {
 	arg int
 	evt Event
 	se  stream.SpectrumElement
+	le  stream.LoudnessElement
+	me  stream.MeterElement
 }
 
 var services = []*eventService{}
 
+// SpectrumOption 每个客户端订阅频谱时的参数
+type SpectrumOption struct {
+	Bands uint8 // 0 为原始频点，否则按 1/Bands 倍频程合并
+	FPS   uint8 // 帧率，0 为最大帧率
+
+	tick int
+}
+
+func (o *SpectrumOption) check() {
+	if !dsp.IsOctaveFractionValid(int(o.Bands)) {
+		o.Bands = 0
+	}
+	if o.FPS == 0 || o.FPS > spectrumMaxFPS {
+		o.FPS = spectrumMaxFPS
+	}
+}
+
+// 本次定时是否需要发送
+func (o *SpectrumOption) due() bool {
+	if o.FPS == 0 {
+		return true
+	}
+	o.tick++
+	if o.tick < spectrumMaxFPS/int(o.FPS) {
+		return false
+	}
+	o.tick = 0
+	return true
+}
+
 type notifySpectrum struct {
-	LevelMeter [2]float32 `jp:"l"`
-	Spectrum   []float32  `jp:"s"`
+	LevelMeter [2]float32         `jp:"l"`
+	Spectrum   []float32          `jp:"s"`
+	Bands      uint8              `jp:"b,omitempty"` // 倍频程合并时频谱和峰值的单位为 dBFS
+	Peaks      []float32          `jp:"p,omitempty"`
+	Meters     []*notifyPeakLevel `jp:"m,omitempty"` // 电平表的峰值
+}
+
+type notifyPeakLevel struct {
+	Channel      int     `jp:"ch"`
+	Peak         float32 `jp:"p"` // dBFS
+	TruePeak     float32 `jp:"tp"`
+	PeakHold     float32 `jp:"ph"`
+	TruePeakHold float32 `jp:"tph"`
+	Clips        int     `jp:"c"` // 超过 0dBFS 的样本数
+}
+
+func newNotifyPeakLevels(me stream.MeterElement) []*notifyPeakLevel {
+	levels := me.Levels()
+	list := make([]*notifyPeakLevel, len(levels))
+	for i, l := range levels {
+		list[i] = &notifyPeakLevel{
+			Channel:      int(l.Channel),
+			Peak:         spectrumDB(l.Peak),
+			TruePeak:     spectrumDB(l.TruePeak),
+			PeakHold:     spectrumDB(l.PeakHold),
+			TruePeakHold: spectrumDB(l.TruePeakHold),
+			Clips:        int(l.Clips),
+		}
+	}
+	return list
+}
+
+type notifyLoudness struct {
+	Line       uint8   `jp:"id"`
+	Momentary  float32 `jp:"m"` // LUFS
+	ShortTerm  float32 `jp:"s"`
+	Integrated float32 `jp:"i"`
+	Gain       float32 `jp:"g"` // dB
+}
+
+// 幅值转换为 dBFS，最低 -120
+func spectrumDB(v float64) float32 {
+	if v <= 1e-6 || math.IsNaN(v) {
+		return -120
+	}
+	return float32(20 * math.Log10(v))
+}
+
+func spectrumMessage(a *eventService, bands uint8) []byte {
+	resp := notifySpectrum{
+		LevelMeter: [2]float32{float32(a.arg), float32(a.se.LevelMeter())},
+	}
+	if a.me != nil {
+		resp.Meters = newNotifyPeakLevels(a.me)
+	}
+
+	if bands == 0 {
+		st := a.se.Spectrum()
+		resp.Spectrum = make([]float32, len(st))
+		for i := 0; i < len(st); i++ {
+			resp.Spectrum[i] = float32(st[i])
+		}
+	} else {
+		levels, peaks := a.se.Bands(int(bands))
+		resp.Bands = bands
+		resp.Spectrum = make([]float32, len(levels))
+		resp.Peaks = make([]float32, len(peaks))
+		for i := range levels {
+			resp.Spectrum[i] = spectrumDB(levels[i])
+		}
+		for i := range peaks {
+			resp.Peaks[i] = spectrumDB(peaks[i])
+		}
+	}
+
+	msg, err := jsonpack.Marshal(resp)
+	if err != nil {
+		return nil
+	}
+	return eventMessage(a.evt, 0, a.arg, msg)
+}
+
+// 按照每个客户端订阅的参数发送频谱，相同参数的消息只生成一次
+func sendSpectrum(a *eventService) {
+	msgs := map[uint8][]byte{}
+
+	for c, evts := range WSHub.broadcast {
+		for i := range evts {
+			e := &evts[i]
+			if e.evt != a.evt || e.arg != a.arg || !e.opt.due() {
+				continue
+			}
+			bands := e.opt.Bands
+			if a.evt == Event_Line_LevelMeter || a.evt == Event_SP_LevelMeter {
+				bands = 0
+			}
+			msg, ok := msgs[bands]
+			if !ok {
+				msg = spectrumMessage(a, bands)
+				msgs[bands] = msg
+			}
+			if msg != nil {
+				c.Write(msg)
+			}
+		}
+	}
+}
+
+// 没有数据时为 -Inf，无法序列化
+func loudnessValue(v float64) float32 {
+	if math.IsInf(v, 0) || math.IsNaN(v) || v < -70 {
+		return -70
+	}
+	return float32(v)
 }
 
 func startSpectumRoutine() {
@@ -75,6 +224,8 @@ func appendSpectrum(evt Event, arg int) {
 		lineSpectrum(&es)
 	case Event_SP_LevelMeter, Event_SP_Spectrum:
 		speakerSpectrum(&es)
+	case Event_Line_Loudness:
+		lineLoudness(&es)
 	default:
 		return
 	}
@@ -101,12 +252,17 @@ func removeSpectrum(evt Event, arg int) {
 	if es.se != nil {
 		es.se.Off()
 	}
+	if es.me != nil {
+		es.me.SetTruePeak(false)
+	}
 
 	switch evt {
 	case Event_Line_Spectrum, Event_Line_LevelMeter:
 		log.Info("stop line spectrum routine")
 	case Event_SP_LevelMeter, Event_SP_Spectrum:
 		log.Info("stop speaker spectrum routine")
+	case Event_Line_Loudness:
+		log.Info("stop line loudness routine")
 	}
 
 }
@@ -119,6 +275,10 @@ func lineSpectrum(es *eventService) {
 	if es.se = line.Input.SpectrumEle; es.se == nil {
 		return
 	}
+	if es.evt == Event_Line_LevelMeter && line.Input.MeterEle != nil {
+		es.me = line.Input.MeterEle
+		es.me.SetTruePeak(true)
+	}
 	if es.se.IsOn() {
 		return
 	}
@@ -127,12 +287,27 @@ func lineSpectrum(es *eventService) {
 	log.Info("start line spectrum")
 }
 
+// 响度元由线路设置控制开关，这里只读取测量值
+func lineLoudness(es *eventService) {
+	line := speaker.FindLineByID(speaker.LineID(es.arg))
+	if line == nil {
+		return
+	}
+	es.le = line.Input.LoudnessEle
+
+	log.Info("start line loudness")
+}
+
 func speakerSpectrum(es *eventService) {
 	sp := speaker.FindSpeakerByID(speaker.SpeakerID(es.arg))
 	if sp == nil || sp.SpectrumEle == nil {
 		return
 	}
 	es.se = sp.SpectrumEle
+	if es.evt == Event_SP_LevelMeter && sp.MeterEle != nil {
+		es.me = sp.MeterEle
+		es.me.SetTruePeak(true)
+	}
 
 	if es.se.IsOn() {
 		return
@@ -168,28 +343,24 @@ func spectrumRoutine() {
 
 		runtime.Gosched()
 		for _, a := range services {
-			if a.se == nil {
+			if a.le != nil {
+				resp := notifyLoudness{
+					Line:       uint8(a.arg),
+					Momentary:  loudnessValue(a.le.Momentary()),
+					ShortTerm:  loudnessValue(a.le.ShortTerm()),
+					Integrated: loudnessValue(a.le.Integrated()),
+					Gain:       float32(a.le.Gain()),
+				}
+				msg, err := jsonpack.Marshal(resp)
+				if err == nil {
+					Broadcast(a.evt, 0, a.arg, msg)
+				}
 				continue
 			}
-			st := a.se.Spectrum()
-
-			// if len(st) == 0 && ls.LevelMeter() == 0 {
-			// 	continue
-			// }
-
-			resp := notifySpectrum{
-				LevelMeter: [2]float32{float32(a.arg), float32(a.se.LevelMeter())},
-				Spectrum:   make([]float32, len(st)),
-			}
-
-			for i := 0; i < len(st); i++ {
-				resp.Spectrum[i] = float32(st[i])
-			}
-
-			msg, err := jsonpack.Marshal(resp)
-			if err == nil {
-				Broadcast(a.evt, 0, a.arg, msg)
+			if a.se == nil {
+				continue
 			}
+			sendSpectrum(a)
 		}
 	}
 }